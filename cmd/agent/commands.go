@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mesh-backend/pkg/agent"
+	"mesh-backend/pkg/config"
+
+	"github.com/rs/zerolog"
+)
+
+// commandUsage 子命令说明，不带子命令时以守护进程方式运行
+const commandUsage = `用法: agent [-config path] [command]
+
+commands:
+  status              通过本地 API 查看运行中 agent 的连接状态、已应用的配置和最近的任务
+  fetch [--dry-run]   从服务端拉取配置并显示与本地文件的差异，不带 --dry-run 时随后应用有变化的文件
+  apply               从服务端拉取配置并强制重写所有文件、重启所有接口和 babeld
+  verify              校验本地的 WireGuard 和 babeld 配置文件，不访问服务端
+  secret set NAME     从标准输入读取值，加密写入 secrets.file，配置中以 secret:NAME 引用
+  secret delete NAME  从 secrets.file 中删除条目
+  secret list         列出 secrets.file 中的条目名称
+`
+
+// runCommand 执行子命令，返回进程退出码
+func runCommand(cfg *config.AgentConfig, name string, args []string) int {
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+
+	var err error
+	switch name {
+	case "status":
+		err = runStatus(cfg)
+	case "fetch":
+		fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "只显示差异，不应用")
+		fs.Parse(args)
+		err = runFetch(cfg, log, *dryRun)
+	case "apply":
+		err = runApply(cfg, log)
+	case "verify":
+		var ok bool
+		ok, err = runVerify(cfg, log)
+		if err == nil && !ok {
+			return 1
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, commandUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runStatus 查询本机运行中 agent 的本地 API
+func runStatus(cfg *config.AgentConfig) error {
+	if !cfg.LocalAPI.Enabled {
+		return fmt.Errorf("local_api is disabled in the agent config")
+	}
+	base := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.LocalAPI.Port))
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	for _, path := range []string{"/health", "/status", "/tasks"} {
+		resp, err := client.Get(base + path)
+		if err != nil {
+			return fmt.Errorf("querying local api (is the agent running?): %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		fmt.Printf("== %s (%s)\n%s\n", path, resp.Status, body)
+	}
+	return nil
+}
+
+// runFetch 拉取配置并显示差异，dryRun 为 false 时应用有变化的文件
+func runFetch(cfg *config.AgentConfig, log zerolog.Logger, dryRun bool) error {
+	handler, err := agent.NewCommandHandler(cfg, log)
+	if err != nil {
+		return err
+	}
+	nodeConfig, err := handler.FetchConfig()
+	if err != nil {
+		return err
+	}
+	changes, err := handler.PlanConfig(nodeConfig)
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for i := range changes {
+		if !changes[i].Changed() {
+			fmt.Printf("unchanged %s\n", changes[i].Path)
+			continue
+		}
+		changed++
+		fmt.Printf("--- %s\n+++ %s (server)\n%s\n", changes[i].Path, changes[i].Path, changes[i].Diff())
+	}
+	fmt.Printf("%d of %d files differ from the server config\n", changed, len(changes))
+
+	if dryRun || changed == 0 {
+		return nil
+	}
+	return handler.ApplyConfig(nodeConfig, false)
+}
+
+// runApply 拉取配置并强制重新应用
+func runApply(cfg *config.AgentConfig, log zerolog.Logger) error {
+	handler, err := agent.NewCommandHandler(cfg, log)
+	if err != nil {
+		return err
+	}
+	nodeConfig, err := handler.FetchConfig()
+	if err != nil {
+		return err
+	}
+	if err := handler.ApplyConfig(nodeConfig, true); err != nil {
+		return err
+	}
+	fmt.Println("configuration re-applied")
+	return nil
+}
+
+// runVerify 校验本地配置文件，有问题时返回 false
+func runVerify(cfg *config.AgentConfig, log zerolog.Logger) (bool, error) {
+	handler, err := agent.NewCommandHandler(cfg, log)
+	if err != nil {
+		return false, err
+	}
+	results, err := handler.VerifyLocalFiles()
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	for _, r := range results {
+		if len(r.Problems) == 0 {
+			fmt.Printf("ok    %s\n", r.Path)
+			continue
+		}
+		ok = false
+		fmt.Printf("FAIL  %s\n", r.Path)
+		for _, p := range r.Problems {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	return ok, nil
+}
+
+// runSecret 管理加密的 secrets 文件，返回进程退出码
+func runSecret(configPath string, args []string) int {
+	if err := secretCommand(configPath, args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func secretCommand(configPath string, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && len(args) != 2) {
+		return fmt.Errorf("usage: agent secret set|delete NAME, agent secret list")
+	}
+	file, machineKey, err := config.LoadAgentSecretsSettings(configPath)
+	if err != nil {
+		return err
+	}
+	secrets, err := config.ReadSecretsFile(file, machineKey, func(msg string) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	case "set":
+		value, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading value: %w", err)
+		}
+		if secrets[args[1]] = strings.TrimSpace(string(value)); secrets[args[1]] == "" {
+			return fmt.Errorf("empty value")
+		}
+	case "delete":
+		if _, ok := secrets[args[1]]; !ok {
+			return fmt.Errorf("secret %s not found", args[1])
+		}
+		delete(secrets, args[1])
+	default:
+		return fmt.Errorf("unknown secret command %q", args[0])
+	}
+	return config.WriteSecretsFile(file, machineKey, secrets)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -21,6 +22,11 @@ func main() {
 	// 命令行参数
 	configPath := flag.String("config", "configs/agent.yaml", "配置文件路径")
 	version := flag.Bool("version", false, "显示版本信息")
+	once := flag.Bool("once", false, "以 standalone 模式运行：拉取并应用一次配置后退出")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), commandUsage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// 显示版本信息
@@ -36,6 +42,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// secrets 文件中的条目可能正是配置所引用的，在加载完整配置之前处理
+	if flag.Arg(0) == "secret" {
+		os.Exit(runSecret(*configPath, flag.Args()[1:]))
+	}
+
 	// 加载配置
 	cfg, err := config.LoadAgentConfig(*configPath, workspaceRoot)
 	if err != nil {
@@ -43,12 +54,51 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 初始化日志
-	log, err := logger.NewLogger(cfg.Runtime.LogPath, cfg.Runtime.LogLevel)
+	// 子命令用于人工排查和应急恢复，执行后退出
+	if flag.NArg() > 0 {
+		for _, warning := range cfg.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		os.Exit(runCommand(cfg, flag.Arg(0), flag.Args()[1:]))
+	}
+
+	// 初始化日志，启用日志上传时同时写入上传队列
+	var shipper *agent.LogShipper
+	var extra []io.Writer
+	if cfg.LogShipping.Enabled {
+		shipper = agent.NewLogShipper(cfg.LogShipping.BufferSize)
+		extra = append(extra, shipper)
+	}
+	log, err := logger.NewLogger(logger.Config{
+		File:       cfg.Runtime.LogPath,
+		Level:      cfg.Runtime.LogLevel,
+		MaxSize:    cfg.Runtime.LogMaxSize,
+		MaxBackups: cfg.Runtime.LogMaxBackups,
+		MaxAge:     cfg.Runtime.LogMaxAge,
+		Compress:   cfg.Runtime.LogCompress,
+		Format:     cfg.Runtime.LogFormat,
+		Components: cfg.Runtime.LogComponents,
+		Sampling: logger.Sampling{
+			Burst:  cfg.Runtime.LogSampleBurst,
+			Period: cfg.Runtime.LogSamplePeriod,
+		},
+	}, extra...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
 		os.Exit(1)
 	}
+	for _, warning := range cfg.Warnings {
+		log.Warn().Msg(warning)
+	}
+
+	// standalone 模式：只通过 HTTP 拉取并应用一次配置，失败时以非零退出码退出，便于 cron 告警
+	if *once || cfg.Runtime.Standalone {
+		if err := agent.RunOnce(cfg, *log); err != nil {
+			log.Error().Err(err).Msg("Standalone run failed")
+			os.Exit(1)
+		}
+		return
+	}
 
 	// 创建Agent实例
 	agent, err := agent.New(cfg, *log)
@@ -56,6 +106,9 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error creating agent: %v\n", err)
 		os.Exit(1)
 	}
+	if shipper != nil {
+		agent.SetLogShipper(shipper)
+	}
 
 	// 启动Agent
 	if err := agent.Start(); err != nil {
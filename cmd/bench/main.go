@@ -0,0 +1,310 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"mesh-backend/pkg/e2e"
+	"mesh-backend/pkg/logger"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+)
+
+// result 单个网格规模的测试结果
+type result struct {
+	size int
+
+	createTotal time.Duration // 创建全部节点耗时
+	configLat   []time.Duration
+	configErrs  int
+	fanOut      time.Duration // 新增节点后所有现有节点收到更新任务的耗时
+	fanOutErr   error
+}
+
+func main() {
+	// 命令行参数
+	sizes := flag.String("sizes", "10,25,50", "网格规模（节点数），逗号分隔")
+	concurrency := flag.Int("concurrency", 8, "拉取配置的并发数")
+	rounds := flag.Int("rounds", 3, "每个节点拉取配置的次数")
+	timeout := flag.Duration("timeout", 30*time.Second, "等待任务下发的超时时间")
+	storage := flag.String("storage", "memory", "存储类型 (memory/sqlite)")
+	sqlitePath := flag.String("sqlite-path", "", "SQLite 数据库路径，为空时使用临时文件")
+	logLevel := flag.String("log-level", "", "服务端日志级别，为空时不输出日志")
+	version := flag.Bool("version", false, "显示版本信息")
+	flag.Parse()
+
+	// 显示版本信息
+	if *version {
+		fmt.Printf("mesh-bench version %s (built at %s)\n", Version, BuildTime)
+		os.Exit(0)
+	}
+
+	meshSizes, err := parseSizes(*sizes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing sizes: %v\n", err)
+		os.Exit(1)
+	}
+
+	var log *zerolog.Logger
+	if *logLevel != "" {
+		l, err := logger.NewLogger(logger.Config{Level: *logLevel})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
+			os.Exit(1)
+		}
+		log = l
+	}
+
+	results := make([]*result, 0, len(meshSizes))
+	for _, size := range meshSizes {
+		cfg := e2e.DefaultConfig()
+		// 临时数据库目录在每轮结束时删除，os.Exit 不会执行 defer
+		var tempDir string
+		if *storage == "sqlite" {
+			path := *sqlitePath
+			if path == "" {
+				dir, err := os.MkdirTemp("", "mesh-bench-")
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error creating temp dir: %v\n", err)
+					os.Exit(1)
+				}
+				tempDir = dir
+				path = fmt.Sprintf("%s/bench-%d.db", dir, size)
+			}
+			cfg.Storage.Type = "sqlite"
+			cfg.Storage.SQLite.Path = path
+		}
+
+		fmt.Fprintf(os.Stderr, "Running mesh size %d...\n", size)
+		r, err := run(e2e.Options{Config: cfg, Logger: log}, size, *concurrency, *rounds, *timeout)
+		if tempDir != "" {
+			os.RemoveAll(tempDir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running mesh size %d: %v\n", size, err)
+			os.Exit(1)
+		}
+		results = append(results, r)
+	}
+
+	report(os.Stdout, results)
+}
+
+// run 在进程内启动服务端并测量指定规模的网格
+func run(opts e2e.Options, size, concurrency, rounds int, timeout time.Duration) (*result, error) {
+	h, err := e2e.Start(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	r := &result{size: size}
+
+	// 节点创建吞吐量
+	type created struct {
+		id    int
+		token string
+	}
+	nodes := make([]created, 0, size)
+	start := time.Now()
+	for i := 0; i < size; i++ {
+		id, token, err := h.CreateNode(fmt.Sprintf("bench-node-%d", i+1), fmt.Sprintf("198.18.%d.%d", (i+1)/250, (i+1)%250+1))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, created{id: id, token: token})
+	}
+	r.createTotal = time.Since(start)
+
+	agents := make([]*e2e.FakeAgent, 0, size)
+	for _, node := range nodes {
+		agents = append(agents, e2e.NewFakeAgent(h.Client, h.Addr, node.id, node.token))
+	}
+
+	// 配置生成延迟，首轮包含连接分配，后续轮次反映缓存命中情况
+	if err := waitRolloutIdle(h, timeout); err != nil {
+		return nil, fmt.Errorf("waiting for rollout: %w", err)
+	}
+	r.configLat, r.configErrs = fetchConfigs(agents, concurrency, rounds)
+
+	// 任务扇出时间
+	for _, agent := range agents {
+		if err := agent.Connect(); err != nil {
+			return nil, fmt.Errorf("connecting agent %d: %w", agent.NodeID, err)
+		}
+	}
+	defer func() {
+		for _, agent := range agents {
+			agent.Disconnect()
+		}
+	}()
+	r.fanOut, r.fanOutErr = measureFanOut(h, agents, timeout)
+
+	return r, nil
+}
+
+// fetchConfigs 并发拉取所有节点的配置，返回每次请求的延迟和失败次数
+func fetchConfigs(agents []*e2e.FakeAgent, concurrency, rounds int) ([]time.Duration, int) {
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		errs      int
+	)
+
+	for round := 0; round < rounds; round++ {
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, agent := range agents {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(agent *e2e.FakeAgent) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				start := time.Now()
+				err := agent.FetchConfig()
+				elapsed := time.Since(start)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs++
+					return
+				}
+				latencies = append(latencies, elapsed)
+			}(agent)
+		}
+		wg.Wait()
+	}
+
+	return latencies, errs
+}
+
+// measureFanOut 新增一个节点，测量所有现有节点收到配置更新任务的耗时
+func measureFanOut(h *e2e.Harness, agents []*e2e.FakeAgent, timeout time.Duration) (time.Duration, error) {
+	// 等待订阅流在服务端就绪，避免把连接建立时间计入扇出时间
+	if err := waitSubscribed(h, agents, timeout); err != nil {
+		return 0, err
+	}
+	if err := waitRolloutIdle(h, timeout); err != nil {
+		return 0, err
+	}
+
+	before := make([]int, len(agents))
+	for i, agent := range agents {
+		before[i] = len(agent.Tasks())
+	}
+
+	start := time.Now()
+	if _, _, err := h.CreateNode("bench-fanout", "198.18.255.254"); err != nil {
+		return 0, err
+	}
+	err := e2e.Eventually(timeout, func() bool {
+		for i, agent := range agents {
+			if len(agent.Tasks()) <= before[i] {
+				return false
+			}
+		}
+		return true
+	})
+	return time.Since(start), err
+}
+
+// waitSubscribed 等待所有 agent 的订阅流在服务端就绪，服务端未就绪时触发配置更新会失败
+func waitSubscribed(h *e2e.Harness, agents []*e2e.FakeAgent, timeout time.Duration) error {
+	for _, agent := range agents {
+		before := len(agent.Tasks())
+		err := e2e.Eventually(timeout, func() bool {
+			return h.TriggerConfigUpdate(agent.NodeID) == nil
+		})
+		if err == nil {
+			err = e2e.Eventually(timeout, func() bool { return len(agent.Tasks()) > before })
+		}
+		if err != nil {
+			return fmt.Errorf("node %d not subscribed: %w", agent.NodeID, err)
+		}
+	}
+	return nil
+}
+
+// waitRolloutIdle 等待配置下发队列清空
+func waitRolloutIdle(h *e2e.Harness, timeout time.Duration) error {
+	return e2e.Eventually(timeout, func() bool {
+		var progress struct {
+			Queued   int `json:"queued"`
+			InFlight int `json:"in_flight"`
+		}
+		if err := h.Do("GET", "/api/v1/dashboard/rollout", nil, &progress); err != nil {
+			return false
+		}
+		return progress.Queued == 0 && progress.InFlight == 0
+	})
+}
+
+// report 输出测试报告
+func report(out *os.File, results []*result) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "nodes\tcreate\tnodes/s\tcfg p50\tcfg p90\tcfg p99\tcfg max\tcfg errs\tfan-out\t")
+	for _, r := range results {
+		fanOut := r.fanOut.Round(time.Millisecond).String()
+		if r.fanOutErr != nil {
+			fanOut = "timeout"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%.1f\t%s\t%s\t%s\t%s\t%d\t%s\t\n",
+			r.size,
+			r.createTotal.Round(time.Millisecond),
+			float64(r.size)/r.createTotal.Seconds(),
+			percentile(r.configLat, 0.50),
+			percentile(r.configLat, 0.90),
+			percentile(r.configLat, 0.99),
+			percentile(r.configLat, 1),
+			r.configErrs,
+			fanOut,
+		)
+	}
+	w.Flush()
+}
+
+// percentile 计算延迟分位数
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx].Round(time.Microsecond)
+}
+
+// parseSizes 解析逗号分隔的网格规模
+func parseSizes(s string) ([]int, error) {
+	var sizes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid mesh size %q", part)
+		}
+		sizes = append(sizes, n)
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no mesh sizes given")
+	}
+	return sizes, nil
+}
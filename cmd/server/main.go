@@ -51,11 +51,20 @@ func main() {
 	}
 
 	// 初始化日志
-	logLevel := "debug"
-	if !cfg.Log.Debug {
-		logLevel = "info"
-	}
-	log, err := logger.NewLogger(cfg.Log.File, logLevel)
+	log, err := logger.NewLogger(logger.Config{
+		File:       cfg.Log.File,
+		Level:      cfg.Log.Level,
+		MaxSize:    cfg.Log.MaxSize,
+		MaxBackups: cfg.Log.MaxBackups,
+		MaxAge:     cfg.Log.MaxAge,
+		Compress:   cfg.Log.Compress,
+		Format:     cfg.Log.Format,
+		Components: cfg.Log.Components,
+		Sampling: logger.Sampling{
+			Burst:  cfg.Log.Sampling.Burst,
+			Period: cfg.Log.Sampling.Period,
+		},
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"mesh-backend/pkg/e2e"
+	"mesh-backend/pkg/logger"
+)
+
+var (
+	Version   = "dev"
+	BuildTime = "unknown"
+)
+
+// stats 模拟运行统计
+type stats struct {
+	reports     atomic.Int64
+	reportErrs  atomic.Int64
+	reconnects  atomic.Int64
+	connectErrs atomic.Int64
+}
+
+func main() {
+	// 命令行参数
+	serverURL := flag.String("server", "http://127.0.0.1:8080", "服务端 HTTP 地址")
+	grpcAddr := flag.String("grpc", "127.0.0.1:8080", "服务端 gRPC 地址")
+	username := flag.String("username", "admin", "用于创建节点的管理员用户名")
+	password := flag.String("password", "", "管理员密码")
+	agents := flag.Int("agents", 100, "模拟 agent 数量")
+	statusInterval := flag.Duration("status-interval", 30*time.Second, "状态上报间隔")
+	reconnectDelay := flag.Duration("reconnect-delay", 5*time.Second, "订阅流断开后的重连延迟")
+	dropRate := flag.Float64("drop-rate", 0, "收到任务后断开订阅流的概率")
+	ackDelay := flag.Duration("ack-delay", 0, "回报任务结果前的随机延迟上限")
+	ackDropRate := flag.Float64("ack-drop-rate", 0, "不回报任务结果的概率")
+	bogusRate := flag.Float64("bogus-metrics-rate", 0, "上报异常指标的概率")
+	logLevel := flag.String("log-level", "info", "日志级别")
+	version := flag.Bool("version", false, "显示版本信息")
+	flag.Parse()
+
+	// 显示版本信息
+	if *version {
+		fmt.Printf("mesh-simulator version %s (built at %s)\n", Version, BuildTime)
+		os.Exit(0)
+	}
+
+	log, err := logger.NewLogger(logger.Config{Level: *logLevel})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	client := e2e.NewClient(*serverURL)
+	if err := client.Login(*username, *password); err != nil {
+		fmt.Fprintf(os.Stderr, "Error logging in: %v\n", err)
+		os.Exit(1)
+	}
+
+	faults := e2e.Faults{
+		DropStreamRate:   *dropRate,
+		AckDelay:         *ackDelay,
+		AckDropRate:      *ackDropRate,
+		BogusMetricsRate: *bogusRate,
+	}
+
+	// 创建节点并接入模拟 agent
+	var st stats
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	fleet := make([]*e2e.FakeAgent, 0, *agents)
+	for i := 0; i < *agents; i++ {
+		name := fmt.Sprintf("sim-%d-%d", time.Now().Unix(), i+1)
+		endpoint := fmt.Sprintf("198.18.%d.%d", (i+1)/250, (i+1)%250+1)
+		nodeID, token, err := client.CreateNode(name, endpoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating node: %v\n", err)
+			os.Exit(1)
+		}
+
+		agent := e2e.NewFakeAgent(client, *grpcAddr, nodeID, token)
+		agent.Faults = faults
+		if err := agent.Connect(); err != nil {
+			log.Warn().Err(err).Int("node_id", nodeID).Msg("Initial connect failed")
+			st.connectErrs.Add(1)
+		}
+		fleet = append(fleet, agent)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runAgent(agent, *statusInterval, *reconnectDelay, stopCh, &st)
+		}()
+	}
+
+	log.Info().
+		Int("agents", len(fleet)).
+		Interface("faults", faults).
+		Msg("Simulator started")
+
+	// 定期输出统计
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		select {
+		case <-ticker.C:
+			connected, tasks, taskErrs := 0, 0, 0
+			for _, agent := range fleet {
+				if agent.Connected() {
+					connected++
+				}
+				tasks += len(agent.Tasks())
+				taskErrs += len(agent.Errors())
+			}
+			log.Info().
+				Int("connected", connected).
+				Int("tasks", tasks).
+				Int("task_errors", taskErrs).
+				Int64("reports", st.reports.Load()).
+				Int64("report_errors", st.reportErrs.Load()).
+				Int64("reconnects", st.reconnects.Load()).
+				Int64("connect_errors", st.connectErrs.Load()).
+				Msg("Simulator stats")
+		case <-sigCh:
+			close(stopCh)
+			wg.Wait()
+			for _, agent := range fleet {
+				agent.Disconnect()
+			}
+			return
+		}
+	}
+}
+
+// runAgent 定期上报状态，订阅流断开时延迟重连
+func runAgent(agent *e2e.FakeAgent, statusInterval, reconnectDelay time.Duration, stopCh <-chan struct{}, st *stats) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// 错开各 agent 的首次上报时间
+	nextReport := time.Now().Add(time.Duration(rand.Int63n(int64(statusInterval))))
+	var disconnectedAt time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+
+		if !agent.Connected() {
+			if disconnectedAt.IsZero() {
+				disconnectedAt = time.Now()
+			}
+			if time.Since(disconnectedAt) < reconnectDelay {
+				continue
+			}
+			st.reconnects.Add(1)
+			if err := agent.Reconnect(); err != nil {
+				st.connectErrs.Add(1)
+				disconnectedAt = time.Now()
+				continue
+			}
+			disconnectedAt = time.Time{}
+		}
+
+		if time.Now().Before(nextReport) {
+			continue
+		}
+		nextReport = time.Now().Add(statusInterval)
+		st.reports.Add(1)
+		if err := agent.ReportStatus("online"); err != nil {
+			st.reportErrs.Add(1)
+		}
+	}
+}
@@ -3,15 +3,21 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	lpb "mesh-backend/api/proto/logs"
 	spb "mesh-backend/api/proto/status"
 	pb "mesh-backend/api/proto/task"
 	"mesh-backend/pkg/agent/handlers"
 	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/utils/clock"
+	"mesh-backend/pkg/utils/proxy"
 
 	"github.com/rs/zerolog"
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -21,6 +27,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip" // 注册 gzip 压缩器
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -37,6 +44,13 @@ type Agent struct {
 	// 任务处理
 	taskHandler *handlers.TaskHandler
 
+	// 连接服务端的拨号函数和 HTTP 客户端，按代理和 TLS 配置创建
+	dial       proxy.DialFunc
+	httpClient *http.Client
+
+	// 客户端证书，未配置时为空
+	certs *certManager
+
 	// 状态管理
 	hostname     string
 	ipAddress    string
@@ -45,6 +59,26 @@ type Agent struct {
 	// 控制
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// 日志上传，未启用时为空
+	logShipper *LogShipper
+
+	// 连接状态和本地 API，未启用本地 API 时 localAPI 为空
+	health   agentHealth
+	localAPI *http.Server
+
+	// 时间源，测试中可替换
+	clock clock.Clock
+
+	// 故障切换后各接口使用的端点，键为接口名，值为 switchedEndpoint
+	switched sync.Map
+
+	// agent 所在的 cgroup v2，不可用或配置为 never 时为空
+	cgroup *cgroup
+
+	// 最近采集的组件版本及采集时间，只在状态上报的协程中访问
+	software   *spb.SoftwareVersions
+	softwareAt time.Time
 }
 
 // New 创建新的Agent实例
@@ -63,18 +97,52 @@ func New(cfg *config.AgentConfig, logger zerolog.Logger) (*Agent, error) {
 		cancel:    cancel,
 		hostname:  hostname,
 		ipAddress: cfg.Server.GRPCAddress, // 临时使用服务器地址，实际应该获取本机IP
+		clock:     clock.Real(),
 	}, nil
 }
 
+// SetClock 替换时间源，需在 Start 之前调用
+func (a *Agent) SetClock(c clock.Clock) {
+	a.clock = c
+}
+
+// SetLogShipper 设置日志上传器，需在 Start 之前调用
+func (a *Agent) SetLogShipper(s *LogShipper) {
+	a.logShipper = s
+}
+
 // Start 启动Agent
 func (a *Agent) Start() error {
+	a.setupResources()
+
+	if err := a.setupTransport(); err != nil {
+		return err
+	}
+
+	// 本地 API 先于连接服务端启动，连接失败时也能查看状态
+	if a.config.LocalAPI.Enabled {
+		if err := a.startLocalAPI(); err != nil {
+			return fmt.Errorf("starting local api: %w", err)
+		}
+	}
+
+	// 申请或续期客户端证书，失败时仍可使用令牌认证
+	if a.certs != nil {
+		if a.certs.needsRenewal(a.clock.Now()) {
+			if err := a.enroll(); err != nil {
+				a.logger.Warn().Err(err).Msg("Failed to obtain client certificate")
+			}
+		}
+		go a.renewCertificateLoop()
+	}
+
 	// 连接gRPC服务器
 	if err := a.connect(); err != nil {
 		return fmt.Errorf("connecting to server: %w", err)
 	}
 
 	// 初始化任务处理器
-	a.taskHandler = handlers.NewTaskHandler(a.config, a.logger, a.client, a.ctx)
+	a.taskHandler = handlers.NewTaskHandler(a.config, a.logger, a.client, a.httpClient, a.ctx)
 	a.taskHandler.Start()
 
 	// 注册节点
@@ -90,12 +158,34 @@ func (a *Agent) Start() error {
 	// 启动状态上报
 	go a.startStatusReporting()
 
+	// 启动端点故障切换
+	if a.config.Failover.Enabled {
+		go a.failoverLoop()
+	}
+
+	// 重新解析域名端点
+	if a.config.Endpoints.ResolveInterval > 0 {
+		go a.resolveLoop()
+	}
+
+	// 启动日志上传
+	if a.logShipper != nil {
+		shipLogger := a.logger.With().Str("component", "logship").Logger()
+		go a.logShipper.run(a.ctx, func() lpb.LogServiceClient {
+			return lpb.NewLogServiceClient(a.conn)
+		}, int32(a.config.NodeID), a.config.Token, shipLogger)
+		if a.config.LogShipping.Journald {
+			go a.logShipper.followJournald(a.ctx, shipLogger)
+		}
+	}
+
 	return nil
 }
 
 // Stop 停止Agent
 func (a *Agent) Stop() error {
 	a.cancel()
+	a.stopLocalAPI()
 	if a.conn != nil {
 		return a.conn.Close()
 	}
@@ -104,11 +194,13 @@ func (a *Agent) Stop() error {
 
 // startStatusReporting 开始定期上报状态
 func (a *Agent) startStatusReporting() {
-	ticker := time.NewTicker(30 * time.Second) // 每30秒上报一次状态
+	ticker := a.clock.NewTicker(statusReportInterval)
 	defer ticker.Stop()
 
 	// 首次立即上报
-	if err := a.reportStatus(); err != nil {
+	err := a.reportStatus()
+	a.health.setReport(err, a.clock.Now())
+	if err != nil {
 		a.logger.Error().Err(err).Msg("Initial status report failed")
 	}
 
@@ -116,8 +208,10 @@ func (a *Agent) startStatusReporting() {
 		select {
 		case <-a.ctx.Done():
 			return
-		case <-ticker.C:
-			if err := a.reportStatus(); err != nil {
+		case <-ticker.C():
+			err := a.reportStatus()
+			a.health.setReport(err, a.clock.Now())
+			if err != nil {
 				a.logger.Error().Err(err).Msg("Status report failed")
 			}
 		}
@@ -130,6 +224,7 @@ func (a *Agent) reportStatus() error {
 	if err != nil {
 		return fmt.Errorf("collecting metrics: %w", err)
 	}
+	wireguard, babel := a.collectMeshStatus()
 
 	status := &spb.NodeStatus{
 		NodeId:       int32(a.config.NodeID),
@@ -139,7 +234,10 @@ func (a *Agent) reportStatus() error {
 		RunningTasks: a.runningTasks,
 		Status:       "online",
 		Version:      runtime.Version(),
-		Timestamp:    time.Now().UnixNano(),
+		Timestamp:    a.clock.Now().UnixNano(),
+		Wireguard:    wireguard,
+		Babel:        babel,
+		Software:     a.softwareVersions(),
 	}
 
 	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Second)
@@ -162,14 +260,8 @@ func (a *Agent) reportStatus() error {
 	return nil
 }
 
-// collectMetrics 收集系统指标
+// collectMetrics 收集系统指标，agent 运行在设有限额的 cgroup 中时 CPU 和内存按 cgroup 统计
 func (a *Agent) collectMetrics() (*spb.SystemMetrics, error) {
-	// CPU使用率
-	cpuPercent, err := cpu.Percent(time.Second, false)
-	if err != nil {
-		return nil, fmt.Errorf("getting CPU usage: %w", err)
-	}
-
 	// 内存使用率
 	memInfo, err := mem.VirtualMemory()
 	if err != nil {
@@ -188,28 +280,36 @@ func (a *Agent) collectMetrics() (*spb.SystemMetrics, error) {
 		return nil, fmt.Errorf("getting host info: %w", err)
 	}
 
-	return &spb.SystemMetrics{
-		CpuUsage:    cpuPercent[0],
+	metrics := &spb.SystemMetrics{
 		MemoryUsage: memInfo.UsedPercent,
 		DiskUsage:   diskInfo.UsedPercent,
 		Uptime:      int64(hostInfo.Uptime),
-	}, nil
+	}
+	if a.useCgroupMetrics() {
+		if err := a.collectCgroupMetrics(metrics, memInfo.Total); err != nil {
+			return nil, err
+		}
+		return metrics, nil
+	}
+
+	// CPU使用率
+	cpuPercent, err := cpu.Percent(time.Second, false)
+	if err != nil {
+		return nil, fmt.Errorf("getting CPU usage: %w", err)
+	}
+	metrics.CpuUsage = cpuPercent[0]
+	return metrics, nil
 }
 
 // connect 连接到gRPC服务器
 func (a *Agent) connect() error {
 	var creds credentials.TransportCredentials
 	if a.config.Server.TLS.Enabled {
-		var err error
-		// 目录为空
-		if a.config.Server.TLS.CACert == "" {
-			creds = credentials.NewTLS(nil)
-		} else {
-			creds, err = credentials.NewClientTLSFromFile(a.config.Server.TLS.CACert, "")
-		}
+		tlsCfg, err := a.tlsConfig()
 		if err != nil {
-			return fmt.Errorf("loading CA cert: %w", err)
+			return fmt.Errorf("loading TLS config: %w", err)
 		}
+		creds = credentials.NewTLS(tlsCfg)
 	} else {
 		creds = insecure.NewCredentials()
 		a.logger.Warn().Msg("TLS is disabled")
@@ -219,6 +319,9 @@ func (a *Agent) connect() error {
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(creds),
 		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return a.dial(ctx, "tcp", addr)
+		}),
 		grpc.WithKeepaliveParams(keepalive.ClientParameters{
 			Time:                10 * time.Second,
 			Timeout:             3 * time.Second,
@@ -238,9 +341,19 @@ func (a *Agent) connect() error {
 		}`),
 	}
 
+	if a.config.Server.Compression != "" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(a.config.Server.Compression)))
+	}
+
+	// 经由代理时由代理解析服务端域名，跳过 gRPC 的 DNS 解析
+	target := a.config.Server.GRPCAddress
+	if a.config.Server.Proxy != "" {
+		target = "passthrough:///" + target
+	}
+
 	// 连接服务器
 	client, err := grpc.NewClient(
-		a.config.Server.GRPCAddress,
+		target,
 		opts...,
 	)
 	if err != nil {
@@ -259,8 +372,9 @@ func (a *Agent) register() error {
 	defer cancel()
 
 	resp, err := a.client.Register(ctx, &pb.RegisterRequest{
-		NodeId: int32(a.config.NodeID),
-		Token:  a.config.Token,
+		NodeId:       int32(a.config.NodeID),
+		Token:        a.config.Token,
+		Capabilities: a.probeCapabilities(),
 	})
 	if err != nil {
 		return err
@@ -269,6 +383,9 @@ func (a *Agent) register() error {
 	if !resp.Success {
 		return fmt.Errorf("registration failed: %s", resp.Message)
 	}
+	for _, warning := range resp.Warnings {
+		a.logger.Warn().Str("problem", warning).Msg("Server reported missing capability")
+	}
 
 	return nil
 }
@@ -283,6 +400,7 @@ func (a *Agent) subscribeTasks() error {
 		return err
 	}
 
+	a.health.setStream(true, nil, a.clock.Now())
 	go a.handleTaskStream(stream)
 	return nil
 }
@@ -293,6 +411,7 @@ func (a *Agent) handleTaskStream(stream pb.TaskService_SubscribeTasksClient) {
 		task, err := stream.Recv()
 		if err != nil {
 			a.logger.Error().Err(err).Msg("Task stream error")
+			a.health.setStream(false, err, a.clock.Now())
 
 			// 检查是否是节点未注册错误
 			if strings.Contains(err.Error(), "node not registered") {
@@ -300,20 +419,20 @@ func (a *Agent) handleTaskStream(stream pb.TaskService_SubscribeTasksClient) {
 				// 尝试重新注册
 				if err := a.register(); err != nil {
 					a.logger.Error().Err(err).Msg("Failed to re-register")
-					time.Sleep(5 * time.Second)
+					a.clock.Sleep(5 * time.Second)
 					continue
 				}
 				// 重新订阅任务
 				if err := a.subscribeTasks(); err != nil {
 					a.logger.Error().Err(err).Msg("Failed to re-subscribe tasks")
-					time.Sleep(5 * time.Second)
+					a.clock.Sleep(5 * time.Second)
 					continue
 				}
 				return
 			}
 
 			// 其他错误，尝试重新连接
-			time.Sleep(5 * time.Second)
+			a.clock.Sleep(5 * time.Second)
 			if err := a.reconnect(); err != nil {
 				a.logger.Error().Err(err).Msg("Failed to reconnect")
 				continue
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"os/exec"
+	"regexp"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/types"
+)
+
+// versionPattern 匹配工具输出中的第一个点分版本号，如 babeld-1.13.1、v1.0.20210914、2.0.8
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// probeCapabilities 检测本地的 babeld、wg 和 bird 是否可用及其版本，注册时上报给服务端
+func (a *Agent) probeCapabilities() []*pb.Capability {
+	babeld := a.config.Babel.BinPath
+	if babeld == "" {
+		babeld = "babeld"
+	}
+	probes := []struct {
+		name string
+		args []string
+	}{
+		{types.CapabilityBabeld, []string{babeld, "-V"}},
+		{types.CapabilityWireGuard, []string{"wg", "--version"}},
+		{types.CapabilityBird, []string{"bird", "--version"}},
+	}
+
+	caps := make([]*pb.Capability, 0, len(probes))
+	for _, probe := range probes {
+		c := &pb.Capability{Name: probe.name}
+		if _, err := exec.LookPath(probe.args[0]); err == nil {
+			c.Available = true
+			c.Version = toolVersion(probe.args[0], probe.args[1:]...)
+		}
+		caps = append(caps, c)
+		a.logger.Debug().
+			Str("tool", c.Name).
+			Bool("available", c.Available).
+			Str("version", c.Version).
+			Msg("Probed local tool")
+	}
+	return caps
+}
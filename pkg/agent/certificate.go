@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certCheckInterval 检查客户端证书是否需要续期的间隔
+const certCheckInterval = time.Hour
+
+// certManager 管理 agent 的客户端证书
+//
+// 证书由服务端内置 CA 签发，剩余有效期不足 1/3 时重新申请。新证书在下次建立连接时生效。
+type certManager struct {
+	certPath string
+	keyPath  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertManager 创建证书管理器并加载已有证书，文件不存在时不报错
+func newCertManager(certPath, keyPath string) (*certManager, error) {
+	m := &certManager{certPath: certPath, keyPath: keyPath}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	switch {
+	case err == nil:
+		m.cert = &cert
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+	return m, nil
+}
+
+// getClientCertificate 实现 tls.Config.GetClientCertificate，没有证书时发送空证书
+func (m *certManager) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return m.cert, nil
+}
+
+// needsRenewal 判断是否需要申请新证书
+func (m *certManager) needsRenewal(now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return true
+	}
+	leaf, err := x509.ParseCertificate(m.cert.Certificate[0])
+	if err != nil {
+		return true
+	}
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return now.After(leaf.NotAfter.Add(-lifetime / 3))
+}
+
+// store 保存新证书和私钥并替换当前证书
+func (m *certManager) store(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("parsing issued certificate: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.keyPath), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.keyPath, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("writing client key: %w", err)
+	}
+	if err := os.WriteFile(m.certPath, certPEM, 0o644); err != nil {
+		return fmt.Errorf("writing client certificate: %w", err)
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	return nil
+}
+
+// enroll 生成新私钥和 CSR，向服务端申请证书
+//
+// 已有有效证书时由 TLS 握手携带证书认证，否则使用令牌认证。
+func (a *Agent) enroll() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "node-" + strconv.Itoa(a.config.NodeID)},
+	}, key)
+	if err != nil {
+		return fmt.Errorf("creating certificate request: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})),
+	})
+	url := fmt.Sprintf("%s/api/v1/auth/node/certificate", a.config.Server.Address)
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	auth := fmt.Sprintf("%d:%s", a.config.NodeID, a.config.Token)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting certificate: unexpected status code %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Certificate string `json:"certificate"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("decoding certificate response: %w", err)
+	}
+	if err := a.certs.store([]byte(result.Certificate), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})); err != nil {
+		return err
+	}
+
+	a.logger.Info().Str("expires_at", result.ExpiresAt).Msg("Obtained client certificate")
+	return nil
+}
+
+// renewCertificateLoop 定期检查客户端证书，临近过期时重新申请
+func (a *Agent) renewCertificateLoop() {
+	ticker := a.clock.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C():
+			if !a.certs.needsRenewal(a.clock.Now()) {
+				continue
+			}
+			if err := a.enroll(); err != nil {
+				a.logger.Error().Err(err).Msg("Failed to renew client certificate")
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+)
+
+// cgroupRoot cgroup v2 的挂载点
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup agent 所在的 cgroup v2
+type cgroup struct {
+	dir string
+}
+
+// cgroupCPUStat cpu.stat 中的累计值
+type cgroupCPUStat struct {
+	usageUsec uint64
+	periods   uint64
+	throttled uint64
+}
+
+// detectCgroup 查找 agent 所在的 cgroup v2，主机只挂载了 cgroup v1 时返回错误
+func detectCgroup() (*cgroup, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	// cgroup v2 的条目为 "0::/path"；启用 cgroup 命名空间的容器中为 "0::/"，挂载点即容器自身的 cgroup
+	for _, line := range strings.Split(string(data), "\n") {
+		path, ok := strings.CutPrefix(line, "0::")
+		if !ok {
+			continue
+		}
+		dir := filepath.Join(cgroupRoot, path)
+		if _, err := os.Stat(filepath.Join(dir, "cpu.stat")); err != nil {
+			return nil, fmt.Errorf("cgroup v2 controller files not found in %s: %w", dir, err)
+		}
+		return &cgroup{dir: dir}, nil
+	}
+	return nil, fmt.Errorf("not running in a cgroup v2 hierarchy")
+}
+
+// cpuLimit 返回 cpu.max 限定的核数，不限或根 cgroup 时为 0
+func (g *cgroup) cpuLimit() float64 {
+	data, err := os.ReadFile(filepath.Join(g.dir, "cpu.max"))
+	if err != nil {
+		return 0
+	}
+	// 格式为 "$MAX $PERIOD"，不限时 $MAX 为 max
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || period <= 0 {
+		return 0
+	}
+	return quota / period
+}
+
+// memoryLimit 返回 memory.max 限定的字节数，不限或根 cgroup 时为 0
+func (g *cgroup) memoryLimit() int64 {
+	data, err := os.ReadFile(filepath.Join(g.dir, "memory.max"))
+	if err != nil {
+		return 0
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// limited cgroup 是否设有 CPU 或内存限额
+func (g *cgroup) limited() bool {
+	return g.cpuLimit() > 0 || g.memoryLimit() > 0
+}
+
+// cpuStat 读取 cpu.stat
+func (g *cgroup) cpuStat() (cgroupCPUStat, error) {
+	var stat cgroupCPUStat
+	fields, err := readKeyValues(filepath.Join(g.dir, "cpu.stat"))
+	if err != nil {
+		return stat, err
+	}
+	stat.usageUsec = fields["usage_usec"]
+	stat.periods = fields["nr_periods"]
+	stat.throttled = fields["nr_throttled"]
+	return stat, nil
+}
+
+// memoryUsage 返回 cgroup 的内存用量，与 docker stats 一致，不计入可回收的文件页缓存
+func (g *cgroup) memoryUsage() (int64, error) {
+	data, err := os.ReadFile(filepath.Join(g.dir, "memory.current"))
+	if err != nil {
+		return 0, err
+	}
+	usage, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing memory.current: %w", err)
+	}
+	if stat, err := readKeyValues(filepath.Join(g.dir, "memory.stat")); err == nil {
+		if inactive := int64(stat["inactive_file"]); inactive < usage {
+			usage -= inactive
+		}
+	}
+	return usage, nil
+}
+
+// readKeyValues 解析 cgroup 的 "key value" 格式文件
+func readKeyValues(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			values[key] = n
+		}
+	}
+	return values, nil
+}
+
+// setupResources 按配置选择指标的统计范围，并限制 agent 自身的 GOMAXPROCS 和内存
+func (a *Agent) setupResources() {
+	res := a.config.Resources
+	if res.CgroupMetrics != "never" {
+		g, err := detectCgroup()
+		if err != nil {
+			a.logger.Debug().Err(err).Msg("cgroup v2 not available, reporting host-wide metrics")
+		} else {
+			a.cgroup = g
+		}
+	}
+
+	procs := res.MaxProcs
+	if procs == 0 && a.cgroup != nil {
+		// Go 运行时不感知 cgroup 的 CPU 限额，按限额向上取整
+		if limit := a.cgroup.cpuLimit(); limit > 0 {
+			procs = int(math.Ceil(limit))
+		}
+	}
+	if procs > 0 && procs < runtime.NumCPU() {
+		runtime.GOMAXPROCS(procs)
+		a.logger.Info().Int("max_procs", procs).Msg("Limited GOMAXPROCS")
+	}
+	if res.MemoryLimitMB > 0 {
+		debug.SetMemoryLimit(int64(res.MemoryLimitMB) << 20)
+	}
+}
+
+// collectCgroupMetrics 在 1 秒的采样期间按 cgroup 统计 CPU 使用率和限流比例，以及内存使用率。
+// 未设限额时相对于整机的 CPU 核数和内存统计
+func (a *Agent) collectCgroupMetrics(metrics *spb.SystemMetrics, hostMemory uint64) error {
+	before, err := a.cgroup.cpuStat()
+	if err != nil {
+		return fmt.Errorf("reading cgroup cpu.stat: %w", err)
+	}
+	start := time.Now()
+	time.Sleep(time.Second)
+	after, err := a.cgroup.cpuStat()
+	if err != nil {
+		return fmt.Errorf("reading cgroup cpu.stat: %w", err)
+	}
+	elapsed := time.Since(start).Microseconds()
+
+	cpuLimit := a.cgroup.cpuLimit()
+	cores := cpuLimit
+	if cores == 0 {
+		cores = float64(runtime.NumCPU())
+	}
+	metrics.CpuUsage = float64(after.usageUsec-before.usageUsec) / (float64(elapsed) * cores) * 100
+	if periods := after.periods - before.periods; periods > 0 {
+		metrics.CpuThrottled = float64(after.throttled-before.throttled) / float64(periods) * 100
+	}
+
+	usage, err := a.cgroup.memoryUsage()
+	if err != nil {
+		return fmt.Errorf("reading cgroup memory usage: %w", err)
+	}
+	memLimit := a.cgroup.memoryLimit()
+	if memLimit > 0 {
+		metrics.MemoryUsage = float64(usage) / float64(memLimit) * 100
+	} else if hostMemory > 0 {
+		metrics.MemoryUsage = float64(usage) / float64(hostMemory) * 100
+	}
+
+	metrics.Cgroup = true
+	metrics.CpuLimit = cpuLimit
+	metrics.MemoryLimit = memLimit
+	return nil
+}
+
+// useCgroupMetrics 本次采样是否按 cgroup 统计
+func (a *Agent) useCgroupMetrics() bool {
+	if a.cgroup == nil {
+		return false
+	}
+	return a.config.Resources.CgroupMetrics == "always" || a.cgroup.limited()
+}
@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"fmt"
+
+	"mesh-backend/pkg/agent/handlers"
+	"mesh-backend/pkg/config"
+
+	"github.com/rs/zerolog"
+)
+
+// NewCommandHandler 创建供命令行子命令使用的任务处理器，只通过 HTTP 访问服务端，不建立 gRPC 连接
+func NewCommandHandler(cfg *config.AgentConfig, logger zerolog.Logger) (*handlers.TaskHandler, error) {
+	a, err := New(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.setupTransport(); err != nil {
+		return nil, err
+	}
+	return handlers.NewTaskHandler(cfg, logger, nil, a.httpClient, a.ctx), nil
+}
+
+// RunOnce 以 standalone 模式运行：通过 HTTP 拉取并应用一次配置后返回，应用失败或钩子失败时返回错误
+func RunOnce(cfg *config.AgentConfig, logger zerolog.Logger) error {
+	handler, err := NewCommandHandler(cfg, logger)
+	if err != nil {
+		return err
+	}
+	if _, err := handler.RunOnce(); err != nil {
+		return fmt.Errorf("applying config: %w", err)
+	}
+	logger.Info().Msg("Configuration applied")
+	return nil
+}
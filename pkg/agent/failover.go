@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"time"
+)
+
+// failoverState 单个接口的端点切换状态
+type failoverState struct {
+	active string    // 生成该状态时配置中的端点，配置变化后重新开始计时
+	index  int       // 当前使用的端点在候选列表中的位置
+	since  time.Time // 开始使用当前端点的时间，切换后至少等待一个超时周期再判断
+}
+
+// switchedEndpoint 故障切换到的端点，只在配置中的端点仍为 active 时有效
+type switchedEndpoint struct {
+	active   string
+	endpoint string
+}
+
+// failoverLoop 定期检查各链路的最近握手时间，超时后切换到对端的下一个端点
+func (a *Agent) failoverLoop() {
+	ticker := a.clock.NewTicker(a.config.Failover.CheckInterval)
+	defer ticker.Stop()
+
+	states := make(map[string]*failoverState)
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C():
+			a.checkEndpoints(states)
+		}
+	}
+}
+
+// checkEndpoints 检查一轮链路握手状态，只处理有多个候选端点的链路
+func (a *Agent) checkEndpoints(states map[string]*failoverState) {
+	links := a.taskHandler.Links()
+	if links == nil {
+		var err error
+		if links, err = a.taskHandler.LoadLinks(); err != nil {
+			a.logger.Warn().Err(err).Msg("Failed to load link endpoints")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Second)
+	defer cancel()
+	wg, err := a.collectWireGuard(ctx)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to collect WireGuard status for failover")
+		return
+	}
+	handshakes := make(map[string]int64, len(wg.Peers))
+	for _, peer := range wg.Peers {
+		handshakes[peer.Interface] = peer.LatestHandshake
+	}
+
+	now := a.clock.Now()
+	timeout := a.config.Failover.HandshakeTimeout
+	for _, link := range links {
+		if len(link.Endpoints) < 2 {
+			continue
+		}
+		iface := a.config.WireGuard.Prefix + link.Interface
+		latest, ok := handshakes[iface]
+		if !ok {
+			// 接口未启动
+			continue
+		}
+
+		state := states[iface]
+		if state == nil || state.active != link.Active {
+			state = &failoverState{active: link.Active, index: max(slices.Index(link.Endpoints, link.Active), 0), since: now}
+			states[iface] = state
+		}
+		if latest > 0 && now.Sub(time.Unix(latest, 0)) < timeout {
+			continue
+		}
+		if now.Sub(state.since) < timeout {
+			continue
+		}
+
+		next := (state.index + 1) % len(link.Endpoints)
+		endpoint := link.Endpoints[next]
+		if err := a.setPeerEndpoint(iface, link.PublicKey, endpoint); err != nil {
+			a.logger.Warn().Err(err).Str("interface", iface).Str("endpoint", endpoint).Msg("Failed to switch peer endpoint")
+			continue
+		}
+		a.logger.Warn().
+			Str("interface", iface).
+			Str("from", link.Endpoints[state.index]).
+			Str("to", endpoint).
+			Msg("No handshake within timeout, switched peer endpoint")
+		state.index, state.since = next, now
+		a.switched.Store(iface, switchedEndpoint{active: link.Active, endpoint: endpoint})
+
+		if err := a.taskHandler.ReportActiveEndpoint(link.PeerID, endpoint); err != nil {
+			a.logger.Warn().Err(err).Int("peer_id", link.PeerID).Msg("Failed to report active endpoint")
+		}
+	}
+}
+
+// setPeerEndpoint 通过 wg set 修改对等节点的端点，不重启接口
+func (a *Agent) setPeerEndpoint(iface, publicKey, endpoint string) error {
+	cmd := exec.Command("wg", "set", iface, "peer", publicKey, "endpoint", endpoint)
+	if a.config.Runtime.DryRun {
+		a.logger.Info().Str("DryRun", "wireguard_endpoint").Msg("Would run: " + cmd.String())
+		return nil
+	}
+	return cmd.Run()
+}
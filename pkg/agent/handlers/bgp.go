@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// applyBGP 写入服务端生成的 BIRD 配置片段并重新加载 BIRD；节点不再是边界节点时删除片段
+func (h *TaskHandler) applyBGP(config string) error {
+	path := h.config.BGP.ConfigPath
+	if path == "" {
+		if config != "" {
+			h.logger.Warn().Msg("Server sent BGP config but bgp.config_path is not set, ignoring")
+		}
+		return nil
+	}
+
+	if config == "" {
+		if h.config.Runtime.DryRun {
+			return nil
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("removing bgp config: %w", err)
+		}
+		h.logger.Info().Str("path", path).Msg("BGP config removed")
+		return h.reloadBird(h.config.BGP.ReloadCommand)
+	}
+
+	changed, err := h.configChanged(path, config)
+	if err != nil {
+		return fmt.Errorf("checking bgp config: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "bgp_config").Msg("Would write " + path + ":\n" + config)
+	} else if err := os.WriteFile(path, []byte(config), 0640); err != nil {
+		return fmt.Errorf("writing bgp config: %w", err)
+	}
+	return h.reloadBird(h.config.BGP.ReloadCommand)
+}
+
+// reloadBird 执行 reload_command 使 BIRD 加载新的配置片段
+func (h *TaskHandler) reloadBird(command []string) error {
+	if len(command) == 0 {
+		return nil
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "bird").Msg("Would run: " + cmd.String())
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", cmd.String(), strings.TrimSpace(string(output)))
+	}
+	h.logger.Info().Msg("BIRD reloaded")
+	return nil
+}
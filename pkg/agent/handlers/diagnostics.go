@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/types"
+)
+
+// bandwidthBufferSize 吞吐量测试每次写入的数据大小
+const bandwidthBufferSize = 128 * 1024
+
+// handleBandwidthTest 处理吞吐量测试任务，按角色监听或连接对端并统计传输的数据量
+func (h *TaskHandler) handleBandwidthTest(task *pb.Task) error {
+	var params types.BandwidthTestParams
+	if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+		return fmt.Errorf("decoding params: %w", err)
+	}
+
+	var (
+		result *types.BandwidthTestResult
+		err    error
+	)
+	switch params.Role {
+	case types.BandwidthRoleReceiver:
+		result, err = h.receiveBandwidth(&params)
+	case types.BandwidthRoleSender:
+		result, err = h.sendBandwidth(&params)
+	default:
+		err = fmt.Errorf("unknown role: %s", params.Role)
+	}
+	if err != nil {
+		return err
+	}
+
+	details, _ := json.Marshal(result)
+	h.updateTaskStatus(task, &types.TaskResult{
+		Status:  types.TaskStatusSuccess,
+		Details: string(details),
+	})
+	h.logger.Info().
+		Str("task_id", task.Id).
+		Str("role", params.Role).
+		Int64("bytes", result.Bytes).
+		Float64("seconds", result.Seconds).
+		Msg("Bandwidth test finished")
+	return nil
+}
+
+// receiveBandwidth 监听端口，接受一个连接并读取到对端关闭
+func (h *TaskHandler) receiveBandwidth(params *types.BandwidthTestParams) (*types.BandwidthTestResult, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(params.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+	defer listener.Close()
+
+	timeout := time.Duration(params.Timeout) * time.Second
+	listener.(*net.TCPListener).SetDeadline(time.Now().Add(timeout))
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("waiting for sender: %w", err)
+	}
+	defer conn.Close()
+
+	// 发送端异常时不会关闭连接，读取最多等待测试时长再加一段余量
+	conn.SetReadDeadline(time.Now().Add(time.Duration(params.Duration)*time.Second + 10*time.Second))
+	start := time.Now()
+	n, err := io.Copy(io.Discard, conn)
+	elapsed := time.Since(start)
+	if err != nil && n == 0 {
+		return nil, fmt.Errorf("receiving: %w", err)
+	}
+	return &types.BandwidthTestResult{Bytes: n, Seconds: elapsed.Seconds()}, nil
+}
+
+// sendBandwidth 在超时内反复连接接收端，连接成功后持续发送测试时长
+func (h *TaskHandler) sendBandwidth(params *types.BandwidthTestParams) (*types.BandwidthTestResult, error) {
+	addr := net.JoinHostPort(params.Address, strconv.Itoa(params.Port))
+	deadline := time.Now().Add(time.Duration(params.Timeout) * time.Second)
+
+	var conn net.Conn
+	for {
+		var err error
+		conn, err = net.DialTimeout("tcp", addr, 3*time.Second)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("connecting %s: %w", addr, err)
+		}
+		select {
+		case <-h.ctx.Done():
+			return nil, h.ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	defer conn.Close()
+
+	buf := make([]byte, bandwidthBufferSize)
+	start := time.Now()
+	end := start.Add(time.Duration(params.Duration) * time.Second)
+	conn.SetWriteDeadline(end)
+
+	var sent int64
+	for time.Now().Before(end) {
+		n, err := conn.Write(buf)
+		sent += int64(n)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("sending: %w", err)
+		}
+	}
+	return &types.BandwidthTestResult{Bytes: sent, Seconds: time.Since(start).Seconds()}, nil
+}
+
+// heavyCommand 创建重任务的子进程，按 resources.task_nice 和 task_io_class 降低其 CPU 和 IO 优先级。
+// nice 和 ionice 以 exec 方式运行目标命令，ctx 取消时仍能结束目标进程
+func (h *TaskHandler) heavyCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	res := h.config.Resources
+	argv := append([]string{name}, args...)
+	switch res.TaskIOClass {
+	case "idle":
+		argv = append([]string{"ionice", "-c", "3"}, argv...)
+	case "best-effort":
+		argv = append([]string{"ionice", "-c", "2", "-n", "7"}, argv...)
+	}
+	if res.TaskNice != 0 {
+		argv = append([]string{"nice", "-n", strconv.Itoa(res.TaskNice)}, argv...)
+	}
+	return exec.CommandContext(ctx, argv[0], argv[1:]...)
+}
+
+// handleTraceroute 处理路径探测任务，执行 traceroute 并回报逐跳结果
+func (h *TaskHandler) handleTraceroute(task *pb.Task) error {
+	var params types.TracerouteParams
+	if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+		return fmt.Errorf("decoding params: %w", err)
+	}
+	if net.ParseIP(params.Target) == nil {
+		return fmt.Errorf("invalid target address: %s", params.Target)
+	}
+	if params.MaxHops <= 0 {
+		params.MaxHops = 16
+	}
+
+	// 每跳 3 次探测、每次最多等待 2 秒
+	ctx, cancel := context.WithTimeout(h.ctx, time.Duration(params.MaxHops)*6*time.Second)
+	defer cancel()
+	cmd := h.heavyCommand(ctx, "traceroute", "-n", "-q", "3", "-w", "2", "-m", strconv.Itoa(params.MaxHops), params.Target)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("running traceroute: %w", err)
+	}
+
+	details, _ := json.Marshal(&types.TracerouteResult{
+		Target: params.Target,
+		Hops:   parseTraceroute(string(output)),
+	})
+	h.updateTaskStatus(task, &types.TaskResult{
+		Status:  types.TaskStatusSuccess,
+		Details: string(details),
+	})
+	return nil
+}
+
+// parseTraceroute 解析 traceroute -n 的输出，如 " 2  10.42.3.2  0.512 ms * 0.498 ms"
+func parseTraceroute(output string) []types.TracerouteHop {
+	var hops []types.TracerouteHop
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ttl, err := strconv.Atoi(fields[0])
+		if err != nil {
+			// 首行 "traceroute to ..." 等
+			continue
+		}
+
+		hop := types.TracerouteHop{TTL: ttl, RTTs: []float64{}}
+		for i := 1; i < len(fields); i++ {
+			switch field := fields[i]; {
+			case field == "*":
+				hop.Lost++
+			case net.ParseIP(field) != nil:
+				// 同一跳的探测可能由不同地址回应，只保留第一个
+				if hop.Address == "" {
+					hop.Address = field
+				}
+			case i+1 < len(fields) && fields[i+1] == "ms":
+				if rtt, err := strconv.ParseFloat(field, 64); err == nil {
+					hop.RTTs = append(hop.RTTs, rtt)
+				}
+				i++
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// handleCapture 处理抓包任务：在网格接口上运行有时长和大小上限的 tcpdump，并将 pcap 上传到服务端
+func (h *TaskHandler) handleCapture(task *pb.Task) error {
+	var params types.CaptureParams
+	if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+		return fmt.Errorf("decoding params: %w", err)
+	}
+
+	// 只允许在本 agent 管理的 WireGuard 接口上抓包
+	if !strings.HasPrefix(params.Interface, h.config.WireGuard.Prefix) {
+		return fmt.Errorf("interface %s is not a mesh interface", params.Interface)
+	}
+	if _, err := net.InterfaceByName(params.Interface); err != nil {
+		return fmt.Errorf("interface %s: %w", params.Interface, err)
+	}
+	if params.Duration <= 0 || params.MaxBytes <= 0 {
+		return fmt.Errorf("capture duration and size limit are required")
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, time.Duration(params.Duration)*time.Second)
+	defer cancel()
+
+	args := []string{"-i", params.Interface, "-n", "-U", "-w", "-"}
+	if params.Filter != "" {
+		args = append(args, params.Filter)
+	}
+	cmd := h.heavyCommand(ctx, "tcpdump", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("creating pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting tcpdump: %w", err)
+	}
+
+	// 多读一个字节用于判断是否达到上限，达到上限后停止抓包
+	var pcap bytes.Buffer
+	n, readErr := io.Copy(&pcap, io.LimitReader(stdout, params.MaxBytes+1))
+	truncated := n > params.MaxBytes
+	if truncated {
+		pcap.Truncate(int(params.MaxBytes))
+	}
+	cancel()
+	cmd.Wait()
+	if readErr != nil {
+		return fmt.Errorf("reading capture: %w", readErr)
+	}
+	if pcap.Len() == 0 {
+		return fmt.Errorf("tcpdump produced no output")
+	}
+
+	if err := h.uploadCapture(task.Id, &pcap); err != nil {
+		return fmt.Errorf("uploading capture: %w", err)
+	}
+
+	details, _ := json.Marshal(&types.CaptureResult{
+		Bytes:     int64(pcap.Len()),
+		Truncated: truncated,
+	})
+	h.updateTaskStatus(task, &types.TaskResult{
+		Status:  types.TaskStatusSuccess,
+		Details: string(details),
+	})
+	return nil
+}
+
+// uploadCapture 将抓包文件上传到服务端
+func (h *TaskHandler) uploadCapture(taskID string, pcap *bytes.Buffer) error {
+	url := fmt.Sprintf("%s/api/v1/agent/captures/%s", h.config.Server.Address, taskID)
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodPost, url, pcap)
+	if err != nil {
+		return err
+	}
+	auth := fmt.Sprintf("%d:%s", h.config.NodeID, h.config.Token)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	req.Header.Set("Content-Type", "application/vnd.tcpdump.pcap")
+
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
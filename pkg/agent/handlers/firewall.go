@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"mesh-backend/pkg/types"
+)
+
+// applyFirewall 按配置中的防火墙规则替换 nftables 中的 mesh_acl 表；租户未设置访问控制策略时删除该表
+func (h *TaskHandler) applyFirewall(policy *types.FirewallPolicy) error {
+	if policy == nil {
+		return h.removeFirewall()
+	}
+
+	script, err := policy.NFTables()
+	if err != nil {
+		return fmt.Errorf("rendering nftables rules: %w", err)
+	}
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "nftables").Msg("Would run: " + cmd.String() + "\n" + script)
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft -f: %s", strings.TrimSpace(string(output)))
+	}
+	h.logger.Info().Int("rules", len(policy.Rules)).Msg("Firewall rules applied")
+	return nil
+}
+
+// removeFirewall 删除之前安装的 mesh_acl 表，节点未安装 nft 或表不存在时不做任何事
+//
+// agent 重启后不知道是否安装过规则，因此每次都检查表是否存在。
+func (h *TaskHandler) removeFirewall() error {
+	if h.config.Runtime.DryRun {
+		return nil
+	}
+	if _, err := exec.LookPath("nft"); err != nil {
+		return nil
+	}
+	if err := exec.Command("nft", "list", "table", "inet", types.FirewallTable).Run(); err != nil {
+		return nil
+	}
+	if output, err := exec.Command("nft", "delete", "table", "inet", types.FirewallTable).CombinedOutput(); err != nil {
+		return fmt.Errorf("nft delete table: %s", strings.TrimSpace(string(output)))
+	}
+	h.logger.Info().Msg("Firewall rules removed")
+	return nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/types"
+)
+
+// handleGC 处理接口清理任务：列出带 wireguard.prefix 前缀的运行中接口和配置文件，
+// 删除服务端当前配置中不存在的接口
+//
+// 默认只删除状态文件中记录的接口，force 时同时删除运维人员创建的同前缀接口。
+func (h *TaskHandler) handleGC(task *pb.Task) error {
+	var params types.GCParams
+	if task.Params != "" {
+		if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+			return fmt.Errorf("decoding params: %w", err)
+		}
+	}
+	// 前缀为空时会匹配主机上的所有 WireGuard 接口
+	if h.config.WireGuard.Prefix == "" {
+		return fmt.Errorf("wireguard.prefix is empty, refusing to collect interfaces")
+	}
+
+	// 与配置更新串行执行，期间不会有新写入的接口不在 desired 中
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+
+	config, err := h.fetchConfig()
+	if err != nil {
+		return err
+	}
+	var desired map[string]string
+	if err := json.Unmarshal([]byte(config.WireGuard), &desired); err != nil {
+		return fmt.Errorf("decoding wireguard config: %w", err)
+	}
+
+	live, err := h.liveInterfaces()
+	if err != nil {
+		return err
+	}
+	state, err := h.loadState()
+	if err != nil {
+		return err
+	}
+	if err := checkConfigFreshness(state, config); err != nil {
+		return err
+	}
+
+	result := &types.GCResult{Removed: []string{}}
+	for _, peerName := range live {
+		if _, ok := desired[peerName]; ok {
+			continue
+		}
+		iface := h.config.WireGuard.Prefix + peerName
+		if _, managed := state.Interfaces[peerName]; !managed && !params.Force {
+			result.Unmanaged = append(result.Unmanaged, iface)
+			continue
+		}
+		if !params.DryRun {
+			if err := h.teardownInterface(peerName); err != nil {
+				return err
+			}
+			delete(state.Interfaces, peerName)
+		}
+		result.Removed = append(result.Removed, iface)
+	}
+	if !params.DryRun {
+		if err := h.saveState(state); err != nil {
+			return err
+		}
+	}
+
+	details, _ := json.Marshal(result)
+	h.updateTaskStatus(task, &types.TaskResult{
+		Status:  types.TaskStatusSuccess,
+		Details: string(details),
+	})
+	h.logger.Info().
+		Str("task_id", task.Id).
+		Strs("removed", result.Removed).
+		Strs("unmanaged", result.Unmanaged).
+		Bool("dry_run", params.DryRun).
+		Msg("Interface garbage collection finished")
+	return nil
+}
+
+// liveInterfaces 返回带前缀的运行中 WireGuard 接口和配置文件对应的接口名（不含前缀），已排序去重
+func (h *TaskHandler) liveInterfaces() ([]string, error) {
+	prefix := h.config.WireGuard.Prefix
+	names := make(map[string]bool)
+
+	output, err := exec.Command("wg", "show", "interfaces").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing wireguard interfaces: %w", err)
+	}
+	for _, iface := range strings.Fields(string(output)) {
+		if strings.HasPrefix(iface, prefix) {
+			names[strings.TrimPrefix(iface, prefix)] = true
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(h.config.WireGuard.ConfigPath, prefix+"*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("listing wireguard configs: %w", err)
+	}
+	for _, path := range paths {
+		names[strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".conf")] = true
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"time"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/types"
+)
+
+// maxTaskHistory 保留的最近任务结果数
+const maxTaskHistory = 20
+
+// TaskRecord 最近处理的任务结果，供 agent 本地 API 查询
+type TaskRecord struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"`
+	Status     types.TaskStatus `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	FinishedAt time.Time        `json:"finished_at"`
+}
+
+// AppliedConfig 最近一次成功应用的配置
+type AppliedConfig struct {
+	TaskID    string            `json:"task_id"`
+	AppliedAt time.Time         `json:"applied_at"`
+	Hashes    map[string]string `json:"hashes"` // 各配置文件内容的 SHA-256，键为 WireGuard 接口名或 babeld
+}
+
+// recordTask 记录任务结果，只保留最近的 maxTaskHistory 条
+func (h *TaskHandler) recordTask(task *pb.Task, result *types.TaskResult) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+
+	h.history = append(h.history, TaskRecord{
+		ID:         task.Id,
+		Type:       task.Type,
+		Status:     result.Status,
+		Error:      result.Error,
+		FinishedAt: time.Now(),
+	})
+	if len(h.history) > maxTaskHistory {
+		h.history = h.history[len(h.history)-maxTaskHistory:]
+	}
+}
+
+// recordApplied 记录成功应用的配置内容摘要
+func (h *TaskHandler) recordApplied(taskID string, config *types.NodeConfig) {
+	applied := &AppliedConfig{
+		TaskID:    taskID,
+		AppliedAt: time.Now(),
+		Hashes:    map[string]string{"babeld": contentHash(config.Babel)},
+	}
+	if config.Bird != "" {
+		applied.Hashes["bird"] = contentHash(config.Bird)
+	}
+	var configs map[string]string
+	if err := json.Unmarshal([]byte(config.WireGuard), &configs); err == nil {
+		for iface, content := range configs {
+			applied.Hashes[iface] = contentHash(content)
+		}
+	}
+
+	h.historyMu.Lock()
+	h.applied = applied
+	h.historyMu.Unlock()
+}
+
+// RecentTasks 返回最近处理的任务结果，最新的在前
+func (h *TaskHandler) RecentTasks() []TaskRecord {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+
+	records := slices.Clone(h.history)
+	slices.Reverse(records)
+	return records
+}
+
+// AppliedConfig 返回最近一次成功应用的配置，agent 启动后尚未应用过配置时为 nil
+func (h *TaskHandler) AppliedConfig() *AppliedConfig {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+	return h.applied
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"mesh-backend/pkg/types"
+)
+
+// maxHookOutput 回报的钩子输出上限，超出时只保留末尾
+const maxHookOutput = 4096
+
+// runHooks 依次执行某一阶段的钩子脚本，遇到失败立即停止并返回错误
+//
+// 脚本只能来自 agent.yaml 的 hooks 配置，服务端无法指定执行的命令。脚本通过环境变量获得
+// MESH_NODE_ID、MESH_TASK_ID、MESH_HOOK_PHASE 以及 extraEnv 中的变量。
+func (h *TaskHandler) runHooks(taskID, phase string, paths []string, extraEnv []string) ([]types.HookResult, error) {
+	results := make([]types.HookResult, 0, len(paths))
+	for _, path := range paths {
+		result := h.runHook(taskID, phase, path, extraEnv)
+		results = append(results, result)
+		if result.Error != "" {
+			return results, fmt.Errorf("%s: %s", path, result.Error)
+		}
+	}
+	return results, nil
+}
+
+// runHook 执行单个钩子脚本
+func (h *TaskHandler) runHook(taskID, phase, path string, extraEnv []string) types.HookResult {
+	result := types.HookResult{Phase: phase, Path: path, ExitCode: -1}
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "hook").Str("phase", phase).Msg("Would run: " + path)
+		result.ExitCode = 0
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, h.config.Hooks.Timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(),
+		"MESH_NODE_ID="+strconv.Itoa(h.config.NodeID),
+		"MESH_TASK_ID="+taskID,
+		"MESH_HOOK_PHASE="+phase,
+	)
+	cmd.Env = append(cmd.Env, extraEnv...)
+
+	start := time.Now()
+	err := cmd.Run()
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+
+	out := output.Bytes()
+	if len(out) > maxHookOutput {
+		out = out[len(out)-maxHookOutput:]
+	}
+	result.Output = string(out)
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.Error = fmt.Sprintf("timed out after %s", h.config.Hooks.Timeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Error = fmt.Sprintf("exit status %d", result.ExitCode)
+	case err != nil:
+		result.Error = err.Error()
+	default:
+		result.ExitCode = 0
+	}
+
+	event := h.logger.Info()
+	if result.Error != "" {
+		event = h.logger.Warn().Str("error", result.Error)
+	}
+	event.Str("task_id", taskID).
+		Str("phase", phase).
+		Str("path", path).
+		Int("exit_code", result.ExitCode).
+		Float64("duration_ms", result.DurationMs).
+		Msg("Config hook finished")
+	return result
+}
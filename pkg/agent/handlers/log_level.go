@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/logger"
+	"mesh-backend/pkg/types"
+
+	"github.com/rs/zerolog"
+)
+
+// handleSetLogLevel 处理日志级别任务，临时调整基础日志级别，到期后恢复配置文件中的级别
+//
+// 新任务会替换尚未到期的调整，恢复时间从最近一次调整开始计算。
+func (h *TaskHandler) handleSetLogLevel(task *pb.Task) error {
+	var params types.LogLevelParams
+	if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+		return fmt.Errorf("decoding params: %w", err)
+	}
+	level, err := zerolog.ParseLevel(params.Level)
+	if err != nil {
+		return fmt.Errorf("parsing level: %w", err)
+	}
+	if params.Duration <= 0 {
+		return fmt.Errorf("invalid duration: %d", params.Duration)
+	}
+
+	configured, err := zerolog.ParseLevel(h.config.Runtime.LogLevel)
+	if err != nil {
+		configured = zerolog.InfoLevel
+	}
+	duration := time.Duration(params.Duration) * time.Second
+
+	h.levelMu.Lock()
+	if h.levelReset != nil {
+		h.levelReset.Stop()
+	}
+	logger.SetLevel(level)
+	h.levelReset = time.AfterFunc(duration, func() {
+		h.levelMu.Lock()
+		defer h.levelMu.Unlock()
+		logger.SetLevel(configured)
+		h.levelReset = nil
+		h.logger.Info().Str("level", configured.String()).Msg("Log level restored")
+	})
+	h.levelMu.Unlock()
+
+	h.updateTaskStatus(task, &types.TaskResult{
+		Status: types.TaskStatusSuccess,
+	})
+	h.logger.Info().
+		Str("task_id", task.Id).
+		Str("level", level.String()).
+		Dur("duration", duration).
+		Msg("Log level changed")
+	return nil
+}
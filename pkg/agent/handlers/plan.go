@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mesh-backend/pkg/types"
+)
+
+// FileChange 一个配置文件当前内容与服务端下发内容的对比
+type FileChange struct {
+	Path    string `json:"path"`
+	Current string `json:"-"` // 文件不存在时为空
+	Desired string `json:"-"`
+}
+
+// Changed 文件内容是否需要更新
+func (c *FileChange) Changed() bool {
+	return c.Current != c.Desired
+}
+
+// FetchConfig 从服务端获取最新配置，不应用
+func (h *TaskHandler) FetchConfig() (*types.NodeConfig, error) {
+	return h.fetchConfig()
+}
+
+// PlanConfig 生成配置中各文件应写入的内容并与磁盘上的文件对比，不受 dry_run 影响，始终读取实际文件
+func (h *TaskHandler) PlanConfig(config *types.NodeConfig) ([]FileChange, error) {
+	var configs map[string]string
+	if err := json.Unmarshal([]byte(config.WireGuard), &configs); err != nil {
+		return nil, fmt.Errorf("decoding wireguard config: %w", err)
+	}
+
+	desired := make(map[string]string, len(configs)+3)
+	switch {
+	case types.IsBird(config.RoutingDaemon):
+		if h.config.Bird.ConfigPath != "" {
+			desired[h.config.Bird.ConfigPath] = strings.ReplaceAll(config.Bird, "{WGPrefix}", h.config.WireGuard.Prefix)
+		}
+	case config.RoutingDaemon == types.RoutingDaemonStatic:
+	default:
+		desired[h.config.Babel.ConfigPath] = strings.ReplaceAll(config.Babel, "{WGPrefix}", h.config.WireGuard.Prefix)
+	}
+	for peerName, content := range configs {
+		desired[h.wireGuardConfigPath(peerName)] = content
+	}
+	if h.config.BGP.ConfigPath != "" {
+		desired[h.config.BGP.ConfigPath] = config.BGP
+	}
+
+	changes := make([]FileChange, 0, len(desired))
+	for path, content := range desired {
+		current, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		changes = append(changes, FileChange{Path: path, Current: string(current), Desired: content})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// ApplyConfig 应用配置，force 为 true 时即使文件未变化也重写并重启所有接口和 babeld，用于手动恢复
+func (h *TaskHandler) ApplyConfig(config *types.NodeConfig, force bool) error {
+	h.force = force
+	defer func() { h.force = false }()
+
+	if err := h.applyConfig(config); err != nil {
+		return err
+	}
+	h.recordApplied("manual", config)
+	return nil
+}
+
+// wireGuardConfigPath 返回 WireGuard 接口配置文件的路径
+func (h *TaskHandler) wireGuardConfigPath(peerName string) string {
+	return filepath.Join(h.config.WireGuard.ConfigPath, fmt.Sprintf("%s%s.conf", h.config.WireGuard.Prefix, peerName))
+}
+
+// Diff 返回逐行对比结果，删除的行以 "-" 开头，新增的行以 "+" 开头，PrivateKey 的值会被隐藏
+func (c *FileChange) Diff() string {
+	from := splitLines(c.Current)
+	to := splitLines(c.Desired)
+
+	// 最长公共子序列
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			b.WriteString("  " + redactSecret(from[i]) + "\n")
+			i++
+			j++
+		case j < len(to) && (i == len(from) || lcs[i][j+1] >= lcs[i+1][j]):
+			b.WriteString("+ " + redactSecret(to[j]) + "\n")
+			j++
+		default:
+			b.WriteString("- " + redactSecret(from[i]) + "\n")
+			i++
+		}
+	}
+	return b.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// redactSecret 隐藏 WireGuard 配置中的私钥和预共享密钥
+func redactSecret(line string) string {
+	key, _, found := strings.Cut(line, "=")
+	if !found {
+		return line
+	}
+	switch strings.TrimSpace(key) {
+	case "PrivateKey", "PresharedKey":
+		return strings.TrimRight(key, " ") + " = <redacted>"
+	}
+	return line
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"mesh-backend/pkg/types"
+)
+
+// applyRoutingPolicy 安装服务端下发的 ip rule，并删除上次安装但已不在策略中的规则
+//
+// policy 为 nil 表示 mesh 路由使用主路由表，只清理之前安装的规则。
+// agent 重启后不记得之前安装的规则，规则按先删除再添加的方式安装，避免重复。
+func (h *TaskHandler) applyRoutingPolicy(policy *types.RoutingPolicy) error {
+	h.rulesMu.Lock()
+	defer h.rulesMu.Unlock()
+
+	var rules []types.IPRule
+	if policy != nil {
+		rules = policy.Rules
+	}
+
+	wanted := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		wanted[rule.String()] = true
+	}
+
+	for _, rule := range h.rules {
+		if wanted[rule.String()] {
+			continue
+		}
+		if err := h.ipRule("del", rule); err != nil {
+			h.logger.Warn().Err(err).Str("rule", rule.String()).Msg("Failed to remove stale ip rule")
+		}
+	}
+
+	installed := make([]types.IPRule, 0, len(rules))
+	for _, rule := range rules {
+		// 规则已存在时先删除，ip rule add 不检查重复
+		_ = h.ipRule("del", rule)
+		if err := h.ipRule("add", rule); err != nil {
+			h.rules = installed
+			return err
+		}
+		installed = append(installed, rule)
+	}
+	h.rules = installed
+
+	if len(rules) > 0 {
+		h.logger.Info().Int("table", policy.Table).Int("rules", len(rules)).Msg("Routing policy applied")
+	}
+	return nil
+}
+
+// ipRule 执行 ip rule add/del
+func (h *TaskHandler) ipRule(action string, rule types.IPRule) error {
+	args := append([]string{rule.Family(), "rule", action}, rule.Args()...)
+	cmd := exec.Command("ip", args...)
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "ip_rule").Msg("Would run: " + cmd.String())
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ip rule %s %s: %s", action, rule, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"mesh-backend/pkg/types"
+)
+
+// staticRouteProto 静态路由使用的 ip route 协议号，用于识别和清理 agent 安装的路由
+const staticRouteProto = "200"
+
+// applyRoutingDaemon 按租户选择的路由守护进程更新路由配置，并停用其他守护进程
+//
+// 服务端未指定守护进程时（旧版本服务端）按 babeld 处理。
+func (h *TaskHandler) applyRoutingDaemon(config *types.NodeConfig) error {
+	var table int
+	if config.Routing != nil {
+		table = config.Routing.Table
+	}
+
+	switch config.RoutingDaemon {
+	case types.RoutingDaemonBirdBabel, types.RoutingDaemonBirdOSPF:
+		if err := h.applyBird(config.Bird); err != nil {
+			return fmt.Errorf("applying bird config: %w", err)
+		}
+		if err := h.stopBabeld(); err != nil {
+			return err
+		}
+		return h.applyStaticRoutes(nil, table)
+	case types.RoutingDaemonStatic:
+		if err := h.applyStaticRoutes(config.StaticRoutes, table); err != nil {
+			return fmt.Errorf("applying static routes: %w", err)
+		}
+		if err := h.stopBabeld(); err != nil {
+			return err
+		}
+		return h.applyBird("")
+	default:
+		if err := h.updateBabeldConfig(config.Babel); err != nil {
+			return fmt.Errorf("updating babeld config: %w", err)
+		}
+		if err := h.applyBird(""); err != nil {
+			return fmt.Errorf("removing bird config: %w", err)
+		}
+		return h.applyStaticRoutes(nil, table)
+	}
+}
+
+// applyBird 写入 BIRD 路由配置片段并重新加载 BIRD；config 为空时删除片段
+func (h *TaskHandler) applyBird(config string) error {
+	path := h.config.Bird.ConfigPath
+	if path == "" {
+		if config != "" {
+			return fmt.Errorf("bird.config_path is not set")
+		}
+		return nil
+	}
+
+	if config == "" {
+		if h.config.Runtime.DryRun {
+			return nil
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("removing bird config: %w", err)
+		}
+		h.logger.Info().Str("path", path).Msg("BIRD routing config removed")
+		return h.reloadBird(h.config.Bird.ReloadCommand)
+	}
+
+	config = strings.ReplaceAll(config, "{WGPrefix}", h.config.WireGuard.Prefix)
+	changed, err := h.configChanged(path, config)
+	if err != nil {
+		return fmt.Errorf("checking bird config: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "bird_config").Msg("Would write " + path + ":\n" + config)
+	} else if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		return fmt.Errorf("writing bird config: %w", err)
+	}
+	return h.reloadBird(h.config.Bird.ReloadCommand)
+}
+
+// stopBabeld 停止正在运行的 babeld，改用其他路由守护进程时调用
+func (h *TaskHandler) stopBabeld() error {
+	if exec.Command("systemctl", "is-active", "--quiet", "babeld").Run() != nil {
+		return nil
+	}
+	cmd := exec.Command("systemctl", "stop", "babeld")
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "babeld").Msg("Would run: " + cmd.String())
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("stopping babeld: %s", strings.TrimSpace(string(output)))
+	}
+	h.logger.Info().Msg("Babeld stopped")
+	return nil
+}
+
+// applyStaticRoutes 安装服务端下发的静态路由，并删除 agent 之前安装、不再需要的路由
+//
+// 路由以 staticRouteProto 标记，agent 重启后仍能识别；table 不为 0 时安装到 mesh 路由表。
+func (h *TaskHandler) applyStaticRoutes(routes []types.StaticRoute, table int) error {
+	wanted := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		dev := h.config.WireGuard.Prefix + route.Interface
+		wanted[route.Prefix+" "+dev] = true
+		if err := h.ipRoute(table, "replace", route.Prefix, "dev", dev); err != nil {
+			return err
+		}
+	}
+
+	for _, family := range []string{"-4", "-6"} {
+		args := []string{family, "route", "show", "proto", staticRouteProto}
+		if table != 0 {
+			args = append(args, "table", strconv.Itoa(table))
+		}
+		output, err := exec.Command("ip", args...).Output()
+		if err != nil {
+			// 主机上没有对应协议族或路由表时没有需要清理的路由
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[1] != "dev" {
+				continue
+			}
+			prefix := fields[0]
+			if !strings.Contains(prefix, "/") {
+				if family == "-4" {
+					prefix += "/32"
+				} else {
+					prefix += "/128"
+				}
+			}
+			if wanted[prefix+" "+fields[2]] {
+				continue
+			}
+			if err := h.ipRoute(table, "del", prefix, "dev", fields[2]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(routes) > 0 {
+		h.logger.Info().Int("routes", len(routes)).Msg("Static routes applied")
+	}
+	return nil
+}
+
+// ipRoute 执行 ip route，路由带有 staticRouteProto 标记
+func (h *TaskHandler) ipRoute(table int, action string, args ...string) error {
+	args = append([]string{"route", action}, args...)
+	args = append(args, "proto", staticRouteProto)
+	if table != 0 {
+		args = append(args, "table", strconv.Itoa(table))
+	}
+	cmd := exec.Command("ip", args...)
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "ip_route").Msg("Would run: " + cmd.String())
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ip %s: %s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mesh-backend/pkg/types"
+)
+
+// ManagedState agent 管理的 WireGuard 接口和配置文件，保存在 runtime.state_path
+//
+// 应用配置时只删除状态中记录、但不再出现在配置中的接口；不在状态中的同名文件视为运维人员自行管理，不会被覆盖。
+type ManagedState struct {
+	Interfaces map[string]string `json:"interfaces"` // 接口名（不含前缀）到写入的配置内容摘要
+	Files      map[string]string `json:"files"`      // babeld、BIRD 等配置文件路径到写入的内容摘要
+	UpdatedAt  time.Time         `json:"updated_at"`
+
+	ConfigIssuedAt time.Time `json:"config_issued_at"` // 最近一次应用的配置的签发时间
+
+	// 状态文件不存在，即首次运行或从旧版本升级，此时接管配置中已存在的文件
+	fresh bool
+}
+
+// loadState 读取状态文件，文件不存在时返回空状态
+func (h *TaskHandler) loadState() (*ManagedState, error) {
+	state := &ManagedState{Interfaces: map[string]string{}, Files: map[string]string{}}
+	data, err := os.ReadFile(h.config.Runtime.StatePath)
+	if os.IsNotExist(err) {
+		state.fresh = true
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("decoding state file %s: %w", h.config.Runtime.StatePath, err)
+	}
+	if state.Interfaces == nil {
+		state.Interfaces = map[string]string{}
+	}
+	if state.Files == nil {
+		state.Files = map[string]string{}
+	}
+	return state, nil
+}
+
+// checkConfigFreshness 拒绝签发时间早于已应用配置的配置，防止代理重放旧配置回滚网络
+func checkConfigFreshness(state *ManagedState, config *types.NodeConfig) error {
+	if config.UpdatedAt.Before(state.ConfigIssuedAt) {
+		return fmt.Errorf("rejecting config issued at %s: older than the applied config issued at %s",
+			config.UpdatedAt.Format(time.RFC3339Nano), state.ConfigIssuedAt.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// saveState 原子地写入状态文件，dry_run 时不写入
+func (h *TaskHandler) saveState(state *ManagedState) error {
+	if h.config.Runtime.DryRun {
+		return nil
+	}
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := h.config.Runtime.StatePath
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
+
+// checkManaged 检查接口配置文件是否可以由 agent 写入：文件不存在、已由 agent 管理或内容与期望一致
+func (h *TaskHandler) checkManaged(state *ManagedState, peerName, desired string) error {
+	if _, ok := state.Interfaces[peerName]; ok || state.fresh {
+		return nil
+	}
+	path := h.wireGuardConfigPath(peerName)
+	current, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if string(current) == desired {
+		return nil
+	}
+	return fmt.Errorf("refusing to overwrite %s, it is not managed by the agent", path)
+}
+
+// removeStaleInterfaces 停用并删除状态中记录、但不再出现在配置中的接口
+//
+// 自 agent 写入后被修改过的配置文件交还运维人员管理，只从状态中移除，不停用接口。
+func (h *TaskHandler) removeStaleInterfaces(state *ManagedState, configs map[string]string) error {
+	var stale []string
+	for peerName := range state.Interfaces {
+		if _, ok := configs[peerName]; !ok {
+			stale = append(stale, peerName)
+		}
+	}
+	sort.Strings(stale)
+
+	for _, peerName := range stale {
+		path := h.wireGuardConfigPath(peerName)
+		iface := h.config.WireGuard.Prefix + peerName
+		current, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		if err == nil && contentHash(string(current)) != state.Interfaces[peerName] {
+			h.logger.Warn().Str("interface", iface).Msg("Stale interface config was modified outside the agent, leaving it in place")
+			delete(state.Interfaces, peerName)
+			continue
+		}
+
+		if err := h.teardownInterface(peerName); err != nil {
+			return err
+		}
+		if !h.config.Runtime.DryRun {
+			delete(state.Interfaces, peerName)
+		}
+	}
+	return nil
+}
+
+// teardownInterface 停用 wg-quick 单元并删除接口配置文件；没有单元时直接删除网络接口
+func (h *TaskHandler) teardownInterface(peerName string) error {
+	iface := h.config.WireGuard.Prefix + peerName
+	path := h.wireGuardConfigPath(peerName)
+	cmd := exec.Command("systemctl", "disable", "--now", "wg-quick@"+iface)
+	if h.config.Runtime.DryRun {
+		h.logger.Info().Str("DryRun", "wireguard_interface").Msg("Would run: " + cmd.String())
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// 手动用 wg-quick up 或 ip link 创建的接口没有对应的单元
+		if linkErr := exec.Command("ip", "link", "del", iface).Run(); linkErr != nil {
+			return fmt.Errorf("%s: %s", cmd.String(), strings.TrimSpace(string(output)))
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing %s: %w", path, err)
+	}
+	h.logger.Info().Str("interface", iface).Msg("Removed stale WireGuard interface")
+	return nil
+}
@@ -1,16 +1,18 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	pb "mesh-backend/api/proto/task"
 	"mesh-backend/pkg/config"
@@ -24,18 +26,43 @@ type TaskHandler struct {
 	config *config.AgentConfig
 	logger zerolog.Logger
 	client pb.TaskServiceClient
+	http   *http.Client // 访问服务端 HTTP API，已按代理和 TLS 配置设置
 
 	// 任务处理
 	taskCh chan *pb.Task
 	ctx    context.Context
+
+	// 任务在各自的协程中处理，应用配置和接口清理都会读写状态文件和接口，需串行执行
+	stateMu sync.Mutex
+
+	// 已安装的 ip rule
+	rulesMu sync.Mutex
+	rules   []types.IPRule
+
+	// 最近一次配置中的链路端点，用于故障切换
+	linksMu sync.RWMutex
+	links   []types.LinkEndpoints
+
+	// 临时日志级别
+	levelMu    sync.Mutex
+	levelReset *time.Timer
+
+	// 最近的任务结果和应用的配置，供本地 API 查询
+	historyMu sync.Mutex
+	history   []TaskRecord
+	applied   *AppliedConfig
+
+	// 强制重写配置并重启服务，只在命令行 apply 时设置
+	force bool
 }
 
 // NewTaskHandler 创建新的任务处理器
-func NewTaskHandler(cfg *config.AgentConfig, logger zerolog.Logger, client pb.TaskServiceClient, ctx context.Context) *TaskHandler {
+func NewTaskHandler(cfg *config.AgentConfig, logger zerolog.Logger, client pb.TaskServiceClient, httpClient *http.Client, ctx context.Context) *TaskHandler {
 	return &TaskHandler{
 		config: cfg,
-		logger: logger,
+		logger: logger.With().Str("component", "task").Logger(),
 		client: client,
+		http:   httpClient,
 		taskCh: make(chan *pb.Task, 100),
 		ctx:    ctx,
 	}
@@ -74,6 +101,16 @@ func (h *TaskHandler) HandleTask(task *pb.Task) {
 	switch task.Type {
 	case string(types.TaskTypeUpdate):
 		err = h.handleConfigUpdate(task)
+	case string(types.TaskTypeBandwidthTest):
+		err = h.handleBandwidthTest(task)
+	case string(types.TaskTypeTraceroute):
+		err = h.handleTraceroute(task)
+	case string(types.TaskTypeCapture):
+		err = h.handleCapture(task)
+	case string(types.TaskTypeLogLevel):
+		err = h.handleSetLogLevel(task)
+	case string(types.TaskTypeGC):
+		err = h.handleGC(task)
 	default:
 		err = fmt.Errorf("unknown task type: %s", task.Type)
 	}
@@ -89,57 +126,249 @@ func (h *TaskHandler) HandleTask(task *pb.Task) {
 	}
 }
 
-// handleConfigUpdate 处理配置更新任务
+// handleConfigUpdate 处理配置更新任务，在写入配置前后执行 agent.yaml 中配置的钩子脚本
 func (h *TaskHandler) handleConfigUpdate(task *pb.Task) error {
-	// 获取最新配置
-	url := fmt.Sprintf("%s/api/agent/config/%d", h.config.Server.Address, h.config.NodeID)
-	req, err := http.NewRequest("GET", url, nil)
+	config, err := h.fetchConfig()
 	if err != nil {
-		return fmt.Errorf("fetching config: %w", err)
+		return err
 	}
 
-	auth := fmt.Sprintf("%d:%s", h.config.NodeID, h.config.Token)
-	encodedAuth := base64.StdEncoding.EncodeToString([]byte(auth))
-	req.Header.Add("Authorization", "Basic "+encodedAuth)
+	result, err := h.applyWithHooks(task.Id, config)
+	h.reportConfigUpdate(task, result, err)
+	return nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// RunOnce 通过 HTTP 拉取配置并应用一次，与任务流中的配置更新使用相同的钩子和写入流程，用于 standalone 模式
+func (h *TaskHandler) RunOnce() (*types.ConfigUpdateResult, error) {
+	config, err := h.fetchConfig()
 	if err != nil {
-		return fmt.Errorf("发送请求失败:%s", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return h.applyWithHooks("standalone", config)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// applyWithHooks 依次执行 pre-apply 钩子、写入配置和 post-apply 钩子
+func (h *TaskHandler) applyWithHooks(taskID string, config *types.NodeConfig) (*types.ConfigUpdateResult, error) {
+	result := &types.ConfigUpdateResult{}
+	hooks, err := h.runHooks(taskID, types.HookPreApply, h.config.Hooks.PreApply, nil)
+	result.Hooks = append(result.Hooks, hooks...)
+	if err != nil {
+		return result, fmt.Errorf("pre-apply hook: %w", err)
 	}
 
-	var config types.NodeConfig
-	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
-		return fmt.Errorf("decoding config: %w", err)
+	applyErr := h.applyConfig(config)
+	status := "success"
+	if applyErr != nil {
+		status = "failed"
+	} else {
+		h.recordApplied(taskID, config)
+	}
+	hooks, err = h.runHooks(taskID, types.HookPostApply, h.config.Hooks.PostApply, []string{"MESH_APPLY_STATUS=" + status})
+	result.Hooks = append(result.Hooks, hooks...)
+	if applyErr == nil && err != nil {
+		applyErr = fmt.Errorf("post-apply hook: %w", err)
 	}
+	return result, applyErr
+}
+
+// applyConfig 写入 WireGuard 配置和所选路由守护进程的配置，更新策略路由、访问控制规则和 BGP 配置
+func (h *TaskHandler) applyConfig(config *types.NodeConfig) error {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
 
 	// 更新 WireGuard 配置
 	var configs map[string]string
-	err = json.Unmarshal([]byte(config.WireGuard), &configs)
+	if err := json.Unmarshal([]byte(config.WireGuard), &configs); err != nil {
+		return fmt.Errorf("decoding wireguard config: %w", err)
+	}
+	state, err := h.loadState()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if err := checkConfigFreshness(state, config); err != nil {
+		return err
 	}
-	if err := h.updateWireGuardConfig(configs); err != nil {
-		return fmt.Errorf("updating wireguard config: %w", err)
+	// 先停用不再需要的接口：对端改名后新接口沿用旧接口的监听端口，旧接口不停用则新接口无法启动
+	wgErr := h.removeStaleInterfaces(state, configs)
+	if wgErr == nil {
+		wgErr = h.updateWireGuardConfig(state, configs)
+	}
+	// 部分接口写入失败时也记录已写入的接口
+	if err := h.saveState(state); err != nil {
+		return err
+	}
+	if wgErr != nil {
+		return fmt.Errorf("updating wireguard config: %w", wgErr)
+	}
+
+	// 更新 Babeld、BIRD 配置或静态路由
+	if err := h.applyRoutingDaemon(config); err != nil {
+		return err
+	}
+
+	// 更新策略路由
+	if err := h.applyRoutingPolicy(config.Routing); err != nil {
+		return fmt.Errorf("applying routing policy: %w", err)
 	}
 
-	// 更新 Babeld 配置
-	if err := h.updateBabeldConfig(config.Babel); err != nil {
-		return fmt.Errorf("updating babeld config: %w", err)
+	// 更新访问控制规则
+	if err := h.applyFirewall(config.Firewall); err != nil {
+		return fmt.Errorf("applying firewall: %w", err)
+	}
+
+	// 更新 BGP 配置片段
+	if err := h.applyBGP(config.BGP); err != nil {
+		return fmt.Errorf("applying bgp config: %w", err)
+	}
+	h.setLinks(config.Links)
+
+	// 记录写入的其他配置文件和已应用配置的签发时间
+	state.ConfigIssuedAt = config.UpdatedAt
+	state.Files = make(map[string]string)
+	for path, content := range map[string]string{
+		h.config.Babel.ConfigPath: config.Babel,
+		h.config.Bird.ConfigPath:  config.Bird,
+		h.config.BGP.ConfigPath:   config.BGP,
+	} {
+		if path != "" && content != "" {
+			state.Files[path] = contentHash(strings.ReplaceAll(content, "{WGPrefix}", h.config.WireGuard.Prefix))
+		}
+	}
+	return h.saveState(state)
+}
+
+// reportConfigUpdate 回报配置更新结果，附带钩子的输出和退出码
+func (h *TaskHandler) reportConfigUpdate(task *pb.Task, result *types.ConfigUpdateResult, err error) {
+	details, _ := json.Marshal(result)
+	if err != nil {
+		h.logger.Error().Err(err).Str("task_id", task.Id).Msg("Failed to process task")
+		h.updateTaskStatus(task, &types.TaskResult{
+			Status:  types.TaskStatusFailed,
+			Error:   err.Error(),
+			Details: string(details),
+		})
+		return
 	}
 
 	h.updateTaskStatus(task, &types.TaskResult{
-		Status: types.TaskStatusSuccess,
+		Status:  types.TaskStatusSuccess,
+		Details: string(details),
 	})
 	h.logger.Info().Msg("Configuration updated successfully")
+}
+
+// fetchConfig 从服务端获取最新配置
+func (h *TaskHandler) fetchConfig() (*types.NodeConfig, error) {
+	url := fmt.Sprintf("%s/api/v1/agent/config/%d", h.config.Server.Address, h.config.NodeID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching config: %w", err)
+	}
+	h.setAuth(req)
+
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败:%s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	// 先校验签名再解码，签名覆盖节点 ID、签发时间和完整的响应体
+	var signed *types.ConfigMeta
+	if h.config.Server.ConfigPublicKey != "" {
+		key, err := types.ParseConfigPublicKey(h.config.Server.ConfigPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := types.ParseConfigMeta(resp.Header.Get(types.ConfigNodeHeader), resp.Header.Get(types.ConfigIssuedAtHeader))
+		if err != nil {
+			return nil, fmt.Errorf("rejecting config: %w", err)
+		}
+		if err := types.VerifyConfigSignature(key, meta, body, resp.Header.Get(types.ConfigSignatureHeader)); err != nil {
+			return nil, fmt.Errorf("rejecting config: %w", err)
+		}
+		if meta.NodeID != h.config.NodeID {
+			return nil, fmt.Errorf("rejecting config: signed for node %d, not this node", meta.NodeID)
+		}
+		signed = &meta
+	}
+
+	var config types.NodeConfig
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+	if config.ID != h.config.NodeID {
+		return nil, fmt.Errorf("rejecting config: issued for node %d, not this node", config.ID)
+	}
+	// 签发时间与 UpdatedAt 相同，以签名的值为准，应用时据此拒绝比已应用配置更旧的配置
+	if signed != nil {
+		config.UpdatedAt = signed.IssuedAt
+	}
+	return &config, nil
+}
+
+// setAuth 设置访问服务端 agent API 的认证头
+func (h *TaskHandler) setAuth(req *http.Request) {
+	auth := fmt.Sprintf("%d:%s", h.config.NodeID, h.config.Token)
+	encodedAuth := base64.StdEncoding.EncodeToString([]byte(auth))
+	req.Header.Add("Authorization", "Basic "+encodedAuth)
+}
+
+// Links 返回最近一次配置中的链路端点列表，尚未获取过配置时为 nil
+func (h *TaskHandler) Links() []types.LinkEndpoints {
+	h.linksMu.RLock()
+	defer h.linksMu.RUnlock()
+	return h.links
+}
+
+// LoadLinks 获取配置中的链路端点列表，不应用配置，用于 agent 启动后尚未收到配置更新的情况
+func (h *TaskHandler) LoadLinks() ([]types.LinkEndpoints, error) {
+	config, err := h.fetchConfig()
+	if err != nil {
+		return nil, err
+	}
+	h.setLinks(config.Links)
+	return h.Links(), nil
+}
+
+// ReportActiveEndpoint 向服务端报告链路切换后使用的对端端点
+func (h *TaskHandler) ReportActiveEndpoint(peerID int, endpoint string) error {
+	body, _ := json.Marshal(map[string]string{"endpoint": endpoint})
+	url := fmt.Sprintf("%s/api/v1/agent/links/%d/endpoint", h.config.Server.Address, peerID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	h.setAuth(req)
+
+	resp, err := h.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("reporting endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
 	return nil
 }
 
+func (h *TaskHandler) setLinks(links []types.LinkEndpoints) {
+	if links == nil {
+		links = []types.LinkEndpoints{}
+	}
+	h.linksMu.Lock()
+	h.links = links
+	h.linksMu.Unlock()
+}
+
 // readFileContent 读取文件内容
 func (h *TaskHandler) readFileContent(filePath string) (string, error) {
 	if h.config.Runtime.DryRun {
@@ -162,7 +391,7 @@ func (h *TaskHandler) readFileContent(filePath string) (string, error) {
 
 // configChanged 检查配置是否有变化
 func (h *TaskHandler) configChanged(filePath, newConfig string) (bool, error) {
-	if h.config.Runtime.DryRun {
+	if h.config.Runtime.DryRun || h.force {
 		return true, nil // 在DryRun模式下总是认为配置有变化
 	}
 
@@ -176,10 +405,13 @@ func (h *TaskHandler) configChanged(filePath, newConfig string) (bool, error) {
 	return currentConfig != newConfig, nil
 }
 
-// updateWireGuardConfig 更新 WireGuard 配置
-func (h *TaskHandler) updateWireGuardConfig(configs map[string]string) error {
+// updateWireGuardConfig 更新 WireGuard 配置，写入的接口记录到 state
+func (h *TaskHandler) updateWireGuardConfig(state *ManagedState, configs map[string]string) error {
 	for peerName, config := range configs {
-		configPath := filepath.Join(h.config.WireGuard.ConfigPath, fmt.Sprintf("%s%s.conf", h.config.WireGuard.Prefix, peerName))
+		configPath := h.wireGuardConfigPath(peerName)
+		if err := h.checkManaged(state, peerName, config); err != nil {
+			return err
+		}
 
 		// 检查配置是否有变化
 		changed, err := h.configChanged(configPath, config)
@@ -188,6 +420,7 @@ func (h *TaskHandler) updateWireGuardConfig(configs map[string]string) error {
 		}
 
 		if !changed {
+			state.Interfaces[peerName] = contentHash(config)
 			h.logger.Info().Str("peer", peerName).Msg("WireGuard配置未变更，跳过重启")
 			continue
 		}
@@ -197,6 +430,7 @@ func (h *TaskHandler) updateWireGuardConfig(configs map[string]string) error {
 			if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
 				return fmt.Errorf("writing wireguard config: %w", err)
 			}
+			state.Interfaces[peerName] = contentHash(config)
 		} else {
 			h.logger.Info().Str("DryRun", "wireguard_config").Str("path", configPath).Msg("Would run: " + config)
 		}
@@ -286,10 +520,15 @@ func (h *TaskHandler) restartBabeld() error {
 
 // updateTaskStatus 更新任务状态
 func (h *TaskHandler) updateTaskStatus(task *pb.Task, result *types.TaskResult) {
+	h.recordTask(task, result)
+
 	req := &pb.UpdateTaskStatusRequest{
-		TaskId: task.Id,
-		Status: string(result.Status),
-		Error:  result.Error,
+		TaskId:  task.Id,
+		Status:  string(result.Status),
+		Error:   result.Error,
+		Details: result.Details,
+		NodeId:  int32(h.config.NodeID),
+		Token:   h.config.Token,
 	}
 
 	_, err := h.client.UpdateTaskStatus(context.Background(), req)
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VerifyResult 本地配置文件的校验结果
+type VerifyResult struct {
+	Path     string   `json:"path"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// VerifyLocalFiles 校验磁盘上由 agent 管理的 WireGuard 和 babeld 配置文件，不访问服务端
+func (h *TaskHandler) VerifyLocalFiles() ([]VerifyResult, error) {
+	pattern := filepath.Join(h.config.WireGuard.ConfigPath, h.config.WireGuard.Prefix+"*.conf")
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("listing wireguard configs: %w", err)
+	}
+
+	interfaces := make(map[string]bool, len(paths))
+	results := make([]VerifyResult, 0, len(paths)+1)
+	for _, path := range paths {
+		interfaces[strings.TrimSuffix(filepath.Base(path), ".conf")] = true
+		results = append(results, VerifyResult{Path: path, Problems: verifyWireGuardFile(path)})
+	}
+	results = append(results, VerifyResult{
+		Path:     h.config.Babel.ConfigPath,
+		Problems: verifyBabeldFile(h.config.Babel.ConfigPath, interfaces),
+	})
+	return results, nil
+}
+
+// verifyWireGuardFile 检查 wg-quick 配置的结构、密钥和地址格式
+func verifyWireGuardFile(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer f.Close()
+
+	var problems []string
+	section := ""
+	interfaces, peers := 0, 0
+	hasPrivateKey := false
+	peerHasKey := true
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if section == "Peer" && !peerHasKey {
+				problems = append(problems, fmt.Sprintf("peer before line %d has no PublicKey", n))
+			}
+			section = strings.Trim(line, "[]")
+			switch section {
+			case "Interface":
+				interfaces++
+			case "Peer":
+				peers++
+				peerHasKey = false
+			default:
+				problems = append(problems, fmt.Sprintf("line %d: unknown section %s", n, line))
+			}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			problems = append(problems, fmt.Sprintf("line %d: expected key = value", n))
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "PrivateKey":
+			hasPrivateKey = true
+			if !validWireGuardKey(value) {
+				problems = append(problems, fmt.Sprintf("line %d: invalid PrivateKey", n))
+			}
+		case "PublicKey":
+			peerHasKey = true
+			if !validWireGuardKey(value) {
+				problems = append(problems, fmt.Sprintf("line %d: invalid PublicKey", n))
+			}
+		case "ListenPort":
+			if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+				problems = append(problems, fmt.Sprintf("line %d: invalid ListenPort %q", n, value))
+			}
+		case "Address", "AllowedIPs":
+			for _, prefix := range strings.Split(value, ",") {
+				if _, err := netip.ParsePrefix(strings.TrimSpace(prefix)); err != nil {
+					problems = append(problems, fmt.Sprintf("line %d: invalid %s %q", n, key, prefix))
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return append(problems, err.Error())
+	}
+	if section == "Peer" && !peerHasKey {
+		problems = append(problems, "last peer has no PublicKey")
+	}
+	if interfaces != 1 {
+		problems = append(problems, fmt.Sprintf("expected exactly one [Interface] section, found %d", interfaces))
+	}
+	if !hasPrivateKey {
+		problems = append(problems, "missing PrivateKey")
+	}
+	if peers == 0 {
+		problems = append(problems, "no [Peer] section")
+	}
+	return problems
+}
+
+// verifyBabeldFile 检查 babeld 配置存在且引用的接口都有对应的 WireGuard 配置
+func verifyBabeldFile(path string, interfaces map[string]bool) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	if strings.Contains(string(content), "{WGPrefix}") {
+		problems = append(problems, "contains unreplaced {WGPrefix} placeholder")
+	}
+	for n, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "interface" && !interfaces[fields[1]] {
+			problems = append(problems, fmt.Sprintf("line %d: interface %s has no wireguard config", n+1, fields[1]))
+		}
+	}
+	return problems
+}
+
+// validWireGuardKey 检查是否为 base64 编码的 32 字节密钥
+func validWireGuardKey(key string) bool {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(raw) == 32
+}
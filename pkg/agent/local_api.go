@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/agent/handlers"
+)
+
+// statusReportInterval 状态上报间隔
+const statusReportInterval = 30 * time.Second
+
+// agentHealth agent 与服务端的连接状态
+type agentHealth struct {
+	mu sync.Mutex
+
+	streamConnected bool      // 任务流是否已建立
+	streamChangedAt time.Time // 任务流状态变化的时间
+	streamError     string    // 任务流最近一次断开的原因
+
+	lastReport      time.Time // 最近一次成功上报状态的时间
+	lastReportError string    // 最近一次上报失败的原因，成功后清空
+}
+
+// setStream 记录任务流状态
+func (h *agentHealth) setStream(connected bool, err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streamConnected = connected
+	h.streamChangedAt = now
+	if err != nil {
+		h.streamError = err.Error()
+	}
+}
+
+// setReport 记录状态上报结果
+func (h *agentHealth) setReport(err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.lastReportError = err.Error()
+		return
+	}
+	h.lastReport = now
+	h.lastReportError = ""
+}
+
+// connectionState 本地 API 返回的连接状态
+type connectionState struct {
+	Server          string     `json:"server"`
+	StreamConnected bool       `json:"stream_connected"`
+	StreamSince     *time.Time `json:"stream_since,omitempty"`
+	StreamError     string     `json:"stream_error,omitempty"`
+	LastReport      *time.Time `json:"last_report,omitempty"`
+	LastReportError string     `json:"last_report_error,omitempty"`
+}
+
+// connection 返回当前连接状态
+func (a *Agent) connection() connectionState {
+	a.health.mu.Lock()
+	defer a.health.mu.Unlock()
+
+	state := connectionState{
+		Server:          a.config.Server.GRPCAddress,
+		StreamConnected: a.health.streamConnected,
+		StreamError:     a.health.streamError,
+		LastReportError: a.health.lastReportError,
+	}
+	if !a.health.streamChangedAt.IsZero() {
+		since := a.health.streamChangedAt
+		state.StreamSince = &since
+	}
+	if !a.health.lastReport.IsZero() {
+		last := a.health.lastReport
+		state.LastReport = &last
+	}
+	return state
+}
+
+// startLocalAPI 在本机回环地址上启动只读的本地 API，供登录节点的运维人员查看 agent 状态
+//
+//	GET /health  连接健康检查，不健康时返回 503
+//	GET /status  连接状态、最近应用的配置和链路
+//	GET /tasks   最近处理的任务结果
+func (a *Agent) startLocalAPI() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", a.handleLocalHealth)
+	mux.HandleFunc("GET /status", a.handleLocalStatus)
+	mux.HandleFunc("GET /tasks", a.handleLocalTasks)
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(a.config.LocalAPI.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	a.localAPI = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		if err := a.localAPI.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.logger.Error().Err(err).Msg("Local API server stopped")
+		}
+	}()
+	a.logger.Info().Str("address", addr).Msg("Local API listening")
+	return nil
+}
+
+// stopLocalAPI 关闭本地 API
+func (a *Agent) stopLocalAPI() {
+	if a.localAPI == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.localAPI.Shutdown(ctx); err != nil {
+		a.logger.Error().Err(err).Msg("Failed to stop local API")
+	}
+}
+
+// handleLocalHealth 任务流已建立且最近按时上报状态时视为健康
+func (a *Agent) handleLocalHealth(w http.ResponseWriter, _ *http.Request) {
+	conn := a.connection()
+	checks := map[string]string{}
+	if !conn.StreamConnected {
+		checks["task_stream"] = "disconnected"
+	}
+	if conn.LastReport == nil || a.clock.Now().Sub(*conn.LastReport) > 3*statusReportInterval {
+		checks["status_report"] = "stale"
+	}
+
+	code := http.StatusOK
+	if len(checks) > 0 {
+		code = http.StatusServiceUnavailable
+	}
+	writeLocalJSON(w, code, map[string]any{
+		"healthy": len(checks) == 0,
+		"failed":  checks,
+	})
+}
+
+// handleLocalStatus 返回 agent 概况
+func (a *Agent) handleLocalStatus(w http.ResponseWriter, _ *http.Request) {
+	status := map[string]any{
+		"node_id":    a.config.NodeID,
+		"hostname":   a.hostname,
+		"version":    runtime.Version(),
+		"dry_run":    a.config.Runtime.DryRun,
+		"connection": a.connection(),
+	}
+	if a.taskHandler != nil {
+		status["applied_config"] = a.taskHandler.AppliedConfig()
+		status["links"] = a.taskHandler.Links()
+	}
+	writeLocalJSON(w, http.StatusOK, status)
+}
+
+// handleLocalTasks 返回最近处理的任务结果
+func (a *Agent) handleLocalTasks(w http.ResponseWriter, _ *http.Request) {
+	tasks := []handlers.TaskRecord{}
+	if a.taskHandler != nil {
+		tasks = a.taskHandler.RecentTasks()
+	}
+	writeLocalJSON(w, http.StatusOK, tasks)
+}
+
+func writeLocalJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	lpb "mesh-backend/api/proto/logs"
+
+	"github.com/rs/zerolog"
+)
+
+// logShipInterval 日志上传间隔
+const logShipInterval = 2 * time.Second
+
+// LogShipper 收集 agent 自身的结构化日志（以及可选的 journald 日志）并定期上传到服务端
+//
+// LogShipper 实现 io.Writer，作为日志的额外输出使用，每次 Write 对应一条 JSON 日志。
+type LogShipper struct {
+	mu      sync.Mutex
+	pending []*lpb.LogEntry
+	size    int
+}
+
+// NewLogShipper 创建日志上传器，size 为等待上传的最大条数
+func NewLogShipper(size int) *LogShipper {
+	return &LogShipper{size: size}
+}
+
+// Write 解析一条 zerolog JSON 日志并加入待上传队列，解析失败的日志原样作为消息
+func (s *LogShipper) Write(p []byte) (int, error) {
+	entry := &lpb.LogEntry{Source: "agent", Timestamp: time.Now().UnixNano()}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(p, &fields); err != nil {
+		entry.Message = string(p)
+	} else {
+		if v, ok := fields[zerolog.LevelFieldName].(string); ok {
+			entry.Level = v
+		}
+		if v, ok := fields[zerolog.MessageFieldName].(string); ok {
+			entry.Message = v
+		}
+		if v, ok := fields[zerolog.TimestampFieldName].(string); ok {
+			if t, err := time.Parse(zerolog.TimeFieldFormat, v); err == nil {
+				entry.Timestamp = t.UnixNano()
+			}
+		}
+		delete(fields, zerolog.LevelFieldName)
+		delete(fields, zerolog.MessageFieldName)
+		delete(fields, zerolog.TimestampFieldName)
+		if len(fields) > 0 {
+			data, _ := json.Marshal(fields)
+			entry.Fields = string(data)
+		}
+	}
+
+	s.add(entry)
+	return len(p), nil
+}
+
+// add 加入待上传队列，超出容量时丢弃最旧的日志
+func (s *LogShipper) add(entries ...*lpb.LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, entries...)
+	if over := len(s.pending) - s.size; over > 0 {
+		s.pending = s.pending[over:]
+	}
+}
+
+// take 取出全部待上传日志
+func (s *LogShipper) take() []*lpb.LogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.pending
+	s.pending = nil
+	return entries
+}
+
+// requeue 上传失败时放回队列头部，超出容量时丢弃最旧的日志
+func (s *LogShipper) requeue(entries []*lpb.LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(entries, s.pending...)
+	if over := len(s.pending) - s.size; over > 0 {
+		s.pending = s.pending[over:]
+	}
+}
+
+// run 定期上传日志直到 ctx 取消，连接断开后在下个周期重新建立上传流
+func (s *LogShipper) run(ctx context.Context, client func() lpb.LogServiceClient, nodeID int32, token string, logger zerolog.Logger) {
+	ticker := time.NewTicker(logShipInterval)
+	defer ticker.Stop()
+
+	var stream lpb.LogService_ShipLogsClient
+	for {
+		select {
+		case <-ctx.Done():
+			if stream != nil {
+				stream.CloseAndRecv()
+			}
+			return
+		case <-ticker.C:
+		}
+
+		entries := s.take()
+		if len(entries) == 0 {
+			continue
+		}
+
+		if stream == nil {
+			var err error
+			stream, err = client().ShipLogs(ctx)
+			if err != nil {
+				s.requeue(entries)
+				logger.Debug().Err(err).Msg("Failed to open log stream")
+				continue
+			}
+		}
+
+		err := stream.Send(&lpb.LogBatch{NodeId: nodeID, Token: token, Entries: entries})
+		if err == io.EOF {
+			// 服务端关闭了流，实际错误由 CloseAndRecv 返回
+			_, err = stream.CloseAndRecv()
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		if err != nil {
+			stream = nil
+			s.requeue(entries)
+			logger.Debug().Err(err).Msg("Failed to ship logs")
+		}
+	}
+}
+
+// followJournald 跟踪 wg-quick@ 和 babeld 单元的 journald 日志直到 ctx 取消
+func (s *LogShipper) followJournald(ctx context.Context, logger zerolog.Logger) {
+	for {
+		cmd := exec.CommandContext(ctx, "journalctl", "-f", "-n", "0", "-o", "json", "-u", "wg-quick@*", "-u", "babeld.service")
+		stdout, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			logger.Warn().Err(err).Msg("Failed to follow journald, journald logs will not be shipped")
+			return
+		}
+
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if entry := parseJournalEntry(scanner.Bytes()); entry != nil {
+				s.add(entry)
+			}
+		}
+		cmd.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// parseJournalEntry 解析 journalctl -o json 输出的一行
+func parseJournalEntry(line []byte) *lpb.LogEntry {
+	var fields struct {
+		Message   interface{} `json:"MESSAGE"`
+		Priority  string      `json:"PRIORITY"`
+		Unit      string      `json:"_SYSTEMD_UNIT"`
+		Timestamp string      `json:"__REALTIME_TIMESTAMP"`
+	}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil
+	}
+	// 非 UTF-8 的消息以字节数组表示，直接跳过
+	message, ok := fields.Message.(string)
+	if !ok {
+		return nil
+	}
+
+	entry := &lpb.LogEntry{
+		Source:  fields.Unit,
+		Message: message,
+		Level:   journalLevel(fields.Priority),
+	}
+	if usec, err := strconv.ParseInt(fields.Timestamp, 10, 64); err == nil {
+		entry.Timestamp = usec * int64(time.Microsecond)
+	}
+	return entry
+}
+
+// journalLevel 将 syslog 优先级转换为日志级别
+func journalLevel(priority string) string {
+	switch priority {
+	case "0", "1", "2", "3":
+		return zerolog.LevelErrorValue
+	case "4":
+		return zerolog.LevelWarnValue
+	case "7":
+		return zerolog.LevelDebugValue
+	default:
+		return zerolog.LevelInfoValue
+	}
+}
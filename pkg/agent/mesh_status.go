@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+)
+
+// collectWireGuard 通过 wg show all dump 采集本节点管理的接口上所有对等节点的状态
+func (a *Agent) collectWireGuard(ctx context.Context) (*spb.WireGuardStatus, error) {
+	output, err := exec.CommandContext(ctx, "wg", "show", "all", "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("executing wg show: %w", err)
+	}
+
+	status := &spb.WireGuardStatus{}
+	for _, line := range strings.Split(string(output), "\n") {
+		// 对等节点行：interface public-key preshared-key endpoint allowed-ips latest-handshake rx tx keepalive
+		// 接口行只有 5 列，跳过
+		fields := strings.Split(line, "\t")
+		if len(fields) != 9 {
+			continue
+		}
+		if a.config.WireGuard.Prefix != "" && !strings.HasPrefix(fields[0], a.config.WireGuard.Prefix) {
+			continue
+		}
+
+		peer := &spb.WireGuardPeer{
+			Interface: fields[0],
+			PublicKey: fields[1],
+		}
+		if fields[3] != "(none)" {
+			peer.Endpoint = fields[3]
+		}
+		peer.LatestHandshake, _ = strconv.ParseInt(fields[5], 10, 64)
+		peer.RxBytes, _ = strconv.ParseInt(fields[6], 10, 64)
+		peer.TxBytes, _ = strconv.ParseInt(fields[7], 10, 64)
+		status.Peers = append(status.Peers, peer)
+	}
+	return status, nil
+}
+
+// collectBabel 通过 babeld 本地控制套接字的 dump 命令采集邻居状态
+func (a *Agent) collectBabel(ctx context.Context) (*spb.BabelStatus, error) {
+	status := &spb.BabelStatus{}
+	if a.config.Babel.ControlSocket == "" {
+		return status, nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", a.config.Babel.ControlSocket)
+	if err != nil {
+		// 套接字无法连接视为 babeld 未运行
+		return status, fmt.Errorf("connecting babeld control socket: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	status.Running = true
+
+	reader := bufio.NewReader(conn)
+	// 跳过连接时输出的版本信息
+	if err := readBabelReply(reader, nil); err != nil {
+		return status, err
+	}
+	if _, err := conn.Write([]byte("dump\n")); err != nil {
+		return status, fmt.Errorf("sending dump: %w", err)
+	}
+	err = readBabelReply(reader, func(fields []string) {
+		if len(fields) < 4 || fields[0] != "add" || fields[1] != "neighbour" {
+			return
+		}
+		if n := parseBabelNeighbour(fields[3:]); n != nil {
+			status.Neighbours = append(status.Neighbours, n)
+		}
+	})
+	return status, err
+}
+
+// readBabelReply 逐行读取 babeld 回复直到 ok，遇到 bad 或 no 时返回错误
+func readBabelReply(reader *bufio.Reader, handle func(fields []string)) error {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("reading babeld reply: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "ok":
+			return nil
+		case line == "bad" || line == "no" || strings.HasPrefix(line, "no "):
+			return fmt.Errorf("babeld replied %q", line)
+		}
+		if handle != nil {
+			handle(strings.Fields(line))
+		}
+	}
+}
+
+// parseBabelNeighbour 解析 neighbour 行中 id 之后的键值对，如 address fe80::1 if wg_1 reach ffff rxcost 96 txcost 96 cost 96
+func parseBabelNeighbour(fields []string) *spb.BabelNeighbour {
+	n := &spb.BabelNeighbour{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := fields[i+1]
+		switch fields[i] {
+		case "address":
+			n.Address = value
+		case "if":
+			n.Interface = value
+		case "reach":
+			reach, _ := strconv.ParseInt(value, 16, 32)
+			n.Reach = int32(reach)
+		case "rxcost":
+			n.Rxcost = parseBabelInt(value)
+		case "txcost":
+			n.Txcost = parseBabelInt(value)
+		case "cost":
+			n.Cost = parseBabelInt(value)
+		}
+	}
+	if n.Address == "" {
+		return nil
+	}
+	return n
+}
+
+func parseBabelInt(value string) int32 {
+	v, _ := strconv.ParseInt(value, 10, 32)
+	return int32(v)
+}
+
+// collectMeshStatus 采集 WireGuard 与 Babel 状态，失败时记录日志并返回已采集到的部分，不影响状态上报
+func (a *Agent) collectMeshStatus() (*spb.WireGuardStatus, *spb.BabelStatus) {
+	ctx, cancel := context.WithTimeout(a.ctx, 5*time.Second)
+	defer cancel()
+
+	wg, err := a.collectWireGuard(ctx)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to collect WireGuard status")
+		wg = &spb.WireGuardStatus{}
+	}
+
+	babel, err := a.collectBabel(ctx)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to collect Babel status")
+	}
+
+	// 每个 WireGuard 接口点对点连接一个对等节点，按接口补全邻居对应的公钥
+	keys := make(map[string]string, len(wg.Peers))
+	for _, peer := range wg.Peers {
+		keys[peer.Interface] = peer.PublicKey
+	}
+	for _, n := range babel.Neighbours {
+		n.PublicKey = keys[n.Interface]
+	}
+
+	return wg, babel
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// staleHandshake 握手超过该时间视为链路不通，与 wireguard-tools 的 reresolve-dns.sh 相同；
+// 链路正常时不重新设置端点，避免覆盖对端漫游后的地址
+const staleHandshake = 135 * time.Second
+
+// resolveLoop 定期重新解析以域名配置的对端端点，地址变化后通过 wg set 更新
+func (a *Agent) resolveLoop() {
+	ticker := a.clock.NewTicker(a.config.Endpoints.ResolveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C():
+			a.resolveEndpoints()
+		}
+	}
+}
+
+// resolveEndpoints 检查一轮握手超时且端点为域名的链路
+func (a *Agent) resolveEndpoints() {
+	links := a.taskHandler.Links()
+	if links == nil {
+		var err error
+		if links, err = a.taskHandler.LoadLinks(); err != nil {
+			a.logger.Warn().Err(err).Msg("Failed to load link endpoints")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 30*time.Second)
+	defer cancel()
+	wg, err := a.collectWireGuard(ctx)
+	if err != nil {
+		a.logger.Warn().Err(err).Msg("Failed to collect WireGuard status for endpoint resolution")
+		return
+	}
+	type peerState struct {
+		endpoint  string
+		handshake int64
+	}
+	peers := make(map[string]peerState, len(wg.Peers))
+	for _, peer := range wg.Peers {
+		peers[peer.Interface+" "+peer.PublicKey] = peerState{endpoint: peer.Endpoint, handshake: peer.LatestHandshake}
+	}
+
+	now := a.clock.Now()
+	for _, link := range links {
+		iface := a.config.WireGuard.Prefix + link.Interface
+		peer, ok := peers[iface+" "+link.PublicKey]
+		if !ok {
+			// 接口未启动
+			continue
+		}
+		if peer.handshake > 0 && now.Sub(time.Unix(peer.handshake, 0)) < staleHandshake {
+			continue
+		}
+
+		endpoint := link.Active
+		if v, ok := a.switched.Load(iface); ok {
+			if sw := v.(switchedEndpoint); sw.active == link.Active {
+				endpoint = sw.endpoint
+			}
+		}
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil || net.ParseIP(host) != nil {
+			continue
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			a.logger.Warn().Err(err).Str("interface", iface).Str("endpoint", endpoint).Msg("Failed to resolve peer endpoint")
+			continue
+		}
+		if current, _, err := net.SplitHostPort(peer.endpoint); err == nil {
+			if ip := net.ParseIP(current); ip != nil && containsIP(addrs, ip) {
+				continue
+			}
+		}
+
+		// wg set 会重新解析域名
+		if err := a.setPeerEndpoint(iface, link.PublicKey, endpoint); err != nil {
+			a.logger.Warn().Err(err).Str("interface", iface).Str("endpoint", endpoint).Msg("Failed to update peer endpoint")
+			continue
+		}
+		a.logger.Info().
+			Str("interface", iface).
+			Str("endpoint", endpoint).
+			Str("previous", peer.endpoint).
+			Msg("Peer endpoint address changed, updated")
+	}
+}
+
+func containsIP(addrs []net.IPAddr, ip net.IP) bool {
+	for _, addr := range addrs {
+		if addr.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
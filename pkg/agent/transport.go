@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"mesh-backend/pkg/utils/proxy"
+)
+
+// dialTimeout 建立到服务端或代理的 TCP 连接的超时
+const dialTimeout = 10 * time.Second
+
+// tlsConfig 根据配置构造连接服务端使用的 TLS 配置
+func (a *Agent) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: a.config.Server.TLS.ServerName}
+	if a.certs != nil {
+		cfg.GetClientCertificate = a.certs.getClientCertificate
+	}
+	if a.config.Server.TLS.CACert != "" {
+		pem, err := os.ReadFile(a.config.Server.TLS.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", a.config.Server.TLS.CACert)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// setupTransport 根据代理和 TLS 配置创建拨号函数和 HTTP 客户端，gRPC 连接和配置拉取共用
+func (a *Agent) setupTransport() error {
+	if a.config.Server.TLS.ClientCert != "" {
+		certs, err := newCertManager(a.config.Server.TLS.ClientCert, a.config.Server.TLS.ClientKey)
+		if err != nil {
+			return err
+		}
+		a.certs = certs
+	}
+
+	dial, err := proxy.NewDialer(a.config.Server.Proxy, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("creating proxy dialer: %w", err)
+	}
+	tlsCfg, err := a.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// 代理由拨号函数处理，不再读取 HTTP_PROXY 等环境变量
+	transport.Proxy = nil
+	transport.DialContext = dial
+	transport.TLSClientConfig = tlsCfg
+
+	a.dial = dial
+	a.httpClient = &http.Client{Transport: transport}
+	if a.config.Server.Proxy != "" {
+		a.logger.Info().Str("proxy", redactProxy(a.config.Server.Proxy)).Msg("Connecting to server through proxy")
+	}
+	return nil
+}
+
+// redactProxy 隐藏代理地址中的密码，用于日志
+func redactProxy(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
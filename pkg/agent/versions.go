@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// softwareRefreshInterval 重新采集组件版本的间隔，版本只在升级后变化，无需每次上报都执行命令
+const softwareRefreshInterval = time.Hour
+
+// softwareVersions 返回随状态上报的组件版本，超过 softwareRefreshInterval 后重新采集
+func (a *Agent) softwareVersions() *spb.SoftwareVersions {
+	if a.software != nil && time.Since(a.softwareAt) < softwareRefreshInterval {
+		return a.software
+	}
+	a.software = a.collectSoftwareVersions()
+	a.softwareAt = time.Now()
+	return a.software
+}
+
+// collectSoftwareVersions 采集发行版、内核、wireguard-tools、WireGuard 内核模块和 babeld 的版本
+func (a *Agent) collectSoftwareVersions() *spb.SoftwareVersions {
+	sw := &spb.SoftwareVersions{}
+	if info, err := host.Info(); err == nil {
+		sw.Os = strings.TrimSpace(info.Platform + " " + info.PlatformVersion)
+		sw.Kernel = info.KernelVersion
+	} else {
+		a.logger.Debug().Err(err).Msg("Failed to get host info")
+	}
+
+	// 以模块加载的 WireGuard 会在 sysfs 中提供版本，内置于内核时没有该文件
+	if data, err := os.ReadFile("/sys/module/wireguard/version"); err == nil {
+		sw.WireguardModule = strings.TrimSpace(string(data))
+	}
+
+	babeld := a.config.Babel.BinPath
+	if babeld == "" {
+		babeld = "babeld"
+	}
+	sw.WireguardTools = toolVersion("wg", "--version")
+	sw.Babeld = toolVersion(babeld, "-V")
+	return sw
+}
+
+// toolVersion 执行命令并从输出中解析版本号，命令不存在或无法解析时返回空
+func toolVersion(name string, args ...string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	// babeld 和 bird 把版本打印到 stderr，退出码不一定为 0
+	output, _ := exec.Command(name, args...).CombinedOutput()
+	return versionPattern.FindString(string(output))
+}
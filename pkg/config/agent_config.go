@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,15 +16,22 @@ import (
 type AgentConfig struct {
 	// 节点标识
 	NodeID int    `yaml:"node_id"`
-	Token  string `yaml:"token"`
+	Token  string `yaml:"token"` // 可写作 env:NAME、credential:NAME 或 secret:NAME 引用，见 secrets
 
 	// 服务端连接信息
 	Server struct {
 		Address     string `yaml:"address"`      // HTTP API地址
 		GRPCAddress string `yaml:"grpc_address"` // gRPC服务地址
-		TLS         struct {
-			Enabled bool   `yaml:"enabled"`
-			CACert  string `yaml:"ca_cert"`
+		Compression string `yaml:"compression"`  // gRPC 消息压缩算法，目前支持 gzip，为空时不压缩
+		Proxy       string `yaml:"proxy"`        // 出站代理，gRPC 和 HTTP 请求都经由此代理，支持 http://、https://、socks5://、socks5h://
+		// 服务端配置签名公钥（base64），设置后拒绝应用未签名或签名无效的配置
+		ConfigPublicKey string `yaml:"config_public_key"`
+		TLS             struct {
+			Enabled    bool   `yaml:"enabled"`
+			CACert     string `yaml:"ca_cert"`
+			ServerName string `yaml:"server_name"` // 覆盖 TLS 握手的 SNI 和证书校验主机名，为空时使用连接地址中的主机名
+			ClientCert string `yaml:"client_cert"` // 客户端证书保存路径，配置后向服务端申请证书并用于认证
+			ClientKey  string `yaml:"client_key"`  // 客户端私钥保存路径
 		} `yaml:"tls"`
 	} `yaml:"server"`
 
@@ -31,17 +43,90 @@ type AgentConfig struct {
 
 	// Babeld配置
 	Babel struct {
-		ConfigPath string `yaml:"config_path"` // Babeld配置文件路径
-		BinPath    string `yaml:"bin_path"`    // babeld命令路径
+		ConfigPath    string `yaml:"config_path"`    // Babeld配置文件路径
+		BinPath       string `yaml:"bin_path"`       // babeld命令路径
+		ControlSocket string `yaml:"control_socket"` // babeld本地控制套接字，为空时不采集邻居状态
 	} `yaml:"babel"`
 
+	// BGP 对接：边界节点将服务端生成的 BIRD 配置片段写入 config_path，BIRD 主配置需 include 该文件
+	BGP struct {
+		ConfigPath    string   `yaml:"config_path"`    // BIRD 配置片段路径，为空时忽略服务端下发的 BGP 配置
+		ReloadCommand []string `yaml:"reload_command"` // 片段变化后执行的命令
+	} `yaml:"bgp"`
+
+	// BIRD 路由：租户选择 bird-babel 或 bird-ospf 时，服务端生成的路由配置片段写入 config_path，BIRD 主配置需 include 该文件
+	Bird struct {
+		ConfigPath    string   `yaml:"config_path"`    // BIRD 路由配置片段路径，为空时无法使用 BIRD 作为路由守护进程
+		ReloadCommand []string `yaml:"reload_command"` // 片段变化后执行的命令
+	} `yaml:"bird"`
+
 	// 运行时配置
 	Runtime struct {
-		LogPath     string `yaml:"log_path"`     // 日志文件路径
-		LogLevel    string `yaml:"log_level"`    // 日志级别
-		DryRun      bool   `yaml:"dry_run"`      // 调试模式
-		MetricsPort int    `yaml:"metrics_port"` // 指标监控端口
+		LogPath         string            `yaml:"log_path"`          // 日志文件路径
+		LogLevel        string            `yaml:"log_level"`         // 日志级别
+		LogMaxSize      int               `yaml:"log_max_size"`      // 单个日志文件的最大大小（MB），超出后轮转
+		LogMaxBackups   int               `yaml:"log_max_backups"`   // 保留的旧日志文件数，为 0 时全部保留
+		LogMaxAge       int               `yaml:"log_max_age"`       // 旧日志文件的保留天数，为 0 时不按时间清理
+		LogCompress     bool              `yaml:"log_compress"`      // 压缩轮转后的旧日志文件
+		LogFormat       string            `yaml:"log_format"`        // 控制台输出格式：console 或 json
+		LogComponents   map[string]string `yaml:"log_components"`    // 按 component 覆盖日志级别
+		LogSampleBurst  int               `yaml:"log_sample_burst"`  // 每个周期内同一条 debug/info 消息最多输出的条数，0 表示不采样
+		LogSamplePeriod time.Duration     `yaml:"log_sample_period"` // 采样周期
+		DryRun          bool              `yaml:"dry_run"`           // 调试模式
+		Standalone      bool              `yaml:"standalone"`        // 只通过 HTTP 拉取并应用一次配置后退出，不连接 gRPC，适合 cron 定时执行
+		MetricsPort     int               `yaml:"metrics_port"`      // 指标监控端口
+		StatePath       string            `yaml:"state_path"`        // 记录 agent 管理的接口和文件的状态文件
 	} `yaml:"runtime"`
+
+	// 日志上传
+	LogShipping struct {
+		Enabled    bool `yaml:"enabled"`     // 将最近的日志上传到服务端
+		Journald   bool `yaml:"journald"`    // 同时上传 wg-quick@ 和 babeld 单元的 journald 日志
+		BufferSize int  `yaml:"buffer_size"` // 等待上传的最大条数，超出时丢弃最旧的日志
+	} `yaml:"log_shipping"`
+
+	// 端点故障切换：链路长时间没有握手时依次尝试对端的下一个端点
+	Failover struct {
+		Enabled          bool          `yaml:"enabled"`
+		HandshakeTimeout time.Duration `yaml:"handshake_timeout"` // 超过该时间没有握手时切换端点，WireGuard 每 2 分钟重新握手
+		CheckInterval    time.Duration `yaml:"check_interval"`    // 检查间隔
+	} `yaml:"failover"`
+
+	// 域名端点：WireGuard 只在加载配置时解析一次对端域名，地址变化后需要重新设置端点
+	Endpoints struct {
+		ResolveInterval time.Duration `yaml:"resolve_interval"` // 重新解析对端域名的间隔，为负数时不重新解析
+	} `yaml:"endpoints"`
+
+	// 资源：容器内的指标统计和 agent 自身的资源限制
+	Resources struct {
+		CgroupMetrics string `yaml:"cgroup_metrics"`  // auto：所在 cgroup v2 设有 CPU 或内存限额时按限额统计使用率；always；never 始终统计整机
+		MaxProcs      int    `yaml:"max_procs"`       // GOMAXPROCS，为 0 时按 cgroup 的 CPU 限额设置
+		MemoryLimitMB int    `yaml:"memory_limit_mb"` // Go 运行时的软内存上限（MB），为 0 时不限
+		TaskNice      int    `yaml:"task_nice"`       // 抓包、路径探测等重任务子进程的 nice 值，为 0 时不调整
+		TaskIOClass   string `yaml:"task_io_class"`   // 重任务子进程的 ionice 调度类：idle 或 best-effort，为空时不调整
+	} `yaml:"resources"`
+
+	// 配置更新钩子：只有这里列出的脚本会被执行，服务端无法指定命令
+	Hooks struct {
+		PreApply  []string      `yaml:"pre_apply"`  // 写入配置前依次执行，任一失败则放弃本次更新
+		PostApply []string      `yaml:"post_apply"` // 写入配置后依次执行，失败时任务回报失败
+		Timeout   time.Duration `yaml:"timeout"`    // 单个脚本的超时时间
+	} `yaml:"hooks"`
+
+	// 本地 API：只监听 127.0.0.1，供登录节点的运维人员查看连接状态、最近应用的配置和任务结果
+	LocalAPI struct {
+		Enabled bool `yaml:"enabled"`
+		Port    int  `yaml:"port"`
+	} `yaml:"local_api"`
+
+	// 加密的 secrets 文件，以 secret:NAME 引用其中的条目，用 agent secret set 写入
+	Secrets struct {
+		File       string `yaml:"file"`
+		MachineKey string `yaml:"machine_key"` // 派生加密密钥的本机文件，只能由所有者访问，默认为 secrets 文件路径加 .key 后缀，首次写入时生成
+	} `yaml:"secrets"`
+
+	// Warnings 加载配置时发现的问题，日志初始化后输出
+	Warnings []string `yaml:"-"`
 }
 
 // LoadAgentConfig 加载客户端配置
@@ -58,6 +143,10 @@ func LoadAgentConfig(path string, workspaceRoot string) (*AgentConfig, error) {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
+	if cfg.Token, err = cfg.resolveSecret("token", cfg.Token); err != nil {
+		return nil, err
+	}
+
 	// 验证必要字段
 	if cfg.NodeID == 0 {
 		return nil, fmt.Errorf("node_id is required")
@@ -72,6 +161,116 @@ func LoadAgentConfig(path string, workspaceRoot string) (*AgentConfig, error) {
 		return nil, fmt.Errorf("server.grpc_address is required")
 	}
 
+	if (cfg.Server.TLS.ClientCert == "") != (cfg.Server.TLS.ClientKey == "") {
+		return nil, fmt.Errorf("server.tls.client_cert and server.tls.client_key must be set together")
+	}
+	if cfg.Server.TLS.ClientCert != "" && !cfg.Server.TLS.Enabled {
+		return nil, fmt.Errorf("server.tls.client_cert requires server.tls.enabled")
+	}
+
+	switch cfg.Server.Compression {
+	case "", "gzip":
+	default:
+		return nil, fmt.Errorf("invalid server.compression: %s", cfg.Server.Compression)
+	}
+
+	if cfg.Server.Proxy != "" {
+		u, err := url.Parse(cfg.Server.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server.proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid server.proxy scheme: %s", u.Scheme)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("server.proxy has no host")
+		}
+	}
+	if key := cfg.Server.ConfigPublicKey; key != "" {
+		if raw, err := base64.StdEncoding.DecodeString(key); err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid server.config_public_key: must be a base64 encoded ed25519 public key")
+		}
+	}
+
+	if cfg.Runtime.LogMaxBackups < 0 || cfg.Runtime.LogMaxAge < 0 {
+		return nil, fmt.Errorf("runtime.log_max_backups and runtime.log_max_age cannot be negative")
+	}
+
+	switch cfg.Runtime.LogFormat {
+	case "", "console", "json":
+	default:
+		return nil, fmt.Errorf("invalid runtime.log_format: %s", cfg.Runtime.LogFormat)
+	}
+
+	for _, path := range append(append([]string{}, cfg.Hooks.PreApply...), cfg.Hooks.PostApply...) {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("hook path must be absolute: %s", path)
+		}
+	}
+
+	switch cfg.Resources.CgroupMetrics {
+	case "", "auto", "always", "never":
+	default:
+		return nil, fmt.Errorf("invalid resources.cgroup_metrics: %s", cfg.Resources.CgroupMetrics)
+	}
+	if cfg.Resources.MaxProcs < 0 || cfg.Resources.MemoryLimitMB < 0 {
+		return nil, fmt.Errorf("resources.max_procs and resources.memory_limit_mb cannot be negative")
+	}
+	if cfg.Resources.TaskNice < -20 || cfg.Resources.TaskNice > 19 {
+		return nil, fmt.Errorf("invalid resources.task_nice: %d", cfg.Resources.TaskNice)
+	}
+	switch cfg.Resources.TaskIOClass {
+	case "", "idle", "best-effort":
+	default:
+		return nil, fmt.Errorf("invalid resources.task_io_class: %s", cfg.Resources.TaskIOClass)
+	}
+
+	if cfg.LocalAPI.Port < 0 || cfg.LocalAPI.Port > 65535 {
+		return nil, fmt.Errorf("invalid local_api.port: %d", cfg.LocalAPI.Port)
+	}
+
+	if cfg.Runtime.LogLevel == "" {
+		cfg.Runtime.LogLevel = "info"
+	}
+	if cfg.Runtime.LogMaxSize <= 0 {
+		cfg.Runtime.LogMaxSize = 100
+	}
+	if cfg.Runtime.LogSamplePeriod <= 0 {
+		cfg.Runtime.LogSamplePeriod = time.Second
+	}
+	if cfg.LogShipping.BufferSize <= 0 {
+		cfg.LogShipping.BufferSize = 1000
+	}
+	if cfg.Failover.HandshakeTimeout <= 0 {
+		cfg.Failover.HandshakeTimeout = 5 * time.Minute
+	}
+	if cfg.Failover.CheckInterval <= 0 {
+		cfg.Failover.CheckInterval = 30 * time.Second
+	}
+	if cfg.Endpoints.ResolveInterval == 0 {
+		cfg.Endpoints.ResolveInterval = 5 * time.Minute
+	}
+	if cfg.Resources.CgroupMetrics == "" {
+		cfg.Resources.CgroupMetrics = "auto"
+	}
+	if cfg.Hooks.Timeout <= 0 {
+		cfg.Hooks.Timeout = 30 * time.Second
+	}
+	if cfg.LocalAPI.Port == 0 {
+		cfg.LocalAPI.Port = 9101
+	}
+	if len(cfg.BGP.ReloadCommand) == 0 {
+		cfg.BGP.ReloadCommand = []string{"birdc", "configure"}
+	}
+	if len(cfg.Bird.ReloadCommand) == 0 {
+		cfg.Bird.ReloadCommand = []string{"birdc", "configure"}
+	}
+	if cfg.Runtime.StatePath == "" {
+		cfg.Runtime.StatePath = "data/state.json"
+	}
+
 	return cfg, nil
 }
 
@@ -81,6 +280,23 @@ func DefaultAgentConfig() *AgentConfig {
 	cfg.Server.Address = "http://localhost:8080"
 	cfg.Server.GRPCAddress = "localhost:9090"
 	cfg.Runtime.LogLevel = "info"
+	cfg.Runtime.LogMaxSize = 100
+	cfg.Runtime.LogMaxBackups = 3
+	cfg.Runtime.LogMaxAge = 28
+	cfg.Runtime.LogCompress = true
+	cfg.Runtime.LogFormat = "console"
+	cfg.Runtime.LogSamplePeriod = time.Second
 	cfg.Runtime.MetricsPort = 9100
+	cfg.Runtime.StatePath = "data/state.json"
+	cfg.LogShipping.BufferSize = 1000
+	cfg.Failover.HandshakeTimeout = 5 * time.Minute
+	cfg.Failover.CheckInterval = 30 * time.Second
+	cfg.Endpoints.ResolveInterval = 5 * time.Minute
+	cfg.Resources.CgroupMetrics = "auto"
+	cfg.Hooks.Timeout = 30 * time.Second
+	cfg.LocalAPI.Enabled = true
+	cfg.LocalAPI.Port = 9101
+	cfg.BGP.ReloadCommand = []string{"birdc", "configure"}
+	cfg.Bird.ReloadCommand = []string{"birdc", "configure"}
 	return cfg
 }
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 敏感配置项的引用前缀，不带前缀时按明文处理
+const (
+	secretRefEnv        = "env:"        // 环境变量，如 env:MESH_AGENT_TOKEN
+	secretRefCredential = "credential:" // systemd 凭据（LoadCredential=/LoadCredentialEncrypted=），从 $CREDENTIALS_DIRECTORY 读取
+	secretRefSecret     = "secret:"     // secrets.file 加密文件中的条目
+)
+
+// legacyMachineKey 早期版本默认的机器密钥文件。它对所有本地用户可读，只在没有专用密钥文件时
+// 用于解密以它加密的 secrets 文件，之后写入时改用生成的密钥
+const legacyMachineKey = "/etc/machine-id"
+
+// machineKeySize 生成的机器密钥的字节数
+const machineKeySize = 32
+
+// secretsFileVersion 加密文件格式版本
+const secretsFileVersion = 1
+
+// SecretsFile 加密的 secrets 文件，内容为名称到值的 JSON 对象，以 AES-256-GCM 加密
+type SecretsFile struct {
+	Version    int    `json:"version"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// resolveSecret 按引用前缀解析敏感配置项
+func (c *AgentConfig) resolveSecret(field, value string) (string, error) {
+	var (
+		resolved string
+		err      error
+	)
+	switch {
+	case strings.HasPrefix(value, secretRefEnv):
+		name := strings.TrimPrefix(value, secretRefEnv)
+		if resolved = os.Getenv(name); resolved == "" {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(value, secretRefCredential):
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return "", fmt.Errorf("%s: CREDENTIALS_DIRECTORY is not set, the agent must run under systemd with LoadCredential", field)
+		}
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(dir, strings.TrimPrefix(value, secretRefCredential)))
+		resolved = strings.TrimSpace(string(data))
+	case strings.HasPrefix(value, secretRefSecret):
+		if c.Secrets.File == "" {
+			return "", fmt.Errorf("%s: secrets.file is not configured", field)
+		}
+		var secrets map[string]string
+		if secrets, err = ReadSecretsFile(c.Secrets.File, c.Secrets.MachineKey, c.warn); err == nil {
+			name := strings.TrimPrefix(value, secretRefSecret)
+			var ok bool
+			if resolved, ok = secrets[name]; !ok {
+				err = fmt.Errorf("secret %s not found in %s", name, c.Secrets.File)
+			}
+		}
+	default:
+		return value, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", field, err)
+	}
+	return resolved, nil
+}
+
+// warn 记录加载配置时发现的问题
+func (c *AgentConfig) warn(msg string) {
+	c.Warnings = append(c.Warnings, msg)
+}
+
+// secretsKeyPath 返回机器密钥文件的路径，未配置时为 secrets 文件路径加 .key 后缀
+func secretsKeyPath(file, machineKeyPath string) string {
+	if machineKeyPath != "" {
+		return machineKeyPath
+	}
+	return file + ".key"
+}
+
+// machineKey 由机器密钥文件派生加密密钥，密钥文件只能由所有者访问。
+// 以 /etc/machine-id 作为密钥仍然可用，但通过 warn 给出警告，warn 可以为 nil
+func machineKey(path string, warn func(string)) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading machine key: %w", err)
+	}
+	if path == legacyMachineKey {
+		if warn != nil {
+			warn(fmt.Sprintf("secrets key is derived from %s, which every local user can read; "+
+				"unset secrets.machine_key and run agent secret set to switch to a generated key", path))
+		}
+	} else if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return nil, fmt.Errorf("machine key %s is accessible by other users (mode %04o), run chmod 600 %s", path, perm, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading machine key: %w", err)
+	}
+	data = []byte(strings.TrimSpace(string(data)))
+	if len(data) == 0 {
+		return nil, fmt.Errorf("machine key %s is empty", path)
+	}
+	key := sha256.Sum256(append([]byte("mesh-agent-secrets:"), data...))
+	return key[:], nil
+}
+
+// ensureMachineKey 机器密钥文件不存在时生成随机密钥，以 0600 权限写入
+func ensureMachineKey(path string) error {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	key := make([]byte, machineKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating machine key directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("creating machine key: %w", err)
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return fmt.Errorf("writing machine key: %w", err)
+	}
+	return f.Close()
+}
+
+func secretsCipher(keyPath string, warn func(string)) (cipher.AEAD, error) {
+	key, err := machineKey(keyPath, warn)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadSecretsFile 解密 secrets 文件，文件不存在时返回空集合。machineKeyPath 为空时使用 secrets 文件旁的
+// .key 文件，该文件不存在时按早期版本的默认值以 /etc/machine-id 解密。警告通过 warn 输出，warn 可以为 nil
+func ReadSecretsFile(path, machineKeyPath string, warn func(string)) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading secrets file: %w", err)
+	}
+	var file SecretsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decoding secrets file: %w", err)
+	}
+	if file.Version != secretsFileVersion {
+		return nil, fmt.Errorf("unsupported secrets file version %d", file.Version)
+	}
+	keyPath := secretsKeyPath(path, machineKeyPath)
+	aead, err := secretsCipher(keyPath, warn)
+	if errors.Is(err, os.ErrNotExist) && machineKeyPath == "" {
+		if warn == nil {
+			warn = func(string) {}
+		}
+		warn(fmt.Sprintf("machine key %s not found, falling back to %s; run agent secret set to re-encrypt with a generated key", keyPath, legacyMachineKey))
+		aead, err = secretsCipher(legacyMachineKey, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s (was it created on another machine?): %w", path, err)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("decoding secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// WriteSecretsFile 加密并原子地写入 secrets 文件，机器密钥文件不存在时生成
+func WriteSecretsFile(path, machineKeyPath string, secrets map[string]string) error {
+	keyPath := secretsKeyPath(path, machineKeyPath)
+	if keyPath != legacyMachineKey {
+		if err := ensureMachineKey(keyPath); err != nil {
+			return err
+		}
+	}
+	aead, err := secretsCipher(keyPath, nil)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(&SecretsFile{
+		Version:    secretsFileVersion,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating secrets directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing secrets file: %w", err)
+	}
+	return nil
+}
+
+// LoadAgentSecretsSettings 只读取配置文件中的 secrets 设置，供管理 secrets 文件的子命令使用，
+// 此时配置中引用的条目可能尚未写入，不能完整加载配置
+func LoadAgentSecretsSettings(path string) (file, machineKeyPath string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("reading config file: %w", err)
+	}
+	cfg := &AgentConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return "", "", fmt.Errorf("parsing config file: %w", err)
+	}
+	if cfg.Secrets.File == "" {
+		return "", "", fmt.Errorf("secrets.file is not configured")
+	}
+	return cfg.Secrets.File, cfg.Secrets.MachineKey, nil
+}
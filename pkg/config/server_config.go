@@ -1,40 +1,140 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"mesh-backend/pkg/types"
+)
+
+const (
+	// agentKeepaliveTime agent 发送 keepalive ping 的间隔，见 agent.connect
+	agentKeepaliveTime = 10 * time.Second
+	// minGRPCConnectionAge 允许的最短连接存活时间
+	minGRPCConnectionAge = time.Minute
+	// minGRPCMsgSize 允许的最小消息大小上限
+	minGRPCMsgSize = 64 << 10
 )
 
 // ServerConfig 服务端配置
 type ServerConfig struct {
 	// 服务器配置
 	Server struct {
-		Host string `yaml:"host"`
-		Port int    `yaml:"port"`
-		TLS  struct {
-			Enabled bool   `yaml:"enabled"`
-			Cert    string `yaml:"cert"`
-			Key     string `yaml:"key"`
+		Host        string `yaml:"host"`
+		Port        int    `yaml:"port"`
+		Mode        string `yaml:"mode"`         // single：gRPC 和 HTTP 经 cmux 共用 port；separate：gRPC 使用 grpc_port
+		GRPCPort    int    `yaml:"grpc_port"`    // separate 模式下的 gRPC 端口
+		GRPCMatcher string `yaml:"grpc_matcher"` // single 模式下识别 gRPC 连接的方式：send_settings、header 或 http2
+		// gRPC 连接保活和资源限制
+		GRPC struct {
+			KeepaliveTime         time.Duration `yaml:"keepalive_time"`           // 连接上没有数据该时间后服务端发送 ping
+			KeepaliveTimeout      time.Duration `yaml:"keepalive_timeout"`        // 等待 ping 响应的时间，超时关闭连接
+			MinPingInterval       time.Duration `yaml:"min_ping_interval"`        // 允许 agent 发送 ping 的最小间隔，更频繁的 ping 会导致连接被关闭
+			MaxConnectionIdle     time.Duration `yaml:"max_connection_idle"`      // 没有进行中 RPC 的连接超过该时间后关闭，0 表示不限
+			MaxConnectionAge      time.Duration `yaml:"max_connection_age"`       // 连接的最长存活时间，到期后 agent 重新连接，0 表示不限
+			MaxConnectionAgeGrace time.Duration `yaml:"max_connection_age_grace"` // 连接到期后等待进行中 RPC 结束的时间，0 表示一直等待
+			MaxConcurrentStreams  uint32        `yaml:"max_concurrent_streams"`   // 每个连接的最大并发流数，0 表示不限
+			MaxRecvMsgSize        int           `yaml:"max_recv_msg_size"`        // 接收消息的最大字节数
+			MaxSendMsgSize        int           `yaml:"max_send_msg_size"`        // 发送消息的最大字节数，0 表示不限
+		} `yaml:"grpc"`
+		// 反向代理部署
+		BasePath       string        `yaml:"base_path"`       // HTTP 路由前缀，如 /mesh，为空时挂载在根路径
+		TrustedProxies []string      `yaml:"trusted_proxies"` // 可信反向代理的 IP 或 CIDR，只信任来自这些地址的 X-Forwarded-For
+		RequestTimeout time.Duration `yaml:"request_timeout"` // HTTP 请求的处理超时，超时或客户端断开后中止未完成的数据库查询，默认 2m
+		TLS            struct {
+			Enabled  bool   `yaml:"enabled"`
+			Cert     string `yaml:"cert"`
+			Key      string `yaml:"key"`
+			GRPCOnly bool   `yaml:"grpc_only"` // separate 模式下只对 gRPC 端口启用 TLS，HTTP 由反向代理终止 TLS
 		} `yaml:"tls"`
 		JWT struct {
 			SecretKey string `yaml:"secret_key"`
 		} `yaml:"jwt"`
+		OIDC struct {
+			Enabled       bool              `yaml:"enabled"`
+			Issuer        string            `yaml:"issuer"`         // OIDC 提供方地址
+			ClientID      string            `yaml:"client_id"`      // 客户端ID
+			ClientSecret  string            `yaml:"client_secret"`  // 客户端密钥
+			RedirectURL   string            `yaml:"redirect_url"`   // 回调地址，指向 /api/v1/auth/oidc/callback
+			Scopes        []string          `yaml:"scopes"`         // 请求的 scope
+			UsernameClaim string            `yaml:"username_claim"` // 用作用户名的声明
+			RoleClaim     string            `yaml:"role_claim"`     // 用于角色映射的声明，可以是字符串或字符串数组
+			RoleMapping   map[string]string `yaml:"role_mapping"`   // 声明值到角色的映射
+			DefaultRole   string            `yaml:"default_role"`   // 未匹配到映射时的角色
+		} `yaml:"oidc"`
+		PasswordPolicy struct {
+			MinLength  int    `yaml:"min_length"`  // 最小长度
+			BreachList string `yaml:"breach_list"` // 泄露密码列表文件，每行一条明文或 SHA-1
+		} `yaml:"password_policy"`
+		Compression struct {
+			Enabled bool `yaml:"enabled"`  // 按 Accept-Encoding 压缩 HTTP 响应
+			MinSize int  `yaml:"min_size"` // 响应体达到该字节数才压缩
+			Level   int  `yaml:"level"`    // 压缩级别 1-9，0 使用默认级别
+		} `yaml:"compression"`
+		UI struct {
+			Enabled bool `yaml:"enabled"` // 提供编译进二进制的前端页面
+		} `yaml:"ui"`
+		// 签发 agent 客户端证书的内置 CA，需要同时启用 TLS
+		CA struct {
+			Enabled           bool          `yaml:"enabled"`
+			Cert              string        `yaml:"cert"`                // CA 证书路径，与私钥都不存在时自动生成
+			Key               string        `yaml:"key"`                 // CA 私钥路径
+			Validity          time.Duration `yaml:"validity"`            // 签发的节点证书有效期
+			RequireClientCert bool          `yaml:"require_client_cert"` // 只接受客户端证书认证，令牌只能用于申请证书
+		} `yaml:"ca"`
+
+		// 配置签名：用 Ed25519 私钥签名下发给 agent 的配置，agent 配置公钥后拒绝签名无效的配置
+		ConfigSigning struct {
+			Enabled bool   `yaml:"enabled"`
+			Key     string `yaml:"key"` // 签名私钥路径（PKCS#8 PEM），不存在时自动生成
+		} `yaml:"config_signing"`
 	} `yaml:"server"`
 
 	// 网络配置
 	Network struct {
 		BasePort          int    `yaml:"base_port"`
+		PortMode          string `yaml:"port_mode"`        // 端口分配模式：sequential 或 pair
+		PortRangeSize     int    `yaml:"port_range_size"`  // pair 模式下可用端口数，端口范围为 [base_port, base_port+port_range_size)
+		InterfaceNaming   string `yaml:"interface_naming"` // 对端接口名的生成方式：name 使用节点名，id 使用节点 ID，hash 使用节点名的摘要
+		InterfacePrefix   string `yaml:"interface_prefix"` // agent 的 wireguard.prefix，用于校验完整接口名的长度
 		IPv4Range         string `yaml:"ipv4_range"`
 		IPv4Template      string `yaml:"ipv4_template"`
 		IPv4NodeTemplate  string `yaml:"ipv4_node_template"`
 		IPv6Range         string `yaml:"ipv6_range"`
 		IPv6Template      string `yaml:"ipv6_template"`
 		IPv6NodeTemplate  string `yaml:"ipv6_node_template"`
-		LinkLocalTemplate string `yaml:"link_local_template"`
+		LinkLocalTemplate string `yaml:"link_local_template"` // 每条链路两端的链路本地地址，{node}、{peer} 替换为本端和对端节点 ID 的十六进制，Go 模板中为 {{ .Node }}、{{ .Peer }}
 		LinkLocalNet      string `yaml:"link_local_net"`
 		BabelMulticast    string `yaml:"babel_multicast"`
 		BabelPort         int    `yaml:"babel_port"`
+		MTU               int    `yaml:"mtu"`       // 未设置 MTU 的节点使用的隧道 MTU，0 表示使用 agent 的默认值；租户可单独设置
+		Keepalive         int    `yaml:"keepalive"` // 链路的 PersistentKeepalive（秒），渲染为模板中的 .Keepalive，0 表示不设置；租户可单独设置
+
+		// 策略路由：mesh 路由放入独立路由表，由 agent 安装 ip rule 查询该表
+		Routing struct {
+			Table        int  `yaml:"table"`         // 路由表编号，0 表示使用主路由表（WireGuard Table = off）
+			RulePriority int  `yaml:"rule_priority"` // ip rule 起始优先级
+			SourceRules  bool `yaml:"source_rules"`  // 同时为源地址在 mesh 网段内的流量添加规则
+
+			// WireGuard 为加密后的报文设置的防火墙标记，0 表示不设置；设置路由表后带该标记的报文只查询主路由表
+			FwMark uint32 `yaml:"fwmark"`
+			// 节点通过 mesh 访问默认路由（如出口节点通告的 0.0.0.0/0），需要同时设置 table 和 fwmark
+			DefaultRoute bool `yaml:"default_route"`
+		} `yaml:"routing"`
+
+		// IPv6 前缀委派：从 prefix 中为每个节点分配一个 prefix_len 长度的子网，供节点下游的局域网使用
+		Delegation struct {
+			Prefix    string `yaml:"prefix"`     // 委派地址池，需在 ipv6_range 内，为空时不分配
+			PrefixLen int    `yaml:"prefix_len"` // 每个节点分配的前缀长度
+		} `yaml:"delegation"`
 	} `yaml:"network"`
 
 	// 配置模板
@@ -43,17 +143,136 @@ type ServerConfig struct {
 		Babel     string `yaml:"babel"`
 	} `yaml:"templates"`
 
+	// 配置下发
+	Rollout struct {
+		Workers         int           `yaml:"workers"`          // 并发下发的工作协程数
+		QueueSize       int           `yaml:"queue_size"`       // 待下发队列长度
+		CoalesceWindow  time.Duration `yaml:"coalesce_window"`  // 同一节点更新请求的合并窗口，未设置时为 2s，负数表示不合并
+		RequireApproval bool          `yaml:"require_approval"` // 修改生成待审批的变更集，由其他管理员批准后才下发
+		// 配置下发的维护窗口，窗口外的配置更新推迟到下一个窗口开始时投递；租户可单独设置
+		Maintenance types.MaintenancePolicy `yaml:"maintenance"`
+	} `yaml:"rollout"`
+
+	// 任务
+	Tasks struct {
+		MaxRetries   int           `yaml:"max_retries"`   // agent 回报失败后的最大重试次数，耗尽后进入死信队列
+		RetryBackoff time.Duration `yaml:"retry_backoff"` // 重试间隔，按已失败次数线性增长
+	} `yaml:"tasks"`
+
+	// 生命周期事件的 webhook 通知
+	Webhooks struct {
+		Endpoints    []WebhookEndpoint `yaml:"endpoints"`
+		Timeout      time.Duration     `yaml:"timeout"`       // 单次请求超时
+		MaxRetries   int               `yaml:"max_retries"`   // 请求失败或返回非 2xx 时的最大重试次数
+		RetryBackoff time.Duration     `yaml:"retry_backoff"` // 重试间隔，按已失败次数倍增
+		QueueSize    int               `yaml:"queue_size"`    // 等待发送的事件数，超出时丢弃新事件
+	} `yaml:"webhooks"`
+
+	// 节点月流量配额，配额在节点上设置
+	Quota struct {
+		Thresholds    []int `yaml:"thresholds"`     // 告警阈值（配额的百分比），当月用量首次达到时发送 quota.threshold 事件
+		PenaltyRxCost int   `yaml:"penalty_rxcost"` // 超出配额且开启 deprioritize 的节点 babeld 接口使用的 rxcost
+	} `yaml:"quota"`
+
+	// agent 注册时上报的本地工具（babeld、wg、bird）与节点配置要求的比对
+	Capabilities struct {
+		Enforce bool `yaml:"enforce"` // 拒绝不满足要求的 agent 注册，关闭时只记录警告并返回给 agent
+	} `yaml:"capabilities"`
+
+	// 客户端对等节点：不运行 agent 的手机、笔记本，通过选定的网关节点接入 mesh
+	Clients struct {
+		Port         int      `yaml:"port"`          // 网关节点上客户端接口的监听端口
+		IPv4Template string   `yaml:"ipv4_template"` // 客户端的 IPv4 地址，{client} 替换为客户端 ID
+		IPv6Template string   `yaml:"ipv6_template"` // 客户端的 IPv6 地址，{client} 替换为客户端 ID 的十六进制
+		DNS          []string `yaml:"dns"`           // 写入客户端配置的 DNS 服务器，为空时不设置
+		Keepalive    int      `yaml:"keepalive"`     // 客户端配置中的 PersistentKeepalive（秒），0 表示不设置
+
+		ExpiryInterval time.Duration `yaml:"expiry_interval"` // 检查并移除到期客户端的间隔
+		MaxTTL         time.Duration `yaml:"max_ttl"`         // 创建客户端时允许的最长有效期，0 表示不限
+	} `yaml:"clients"`
+
+	// 诊断
+	Diagnostics struct {
+		Bandwidth struct {
+			Port            int `yaml:"port"`             // 接收端监听端口
+			DefaultDuration int `yaml:"default_duration"` // 默认测试时长（秒）
+			MaxDuration     int `yaml:"max_duration"`     // 允许的最长测试时长（秒）
+		} `yaml:"bandwidth"`
+		Path struct {
+			MaxHops int           `yaml:"max_hops"` // 最大跳数
+			Timeout time.Duration `yaml:"timeout"`  // 等待 agent 回报结果的超时
+		} `yaml:"path"`
+		Capture struct {
+			Dir         string            `yaml:"dir"`          // 抓包文件保存目录
+			MaxDuration int               `yaml:"max_duration"` // 允许的最长抓包时长（秒）
+			MaxBytes    int64             `yaml:"max_bytes"`    // 单次抓包文件大小上限
+			Filters     map[string]string `yaml:"filters"`      // 允许使用的 BPF 过滤器，按名称引用
+		} `yaml:"capture"`
+	} `yaml:"diagnostics"`
+
+	// 数据保留，清理任务按间隔在后台执行，保留时间为 0 表示永久保留
+	Retention struct {
+		Interval       time.Duration `yaml:"interval"`         // 清理间隔
+		TaskSuccess    time.Duration `yaml:"task_success"`     // 成功任务
+		TaskCanceled   time.Duration `yaml:"task_canceled"`    // 已取消任务
+		TaskFailed     time.Duration `yaml:"task_failed"`      // 失败任务，保留更久便于排查
+		TaskDeadLetter time.Duration `yaml:"task_dead_letter"` // 死信任务，默认永久保留等待人工处理
+		NodeStatus     time.Duration `yaml:"node_status"`      // 长期未上报的节点状态
+		TrafficUsage   time.Duration `yaml:"traffic_usage"`    // 按天的流量统计
+
+		// 删除节点时先将其任务、状态、流量统计和测速记录导出到该目录再清除，为空时直接清除
+		NodeArchiveDir string `yaml:"node_archive_dir"`
+	} `yaml:"retention"`
+
+	// 状态上报
+	Status struct {
+		FlushInterval time.Duration `yaml:"flush_interval"` // 批量写入间隔
+		BatchSize     int           `yaml:"batch_size"`     // 达到该数量立即写入
+
+		OfflineAfter     time.Duration `yaml:"offline_after"`     // 超过该时间未上报的节点视为离线
+		HandshakeTimeout time.Duration `yaml:"handshake_timeout"` // WireGuard 最近握手超过该时间视为链路失效
+
+		CheckInterval    time.Duration `yaml:"check_interval"`    // 邻接检查间隔
+		AdjacencyTimeout time.Duration `yaml:"adjacency_timeout"` // 期望的 Babel 邻居缺失超过该时间时产生事件
+
+		UsageFlushInterval time.Duration `yaml:"usage_flush_interval"` // 流量统计写入间隔
+
+		SubscriberBuffer int `yaml:"subscriber_buffer"` // 每个状态订阅者等待发送的更新数，超出时丢弃最旧的更新
+	} `yaml:"status"`
+
 	// 日志配置
 	Log struct {
-		Debug bool   `yaml:"debug"`
-		File  string `yaml:"file"`
+		Debug      bool   `yaml:"debug"`       // 等同于 level: debug，保留用于兼容旧配置
+		Level      string `yaml:"level"`       // 日志级别，设置后优先于 debug
+		File       string `yaml:"file"`        // 日志文件路径，为空时只输出到控制台
+		MaxSize    int    `yaml:"max_size"`    // 单个日志文件的最大大小（MB），超出后轮转
+		MaxBackups int    `yaml:"max_backups"` // 保留的旧日志文件数，为 0 时全部保留
+		MaxAge     int    `yaml:"max_age"`     // 旧日志文件的保留天数，为 0 时不按时间清理
+		Compress   bool   `yaml:"compress"`    // 压缩轮转后的旧日志文件
+
+		Format     string            `yaml:"format"`     // 控制台输出格式：console 或 json
+		Components map[string]string `yaml:"components"` // 按 component/service 覆盖日志级别，如 node_auth: warn
+		Sampling   struct {
+			Burst  int           `yaml:"burst"`  // 每个周期内同一条 debug/info 消息最多输出的条数，0 表示不采样
+			Period time.Duration `yaml:"period"` // 采样周期
+		} `yaml:"sampling"`
 	} `yaml:"log"`
 
+	// agent 上传的日志
+	NodeLogs struct {
+		BufferSize int `yaml:"buffer_size"` // 每个节点保留的最近日志条数
+	} `yaml:"node_logs"`
+
 	// 存储配置
 	Storage struct {
-		Type   string `yaml:"type"`
-		SQLite struct {
-			Path string `yaml:"path"`
+		Type               string        `yaml:"type"`
+		SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"` // 慢查询日志阈值
+		SQLite             struct {
+			Path        string        `yaml:"path"`
+			JournalMode string        `yaml:"journal_mode"`
+			Synchronous string        `yaml:"synchronous"`
+			BusyTimeout time.Duration `yaml:"busy_timeout"`
+			BusyRetries int           `yaml:"busy_retries"`
 		} `yaml:"sqlite"`
 		Postgres struct {
 			Host     string `yaml:"host"`
@@ -63,7 +282,35 @@ type ServerConfig struct {
 			DBName   string `yaml:"dbname"`
 			SSLMode  string `yaml:"sslmode"`
 		} `yaml:"postgres"`
+		Options map[string]string `yaml:"options"` // 第三方存储后端的专有参数
 	} `yaml:"storage"`
+
+	// 临时状态配置（订阅流归属、节点最新状态、待投递任务），多副本部署时使用 redis 共享
+	Ephemeral struct {
+		Type      string        `yaml:"type"`       // memory / redis
+		StreamTTL time.Duration `yaml:"stream_ttl"` // 订阅流归属的过期时间，副本异常退出后节点重连到其他副本即可接管
+		Redis     struct {
+			Addr      string `yaml:"addr"`
+			Password  string `yaml:"password"`
+			DB        int    `yaml:"db"`
+			KeyPrefix string `yaml:"key_prefix"`
+		} `yaml:"redis"`
+	} `yaml:"ephemeral"`
+
+	// 外部 secret：敏感配置项可以写作 env:、file:、vault: 或 command: 引用，启动时读取并定期刷新
+	Secrets struct {
+		RefreshInterval time.Duration `yaml:"refresh_interval"` // 重新读取的间隔，为 0 时不刷新
+		Vault           struct {
+			Address   string        `yaml:"address"`    // 为空时使用 VAULT_ADDR 环境变量
+			Token     string        `yaml:"token"`      // 为空时使用 VAULT_TOKEN 环境变量
+			TokenFile string        `yaml:"token_file"` // 如 Vault Agent 写入的 token 文件，每次读取时重新加载，优先于 token
+			Namespace string        `yaml:"namespace"`
+			Timeout   time.Duration `yaml:"timeout"`
+		} `yaml:"vault"`
+	} `yaml:"secrets"`
+
+	// 外部 secret 引用，配置项名称到原始配置值
+	secretRefs map[string]string
 }
 
 // LoadServerConfig 加载服务端配置
@@ -78,9 +325,24 @@ func LoadServerConfig(path string, workspaceRoot string) (*ServerConfig, error)
 		return nil, fmt.Errorf("resolving paths: %w", err)
 	}
 
+	// 填充默认值
+	cfg.applyDefaults()
+
+	// 读取外部 secret
+	if err := cfg.ResolveSecrets(context.Background()); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
+// WebhookEndpoint 接收事件通知的地址
+type WebhookEndpoint struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"` // HMAC-SHA256 签名密钥，签名放在 X-Mesh-Signature 请求头中
+	Events []string `yaml:"events"` // 订阅的事件，为空表示全部
+}
+
 // Validate 实现Config接口
 func (c *ServerConfig) Validate() error {
 	if c.Server.Host == "" {
@@ -89,21 +351,467 @@ func (c *ServerConfig) Validate() error {
 	if c.Server.Port <= 0 {
 		return fmt.Errorf("invalid server.port: %d", c.Server.Port)
 	}
+	switch c.Server.Mode {
+	case "", "single":
+		if c.Server.TLS.GRPCOnly {
+			return fmt.Errorf("server.tls.grpc_only requires server.mode separate")
+		}
+	case "separate":
+		if c.Server.GRPCPort <= 0 || c.Server.GRPCPort > 65535 {
+			return fmt.Errorf("invalid server.grpc_port: %d", c.Server.GRPCPort)
+		}
+		if c.Server.GRPCPort == c.Server.Port {
+			return fmt.Errorf("server.grpc_port must differ from server.port")
+		}
+	default:
+		return fmt.Errorf("invalid server.mode: %s", c.Server.Mode)
+	}
+	if c.Server.BasePath != "" {
+		if !strings.HasPrefix(c.Server.BasePath, "/") || strings.HasSuffix(c.Server.BasePath, "/") {
+			return fmt.Errorf("invalid server.base_path %q: must start with / and not end with /", c.Server.BasePath)
+		}
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid server.trusted_proxies entry: %s", proxy)
+			}
+		}
+	}
+	switch c.Server.GRPCMatcher {
+	case "", "send_settings", "header", "http2":
+	default:
+		return fmt.Errorf("invalid server.grpc_matcher: %s", c.Server.GRPCMatcher)
+	}
+	// agent 每 10 秒发送一次 keepalive ping，允许的最小间隔更长时服务端会以 too_many_pings 关闭连接
+	if g := c.Server.GRPC; g.MinPingInterval < 0 || g.MinPingInterval > agentKeepaliveTime {
+		return fmt.Errorf("invalid server.grpc.min_ping_interval: %s, must not exceed the agent keepalive interval %s", g.MinPingInterval, agentKeepaliveTime)
+	}
+	if c.Server.GRPC.KeepaliveTime < 0 || c.Server.GRPC.KeepaliveTimeout < 0 {
+		return fmt.Errorf("server.grpc.keepalive_time and keepalive_timeout must not be negative")
+	}
+	// 连接到期后 agent 需要重新建立任务和状态流，过短的存活时间会导致持续重连
+	if age := c.Server.GRPC.MaxConnectionAge; age < 0 || (age > 0 && age < minGRPCConnectionAge) {
+		return fmt.Errorf("invalid server.grpc.max_connection_age: %s, must be 0 (unlimited) or at least %s", age, minGRPCConnectionAge)
+	}
+	// 任务流等长连接在没有进行中 RPC 时不会空闲，过短的空闲时间只影响短暂的连接
+	if c.Server.GRPC.MaxConnectionIdle < 0 || c.Server.GRPC.MaxConnectionAgeGrace < 0 {
+		return fmt.Errorf("server.grpc.max_connection_idle and max_connection_age_grace must not be negative")
+	}
+	// 配置更新等消息随节点数增长，接收上限过小时 agent 的上报会被拒绝
+	if size := c.Server.GRPC.MaxRecvMsgSize; size < 0 || (size > 0 && size < minGRPCMsgSize) {
+		return fmt.Errorf("invalid server.grpc.max_recv_msg_size: %d, must be at least %d", size, minGRPCMsgSize)
+	}
+	if size := c.Server.GRPC.MaxSendMsgSize; size < 0 || (size > 0 && size < minGRPCMsgSize) {
+		return fmt.Errorf("invalid server.grpc.max_send_msg_size: %d, must be 0 (unlimited) or at least %d", size, minGRPCMsgSize)
+	}
+	if c.Server.Compression.Level < 0 || c.Server.Compression.Level > 9 {
+		return fmt.Errorf("invalid server.compression.level: %d", c.Server.Compression.Level)
+	}
+	if c.Server.CA.Enabled {
+		if !c.Server.TLS.Enabled {
+			return fmt.Errorf("server.ca requires server.tls to be enabled")
+		}
+		if c.Server.CA.Cert == "" || c.Server.CA.Key == "" {
+			return fmt.Errorf("server.ca.cert and server.ca.key are required")
+		}
+		if c.Server.CA.Validity < 0 {
+			return fmt.Errorf("invalid server.ca.validity: %s", c.Server.CA.Validity)
+		}
+	} else if c.Server.CA.RequireClientCert {
+		return fmt.Errorf("server.ca.require_client_cert requires server.ca to be enabled")
+	}
+	if c.Server.ConfigSigning.Enabled && c.Server.ConfigSigning.Key == "" {
+		return fmt.Errorf("server.config_signing.key is required")
+	}
+	if c.Server.RequestTimeout < 0 {
+		return fmt.Errorf("invalid server.request_timeout: %s", c.Server.RequestTimeout)
+	}
+	if c.Secrets.RefreshInterval < 0 || c.Secrets.Vault.Timeout < 0 {
+		return fmt.Errorf("secrets.refresh_interval and secrets.vault.timeout cannot be negative")
+	}
 	if c.Network.BasePort <= 0 {
 		return fmt.Errorf("invalid network.base_port: %d", c.Network.BasePort)
 	}
+	switch c.Network.PortMode {
+	case "", "sequential", "pair":
+	default:
+		return fmt.Errorf("invalid network.port_mode: %s", c.Network.PortMode)
+	}
+	switch c.Network.InterfaceNaming {
+	case "", "name", "id", "hash":
+	default:
+		return fmt.Errorf("invalid network.interface_naming: %s", c.Network.InterfaceNaming)
+	}
+	// Linux 接口名最长 15 个字符，前缀至少要为 ".N" 形式的路径后缀和一个字符的接口名留出空间
+	if len(c.Network.InterfacePrefix) > 12 {
+		return fmt.Errorf("network.interface_prefix %q is too long", c.Network.InterfacePrefix)
+	}
+	if c.Network.PortRangeSize < 0 || c.Network.BasePort+c.Network.PortRangeSize > 65536 {
+		return fmt.Errorf("invalid network.port_range_size: %d", c.Network.PortRangeSize)
+	}
+	if c.Network.MTU != 0 && (c.Network.MTU < 1280 || c.Network.MTU > 9000) {
+		return fmt.Errorf("invalid network.mtu: %d", c.Network.MTU)
+	}
+	if c.Network.Keepalive < 0 || c.Network.Keepalive > 65535 {
+		return fmt.Errorf("invalid network.keepalive: %d", c.Network.Keepalive)
+	}
 	if c.Network.IPv4Range == "" {
 		return fmt.Errorf("network.ipv4_range is required")
 	}
 	if c.Network.IPv6Range == "" {
 		return fmt.Errorf("network.ipv6_range is required")
 	}
+	for name, t := range map[string]string{
+		"ipv4_template":      c.Network.IPv4Template,
+		"ipv4_node_template": c.Network.IPv4NodeTemplate,
+		"ipv6_template":      c.Network.IPv6Template,
+		"ipv6_node_template": c.Network.IPv6NodeTemplate,
+	} {
+		if _, err := ExpandAddress(t, AddressVars{Node: 1, Peer: 2}); err != nil {
+			return fmt.Errorf("invalid network.%s: %w", name, err)
+		}
+	}
+	if t := c.Network.LinkLocalTemplate; t != "" {
+		if !IsAddressTemplate(t) && (!strings.Contains(t, "{node}") || !strings.Contains(t, "{peer}")) {
+			return fmt.Errorf("network.link_local_template must contain {node} and {peer}")
+		}
+		addr, err := ExpandAddressHex(t, AddressVars{Node: 1, Peer: 2})
+		if err != nil {
+			return fmt.Errorf("invalid network.link_local_template: %w", err)
+		}
+		ip, _, err := net.ParseCIDR(addr)
+		if err != nil || ip.To4() != nil || !ip.IsLinkLocalUnicast() {
+			return fmt.Errorf("invalid network.link_local_template: %s", t)
+		}
+	}
+	// 253-255 为内核保留的 default、main、local 表
+	if t := c.Network.Routing.Table; t < 0 || t >= 253 && t <= 255 {
+		return fmt.Errorf("invalid network.routing.table: %d", t)
+	}
+	if p := c.Network.Routing.RulePriority; p < 0 || p > 32765 {
+		return fmt.Errorf("invalid network.routing.rule_priority: %d", p)
+	}
+	// 按标记排除隧道报文的规则使用 rule_priority 之前的两个优先级
+	if p := c.Network.Routing.RulePriority; p != 0 && p < 3 && c.Network.Routing.FwMark != 0 {
+		return fmt.Errorf("network.routing.rule_priority must be at least 3 when fwmark is set")
+	}
+	if c.Network.Routing.DefaultRoute && (c.Network.Routing.Table == 0 || c.Network.Routing.FwMark == 0) {
+		return fmt.Errorf("network.routing.default_route requires network.routing.table and network.routing.fwmark")
+	}
+	if p := c.Network.Delegation.Prefix; p != "" {
+		pool, err := netip.ParsePrefix(p)
+		if err != nil || !pool.Addr().Is6() || pool.Masked() != pool {
+			return fmt.Errorf("invalid network.delegation.prefix: %s", p)
+		}
+		// 委派子网需要被 mesh 的 ip rule 和过滤规则覆盖
+		mesh, err := netip.ParsePrefix(c.Network.IPv6Range)
+		if err != nil || mesh.Bits() > pool.Bits() || !mesh.Contains(pool.Addr()) {
+			return fmt.Errorf("network.delegation.prefix %s is not within network.ipv6_range %s", p, c.Network.IPv6Range)
+		}
+		n := c.Network.Delegation.PrefixLen
+		if n == 0 {
+			n = 64
+		}
+		if n <= pool.Bits() || n > 128 {
+			return fmt.Errorf("invalid network.delegation.prefix_len: %d", n)
+		}
+	}
+	for i, endpoint := range c.Webhooks.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhooks.endpoints[%d].url: %s", i, endpoint.URL)
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("webhooks.endpoints[%d].secret is required", i)
+		}
+		for _, event := range endpoint.Events {
+			if !slices.Contains(types.WebhookEvents, event) {
+				return fmt.Errorf("invalid webhooks.endpoints[%d] event: %s", i, event)
+			}
+		}
+	}
+	for _, threshold := range c.Quota.Thresholds {
+		if threshold <= 0 || threshold > 1000 {
+			return fmt.Errorf("invalid quota.thresholds: %d", threshold)
+		}
+	}
+	if c.Quota.PenaltyRxCost < 0 || c.Quota.PenaltyRxCost > 65535 {
+		return fmt.Errorf("invalid quota.penalty_rxcost: %d", c.Quota.PenaltyRxCost)
+	}
+	if c.Clients.Port < 0 || c.Clients.Port > 65535 {
+		return fmt.Errorf("invalid clients.port: %d", c.Clients.Port)
+	}
+	if c.Clients.Keepalive < 0 || c.Clients.Keepalive > 65535 {
+		return fmt.Errorf("invalid clients.keepalive: %d", c.Clients.Keepalive)
+	}
+	if c.Clients.ExpiryInterval < 0 {
+		return fmt.Errorf("invalid clients.expiry_interval: %s", c.Clients.ExpiryInterval)
+	}
+	if c.Clients.MaxTTL < 0 {
+		return fmt.Errorf("invalid clients.max_ttl: %s", c.Clients.MaxTTL)
+	}
+	for _, tmpl := range []string{c.Clients.IPv4Template, c.Clients.IPv6Template} {
+		if tmpl != "" && !strings.Contains(tmpl, "{client}") {
+			return fmt.Errorf("clients address template %q must contain {client}", tmpl)
+		}
+	}
+	if err := c.Rollout.Maintenance.Validate(); err != nil {
+		return fmt.Errorf("invalid rollout.maintenance: %w", err)
+	}
 	if c.Storage.Type == "" {
 		return fmt.Errorf("storage.type is required")
 	}
+	if c.Server.OIDC.Enabled {
+		if c.Server.OIDC.Issuer == "" {
+			return fmt.Errorf("server.oidc.issuer is required")
+		}
+		if c.Server.OIDC.ClientID == "" {
+			return fmt.Errorf("server.oidc.client_id is required")
+		}
+		if c.Server.OIDC.RedirectURL == "" {
+			return fmt.Errorf("server.oidc.redirect_url is required")
+		}
+	}
+	if c.Log.MaxBackups < 0 || c.Log.MaxAge < 0 {
+		return fmt.Errorf("log.max_backups and log.max_age cannot be negative")
+	}
+	switch c.Log.Format {
+	case "", "console", "json":
+	default:
+		return fmt.Errorf("invalid log.format: %s", c.Log.Format)
+	}
+	if c.Diagnostics.Bandwidth.Port > 65535 {
+		return fmt.Errorf("invalid diagnostics.bandwidth.port: %d", c.Diagnostics.Bandwidth.Port)
+	}
+	for name := range c.Diagnostics.Capture.Filters {
+		if name == "" {
+			return fmt.Errorf("diagnostics.capture.filters: filter name cannot be empty")
+		}
+	}
+	switch c.Ephemeral.Type {
+	case "", "memory":
+	case "redis":
+		if c.Ephemeral.Redis.Addr == "" {
+			return fmt.Errorf("ephemeral.redis.addr is required")
+		}
+	default:
+		return fmt.Errorf("invalid ephemeral.type: %s", c.Ephemeral.Type)
+	}
 	return nil
 }
 
+// applyDefaults 为未配置的可选项填充默认值
+func (c *ServerConfig) applyDefaults() {
+	if len(c.Server.OIDC.Scopes) == 0 {
+		c.Server.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.Server.OIDC.UsernameClaim == "" {
+		c.Server.OIDC.UsernameClaim = "preferred_username"
+	}
+	if c.Server.OIDC.DefaultRole == "" {
+		c.Server.OIDC.DefaultRole = "user"
+	}
+	if c.Server.PasswordPolicy.MinLength <= 0 {
+		c.Server.PasswordPolicy.MinLength = 8
+	}
+	if c.Server.Mode == "" {
+		c.Server.Mode = "single"
+	}
+	if c.Server.GRPCMatcher == "" {
+		c.Server.GRPCMatcher = "send_settings"
+	}
+	if c.Server.Compression.MinSize <= 0 {
+		c.Server.Compression.MinSize = 1024
+	}
+	if c.Server.GRPC.KeepaliveTime <= 0 {
+		c.Server.GRPC.KeepaliveTime = 30 * time.Second
+	}
+	if c.Server.GRPC.KeepaliveTimeout <= 0 {
+		c.Server.GRPC.KeepaliveTimeout = 10 * time.Second
+	}
+	if c.Server.GRPC.MinPingInterval <= 0 {
+		c.Server.GRPC.MinPingInterval = 5 * time.Second
+	}
+	if c.Server.GRPC.MaxRecvMsgSize <= 0 {
+		c.Server.GRPC.MaxRecvMsgSize = 4 << 20
+	}
+	if c.Server.CA.Validity <= 0 {
+		c.Server.CA.Validity = 90 * 24 * time.Hour
+	}
+	if c.Network.PortMode == "" {
+		c.Network.PortMode = "sequential"
+	}
+	if c.Network.InterfaceNaming == "" {
+		c.Network.InterfaceNaming = "name"
+	}
+	if c.Network.InterfacePrefix == "" {
+		c.Network.InterfacePrefix = "wg_"
+	}
+	if c.Network.PortRangeSize == 0 {
+		c.Network.PortRangeSize = 65536 - c.Network.BasePort
+	}
+	if c.Network.LinkLocalTemplate == "" {
+		c.Network.LinkLocalTemplate = "fe80::{node}:{peer}/64"
+	}
+	if c.Network.Routing.RulePriority == 0 {
+		c.Network.Routing.RulePriority = 1000
+	}
+	if c.Network.Delegation.PrefixLen == 0 {
+		c.Network.Delegation.PrefixLen = 64
+	}
+	if c.Rollout.Workers <= 0 {
+		c.Rollout.Workers = 4
+	}
+	if c.Rollout.QueueSize <= 0 {
+		c.Rollout.QueueSize = 1024
+	}
+	// 未设置时使用 2s，负数表示不合并
+	if c.Rollout.CoalesceWindow == 0 {
+		c.Rollout.CoalesceWindow = 2 * time.Second
+	} else if c.Rollout.CoalesceWindow < 0 {
+		c.Rollout.CoalesceWindow = 0
+	}
+	if c.Tasks.MaxRetries < 0 {
+		c.Tasks.MaxRetries = 0
+	}
+	if c.Tasks.RetryBackoff <= 0 {
+		c.Tasks.RetryBackoff = 10 * time.Second
+	}
+	if c.Webhooks.Timeout <= 0 {
+		c.Webhooks.Timeout = 10 * time.Second
+	}
+	if c.Webhooks.MaxRetries < 0 {
+		c.Webhooks.MaxRetries = 0
+	}
+	if c.Webhooks.RetryBackoff <= 0 {
+		c.Webhooks.RetryBackoff = 5 * time.Second
+	}
+	if c.Webhooks.QueueSize <= 0 {
+		c.Webhooks.QueueSize = 1000
+	}
+	if len(c.Quota.Thresholds) == 0 {
+		c.Quota.Thresholds = []int{80, 100}
+	}
+	if c.Quota.PenaltyRxCost == 0 {
+		c.Quota.PenaltyRxCost = 4096
+	}
+	if c.Clients.Port == 0 {
+		c.Clients.Port = 51820
+	}
+	if c.Clients.ExpiryInterval == 0 {
+		c.Clients.ExpiryInterval = time.Minute
+	}
+	if c.Clients.IPv4Template == "" {
+		c.Clients.IPv4Template = "10.42.255.{client}"
+	}
+	if c.Clients.IPv6Template == "" {
+		c.Clients.IPv6Template = "2a13:a5c7:21ff:277::{client}"
+	}
+	if c.Log.Level == "" {
+		c.Log.Level = "info"
+		if c.Log.Debug {
+			c.Log.Level = "debug"
+		}
+	}
+	if c.Log.MaxSize <= 0 {
+		c.Log.MaxSize = 100
+	}
+	if c.Log.Format == "" {
+		c.Log.Format = "console"
+	}
+	if c.Log.Sampling.Period <= 0 {
+		c.Log.Sampling.Period = time.Second
+	}
+	if c.NodeLogs.BufferSize <= 0 {
+		c.NodeLogs.BufferSize = 1000
+	}
+	if c.Diagnostics.Bandwidth.Port <= 0 {
+		c.Diagnostics.Bandwidth.Port = 5201
+	}
+	if c.Diagnostics.Bandwidth.DefaultDuration <= 0 {
+		c.Diagnostics.Bandwidth.DefaultDuration = 10
+	}
+	if c.Diagnostics.Bandwidth.MaxDuration <= 0 {
+		c.Diagnostics.Bandwidth.MaxDuration = 60
+	}
+	if c.Diagnostics.Path.MaxHops <= 0 {
+		c.Diagnostics.Path.MaxHops = 16
+	}
+	if c.Diagnostics.Path.Timeout <= 0 {
+		c.Diagnostics.Path.Timeout = 60 * time.Second
+	}
+	if c.Diagnostics.Capture.Dir == "" {
+		c.Diagnostics.Capture.Dir = "data/captures"
+	}
+	if c.Diagnostics.Capture.MaxDuration <= 0 {
+		c.Diagnostics.Capture.MaxDuration = 60
+	}
+	if c.Diagnostics.Capture.MaxBytes <= 0 {
+		c.Diagnostics.Capture.MaxBytes = 10 << 20
+	}
+	if c.Diagnostics.Capture.Filters == nil {
+		c.Diagnostics.Capture.Filters = defaultCaptureFilters()
+	}
+	if c.Retention.Interval <= 0 {
+		c.Retention.Interval = time.Hour
+	}
+	if c.Secrets.Vault.Timeout == 0 {
+		c.Secrets.Vault.Timeout = 10 * time.Second
+	}
+	if c.Server.RequestTimeout == 0 {
+		c.Server.RequestTimeout = 2 * time.Minute
+	}
+	if c.Status.FlushInterval <= 0 {
+		c.Status.FlushInterval = 5 * time.Second
+	}
+	if c.Status.BatchSize <= 0 {
+		c.Status.BatchSize = 200
+	}
+	if c.Status.OfflineAfter <= 0 {
+		c.Status.OfflineAfter = 90 * time.Second
+	}
+	if c.Status.HandshakeTimeout <= 0 {
+		c.Status.HandshakeTimeout = 3 * time.Minute
+	}
+	if c.Status.CheckInterval <= 0 {
+		c.Status.CheckInterval = 30 * time.Second
+	}
+	if c.Status.AdjacencyTimeout <= 0 {
+		c.Status.AdjacencyTimeout = 2 * time.Minute
+	}
+	if c.Status.UsageFlushInterval <= 0 {
+		c.Status.UsageFlushInterval = time.Minute
+	}
+	if c.Status.SubscriberBuffer <= 0 {
+		c.Status.SubscriberBuffer = 256
+	}
+	if c.Storage.SlowQueryThreshold == 0 {
+		c.Storage.SlowQueryThreshold = 200 * time.Millisecond
+	}
+	if c.Storage.SQLite.JournalMode == "" {
+		c.Storage.SQLite.JournalMode = "WAL"
+	}
+	if c.Storage.SQLite.Synchronous == "" {
+		c.Storage.SQLite.Synchronous = "NORMAL"
+	}
+	if c.Storage.SQLite.BusyTimeout <= 0 {
+		c.Storage.SQLite.BusyTimeout = 5 * time.Second
+	}
+	if c.Storage.SQLite.BusyRetries <= 0 {
+		c.Storage.SQLite.BusyRetries = 5
+	}
+	if c.Ephemeral.Type == "" {
+		c.Ephemeral.Type = "memory"
+	}
+	if c.Ephemeral.StreamTTL <= 0 {
+		c.Ephemeral.StreamTTL = time.Minute
+	}
+	if c.Ephemeral.Redis.KeyPrefix == "" {
+		c.Ephemeral.Redis.KeyPrefix = "mesh:"
+	}
+}
+
 // resolveRelativePaths 处理相对路径
 func (c *ServerConfig) resolveRelativePaths(baseDir string) error {
 	// 处理日志文件路径
@@ -111,6 +819,19 @@ func (c *ServerConfig) resolveRelativePaths(baseDir string) error {
 		c.Log.File = filepath.Join(baseDir, c.Log.File)
 	}
 
+	// 处理 CA 证书路径
+	if c.Server.CA.Cert != "" && !filepath.IsAbs(c.Server.CA.Cert) {
+		c.Server.CA.Cert = filepath.Join(baseDir, c.Server.CA.Cert)
+	}
+	if c.Server.CA.Key != "" && !filepath.IsAbs(c.Server.CA.Key) {
+		c.Server.CA.Key = filepath.Join(baseDir, c.Server.CA.Key)
+	}
+
+	// 处理泄露密码列表路径
+	if c.Server.PasswordPolicy.BreachList != "" && !filepath.IsAbs(c.Server.PasswordPolicy.BreachList) {
+		c.Server.PasswordPolicy.BreachList = filepath.Join(baseDir, c.Server.PasswordPolicy.BreachList)
+	}
+
 	// 处理SQLite数据库路径
 	if c.Storage.Type == "sqlite" && !filepath.IsAbs(c.Storage.SQLite.Path) {
 		c.Storage.SQLite.Path = filepath.Join(baseDir, c.Storage.SQLite.Path)
@@ -130,27 +851,127 @@ func DefaultServerConfig() *ServerConfig {
 	// 服务器配置
 	cfg.Server.Host = "0.0.0.0"
 	cfg.Server.Port = 8080
+	cfg.Server.Mode = "single"
+	cfg.Server.GRPCMatcher = "send_settings"
+	cfg.Server.GRPC.KeepaliveTime = 30 * time.Second
+	cfg.Server.GRPC.KeepaliveTimeout = 10 * time.Second
+	cfg.Server.GRPC.MinPingInterval = 5 * time.Second
+	cfg.Server.GRPC.MaxConnectionIdle = 30 * time.Minute
+	cfg.Server.GRPC.MaxConnectionAge = 24 * time.Hour
+	cfg.Server.GRPC.MaxConnectionAgeGrace = time.Minute
+	cfg.Server.GRPC.MaxRecvMsgSize = 4 << 20
+	cfg.Server.OIDC.Scopes = []string{"openid", "profile", "email"}
+	cfg.Server.OIDC.UsernameClaim = "preferred_username"
+	cfg.Server.OIDC.DefaultRole = "user"
+	cfg.Server.PasswordPolicy.MinLength = 8
+	cfg.Server.Compression.Enabled = true
+	cfg.Server.UI.Enabled = true
+	cfg.Server.Compression.MinSize = 1024
+	cfg.Server.CA.Validity = 90 * 24 * time.Hour
 
 	// 网络配置
 	cfg.Network.BasePort = 36420
+	cfg.Network.PortMode = "sequential"
+	cfg.Network.InterfaceNaming = "name"
+	cfg.Network.InterfacePrefix = "wg_"
+	cfg.Network.PortRangeSize = 65536 - 36420
 	cfg.Network.IPv4Range = "10.42.0.0/16"
 	cfg.Network.IPv4Template = "10.42.0.0/16"
 	cfg.Network.IPv4NodeTemplate = "10.42.0.0/16"
 	cfg.Network.IPv6Range = "2a13:a5c7:21ff::/48"
 	cfg.Network.IPv6Template = "2a13:a5c7:21ff::/48"
 	cfg.Network.IPv6NodeTemplate = "2a13:a5c7:21ff::/48"
-	cfg.Network.LinkLocalTemplate = "fe80::/64"
+	cfg.Network.LinkLocalTemplate = "fe80::{node}:{peer}/64"
 	cfg.Network.LinkLocalNet = "fe80::/64"
 	cfg.Network.BabelMulticast = "ff02::1:6/128"
 	cfg.Network.BabelPort = 6696
+	cfg.Network.Keepalive = 25
+	cfg.Network.Routing.RulePriority = 1000
+	cfg.Network.Delegation.PrefixLen = 64
+
+	// 配置下发
+	cfg.Rollout.Workers = 4
+	cfg.Rollout.QueueSize = 1024
+	cfg.Rollout.CoalesceWindow = 2 * time.Second
+
+	// 任务
+	cfg.Tasks.MaxRetries = 3
+	cfg.Tasks.RetryBackoff = 10 * time.Second
+	cfg.Webhooks.Timeout = 10 * time.Second
+	cfg.Webhooks.MaxRetries = 5
+	cfg.Webhooks.RetryBackoff = 5 * time.Second
+	cfg.Webhooks.QueueSize = 1000
+	cfg.Quota.Thresholds = []int{80, 100}
+	cfg.Quota.PenaltyRxCost = 4096
+	cfg.Clients.Port = 51820
+	cfg.Clients.IPv4Template = "10.42.255.{client}"
+	cfg.Clients.IPv6Template = "2a13:a5c7:21ff:277::{client}"
+	cfg.Clients.Keepalive = 25
+	cfg.Clients.ExpiryInterval = time.Minute
+	cfg.NodeLogs.BufferSize = 1000
+	cfg.Diagnostics.Bandwidth.Port = 5201
+	cfg.Diagnostics.Bandwidth.DefaultDuration = 10
+	cfg.Diagnostics.Bandwidth.MaxDuration = 60
+	cfg.Diagnostics.Path.MaxHops = 16
+	cfg.Diagnostics.Path.Timeout = 60 * time.Second
+	cfg.Diagnostics.Capture.Dir = "data/captures"
+	cfg.Diagnostics.Capture.MaxDuration = 60
+	cfg.Diagnostics.Capture.MaxBytes = 10 << 20
+	cfg.Diagnostics.Capture.Filters = defaultCaptureFilters()
+
+	// 数据保留
+	cfg.Retention.Interval = time.Hour
+	cfg.Secrets.Vault.Timeout = 10 * time.Second
+	cfg.Server.RequestTimeout = 2 * time.Minute
+	cfg.Retention.TaskSuccess = 24 * time.Hour
+	cfg.Retention.TaskCanceled = 24 * time.Hour
+	cfg.Retention.TaskFailed = 7 * 24 * time.Hour
+	cfg.Retention.NodeStatus = 30 * 24 * time.Hour
+	cfg.Retention.TrafficUsage = 400 * 24 * time.Hour
+
+	// 状态上报
+	cfg.Status.FlushInterval = 5 * time.Second
+	cfg.Status.BatchSize = 200
+	cfg.Status.OfflineAfter = 90 * time.Second
+	cfg.Status.HandshakeTimeout = 3 * time.Minute
+	cfg.Status.CheckInterval = 30 * time.Second
+	cfg.Status.AdjacencyTimeout = 2 * time.Minute
+	cfg.Status.UsageFlushInterval = time.Minute
+	cfg.Status.SubscriberBuffer = 256
 
 	// 日志配置
 	cfg.Log.Debug = false
+	cfg.Log.Level = "info"
 	cfg.Log.File = "data/mesh-server.log"
+	cfg.Log.MaxSize = 100
+	cfg.Log.MaxBackups = 3
+	cfg.Log.MaxAge = 28
+	cfg.Log.Compress = true
+	cfg.Log.Format = "console"
+	cfg.Log.Sampling.Period = time.Second
 
 	// 存储配置
 	cfg.Storage.Type = "sqlite"
+	cfg.Storage.SlowQueryThreshold = 200 * time.Millisecond
 	cfg.Storage.SQLite.Path = "data/mesh.db"
+	cfg.Storage.SQLite.JournalMode = "WAL"
+	cfg.Storage.SQLite.Synchronous = "NORMAL"
+	cfg.Storage.SQLite.BusyTimeout = 5 * time.Second
+	cfg.Storage.SQLite.BusyRetries = 5
+
+	// 临时状态配置
+	cfg.Ephemeral.Type = "memory"
+	cfg.Ephemeral.StreamTTL = time.Minute
+	cfg.Ephemeral.Redis.KeyPrefix = "mesh:"
 
 	return cfg
 }
+
+// defaultCaptureFilters 默认允许的抓包过滤器
+func defaultCaptureFilters() map[string]string {
+	return map[string]string{
+		"all":   "",
+		"babel": "udp port 6696",
+		"icmp":  "icmp or icmp6",
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// 服务端敏感配置项的引用前缀，不带前缀时按明文处理
+const (
+	serverSecretEnv     = "env:"     // 环境变量，如 env:MESH_JWT_SECRET
+	serverSecretFile    = "file:"    // 文件内容，如 Kubernetes Secret 挂载的文件
+	serverSecretVault   = "vault:"   // HashiCorp Vault，格式为 vault:<路径>#<字段>，如 vault:secret/data/mesh#jwt_secret
+	serverSecretCommand = "command:" // 命令的标准输出，用于云厂商 KMS/SSM 等，如 command:aws ssm get-parameter ...
+)
+
+// secretCommandTimeout command: 引用的执行超时
+const secretCommandTimeout = 30 * time.Second
+
+// 可以引用外部 secret 的配置项
+const (
+	SecretJWT              = "server.jwt.secret_key"
+	SecretOIDCClient       = "server.oidc.client_secret"
+	SecretPostgresPassword = "storage.postgres.password"
+	SecretRedisPassword    = "ephemeral.redis.password"
+)
+
+// secretFields 返回可以引用外部 secret 的配置项
+func (c *ServerConfig) secretFields() map[string]*string {
+	fields := map[string]*string{
+		SecretJWT:              &c.Server.JWT.SecretKey,
+		SecretOIDCClient:       &c.Server.OIDC.ClientSecret,
+		SecretPostgresPassword: &c.Storage.Postgres.Password,
+		SecretRedisPassword:    &c.Ephemeral.Redis.Password,
+	}
+	for i := range c.Webhooks.Endpoints {
+		fields[fmt.Sprintf("webhooks.endpoints[%d].secret", i)] = &c.Webhooks.Endpoints[i].Secret
+	}
+	return fields
+}
+
+// isSecretRef 配置值是否为外部 secret 引用
+func isSecretRef(value string) bool {
+	for _, prefix := range []string{serverSecretEnv, serverSecretFile, serverSecretVault, serverSecretCommand} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecrets 将配置中的外部 secret 引用替换为实际值，引用本身保留下来供 RefreshSecrets 重新读取
+func (c *ServerConfig) ResolveSecrets(ctx context.Context) error {
+	if c.secretRefs == nil {
+		c.secretRefs = make(map[string]string)
+		for name, field := range c.secretFields() {
+			if isSecretRef(*field) {
+				c.secretRefs[name] = *field
+			}
+		}
+	}
+	values, err := c.FetchSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	fields := c.secretFields()
+	for name, value := range values {
+		*fields[name] = value
+	}
+	return nil
+}
+
+// HasSecretRefs 配置中是否有外部 secret 引用
+func (c *ServerConfig) HasSecretRefs() bool {
+	return len(c.secretRefs) > 0
+}
+
+// ResolvedSecrets 返回启动时读取的外部 secret，配置项名称到值
+func (c *ServerConfig) ResolvedSecrets() map[string]string {
+	fields := c.secretFields()
+	values := make(map[string]string, len(c.secretRefs))
+	for name := range c.secretRefs {
+		values[name] = *fields[name]
+	}
+	return values
+}
+
+// FetchSecrets 重新读取所有外部 secret 的当前值，不修改配置本身
+//
+// 配置在运行期间被各服务并发读取，由调用方决定如何应用新值。
+func (c *ServerConfig) FetchSecrets(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string, len(c.secretRefs))
+	vault := newVaultClient(c)
+	for name, ref := range c.secretRefs {
+		value, err := c.fetchSecret(ctx, vault, ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", name, err)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("resolving %s: empty value", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func (c *ServerConfig) fetchSecret(ctx context.Context, vault *vaultClient, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, serverSecretEnv):
+		return os.Getenv(strings.TrimPrefix(ref, serverSecretEnv)), nil
+	case strings.HasPrefix(ref, serverSecretFile):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, serverSecretFile))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(ref, serverSecretVault):
+		path, field, ok := strings.Cut(strings.TrimPrefix(ref, serverSecretVault), "#")
+		if !ok || path == "" || field == "" {
+			return "", fmt.Errorf("vault reference must be vault:<path>#<field>")
+		}
+		return vault.read(ctx, path, field)
+	case strings.HasPrefix(ref, serverSecretCommand):
+		args := strings.Fields(strings.TrimPrefix(ref, serverSecretCommand))
+		if len(args) == 0 {
+			return "", fmt.Errorf("empty command")
+		}
+		ctx, cancel := context.WithTimeout(ctx, secretCommandTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return ref, nil
+}
+
+// vaultClient 通过 HTTP API 读取 Vault 中的 secret
+type vaultClient struct {
+	address   string
+	token     string
+	tokenFile string
+	namespace string
+	http      *http.Client
+}
+
+func newVaultClient(c *ServerConfig) *vaultClient {
+	v := c.Secrets.Vault
+	address := v.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	return &vaultClient{
+		address:   strings.TrimSuffix(address, "/"),
+		token:     token,
+		tokenFile: v.TokenFile,
+		namespace: v.Namespace,
+		http:      &http.Client{Timeout: v.Timeout},
+	}
+}
+
+// read 读取路径下的字段，同时支持 KV v2（data.data）和 KV v1（data）的响应格式
+func (v *vaultClient) read(ctx context.Context, path, field string) (string, error) {
+	if v.address == "" {
+		return "", fmt.Errorf("secrets.vault.address is not configured")
+	}
+	token := v.token
+	// token 文件由 Vault Agent 等定期续期，每次读取时重新加载
+	if v.tokenFile != "" {
+		data, err := os.ReadFile(v.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading vault token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.address+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("querying vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding vault response: %w", err)
+	}
+	data := body.Data
+	if inner, ok := data["data"].(map[string]any); ok {
+		data = inner
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("field %s not found in %s", field, path)
+	}
+	return value, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// TemplateFuncs WireGuard、babeld 配置模板和地址模板中可用的函数
+//
+//	cidrhost "10.42.0.0/16" 5      网段中的第 5 个地址，超出网段时报错
+//	ipAdd "2a13:a5c7:21ff::" 16    地址加上偏移量
+//	lower "Node-A"                 转为小写
+//	hash "node-a"                  SHA-256 摘要的前 8 位十六进制，与 interface_naming: hash 相同
+//	joinPort "2001:db8::1" 36420   拼接主机和端口，IPv6 地址加方括号
+var TemplateFuncs = template.FuncMap{
+	"cidrhost": cidrHost,
+	"ipAdd":    ipAdd,
+	"lower":    strings.ToLower,
+	"hash":     ShortHash,
+	"joinPort": func(host string, port int) string { return net.JoinHostPort(host, strconv.Itoa(port)) },
+}
+
+// ShortHash 返回 s 的 SHA-256 摘要的前 8 位十六进制
+func ShortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// ipAdd 返回地址 addr 加上 n 后的地址，结果溢出地址空间时报错
+func ipAdd(addr string, n int) (string, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("ipAdd: %w", err)
+	}
+	raw := ip.AsSlice()
+	sum := new(big.Int).Add(new(big.Int).SetBytes(raw), big.NewInt(int64(n)))
+	if sum.Sign() < 0 || sum.BitLen() > len(raw)*8 {
+		return "", fmt.Errorf("ipAdd: %s%+d is out of range", addr, n)
+	}
+	result, _ := netip.AddrFromSlice(sum.FillBytes(make([]byte, len(raw))))
+	return result.String(), nil
+}
+
+// cidrHost 返回网段 prefix 中编号为 n 的地址，与 Terraform 的 cidrhost 相同，n 为负数时从网段末尾倒数
+func cidrHost(prefix string, n int) (string, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return "", fmt.Errorf("cidrhost: %w", err)
+	}
+	p = p.Masked()
+	if n < 0 {
+		size := new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits()))
+		n = int(new(big.Int).Add(size, big.NewInt(int64(n))).Int64())
+	}
+	addr, err := ipAdd(p.Addr().String(), n)
+	if err != nil || !p.Contains(netip.MustParseAddr(addr)) {
+		return "", fmt.Errorf("cidrhost: host number %d does not fit in %s", n, prefix)
+	}
+	return addr, nil
+}
+
+// AddressVars 地址模板中可用的数据：{{ .Node }}、{{ .Peer }} 为本端和对端节点的地址编号
+type AddressVars struct {
+	Node int
+	Peer int
+}
+
+// addressTemplates 已解析的地址模板，模板来自配置文件，数量有限
+var addressTemplates sync.Map
+
+// IsAddressTemplate 地址模板是否使用 Go 模板语法，否则为 {node}、{peer} 占位符
+func IsAddressTemplate(tmpl string) bool {
+	return strings.Contains(tmpl, "{{")
+}
+
+// ExpandAddress 按地址模板生成地址
+//
+// 模板可以使用 Go 模板语法和 TemplateFuncs，如 10.42.{{ .Node }}.{{ .Peer }}/32、
+// {{ cidrhost "10.42.0.0/16" .Node }}；也可以使用 {node}、{peer} 占位符，按十进制替换。
+func ExpandAddress(tmpl string, vars AddressVars) (string, error) {
+	if !IsAddressTemplate(tmpl) {
+		return strings.NewReplacer("{node}", strconv.Itoa(vars.Node), "{peer}", strconv.Itoa(vars.Peer)).Replace(tmpl), nil
+	}
+	return executeAddressTemplate(tmpl, vars)
+}
+
+// ExpandAddressHex 与 ExpandAddress 相同，但 {node}、{peer} 占位符按十六进制替换；Go 模板中可用 printf "%x" 生成十六进制
+func ExpandAddressHex(tmpl string, vars AddressVars) (string, error) {
+	if !IsAddressTemplate(tmpl) {
+		return strings.NewReplacer(
+			"{node}", strconv.FormatInt(int64(vars.Node), 16),
+			"{peer}", strconv.FormatInt(int64(vars.Peer), 16),
+		).Replace(tmpl), nil
+	}
+	return executeAddressTemplate(tmpl, vars)
+}
+
+func executeAddressTemplate(tmpl string, vars AddressVars) (string, error) {
+	cached, ok := addressTemplates.Load(tmpl)
+	if !ok {
+		t, err := template.New("address").Funcs(TemplateFuncs).Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return "", fmt.Errorf("parsing address template %q: %w", tmpl, err)
+		}
+		cached, _ = addressTemplates.LoadOrStore(tmpl, t)
+	}
+	var buf strings.Builder
+	if err := cached.(*template.Template).Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("executing address template %q: %w", tmpl, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,287 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/types"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Faults 模拟 agent 的故障注入配置，零值表示不注入故障
+type Faults struct {
+	DropStreamRate   float64       // 收到任务后主动断开订阅流的概率
+	AckDelay         time.Duration // 回报任务结果前的随机延迟上限
+	AckDropRate      float64       // 不回报任务结果的概率
+	BogusMetricsRate float64       // 上报异常指标的概率
+}
+
+// FakeAgent 通过真实 gRPC 连接接入服务端的模拟 agent
+//
+// 收到配置更新任务时从 HTTP 接口拉取配置并记录，然后回报任务结果，不修改本机网络。
+type FakeAgent struct {
+	NodeID int
+	Token  string
+	Faults Faults
+
+	client *Client
+	addr   string
+
+	mu      sync.Mutex
+	conn    *grpc.ClientConn
+	cancel  context.CancelFunc
+	done    chan struct{}
+	tasks   []string
+	configs []*types.NodeConfig
+	errs    []error
+}
+
+// NewFakeAgent 创建模拟 agent，addr 为服务端 gRPC 地址，需调用 Connect 接入服务端
+func NewFakeAgent(client *Client, addr string, nodeID int, token string) *FakeAgent {
+	return &FakeAgent{
+		NodeID: nodeID,
+		Token:  token,
+		client: client,
+		addr:   addr,
+	}
+}
+
+// Connect 建立 gRPC 连接、注册节点并订阅任务
+func (a *FakeAgent) Connect() error {
+	conn, err := grpc.NewClient(a.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("dialing server: %w", err)
+	}
+
+	client := pb.NewTaskServiceClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if _, err := client.Register(ctx, &pb.RegisterRequest{NodeId: int32(a.NodeID), Token: a.Token}); err != nil {
+		cancel()
+		conn.Close()
+		return fmt.Errorf("registering node: %w", err)
+	}
+
+	stream, err := client.SubscribeTasks(ctx, &pb.SubscribeRequest{NodeId: int32(a.NodeID), Token: a.Token})
+	if err != nil {
+		cancel()
+		conn.Close()
+		return fmt.Errorf("subscribing tasks: %w", err)
+	}
+
+	done := make(chan struct{})
+	a.mu.Lock()
+	a.conn = conn
+	a.cancel = cancel
+	a.done = done
+	a.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		for {
+			task, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			a.handleTask(ctx, client, task)
+			if chance(a.Faults.DropStreamRate) {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Connected 订阅流是否仍然存活
+func (a *FakeAgent) Connected() bool {
+	a.mu.Lock()
+	done := a.done
+	a.mu.Unlock()
+	if done == nil {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Disconnect 断开连接，模拟 agent 掉线
+func (a *FakeAgent) Disconnect() {
+	a.mu.Lock()
+	conn, cancel, done := a.conn, a.cancel, a.done
+	a.conn, a.cancel, a.done = nil, nil, nil
+	a.mu.Unlock()
+
+	if conn == nil {
+		return
+	}
+	cancel()
+	<-done
+	conn.Close()
+}
+
+// Reconnect 断开后重新接入
+func (a *FakeAgent) Reconnect() error {
+	a.Disconnect()
+	return a.Connect()
+}
+
+// ReportStatus 上报节点状态
+func (a *FakeAgent) ReportStatus(state string) error {
+	a.mu.Lock()
+	conn := a.conn
+	a.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("agent %d not connected", a.NodeID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metrics := &spb.SystemMetrics{
+		CpuUsage:    rand.Float64() * 100,
+		MemoryUsage: rand.Float64() * 100,
+		DiskUsage:   rand.Float64() * 100,
+		Uptime:      int64(rand.Intn(86400)),
+	}
+	if chance(a.Faults.BogusMetricsRate) {
+		metrics = &spb.SystemMetrics{
+			CpuUsage:    -1,
+			MemoryUsage: 1e9,
+			DiskUsage:   math.NaN(),
+			Uptime:      -1,
+		}
+	}
+
+	_, err := spb.NewStatusServiceClient(conn).ReportStatus(ctx, &spb.StatusReport{
+		NodeId: int32(a.NodeID),
+		Token:  a.Token,
+		Status: &spb.NodeStatus{
+			NodeId:    int32(a.NodeID),
+			Hostname:  fmt.Sprintf("fake-node-%d", a.NodeID),
+			Status:    state,
+			Version:   "fake",
+			Timestamp: time.Now().UnixNano(),
+			Metrics:   metrics,
+		},
+	})
+	return err
+}
+
+// Tasks 返回已收到的任务ID
+func (a *FakeAgent) Tasks() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.tasks...)
+}
+
+// Configs 返回已拉取的配置
+func (a *FakeAgent) Configs() []*types.NodeConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]*types.NodeConfig(nil), a.configs...)
+}
+
+// LastConfig 返回最近一次拉取的配置
+func (a *FakeAgent) LastConfig() *types.NodeConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.configs) == 0 {
+		return nil
+	}
+	return a.configs[len(a.configs)-1]
+}
+
+// Errors 返回处理任务时发生的错误
+func (a *FakeAgent) Errors() []error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]error(nil), a.errs...)
+}
+
+// handleTask 处理任务并回报结果
+func (a *FakeAgent) handleTask(ctx context.Context, client pb.TaskServiceClient, task *pb.Task) {
+	a.mu.Lock()
+	a.tasks = append(a.tasks, task.Id)
+	a.mu.Unlock()
+
+	var err error
+	if types.TaskType(task.Type) == types.TaskTypeUpdate {
+		err = a.FetchConfig()
+	}
+
+	req := &pb.UpdateTaskStatusRequest{
+		TaskId: task.Id,
+		Status: string(types.TaskStatusSuccess),
+		NodeId: int32(a.NodeID),
+		Token:  a.Token,
+	}
+	if err != nil {
+		a.mu.Lock()
+		a.errs = append(a.errs, err)
+		a.mu.Unlock()
+		req.Status = string(types.TaskStatusFailed)
+		req.Error = err.Error()
+	}
+
+	if chance(a.Faults.AckDropRate) {
+		return
+	}
+	if a.Faults.AckDelay > 0 {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(a.Faults.AckDelay)))):
+		case <-ctx.Done():
+			return
+		}
+	}
+	client.UpdateTaskStatus(ctx, req)
+}
+
+// chance 以概率 p 返回 true
+func chance(p float64) bool {
+	return p > 0 && rand.Float64() < p
+}
+
+// FetchConfig 从 HTTP 接口拉取节点配置并记录
+func (a *FakeAgent) FetchConfig() error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/agent/config/%d", a.client.BaseURL, a.NodeID), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(fmt.Sprintf("%d", a.NodeID), a.Token)
+
+	resp, err := a.client.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching config: status %d", resp.StatusCode)
+	}
+
+	var config types.NodeConfig
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return fmt.Errorf("decoding config: %w", err)
+	}
+
+	a.mu.Lock()
+	a.configs = append(a.configs, &config)
+	a.mu.Unlock()
+	return nil
+}
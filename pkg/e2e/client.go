@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Client 服务端 HTTP 管理接口客户端
+type Client struct {
+	BaseURL string // HTTP 地址，如 http://127.0.0.1:12345
+
+	token string // JWT
+	http  *http.Client
+}
+
+// NewClient 创建管理接口客户端
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Login 登录并保存 JWT
+func (c *Client) Login(username, password string) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	creds := map[string]string{"username": username, "password": password}
+	if err := c.Do(http.MethodPost, "/api/v1/auth/login", creds, &resp); err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+	c.token = resp.Token
+	return nil
+}
+
+// CreateNode 通过管理接口创建节点，返回节点ID和令牌
+func (c *Client) CreateNode(name, endpoint string) (int, string, error) {
+	var resp struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+	}
+	req := map[string]string{"name": name, "endpoint": endpoint}
+	if err := c.Do(http.MethodPost, "/api/v1/dashboard/nodes", req, &resp); err != nil {
+		return 0, "", fmt.Errorf("creating node %s: %w", name, err)
+	}
+	return resp.ID, resp.Token, nil
+}
+
+// TriggerConfigUpdate 通过管理接口触发节点配置更新
+func (c *Client) TriggerConfigUpdate(nodeID int) error {
+	return c.Do(http.MethodPost, fmt.Sprintf("/api/v1/dashboard/nodes/config/%d", nodeID), nil, nil)
+}
+
+// Do 调用 HTTP 接口，out 不为空时解析响应
+func (c *Client) Do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,24 @@
+package e2e_test
+
+import (
+	"testing"
+
+	"mesh-backend/pkg/e2e"
+)
+
+// TestScenarios 在进程内启动服务端，以少量模拟 agent 执行注册、配置下发、状态上报和重连场景
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping end-to-end scenarios in short mode")
+	}
+
+	h, err := e2e.Start(e2e.Options{})
+	if err != nil {
+		t.Fatalf("starting harness: %v", err)
+	}
+	defer h.Close()
+
+	if err := e2e.RunScenarios(h, 3); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scenario 控制面回归场景
+type Scenario struct {
+	Name string
+	Run  func(h *Harness, agents []*FakeAgent) error
+}
+
+// Scenarios 内置的回归场景，按顺序执行，后续场景依赖前序场景建立的状态
+var Scenarios = []Scenario{
+	{Name: "config_push", Run: ConfigPush},
+	{Name: "status_report", Run: StatusReport},
+	{Name: "reconnect", Run: Reconnect},
+}
+
+// RunScenarios 启动 n 个模拟 agent 并依次执行所有内置场景
+func RunScenarios(h *Harness, n int) error {
+	agents, err := h.SpawnAgents(n)
+	if err != nil {
+		return err
+	}
+	for _, scenario := range Scenarios {
+		if err := scenario.Run(h, agents); err != nil {
+			return fmt.Errorf("scenario %s: %w", scenario.Name, err)
+		}
+	}
+	return nil
+}
+
+// ConfigPush 触发每个节点的配置更新，校验 agent 收到任务并拉取到包含其余所有节点的配置
+func ConfigPush(h *Harness, agents []*FakeAgent) error {
+	for _, agent := range agents {
+		before := len(agent.Configs())
+		if err := waitTriggered(h, agent); err != nil {
+			return err
+		}
+		if err := Eventually(5*time.Second, func() bool { return len(agent.Configs()) > before }); err != nil {
+			return fmt.Errorf("node %d did not fetch config: %w (errors: %v)", agent.NodeID, err, agent.Errors())
+		}
+
+		config := agent.LastConfig()
+		if config.ID != agent.NodeID {
+			return fmt.Errorf("node %d fetched config of node %d", agent.NodeID, config.ID)
+		}
+		if config.WireGuard == "" || config.Babel == "" {
+			return fmt.Errorf("node %d fetched empty config", agent.NodeID)
+		}
+	}
+	return nil
+}
+
+// StatusReport 每个 agent 上报状态，校验状态落库后可通过节点摘要接口查询
+func StatusReport(h *Harness, agents []*FakeAgent) error {
+	for _, agent := range agents {
+		if err := agent.ReportStatus("online"); err != nil {
+			return fmt.Errorf("node %d reporting status: %w", agent.NodeID, err)
+		}
+	}
+
+	return Eventually(5*time.Second, func() bool {
+		var summaries []struct {
+			ID     int    `json:"id"`
+			Status string `json:"status"`
+		}
+		if err := h.Do("GET", "/api/v1/dashboard/nodes/summary", nil, &summaries); err != nil {
+			return false
+		}
+		online := make(map[int]bool, len(summaries))
+		for _, summary := range summaries {
+			online[summary.ID] = summary.Status == "online"
+		}
+		for _, agent := range agents {
+			if !online[agent.NodeID] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Reconnect 断开并重连所有 agent，校验重连后仍能收到配置更新
+func Reconnect(h *Harness, agents []*FakeAgent) error {
+	for _, agent := range agents {
+		if err := agent.Reconnect(); err != nil {
+			return fmt.Errorf("node %d reconnecting: %w", agent.NodeID, err)
+		}
+	}
+	return ConfigPush(h, agents)
+}
+
+// waitTriggered 触发配置更新，订阅流尚未在服务端就绪时重试
+func waitTriggered(h *Harness, agent *FakeAgent) error {
+	var err error
+	for attempt := 0; attempt < 25; attempt++ {
+		if err = h.TriggerConfigUpdate(agent.NodeID); err == nil {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("triggering config update for node %d: %w", agent.NodeID, err)
+}
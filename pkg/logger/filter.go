@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// active 当前进程中 NewLogger 创建的过滤器，供 SetLevel 调整基础级别
+var (
+	activeMu sync.Mutex
+	active   *filterWriter
+)
+
+// Sampling 高频日志采样配置
+type Sampling struct {
+	Burst  int           // 每个周期内同一条 debug/info 消息最多输出的条数，为 0 时不采样
+	Period time.Duration // 采样周期
+}
+
+// filterWriter 按组件级别和采样规则过滤日志
+//
+// zerolog 只支持全局级别和 logger 级别，组件级别需要在输出前根据 component/service 字段判断。
+// 全局级别设置为所有级别中的最低值，更细的判断在这里完成。
+type filterWriter struct {
+	out zerolog.LevelWriter
+
+	mu         sync.Mutex
+	base       zerolog.Level
+	components map[string]zerolog.Level
+	sampling   Sampling
+	window     time.Time
+	counts     map[string]int
+}
+
+// eventFields 过滤时需要读取的日志字段
+type eventFields struct {
+	Component string `json:"component"`
+	Service   string `json:"service"`
+	Message   string `json:"message"`
+}
+
+func newFilterWriter(out zerolog.LevelWriter, base zerolog.Level, components map[string]zerolog.Level, sampling Sampling) *filterWriter {
+	return &filterWriter{
+		out:        out,
+		base:       base,
+		components: components,
+		sampling:   sampling,
+		counts:     make(map[string]int),
+	}
+}
+
+func (f *filterWriter) Write(p []byte) (int, error) {
+	return f.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (f *filterWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if !f.allow(level, p) {
+		return len(p), nil
+	}
+	return f.out.WriteLevel(level, p)
+}
+
+// allow 判断日志是否应当输出
+func (f *filterWriter) allow(level zerolog.Level, p []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// 无级别的日志（如 Print）和无需过滤的情况直接输出
+	if level == zerolog.NoLevel || (len(f.components) == 0 && f.sampling.Burst <= 0 && level >= f.base) {
+		return true
+	}
+
+	var fields eventFields
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return level >= f.base
+	}
+
+	min := f.base
+	if l, ok := f.components[fields.Component]; ok && fields.Component != "" {
+		min = l
+	} else if l, ok := f.components[fields.Service]; ok && fields.Service != "" {
+		min = l
+	}
+	if level < min {
+		return false
+	}
+
+	// 只对 debug/info 采样，告警和错误总是输出
+	if f.sampling.Burst <= 0 || level > zerolog.InfoLevel {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(f.window) >= f.sampling.Period {
+		f.window = now
+		f.counts = make(map[string]int)
+	}
+	key := level.String() + "\x00" + fields.Message
+	f.counts[key]++
+	return f.counts[key] <= f.sampling.Burst
+}
+
+// globalLevel 返回所有级别中的最低值，作为 zerolog 的全局级别
+func (f *filterWriter) globalLevel() zerolog.Level {
+	min := f.base
+	for _, l := range f.components {
+		if l < min {
+			min = l
+		}
+	}
+	return min
+}
+
+// SetLevel 调整基础日志级别，组件级别覆盖不受影响
+func SetLevel(level zerolog.Level) {
+	activeMu.Lock()
+	f := active
+	activeMu.Unlock()
+
+	if f == nil {
+		zerolog.SetGlobalLevel(level)
+		return
+	}
+	f.mu.Lock()
+	f.base = level
+	global := f.globalLevel()
+	f.mu.Unlock()
+	zerolog.SetGlobalLevel(global)
+}
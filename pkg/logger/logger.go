@@ -10,48 +10,86 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-// NewLogger 创建新的日志记录器
-func NewLogger(logPath string, logLevel string) (*zerolog.Logger, error) {
+// Config 日志配置
+type Config struct {
+	File       string // 日志文件路径，为空时只输出到控制台
+	Level      string // 日志级别，为空时使用 info
+	MaxSize    int    // 单个日志文件的最大大小（MB），为 0 时使用 100
+	MaxBackups int    // 保留的旧日志文件数，为 0 时全部保留
+	MaxAge     int    // 旧日志文件的保留天数，为 0 时不按时间清理
+	Compress   bool   // 使用 gzip 压缩轮转后的旧日志文件
+
+	Format     string            // 控制台输出格式：console（默认，便于阅读）或 json
+	Components map[string]string // 按 component/service 字段覆盖日志级别
+	Sampling   Sampling          // 高频 debug/info 日志采样
+}
+
+// NewLogger 创建新的日志记录器，extra 为额外的 JSON 输出，如 agent 的日志上传
+func NewLogger(cfg Config, extra ...io.Writer) (*zerolog.Logger, error) {
 	// 设置日志级别
-	level, err := zerolog.ParseLevel(logLevel)
-	if err != nil {
-		level = zerolog.InfoLevel
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		parsed, err := zerolog.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, fmt.Errorf("parsing log level: %w", err)
+		}
+		level = parsed
+	}
+	components := make(map[string]zerolog.Level, len(cfg.Components))
+	for name, l := range cfg.Components {
+		parsed, err := zerolog.ParseLevel(l)
+		if err != nil {
+			return nil, fmt.Errorf("parsing log level for %s: %w", name, err)
+		}
+		components[name] = parsed
 	}
-	zerolog.SetGlobalLevel(level)
 
 	// 准备输出写入器
 	var writers []io.Writer
 
 	// 总是添加控制台输出
-	writers = append(writers, zerolog.ConsoleWriter{
-		Out:        os.Stdout,
-		TimeFormat: "2006-01-02 15:04:05",
-	})
+	switch cfg.Format {
+	case "", "console":
+		writers = append(writers, zerolog.ConsoleWriter{
+			Out:        os.Stdout,
+			TimeFormat: "2006-01-02 15:04:05",
+		})
+	case "json":
+		writers = append(writers, os.Stdout)
+	default:
+		return nil, fmt.Errorf("unsupported log format: %s", cfg.Format)
+	}
 
 	// 如果指定了日志文件，添加文件输出
-	if logPath != "" {
+	if cfg.File != "" {
 		// 确保日志目录存在
-		if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0755); err != nil {
 			return nil, fmt.Errorf("creating log directory: %w", err)
 		}
 
 		// 配置日志轮转
 		fileWriter := &lumberjack.Logger{
-			Filename:   logPath,
-			MaxSize:    100, // 每个日志文件最大100MB
-			MaxBackups: 3,   // 保留3个旧文件
-			MaxAge:     28,  // 保留28天
-			Compress:   true,
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+			Compress:   cfg.Compress,
 		}
 
 		writers = append(writers, fileWriter)
 	}
 
-	// 创建多输出写入器
-	mw := zerolog.MultiLevelWriter(writers...)
+	writers = append(writers, extra...)
+
+	// 创建多输出写入器，按组件级别和采样规则过滤
+	filter := newFilterWriter(zerolog.MultiLevelWriter(writers...), level, components, cfg.Sampling)
+	activeMu.Lock()
+	active = filter
+	activeMu.Unlock()
+	zerolog.SetGlobalLevel(filter.globalLevel())
 
 	// 创建并配置logger
-	logger := zerolog.New(mw).With().Timestamp().Logger()
+	logger := zerolog.New(filter).With().Timestamp().Logger()
 
 	return &logger, nil
 }
@@ -0,0 +1,346 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metric 可导出的指标
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+// registeredMetric 已注册的指标
+type registeredMetric struct {
+	name   string
+	help   string
+	kind   string
+	metric metric
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]*registeredMetric
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*registeredMetric)}
+}
+
+// Default 默认指标注册表
+var Default = NewRegistry()
+
+// register 注册指标，同名指标重复注册时返回已有实例
+func (r *Registry) register(name, help, kind string, m metric) metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.metrics[name]; ok {
+		return existing.metric
+	}
+	r.metrics[name] = &registeredMetric{name: name, help: help, kind: kind, metric: m}
+	return m
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出所有指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]*registeredMetric, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, r.metrics[name])
+	}
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range entries {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		m.metric.write(w, m.name)
+	}
+}
+
+// Handler 返回默认注册表的 HTTP 处理器
+func Handler() http.Handler {
+	return Default
+}
+
+// Counter 单调递增计数器
+type Counter struct {
+	v atomic.Uint64
+}
+
+// NewCounter 在默认注册表中创建计数器
+func NewCounter(name, help string) *Counter {
+	return Default.register(name, help, "counter", &Counter{}).(*Counter)
+}
+
+// Inc 计数加一
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add 计数增加 n
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value 返回当前计数
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, c.Value())
+}
+
+// Gauge 可增可减的瞬时值
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// NewGauge 在默认注册表中创建瞬时值指标
+func NewGauge(name, help string) *Gauge {
+	return Default.register(name, help, "gauge", &Gauge{}).(*Gauge)
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add 当前值增加 delta
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// Value 返回当前值
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %g\n", name, g.Value())
+}
+
+// DefaultBuckets 默认的耗时直方图分桶（秒）
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram 分桶直方图
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     Gauge
+}
+
+// newHistogram 创建直方图
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+// NewHistogram 在默认注册表中创建直方图
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.register(name, help, "histogram", newHistogram(buckets)).(*Histogram)
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i].Add(1)
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(v)
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.writeLabeled(w, name, "")
+}
+
+// writeLabeled 输出带标签的直方图
+func (h *Histogram) writeLabeled(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, upper, h.counts[i].Load())
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count.Load())
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, wrapLabels(labels), h.sum.Value())
+	fmt.Fprintf(w, "%s_count%s %d\n", name, wrapLabels(labels), h.count.Load())
+}
+
+// vec 带标签的指标集合
+type vec[T any] struct {
+	labels []string
+	mu     sync.RWMutex
+	values map[string]T
+	keys   map[string][]string
+	create func() T
+}
+
+// with 获取或创建指定标签值对应的指标
+func (v *vec[T]) with(values ...string) T {
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	m, ok := v.values[key]
+	v.mu.RUnlock()
+	if ok {
+		return m
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if m, ok := v.values[key]; ok {
+		return m
+	}
+	m = v.create()
+	v.values[key] = m
+	v.keys[key] = append([]string(nil), values...)
+	return m
+}
+
+// each 按标签字符串排序遍历所有指标
+func (v *vec[T]) each(fn func(labels string, m T)) {
+	v.mu.RLock()
+	entries := make(map[string]T, len(v.values))
+	labels := make([]string, 0, len(v.values))
+	for key, m := range v.values {
+		l := formatLabels(v.labels, v.keys[key])
+		entries[l] = m
+		labels = append(labels, l)
+	}
+	v.mu.RUnlock()
+
+	sort.Strings(labels)
+	for _, l := range labels {
+		fn(l, entries[l])
+	}
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	vec[*Counter]
+}
+
+// NewCounterVec 在默认注册表中创建带标签的计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec[*Counter]{
+		labels: labels,
+		values: make(map[string]*Counter),
+		keys:   make(map[string][]string),
+		create: func() *Counter { return &Counter{} },
+	}}
+	return Default.register(name, help, "counter", v).(*CounterVec)
+}
+
+// WithLabelValues 获取指定标签值对应的计数器
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values...)
+}
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	v.each(func(labels string, c *Counter) {
+		fmt.Fprintf(w, "%s%s %d\n", name, wrapLabels(labels), c.Value())
+	})
+}
+
+// GaugeVec 带标签的瞬时值指标
+type GaugeVec struct {
+	vec[*Gauge]
+}
+
+// NewGaugeVec 在默认注册表中创建带标签的瞬时值指标
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec[*Gauge]{
+		labels: labels,
+		values: make(map[string]*Gauge),
+		keys:   make(map[string][]string),
+		create: func() *Gauge { return &Gauge{} },
+	}}
+	return Default.register(name, help, "gauge", v).(*GaugeVec)
+}
+
+// WithLabelValues 获取指定标签值对应的瞬时值指标
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.with(values...)
+}
+
+func (v *GaugeVec) write(w io.Writer, name string) {
+	v.each(func(labels string, g *Gauge) {
+		fmt.Fprintf(w, "%s%s %g\n", name, wrapLabels(labels), g.Value())
+	})
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	vec[*Histogram]
+}
+
+// NewHistogramVec 在默认注册表中创建带标签的直方图
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{vec[*Histogram]{
+		labels: labels,
+		values: make(map[string]*Histogram),
+		keys:   make(map[string][]string),
+		create: func() *Histogram { return newHistogram(buckets) },
+	}}
+	return Default.register(name, help, "histogram", v).(*HistogramVec)
+}
+
+// WithLabelValues 获取指定标签值对应的直方图
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values...)
+}
+
+func (v *HistogramVec) write(w io.Writer, name string) {
+	v.each(func(labels string, h *Histogram) {
+		h.writeLabeled(w, name, labels)
+	})
+}
+
+// formatLabels 生成 name="value" 形式的标签串
+func formatLabels(names, values []string) string {
+	parts := make([]string, 0, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		parts = append(parts, fmt.Sprintf("%s=%q", name, value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// wrapLabels 为非空标签串加上花括号
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
@@ -0,0 +1,244 @@
+// Package ca 实现签发 agent 客户端证书的内置 CA
+//
+// agent 在本地生成私钥和 CSR，经令牌认证后提交给服务端签名，证书与节点 ID 绑定，
+// 之后的 gRPC 和 HTTP 请求可以使用客户端证书认证，逐步取代长期有效的令牌。
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nodeCNPrefix 节点证书 CommonName 前缀，完整格式为 node-<id>
+const nodeCNPrefix = "node-"
+
+// caValidity 自动生成的 CA 证书有效期
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// clockSkew 签发证书时 NotBefore 向前调整的时间，容忍节点时钟偏差
+const clockSkew = 5 * time.Minute
+
+// CA 证书签发机构
+type CA struct {
+	cert     *x509.Certificate
+	certPEM  []byte
+	key      crypto.Signer
+	validity time.Duration
+}
+
+// Issued 签发结果
+type Issued struct {
+	CertPEM   []byte
+	Serial    string
+	NotAfter  time.Time
+	NotBefore time.Time
+}
+
+// LoadOrCreate 加载 CA 证书和私钥，文件都不存在时生成自签名 CA 并写入
+func LoadOrCreate(certPath, keyPath string, validity time.Duration) (*CA, error) {
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(keyPath)
+	switch {
+	case certErr == nil && keyErr == nil:
+		return load(certPath, keyPath, validity)
+	case errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist):
+		return create(certPath, keyPath, validity)
+	case certErr != nil && !errors.Is(certErr, os.ErrNotExist):
+		return nil, fmt.Errorf("checking CA cert: %w", certErr)
+	case keyErr != nil && !errors.Is(keyErr, os.ErrNotExist):
+		return nil, fmt.Errorf("checking CA key: %w", keyErr)
+	default:
+		return nil, fmt.Errorf("CA cert %s and key %s must both exist or both be absent", certPath, keyPath)
+	}
+}
+
+func load(certPath, keyPath string, validity time.Duration) (*CA, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA cert: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA cert: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certPath)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA key: %w", err)
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", keyPath)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("parsing CA key: %w", err)
+		}
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", parsed)
+	}
+
+	return &CA{cert: cert, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), key: key, validity: validity}, nil
+}
+
+func create(certPath, keyPath string, validity time.Duration) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "mesh-backend node CA"},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("creating CA cert: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("creating CA directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return nil, fmt.Errorf("writing CA key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return nil, fmt.Errorf("writing CA cert: %w", err)
+	}
+
+	return &CA{cert: cert, certPEM: certPEM, key: key, validity: validity}, nil
+}
+
+// CertPEM 返回 PEM 编码的 CA 证书
+func (c *CA) CertPEM() []byte {
+	return c.certPEM
+}
+
+// Pool 返回只包含本 CA 的证书池，用于校验客户端证书
+func (c *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// Sign 校验 CSR 并签发绑定到节点的客户端证书
+//
+// CSR 中的主题和扩展被忽略，证书的 CommonName 固定为 node-<id>，只能用于客户端认证。
+func (c *CA) Sign(csrPEM []byte, nodeID int) (*Issued, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(c.validity)
+	if notAfter.After(c.cert.NotAfter) {
+		notAfter = c.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: NodeCommonName(nodeID)},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, csr.PublicKey, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate: %w", err)
+	}
+
+	return &Issued{
+		CertPEM:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Serial:    SerialString(serial),
+		NotBefore: template.NotBefore,
+		NotAfter:  notAfter,
+	}, nil
+}
+
+// NodeCommonName 返回节点证书的 CommonName
+func NodeCommonName(nodeID int) string {
+	return nodeCNPrefix + strconv.Itoa(nodeID)
+}
+
+// NodeID 从节点证书中解析节点 ID
+func NodeID(cert *x509.Certificate) (int, bool) {
+	id, ok := strings.CutPrefix(cert.Subject.CommonName, nodeCNPrefix)
+	if !ok {
+		return 0, false
+	}
+	nodeID, err := strconv.Atoi(id)
+	if err != nil || nodeID <= 0 {
+		return 0, false
+	}
+	return nodeID, true
+}
+
+// SerialString 返回证书序列号的十六进制表示
+func SerialString(serial *big.Int) string {
+	return serial.Text(16)
+}
+
+// randomSerial 生成 128 位随机序列号
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	return serial, nil
+}
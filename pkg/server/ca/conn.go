@@ -0,0 +1,63 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+
+	"github.com/soheilhy/cmux"
+)
+
+// connStateKey 保存 TLS 连接状态的 context 键
+type connStateKey struct{}
+
+// ConnState 返回连接的 TLS 状态，连接经过 cmux 包装时取出底层的 TLS 连接
+//
+// 服务端在 cmux 之前完成 TLS 握手，gRPC 和 HTTP 服务看到的是包装后的连接，
+// 无法直接读取客户端证书。
+func ConnState(conn net.Conn) *tls.ConnectionState {
+	if mc, ok := conn.(*cmux.MuxConn); ok {
+		conn = mc.Conn
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tc.ConnectionState()
+	if !state.HandshakeComplete {
+		return nil
+	}
+	return &state
+}
+
+// WithConnState 将 TLS 状态保存到 context，用于 http.Server.ConnContext
+func WithConnState(ctx context.Context, conn net.Conn) context.Context {
+	if state := ConnState(conn); state != nil {
+		return context.WithValue(ctx, connStateKey{}, state)
+	}
+	return ctx
+}
+
+// PeerCertificate 返回请求中已通过校验的客户端证书
+//
+// http.Server 直接处理 TLS 连接时从 r.TLS 读取，经 cmux 包装时从 ConnContext 保存的状态读取。
+func PeerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS != nil {
+		return VerifiedLeaf(r.TLS)
+	}
+	state, ok := r.Context().Value(connStateKey{}).(*tls.ConnectionState)
+	if !ok {
+		return nil
+	}
+	return VerifiedLeaf(state)
+}
+
+// VerifiedLeaf 返回 TLS 状态中已通过校验的客户端证书
+func VerifiedLeaf(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
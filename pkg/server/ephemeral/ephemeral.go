@@ -0,0 +1,83 @@
+// Package ephemeral 管理服务端的临时状态：订阅流归属、节点最新状态、待投递任务队列以及副本间通知。
+//
+// 持久数据仍保存在 SQL 存储中。单副本部署使用进程内实现；多副本部署使用 Redis 实现，
+// 各副本共享这些状态，服务端重启也不会丢失待投递的任务。
+package ephemeral
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+	tpb "mesh-backend/api/proto/task"
+
+	"github.com/rs/zerolog"
+)
+
+// 副本间通知的频道
+const (
+	ChannelStatus = "status" // 节点状态更新，负载为序列化的 NodeStatus
+	ChannelTasks  = "tasks"  // 节点有待投递任务，负载为节点ID
+	ChannelMesh   = "mesh"   // 网格状态已变化，各副本清空配置缓存，负载为空
+)
+
+// State 副本间共享的临时状态
+type State interface {
+	// ClaimStream 声明本副本持有节点的任务订阅流，ttl 内未续期则失效
+	ClaimStream(nodeID int32, ttl time.Duration) error
+	// ReleaseStream 释放本副本对节点订阅流的声明
+	ReleaseStream(nodeID int32) error
+	// StreamElsewhere 节点的订阅流是否由其他副本持有
+	StreamElsewhere(nodeID int32) (bool, error)
+
+	// SetStatus 保存节点最新状态
+	SetStatus(status *spb.NodeStatus) error
+	// Status 返回节点最新状态，不存在时返回 nil
+	Status(nodeID int32) (*spb.NodeStatus, error)
+	// Statuses 返回所有节点的最新状态
+	Statuses() (map[int32]*spb.NodeStatus, error)
+
+	// EnqueueTask 将任务加入节点的待投递队列
+	EnqueueTask(nodeID int32, task *tpb.Task) error
+	// DrainTasks 取出并清空节点的待投递队列
+	DrainTasks(nodeID int32) ([]*tpb.Task, error)
+
+	// Publish 向所有副本（包括本副本）发送通知
+	Publish(channel string, payload []byte) error
+	// Subscribe 注册通知处理函数
+	Subscribe(channel string, handler func(payload []byte))
+
+	Close() error
+}
+
+// Config 临时状态配置
+type Config struct {
+	Type          string // memory / redis
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	KeyPrefix     string
+}
+
+// New 根据配置创建临时状态
+func New(cfg Config, logger zerolog.Logger) (State, error) {
+	switch cfg.Type {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(cfg, newReplicaID(), logger)
+	default:
+		return nil, fmt.Errorf("unsupported ephemeral state type: %s", cfg.Type)
+	}
+}
+
+// newReplicaID 生成副本标识，用于区分订阅流由哪个副本持有
+func newReplicaID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", host, hex.EncodeToString(b))
+}
@@ -0,0 +1,110 @@
+package ephemeral
+
+import (
+	"sync"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+	tpb "mesh-backend/api/proto/task"
+)
+
+// Memory 进程内临时状态，只适用于单副本部署
+type Memory struct {
+	mu       sync.RWMutex
+	streams  map[int32]bool
+	statuses map[int32]*spb.NodeStatus
+	tasks    map[int32][]*tpb.Task
+	handlers map[string][]handlerFunc
+}
+
+// handlerFunc 通知处理函数
+type handlerFunc func(payload []byte)
+
+// NewMemory 创建进程内临时状态
+func NewMemory() *Memory {
+	return &Memory{
+		streams:  make(map[int32]bool),
+		statuses: make(map[int32]*spb.NodeStatus),
+		tasks:    make(map[int32][]*tpb.Task),
+		handlers: make(map[string][]handlerFunc),
+	}
+}
+
+func (m *Memory) ClaimStream(nodeID int32, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams[nodeID] = true
+	return nil
+}
+
+func (m *Memory) ReleaseStream(nodeID int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams, nodeID)
+	return nil
+}
+
+// StreamElsewhere 单副本部署中订阅流只可能由本副本持有
+func (m *Memory) StreamElsewhere(nodeID int32) (bool, error) {
+	return false, nil
+}
+
+func (m *Memory) SetStatus(status *spb.NodeStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses[status.NodeId] = status
+	return nil
+}
+
+func (m *Memory) Status(nodeID int32) (*spb.NodeStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.statuses[nodeID], nil
+}
+
+func (m *Memory) Statuses() (map[int32]*spb.NodeStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	statuses := make(map[int32]*spb.NodeStatus, len(m.statuses))
+	for nodeID, status := range m.statuses {
+		statuses[nodeID] = status
+	}
+	return statuses, nil
+}
+
+func (m *Memory) EnqueueTask(nodeID int32, task *tpb.Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks[nodeID] = append(m.tasks[nodeID], task)
+	return nil
+}
+
+func (m *Memory) DrainTasks(nodeID int32) ([]*tpb.Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tasks := m.tasks[nodeID]
+	delete(m.tasks, nodeID)
+	return tasks, nil
+}
+
+// Publish 同步调用本进程内的处理函数
+func (m *Memory) Publish(channel string, payload []byte) error {
+	m.mu.RLock()
+	handlers := append([]handlerFunc(nil), m.handlers[channel]...)
+	m.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(channel string, handler func(payload []byte)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[channel] = append(m.handlers[channel], handler)
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,200 @@
+package ephemeral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+	tpb "mesh-backend/api/proto/task"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+// taskQueueTTL 待投递队列的过期时间，节点长期不上线时队列自动清除，任务记录仍保留在 SQL 存储中
+const taskQueueTTL = 24 * time.Hour
+
+// releaseScript 仅当订阅流仍由本副本持有时删除声明，避免误删其他副本的新声明
+var releaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// drainScript 原子地读取并清空列表
+var drainScript = redis.NewScript(`local v = redis.call("LRANGE", KEYS[1], 0, -1) redis.call("DEL", KEYS[1]) return v`)
+
+// Redis 基于 Redis 的临时状态，供多个服务端副本共享
+type Redis struct {
+	client  *redis.Client
+	prefix  string
+	replica string
+	logger  zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRedis 创建 Redis 临时状态，replica 为本副本标识
+func NewRedis(cfg Config, replica string, logger zerolog.Logger) (*Redis, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.Ping(ctx).Err(); err != nil {
+		cancel()
+		client.Close()
+		return nil, fmt.Errorf("connecting redis: %w", err)
+	}
+
+	return &Redis{
+		client:  client,
+		prefix:  cfg.KeyPrefix,
+		replica: replica,
+		logger:  logger.With().Str("component", "ephemeral").Str("replica", replica).Logger(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+func (r *Redis) key(parts ...string) string {
+	key := r.prefix
+	for i, part := range parts {
+		if i > 0 {
+			key += ":"
+		}
+		key += part
+	}
+	return key
+}
+
+func (r *Redis) streamKey(nodeID int32) string {
+	return r.key("stream", strconv.Itoa(int(nodeID)))
+}
+
+func (r *Redis) ClaimStream(nodeID int32, ttl time.Duration) error {
+	return r.client.Set(r.ctx, r.streamKey(nodeID), r.replica, ttl).Err()
+}
+
+func (r *Redis) ReleaseStream(nodeID int32) error {
+	return releaseScript.Run(r.ctx, r.client, []string{r.streamKey(nodeID)}, r.replica).Err()
+}
+
+func (r *Redis) StreamElsewhere(nodeID int32) (bool, error) {
+	owner, err := r.client.Get(r.ctx, r.streamKey(nodeID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return owner != r.replica, nil
+}
+
+func (r *Redis) SetStatus(status *spb.NodeStatus) error {
+	data, err := proto.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(r.ctx, r.key("status"), strconv.Itoa(int(status.NodeId)), data).Err()
+}
+
+func (r *Redis) Status(nodeID int32) (*spb.NodeStatus, error) {
+	data, err := r.client.HGet(r.ctx, r.key("status"), strconv.Itoa(int(nodeID))).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status := &spb.NodeStatus{}
+	if err := proto.Unmarshal(data, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (r *Redis) Statuses() (map[int32]*spb.NodeStatus, error) {
+	values, err := r.client.HGetAll(r.ctx, r.key("status")).Result()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[int32]*spb.NodeStatus, len(values))
+	for nodeID, data := range values {
+		status := &spb.NodeStatus{}
+		if err := proto.Unmarshal([]byte(data), status); err != nil {
+			r.logger.Warn().Err(err).Str("node_id", nodeID).Msg("Skipping undecodable node status")
+			continue
+		}
+		statuses[status.NodeId] = status
+	}
+	return statuses, nil
+}
+
+func (r *Redis) EnqueueTask(nodeID int32, task *tpb.Task) error {
+	data, err := proto.Marshal(task)
+	if err != nil {
+		return err
+	}
+	key := r.key("tasks", strconv.Itoa(int(nodeID)))
+	_, err = r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(r.ctx, key, data)
+		pipe.PExpire(r.ctx, key, taskQueueTTL)
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) DrainTasks(nodeID int32) ([]*tpb.Task, error) {
+	values, err := drainScript.Run(r.ctx, r.client, []string{r.key("tasks", strconv.Itoa(int(nodeID)))}).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]*tpb.Task, 0, len(values))
+	for _, value := range values {
+		task := &tpb.Task{}
+		if err := proto.Unmarshal([]byte(value), task); err != nil {
+			r.logger.Warn().Err(err).Int32("node_id", nodeID).Msg("Skipping undecodable queued task")
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (r *Redis) Publish(channel string, payload []byte) error {
+	return r.client.Publish(r.ctx, r.key("events", channel), payload).Err()
+}
+
+// Subscribe 在后台订阅频道，连接断开后客户端自动重新订阅，期间的通知会丢失
+func (r *Redis) Subscribe(channel string, handler func(payload []byte)) {
+	pubsub := r.client.Subscribe(r.ctx, r.key("events", channel))
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler([]byte(msg.Payload))
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *Redis) Close() error {
+	r.cancel()
+	r.wg.Wait()
+	return r.client.Close()
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc/stats"
+
+	"mesh-backend/pkg/metrics"
+)
+
+var (
+	grpcPayloadBytes = metrics.NewCounterVec("mesh_grpc_payload_bytes_total",
+		"Uncompressed gRPC message bytes", "method", "direction")
+	grpcWireBytes = metrics.NewCounterVec("mesh_grpc_wire_bytes_total",
+		"gRPC message bytes on the wire after compression", "method", "direction")
+)
+
+// methodKey 保存 RPC 方法名的 context 键
+type methodKey struct{}
+
+// payloadStats 统计 gRPC 消息压缩前后的大小
+type payloadStats struct{}
+
+func (payloadStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, methodKey{}, info.FullMethodName)
+}
+
+func (payloadStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	method, _ := ctx.Value(methodKey{}).(string)
+	switch p := s.(type) {
+	case *stats.InPayload:
+		grpcPayloadBytes.WithLabelValues(method, "in").Add(uint64(p.Length))
+		grpcWireBytes.WithLabelValues(method, "in").Add(uint64(p.CompressedLength))
+	case *stats.OutPayload:
+		grpcPayloadBytes.WithLabelValues(method, "out").Add(uint64(p.Length))
+		grpcWireBytes.WithLabelValues(method, "out").Add(uint64(p.CompressedLength))
+	}
+}
+
+func (payloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (payloadStats) HandleConn(context.Context, stats.ConnStats) {}
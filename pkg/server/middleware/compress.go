@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mesh-backend/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpResponseBytes = metrics.NewCounterVec("mesh_http_response_bytes_total",
+		"Bytes written to HTTP clients after compression", "encoding")
+	httpResponseUncompressedBytes = metrics.NewCounterVec("mesh_http_response_uncompressed_bytes_total",
+		"Bytes produced by HTTP handlers before compression", "encoding")
+)
+
+// compressor 流式压缩器
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// encoders 支持的内容编码，按优先级排列
+var encoders = []struct {
+	name string
+	new  func(w io.Writer, level int) (compressor, error)
+}{
+	{"gzip", func(w io.Writer, level int) (compressor, error) {
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	}},
+}
+
+// Compress 按 Accept-Encoding 协商压缩响应体
+//
+// 响应体达到 minSize 字节后才压缩，较小的响应和已压缩的内容原样返回。
+// Server-Sent Events 等在达到阈值前就 Flush 的流式响应不压缩，避免推送被缓冲。
+func Compress(minSize, level int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding < 0 || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			level:          level,
+			minSize:        minSize,
+		}
+		c.Writer = w
+		defer w.finish()
+		c.Next()
+	}
+}
+
+// negotiateEncoding 返回客户端可接受的编码在 encoders 中的下标，都不接受时返回 -1
+func negotiateEncoding(header string) int {
+	if header == "" {
+		return -1
+	}
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := -1, 0.0
+	for i, enc := range encoders {
+		q, ok := accepted[enc.name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// compressible 判断内容类型是否值得压缩
+func compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	ct = strings.TrimSpace(strings.ToLower(ct))
+	switch {
+	case ct == "text/event-stream":
+		return false
+	case ct == "image/svg+xml":
+		return true
+	case strings.HasPrefix(ct, "image/"), strings.HasPrefix(ct, "video/"), strings.HasPrefix(ct, "audio/"):
+		return false
+	case ct == "application/zip", ct == "application/gzip", ct == "application/x-gzip", ct == "application/zstd":
+		return false
+	}
+	return true
+}
+
+// compressWriter 先缓冲响应体，达到阈值后决定是否压缩
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding int
+	level    int
+	minSize  int
+
+	buf     []byte
+	decided bool
+	zw      compressor
+	raw     int
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	w.raw += len(p)
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize {
+			return len(p), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.zw != nil {
+		return w.zw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.zw != nil {
+		w.zw.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide 根据已缓冲的内容决定是否压缩，并写出缓冲区
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.ResponseWriter.Header()
+	status := w.ResponseWriter.Status()
+	if len(w.buf) >= w.minSize && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		zw, err := encoders[w.encoding].new(w.ResponseWriter, w.level)
+		if err == nil {
+			h.Set("Content-Encoding", encoders[w.encoding].name)
+			h.Del("Content-Length")
+			w.zw = zw
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.zw != nil {
+		_, err := w.zw.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish 写出剩余内容并记录响应大小
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide()
+	}
+	encoding := "identity"
+	if w.zw != nil {
+		w.zw.Close()
+		encoding = encoders[w.encoding].name
+	}
+	if size := w.ResponseWriter.Size(); size > 0 {
+		httpResponseBytes.WithLabelValues(encoding).Add(uint64(size))
+	}
+	httpResponseUncompressedBytes.WithLabelValues(encoding).Add(uint64(w.raw))
+}
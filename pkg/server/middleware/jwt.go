@@ -2,8 +2,12 @@ package middleware
 
 import (
 	"errors"
+	"fmt"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,14 +17,19 @@ import (
 
 // JWTAuthenticator 实现 JWT 认证
 type JWTAuthenticator struct {
-	logger    zerolog.Logger
-	jwtSecret []byte
+	logger zerolog.Logger
+	store  store.Store
+
+	mu         sync.RWMutex
+	jwtSecret  []byte
+	prevSecret []byte // 轮换前的密钥，轮换前签发的 token 在过期前仍然有效
 }
 
 // NewJWTAuthenticator 创建 JWT 认证器
-func NewJWTAuthenticator(logger zerolog.Logger, jwtSecret []byte) *JWTAuthenticator {
+func NewJWTAuthenticator(logger zerolog.Logger, store store.Store, jwtSecret []byte) *JWTAuthenticator {
 	return &JWTAuthenticator{
 		logger:    logger.With().Str("component", "jwt_auth").Logger(),
+		store:     store,
 		jwtSecret: jwtSecret,
 	}
 }
@@ -28,14 +37,40 @@ func NewJWTAuthenticator(logger zerolog.Logger, jwtSecret []byte) *JWTAuthentica
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
+	TenantID int    `json:"tenant_id"`
+	Role     string `json:"role"`
+
+	// 签发时用户的 token 版本，与用户当前版本不一致的 token 已被吊销
+	TokenVersion int `json:"token_version"`
+	// 用户需修改密码，此时 token 只能用于修改密码
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成 JWT token
-func (a *JWTAuthenticator) GenerateToken(userID int, username string) (string, error) {
+// SetSecret 轮换签名密钥，新 token 使用新密钥签发，旧密钥继续用于校验
+func (a *JWTAuthenticator) SetSecret(secret []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prevSecret = a.jwtSecret
+	a.jwtSecret = secret
+}
+
+// secrets 返回当前密钥和轮换前的密钥
+func (a *JWTAuthenticator) secrets() ([]byte, []byte) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.jwtSecret, a.prevSecret
+}
+
+// GenerateToken 为用户生成 JWT token
+func (a *JWTAuthenticator) GenerateToken(user *types.User) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:             user.ID,
+		Username:           user.Username,
+		TenantID:           user.TenantID,
+		Role:               user.Role,
+		TokenVersion:       user.TokenVersion,
+		MustChangePassword: user.MustChangePassword,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -43,13 +78,64 @@ func (a *JWTAuthenticator) GenerateToken(userID int, username string) (string, e
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(a.jwtSecret)
+	secret, _ := a.secrets()
+	return token.SignedString(secret)
+}
+
+// ParseToken 校验 token 的签名和有效期，返回其中的用户信息，轮换前的密钥签发的 token 仍然有效。
+// 用户被删除或 token 版本已过时的 token 视为无效
+func (a *JWTAuthenticator) ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	secret, prev := a.secrets()
+	parse := func(key []byte) (*jwt.Token, error) {
+		return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("invalid signing method")
+			}
+			return key, nil
+		})
+	}
+	token, err := parse(secret)
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) && prev != nil {
+		token, err = parse(prev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	user, err := a.store.GetUser(claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("loading token user: %w", err)
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, errors.New("token revoked")
+	}
+	return claims, nil
 }
 
-// JWTAuth JWT 认证中间件
+// JWTAuth JWT 认证中间件，需修改密码的用户被拒绝
 func (a *JWTAuthenticator) JWTAuth() gin.HandlerFunc {
+	return a.jwtAuth(false)
+}
+
+// PasswordChangeAuth 修改密码使用的认证中间件，需修改密码的用户也可以通过
+func (a *JWTAuthenticator) PasswordChangeAuth() gin.HandlerFunc {
+	return a.jwtAuth(true)
+}
+
+// jwtAuth 认证中间件的实现，allowPasswordChange 为 false 时拒绝需修改密码的用户
+func (a *JWTAuthenticator) jwtAuth(allowPasswordChange bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			// 浏览器 EventSource 无法设置请求头，事件流请求允许通过查询参数传递 token
+			if token := c.Query(accessTokenQuery); token != "" && isEventStream(c) {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
 			c.Abort()
@@ -63,22 +149,15 @@ func (a *JWTAuthenticator) JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("invalid signing method")
-			}
-			return a.jwtSecret, nil
-		})
-
+		claims, err := a.ParseToken(parts[1])
 		if err != nil {
+			a.logger.Debug().Err(err).Msg("Rejected token")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
-
-		if !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		if claims.MustChangePassword && !allowPasswordChange {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required"})
 			c.Abort()
 			return
 		}
@@ -86,6 +165,21 @@ func (a *JWTAuthenticator) JWTAuth() gin.HandlerFunc {
 		// 将用户信息存储到上下文中
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("tenant_id", claims.TenantID)
+		c.Set("role", claims.Role)
 		c.Next()
 	}
 }
+
+// accessTokenQuery 事件流请求传递 token 的查询参数
+const accessTokenQuery = "access_token"
+
+// isEventStream 请求是否为 SSE 事件流
+func isEventStream(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// TenantID 获取请求所属的租户ID
+func TenantID(c *gin.Context) int {
+	return c.GetInt("tenant_id")
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"mesh-backend/pkg/server/ca"
 	"mesh-backend/pkg/store"
 	"net/http"
 
@@ -10,12 +13,17 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 )
 
 // NodeAuthenticator 实现节点认证
 type NodeAuthenticator struct {
 	logger zerolog.Logger
 	store  store.Store
+
+	// 为 true 时只接受客户端证书，令牌只能用于申请证书
+	requireCert bool
 }
 
 // NewNodeAuthenticator 创建节点认证器
@@ -36,9 +44,55 @@ func (a *NodeAuthenticator) GenerateToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(token), nil
 }
 
+// SetRequireClientCert 设置是否只接受客户端证书认证，需在处理请求之前调用
+func (a *NodeAuthenticator) SetRequireClientCert(require bool) {
+	a.requireCert = require
+}
+
+// ValidateCert 验证客户端证书，返回证书绑定的节点 ID
+//
+// 证书链已在 TLS 握手时校验，这里只检查证书是否为节点当前有效的证书，重新签发或吊销后旧证书失效。
+func (a *NodeAuthenticator) ValidateCert(ctx context.Context, cert *x509.Certificate) (int, bool) {
+	nodeID, ok := ca.NodeID(cert)
+	if !ok {
+		return 0, false
+	}
+	node, err := a.store.WithContext(ctx).GetNode(nodeID)
+	if err != nil {
+		a.logger.Debug().Int("node_id", nodeID).Msg("Client certificate for unknown node")
+		return 0, false
+	}
+	if node.CertSerial == "" || node.CertSerial != ca.SerialString(cert.SerialNumber) {
+		a.logger.Debug().
+			Int("node_id", nodeID).
+			Str("serial", ca.SerialString(cert.SerialNumber)).
+			Msg("Client certificate is not the node's current certificate")
+		return 0, false
+	}
+	return nodeID, true
+}
+
+// ValidateCredentials 验证 gRPC 请求的节点身份
+//
+// 连接带有该节点的有效客户端证书时不再检查令牌；未要求证书时回退到令牌认证。
+func (a *NodeAuthenticator) ValidateCredentials(ctx context.Context, nodeID int, token string) bool {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if cert := ca.VerifiedLeaf(&info.State); cert != nil {
+				certNodeID, valid := a.ValidateCert(ctx, cert)
+				return valid && certNodeID == nodeID
+			}
+		}
+	}
+	if a.requireCert {
+		return false
+	}
+	return a.ValidateToken(ctx, nodeID, token)
+}
+
 // ValidateToken 验证节点令牌
-func (a *NodeAuthenticator) ValidateToken(nodeID int, token string) bool {
-	node, err := a.store.GetNode(nodeID)
+func (a *NodeAuthenticator) ValidateToken(ctx context.Context, nodeID int, token string) bool {
+	node, err := a.store.WithContext(ctx).GetNode(nodeID)
 	if err != nil {
 		a.logger.Debug().
 			Int("node_id", nodeID).
@@ -63,9 +117,35 @@ func (a *NodeAuthenticator) ValidateToken(nodeID int, token string) bool {
 	return true
 }
 
-// NodeAuth 节点认证中间件
+// NodeAuth 节点认证中间件，接受客户端证书，未要求证书时也接受 Basic 认证的令牌
 func (a *NodeAuthenticator) NodeAuth() gin.HandlerFunc {
+	return a.nodeAuth(!a.requireCert)
+}
+
+// EnrollAuth 申请证书接口的认证中间件，始终接受令牌，用于节点首次获取证书
+func (a *NodeAuthenticator) EnrollAuth() gin.HandlerFunc {
+	return a.nodeAuth(true)
+}
+
+func (a *NodeAuthenticator) nodeAuth(allowToken bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if cert := ca.PeerCertificate(c.Request); cert != nil {
+			nodeID, ok := a.ValidateCert(c.Request.Context(), cert)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid client certificate"})
+				c.Abort()
+				return
+			}
+			c.Set("node_id", nodeID)
+			c.Next()
+			return
+		}
+		if !allowToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Client certificate is required"})
+			c.Abort()
+			return
+		}
+
 		nodeID, token, ok := c.Request.BasicAuth()
 		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Basic authentication is required"})
@@ -78,11 +158,16 @@ func (a *NodeAuthenticator) NodeAuth() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		if !a.ValidateToken(nodeIDInt, token) {
+		if !a.ValidateToken(c.Request.Context(), nodeIDInt, token) {
+			a.logger.Warn().
+				Int("node_id", nodeIDInt).
+				Str("client_ip", c.ClientIP()).
+				Msg("Rejected invalid node token")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid node token"})
 			c.Abort()
 			return
 		}
+		c.Set("node_id", nodeIDInt)
 		c.Next()
 	}
 }
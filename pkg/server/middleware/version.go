@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersionHeader 客户端指定 API 版本的请求头，响应中返回实际使用的版本
+const APIVersionHeader = "X-API-Version"
+
+// APIVersion 标记请求使用的 API 版本
+func APIVersion(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_version", version)
+		c.Header(APIVersionHeader, version)
+		c.Next()
+	}
+}
+
+// NegotiateAPIVersion 为不带版本号的旧路径协商 API 版本
+//
+// 请求路径形如 prefix/<path> 且未带版本号时：请求头未指定版本或指定为默认版本，
+// 按默认版本处理并在响应中标记该路径已废弃；指定了其他受支持的版本时，
+// 将请求转发到 prefix/<version>/<path>；指定了不支持的版本时返回 400。
+func NegotiateAPIVersion(engine *gin.Engine, prefix, defaultVersion string, supported []string) gin.HandlerFunc {
+	known := make(map[string]bool, len(supported))
+	for _, v := range supported {
+		known[v] = true
+	}
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !strings.HasPrefix(path, prefix+"/") {
+			c.Next()
+			return
+		}
+		rest := strings.TrimPrefix(path, prefix)
+		segment, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		if known[segment] || segment == "versions" {
+			c.Next()
+			return
+		}
+
+		version := c.GetHeader(APIVersionHeader)
+		switch {
+		case version == "" || version == defaultVersion:
+			c.Header("Deprecation", "true")
+			c.Header("Link", "<"+prefix+"/"+defaultVersion+rest+">; rel=\"successor-version\"")
+			c.Next()
+		case known[version]:
+			c.Request.URL.Path = prefix + "/" + version + rest
+			engine.HandleContext(c)
+			c.Abort()
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":     "Unsupported API version",
+				"supported": supported,
+			})
+		}
+	}
+}
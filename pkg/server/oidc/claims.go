@@ -0,0 +1,42 @@
+package oidc
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StringClaim 读取字符串类型的声明
+func StringClaim(claims jwt.MapClaims, name string) string {
+	v, _ := claims[name].(string)
+	return v
+}
+
+// StringsClaim 读取字符串或字符串数组类型的声明
+func StringsClaim(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// MapRole 按声明值依次匹配角色映射，未匹配时返回默认角色
+func MapRole(claims jwt.MapClaims, roleClaim string, mapping map[string]string, defaultRole string) string {
+	if roleClaim == "" {
+		return defaultRole
+	}
+	for _, value := range StringsClaim(claims, roleClaim) {
+		if role, ok := mapping[value]; ok {
+			return role
+		}
+	}
+	return defaultRole
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
@@ -13,23 +14,56 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/soheilhy/cmux"
 	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // 注册 gzip 压缩器，agent 使用压缩时服务端以相同编码响应
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 
 	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/metrics"
+	"mesh-backend/pkg/server/ca"
+	"mesh-backend/pkg/server/ephemeral"
 	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/server/oidc"
 	"mesh-backend/pkg/server/services"
 	"mesh-backend/pkg/server/static"
 	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/utils/password"
 
 	"github.com/gin-gonic/gin"
 )
 
+// apiVersions 支持的 API 版本，按发布顺序排列，新版本追加在末尾
+var apiVersions = []string{"v1"}
+
+// mountAPI 在 basePath 下挂载各版本的 API 路由，返回 basePath 路由组
+//
+// 每个版本挂载在 /api/<version> 下；不带版本号的 /api 路径作为旧版 agent 和前端的兼容别名，
+// 按 X-API-Version 请求头协商版本，未指定时使用 v1。
+// gin 在创建路由组时复制当前的中间件链，版本协商中间件必须在创建路由组之前注册。
+func mountAPI(router *gin.Engine, basePath string, mount func(api *gin.RouterGroup, version string)) *gin.RouterGroup {
+	router.Use(middleware.NegotiateAPIVersion(router, basePath+"/api", apiVersions[0], apiVersions))
+	base := router.Group(basePath)
+
+	for _, version := range apiVersions {
+		mount(base.Group("/api/"+version, middleware.APIVersion(version)), version)
+	}
+	mount(base.Group("/api", middleware.APIVersion(apiVersions[0])), apiVersions[0])
+
+	base.GET("/api/versions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"versions": apiVersions,
+			"latest":   apiVersions[len(apiVersions)-1],
+		})
+	})
+	return base
+}
+
 // Server 服务器结构
 type Server struct {
 	config *config.ServerConfig
 	logger zerolog.Logger
 	store  store.Store
+	state  ephemeral.State
 
 	// 服务实例
 	nodeService   *services.NodeService
@@ -37,43 +71,109 @@ type Server struct {
 	taskService   *services.TaskService
 	statusService *services.StatusService
 	userService   *services.UserService
+	janitor       *services.Janitor
+	secrets       *services.SecretRefresher
+	adjacency     *services.AdjacencyMonitor
+	webhooks      *services.WebhookNotifier
+	usage         *services.UsageService
+	clients       *services.ClientService
 
 	// 服务器实例
-	listener   net.Listener
-	mux        cmux.CMux
-	grpcServer *grpc.Server
-	httpServer *gin.Engine
-	wg         sync.WaitGroup
+	listener     net.Listener // 单端口模式下的共享监听器，分离端口模式下的 HTTP 监听器
+	grpcListener net.Listener // 分离端口模式下的 gRPC 监听器
+	mux          cmux.CMux    // 单端口模式下的多路复用器
+	grpcServer   *grpc.Server
+	httpServer   *gin.Engine
+	wg           sync.WaitGroup
 }
 
 // New 创建服务器实例
 func New(cfg *config.ServerConfig, logger zerolog.Logger) (*Server, error) {
 
 	// 创建存储实例
-	store, err := store.NewStore(&store.Config{
+	baseStore, err := store.NewStore(&store.Config{
 		Type: cfg.Storage.Type,
 		SQLite: store.SQLiteConfig{
-			Path: cfg.Storage.SQLite.Path,
+			Path:        cfg.Storage.SQLite.Path,
+			JournalMode: cfg.Storage.SQLite.JournalMode,
+			Synchronous: cfg.Storage.SQLite.Synchronous,
+			BusyTimeout: cfg.Storage.SQLite.BusyTimeout,
+			BusyRetries: cfg.Storage.SQLite.BusyRetries,
 		},
 		Postgres: cfg.Storage.Postgres,
+		Options:  cfg.Storage.Options,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating store: %w", err)
 	}
+	store := store.NewInstrumentedStore(baseStore, logger, cfg.Storage.SlowQueryThreshold)
+
+	// 创建临时状态
+	state, err := ephemeral.New(ephemeral.Config{
+		Type:          cfg.Ephemeral.Type,
+		RedisAddr:     cfg.Ephemeral.Redis.Addr,
+		RedisPassword: cfg.Ephemeral.Redis.Password,
+		RedisDB:       cfg.Ephemeral.Redis.DB,
+		KeyPrefix:     cfg.Ephemeral.Redis.KeyPrefix,
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("creating ephemeral state: %w", err)
+	}
 
 	// 创建认证中间件
-	jwtAuth := middleware.NewJWTAuthenticator(logger, []byte(cfg.Server.JWT.SecretKey))
+	jwtAuth := middleware.NewJWTAuthenticator(logger, store, []byte(cfg.Server.JWT.SecretKey))
 	nodeAuth := middleware.NewNodeAuthenticator(logger, store)
+	nodeAuth.SetRequireClientCert(cfg.Server.CA.RequireClientCert)
+
+	// 加载签发客户端证书的 CA
+	var authority *ca.CA
+	if cfg.Server.CA.Enabled {
+		authority, err = ca.LoadOrCreate(cfg.Server.CA.Cert, cfg.Server.CA.Key, cfg.Server.CA.Validity)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA: %w", err)
+		}
+	}
 
 	// 创建服务实例
-	taskService := services.NewTaskService(cfg, logger, store, nodeAuth)
+	taskService := services.NewTaskService(cfg, logger, store, nodeAuth, state)
 	nodeService := services.NewNodeService(cfg, logger, store, taskService)
 	configService, err := services.NewConfigService(cfg, nodeService, logger, taskService)
 	if err != nil {
 		return nil, fmt.Errorf("creating config service: %w", err)
 	}
-	statusService := services.NewStatusService(cfg, logger, store, nodeAuth)
-	userService := services.NewUserService(cfg, logger, store, *jwtAuth)
+	statusService := services.NewStatusService(cfg, logger, store, nodeAuth, jwtAuth, state)
+	usageService := services.NewUsageService(cfg, logger, store, nodeService)
+	statusService.SetUsage(usageService)
+	clientService := services.NewClientService(cfg, logger, store, nodeService)
+	var oidcProvider *oidc.Provider
+	if cfg.Server.OIDC.Enabled {
+		oidcProvider, err = oidc.NewProvider(context.Background(), oidc.Config{
+			Issuer:       cfg.Server.OIDC.Issuer,
+			ClientID:     cfg.Server.OIDC.ClientID,
+			ClientSecret: cfg.Server.OIDC.ClientSecret,
+			RedirectURL:  cfg.Server.OIDC.RedirectURL,
+			Scopes:       cfg.Server.OIDC.Scopes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating oidc provider: %w", err)
+		}
+	}
+	passwordPolicy, err := password.NewPolicy(cfg.Server.PasswordPolicy.MinLength, cfg.Server.PasswordPolicy.BreachList)
+	if err != nil {
+		return nil, fmt.Errorf("loading password policy: %w", err)
+	}
+	userService := services.NewUserService(cfg, logger, store, jwtAuth, oidcProvider, passwordPolicy)
+	topologyService := services.NewTopologyService(cfg, logger, store, nodeService)
+	changesetService := services.NewChangesetService(cfg, logger, store, nodeService)
+
+	webhooks := services.NewWebhookNotifier(cfg, logger, store)
+	nodeService.SetWebhooks(webhooks)
+	taskService.OnTaskDone("", webhooks.HandleTaskDone)
+	adjacencyMonitor := services.NewAdjacencyMonitor(cfg, logger, store)
+	nodeService.OnNodeDeleted(adjacencyMonitor.Forget)
+	diagnosticsService := services.NewDiagnosticsService(cfg, logger, store, taskService)
+	logService := services.NewLogService(cfg, logger, store, nodeAuth)
+	nodeService.OnNodeDeleted(logService.Forget)
 
 	// 创建基础TCP监听器
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -82,86 +182,161 @@ func New(cfg *config.ServerConfig, logger zerolog.Logger) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating listener: %w", err)
 	}
+
+	// 分离端口模式下 gRPC 使用单独的监听器
+	var grpcListener net.Listener
+	if cfg.Server.Mode == "separate" {
+		grpcListener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.GRPCPort))
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("creating grpc listener: %w", err)
+		}
+	}
+
 	// 如果启用 tls
 	if cfg.Server.TLS.Enabled {
 		cert, err := tls.LoadX509KeyPair(cfg.Server.TLS.Cert, cfg.Server.TLS.Key)
 		if err != nil {
 			log.Fatalf("failed to load key pair: %s", err)
 		}
-		listener = tls.NewListener(listener, &tls.Config{
+		tlsConfig := &tls.Config{
 			Certificates: []tls.Certificate{cert},
 			NextProtos:   []string{"http/1.1", "h2"},
-		})
+		}
+		// 客户端证书可选，未携带证书的请求回退到令牌认证
+		if authority != nil {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			tlsConfig.ClientCAs = authority.Pool()
+		}
+		if grpcListener != nil {
+			grpcListener = tls.NewListener(grpcListener, tlsConfig)
+		}
+		// grpc_only 时 HTTP 端口不启用 TLS，由前置的反向代理终止 TLS
+		if grpcListener == nil || !cfg.Server.TLS.GRPCOnly {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
 	}
 
-	// 创建多路复用器
-	mux := cmux.New(listener)
+	// 创建多路复用器，分离端口模式下不使用
+	var mux cmux.CMux
+	if grpcListener == nil {
+		mux = cmux.New(listener)
+	}
 
 	// 创建gRPC服务器
 	var opts []grpc.ServerOption
 
 	// 添加服务器选项
+	grpcCfg := cfg.Server.GRPC
 	opts = append(opts,
 		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
-			MinTime:             5 * time.Second,
+			MinTime:             grpcCfg.MinPingInterval,
 			PermitWithoutStream: true,
 		}),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
-			MaxConnectionIdle:     15 * time.Second,
-			MaxConnectionAge:      30 * time.Hour,
-			MaxConnectionAgeGrace: 5 * time.Second,
-			Time:                  5 * time.Second,
-			Timeout:               1 * time.Second,
+			MaxConnectionIdle:     grpcCfg.MaxConnectionIdle,
+			MaxConnectionAge:      grpcCfg.MaxConnectionAge,
+			MaxConnectionAgeGrace: grpcCfg.MaxConnectionAgeGrace,
+			Time:                  grpcCfg.KeepaliveTime,
+			Timeout:               grpcCfg.KeepaliveTimeout,
 		}),
+		grpc.MaxRecvMsgSize(grpcCfg.MaxRecvMsgSize),
+		grpc.StatsHandler(payloadStats{}),
 	)
+	if grpcCfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(grpcCfg.MaxConcurrentStreams))
+	}
+	if grpcCfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(grpcCfg.MaxSendMsgSize))
+	}
+	if cfg.Server.TLS.Enabled {
+		opts = append(opts, grpc.Creds(muxTLSCreds{}))
+	}
 
 	grpcServer := grpc.NewServer(opts...)
 
 	// 注册服务
 	taskService.RegisterGRPC(grpcServer)
 	statusService.RegisterGRPC(grpcServer)
+	logService.RegisterGRPC(grpcServer)
 	reflection.Register(grpcServer)
 
 	// 创建 Gin 引擎
 	gin.SetMode(gin.ReleaseMode)
+	services.RegisterValidators()
 	router := gin.New()
+	// 只信任配置的反向代理转发的客户端地址，未配置时直接使用连接的对端地址
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("setting trusted proxies: %w", err)
+	}
 	router.Use(gin.Recovery())
+	router.Use(middleware.RequestTimeout(cfg.Server.RequestTimeout))
+	if cfg.Server.Compression.Enabled {
+		router.Use(middleware.Compress(cfg.Server.Compression.MinSize, cfg.Server.Compression.Level))
+	}
 
-	api := router.Group("/api")
-	{
-		auth := api.Group("/auth")
-		{
-			userService.RegisterRoutes(auth)
-		}
+	registrars := []services.RouteRegistrar{
+		userService,
+		nodeService,
+		topologyService,
+		changesetService,
+		configService,
+		statusService,
+		usageService,
+		clientService,
+		taskService,
+		adjacencyMonitor,
+		diagnosticsService,
+		logService,
+	}
+	if authority != nil {
+		registrars = append(registrars, services.NewCertService(cfg, logger, store, authority, nodeAuth))
+	}
 
-		// 创建需要JWT认证的路由组
-		dashboard := api.Group("/dashboard")
-		dashboard.Use(jwtAuth.JWTAuth())
-		{
-			nodeService.RegisterRoutes(dashboard)
-			// statusService.RegisterRoutes(dashboard)
+	mount := func(api *gin.RouterGroup, version string) {
+		groups := &services.RouteGroups{
+			Version:   version,
+			Auth:      api.Group("/auth"),
+			Dashboard: api.Group("/dashboard", jwtAuth.JWTAuth(), changesetService.TrackChanges()),
+			Agent:     api.Group("/agent", nodeAuth.NodeAuth()),
 		}
-
-		agent := api.Group("/agent")
-		agent.Use(nodeAuth.NodeAuth())
-		{
-			configService.RegisterRoutes(agent)
+		for _, registrar := range registrars {
+			registrar.RegisterRoutes(groups)
 		}
 	}
 
-	// static.Register(router)
-	static.Register(router)
+	// 所有路由挂载在 base_path 下，便于部署在反向代理的子路径中
+	basePath := cfg.Server.BasePath
+	base := mountAPI(router, basePath, mount)
+
+	// 指标
+	base.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// 前端页面
+	if cfg.Server.UI.Enabled {
+		if err := static.Register(router, basePath); err != nil {
+			logger.Warn().Err(err).Msg("Web UI disabled")
+		}
+	}
 
 	return &Server{
 		config:        cfg,
 		logger:        logger.With().Str("component", "server").Logger(),
 		store:         store,
+		state:         state,
 		nodeService:   nodeService,
 		configService: configService,
 		taskService:   taskService,
 		statusService: statusService,
 		userService:   userService,
+		janitor:       services.NewJanitor(cfg, logger, store),
+		secrets:       services.NewSecretRefresher(cfg, logger, jwtAuth),
+		adjacency:     adjacencyMonitor,
+		webhooks:      webhooks,
+		usage:         usageService,
+		clients:       clientService,
 		listener:      listener,
+		grpcListener:  grpcListener,
 		mux:           mux,
 		grpcServer:    grpcServer,
 		httpServer:    router,
@@ -170,13 +345,22 @@ func New(cfg *config.ServerConfig, logger zerolog.Logger) (*Server, error) {
 
 // Start 启动服务器
 func (s *Server) Start() error {
-	// 设置 gRPC 匹配器
-	grpcL := s.mux.MatchWithWriters(
-		cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"),
-	)
-
-	// 设置 HTTP 匹配器
-	httpL := s.mux.Match(cmux.HTTP1Fast())
+	// 启动后台服务
+	s.nodeService.Start()
+	s.taskService.Start()
+	s.statusService.Start()
+	s.janitor.Start()
+	s.secrets.Start()
+	s.adjacency.Start()
+	s.webhooks.Start()
+	s.usage.Start()
+	s.clients.Start()
+
+	grpcL, httpL := s.grpcListener, s.listener
+	if s.mux != nil {
+		grpcL = s.mux.MatchWithWriters(grpcMatcher(s.config.Server.GRPCMatcher))
+		httpL = s.mux.Match(cmux.HTTP1Fast())
+	}
 
 	// 启动 gRPC 服务器
 	s.wg.Add(1)
@@ -189,7 +373,8 @@ func (s *Server) Start() error {
 
 	// 修改 HTTP 服务器启动方式
 	httpServer := &http.Server{
-		Handler: s.httpServer,
+		Handler:     s.httpServer,
+		ConnContext: ca.WithConnState,
 	}
 
 	s.wg.Add(1)
@@ -201,22 +386,61 @@ func (s *Server) Start() error {
 	}()
 
 	// 启动 cmux
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		if err := s.mux.Serve(); err != nil {
-			s.logger.Error().Err(err).Msg("cmux server error")
-		}
-	}()
+	if s.mux != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.mux.Serve(); err != nil {
+				s.logger.Error().Err(err).Msg("cmux server error")
+			}
+		}()
+	}
 
-	s.logger.Info().
-		Str("address", fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)).
-		Bool("tls", s.config.Server.TLS.Enabled).
-		Msg("Server started")
+	event := s.logger.Info().
+		Str("address", s.listener.Addr().String()).
+		Str("mode", s.config.Server.Mode).
+		Bool("tls", s.config.Server.TLS.Enabled)
+	if s.grpcListener != nil {
+		event = event.Str("grpc_address", s.grpcListener.Addr().String())
+	}
+	event.Msg("Server started")
 
 	return nil
 }
 
+// Addr 返回服务器实际监听的地址，配置端口为 0 时可用于获取随机分配的端口
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// GRPCAddr 返回 gRPC 实际监听的地址，单端口模式下与 Addr 相同
+func (s *Server) GRPCAddr() net.Addr {
+	if s.grpcListener != nil {
+		return s.grpcListener.Addr()
+	}
+	return s.listener.Addr()
+}
+
+// grpcMatcher 返回 cmux 识别 gRPC 连接的匹配器
+//
+// send_settings 先向客户端发送 SETTINGS 帧再读取请求头，兼容等待服务端 SETTINGS 的客户端；
+// header 只读取请求头不发送 SETTINGS，适用于不接受提前发送 SETTINGS 的代理；
+// http2 将所有 HTTP/2 连接视为 gRPC，适用于会改写 content-type 的代理，此时 HTTP 只能使用 HTTP/1.1。
+func grpcMatcher(name string) cmux.MatchWriter {
+	switch name {
+	case "header":
+		return func(_ io.Writer, r io.Reader) bool {
+			return cmux.HTTP2HeaderField("content-type", "application/grpc")(r)
+		}
+	case "http2":
+		return func(_ io.Writer, r io.Reader) bool {
+			return cmux.HTTP2()(r)
+		}
+	default:
+		return cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc")
+	}
+}
+
 // Stop 停止服务器
 func (s *Server) Stop() error {
 	// 优雅关闭 HTTP 服务器
@@ -234,10 +458,30 @@ func (s *Server) Stop() error {
 	if err := s.listener.Close(); err != nil {
 		s.logger.Error().Err(err).Msg("Error closing listener")
 	}
+	if s.grpcListener != nil {
+		if err := s.grpcListener.Close(); err != nil {
+			s.logger.Error().Err(err).Msg("Error closing grpc listener")
+		}
+	}
 
 	// 等待所有服务停止
 	s.wg.Wait()
 
+	// 停止后台服务
+	s.nodeService.Stop()
+	s.statusService.Stop()
+	s.usage.Stop()
+	s.clients.Stop()
+	s.janitor.Stop()
+	s.secrets.Stop()
+	s.adjacency.Stop()
+	s.webhooks.Stop()
+
+	// 关闭临时状态
+	if err := s.state.Close(); err != nil {
+		s.logger.Error().Err(err).Msg("Error closing ephemeral state")
+	}
+
 	// 关闭存储
 	if err := s.store.Close(); err != nil {
 		s.logger.Error().Err(err).Msg("Error closing store")
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mesh-backend/pkg/server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMountAPINegotiatesVersionUnderBasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	mountAPI(router, "/mesh", func(api *gin.RouterGroup, version string) {
+		api.GET("/ping", func(c *gin.Context) {
+			c.String(http.StatusOK, c.GetString("api_version"))
+		})
+	})
+
+	get := func(path, version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if version != "" {
+			req.Header.Set(middleware.APIVersionHeader, version)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 不带版本号的旧路径按默认版本处理，并标记为已废弃
+	w := get("/mesh/api/ping", "")
+	if w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Fatalf("unversioned path: status %d, body %q", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q, want true", got)
+	}
+	if got, want := w.Header().Get("Link"), `</mesh/api/v1/ping>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	if w := get("/mesh/api/ping", "v9"); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported X-API-Version: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// 带版本号的路径不标记废弃
+	w = get("/mesh/api/v1/ping", "")
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Errorf("versioned path: status %d, Deprecation %q", w.Code, w.Header().Get("Deprecation"))
+	}
+	if got := w.Header().Get(middleware.APIVersionHeader); got != "v1" {
+		t.Errorf("%s = %q, want v1", middleware.APIVersionHeader, got)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 节点在访问控制中的地址范围：节点的各链路地址由 ipv4_template/ipv6_template 生成，
+// 都在 ipv4_node_template/ipv6_node_template 所在的 /24 和 /80 内
+const (
+	aclNodeIPv4PrefixLen = 24
+	aclNodeIPv6PrefixLen = 80
+)
+
+// aclMember 访问控制中的一个成员：节点或客户端
+type aclMember struct {
+	tags     []string
+	prefixes []string
+}
+
+// HandleGetACLPolicy 返回租户的访问控制策略，未设置时返回 404
+func (s *ConfigService) HandleGetACLPolicy(c *gin.Context) {
+	tenant, err := s.nodeService.store.GetTenant(middleware.TenantID(c))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tenant == nil || tenant.ACLPolicy == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ACL policy not set"})
+		return
+	}
+	c.JSON(http.StatusOK, tenant.ACLPolicy)
+}
+
+// HandleUpdateACLPolicy 替换租户的访问控制策略并下发到租户内所有节点
+func (s *ConfigService) HandleUpdateACLPolicy(c *gin.Context) {
+	var req types.ACLPolicy
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []types.ACLRule{}
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.saveACLPolicy(c, &req)
+}
+
+// HandleDeleteACLPolicy 删除租户的访问控制策略，agent 随后删除已安装的规则
+func (s *ConfigService) HandleDeleteACLPolicy(c *gin.Context) {
+	s.saveACLPolicy(c, nil)
+}
+
+func (s *ConfigService) saveACLPolicy(c *gin.Context, policy *types.ACLPolicy) {
+	tenantID := middleware.TenantID(c)
+	if err := s.nodeService.store.UpdateTenantACLPolicy(tenantID, policy); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// aclPolicy 返回租户的访问控制策略，未设置时返回 nil
+func (s *NodeService) aclPolicy(tenantID int) (*types.ACLPolicy, error) {
+	tenant, err := s.tenantSettings(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.ACLPolicy, nil
+}
+
+// tenantSettings 返回租户记录，租户不存在时返回空记录，即全部使用默认设置
+func (s *NodeService) tenantSettings(tenantID int) (*types.Tenant, error) {
+	tenant, err := s.store.GetTenant(tenantID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("getting tenant: %w", err)
+	}
+	if tenant == nil {
+		return &types.Tenant{ID: tenantID}, nil
+	}
+	return tenant, nil
+}
+
+// compileFirewall 将访问控制策略编译为节点的防火墙规则，策略为空时返回 nil
+//
+// 节点只过滤发往自己（input）和发往经它接入的客户端（forward）的报文，丢弃策略不允许的成员地址；
+// 不属于任何成员的地址不受影响。成员总是可以访问自己。
+func (s *ConfigService) compileFirewall(node *types.NodeConfig, nodes []*types.NodeConfig, clients []*types.ClientPeer, policy *types.ACLPolicy) *types.FirewallPolicy {
+	if policy == nil {
+		return nil
+	}
+
+	nodeMembers := make(map[int]aclMember, len(nodes))
+	for _, n := range nodes {
+		nodeMembers[n.ID] = aclMember{tags: n.Tags, prefixes: s.nodePrefixes(n.AddressNumber())}
+	}
+	clientMembers := make(map[int]aclMember, len(clients))
+	for _, client := range clients {
+		clientMembers[client.ID] = aclMember{tags: client.Tags, prefixes: clientPrefixes(client)}
+	}
+
+	denied := func(dst aclMember, self func(kind string, id int) bool) []string {
+		var prefixes []string
+		for id, src := range nodeMembers {
+			if !self("node", id) && !policy.Allowed(src.tags, dst.tags) {
+				prefixes = append(prefixes, src.prefixes...)
+			}
+		}
+		for id, src := range clientMembers {
+			if !self("client", id) && !policy.Allowed(src.tags, dst.tags) {
+				prefixes = append(prefixes, src.prefixes...)
+			}
+		}
+		slices.Sort(prefixes)
+		return prefixes
+	}
+
+	firewall := &types.FirewallPolicy{Rules: []types.FirewallRule{}}
+	self := nodeMembers[node.ID]
+	if saddr := denied(self, func(kind string, id int) bool { return kind == "node" && id == node.ID }); len(saddr) > 0 {
+		firewall.Rules = append(firewall.Rules, types.FirewallRule{Saddr: saddr})
+	}
+	for _, client := range clients {
+		if !client.HasGateway(node.ID) {
+			continue
+		}
+		dst := clientMembers[client.ID]
+		saddr := denied(dst, func(kind string, id int) bool { return kind == "client" && id == client.ID })
+		if len(saddr) > 0 {
+			firewall.Rules = append(firewall.Rules, types.FirewallRule{Daddr: dst.prefixes, Saddr: saddr})
+		}
+	}
+	return firewall
+}
+
+// nodePrefixes 返回节点在访问控制中的地址范围，包括委派前缀
+//
+// 链路地址中的 {node} 按十进制生成，babeld 通告的节点地址按十六进制生成，两者不同时都包含；
+// Go 模板语法的地址模板两者相同。
+func (s *ConfigService) nodePrefixes(index int) []string {
+	var prefixes []string
+	vars := config.AddressVars{Node: index}
+	add := func(addr string, err error, bits int) {
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("Skipping invalid node address in ACL")
+			return
+		}
+		prefix, err := netip.ParsePrefix(addr + "/" + strconv.Itoa(bits))
+		if err != nil {
+			s.logger.Warn().Err(err).Str("address", addr).Msg("Skipping invalid node address in ACL")
+			return
+		}
+		if p := prefix.Masked().String(); !slices.Contains(prefixes, p) {
+			prefixes = append(prefixes, p)
+		}
+	}
+	addr, err := config.ExpandAddress(s.config.Network.IPv4NodeTemplate, vars)
+	add(addr, err, aclNodeIPv4PrefixLen)
+	addr, err = config.ExpandAddress(s.config.Network.IPv6NodeTemplate, vars)
+	add(addr, err, aclNodeIPv6PrefixLen)
+	addr, err = config.ExpandAddressHex(s.config.Network.IPv6NodeTemplate, vars)
+	add(addr, err, aclNodeIPv6PrefixLen)
+	// 节点下游局域网的委派前缀也属于该节点
+	if prefix, ok, err := delegatedPrefix(s.config, index); err == nil && ok {
+		prefixes = append(prefixes, prefix.String())
+	}
+	return prefixes
+}
+
+// clientPrefixes 返回客户端在访问控制中的地址
+func clientPrefixes(client *types.ClientPeer) []string {
+	return []string{client.IPv4 + "/32", client.IPv6 + "/128"}
+}
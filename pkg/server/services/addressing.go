@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nodeAddresses 按节点地址模板生成地址编号为 index 的节点地址，生成的地址不合法时返回错误
+func nodeAddresses(cfg *config.ServerConfig, index int) (ipv4, ipv6 string, err error) {
+	vars := config.AddressVars{Node: index}
+	if ipv4, err = config.ExpandAddress(cfg.Network.IPv4NodeTemplate, vars); err != nil {
+		return "", "", err
+	}
+	if ipv6, err = config.ExpandAddress(cfg.Network.IPv6NodeTemplate, vars); err != nil {
+		return "", "", err
+	}
+	for _, addr := range []string{ipv4, ipv6} {
+		host, _, _ := strings.Cut(addr, "/")
+		if _, err := netip.ParseAddr(host); err != nil {
+			return "", "", fmt.Errorf("address index %d produces invalid address %q", index, addr)
+		}
+	}
+	return ipv4, ipv6, nil
+}
+
+// addressAssignment 生成节点在地址规划中的条目
+func (s *NodeService) addressAssignment(node *types.NodeConfig) *types.AddressAssignment {
+	item := &types.AddressAssignment{NodeID: node.ID, Name: node.Name, AddressIndex: node.AddressNumber()}
+	item.IPv4, item.IPv6, _ = nodeAddresses(s.config, item.AddressIndex)
+	if prefix, ok, err := delegatedPrefix(s.config, item.AddressIndex); err == nil && ok {
+		item.DelegatedPrefix = prefix.String()
+	}
+	return item
+}
+
+// HandleGetAddressingPlan 返回租户的地址规划，按节点 ID 排序
+func (s *NodeService) HandleGetAddressingPlan(c *gin.Context) {
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	plan := make([]*types.AddressAssignment, 0, len(nodes))
+	for _, node := range nodes {
+		plan = append(plan, s.addressAssignment(node))
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// HandleUpdateAddressingPlan 为租户内的节点重新编址
+//
+// 请求只需列出要修改的节点，可以在一次请求中交换两个节点的编号。地址模板由所有租户共用，
+// 新编号不能与任何租户的节点重复。修改保存后按普通配置更新下发到租户内所有节点（受变更审批和维护窗口约束），
+// 下发进度见 /rollout；dry_run=true 时只返回修改后的地址规划。
+func (s *NodeService) HandleUpdateAddressingPlan(c *gin.Context) {
+	var req struct {
+		Assignments []struct {
+			NodeID       int `json:"node_id" binding:"required"`
+			AddressIndex int `json:"address_index" binding:"required,min=1"`
+		} `json:"assignments" binding:"required,min=1,dive"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	nodes, err := s.store.WithContext(c.Request.Context()).ListNodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	byID := make(map[int]*types.NodeConfig, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	changes := make(map[int]int, len(req.Assignments))
+	for _, a := range req.Assignments {
+		node, ok := byID[a.NodeID]
+		if !ok || node.TenantID != tenantID {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("node %d not found", a.NodeID)})
+			return
+		}
+		if _, dup := changes[a.NodeID]; dup {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("node %d is listed more than once", a.NodeID)})
+			return
+		}
+		if _, _, err := nodeAddresses(s.config, a.AddressIndex); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, _, err := delegatedPrefix(s.config, a.AddressIndex); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if a.AddressIndex != node.AddressNumber() {
+			changes[a.NodeID] = a.AddressIndex
+		}
+	}
+
+	// 按修改后的规划检查所有节点的编号互不相同
+	owners := make(map[int]*types.NodeConfig, len(nodes))
+	for _, node := range nodes {
+		index := node.AddressNumber()
+		if changed, ok := changes[node.ID]; ok {
+			index = changed
+		}
+		if owner, taken := owners[index]; taken {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("address index %d is assigned to both node %d and node %d", index, owner.ID, node.ID)})
+			return
+		}
+		owners[index] = node
+	}
+
+	plan := make([]*types.AddressAssignment, 0, len(changes))
+	for nodeID, index := range changes {
+		renumbered := *byID[nodeID]
+		renumbered.AddressIndex = index
+		plan = append(plan, s.addressAssignment(&renumbered))
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].NodeID < plan[j].NodeID })
+	if c.Query("dry_run") == "true" || len(changes) == 0 {
+		c.JSON(http.StatusOK, plan)
+		return
+	}
+
+	if err := s.store.UpdateNodeAddressIndexes(changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 对端的 AllowedIPs、访问控制和路由过滤都引用节点地址，租户内所有节点都需要更新
+	s.notifyMeshChange()
+	if err := s.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	for _, item := range plan {
+		s.logger.Info().
+			Int("node_id", item.NodeID).
+			Int("address_index", item.AddressIndex).
+			Msg("Renumbered node")
+	}
+	c.JSON(http.StatusOK, plan)
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/metrics"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// maxResolvedAdjacencyEvents 保留的已恢复事件数量
+const maxResolvedAdjacencyEvents = 100
+
+var (
+	adjacencyEventsRaised = metrics.NewCounter("mesh_babel_adjacency_events_total", "Missing babel adjacency events raised")
+	adjacencyMissing      = metrics.NewGauge("mesh_babel_adjacencies_missing", "Number of expected babel adjacencies currently missing beyond the timeout")
+)
+
+// AdjacencyMonitor 定期将节点上报的 babeld 邻居与拓扑中启用的链路比对，
+// 期望的邻居缺失超过阈值时产生事件，用于发现隧道已建立但不参与路由的黑洞链路
+type AdjacencyMonitor struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+	clock  clock.Clock
+
+	mu       sync.Mutex
+	missing  map[[2]int]time.Time             // 有向邻接（节点, 期望邻居）首次缺失的时间
+	active   map[[2]int]*types.AdjacencyEvent // 未恢复的事件
+	resolved []*types.AdjacencyEvent          // 最近恢复的事件，按恢复时间排列
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewAdjacencyMonitor 创建邻接检查服务实例
+func NewAdjacencyMonitor(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store) *AdjacencyMonitor {
+	return &AdjacencyMonitor{
+		config:  cfg,
+		logger:  logger.With().Str("service", "adjacency").Logger(),
+		store:   store,
+		clock:   clock.Real(),
+		missing: make(map[[2]int]time.Time),
+		active:  make(map[[2]int]*types.AdjacencyEvent),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// SetClock 替换时间源，需在服务启动前调用
+func (m *AdjacencyMonitor) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// RegisterRoutes 注册路由
+func (m *AdjacencyMonitor) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.GET("/topology/adjacency-events", m.HandleListEvents)
+}
+
+// Start 启动检查协程
+func (m *AdjacencyMonitor) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := m.clock.NewTicker(m.config.Status.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C():
+				m.Run()
+			}
+		}
+	}()
+}
+
+// Stop 停止检查协程
+func (m *AdjacencyMonitor) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+// Run 执行一次检查
+func (m *AdjacencyMonitor) Run() {
+	nodes, err := m.store.ListNodes()
+	if err != nil {
+		m.logger.Error().Err(err).Msg("Failed to list nodes")
+		return
+	}
+	statuses, err := m.store.ListNodeStatus()
+	if err != nil {
+		m.logger.Error().Err(err).Msg("Failed to list node statuses")
+		return
+	}
+	conns, err := m.store.ListWireguardConnections(0)
+	if err != nil {
+		m.logger.Error().Err(err).Msg("Failed to list connections")
+		return
+	}
+
+	now := m.clock.Now()
+	byID := make(map[int]*types.NodeConfig, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+	byNode := make(map[int]*types.NodeStatus, len(statuses))
+	for _, status := range statuses {
+		byNode[status.NodeID] = status
+	}
+
+	// 找出当前缺失的有向邻接，记录隧道是否已建立
+	missingNow := make(map[[2]int]bool)
+	for _, conn := range conns {
+		if conn.Disabled || conn.Path != 0 {
+			continue
+		}
+		a, b := byID[conn.NodeID], byID[conn.PeerID]
+		if a == nil || b == nil {
+			continue
+		}
+		for _, pair := range [][2]*types.NodeConfig{{a, b}, {b, a}} {
+			node, peer := pair[0], pair[1]
+			status := byNode[node.ID]
+			// 双方都在线且本端 babeld 可观测时才能判断邻接是否缺失
+			if !isOnline(status, now, m.config.Status.OfflineAfter) ||
+				!isOnline(byNode[peer.ID], now, m.config.Status.OfflineAfter) ||
+				!status.Babel.Running {
+				continue
+			}
+			if hasBabelNeighbour(status, peer.PublicKey) {
+				continue
+			}
+			missingNow[[2]int{node.ID, peer.ID}] = handshakeView(status, peer.PublicKey, now, m.config.Status.HandshakeTimeout).Fresh
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, tunnelUp := range missingNow {
+		since, ok := m.missing[key]
+		if !ok {
+			m.missing[key] = now
+			since = now
+		}
+		if event := m.active[key]; event != nil {
+			event.TunnelUp = tunnelUp
+			continue
+		}
+		if now.Sub(since) < m.config.Status.AdjacencyTimeout {
+			continue
+		}
+
+		event := &types.AdjacencyEvent{
+			TenantID:     byID[key[0]].TenantID,
+			NodeID:       key[0],
+			PeerID:       key[1],
+			TunnelUp:     tunnelUp,
+			MissingSince: since,
+			RaisedAt:     now,
+		}
+		m.active[key] = event
+		adjacencyEventsRaised.Inc()
+		m.logger.Warn().
+			Int("node_id", event.NodeID).
+			Int("peer_id", event.PeerID).
+			Bool("tunnel_up", tunnelUp).
+			Dur("missing_for", now.Sub(since)).
+			Msg("Expected babel neighbour missing")
+	}
+
+	for key := range m.missing {
+		if missingNow[key] {
+			continue
+		}
+		delete(m.missing, key)
+		event := m.active[key]
+		if event == nil {
+			continue
+		}
+		delete(m.active, key)
+		resolvedAt := now
+		event.ResolvedAt = &resolvedAt
+		m.resolved = append(m.resolved, event)
+		if len(m.resolved) > maxResolvedAdjacencyEvents {
+			m.resolved = m.resolved[len(m.resolved)-maxResolvedAdjacencyEvents:]
+		}
+		m.logger.Info().
+			Int("node_id", event.NodeID).
+			Int("peer_id", event.PeerID).
+			Msg("Babel neighbour restored")
+	}
+
+	adjacencyMissing.Set(float64(len(m.active)))
+}
+
+// Forget 移除已删除节点相关的缺失记录和事件
+func (m *AdjacencyMonitor) Forget(nodeID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.missing {
+		if key[0] == nodeID || key[1] == nodeID {
+			delete(m.missing, key)
+		}
+	}
+	for key := range m.active {
+		if key[0] == nodeID || key[1] == nodeID {
+			delete(m.active, key)
+		}
+	}
+	m.resolved = slices.DeleteFunc(m.resolved, func(event *types.AdjacencyEvent) bool {
+		return event.NodeID == nodeID || event.PeerID == nodeID
+	})
+	adjacencyMissing.Set(float64(len(m.active)))
+}
+
+// Events 返回租户内未恢复的事件和最近恢复的事件
+func (m *AdjacencyMonitor) Events(tenantID int) (active, resolved []types.AdjacencyEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active = make([]types.AdjacencyEvent, 0)
+	for _, event := range m.active {
+		if event.TenantID == tenantID {
+			active = append(active, *event)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].RaisedAt.Before(active[j].RaisedAt) })
+
+	resolved = make([]types.AdjacencyEvent, 0)
+	for _, event := range m.resolved {
+		if event.TenantID == tenantID {
+			resolved = append(resolved, *event)
+		}
+	}
+	return active, resolved
+}
+
+// HandleListEvents 列出 Babel 邻接缺失事件
+func (m *AdjacencyMonitor) HandleListEvents(c *gin.Context) {
+	active, resolved := m.Events(middleware.TenantID(c))
+	c.JSON(http.StatusOK, gin.H{
+		"active":   active,
+		"resolved": resolved,
+	})
+}
+
+// hasBabelNeighbour 节点上报的 babeld 邻居中是否有可达的指定对等节点
+func hasBabelNeighbour(status *types.NodeStatus, publicKey string) bool {
+	for _, n := range status.Babel.Neighbours {
+		if n.PublicKey == publicKey && n.Reach != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGetBGPConfig 返回租户的 BGP 对接设置，未设置时返回 404
+func (s *ConfigService) HandleGetBGPConfig(c *gin.Context) {
+	tenant, err := s.nodeService.tenantSettings(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tenant.BGP == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "BGP not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, tenant.BGP)
+}
+
+// HandleUpdateBGPConfig 替换租户的 BGP 对接设置，新旧边界节点的配置都会更新
+func (s *ConfigService) HandleUpdateBGPConfig(c *gin.Context) {
+	var req types.BGPConfig
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	for _, nodeID := range req.NodeIDs() {
+		node, err := s.nodeService.GetTenantNode(c.Request.Context(), tenantID, nodeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if node == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("node %d not found", nodeID)})
+			return
+		}
+	}
+	s.saveBGPConfig(c, &req)
+}
+
+// HandleDeleteBGPConfig 删除租户的 BGP 对接设置，agent 随后删除边界节点上的 BIRD 配置片段
+func (s *ConfigService) HandleDeleteBGPConfig(c *gin.Context) {
+	s.saveBGPConfig(c, nil)
+}
+
+func (s *ConfigService) saveBGPConfig(c *gin.Context, bgp *types.BGPConfig) {
+	tenantID := middleware.TenantID(c)
+	tenant, err := s.nodeService.tenantSettings(tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.nodeService.store.UpdateTenantBGPConfig(tenantID, bgp); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var nodeIDs []int
+	for _, cfg := range []*types.BGPConfig{tenant.BGP, bgp} {
+		if cfg != nil {
+			nodeIDs = append(nodeIDs, cfg.NodeIDs()...)
+		}
+	}
+	slices.Sort(nodeIDs)
+	s.nodeService.notifyMeshChange()
+	s.nodeService.enqueueNodeUpdate(slices.Compact(nodeIDs)...)
+	c.Status(http.StatusNoContent)
+}
+
+// renderBGP 为边界节点生成 BIRD 配置片段，未设置 BGP 或节点不是边界节点时返回空字符串
+func (s *ConfigService) renderBGP(node *types.NodeConfig, bgp *types.BGPConfig) string {
+	if bgp == nil {
+		return ""
+	}
+	prefixes := bgp.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{s.config.Network.IPv4Range, s.config.Network.IPv6Range}
+	}
+	return bgp.BIRD(node.ID, prefixes)
+}
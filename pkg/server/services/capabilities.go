@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleGetNodeCapabilities 返回 agent 上报的本地工具探测结果，以及按当前配置不满足的要求
+func (s *NodeService) HandleGetNodeCapabilities(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	problems, err := capabilityProblems(s.config, s.store, node.TenantID, node.Capabilities)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"capabilities": node.Capabilities,
+		"problems":     problems,
+	})
+}
+
+// checkRegistration 保存 agent 注册时上报的探测结果，返回不满足节点配置要求的项
+func (s *TaskService) checkRegistration(ctx context.Context, nodeID int, reported []*pb.Capability) ([]string, error) {
+	if len(reported) == 0 {
+		return nil, nil
+	}
+	caps := make([]types.Capability, 0, len(reported))
+	for _, c := range reported {
+		caps = append(caps, types.Capability{Name: c.Name, Available: c.Available, Version: c.Version})
+	}
+
+	st := s.store.WithContext(ctx)
+	node, err := st.GetNode(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("getting node: %w", err)
+	}
+	if err := st.UpdateNodeCapabilities(nodeID, caps); err != nil {
+		return nil, err
+	}
+	return capabilityProblems(s.config, st, node.TenantID, caps)
+}
+
+// capabilityProblems 按租户的路由守护进程和 babel 模板检查探测结果
+func capabilityProblems(cfg *config.ServerConfig, st store.Store, tenantID int, caps []types.Capability) ([]string, error) {
+	req := types.CapabilityRequirements{
+		RoutingDaemon: types.RoutingDaemonBabeld,
+		BabeldRTT:     strings.Contains(cfg.Templates.Babel, "enable-timestamps") || strings.Contains(cfg.Templates.Babel, "max-rtt-penalty"),
+	}
+	tenant, err := st.GetTenant(tenantID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("getting tenant: %w", err)
+	}
+	if tenant != nil {
+		req.RoutingDaemon = tenantRoutingDaemon(tenant)
+	}
+	return types.CheckCapabilities(caps, req), nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ca"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// CertService 为 agent 签发客户端证书
+type CertService struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+
+	// 服务依赖
+	ca       *ca.CA
+	nodeAuth *middleware.NodeAuthenticator
+}
+
+// NewCertService 创建证书服务实例
+func NewCertService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, authority *ca.CA, nodeAuth *middleware.NodeAuthenticator) *CertService {
+	return &CertService{
+		config:   cfg,
+		logger:   logger.With().Str("service", "cert").Logger(),
+		store:    store,
+		ca:       authority,
+		nodeAuth: nodeAuth,
+	}
+}
+
+// RegisterRoutes 注册HTTP路由
+func (s *CertService) RegisterRoutes(g *RouteGroups) {
+	// 申请证书不挂在 agent 路由组下：要求客户端证书时，节点仍需凭令牌完成首次申请
+	g.Auth.POST("/node/certificate", s.nodeAuth.EnrollAuth(), s.HandleSignCertificate)
+	g.Auth.GET("/ca.pem", s.HandleGetCA)
+
+	g.Dashboard.DELETE("/nodes/:id/certificate", s.HandleRevokeCertificate)
+}
+
+// HandleSignCertificate 签发节点证书，请求节点的旧证书随即失效
+func (s *CertService) HandleSignCertificate(c *gin.Context) {
+	nodeID := c.GetInt("node_id")
+
+	var req struct {
+		CSR string `json:"csr"` // PEM 编码的证书签名请求
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.CSR == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	issued, err := s.ca.Sign([]byte(req.CSR), nodeID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.store.UpdateNodeCertificate(nodeID, issued.Serial, &issued.NotAfter); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.Info().
+		Int("node_id", nodeID).
+		Str("serial", issued.Serial).
+		Time("expires_at", issued.NotAfter).
+		Msg("Issued node certificate")
+
+	c.JSON(http.StatusOK, gin.H{
+		"certificate":    string(issued.CertPEM),
+		"ca_certificate": string(s.ca.CertPEM()),
+		"serial":         issued.Serial,
+		"expires_at":     issued.NotAfter.Format(time.RFC3339),
+	})
+}
+
+// HandleGetCA 返回 CA 证书
+func (s *CertService) HandleGetCA(c *gin.Context) {
+	c.Data(http.StatusOK, "application/x-pem-file", s.ca.CertPEM())
+}
+
+// HandleRevokeCertificate 吊销节点当前的证书，节点需凭令牌重新申请
+func (s *CertService) HandleRevokeCertificate(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	node, err := s.store.GetNode(nodeID)
+	if err != nil || node.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if err := s.store.UpdateNodeCertificate(nodeID, "", nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.Info().
+		Int("node_id", nodeID).
+		Str("serial", node.CertSerial).
+		Msg("Revoked node certificate")
+	c.JSON(http.StatusOK, gin.H{"message": "Certificate revoked"})
+}
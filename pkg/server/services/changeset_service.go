@@ -0,0 +1,287 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ChangesetService 配置变更审批服务
+//
+// 开启 rollout.require_approval 后，修改照常保存，但受影响节点的配置更新记录到租户待审批的变更集，
+// 由未参与修改的管理员批准后才加入下发队列。拒绝只放弃下发，已保存的修改需另行撤销，
+// 否则会随下一个被批准的变更集下发。
+type ChangesetService struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+
+	// 服务依赖
+	nodeService *NodeService
+
+	// 串行化待审批变更集的读改写
+	mu sync.Mutex
+}
+
+// NewChangesetService 创建变更审批服务
+func NewChangesetService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeService *NodeService) *ChangesetService {
+	srv := &ChangesetService{
+		config:      cfg,
+		logger:      logger.With().Str("service", "changeset").Logger(),
+		store:       store,
+		nodeService: nodeService,
+	}
+	if cfg.Rollout.RequireApproval {
+		nodeService.SetChangeHold(srv.hold)
+	}
+	return srv
+}
+
+// RegisterRoutes 注册路由
+func (s *ChangesetService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.GET("/changesets", s.HandleListChangesets)
+	g.Dashboard.GET("/changesets/:id", s.HandleGetChangeset)
+	g.Dashboard.POST("/changesets/:id/approve", s.HandleApproveChangeset)
+	g.Dashboard.POST("/changesets/:id/reject", s.HandleRejectChangeset)
+}
+
+// hold 将节点更新记录到各自租户的待审批变更集
+func (s *ChangesetService) hold(nodeIDs []int) bool {
+	byTenant := make(map[int][]int)
+	for _, nodeID := range nodeIDs {
+		node, err := s.store.GetNode(nodeID)
+		if err != nil {
+			s.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to get node for changeset")
+			continue
+		}
+		byTenant[node.TenantID] = append(byTenant[node.TenantID], nodeID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tenantID, ids := range byTenant {
+		changeset, err := s.pending(tenantID)
+		if err != nil {
+			s.logger.Error().Err(err).Int("tenant_id", tenantID).Msg("Failed to load pending changeset")
+			continue
+		}
+		changeset.NodeIDs = mergeNodeIDs(changeset.NodeIDs, ids)
+		changeset.UpdatedAt = time.Now()
+		if err := s.store.UpdateChangeset(changeset); err != nil {
+			s.logger.Error().Err(err).Int("changeset_id", changeset.ID).Msg("Failed to update changeset")
+		}
+	}
+	return true
+}
+
+// pending 获取租户待审批的变更集，没有时创建
+func (s *ChangesetService) pending(tenantID int) (*types.Changeset, error) {
+	changeset, err := s.store.GetPendingChangeset(tenantID)
+	if err == nil {
+		return changeset, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	changeset = &types.Changeset{
+		TenantID:  tenantID,
+		Status:    types.ChangesetPending,
+		NodeIDs:   []int{},
+		Changes:   []types.ChangeEntry{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.CreateChangeset(changeset); err != nil {
+		return nil, err
+	}
+	s.logger.Info().Int("changeset_id", changeset.ID).Int("tenant_id", tenantID).Msg("Opened changeset for approval")
+	return changeset, nil
+}
+
+// TrackChanges 记录修改请求的提交人
+//
+// 挂载在管理路由上。成功的修改请求执行期间租户的待审批变更集有更新时，
+// 将请求和提交人记入变更集，提交人不能再批准该变更集。
+func (s *ChangesetService) TrackChanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.Rollout.RequireApproval || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+
+		tenantID := middleware.TenantID(c)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		changeset, err := s.store.GetPendingChangeset(tenantID)
+		if err != nil || changeset.UpdatedAt.Before(start) {
+			return
+		}
+		changeset.Changes = append(changeset.Changes, types.ChangeEntry{
+			UserID:   c.GetInt("user_id"),
+			Username: c.GetString("username"),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			At:       start,
+		})
+		if err := s.store.UpdateChangeset(changeset); err != nil {
+			s.logger.Error().Err(err).Int("changeset_id", changeset.ID).Msg("Failed to record change")
+		}
+	}
+}
+
+// HandleListChangesets 列出租户的变更集，可按 status 过滤
+func (s *ChangesetService) HandleListChangesets(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", types.ChangesetPending, types.ChangesetApproved, types.ChangesetRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	changesets, err := s.store.ListChangesets(middleware.TenantID(c), status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if changesets == nil {
+		changesets = []*types.Changeset{}
+	}
+	c.JSON(http.StatusOK, changesets)
+}
+
+// HandleGetChangeset 获取变更集
+func (s *ChangesetService) HandleGetChangeset(c *gin.Context) {
+	changeset, ok := s.tenantChangeset(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, changeset)
+}
+
+// HandleApproveChangeset 批准变更集，将相关节点加入配置下发队列
+func (s *ChangesetService) HandleApproveChangeset(c *gin.Context) {
+	s.review(c, types.ChangesetApproved)
+}
+
+// HandleRejectChangeset 拒绝变更集，相关节点不下发
+func (s *ChangesetService) HandleRejectChangeset(c *gin.Context) {
+	s.review(c, types.ChangesetRejected)
+}
+
+// review 审批变更集，只有未参与修改的管理员可以审批
+func (s *ChangesetService) review(c *gin.Context, status string) {
+	if c.GetString("role") != types.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+		return
+	}
+
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	// 请求体可选
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changeset, ok := s.tenantChangeset(c)
+	if !ok {
+		return
+	}
+	if changeset.Status != types.ChangesetPending {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Changeset is already %s", changeset.Status)})
+		return
+	}
+	userID := c.GetInt("user_id")
+	if changeset.AuthoredBy(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Changeset must be reviewed by an admin who did not author it"})
+		return
+	}
+
+	now := time.Now()
+	changeset.Status = status
+	changeset.ReviewedBy = userID
+	changeset.ReviewedAt = &now
+	changeset.Comment = req.Comment
+	changeset.UpdatedAt = now
+	if err := s.store.UpdateChangeset(changeset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status == types.ChangesetApproved {
+		s.nodeService.dispatchNodeUpdate(changeset.NodeIDs...)
+	}
+
+	s.logger.Info().
+		Int("changeset_id", changeset.ID).
+		Int("reviewer_id", userID).
+		Str("status", status).
+		Ints("node_ids", changeset.NodeIDs).
+		Msg("Changeset reviewed")
+	c.JSON(http.StatusOK, changeset)
+}
+
+// tenantChangeset 获取请求中属于租户的变更集，失败时已写入响应
+func (s *ChangesetService) tenantChangeset(c *gin.Context) (*types.Changeset, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid changeset ID"})
+		return nil, false
+	}
+	changeset, err := s.store.GetChangeset(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Changeset not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if changeset.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Changeset not found"})
+		return nil, false
+	}
+	return changeset, true
+}
+
+// mergeNodeIDs 合并节点ID并去重排序
+func mergeNodeIDs(a, b []int) []int {
+	seen := make(map[int]bool, len(a)+len(b))
+	merged := make([]int, 0, len(a)+len(b))
+	for _, id := range append(append([]int{}, a...), b...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	sort.Ints(merged)
+	return merged
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ephemeral"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// TestPromotedReviewerApprovesChangeset 新租户只有创建者一名管理员，创建者提升同租户用户为管理员后，由其审批创建者提交的变更集
+func TestPromotedReviewerApprovesChangeset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.DefaultServerConfig()
+	cfg.Rollout.RequireApproval = true
+
+	logger := zerolog.Nop()
+	st := store.NewMemoryStore()
+	tasks := NewTaskService(cfg, logger, st, middleware.NewNodeAuthenticator(logger, st), ephemeral.NewMemory())
+	changesets := NewChangesetService(cfg, logger, st, NewNodeService(cfg, logger, st, tasks))
+	users := NewUserService(cfg, logger, st, middleware.NewJWTAuthenticator(logger, st, []byte("test")), nil, nil)
+
+	tenant := &types.Tenant{Name: "acme"}
+	if err := st.CreateTenant(tenant); err != nil {
+		t.Fatalf("CreateTenant: %v", err)
+	}
+	admin := &types.User{Username: "owner", Password: "x", TenantID: tenant.ID, Role: types.RoleAdmin}
+	member := &types.User{Username: "member", Password: "x", TenantID: tenant.ID, Role: types.RoleUser}
+	for _, user := range []*types.User{admin, member} {
+		if err := st.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	changeset := &types.Changeset{
+		TenantID: tenant.ID,
+		Status:   types.ChangesetPending,
+		Changes:  []types.ChangeEntry{{UserID: admin.ID, Username: admin.Username}},
+	}
+	if err := st.CreateChangeset(changeset); err != nil {
+		t.Fatalf("CreateChangeset: %v", err)
+	}
+
+	// 按存储中的用户设置请求身份，相当于用户重新登录后的 token
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id, _ := strconv.Atoi(c.GetHeader("X-Test-User"))
+		user, err := st.GetUser(id)
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set("user_id", user.ID)
+		c.Set("tenant_id", user.TenantID)
+		c.Set("role", user.Role)
+	})
+	router.POST("/changesets/:id/approve", changesets.HandleApproveChangeset)
+	router.PUT("/users/:id/role", users.HandleUpdateUserRole)
+
+	do := func(method, path string, as *types.User, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", strconv.Itoa(as.ID))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	approvePath := fmt.Sprintf("/changesets/%d/approve", changeset.ID)
+
+	if w := do(http.MethodPost, approvePath, admin, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("author approved own changeset: status %d", w.Code)
+	}
+	if w := do(http.MethodPost, approvePath, member, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin approved changeset: status %d", w.Code)
+	}
+	if w := do(http.MethodPut, fmt.Sprintf("/users/%d/role", admin.ID), member, `{"role":"user"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin changed a role: status %d", w.Code)
+	}
+	if w := do(http.MethodPut, fmt.Sprintf("/users/%d/role", admin.ID), admin, `{"role":"user"}`); w.Code != http.StatusConflict {
+		t.Fatalf("admin demoted themselves: status %d", w.Code)
+	}
+
+	if w := do(http.MethodPut, fmt.Sprintf("/users/%d/role", member.ID), admin, `{"role":"admin"}`); w.Code != http.StatusOK {
+		t.Fatalf("promoting member: status %d, body %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, approvePath, member, ""); w.Code != http.StatusOK {
+		t.Fatalf("promoted reviewer approving: status %d, body %s", w.Code, w.Body)
+	}
+
+	approved, err := st.GetChangeset(changeset.ID)
+	if err != nil {
+		t.Fatalf("GetChangeset: %v", err)
+	}
+	if approved.Status != types.ChangesetApproved || approved.ReviewedBy != member.ID {
+		t.Errorf("changeset status %s reviewed by %d, want approved by %d", approved.Status, approved.ReviewedBy, member.ID)
+	}
+}
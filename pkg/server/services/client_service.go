@@ -0,0 +1,563 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+	"mesh-backend/pkg/utils/qrcode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ClientService 管理客户端对等节点：手机、笔记本等不运行 agent 的设备
+//
+// 客户端通过选定的网关节点接入 mesh。网关节点的下发配置中增加 {WGPrefix}clients 接口，
+// 每个客户端一个 [Peer]，wg-quick 为客户端地址安装路由，babeld 将其通告到 mesh；
+// 客户端使用服务端生成的标准 wg-quick 配置，AllowedIPs 为整个 mesh 网段。
+type ClientService struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+	clock  clock.Clock
+
+	nodeService *NodeService
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewClientService 创建客户端对等节点服务
+func NewClientService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeService *NodeService) *ClientService {
+	return &ClientService{
+		config:      cfg,
+		logger:      logger.With().Str("service", "client").Logger(),
+		store:       store,
+		clock:       clock.Real(),
+		nodeService: nodeService,
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// SetClock 替换时间源，需在服务启动前调用
+func (s *ClientService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Start 启动到期检查协程
+func (s *ClientService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := s.clock.NewTicker(s.config.Clients.ExpiryInterval)
+		defer ticker.Stop()
+
+		s.expire()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C():
+				s.expire()
+			}
+		}
+	}()
+}
+
+// Stop 停止到期检查协程
+func (s *ClientService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// expire 删除到期的客户端并更新其网关节点的配置
+//
+// 生成配置时已跳过到期的客户端，这里删除记录并触发下发，使网关节点及时撤销对应的 [Peer]。
+// 多副本同时执行时只有一个副本删除成功，其余副本忽略 ErrNotFound。
+func (s *ClientService) expire() {
+	peers, err := s.store.ListExpiredClientPeers(s.clock.Now())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list expired client peers")
+		return
+	}
+
+	gateways := make(map[int][]int)
+	for _, peer := range peers {
+		if err := s.store.DeleteClientPeer(peer.ID); err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				s.logger.Error().Err(err).Int("client_id", peer.ID).Msg("Failed to delete expired client peer")
+			}
+			continue
+		}
+		gateways[peer.TenantID] = append(gateways[peer.TenantID], peer.GatewayIDs...)
+		s.nodeService.webhooks.Emit(types.EventClientExpired, peer.TenantID, gin.H{"id": peer.ID, "name": peer.Name, "expires_at": peer.ExpiresAt})
+		s.logger.Info().Int("client_id", peer.ID).Str("name", peer.Name).Msg("Removed expired client peer")
+	}
+	for tenantID, ids := range gateways {
+		s.updateGateways(tenantID, ids)
+	}
+}
+
+// RegisterRoutes 注册路由
+func (s *ClientService) RegisterRoutes(g *RouteGroups) {
+	r := g.Dashboard
+	r.GET("/clients", s.HandleListClients)
+	r.POST("/clients", s.HandleCreateClient)
+	r.GET("/clients/:id", s.HandleGetClient)
+	r.PUT("/clients/:id", s.HandleUpdateClient)
+	r.DELETE("/clients/:id", s.HandleDeleteClient)
+	r.GET("/clients/:id/config", s.HandleGetClientConfig)
+	r.GET("/clients/:id/qrcode", s.HandleGetClientQRCode)
+}
+
+// clientRequest 创建和更新客户端的请求体
+type clientRequest struct {
+	Name        string   `json:"name" binding:"required,name"`
+	GatewayIDs  []int    `json:"gateway_ids" binding:"required"`
+	PublicKey   string   `json:"public_key"` // 客户端自行生成密钥时提供公钥，为空时由服务端生成密钥对，仅创建时有效
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"` // 访问控制标签
+	TTL         string   `json:"ttl"`  // 有效期，如 72h，从请求时起算；更新时为空表示保持原过期时间
+}
+
+// expiresAt 解析 ttl，返回过期时间，ttl 为空时返回 nil
+func (s *ClientService) expiresAt(ttl string) (*time.Time, error) {
+	if ttl == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid ttl: %s", ttl)
+	}
+	if limit := s.config.Clients.MaxTTL; limit > 0 && d > limit {
+		return nil, fmt.Errorf("ttl exceeds clients.max_ttl (%s)", limit)
+	}
+	at := s.clock.Now().Add(d)
+	return &at, nil
+}
+
+// HandleListClients 列出租户的客户端
+func (s *ClientService) HandleListClients(c *gin.Context) {
+	peers, err := s.store.ListClientPeers(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if peers == nil {
+		peers = []*types.ClientPeer{}
+	}
+	c.JSON(http.StatusOK, peers)
+}
+
+// HandleCreateClient 创建客户端，分配地址并更新网关节点的配置
+func (s *ClientService) HandleCreateClient(c *gin.Context) {
+	var req clientRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	expiresAt, err := s.expiresAt(req.TTL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	now := s.clock.Now()
+	peer := &types.ClientPeer{
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		TenantID:    tenantID,
+		Name:        req.Name,
+		PublicKey:   req.PublicKey,
+		GatewayIDs:  req.GatewayIDs,
+		Description: req.Description,
+		Tags:        req.Tags,
+		ExpiresAt:   expiresAt,
+	}
+	if peer.PublicKey == "" {
+		privateKey, publicKey, err := generateWireGuardKeyPair()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		peer.PrivateKey, peer.PublicKey = privateKey, publicKey
+	}
+	if err := peer.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkGateways(c, tenantID, peer.GatewayIDs) {
+		return
+	}
+
+	// 地址由 ID 生成，创建后再写入
+	if err := s.store.CreateClientPeer(peer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ipv4, ipv6, err := s.clientAddresses(peer.ID)
+	if err != nil {
+		if err := s.store.DeleteClientPeer(peer.ID); err != nil {
+			s.logger.Error().Err(err).Int("client_id", peer.ID).Msg("Failed to remove client without address")
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	peer.IPv4, peer.IPv6 = ipv4, ipv6
+	if err := s.store.UpdateClientPeer(peer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.updateGateways(tenantID, peer.GatewayIDs)
+	s.logger.Info().Int("client_id", peer.ID).Str("name", peer.Name).Ints("gateways", peer.GatewayIDs).Msg("Created client peer")
+	c.JSON(http.StatusOK, peer)
+}
+
+// HandleGetClient 获取客户端
+func (s *ClientService) HandleGetClient(c *gin.Context) {
+	peer, ok := s.tenantClient(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, peer)
+}
+
+// HandleUpdateClient 更新客户端的名称、网关和描述，指定 ttl 时延长有效期，新旧网关节点的配置都会更新
+func (s *ClientService) HandleUpdateClient(c *gin.Context) {
+	peer, ok := s.tenantClient(c)
+	if !ok {
+		return
+	}
+
+	var req clientRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.PublicKey != "" && req.PublicKey != peer.PublicKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "public_key cannot be changed, create a new client instead"})
+		return
+	}
+
+	expiresAt, err := s.expiresAt(req.TTL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated := *peer
+	updated.Name = req.Name
+	updated.GatewayIDs = req.GatewayIDs
+	updated.Description = req.Description
+	updated.Tags = req.Tags
+	updated.UpdatedAt = s.clock.Now()
+	if expiresAt != nil {
+		updated.ExpiresAt = expiresAt
+	}
+	if err := updated.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkGateways(c, peer.TenantID, updated.GatewayIDs) {
+		return
+	}
+
+	if err := s.store.UpdateClientPeer(&updated); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.updateGateways(peer.TenantID, append(peer.GatewayIDs, updated.GatewayIDs...))
+	c.JSON(http.StatusOK, &updated)
+}
+
+// HandleDeleteClient 删除客户端并从网关节点的配置中移除
+func (s *ClientService) HandleDeleteClient(c *gin.Context) {
+	peer, ok := s.tenantClient(c)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteClientPeer(peer.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.updateGateways(peer.TenantID, peer.GatewayIDs)
+	s.logger.Info().Int("client_id", peer.ID).Str("name", peer.Name).Msg("Deleted client peer")
+	c.Status(http.StatusNoContent)
+}
+
+// HandleGetClientConfig 下载客户端的 wg-quick 配置，?gateway=<node_id> 指定网关，默认使用第一个
+//
+// 客户端自带公钥时服务端没有私钥，配置中的 PrivateKey 需由用户自行填写。
+func (s *ClientService) HandleGetClientConfig(c *gin.Context) {
+	peer, ok := s.tenantClient(c)
+	if !ok {
+		return
+	}
+	gatewayID, ok := clientGateway(c, peer)
+	if !ok {
+		return
+	}
+
+	conf, err := s.ClientConfig(c.Request.Context(), peer, gatewayID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+clientConfigFilename(peer)+`"`)
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(conf))
+}
+
+// HandleGetClientQRCode 以 QR 码返回客户端配置，供移动端 WireGuard 应用扫码导入
+//
+// format=png（默认）返回图片，format=text 返回 Unicode 方块字符，深色背景的终端加 invert=true；
+// gateway 参数同 HandleGetClientConfig。客户端自带公钥时服务端没有私钥，无法生成可直接导入的配置。
+func (s *ClientService) HandleGetClientQRCode(c *gin.Context) {
+	format := c.DefaultQuery("format", "png")
+	if format != "png" && format != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected png or text"})
+		return
+	}
+
+	peer, ok := s.tenantClient(c)
+	if !ok {
+		return
+	}
+	if peer.PrivateKey == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Client was created with its own public key, the server does not hold its private key"})
+		return
+	}
+	gatewayID, ok := clientGateway(c, peer)
+	if !ok {
+		return
+	}
+
+	conf, err := s.ClientConfig(c.Request.Context(), peer, gatewayID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	code, err := qrcode.Encode([]byte(conf))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 配置中含私钥，不允许缓存
+	c.Header("Cache-Control", "no-store")
+	if format == "text" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(code.Text(2, c.Query("invert") == "true")))
+		return
+	}
+	img, err := code.PNG(qrScale, qrBorder)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", img)
+}
+
+// PNG 二维码每个模块的像素数和四周留白的模块数
+const (
+	qrScale  = 6
+	qrBorder = 4
+)
+
+// clientGateway 解析 ?gateway=<node_id>，未指定时使用客户端的第一个网关，失败时已写入响应
+func clientGateway(c *gin.Context, peer *types.ClientPeer) (int, bool) {
+	raw := c.Query("gateway")
+	if raw == "" {
+		return peer.GatewayIDs[0], true
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || !peer.HasGateway(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gateway, expected one of the client's gateway_ids"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ClientConfig 渲染客户端通过指定网关接入时使用的 wg-quick 配置
+func (s *ClientService) ClientConfig(ctx context.Context, peer *types.ClientPeer, gatewayID int) (string, error) {
+	gateway, err := s.nodeService.GetNode(ctx, gatewayID)
+	if err != nil {
+		return "", fmt.Errorf("getting gateway %d: %w", gatewayID, err)
+	}
+	var hosts []string
+	if err := json.Unmarshal([]byte(gateway.Endpoints), &hosts); err != nil || len(hosts) == 0 {
+		return "", fmt.Errorf("gateway %d has no endpoint", gatewayID)
+	}
+
+	privateKey := peer.PrivateKey
+	if privateKey == "" {
+		privateKey = "<client private key>"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s via %s\n", peer.Name, gateway.Name)
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", privateKey)
+	fmt.Fprintf(&b, "Address = %s/32, %s/128\n", peer.IPv4, peer.IPv6)
+	if len(s.config.Clients.DNS) > 0 {
+		fmt.Fprintf(&b, "DNS = %s\n", strings.Join(s.config.Clients.DNS, ", "))
+	}
+	b.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&b, "PublicKey = %s\n", gateway.PublicKey)
+	fmt.Fprintf(&b, "Endpoint = %s\n", joinEndpoint(endpointHost(hosts[0]), s.config.Clients.Port))
+	fmt.Fprintf(&b, "AllowedIPs = %s, %s\n", s.config.Network.IPv4Range, s.config.Network.IPv6Range)
+	if s.config.Clients.Keepalive > 0 {
+		fmt.Fprintf(&b, "PersistentKeepalive = %d\n", s.config.Clients.Keepalive)
+	}
+	return b.String(), nil
+}
+
+// tenantClient 解析路径中的客户端 ID 并检查所属租户，失败时已写入响应
+func (s *ClientService) tenantClient(c *gin.Context) (*types.ClientPeer, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return nil, false
+	}
+	peer, err := s.store.GetClientPeer(id)
+	// 到期但尚未被删除的客户端视为不存在
+	if errors.Is(err, store.ErrNotFound) || (err == nil && (peer.TenantID != middleware.TenantID(c) || peer.Expired(s.clock.Now()))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return peer, true
+}
+
+// checkGateways 检查网关节点都属于租户，失败时已写入响应
+func (s *ClientService) checkGateways(c *gin.Context, tenantID int, gatewayIDs []int) bool {
+	for _, id := range gatewayIDs {
+		node, err := s.nodeService.GetTenantNode(c.Request.Context(), tenantID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		if node == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Gateway node %d not found", id)})
+			return false
+		}
+	}
+	return true
+}
+
+// clientAddresses 按 clients 地址模板生成客户端地址，ID 超出模板可表示的范围时返回错误
+func (s *ClientService) clientAddresses(id int) (ipv4, ipv6 string, err error) {
+	ipv4 = strings.ReplaceAll(s.config.Clients.IPv4Template, "{client}", strconv.Itoa(id))
+	ipv6 = strings.ReplaceAll(s.config.Clients.IPv6Template, "{client}", strconv.FormatInt(int64(id), 16))
+	if addr, err := netip.ParseAddr(ipv4); err != nil || !addr.Is4() {
+		return "", "", fmt.Errorf("client address space exhausted: %s is not a valid IPv4 address", ipv4)
+	}
+	if addr, err := netip.ParseAddr(ipv6); err != nil || !addr.Is6() {
+		return "", "", fmt.Errorf("client address space exhausted: %s is not a valid IPv6 address", ipv6)
+	}
+	return ipv4, ipv6, nil
+}
+
+// updateGateways 客户端变化后重新下发网关节点的配置
+//
+// 租户设置了访问控制策略时，其他节点的防火墙规则也包含客户端地址，需要更新整个租户。
+func (s *ClientService) updateGateways(tenantID int, gatewayIDs []int) {
+	s.nodeService.notifyMeshChange()
+	if acl, err := s.nodeService.aclPolicy(tenantID); err != nil {
+		s.logger.Error().Err(err).Int("tenant_id", tenantID).Msg("Failed to load ACL policy")
+	} else if acl != nil {
+		if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+		}
+		return
+	}
+	ids := slices.Clone(gatewayIDs)
+	slices.Sort(ids)
+	s.nodeService.enqueueNodeUpdate(slices.Compact(ids)...)
+}
+
+// clientConfigFilename 客户端配置的文件名，WireGuard 客户端以文件名作为隧道名
+func clientConfigFilename(peer *types.ClientPeer) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, peer.Name)
+	return name + ".conf"
+}
+
+// gatewayClientConfig 渲染网关节点上的客户端接口配置，没有客户端时返回空字符串
+//
+// 接口不设置 Table = off，wg-quick 为客户端地址安装路由（设置了 network.routing.table 时装入 mesh 路由表），
+// babeld 按 redistribute 规则将这些路由通告到 mesh。
+func (s *ConfigService) gatewayClientConfig(node *types.NodeConfig, clients []*types.ClientPeer) string {
+	if len(clients) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", node.PrivateKey)
+	fmt.Fprintf(&b, "ListenPort = %d\n", s.config.Clients.Port)
+	if table := s.config.Network.Routing.Table; table > 0 {
+		fmt.Fprintf(&b, "Table = %d\n", table)
+	}
+	if mark := s.config.Network.Routing.FwMark; mark != 0 {
+		fmt.Fprintf(&b, "FwMark = 0x%x\n", mark)
+	}
+	for _, client := range clients {
+		fmt.Fprintf(&b, "\n# %s (client %d)\n", client.Name, client.ID)
+		b.WriteString("[Peer]\n")
+		fmt.Fprintf(&b, "PublicKey = %s\n", client.PublicKey)
+		fmt.Fprintf(&b, "AllowedIPs = %s/32, %s/128\n", client.IPv4, client.IPv6)
+	}
+	return b.String()
+}
+
+// liveClients 返回租户内已分配地址且未到期的客户端，按 ID 排序
+func (s *ConfigService) liveClients(tenantID int) ([]*types.ClientPeer, error) {
+	peers, err := s.nodeService.store.ListClientPeers(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	clients := make([]*types.ClientPeer, 0, len(peers))
+	for _, peer := range peers {
+		if peer.IPv4 != "" && !peer.Expired(now) {
+			clients = append(clients, peer)
+		}
+	}
+	return clients, nil
+}
+
+// gatewayClients 返回通过该节点接入的客户端
+func gatewayClients(node *types.NodeConfig, clients []*types.ClientPeer) []*types.ClientPeer {
+	result := make([]*types.ClientPeer, 0, len(clients))
+	for _, client := range clients {
+		if client.HasGateway(node.ID) {
+			result = append(result, client)
+		}
+	}
+	return result
+}
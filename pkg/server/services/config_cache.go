@@ -0,0 +1,114 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/metrics"
+	"mesh-backend/pkg/types"
+)
+
+var (
+	configCacheHits   = metrics.NewCounter("mesh_config_cache_hits_total", "Rendered node config cache hits")
+	configCacheMisses = metrics.NewCounter("mesh_config_cache_misses_total", "Rendered node config cache misses")
+	configCacheSize   = metrics.NewGauge("mesh_config_cache_entries", "Number of cached rendered node configs")
+)
+
+// cachedConfig 缓存的渲染结果
+type cachedConfig struct {
+	generation uint64
+	hash       string
+	validUntil time.Time // 最早到期的客户端过期时间，到期后需要重新生成，零值表示不会过期
+	config     *types.NodeConfig
+}
+
+// configCache 节点配置缓存
+//
+// 网格状态的变化都通过 notifyMeshChange 通知，此时 invalidate 清空缓存并递增代数；
+// 多副本部署时变化同时经临时状态的 mesh 频道发布，其他副本收到后清空各自的缓存。
+// 生成配置前记录代数，期间发生变化时不写入缓存，避免缓存按旧状态生成的配置。
+// 命中只需读取节点本身，不再加载连接、策略和客户端。
+type configCache struct {
+	mu         sync.RWMutex
+	generation uint64
+	entries    map[int]*cachedConfig
+}
+
+// newConfigCache 创建配置缓存
+func newConfigCache() *configCache {
+	return &configCache{entries: make(map[int]*cachedConfig)}
+}
+
+// currentGeneration 返回当前的网格状态代数，在加载生成配置所需的数据之前调用
+func (c *configCache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// get 获取缓存，节点记录的哈希不一致或客户端已到期视为未命中
+func (c *configCache) get(nodeID int, hash string, now time.Time) (*types.NodeConfig, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[nodeID]
+	ok = ok && entry.generation == c.generation && entry.hash == hash
+	c.mu.RUnlock()
+
+	if !ok || (!entry.validUntil.IsZero() && !now.Before(entry.validUntil)) {
+		configCacheMisses.Inc()
+		return nil, false
+	}
+	configCacheHits.Inc()
+	return entry.config, true
+}
+
+// put 写入缓存，generation 为开始生成时的代数，之后网格状态发生变化时丢弃
+func (c *configCache) put(nodeID int, generation uint64, hash string, validUntil time.Time, config *types.NodeConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	c.entries[nodeID] = &cachedConfig{generation: generation, hash: hash, validUntil: validUntil, config: config}
+	configCacheSize.Set(float64(len(c.entries)))
+}
+
+// invalidate 使指定节点的缓存失效，未指定节点时清空全部缓存并递增代数
+func (c *configCache) invalidate(nodeIDs ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(nodeIDs) == 0 {
+		c.generation++
+		c.entries = make(map[int]*cachedConfig)
+	} else {
+		for _, nodeID := range nodeIDs {
+			delete(c.entries, nodeID)
+		}
+	}
+	configCacheSize.Set(float64(len(c.entries)))
+}
+
+// nodeStateHash 计算节点记录中影响配置渲染的字段的哈希，只修改节点本身、未通知网格变化的更新也能使缓存失效
+func nodeStateHash(node *types.NodeConfig) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "node|%d|%d|%s|%s|%s|%s|%s|%s|%d|%d|%s|%d|%d\n",
+		node.ID, node.AddressNumber(), node.Name, node.PrivateKey, node.PublicKey, node.IPv4, node.IPv6, node.Endpoints,
+		node.MTU, node.BasePort, node.LinkLocalNet, node.BabelPort, node.BabelInterval)
+	fmt.Fprintf(h, "babel|%s|%t\n", node.BabelOptions, node.QuotaStatus.Deprioritized)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clientsValidUntil 返回最早到期的客户端的过期时间，没有会到期的客户端时返回零值
+func clientsValidUntil(clients []*types.ClientPeer) time.Time {
+	var until time.Time
+	for _, client := range clients {
+		if client.ExpiresAt != nil && (until.IsZero() || client.ExpiresAt.Before(until)) {
+			until = *client.ExpiresAt
+		}
+	}
+	return until
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrConfigRejected 生成的配置未通过检查，本次下发被拒绝
+var ErrConfigRejected = errors.New("config rejected by sanity checks")
+
+// 配置检查项
+const (
+	CheckPrivateKey = "private_key" // 私钥为空
+	CheckPort       = "port"        // 监听端口缺失、无效或在同一节点上重复
+	CheckAllowedIPs = "allowed_ips" // AllowedIPs 无效或重叠
+	CheckEndpoint   = "endpoint"    // 对端端点缺失
+	CheckRender     = "render"      // 配置生成失败
+)
+
+// ConfigIssue 配置检查发现的问题
+type ConfigIssue struct {
+	Check     string `json:"check"`
+	Interface string `json:"interface,omitempty"` // 问题所在的 WireGuard 配置，为空表示整个节点
+	Message   string `json:"message"`
+}
+
+// ConfigCheckReport 节点配置的检查结果
+type ConfigCheckReport struct {
+	NodeID    int           `json:"node_id"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Issues    []ConfigIssue `json:"issues"`
+}
+
+// OK 配置是否通过检查
+func (r *ConfigCheckReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *ConfigCheckReport) add(check, iface, format string, args ...any) {
+	r.Issues = append(r.Issues, ConfigIssue{Check: check, Interface: iface, Message: fmt.Sprintf(format, args...)})
+}
+
+// CheckNodeConfig 生成节点配置并检查，结果中的问题会导致 agent 写入无效配置或链路无法建立
+func (s *ConfigService) CheckNodeConfig(ctx context.Context, nodeID int) (*ConfigCheckReport, error) {
+	report := &ConfigCheckReport{NodeID: nodeID, CheckedAt: time.Now(), Issues: []ConfigIssue{}}
+
+	node, err := s.GenerateNodeConfig(ctx, nodeID)
+	if err != nil {
+		if _, getErr := s.nodeService.GetNode(ctx, nodeID); getErr != nil {
+			return nil, err
+		}
+		report.add(CheckRender, "", "%v", err)
+		return report, nil
+	}
+	if node.PrivateKey == "" {
+		report.add(CheckPrivateKey, "", "node has no private key")
+	}
+
+	var configs map[string]string
+	if err := json.Unmarshal([]byte(node.WireGuard), &configs); err != nil {
+		report.add(CheckRender, "", "decoding wireguard configs: %v", err)
+		return report, nil
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ports := make(map[int]string)
+	// Table 不为 off 时 wg-quick 将 AllowedIPs 写入路由表，不同接口之间也不能重叠
+	routed := make(map[string][]*net.IPNet)
+	for _, name := range names {
+		wg := parseWireGuardConfig(configs[name])
+		iface := wg.section("Interface")
+		tableOff := iface != nil && strings.EqualFold(iface.get("Table"), "off")
+
+		if iface == nil || strings.TrimSpace(iface.get("PrivateKey")) == "" {
+			report.add(CheckPrivateKey, name, "interface has no private key")
+		}
+
+		if iface != nil {
+			if raw := iface.get("ListenPort"); raw != "" {
+				port, err := strconv.Atoi(raw)
+				switch {
+				case err != nil || port <= 0 || port > 65535:
+					report.add(CheckPort, name, "invalid listen port %q", raw)
+				case ports[port] != "":
+					report.add(CheckPort, name, "listen port %d is also used by %s", port, ports[port])
+				default:
+					ports[port] = name
+				}
+			}
+		}
+
+		var prefixes []*net.IPNet
+		peers := wg.sections("Peer")
+		if len(peers) == 0 {
+			report.add(CheckEndpoint, name, "no peer section")
+		}
+		for i, peer := range peers {
+			// 客户端接口的 peer 由客户端主动连接，没有 Endpoint
+			endpoint := peer.get("Endpoint")
+			if name != types.ClientInterfaceName && (endpoint == "" || strings.HasPrefix(endpoint, "unknown:") || strings.HasPrefix(endpoint, "error:")) {
+				report.add(CheckEndpoint, name, "peer %d has no usable endpoint", i+1)
+			}
+
+			var peerPrefixes []*net.IPNet
+			for _, raw := range peer.getAll("AllowedIPs") {
+				for _, item := range strings.Split(raw, ",") {
+					item = strings.TrimSpace(item)
+					if item == "" {
+						continue
+					}
+					_, prefix, err := net.ParseCIDR(item)
+					if err != nil {
+						report.add(CheckAllowedIPs, name, "invalid allowed ip %q", item)
+						continue
+					}
+					peerPrefixes = append(peerPrefixes, prefix)
+				}
+			}
+
+			for _, prefix := range peerPrefixes {
+				// 同一接口的不同 peer 之间不能重叠，否则 WireGuard 只保留最后一个
+				for _, other := range prefixes {
+					if prefixesOverlap(prefix, other) {
+						report.add(CheckAllowedIPs, name, "allowed ip %s overlaps %s", prefix, other)
+					}
+				}
+				if !tableOff {
+					for _, otherName := range names {
+						for _, other := range routed[otherName] {
+							if prefixesOverlap(prefix, other) {
+								report.add(CheckAllowedIPs, name, "allowed ip %s overlaps %s on %s", prefix, other, otherName)
+							}
+						}
+					}
+				}
+			}
+			prefixes = append(prefixes, peerPrefixes...)
+		}
+		if !tableOff {
+			routed[name] = prefixes
+		}
+	}
+	return report, nil
+}
+
+// prefixesOverlap 两个前缀是否有交集
+func prefixesOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// wgSection WireGuard 配置中的一节，同名键可以出现多次
+type wgSection struct {
+	name   string
+	values map[string][]string
+}
+
+func (s *wgSection) get(key string) string {
+	if v := s.values[strings.ToLower(key)]; len(v) > 0 {
+		return v[len(v)-1]
+	}
+	return ""
+}
+
+func (s *wgSection) getAll(key string) []string {
+	return s.values[strings.ToLower(key)]
+}
+
+type wgConfig []*wgSection
+
+func (c wgConfig) section(name string) *wgSection {
+	for _, s := range c {
+		if strings.EqualFold(s.name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (c wgConfig) sections(name string) []*wgSection {
+	var result []*wgSection
+	for _, s := range c {
+		if strings.EqualFold(s.name, name) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// parseWireGuardConfig 按 wg-quick 的格式解析配置，键名不区分大小写
+func parseWireGuardConfig(text string) wgConfig {
+	var (
+		config  wgConfig
+		current *wgSection
+	)
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = &wgSection{name: strings.TrimSpace(line[1 : len(line)-1]), values: make(map[string][]string)}
+			config = append(config, current)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || current == nil {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		current.values[key] = append(current.values[key], strings.TrimSpace(value))
+	}
+	return config
+}
+
+// HandleCheckNodeConfig 检查节点当前生成的配置，不下发
+func (s *ConfigService) HandleCheckNodeConfig(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+	node, err := s.nodeService.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	report, err := s.CheckNodeConfig(c.Request.Context(), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RolloutProgress 配置下发进度
+type RolloutProgress struct {
+	Queued    int        `json:"queued"`     // 等待下发的节点数
+	InFlight  int        `json:"in_flight"`  // 正在下发的节点数
+	Completed int        `json:"completed"`  // 本轮已成功下发的节点数
+	Failed    int        `json:"failed"`     // 本轮下发失败的节点数
+	Rejected  int        `json:"rejected"`   // 本轮配置未通过检查、未下发的节点数
+	StartedAt *time.Time `json:"started_at"` // 本轮开始时间
+	UpdatedAt *time.Time `json:"updated_at"` // 最近一次进度更新时间
+}
+
+// 本轮中节点的下发状态
+const (
+	rolloutQueued = iota
+	rolloutInFlight
+	rolloutCompleted
+	rolloutFailed
+	rolloutRejected
+)
+
+// rolloutNode 节点在本轮中的下发进度
+type rolloutNode struct {
+	state     int
+	queuedAt  time.Time
+	updatedAt time.Time
+}
+
+// ConfigDispatcher 使用有界工作池异步下发节点配置更新
+type ConfigDispatcher struct {
+	logger  zerolog.Logger
+	workers int
+	trigger func(nodeID int) error
+
+	queue   chan int
+	pending map[int]struct{} // 已入队但尚未开始处理的节点，用于去重
+	mu      sync.Mutex
+
+	// 本轮各节点的进度，队列空闲时开始新一轮；按节点记录以便按租户统计
+	round    map[int]*rolloutNode
+	queued   int
+	inFlight int
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewConfigDispatcher 创建配置下发器
+func NewConfigDispatcher(logger zerolog.Logger, workers, queueSize int, trigger func(nodeID int) error) *ConfigDispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	return &ConfigDispatcher{
+		logger:  logger.With().Str("component", "config_dispatcher").Logger(),
+		workers: workers,
+		trigger: trigger,
+		queue:   make(chan int, queueSize),
+		pending: make(map[int]struct{}),
+		round:   make(map[int]*rolloutNode),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start 启动工作协程
+func (d *ConfigDispatcher) Start() {
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+}
+
+// Stop 停止工作协程，未处理的节点将被丢弃
+func (d *ConfigDispatcher) Stop() {
+	close(d.stopCh)
+	d.wg.Wait()
+}
+
+// Enqueue 将节点加入下发队列，已在队列中的节点会被忽略
+func (d *ConfigDispatcher) Enqueue(nodeIDs ...int) {
+	for _, nodeID := range nodeIDs {
+		d.mu.Lock()
+		if _, exists := d.pending[nodeID]; exists {
+			d.mu.Unlock()
+			continue
+		}
+		// 队列空闲时开始新一轮进度统计
+		if d.queued == 0 && d.inFlight == 0 {
+			d.round = make(map[int]*rolloutNode)
+		}
+		now := time.Now()
+		prev := d.round[nodeID]
+		d.round[nodeID] = &rolloutNode{state: rolloutQueued, queuedAt: now, updatedAt: now}
+		d.pending[nodeID] = struct{}{}
+		d.queued++
+		d.mu.Unlock()
+
+		select {
+		case d.queue <- nodeID:
+		default:
+			// 队列已满，回滚登记
+			d.mu.Lock()
+			delete(d.pending, nodeID)
+			d.queued--
+			if prev != nil {
+				d.round[nodeID] = prev
+			} else {
+				delete(d.round, nodeID)
+			}
+			d.mu.Unlock()
+			d.logger.Warn().Int("node_id", nodeID).Msg("Rollout queue full, dropping config update")
+		}
+	}
+}
+
+// Progress 返回本轮中 include 内节点的下发进度
+func (d *ConfigDispatcher) Progress(include map[int]bool) RolloutProgress {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var progress RolloutProgress
+	for nodeID, node := range d.round {
+		if !include[nodeID] {
+			continue
+		}
+		switch node.state {
+		case rolloutQueued:
+			progress.Queued++
+		case rolloutInFlight:
+			progress.InFlight++
+		case rolloutCompleted:
+			progress.Completed++
+		case rolloutFailed:
+			progress.Failed++
+		case rolloutRejected:
+			progress.Rejected++
+		}
+		if progress.StartedAt == nil || node.queuedAt.Before(*progress.StartedAt) {
+			queuedAt := node.queuedAt
+			progress.StartedAt = &queuedAt
+		}
+		if progress.UpdatedAt == nil || node.updatedAt.After(*progress.UpdatedAt) {
+			updatedAt := node.updatedAt
+			progress.UpdatedAt = &updatedAt
+		}
+	}
+	return progress
+}
+
+// worker 从队列中取出节点并触发配置更新
+func (d *ConfigDispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case nodeID := <-d.queue:
+			d.mu.Lock()
+			// 开始处理后移出去重集合，处理期间的新变更会重新入队
+			delete(d.pending, nodeID)
+			d.queued--
+			d.inFlight++
+			d.setState(nodeID, rolloutInFlight)
+			d.mu.Unlock()
+
+			err := d.trigger(nodeID)
+			if err != nil {
+				d.logger.Warn().Err(err).Int("node_id", nodeID).Msg("Failed to trigger config update for node")
+			}
+
+			d.mu.Lock()
+			d.inFlight--
+			// 处理期间节点重新入队时，保留入队状态
+			if _, requeued := d.pending[nodeID]; !requeued {
+				switch {
+				case errors.Is(err, ErrConfigRejected):
+					d.setState(nodeID, rolloutRejected)
+				case err != nil:
+					d.setState(nodeID, rolloutFailed)
+				default:
+					d.setState(nodeID, rolloutCompleted)
+				}
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// setState 更新节点在本轮中的状态，调用方需持有锁
+func (d *ConfigDispatcher) setState(nodeID, state int) {
+	node, ok := d.round[nodeID]
+	if !ok {
+		node = &rolloutNode{queuedAt: time.Now()}
+		d.round[nodeID] = node
+	}
+	node.state = state
+	node.updatedAt = time.Now()
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/metrics"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+)
+
+// maxRecentRollouts 保留的最近完成的下发记录数量
+const maxRecentRollouts = 100
+
+var (
+	configDriftedNodes   = metrics.NewGauge("mesh_config_drifted_nodes", "Number of nodes whose applied config lags behind the latest committed change")
+	configRolloutLatency = metrics.NewHistogram("mesh_config_rollout_latency_seconds",
+		"Time from a config change being committed to the affected node reporting it applied",
+		[]float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800})
+)
+
+// DriftedNode 配置落后于最新变更的节点
+type DriftedNode struct {
+	NodeID     int       `json:"node_id"`
+	Since      time.Time `json:"since"`       // 最早未应用的变更提交时间
+	LastChange time.Time `json:"last_change"` // 最近一次变更提交时间
+	Seconds    float64   `json:"seconds"`     // 已落后的时长（秒）
+}
+
+// AppliedRollout 一次完成的配置下发
+type AppliedRollout struct {
+	NodeID      int       `json:"node_id"`
+	CommittedAt time.Time `json:"committed_at"` // 最早未应用的变更提交时间
+	AppliedAt   time.Time `json:"applied_at"`   // agent 回报应用成功的时间
+	Seconds     float64   `json:"seconds"`      // 下发耗时（秒）
+}
+
+// DriftReport 配置漂移和下发耗时汇总
+type DriftReport struct {
+	Drifted []DriftedNode    `json:"drifted"` // 当前落后的节点，按落后时长降序
+	Recent  []AppliedRollout `json:"recent"`  // 最近完成的下发，按完成时间倒序
+	Latency struct {
+		Count int     `json:"count"` // 统计的下发次数
+		Avg   float64 `json:"avg"`   // 平均耗时（秒）
+		P50   float64 `json:"p50"`
+		P95   float64 `json:"p95"`
+		Max   float64 `json:"max"`
+	} `json:"latency"` // 最近完成的下发的耗时统计
+}
+
+// driftEntry 单个节点未应用的变更
+type driftEntry struct {
+	since  time.Time
+	latest time.Time
+}
+
+// DriftTracker 跟踪配置变更提交到 agent 回报应用成功之间的耗时，以及当前配置落后的节点
+//
+// 变更在加入下发队列时登记，节点的更新任务在最近一次变更之后成功完成时视为已应用。
+// agent 执行更新任务时才拉取配置，因此任务的完成时间晚于变更即说明拿到了该变更。
+// 数据只保存在内存中，多副本部署时只统计本副本提交的变更。
+type DriftTracker struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	drifted map[int]*driftEntry
+	recent  []AppliedRollout
+}
+
+// NewDriftTracker 创建配置漂移跟踪器
+func NewDriftTracker() *DriftTracker {
+	return &DriftTracker{
+		clock:   clock.Real(),
+		drifted: make(map[int]*driftEntry),
+	}
+}
+
+// SetClock 替换时间源
+func (t *DriftTracker) SetClock(c clock.Clock) {
+	t.clock = c
+}
+
+// MarkChanged 登记节点有新的配置变更等待下发
+func (t *DriftTracker) MarkChanged(nodeIDs ...int) {
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, nodeID := range nodeIDs {
+		if entry, ok := t.drifted[nodeID]; ok {
+			entry.latest = now
+			continue
+		}
+		t.drifted[nodeID] = &driftEntry{since: now, latest: now}
+	}
+	configDriftedNodes.Set(float64(len(t.drifted)))
+}
+
+// Forget 移除已删除节点的记录
+func (t *DriftTracker) Forget(nodeID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.drifted, nodeID)
+	configDriftedNodes.Set(float64(len(t.drifted)))
+}
+
+// handleUpdateDone 更新任务结束时判断节点是否已应用最新变更
+func (t *DriftTracker) handleUpdateDone(task *types.Task) {
+	if task.Status != types.TaskStatusSuccess {
+		return
+	}
+	appliedAt := t.clock.Now()
+	if task.CompletedAt != nil {
+		appliedAt = *task.CompletedAt
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.drifted[task.NodeID]
+	if !ok || appliedAt.Before(entry.latest) {
+		return
+	}
+	delete(t.drifted, task.NodeID)
+	configDriftedNodes.Set(float64(len(t.drifted)))
+
+	rollout := AppliedRollout{
+		NodeID:      task.NodeID,
+		CommittedAt: entry.since,
+		AppliedAt:   appliedAt,
+		Seconds:     appliedAt.Sub(entry.since).Seconds(),
+	}
+	configRolloutLatency.Observe(rollout.Seconds)
+	t.recent = append(t.recent, rollout)
+	if len(t.recent) > maxRecentRollouts {
+		t.recent = t.recent[len(t.recent)-maxRecentRollouts:]
+	}
+}
+
+// Report 返回指定节点范围内的漂移汇总，include 为 nil 时包含所有节点
+func (t *DriftTracker) Report(include map[int]bool) DriftReport {
+	now := t.clock.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := DriftReport{
+		Drifted: []DriftedNode{},
+		Recent:  []AppliedRollout{},
+	}
+	for nodeID, entry := range t.drifted {
+		if include != nil && !include[nodeID] {
+			continue
+		}
+		report.Drifted = append(report.Drifted, DriftedNode{
+			NodeID:     nodeID,
+			Since:      entry.since,
+			LastChange: entry.latest,
+			Seconds:    now.Sub(entry.since).Seconds(),
+		})
+	}
+	sort.Slice(report.Drifted, func(i, j int) bool {
+		return report.Drifted[i].Seconds > report.Drifted[j].Seconds
+	})
+
+	var latencies []float64
+	for i := len(t.recent) - 1; i >= 0; i-- {
+		rollout := t.recent[i]
+		if include != nil && !include[rollout.NodeID] {
+			continue
+		}
+		report.Recent = append(report.Recent, rollout)
+		latencies = append(latencies, rollout.Seconds)
+	}
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		var sum float64
+		for _, v := range latencies {
+			sum += v
+		}
+		report.Latency.Count = len(latencies)
+		report.Latency.Avg = sum / float64(len(latencies))
+		report.Latency.P50 = latencies[(len(latencies)-1)*50/100]
+		report.Latency.P95 = latencies[(len(latencies)-1)*95/100]
+		report.Latency.Max = latencies[len(latencies)-1]
+	}
+	return report
+}
@@ -1,17 +1,25 @@
 package services
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"text/template"
-	"time"
 
 	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ephemeral"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
 	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -25,6 +33,13 @@ type ConfigService struct {
 	templateMu    sync.RWMutex
 	logger        zerolog.Logger
 
+	// 渲染结果缓存
+	cache *configCache
+	clock clock.Clock
+
+	// 配置签名私钥，未启用签名时为 nil
+	signer ed25519.PrivateKey
+
 	// 服务依赖
 	nodeService *NodeService
 	taskService *TaskService
@@ -37,49 +52,168 @@ func NewConfigService(cfg *config.ServerConfig, nodeService *NodeService, logger
 		nodeService: nodeService,
 		logger:      logger.With().Str("component", "config_service").Logger(),
 		taskService: taskService,
+		cache:       newConfigCache(),
+		clock:       clock.Real(),
 	}
 
+	// 节点变更时清空本副本的缓存，并通知其他副本清空各自的缓存
+	state := taskService.state
+	nodeService.OnMeshChange(func() {
+		s.cache.invalidate()
+		if err := state.Publish(ephemeral.ChannelMesh, nil); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to publish mesh change")
+		}
+	})
+	state.Subscribe(ephemeral.ChannelMesh, func([]byte) {
+		s.cache.invalidate()
+	})
+	// 下发前检查生成的配置
+	nodeService.SetConfigCheck(s.CheckNodeConfig)
+
 	// 解析 WireGuard 模板
-	wgTmpl, err := template.New("wireguard").Parse(cfg.Templates.WireGuard)
+	wgTmpl, err := template.New("wireguard").Funcs(config.TemplateFuncs).Parse(cfg.Templates.WireGuard)
 	if err != nil {
 		return nil, fmt.Errorf("parsing wireguard template: %w", err)
 	}
 	s.wgTemplate = wgTmpl
 
 	// 解析 Babeld 模板
-	babelTmpl, err := template.New("babel").Parse(cfg.Templates.Babel)
+	babelTmpl, err := template.New("babel").Funcs(config.TemplateFuncs).Parse(cfg.Templates.Babel)
 	if err != nil {
 		return nil, fmt.Errorf("parsing babel template: %w", err)
 	}
 	s.babelTemplate = babelTmpl
 
+	if cfg.Server.ConfigSigning.Enabled {
+		if s.signer, err = loadOrCreateSigningKey(cfg.Server.ConfigSigning.Key); err != nil {
+			return nil, err
+		}
+		s.logger.Info().Str("public_key", s.signingPublicKey()).Msg("Config signing enabled")
+	}
+
 	return s, nil
 }
 
+// SetClock 替换时间源，需在处理请求之前调用
+func (s *ConfigService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
 // GenerateNodeConfig 生成节点配置
-func (s *ConfigService) GenerateNodeConfig(nodeID int) (*types.NodeConfig, error) {
+func (s *ConfigService) GenerateNodeConfig(ctx context.Context, nodeID int) (*types.NodeConfig, error) {
 	// 获取节点信息
-	node, err := s.nodeService.GetNode(nodeID)
+	node, err := s.nodeService.GetNode(ctx, nodeID)
 	if err != nil {
 		return nil, fmt.Errorf("getting node info: %w", err)
 	}
 
-	// 获取所有节点列表（用于生成peer配置）
-	nodes, err := s.nodeService.ListNodes()
+	// 网格状态未变化时直接返回缓存结果，无需加载对端、连接和策略
+	generation := s.cache.currentGeneration()
+	hash := nodeStateHash(node)
+	now := s.clock.Now()
+	if cached, ok := s.cache.get(nodeID, hash, now); ok {
+		config := *cached
+		config.UpdatedAt = now
+		return &config, nil
+	}
+
+	// 获取同租户节点列表（用于生成peer配置），不同租户的网络互不连通
+	nodes, err := s.nodeService.ListTenantNodes(ctx, node.TenantID)
 	if err != nil {
 		return nil, fmt.Errorf("list nodes: %w", err)
 	}
 
+	// 一次性获取节点与所有对等节点之间的连接
+	peerIDs := make([]int, 0, len(nodes))
+	for _, peer := range nodes {
+		if peer.ID != node.ID {
+			peerIDs = append(peerIDs, peer.ID)
+		}
+	}
+	conns, err := s.nodeService.GenerateWireguardConnections(node.ID, peerIDs, s.config.Network.BasePort)
+	if err != nil {
+		return nil, fmt.Errorf("generating wireguard connections: %w", err)
+	}
+
+	// 仅保留启用了链路的对等节点
+	peers := make([]*types.NodeConfig, 0, len(nodes))
+	for _, peer := range nodes {
+		if conn, ok := conns[peer.ID]; ok && !conn.Disabled {
+			peers = append(peers, peer)
+		}
+	}
+
+	// 附加路径随主链路启用，停用的路径不下发
+	allPaths, err := s.nodeService.connectionPaths(node.ID)
+	if err != nil {
+		return nil, fmt.Errorf("listing connection paths: %w", err)
+	}
+	paths := make(map[int][]*types.WireguardConnection, len(allPaths))
+	for _, peer := range peers {
+		for _, path := range allPaths[peer.ID] {
+			if !path.Disabled {
+				paths[peer.ID] = append(paths[peer.ID], path)
+			}
+		}
+	}
+
+	policy, _, err := s.nodeService.BabelPolicy(node.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("loading babel policy: %w", err)
+	}
+
+	tenantClients, err := s.liveClients(node.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("listing client peers: %w", err)
+	}
+	clients := gatewayClients(node, tenantClients)
+
+	tenant, err := s.nodeService.tenantSettings(node.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("loading tenant settings: %w", err)
+	}
+	firewall := s.compileFirewall(node, nodes, tenantClients, tenant.ACLPolicy)
+	bgp := s.renderBGP(node, tenant.BGP)
+	daemon := tenantRoutingDaemon(tenant)
+	settings := effectiveNetworkSettings(s.config, tenant)
+
+	// 节点 ID 超出地址池时不委派前缀，不影响其他配置
+	var delegated string
+	if prefix, ok, err := delegatedPrefix(s.config, node.AddressNumber()); err != nil {
+		s.logger.Warn().Err(err).Int("node_id", node.ID).Msg("Node has no delegated prefix")
+	} else if ok {
+		delegated = prefix.String()
+	}
+
 	// 生成WireGuard配置
-	wgConfig, err := s.generateWireGuardConfig(node, nodes)
+	wgConfig, err := s.generateWireGuardConfig(node, peers, conns, paths, *settings.Keepalive)
 	if err != nil {
 		return nil, fmt.Errorf("generating wireguard config: %w", err)
 	}
+	if conf := s.gatewayClientConfig(node, clients); conf != "" {
+		wgConfig[types.ClientInterfaceName] = conf
+	}
 
-	// 生成Babeld配置
-	babelConfig, err := s.generateBabeldConfig(node, nodes)
-	if err != nil {
-		return nil, fmt.Errorf("generating babel config: %w", err)
+	// 按租户选择的守护进程生成路由配置
+	var babelConfig, birdConfig string
+	var staticRoutes []types.StaticRoute
+	links := s.linkInterfaces(node, peers, conns, paths, settings.BabelOptions)
+	switch daemon {
+	case types.RoutingDaemonBirdBabel, types.RoutingDaemonBirdOSPF:
+		birdConfig = s.generateBirdConfig(daemon, node, links, clients)
+	case types.RoutingDaemonStatic:
+		staticRoutes = s.generateStaticRoutes(node, peers, conns, tenantClients)
+	default:
+		babelConfig, err = s.generateBabeldConfig(node, links, policy, clients, delegated)
+		if err != nil {
+			return nil, fmt.Errorf("generating babel config: %w", err)
+		}
+	}
+
+	// 节点未设置 MTU 时使用租户网络的默认值
+	mtu := node.MTU
+	if mtu == 0 {
+		mtu = settings.MTU
 	}
 
 	// 创建完整的节点配置
@@ -97,37 +231,53 @@ func (s *ConfigService) GenerateNodeConfig(nodeID int) (*types.NodeConfig, error
 		WireGuard:  string(wgConfigBytes),
 		Babel:      babelConfig,
 		// Network:   node.Network,
-		MTU:           node.MTU,
-		BasePort:      node.BasePort,
-		LinkLocalNet:  node.LinkLocalNet,
-		BabelPort:     node.BabelPort,
-		BabelInterval: node.BabelInterval,
-		CreatedAt:     node.CreatedAt,
-		UpdatedAt:     time.Now(),
+		MTU:             mtu,
+		BasePort:        node.BasePort,
+		LinkLocalNet:    node.LinkLocalNet,
+		BabelPort:       node.BabelPort,
+		BabelInterval:   node.BabelInterval,
+		Routing:         s.routingPolicy(),
+		Links:           s.linkEndpoints(node, peers, conns),
+		Firewall:        firewall,
+		DelegatedPrefix: delegated,
+		BGP:             bgp,
+		RoutingDaemon:   daemon,
+		Bird:            birdConfig,
+		StaticRoutes:    staticRoutes,
+		CreatedAt:       node.CreatedAt,
+		UpdatedAt:       now,
 	}
 
+	cached := *config
+	s.cache.put(nodeID, generation, hash, clientsValidUntil(tenantClients), &cached)
+
 	return config, nil
 }
 
-// HandleGetConfig HTTP处理器：获取节点配置
+// HandleGetConfig HTTP处理器：获取节点配置，节点只能获取自己的配置
 func (s *ConfigService) HandleGetConfig(c *gin.Context) {
 	nodeID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
 		return
 	}
+	// 配置中包含私钥和令牌，认证的节点（令牌或客户端证书绑定的节点）必须与请求的节点一致
+	if nodeID != c.GetInt("node_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Node is not allowed to access this config"})
+		return
+	}
 
-	config, err := s.GenerateNodeConfig(nodeID)
+	config, err := s.GenerateNodeConfig(c.Request.Context(), nodeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, config)
+	s.writeSignedConfig(c, config)
 }
 
-// generateWireGuardConfig 生成 WireGuard 配置
-func (s *ConfigService) generateWireGuardConfig(node *types.NodeConfig, peers []*types.NodeConfig) (map[string]string, error) {
+// generateWireGuardConfig 生成 WireGuard 配置，每条主链路和附加路径各一个接口
+func (s *ConfigService) generateWireGuardConfig(node *types.NodeConfig, peers []*types.NodeConfig, conns map[int]*types.WireguardConnection, paths map[int][]*types.WireguardConnection, keepalive int) (map[string]string, error) {
 	s.templateMu.RLock()
 	defer s.templateMu.RUnlock()
 
@@ -137,86 +287,195 @@ func (s *ConfigService) generateWireGuardConfig(node *types.NodeConfig, peers []
 			continue
 		}
 
-		wgConn, err := s.nodeService.GenerateWireguardConnection(node.ID, peer.ID, s.config.Network.BasePort)
-		if err != nil {
-			return nil, fmt.Errorf("generating wireguard connection: %w", err)
+		primary, ok := conns[peer.ID]
+		if !ok {
+			return nil, fmt.Errorf("missing wireguard connection for peer %d", peer.ID)
 		}
-
-		IPv4Address := strings.Replace(s.config.Network.IPv4Template, "{node}", fmt.Sprintf("%d", node.ID), -1)
-		IPv4Address = strings.Replace(IPv4Address, "{peer}", fmt.Sprintf("%d", peer.ID), -1)
-		IPv6Address := strings.Replace(s.config.Network.IPv6Template, "{node}", fmt.Sprintf("%d", node.ID), -1)
-		IPv6Address = strings.Replace(IPv6Address, "{peer}", fmt.Sprintf("%d", peer.ID), -1)
-
-		// 准备模板数据
-		data := struct {
-			PrivateKey  string
-			ListenPort  int
-			IPv4Address string
-			IPv6Address string
-			NodeID      int
-			Peer        struct {
-				PublicKey  string
-				AllowedIPs string
-				Endpoint   string
-				ID         int
+		for _, wgConn := range append([]*types.WireguardConnection{primary}, paths[peer.ID]...) {
+			conf, err := s.renderWireGuard(node, peer, wgConn, keepalive)
+			if err != nil {
+				return nil, err
 			}
-		}{
-			PrivateKey:  node.PrivateKey,
-			ListenPort:  wgConn.Port,
-			IPv4Address: IPv4Address,
-			IPv6Address: IPv6Address,
-			NodeID:      node.ID,
+			configs[wgConn.InterfaceName(peerInterface(s.config, peer))] = conf
 		}
+	}
+
+	return configs, nil
+}
+
+// wireGuardPeer WireGuard 模板中的对端，即 .Peer
+type wireGuardPeer struct {
+	PublicKey        string
+	AllowedIPs       string // 对端的节点地址，IPv4 和 IPv6 以逗号分隔
+	Endpoint         string // 含端口的端点，可由 joinPort .Peer.Host .Peer.Port 重新拼接
+	Host             string // 端点的主机部分，IPv6 地址不含方括号
+	Port             int
+	ID               int
+	Name             string
+	AddressIndex     int // 对端在地址规划中的编号
+	LinkLocalAddress string
+}
+
+// renderWireGuard 渲染节点在一条连接上的 WireGuard 接口配置，keepalive 为 0 时不设置 PersistentKeepalive
+func (s *ConfigService) renderWireGuard(node, peer *types.NodeConfig, wgConn *types.WireguardConnection, keepalive int) (string, error) {
+	// 地址按地址规划中的编号生成，与节点 ID 无关
+	link := config.AddressVars{Node: node.AddressNumber(), Peer: peer.AddressNumber()}
+	IPv4Address, err := config.ExpandAddress(s.config.Network.IPv4Template, link)
+	if err != nil {
+		return "", err
+	}
+	IPv6Address, err := config.ExpandAddress(s.config.Network.IPv6Template, link)
+	if err != nil {
+		return "", err
+	}
+	peerIPv4, err := config.ExpandAddress(s.config.Network.IPv4NodeTemplate, config.AddressVars{Node: peer.AddressNumber()})
+	if err != nil {
+		return "", err
+	}
+	peerIPv6, err := config.ExpandAddress(s.config.Network.IPv6NodeTemplate, config.AddressVars{Node: peer.AddressNumber()})
+	if err != nil {
+		return "", err
+	}
+	endpoint := s.formatPeerEndpoint(peer, wgConn.RemotePort(node.ID), connectionEndpoint(wgConn, node.ID, peer.ID))
+	host, _, _ := net.SplitHostPort(endpoint)
+
+	// 准备模板数据
+	data := struct {
+		PrivateKey       string
+		ListenPort       int
+		IPv4Address      string
+		IPv6Address      string
+		NodeID           int
+		AddressIndex     int    // 本端在地址规划中的编号
+		IPv4Range        string // mesh 网段，即 network.ipv4_range
+		IPv6Range        string
+		LinkLocalAddress string // 本端隧道接口的链路本地地址，含前缀长度
+		Table            string // off 或 mesh 路由表编号
+		FwMark           string // 隧道报文的防火墙标记，未设置时为空
+		Keepalive        int    // PersistentKeepalive（秒），0 表示不设置
+		Peer             wireGuardPeer
+	}{
+		PrivateKey:   node.PrivateKey,
+		ListenPort:   wgConn.ListenPort(node.ID),
+		IPv4Address:  IPv4Address,
+		IPv6Address:  IPv6Address,
+		NodeID:       node.ID,
+		AddressIndex: node.AddressNumber(),
+		IPv4Range:    s.config.Network.IPv4Range,
+		IPv6Range:    s.config.Network.IPv6Range,
+		Table:        "off",
+		Keepalive:    keepalive,
+	}
+	localLL, remoteLL := wgConn.LinkLocal(node.ID)
+	data.LinkLocalAddress = localLL
+	if table := s.config.Network.Routing.Table; table > 0 {
+		data.Table = strconv.Itoa(table)
+	}
+	if mark := s.config.Network.Routing.FwMark; mark != 0 {
+		data.FwMark = fmt.Sprintf("0x%x", mark)
+	}
+
+	// 添加对等节点信息
+	data.Peer = wireGuardPeer{
+		PublicKey:        peer.PublicKey,
+		AllowedIPs:       fmt.Sprintf("%s,%s", peerIPv4, peerIPv6),
+		Endpoint:         endpoint,
+		Host:             host,
+		Port:             wgConn.RemotePort(node.ID),
+		ID:               peer.ID,
+		Name:             peer.Name,
+		AddressIndex:     peer.AddressNumber(),
+		LinkLocalAddress: remoteLL,
+	}
+
+	// 生成配置
+	var buf strings.Builder
+	if err := s.wgTemplate.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing wireguard template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// connectionEndpoint 返回节点 nodeID 在连接上应使用的对端端点地址：附加路径使用指定的端点，
+// 主链路使用 agent 上报的当前端点；为空时使用对端的首个端点
+func connectionEndpoint(conn *types.WireguardConnection, nodeID, peerID int) string {
+	if conn.Path != 0 {
+		return conn.PathEndpoints[peerID]
+	}
+	return conn.ActiveEndpoint(nodeID)
+}
+
+// endpointHosts 解析节点的端点列表，按优先级排列，每项为 host 或 host:port
+func endpointHosts(node *types.NodeConfig) ([]string, error) {
+	var endpoints []string
+	if err := json.Unmarshal([]byte(node.Endpoints), &endpoints); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// joinEndpoint 拼接端点地址和端口，IPv6 地址加方括号，域名原样保留，由 WireGuard 在加载配置时解析
+func joinEndpoint(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
 
-		// 添加对等节点信息
-		peerData := struct {
-			PublicKey  string
-			AllowedIPs string
-			Endpoint   string
-			ID         int
-		}{
+// formatPeerEndpoint 生成对等节点的 Endpoint，优先使用 agent 上报的当前端点，否则使用对等节点的首个端点；
+// 端点自带端口时使用该端口，否则使用 port
+func (s *ConfigService) formatPeerEndpoint(peer *types.NodeConfig, port int, active string) string {
+	endpoints, err := endpointHosts(peer)
+	if err != nil {
+		s.logger.Error().Err(err).Str("endpoints", peer.Endpoints).Msg("Failed to unmarshal endpoints")
+		return fmt.Sprintf("error:%d", port)
+	}
+	if len(endpoints) == 0 {
+		s.logger.Warn().Str("endpoints", peer.Endpoints).Msg("No endpoints found")
+		return fmt.Sprintf("unknown:%d", port)
+	}
+	// 上报的端点已从对等节点的端点列表中移除时回到首个端点
+	if active != "" && slices.Contains(endpoints, active) {
+		return peerEndpoint(active, port)
+	}
+	return peerEndpoint(endpoints[0], port)
+}
+
+// linkEndpoints 生成各链路对端的候选端点列表，供 agent 故障切换使用
+func (s *ConfigService) linkEndpoints(node *types.NodeConfig, peers []*types.NodeConfig, conns map[int]*types.WireguardConnection) []types.LinkEndpoints {
+	var links []types.LinkEndpoints
+	for _, peer := range peers {
+		conn, ok := conns[peer.ID]
+		if !ok || peer.ID == node.ID {
+			continue
+		}
+		hosts, err := endpointHosts(peer)
+		if err != nil || len(hosts) == 0 {
+			continue
+		}
+		link := types.LinkEndpoints{
+			PeerID:    peer.ID,
+			Interface: peerInterface(s.config, peer),
 			PublicKey: peer.PublicKey,
-			AllowedIPs: fmt.Sprintf("%s,%s",
-				strings.Replace(s.config.Network.IPv4NodeTemplate, "{node}", fmt.Sprintf("%d", peer.ID), -1),
-				strings.Replace(s.config.Network.IPv6NodeTemplate, "{node}", fmt.Sprintf("%d", peer.ID), -1)),
-			Endpoint: func() string {
-				var endpoints []string
-				if err := json.Unmarshal([]byte(peer.Endpoints), &endpoints); err != nil {
-					s.logger.Error().Err(err).Str("endpoints", peer.Endpoints).Msg("Failed to unmarshal endpoints")
-					return fmt.Sprintf("error:%d", wgConn.Port)
-				}
-				if len(endpoints) == 0 {
-					s.logger.Warn().Str("endpoints", peer.Endpoints).Msg("No endpoints found")
-					return fmt.Sprintf("unknown:%d", wgConn.Port)
-				}
-				// 如果 endpoint 是 v4
-				if strings.Contains(endpoints[0], ".") {
-					return fmt.Sprintf("%s:%d", endpoints[0], wgConn.Port)
-				}
-				// 如果 endpoint 是 v6
-				if strings.Contains(endpoints[0], ":") {
-					return fmt.Sprintf("[%s]:%d", endpoints[0], wgConn.Port)
-				}
-				return fmt.Sprintf("%s:%d", endpoints[0], wgConn.Port)
-			}(),
-			ID: peer.ID,
+			Active:    s.formatPeerEndpoint(peer, conn.RemotePort(node.ID), conn.ActiveEndpoint(node.ID)),
 		}
-		data.Peer = peerData
-
-		// 生成配置
-		var buf strings.Builder
-		if err := s.wgTemplate.Execute(&buf, data); err != nil {
-			return nil, fmt.Errorf("executing wireguard template: %w", err)
+		for _, host := range hosts {
+			link.Endpoints = append(link.Endpoints, peerEndpoint(host, conn.RemotePort(node.ID)))
 		}
-
-		configs[peer.Name] = buf.String()
+		links = append(links, link)
 	}
+	return links
+}
 
-	return configs, nil
+// babelInterface babeld 模板中的接口
+type babelInterface struct {
+	Name          string
+	Options       string // 合并节点和链路设置后渲染的接口参数，如 type tunnel hello-interval 4
+	LinkLocal     string // 本端的链路本地地址，不含前缀长度
+	PeerLinkLocal string // 对端的链路本地地址，即 babeld 邻居地址
+	types.BabelInterfaceOptions
 }
 
 // generateBabeldConfig 生成 Babeld 配置
-func (s *ConfigService) generateBabeldConfig(node *types.NodeConfig, peers []*types.NodeConfig) (string, error) {
+func (s *ConfigService) generateBabeldConfig(node *types.NodeConfig, links []linkInterface, policy *types.BabelPolicy, clients []*types.ClientPeer, delegated string) (string, error) {
 	s.templateMu.RLock()
 	defer s.templateMu.RUnlock()
 
@@ -225,39 +484,70 @@ func (s *ConfigService) generateBabeldConfig(node *types.NodeConfig, peers []*ty
 		NodeID         int
 		Port           int
 		UpdateInterval int
-		Interfaces     []struct{ Name string }
+		Table          int // mesh 路由表编号，0 表示主路由表
+		Interfaces     []babelInterface
+		Filters        []string // 按租户过滤策略渲染的 in/out/redistribute 语句
 		IPv4Routes     []struct{ Network, PrefixLen, Metric string }
 		IPv6Routes     []struct{ Network, PrefixLen, Metric string }
 	}{
 		NodeID:         node.ID,
 		Port:           s.config.Network.BabelPort,
 		UpdateInterval: node.BabelInterval,
+		Table:          s.config.Network.Routing.Table,
 	}
 
-	// 添加接口配置
-	for _, peer := range peers {
-		if peer.ID == node.ID {
-			continue
-		}
-		data.Interfaces = append(data.Interfaces, struct{ Name string }{
-			Name: peer.Name,
+	// 添加接口配置，每条路径一个接口，babeld 按各自的开销选择路径
+	for _, link := range links {
+		data.Interfaces = append(data.Interfaces, babelInterface{
+			Name:                  link.Name,
+			Options:               link.Options.String(),
+			LinkLocal:             stripPrefixLen(link.LinkLocal),
+			PeerLinkLocal:         stripPrefixLen(link.PeerLinkLocal),
+			BabelInterfaceOptions: link.Options,
 		})
 	}
 
-	// 添加 IPv4 路由
+	// 本节点的网段，用于替换过滤规则中的占位符；IPv4Routes/IPv6Routes 保留给自定义模板使用
+	self := config.AddressVars{Node: node.AddressNumber()}
+	nodeIPv4, err := config.ExpandAddress(s.config.Network.IPv4NodeTemplate, self)
+	if err != nil {
+		return "", err
+	}
+	nodeIPv6, err := config.ExpandAddressHex(s.config.Network.IPv6NodeTemplate, self)
+	if err != nil {
+		return "", err
+	}
 	data.IPv4Routes = append(data.IPv4Routes, struct{ Network, PrefixLen, Metric string }{
-		Network:   strings.Replace(s.config.Network.IPv4NodeTemplate, "{node}", fmt.Sprintf("%d", node.ID), -1),
+		Network:   nodeIPv4,
 		PrefixLen: "32",
 		Metric:    "128",
 	})
-
-	// 添加 IPv6 路由
 	data.IPv6Routes = append(data.IPv6Routes, struct{ Network, PrefixLen, Metric string }{
-		Network:   strings.Replace(s.config.Network.IPv6NodeTemplate, "{node}", fmt.Sprintf("%x", node.ID), -1),
+		Network:   nodeIPv6,
 		PrefixLen: "80",
 		Metric:    "128",
 	})
 
+	// 通告经本节点接入的客户端地址，放在租户策略之前，不受其中 redistribute deny 规则的影响
+	for _, client := range clients {
+		data.Filters = append(data.Filters,
+			fmt.Sprintf("redistribute ip %s/32 allow", client.IPv4),
+			fmt.Sprintf("redistribute ip %s/128 allow", client.IPv6))
+	}
+
+	// 接收其他节点的委派前缀并通告本节点的委派前缀，同样不受租户策略影响
+	if delegated != "" {
+		data.Filters = append(data.Filters,
+			fmt.Sprintf("in ip %s eq %d allow", s.config.Network.Delegation.Prefix, s.config.Network.Delegation.PrefixLen),
+			fmt.Sprintf("redistribute ip %s eq %d allow", delegated, s.config.Network.Delegation.PrefixLen))
+	}
+
+	// 渲染过滤策略
+	replacer := strings.NewReplacer(types.BabelPlaceholderIPv4, nodeIPv4, types.BabelPlaceholderIPv6, nodeIPv6)
+	for _, rule := range policy.Rules {
+		data.Filters = append(data.Filters, rule.Render(replacer))
+	}
+
 	// 生成配置
 	var buf strings.Builder
 	if err := s.babelTemplate.Execute(&buf, data); err != nil {
@@ -267,8 +557,69 @@ func (s *ConfigService) generateBabeldConfig(node *types.NodeConfig, peers []*ty
 	return buf.String(), nil
 }
 
-func (s *ConfigService) RegisterRoutes(r *gin.RouterGroup) {
-	r.GET("/config/:id", s.HandleGetConfig)
+// routingPolicy 根据网络配置生成策略路由，未配置路由表时返回 nil
+//
+// 目的地址在 mesh 网段内的流量查询 mesh 路由表；启用 source_rules 时源地址在 mesh 网段内的流量
+// 也查询该表。表中没有匹配路由时内核继续匹配后续规则，不影响其他流量。
+//
+// 设置 fwmark 后，WireGuard 加密后的报文在所有 mesh 规则之前转到主路由表，
+// 避免 mesh 路由表中的默认路由或覆盖对端地址的路由把隧道报文再送回隧道。
+// 启用 default_route 时按 wg-quick 的方式添加规则：主路由表中除默认路由外的路由优先，
+// 其余未带标记的流量查询 mesh 路由表。
+func (s *ConfigService) routingPolicy() *types.RoutingPolicy {
+	routing := s.config.Network.Routing
+	if routing.Table == 0 {
+		return nil
+	}
+	policy := &types.RoutingPolicy{Table: routing.Table}
+	priority := routing.RulePriority
+
+	if routing.FwMark != 0 {
+		policy.FwMark = fmt.Sprintf("0x%x", routing.FwMark)
+		for _, ipv6 := range []bool{false, true} {
+			policy.Rules = append(policy.Rules, types.IPRule{Priority: priority - 2, FwMark: policy.FwMark, IPv6: ipv6, Table: types.RouteTableMain})
+		}
+	}
+	if routing.DefaultRoute {
+		suppress := 0
+		for _, ipv6 := range []bool{false, true} {
+			policy.Rules = append(policy.Rules, types.IPRule{Priority: priority - 1, IPv6: ipv6, Table: types.RouteTableMain, SuppressPrefixLength: &suppress})
+		}
+	}
+
+	for _, prefix := range []string{s.config.Network.IPv4Range, s.config.Network.IPv6Range} {
+		policy.Rules = append(policy.Rules, types.IPRule{Priority: priority, To: prefix, Table: routing.Table})
+		if routing.SourceRules {
+			policy.Rules = append(policy.Rules, types.IPRule{Priority: priority + 1, From: prefix, Table: routing.Table})
+		}
+	}
+
+	if routing.DefaultRoute {
+		for _, ipv6 := range []bool{false, true} {
+			policy.Rules = append(policy.Rules, types.IPRule{Priority: priority + 2, Not: true, FwMark: policy.FwMark, IPv6: ipv6, Table: routing.Table})
+		}
+	}
+	return policy
+}
+
+// RegisterRoutes 注册路由
+func (s *ConfigService) RegisterRoutes(g *RouteGroups) {
+	g.Agent.GET("/config/:id", s.HandleGetConfig)
+	g.Dashboard.GET("/config-signing-key", s.HandleGetSigningKey)
+	g.Dashboard.GET("/nodes/:id/config/check", s.HandleCheckNodeConfig)
+	g.Dashboard.GET("/babel-policy", s.HandleGetBabelPolicy)
+	g.Dashboard.PUT("/babel-policy", s.HandleUpdateBabelPolicy)
+	g.Dashboard.DELETE("/babel-policy", s.HandleResetBabelPolicy)
+	g.Dashboard.GET("/acl", s.HandleGetACLPolicy)
+	g.Dashboard.PUT("/acl", s.HandleUpdateACLPolicy)
+	g.Dashboard.DELETE("/acl", s.HandleDeleteACLPolicy)
+	g.Dashboard.GET("/bgp", s.HandleGetBGPConfig)
+	g.Dashboard.PUT("/bgp", s.HandleUpdateBGPConfig)
+	g.Dashboard.DELETE("/bgp", s.HandleDeleteBGPConfig)
+	g.Dashboard.GET("/routing-daemon", s.HandleGetRoutingDaemon)
+	g.Dashboard.PUT("/routing-daemon", s.HandleUpdateRoutingDaemon)
+	g.Dashboard.GET("/networks/:id/settings", s.HandleGetNetworkSettings)
+	g.Dashboard.PUT("/networks/:id/settings", s.HandleUpdateNetworkSettings)
 }
 
 func (s *NodeService) GenerateWireguardConnection(nodeID int, peerID int, basePort int) (*types.WireguardConnection, error) {
@@ -284,3 +635,105 @@ func (s *NodeService) GenerateWireguardConnection(nodeID int, peerID int, basePo
 
 	return connection, nil
 }
+
+// GenerateWireguardConnections 批量获取或创建节点与多个对等节点之间的连接
+//
+// 任一端设置了端口白名单的链路在白名单交集中分配端口，其余链路按 network.port_mode 分配；
+// 返回前检查启用的链路端口是否满足两端的白名单。
+func (s *NodeService) GenerateWireguardConnections(nodeID int, peerIDs []int, basePort int) (map[int]*types.WireguardConnection, error) {
+	constraints, err := s.portConstraints(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("loading port constraints: %w", err)
+	}
+
+	free := peerIDs
+	if len(constraints) > 0 {
+		var pinned []int
+		free = nil
+		for _, peerID := range peerIDs {
+			if len(constraints[nodeID]) > 0 || len(constraints[peerID]) > 0 {
+				pinned = append(pinned, peerID)
+			} else {
+				free = append(free, peerID)
+			}
+		}
+		if err := s.generateConstrainedConnections(nodeID, pinned, constraints); err != nil {
+			return nil, fmt.Errorf("allocating constrained ports: %w", err)
+		}
+	}
+
+	var conns map[int]*types.WireguardConnection
+	if s.config.Network.PortMode == PortModePair {
+		conns, err = s.generatePairConnections(nodeID, free)
+	} else {
+		conns, err = s.store.GetOrCreateWireguardConnections(nodeID, free, basePort)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get or create wireguard connections: %w", err)
+	}
+
+	if len(constraints) > 0 {
+		for _, conn := range conns {
+			if conn.Disabled {
+				continue
+			}
+			if err := checkPortConstraints(conn, constraints); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.assignLinkLocal(conns); err != nil {
+		return nil, fmt.Errorf("assigning link-local addresses: %w", err)
+	}
+	return conns, nil
+}
+
+// HandleGetBabelPolicy 返回租户的 babeld 过滤策略，default 表示租户未配置、使用默认策略
+func (s *ConfigService) HandleGetBabelPolicy(c *gin.Context) {
+	policy, custom, err := s.nodeService.BabelPolicy(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": policy.Rules, "default": !custom})
+}
+
+// HandleUpdateBabelPolicy 替换租户的 babeld 过滤策略并下发到租户内所有节点
+func (s *ConfigService) HandleUpdateBabelPolicy(c *gin.Context) {
+	var req types.BabelPolicy
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Rules == nil {
+		req.Rules = []types.BabelFilterRule{}
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.saveBabelPolicy(c, &req)
+}
+
+// HandleResetBabelPolicy 删除租户的 babeld 过滤策略，恢复默认策略
+func (s *ConfigService) HandleResetBabelPolicy(c *gin.Context) {
+	s.saveBabelPolicy(c, nil)
+}
+
+func (s *ConfigService) saveBabelPolicy(c *gin.Context, policy *types.BabelPolicy) {
+	tenantID := middleware.TenantID(c)
+	if err := s.nodeService.store.UpdateTenantBabelPolicy(tenantID, policy); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ephemeral"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+const (
+	benchWireGuardTemplate = `[Interface]
+PrivateKey = {{ .PrivateKey }}
+ListenPort = {{ .ListenPort }}
+Address = {{ .IPv4Address }}, {{ .IPv6Address }}
+Address = {{ .LinkLocalAddress }}
+Table = off
+
+[Peer]
+PublicKey = {{ .Peer.PublicKey }}
+AllowedIPs = {{ .IPv4Range }}, {{ .IPv6Range }}
+Endpoint = {{ joinPort .Peer.Host .Peer.Port }}
+{{- if .Keepalive }}
+PersistentKeepalive = {{ .Keepalive }}
+{{- end }}
+`
+	benchBabelTemplate = `local-port {{ .Port }}
+default type tunnel
+{{- range .Interfaces }}
+interface {{ .Name }} {{ .Options }}
+{{- end }}
+{{- range .Filters }}
+{{ . }}
+{{- end }}
+`
+)
+
+// testConfigServerConfig 返回使用测试模板和地址规划的服务端配置
+func testConfigServerConfig() *config.ServerConfig {
+	cfg := config.DefaultServerConfig()
+	cfg.Templates.WireGuard = benchWireGuardTemplate
+	cfg.Templates.Babel = benchBabelTemplate
+	cfg.Network.IPv4Range = "10.42.0.0/16"
+	cfg.Network.IPv6Range = "2a13:a5c7:21ff::/48"
+	cfg.Network.IPv4Template = "10.42.{node}.{peer}/32"
+	cfg.Network.IPv4NodeTemplate = "10.42.{node}.0"
+	cfg.Network.IPv6Template = "2a13:a5c7:21ff:276:{node}::{peer}/80"
+	cfg.Network.IPv6NodeTemplate = "2a13:a5c7:21ff:276:{node}::"
+	cfg.Network.LinkLocalTemplate = "fe80::{node}:{peer}/64"
+	return cfg
+}
+
+// newTestReplica 按服务端的方式在给定的存储和临时状态上组装配置服务，相当于一个服务端副本
+func newTestReplica(tb testing.TB, st store.Store, state ephemeral.State) (*ConfigService, *middleware.NodeAuthenticator) {
+	tb.Helper()
+	cfg := testConfigServerConfig()
+	logger := zerolog.Nop()
+	nodeAuth := middleware.NewNodeAuthenticator(logger, st)
+	tasks := NewTaskService(cfg, logger, st, nodeAuth, state)
+	nodes := NewNodeService(cfg, logger, st, tasks)
+	s, err := NewConfigService(cfg, nodes, logger, tasks)
+	if err != nil {
+		tb.Fatalf("NewConfigService: %v", err)
+	}
+	return s, nodeAuth
+}
+
+// createTestNodes 在存储中创建 n 个同租户节点
+func createTestNodes(tb testing.TB, st store.Store, n int) {
+	tb.Helper()
+	for i := 1; i <= n; i++ {
+		node := &types.NodeConfig{
+			Name:       fmt.Sprintf("node-%d", i),
+			Endpoints:  fmt.Sprintf(`["198.18.%d.%d"]`, i/250, i%250+1),
+			PublicKey:  fmt.Sprintf("pub-%d", i),
+			PrivateKey: fmt.Sprintf("priv-%d", i),
+			Token:      fmt.Sprintf("token-%d", i),
+		}
+		if err := st.CreateNode(node); err != nil {
+			tb.Fatalf("CreateNode: %v", err)
+		}
+	}
+}
+
+// newTestConfigService 在内存存储中创建 n 个同租户节点，返回与服务端相同方式组装的配置服务和节点认证器
+func newTestConfigService(tb testing.TB, n int) (*ConfigService, *middleware.NodeAuthenticator) {
+	tb.Helper()
+	st := store.NewMemoryStore()
+	s, nodeAuth := newTestReplica(tb, st, ephemeral.NewMemory())
+	createTestNodes(tb, st, n)
+	return s, nodeAuth
+}
+
+func TestConfigCacheInvalidatedAcrossReplicas(t *testing.T) {
+	st := store.NewMemoryStore()
+	state := ephemeral.NewMemory()
+	a, _ := newTestReplica(t, st, state)
+	b, _ := newTestReplica(t, st, state)
+	createTestNodes(t, st, 3)
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b.SetClock(fake)
+	generated, err := b.GenerateNodeConfig(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GenerateNodeConfig: %v", err)
+	}
+	if !generated.UpdatedAt.Equal(fake.Now()) {
+		t.Errorf("UpdatedAt = %v, want the replaced clock's %v", generated.UpdatedAt, fake.Now())
+	}
+	node, err := st.GetNode(1)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	hash := nodeStateHash(node)
+	if _, ok := b.cache.get(1, hash, fake.Now()); !ok {
+		t.Fatal("generated config was not cached")
+	}
+
+	// 副本 a 上的网格变化使副本 b 的缓存失效
+	a.nodeService.notifyMeshChange()
+	if _, ok := b.cache.get(1, hash, fake.Now()); ok {
+		t.Error("replica b still serves a cached config after a mesh change on replica a")
+	}
+}
+
+func TestHandleGetConfigRejectsOtherNodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, nodeAuth := newTestConfigService(t, 2)
+	router := gin.New()
+	router.GET("/agent/config/:id", nodeAuth.NodeAuth(), s.HandleGetConfig)
+
+	get := func(path string, nodeID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.SetBasicAuth(strconv.Itoa(nodeID), fmt.Sprintf("token-%d", nodeID))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/agent/config/2", 2); w.Code != http.StatusOK {
+		t.Fatalf("own config: status %d, body %s", w.Code, w.Body)
+	}
+	// 节点 2 以自己的令牌获取节点 1 的配置
+	w := get("/agent/config/1", 2)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("cross-node fetch: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if strings.Contains(w.Body.String(), "priv-1") || strings.Contains(w.Body.String(), "token-1") {
+		t.Errorf("cross-node fetch leaked node 1 secrets: %s", w.Body)
+	}
+}
+
+// BenchmarkGenerateNodeConfig 测量 1000 节点全互联网格中单个节点的配置生成延迟
+//
+// uncached 每次清空缓存，包含加载 999 条连接和 999 次 WireGuard 模板渲染；模板在创建服务时解析一次后复用。
+// cached 为网格未变化时的缓存命中。连接在计时前的首次生成中创建。
+func BenchmarkGenerateNodeConfig(b *testing.B) {
+	const meshSize = 1000
+	s, _ := newTestConfigService(b, meshSize)
+	ctx := context.Background()
+
+	generated, err := s.GenerateNodeConfig(ctx, 1)
+	if err != nil {
+		b.Fatalf("GenerateNodeConfig: %v", err)
+	}
+	if len(generated.Links) != meshSize-1 {
+		b.Fatalf("generated %d links, want %d", len(generated.Links), meshSize-1)
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.cache.invalidate()
+			if _, err := s.GenerateNodeConfig(ctx, 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.GenerateNodeConfig(ctx, 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadOrCreateSigningKey 加载配置签名私钥，文件不存在时生成并写入
+func loadOrCreateSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("generating signing key: %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("creating signing key directory: %w", err)
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			return nil, fmt.Errorf("writing signing key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key must be ed25519, got %T", parsed)
+	}
+	return key, nil
+}
+
+// signingPublicKey 返回 base64 编码的配置签名公钥，未启用签名时为空
+func (s *ConfigService) signingPublicKey() string {
+	if s.signer == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.signer.Public().(ed25519.PublicKey))
+}
+
+// writeSignedConfig 返回节点配置，响应头中附带节点 ID 和签发时间，启用签名时附带对它们和响应体的签名
+//
+// 签名覆盖完整的响应体，agent 在解码前校验，因此不依赖字段顺序等序列化细节；
+// 节点 ID 和签发时间一并签名，agent 据此拒绝其他节点的配置和比已应用配置更旧的配置。
+func (s *ConfigService) writeSignedConfig(c *gin.Context, config *types.NodeConfig) {
+	body, err := json.Marshal(config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	meta := types.ConfigMeta{NodeID: config.ID, IssuedAt: config.UpdatedAt}
+	c.Header(types.ConfigNodeHeader, strconv.Itoa(meta.NodeID))
+	c.Header(types.ConfigIssuedAtHeader, strconv.FormatInt(meta.IssuedAt.UnixNano(), 10))
+	if s.signer != nil {
+		signature := ed25519.Sign(s.signer, types.ConfigSignedMessage(meta, body))
+		c.Header(types.ConfigSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// HandleGetSigningKey 返回配置签名公钥，填入 agent 的 server.config_public_key
+func (s *ConfigService) HandleGetSigningKey(c *gin.Context) {
+	key := s.signingPublicKey()
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Config signing is not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"algorithm": "ed25519", "public_key": key})
+}
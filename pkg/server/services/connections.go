@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleListConnections 列出租户内的 WireGuard 连接，可按 node_id 过滤
+func (s *TopologyService) HandleListConnections(c *gin.Context) {
+	nodeID := 0
+	if v := c.Query("node_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+			return
+		}
+		nodeID = id
+	}
+
+	conns, err := s.ListConnections(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, conns)
+}
+
+// HandlePinConnectionPort 为链路指定固定端口，两端可以使用不同的监听端口
+func (s *TopologyService) HandlePinConnectionPort(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
+		return
+	}
+
+	var req struct {
+		Port     int `json:"port" binding:"required,min=1,max=65535"`       // NodeID 一端的监听端口
+		PeerPort int `json:"peer_port" binding:"omitempty,min=1,max=65535"` // PeerID 一端的监听端口，为空时与 port 相同
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	conn, err := s.tenantConnection(c.Request.Context(), tenantID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PeerPort == 0 {
+		req.PeerPort = req.Port
+	}
+	if conn.Port == req.Port && conn.ListenPort(conn.PeerID) == req.PeerPort {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	oldPort, oldPeerPort := conn.Port, conn.ListenPort(conn.PeerID)
+	if err := s.nodeService.PinConnectionPort(conn, req.Port, req.PeerPort); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	s.logger.Info().
+		Int("connection_id", conn.ID).
+		Int("old_port", oldPort).
+		Int("old_peer_port", oldPeerPort).
+		Int("port", req.Port).
+		Int("peer_port", req.PeerPort).
+		Msg("Pinned wireguard connection port")
+	c.Status(http.StatusNoContent)
+}
+
+// HandleUpdateConnectionBabelOptions 设置链路的 babeld 接口参数，覆盖两端节点的设置
+func (s *TopologyService) HandleUpdateConnectionBabelOptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
+		return
+	}
+
+	var req types.BabelInterfaceOptions
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	conn, err := s.tenantConnection(c.Request.Context(), tenantID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn.BabelOptions = req
+	if err := s.store.UpdateWireguardConnection(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	s.nodeService.enqueueNodeUpdate(conn.NodeID, conn.PeerID)
+	c.Status(http.StatusNoContent)
+}
+
+// HandleUpdateConnectionEndpointPorts 设置链路两端对外的端点端口，用于端口转发或 NAT 映射后
+// 对端须连接的端口与监听端口不同的情况；请求中未列出的一端恢复使用其监听端口
+func (s *TopologyService) HandleUpdateConnectionEndpointPorts(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
+		return
+	}
+
+	var req struct {
+		Ports map[int]int `json:"ports" binding:"dive,min=1,max=65535"` // 键为节点 ID
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	conn, err := s.tenantConnection(c.Request.Context(), tenantID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for nodeID := range req.Ports {
+		if nodeID != conn.NodeID && nodeID != conn.PeerID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("node %d is not part of the link", nodeID)})
+			return
+		}
+	}
+
+	conn.EndpointPorts = req.Ports
+	if err := s.store.UpdateWireguardConnection(conn); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	s.nodeService.enqueueNodeUpdate(conn.NodeID, conn.PeerID)
+	c.Status(http.StatusNoContent)
+}
+
+// HandleReportActiveEndpoint 记录 agent 故障切换后使用的对端端点
+//
+// 之后生成的配置使用该端点，避免重启 WireGuard 接口后回到不可达的端点。只更新缓存，不主动下发配置，
+// agent 已通过 wg set 切换了端点。
+func (s *TopologyService) HandleReportActiveEndpoint(c *gin.Context) {
+	nodeID := c.GetInt("node_id")
+	peerID, err := strconv.Atoi(c.Param("peer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint" binding:"required,endpoint"` // host 或 host:port
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	node, err := s.store.GetNode(nodeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	peer, err := s.nodeService.GetTenantNode(c.Request.Context(), node.TenantID, peerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if peer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Peer not found"})
+		return
+	}
+	var endpoints []string
+	_ = json.Unmarshal([]byte(peer.Endpoints), &endpoints)
+	// 端点列表中的项可能带端口，不带端口时上报的端点由其拼接连接端口生成
+	host := ""
+	for _, endpoint := range endpoints {
+		if endpoint == req.Endpoint || endpoint == endpointHost(req.Endpoint) {
+			host = endpoint
+			break
+		}
+	}
+	if host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Endpoint does not belong to peer"})
+		return
+	}
+
+	conns, err := s.store.ListWireguardConnections(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var conn *types.WireguardConnection
+	for _, candidate := range conns {
+		if candidate.Path == 0 && (candidate.NodeID == peerID || candidate.PeerID == peerID) {
+			conn = candidate
+			break
+		}
+	}
+	if conn == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+		return
+	}
+
+	previous := conn.ActiveEndpoint(nodeID)
+	if previous == host {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err := s.store.UpdateConnectionActiveEndpoint(conn.ID, nodeID, host); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.logger.Info().
+		Int("node_id", nodeID).
+		Int("peer_id", peerID).
+		Str("from", previous).
+		Str("to", host).
+		Msg("Node switched peer endpoint")
+
+	s.nodeService.notifyMeshChange()
+	c.Status(http.StatusNoContent)
+}
+
+// HandleDeleteConnection 删除连接记录以释放端口
+//
+// 删除主链路后两端节点下次生成配置时会重新分配端口；删除附加路径则移除该路径。
+func (s *TopologyService) HandleDeleteConnection(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection ID"})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	conn, err := s.tenantConnection(c.Request.Context(), tenantID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.store.DeleteWireguardConnection(conn.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 配置生成时会为每对节点重新创建主链路且默认启用，停用的链路需要立即重建并保持停用
+	if conn.Disabled && conn.Path == 0 {
+		if err := s.recreateDisabled(conn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	s.nodeService.notifyMeshChange()
+	if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	s.logger.Info().
+		Int("connection_id", conn.ID).
+		Int("node_id", conn.NodeID).
+		Int("peer_id", conn.PeerID).
+		Int("path", conn.Path).
+		Int("port", conn.Port).
+		Msg("Deleted wireguard connection")
+	c.Status(http.StatusNoContent)
+}
+
+// ListConnections 列出租户内的连接，nodeID 不为 0 时只列出该节点参与的连接
+func (s *TopologyService) ListConnections(ctx context.Context, tenantID, nodeID int) ([]*types.ConnectionInfo, error) {
+	nodes, err := s.nodeService.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	byID := make(map[int]*types.NodeConfig, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+	if nodeID != 0 && byID[nodeID] == nil {
+		return []*types.ConnectionInfo{}, nil
+	}
+
+	conns, err := s.store.ListWireguardConnections(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+
+	infos := make([]*types.ConnectionInfo, 0, len(conns))
+	for _, conn := range conns {
+		node, peer := byID[conn.NodeID], byID[conn.PeerID]
+		if node == nil || peer == nil {
+			continue
+		}
+		infos = append(infos, &types.ConnectionInfo{
+			ID:              conn.ID,
+			NodeID:          conn.NodeID,
+			NodeName:        node.Name,
+			PeerID:          conn.PeerID,
+			PeerName:        peer.Name,
+			Path:            conn.Path,
+			Port:            conn.Port,
+			PeerPort:        conn.ListenPort(conn.PeerID),
+			Enabled:         !conn.Disabled,
+			NodeLinkLocal:   conn.NodeLinkLocal,
+			PeerLinkLocal:   conn.PeerLinkLocal,
+			BabelOptions:    conn.BabelOptions,
+			ActiveEndpoints: conn.ActiveEndpoints,
+			PathEndpoints:   conn.PathEndpoints,
+			EndpointPorts:   conn.EndpointPorts,
+			CreatedAt:       conn.CreatedAt,
+			UpdatedAt:       conn.UpdatedAt,
+		})
+	}
+	return infos, nil
+}
+
+// recreateDisabled 以新端口重建已停用的连接
+func (s *TopologyService) recreateDisabled(old *types.WireguardConnection) error {
+	conns, err := s.nodeService.GenerateWireguardConnections(old.NodeID, []int{old.PeerID}, s.config.Network.BasePort)
+	if err != nil {
+		return fmt.Errorf("recreating connection %d-%d: %w", old.NodeID, old.PeerID, err)
+	}
+	conn := conns[old.PeerID]
+	conn.Disabled = true
+	if err := s.store.UpdateWireguardConnection(conn); err != nil {
+		return fmt.Errorf("disabling connection %d-%d: %w", old.NodeID, old.PeerID, err)
+	}
+	return nil
+}
+
+// tenantConnection 获取两端节点都属于租户的连接
+func (s *TopologyService) tenantConnection(ctx context.Context, tenantID, id int) (*types.WireguardConnection, error) {
+	conn, err := s.store.GetWireguardConnection(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeID := range []int{conn.NodeID, conn.PeerID} {
+		node, err := s.nodeService.GetTenantNode(ctx, tenantID, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, store.ErrNotFound
+		}
+	}
+	return conn, nil
+}
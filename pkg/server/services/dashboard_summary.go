@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// summaryTaskWindow 概览中统计任务的时间范围
+const summaryTaskWindow = 24 * time.Hour
+
+// HandleGetSummary 返回租户网格的汇总指标，供控制台概览页一次获取
+func (s *TopologyService) HandleGetSummary(c *gin.Context) {
+	summary, err := s.Summary(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// Summary 汇总租户内节点和链路的健康状况、最近的任务、资源使用率和配置漂移
+func (s *TopologyService) Summary(ctx context.Context, tenantID int) (*types.MeshSummary, error) {
+	st := s.store.WithContext(ctx)
+	nodes, err := s.nodeService.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	statuses, err := st.ListNodeStatus()
+	if err != nil {
+		return nil, fmt.Errorf("listing node statuses: %w", err)
+	}
+	conns, err := st.ListWireguardConnections(0)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+
+	include := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		include[node.ID] = true
+	}
+	byNode := make(map[int]*types.NodeStatus, len(statuses))
+	for _, status := range statuses {
+		byNode[status.NodeID] = status
+	}
+
+	now := s.clock.Now()
+	health := ComputeMeshHealth(nodes, byNode, conns, now, s.config.Status.OfflineAfter, s.config.Status.HandshakeTimeout)
+
+	summary := &types.MeshSummary{}
+	var cpu, mem float64
+	for _, h := range health.Nodes {
+		summary.Nodes.Total++
+		switch h.Health {
+		case types.NodeHealthOffline:
+			summary.Nodes.Offline++
+			continue
+		case types.NodeHealthDegraded:
+			summary.Nodes.Degraded++
+		}
+		summary.Nodes.Online++
+		cpu += byNode[h.NodeID].Metrics.CPUUsage
+		mem += byNode[h.NodeID].Metrics.MemoryUsage
+	}
+	if summary.Nodes.Online > 0 {
+		summary.AvgCPUUsage = cpu / float64(summary.Nodes.Online)
+		summary.AvgMemoryUsage = mem / float64(summary.Nodes.Online)
+	}
+
+	for _, link := range health.Links {
+		summary.Links.Total++
+		if link.Health == types.LinkHealthOneWay || link.Health == types.LinkHealthDown {
+			summary.Links.Unhealthy++
+		}
+	}
+
+	since := now.Add(-summaryTaskWindow)
+	for _, status := range []types.TaskStatus{types.TaskStatusPending, types.TaskStatusFailed} {
+		tasks, err := st.ListTasks(store.TaskFilter{Status: &status})
+		if err != nil {
+			return nil, fmt.Errorf("listing tasks: %w", err)
+		}
+		count := 0
+		for _, task := range tasks {
+			if include[task.NodeID] && !task.CreatedAt.Before(since) {
+				count++
+			}
+		}
+		if status == types.TaskStatusPending {
+			summary.Tasks.Pending = count
+		} else {
+			summary.Tasks.Failed = count
+		}
+	}
+
+	summary.DriftedNodes = len(s.nodeService.drift.Report(include).Drifted)
+	return summary, nil
+}
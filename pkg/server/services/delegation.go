@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// delegatedPrefix 计算节点的委派前缀：地址池中按 prefix_len 划分的第 index 个子网（index 为节点的地址编号），未启用前缀委派时返回 false
+func delegatedPrefix(cfg *config.ServerConfig, index int) (netip.Prefix, bool, error) {
+	delegation := cfg.Network.Delegation
+	if delegation.Prefix == "" {
+		return netip.Prefix{}, false, nil
+	}
+	pool, err := netip.ParsePrefix(delegation.Prefix)
+	if err != nil {
+		return netip.Prefix{}, false, fmt.Errorf("parsing delegation prefix: %w", err)
+	}
+
+	subnetBits := delegation.PrefixLen - pool.Bits()
+	if index <= 0 || subnetBits < 63 && uint64(index) >= 1<<subnetBits {
+		return netip.Prefix{}, false, fmt.Errorf("address index %d out of range for delegation prefix %s with /%d subnets", index, pool, delegation.PrefixLen)
+	}
+
+	// 子网编号写入地址的第 pool.Bits()+1 到 prefix_len 位
+	addr := pool.Addr().As16()
+	hi, lo := binary.BigEndian.Uint64(addr[:8]), binary.BigEndian.Uint64(addr[8:])
+	id := uint64(index)
+	switch shift := 128 - delegation.PrefixLen; {
+	case shift >= 64:
+		hi |= id << (shift - 64)
+	case shift == 0:
+		lo |= id
+	default:
+		lo |= id << shift
+		hi |= id >> (64 - shift)
+	}
+	binary.BigEndian.PutUint64(addr[:8], hi)
+	binary.BigEndian.PutUint64(addr[8:], lo)
+	return netip.PrefixFrom(netip.AddrFrom16(addr), delegation.PrefixLen), true, nil
+}
+
+// HandleGetDelegatedPrefix 返回节点的委派前缀
+func (s *NodeService) HandleGetDelegatedPrefix(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	prefix, ok, err := delegatedPrefix(s.config, node.AddressNumber())
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "IPv6 prefix delegation is not enabled"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node_id": node.ID, "name": node.Name, "prefix": prefix.String()})
+}
+
+// HandleListDelegatedPrefixes 列出租户内各节点的委派前缀，超出地址池的节点不在列表中
+func (s *NodeService) HandleListDelegatedPrefixes(c *gin.Context) {
+	if s.config.Network.Delegation.Prefix == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "IPv6 prefix delegation is not enabled"})
+		return
+	}
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	prefixes := make([]gin.H, 0, len(nodes))
+	for _, node := range nodes {
+		prefix, ok, err := delegatedPrefix(s.config, node.AddressNumber())
+		if err != nil {
+			s.logger.Warn().Err(err).Int("node_id", node.ID).Msg("Node has no delegated prefix")
+			continue
+		}
+		if ok {
+			prefixes = append(prefixes, gin.H{"node_id": node.ID, "name": node.Name, "prefix": prefix.String()})
+		}
+	}
+	c.JSON(http.StatusOK, prefixes)
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// interfaceNamePattern 合法的网络接口名称
+var interfaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// captureInfo 抓包任务信息
+type captureInfo struct {
+	TaskID      string               `json:"task_id"`
+	NodeID      int                  `json:"node_id"`
+	Status      types.TaskStatus     `json:"status"`
+	Params      types.CaptureParams  `json:"params"`
+	Result      *types.CaptureResult `json:"result,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	CompletedAt *time.Time           `json:"completed_at"`
+}
+
+// HandleStartCapture 让节点在网格接口上抓包，时长和大小受配置上限约束，过滤器只能从白名单中选择
+func (s *DiagnosticsService) HandleStartCapture(c *gin.Context) {
+	var req struct {
+		NodeID    int    `json:"node_id" binding:"required"`
+		Interface string `json:"interface" binding:"required"`
+		Filter    string `json:"filter"`    // 白名单中的过滤器名称，为空时不过滤
+		Duration  int    `json:"duration"`  // 抓包时长（秒）
+		MaxBytes  int64  `json:"max_bytes"` // 文件大小上限
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	node, err := s.tenantNode(middleware.TenantID(c), req.NodeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !interfaceNamePattern.MatchString(req.Interface) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interface name"})
+		return
+	}
+
+	limits := s.config.Diagnostics.Capture
+	filter := ""
+	if req.Filter != "" {
+		var ok bool
+		if filter, ok = limits.Filters[req.Filter]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Filter %q is not allowed", req.Filter)})
+			return
+		}
+	}
+	if req.Duration <= 0 || req.Duration > limits.MaxDuration {
+		req.Duration = limits.MaxDuration
+	}
+	if req.MaxBytes <= 0 || req.MaxBytes > limits.MaxBytes {
+		req.MaxBytes = limits.MaxBytes
+	}
+
+	task, err := s.taskService.CreateTaskWithParams(types.TaskTypeCapture, node.ID, types.CaptureParams{
+		Interface: req.Interface,
+		Filter:    filter,
+		Duration:  req.Duration,
+		MaxBytes:  req.MaxBytes,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.taskService.PushTask(task); err != nil {
+		s.taskService.CancelTask(task, "node not connected")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("node %d is not connected", node.ID)})
+		return
+	}
+
+	s.logger.Info().
+		Str("task_id", task.ID).
+		Int("node_id", node.ID).
+		Str("interface", req.Interface).
+		Str("filter", req.Filter).
+		Int("duration", req.Duration).
+		Msg("Started packet capture")
+	c.JSON(http.StatusAccepted, s.captureInfo(task))
+}
+
+// HandleListCaptures 列出租户内的抓包任务
+func (s *DiagnosticsService) HandleListCaptures(c *gin.Context) {
+	nodes, err := s.store.ListNodesByTenant(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	inTenant := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		inTenant[node.ID] = true
+	}
+
+	captureType := types.TaskTypeCapture
+	tasks, err := s.store.ListTasks(store.TaskFilter{Type: &captureType})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]*captureInfo, 0, len(tasks))
+	for _, task := range tasks {
+		if inTenant[task.NodeID] {
+			result = append(result, s.captureInfo(task))
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// HandleDownloadCapture 下载抓包文件
+func (s *DiagnosticsService) HandleDownloadCapture(c *gin.Context) {
+	task, err := s.captureTask(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Capture not found"})
+		return
+	}
+	if _, err := s.tenantNode(middleware.TenantID(c), task.NodeID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Capture not found"})
+		return
+	}
+
+	path := s.capturePath(task.ID)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Capture file not available"})
+		return
+	}
+	c.FileAttachment(path, fmt.Sprintf("node%d-%s.pcap", task.NodeID, task.ID))
+}
+
+// HandleUploadCapture 接收 agent 上传的抓包文件，只接受本节点正在执行的抓包任务
+func (s *DiagnosticsService) HandleUploadCapture(c *gin.Context) {
+	task, err := s.captureTask(c.Param("id"))
+	if err != nil || task.NodeID != c.GetInt("node_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Capture not found"})
+		return
+	}
+	if task.Status != types.TaskStatusRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": "Capture is not running"})
+		return
+	}
+
+	if err := os.MkdirAll(s.config.Diagnostics.Capture.Dir, 0o700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	path := s.capturePath(task.ID)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, s.config.Diagnostics.Capture.MaxBytes)
+	n, err := io.Copy(file, body)
+	if err != nil {
+		os.Remove(path)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Capture exceeds size limit"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.logger.Info().
+		Str("task_id", task.ID).
+		Int("node_id", task.NodeID).
+		Int64("bytes", n).
+		Msg("Received packet capture")
+	c.JSON(http.StatusOK, gin.H{"bytes": n})
+}
+
+// captureTask 获取抓包任务
+func (s *DiagnosticsService) captureTask(id string) (*types.Task, error) {
+	task, err := s.store.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if task.Type != types.TaskTypeCapture {
+		return nil, store.ErrNotFound
+	}
+	return task, nil
+}
+
+// capturePath 抓包文件路径，任务ID由服务端生成，可直接作为文件名
+func (s *DiagnosticsService) capturePath(taskID string) string {
+	return filepath.Join(s.config.Diagnostics.Capture.Dir, filepath.Base(taskID)+".pcap")
+}
+
+// captureInfo 组装抓包任务信息
+func (s *DiagnosticsService) captureInfo(task *types.Task) *captureInfo {
+	info := &captureInfo{
+		TaskID:      task.ID,
+		NodeID:      task.NodeID,
+		Status:      task.Status,
+		CreatedAt:   task.CreatedAt,
+		CompletedAt: task.CompletedAt,
+	}
+	json.Unmarshal([]byte(task.Params), &info.Params)
+	if task.Status == types.TaskStatusSuccess {
+		var result types.CaptureResult
+		if json.Unmarshal([]byte(task.Result), &result) == nil {
+			info.Result = &result
+		}
+	} else {
+		info.Error = task.Message
+	}
+	return info
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// bandwidthConnectGrace 接收端在测试时长之外额外等待发送端连接的时间（秒）
+const bandwidthConnectGrace = 30
+
+// DiagnosticsService 通过向 agent 下发诊断任务排查网格问题
+type DiagnosticsService struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+
+	// 服务依赖
+	taskService *TaskService
+
+	// 串行化吞吐量测试结果的汇总
+	bandwidthMu sync.Mutex
+
+	// 时间源，测试中可替换
+	clock clock.Clock
+}
+
+// NewDiagnosticsService 创建诊断服务实例
+func NewDiagnosticsService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, taskService *TaskService) *DiagnosticsService {
+	s := &DiagnosticsService{
+		config:      cfg,
+		logger:      logger.With().Str("service", "diagnostics").Logger(),
+		store:       store,
+		taskService: taskService,
+		clock:       clock.Real(),
+	}
+	taskService.OnTaskDone(types.TaskTypeBandwidthTest, s.handleBandwidthTaskDone)
+	return s
+}
+
+// SetClock 替换时间源
+func (s *DiagnosticsService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// RegisterRoutes 注册路由
+func (s *DiagnosticsService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.POST("/diagnostics/bandwidth", s.HandleStartBandwidthTest)
+	g.Dashboard.GET("/diagnostics/bandwidth", s.HandleListBandwidthTests)
+	g.Dashboard.GET("/diagnostics/bandwidth/:id", s.HandleGetBandwidthTest)
+	g.Dashboard.POST("/diagnostics/path", s.HandleDiagnosePath)
+	g.Dashboard.POST("/diagnostics/captures", s.HandleStartCapture)
+	g.Dashboard.GET("/diagnostics/captures", s.HandleListCaptures)
+	g.Dashboard.GET("/diagnostics/captures/:id", s.HandleDownloadCapture)
+	g.Agent.POST("/captures/:id", s.HandleUploadCapture)
+}
+
+// HandleDiagnosePath 让源节点向目标节点的网格地址执行 traceroute，等待并返回逐跳结果
+func (s *DiagnosticsService) HandleDiagnosePath(c *gin.Context) {
+	var req struct {
+		From int `json:"from" binding:"required"`
+		To   int `json:"to" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	from, err := s.tenantNode(tenantID, req.From)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := s.tenantNode(tenantID, req.To)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	task, err := s.taskService.CreateTaskWithParams(types.TaskTypeTraceroute, from.ID, types.TracerouteParams{
+		Target:  meshAddress(s.config, to.AddressNumber()),
+		MaxHops: s.config.Diagnostics.Path.MaxHops,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.taskService.PushTask(task); err != nil {
+		s.taskService.CancelTask(task, "source node not connected")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("node %d is not connected", from.ID)})
+		return
+	}
+
+	task, err = s.waitTask(c.Request.Context(), task.ID, s.config.Diagnostics.Path.Timeout)
+	if err != nil {
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error(), "task_id": task.ID})
+		return
+	}
+	if task.Status != types.TaskStatusSuccess {
+		c.JSON(http.StatusBadGateway, gin.H{"error": task.Message, "task_id": task.ID})
+		return
+	}
+
+	var result types.TracerouteResult
+	if err := json.Unmarshal([]byte(task.Result), &result); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Invalid traceroute result", "task_id": task.ID})
+		return
+	}
+	nodes, err := s.store.ListNodesByTenant(tenantID)
+	if err == nil {
+		s.annotateHops(result.Hops, nodes)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": task.ID,
+		"from":    from.ID,
+		"to":      to.ID,
+		"target":  result.Target,
+		"hops":    result.Hops,
+	})
+}
+
+// waitTask 轮询存储直到任务结束或超时，超时时返回最后读取到的任务
+func (s *DiagnosticsService) waitTask(ctx context.Context, taskID string, timeout time.Duration) (*types.Task, error) {
+	ticker := s.clock.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := s.clock.Now().Add(timeout)
+
+	for {
+		task, err := s.store.GetTask(taskID)
+		if err != nil {
+			return &types.Task{ID: taskID}, fmt.Errorf("loading task: %w", err)
+		}
+		switch task.Status {
+		case types.TaskStatusPending, types.TaskStatusRunning:
+		default:
+			return task, nil
+		}
+		if s.clock.Now().After(deadline) {
+			return task, fmt.Errorf("timed out waiting for node %d", task.NodeID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return task, ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
+
+// annotateHops 将逐跳地址对应到网格节点：节点地址，或节点与对端之间的链路地址
+func (s *DiagnosticsService) annotateHops(hops []types.TracerouteHop, nodes []*types.NodeConfig) {
+	owners := make(map[string]*types.NodeConfig, len(nodes)*len(nodes))
+	for _, node := range nodes {
+		owners[meshAddress(s.config, node.AddressNumber())] = node
+		for _, peer := range nodes {
+			if peer.ID == node.ID {
+				continue
+			}
+			addr, err := config.ExpandAddress(s.config.Network.IPv4Template, config.AddressVars{Node: node.AddressNumber(), Peer: peer.AddressNumber()})
+			if err != nil {
+				continue
+			}
+			if i := strings.IndexByte(addr, '/'); i >= 0 {
+				addr = addr[:i]
+			}
+			owners[addr] = node
+		}
+	}
+
+	for i := range hops {
+		if node, ok := owners[hops[i].Address]; ok {
+			hops[i].NodeID = node.ID
+			hops[i].NodeName = node.Name
+		}
+	}
+}
+
+// HandleStartBandwidthTest 发起两个节点之间的吞吐量测试
+func (s *DiagnosticsService) HandleStartBandwidthTest(c *gin.Context) {
+	var req struct {
+		NodeID   int `json:"node_id" binding:"required"` // 发送端
+		PeerID   int `json:"peer_id" binding:"required"` // 接收端
+		Duration int `json:"duration"`                   // 测试时长（秒）
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	sender, err := s.tenantNode(tenantID, req.NodeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	receiver, err := s.tenantNode(tenantID, req.PeerID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if sender.ID == receiver.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sender and receiver must be different nodes"})
+		return
+	}
+
+	duration := req.Duration
+	if duration <= 0 {
+		duration = s.config.Diagnostics.Bandwidth.DefaultDuration
+	}
+	if duration > s.config.Diagnostics.Bandwidth.MaxDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duration exceeds maximum of %d seconds", s.config.Diagnostics.Bandwidth.MaxDuration)})
+		return
+	}
+
+	test, err := s.StartBandwidthTest(sender, receiver, duration)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "test": test})
+		return
+	}
+	c.JSON(http.StatusAccepted, test)
+}
+
+// HandleListBandwidthTests 列出吞吐量测试结果，可按 node_id、peer_id 过滤
+func (s *DiagnosticsService) HandleListBandwidthTests(c *gin.Context) {
+	tests, err := s.store.ListBandwidthTests(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	nodeID, _ := strconv.Atoi(c.Query("node_id"))
+	peerID, _ := strconv.Atoi(c.Query("peer_id"))
+	result := make([]*types.BandwidthTest, 0, len(tests))
+	for _, test := range tests {
+		if (nodeID == 0 || test.NodeID == nodeID) && (peerID == 0 || test.PeerID == peerID) {
+			result = append(result, test)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// HandleGetBandwidthTest 获取单次吞吐量测试结果
+func (s *DiagnosticsService) HandleGetBandwidthTest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test ID"})
+		return
+	}
+	test, err := s.store.GetBandwidthTest(id)
+	if err != nil || test.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bandwidth test not found"})
+		return
+	}
+	c.JSON(http.StatusOK, test)
+}
+
+// StartBandwidthTest 创建测试记录并向接收端和发送端下发任务
+//
+// 接收端先监听端口，发送端在超时内反复尝试连接，因此两个任务的到达顺序不影响结果。
+// 任一任务无法下发时测试直接失败，已下发的任务会在超时后自行结束。
+func (s *DiagnosticsService) StartBandwidthTest(sender, receiver *types.NodeConfig, duration int) (*types.BandwidthTest, error) {
+	test := &types.BandwidthTest{
+		TenantID:  sender.TenantID,
+		NodeID:    sender.ID,
+		PeerID:    receiver.ID,
+		Duration:  duration,
+		Status:    types.TaskStatusRunning,
+		CreatedAt: s.clock.Now(),
+	}
+	if err := s.store.CreateBandwidthTest(test); err != nil {
+		return nil, fmt.Errorf("saving bandwidth test: %w", err)
+	}
+
+	params := types.BandwidthTestParams{
+		TestID:   test.ID,
+		Port:     s.config.Diagnostics.Bandwidth.Port,
+		Duration: duration,
+		Timeout:  duration + bandwidthConnectGrace,
+	}
+
+	receiverParams := params
+	receiverParams.Role = types.BandwidthRoleReceiver
+	receiverTask, err := s.taskService.CreateTaskWithParams(types.TaskTypeBandwidthTest, receiver.ID, receiverParams)
+	if err != nil {
+		return test, s.failBandwidthTest(test, err)
+	}
+	test.ReceiverTaskID = receiverTask.ID
+
+	senderParams := params
+	senderParams.Role = types.BandwidthRoleSender
+	senderParams.Address = meshAddress(s.config, receiver.AddressNumber())
+	senderTask, err := s.taskService.CreateTaskWithParams(types.TaskTypeBandwidthTest, sender.ID, senderParams)
+	if err != nil {
+		s.taskService.CancelTask(receiverTask, "bandwidth test aborted")
+		return test, s.failBandwidthTest(test, err)
+	}
+	test.SenderTaskID = senderTask.ID
+
+	if err := s.store.UpdateBandwidthTest(test); err != nil {
+		return test, fmt.Errorf("updating bandwidth test: %w", err)
+	}
+
+	for _, task := range []*types.Task{receiverTask, senderTask} {
+		if err := s.taskService.PushTask(task); err != nil {
+			s.taskService.CancelTask(receiverTask, "bandwidth test aborted")
+			s.taskService.CancelTask(senderTask, "bandwidth test aborted")
+			return test, s.failBandwidthTest(test, fmt.Errorf("node %d is not connected: %w", task.NodeID, err))
+		}
+	}
+
+	s.logger.Info().
+		Int("test_id", test.ID).
+		Int("node_id", sender.ID).
+		Int("peer_id", receiver.ID).
+		Int("duration", duration).
+		Msg("Started bandwidth test")
+	return test, nil
+}
+
+// handleBandwidthTaskDone 一端的任务结束后汇总测试结果
+//
+// 两端的回报可能同时到达，因此每次都从存储读取两端任务，两端都成功后才计算吞吐量。
+func (s *DiagnosticsService) handleBandwidthTaskDone(task *types.Task) {
+	var params types.BandwidthTestParams
+	if err := json.Unmarshal([]byte(task.Params), &params); err != nil {
+		s.logger.Error().Err(err).Str("task_id", task.ID).Msg("Invalid bandwidth test params")
+		return
+	}
+
+	s.bandwidthMu.Lock()
+	defer s.bandwidthMu.Unlock()
+
+	test, err := s.store.GetBandwidthTest(params.TestID)
+	if err != nil {
+		s.logger.Error().Err(err).Int("test_id", params.TestID).Msg("Failed to load bandwidth test")
+		return
+	}
+	if test.Status != types.TaskStatusRunning {
+		return
+	}
+
+	var results [2]types.BandwidthTestResult
+	done := true
+	for i, id := range []string{test.SenderTaskID, test.ReceiverTaskID} {
+		t, err := s.store.GetTask(id)
+		if err != nil {
+			s.failBandwidthTest(test, fmt.Errorf("loading task %s: %w", id, err))
+			return
+		}
+		switch t.Status {
+		case types.TaskStatusSuccess:
+			if err := json.Unmarshal([]byte(t.Result), &results[i]); err != nil {
+				s.failBandwidthTest(test, fmt.Errorf("invalid result from node %d: %w", t.NodeID, err))
+				return
+			}
+		case types.TaskStatusPending, types.TaskStatusRunning:
+			done = false
+		default:
+			s.failBandwidthTest(test, fmt.Errorf("node %d: %s", t.NodeID, t.Message))
+			return
+		}
+	}
+	if !done {
+		return
+	}
+
+	sent, received := results[0], results[1]
+	now := s.clock.Now()
+	test.SentBytes = sent.Bytes
+	test.ReceivedBytes = received.Bytes
+	if received.Seconds > 0 {
+		test.BitsPerSecond = float64(received.Bytes) * 8 / received.Seconds
+	}
+	test.Status = types.TaskStatusSuccess
+	test.CompletedAt = &now
+	if err := s.store.UpdateBandwidthTest(test); err != nil {
+		s.logger.Error().Err(err).Int("test_id", test.ID).Msg("Failed to save bandwidth test result")
+		return
+	}
+
+	s.logger.Info().
+		Int("test_id", test.ID).
+		Int("node_id", test.NodeID).
+		Int("peer_id", test.PeerID).
+		Float64("bits_per_second", test.BitsPerSecond).
+		Msg("Bandwidth test completed")
+}
+
+// failBandwidthTest 将测试标记为失败并返回原因
+func (s *DiagnosticsService) failBandwidthTest(test *types.BandwidthTest, cause error) error {
+	now := s.clock.Now()
+	test.Status = types.TaskStatusFailed
+	test.Error = cause.Error()
+	test.CompletedAt = &now
+	if err := s.store.UpdateBandwidthTest(test); err != nil {
+		s.logger.Error().Err(err).Int("test_id", test.ID).Msg("Failed to save bandwidth test")
+	}
+	s.logger.Warn().Err(cause).Int("test_id", test.ID).Msg("Bandwidth test failed")
+	return cause
+}
+
+// tenantNode 获取租户内的节点
+func (s *DiagnosticsService) tenantNode(tenantID, nodeID int) (*types.NodeConfig, error) {
+	node, err := s.store.GetNode(nodeID)
+	if err != nil || node.TenantID != tenantID {
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			s.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to load node")
+		}
+		return nil, fmt.Errorf("node %d not found", nodeID)
+	}
+	return node, nil
+}
+
+// meshAddress 返回地址编号为 index 的节点在网格内的 IPv4 地址，模板无法生成地址时返回空
+func meshAddress(cfg *config.ServerConfig, index int) string {
+	addr, _ := config.ExpandAddress(cfg.Network.IPv4NodeTemplate, config.AddressVars{Node: index})
+	return addr
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// endpointResolveTimeout 解析端点域名的超时时间
+const endpointResolveTimeout = 5 * time.Second
+
+// splitEndpoint 拆分端点的主机和端口，去掉 IPv6 地址的方括号，未带端口时 port 为 0
+func splitEndpoint(endpoint string) (host string, port int) {
+	if net.ParseIP(endpoint) != nil {
+		return endpoint, 0
+	}
+	h, p, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return endpoint, 0
+	}
+	port, _ = strconv.Atoi(p)
+	return h, port
+}
+
+// endpointHost 返回端点的主机部分
+func endpointHost(endpoint string) string {
+	host, _ := splitEndpoint(endpoint)
+	return host
+}
+
+// peerEndpoint 生成 WireGuard 的 Endpoint：端点自带端口时原样使用，否则拼接 port
+func peerEndpoint(endpoint string, port int) string {
+	if host, p := splitEndpoint(endpoint); p != 0 {
+		return joinEndpoint(host, p)
+	}
+	return joinEndpoint(endpoint, port)
+}
+
+// resolveEndpoint 返回端点的 IPv4 和 IPv6 地址，端点为域名时解析出首个 IPv4 和 IPv6 地址，
+// 用于创建节点时检查域名是否可用；生成的配置仍使用域名，地址变化由 agent 重新解析
+func resolveEndpoint(ctx context.Context, endpoint string) (ipv4, ipv6 string, err error) {
+	host := endpointHost(endpoint)
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			return host, "", nil
+		}
+		return "", host, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", "", fmt.Errorf("endpoint %s does not resolve: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			if ipv4 == "" {
+				ipv4 = addr.IP.String()
+			}
+		} else if ipv6 == "" {
+			ipv6 = addr.IP.String()
+		}
+	}
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", fmt.Errorf("endpoint %s has no addresses", host)
+	}
+	return ipv4, ipv6, nil
+}
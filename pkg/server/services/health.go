@@ -0,0 +1,121 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"mesh-backend/pkg/types"
+)
+
+// ComputeMeshHealth 根据各节点最近上报的状态计算节点和链路的健康状况，statuses 以节点ID为键
+//
+// 节点在 offlineAfter 内没有上报视为离线；链路一端上报的 WireGuard 最近握手超过 handshakeTimeout 视为该端失效。
+// 只有一端失效的链路说明连通是单向的，此时对端仍在线并报告握手过期的节点标记为 degraded。
+func ComputeMeshHealth(nodes []*types.NodeConfig, statuses map[int]*types.NodeStatus, conns []*types.WireguardConnection, now time.Time, offlineAfter, handshakeTimeout time.Duration) *types.MeshHealth {
+	byID := make(map[int]*types.NodeConfig, len(nodes))
+	online := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+		online[node.ID] = isOnline(statuses[node.ID], now, offlineAfter)
+	}
+
+	view := func(node, peer *types.NodeConfig) types.LinkView {
+		return handshakeView(statuses[node.ID], peer.PublicKey, now, handshakeTimeout)
+	}
+
+	health := &types.MeshHealth{
+		Nodes: make([]types.NodeHealth, 0, len(nodes)),
+		Links: make([]types.LinkHealth, 0, len(conns)),
+	}
+	stalePeers := make(map[int][]int)
+	seen := make(map[[2]int]bool, len(conns))
+	for _, conn := range conns {
+		key := pairKey(conn.NodeID, conn.PeerID)
+		node, peer := byID[key[0]], byID[key[1]]
+		if conn.Disabled || conn.Path != 0 || node == nil || peer == nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		link := types.LinkHealth{
+			NodeID:   node.ID,
+			PeerID:   peer.ID,
+			NodeView: view(node, peer),
+			PeerView: view(peer, node),
+		}
+		switch {
+		case !online[node.ID] || !online[peer.ID]:
+			link.Health = types.LinkHealthUnknown
+		case link.NodeView.Fresh && link.PeerView.Fresh:
+			link.Health = types.LinkHealthUp
+		case link.NodeView.Fresh || link.PeerView.Fresh:
+			link.Health = types.LinkHealthOneWay
+		default:
+			link.Health = types.LinkHealthDown
+		}
+		health.Links = append(health.Links, link)
+
+		if online[node.ID] && online[peer.ID] {
+			if !link.PeerView.Fresh {
+				stalePeers[node.ID] = append(stalePeers[node.ID], peer.ID)
+			}
+			if !link.NodeView.Fresh {
+				stalePeers[peer.ID] = append(stalePeers[peer.ID], node.ID)
+			}
+		}
+	}
+	sort.Slice(health.Links, func(i, j int) bool {
+		if health.Links[i].NodeID != health.Links[j].NodeID {
+			return health.Links[i].NodeID < health.Links[j].NodeID
+		}
+		return health.Links[i].PeerID < health.Links[j].PeerID
+	})
+
+	for _, node := range nodes {
+		h := types.NodeHealth{
+			NodeID: node.ID,
+			Name:   node.Name,
+			Health: types.NodeHealthOffline,
+		}
+		if status := statuses[node.ID]; status != nil {
+			lastSeen := status.Timestamp
+			h.LastSeen = &lastSeen
+		}
+		if online[node.ID] {
+			h.Health = types.NodeHealthOnline
+			if peers := stalePeers[node.ID]; len(peers) > 0 {
+				sort.Ints(peers)
+				h.Health = types.NodeHealthDegraded
+				h.StalePeers = peers
+			}
+		}
+		health.Nodes = append(health.Nodes, h)
+	}
+	sort.Slice(health.Nodes, func(i, j int) bool { return health.Nodes[i].NodeID < health.Nodes[j].NodeID })
+
+	return health
+}
+
+// handshakeView 返回节点状态中与指定公钥的对等节点之间的握手情况
+func handshakeView(status *types.NodeStatus, publicKey string, now time.Time, handshakeTimeout time.Duration) types.LinkView {
+	var v types.LinkView
+	if status == nil {
+		return v
+	}
+	for _, p := range status.WireGuard.Peers {
+		if p.PublicKey != publicKey {
+			continue
+		}
+		v.Reported = true
+		if p.LatestHandshake != nil && (v.LatestHandshake == nil || p.LatestHandshake.After(*v.LatestHandshake)) {
+			v.LatestHandshake = p.LatestHandshake
+		}
+	}
+	v.Fresh = v.LatestHandshake != nil && now.Sub(*v.LatestHandshake) <= handshakeTimeout
+	return v
+}
+
+// isOnline 节点是否在 offlineAfter 内上报过状态
+func isOnline(status *types.NodeStatus, now time.Time, offlineAfter time.Duration) bool {
+	return status != nil && now.Sub(status.Timestamp) <= offlineAfter
+}
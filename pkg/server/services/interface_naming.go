@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 对端接口名的生成方式
+const (
+	InterfaceNamingName = "name" // 使用对端节点名
+	InterfaceNamingID   = "id"   // 使用对端节点 ID，重命名节点不影响接口
+	InterfaceNamingHash = "hash" // 使用对端节点名摘要的前 8 位
+)
+
+// maxInterfaceNameLen Linux 网络接口名的最大长度（IFNAMSIZ - 1）
+const maxInterfaceNameLen = 15
+
+// peerInterface 返回节点上指向 peer 的主链路接口名（不含前缀），附加路径在此基础上追加路径编号
+func peerInterface(cfg *config.ServerConfig, peer *types.NodeConfig) string {
+	switch cfg.Network.InterfaceNaming {
+	case InterfaceNamingID:
+		return strconv.Itoa(peer.ID)
+	case InterfaceNamingHash:
+		return config.ShortHash(peer.Name)
+	}
+	return peer.Name
+}
+
+// validateInterfaceName 检查加上 agent 前缀后的接口名是否为合法的 Linux 接口名
+func validateInterfaceName(cfg *config.ServerConfig, name string) error {
+	full := cfg.Network.InterfacePrefix + name
+	if len(full) > maxInterfaceNameLen {
+		return fmt.Errorf("interface name %s exceeds %d characters, use a shorter node name or network.interface_naming id/hash", full, maxInterfaceNameLen)
+	}
+	if !interfaceNamePattern.MatchString(full) {
+		return fmt.Errorf("interface name %s contains invalid characters", full)
+	}
+	return nil
+}
+
+// checkNodeInterfaces 检查新建或改名的节点作为对端时的接口名：长度和字符合法，且不与租户内其他节点及彼此冲突
+//
+// 节点已有附加路径时，带路径编号的接口名也一并检查。id 方式下节点 ID 全局唯一，不会冲突，只检查长度。
+func (s *NodeService) checkNodeInterfaces(ctx context.Context, tenantID int, candidates ...*types.NodeConfig) error {
+	conns, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return err
+	}
+	pathsOf := make(map[int][]*types.WireguardConnection)
+	for _, conn := range conns {
+		if conn.Path > 0 {
+			pathsOf[conn.NodeID] = append(pathsOf[conn.NodeID], conn)
+			pathsOf[conn.PeerID] = append(pathsOf[conn.PeerID], conn)
+		}
+	}
+	interfaceNames := func(node *types.NodeConfig) []string {
+		base := peerInterface(s.config, node)
+		names := []string{base}
+		for _, conn := range pathsOf[node.ID] {
+			names = append(names, conn.InterfaceName(base))
+		}
+		return names
+	}
+
+	// 已占用的接口名到占用者的描述
+	taken := map[string]string{types.ClientInterfaceName: "the client interface"}
+	if s.config.Network.InterfaceNaming != InterfaceNamingID {
+		nodes, err := s.ListTenantNodes(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if slices.ContainsFunc(candidates, func(c *types.NodeConfig) bool { return c.ID == node.ID }) {
+				continue
+			}
+			for _, name := range interfaceNames(node) {
+				taken[name] = fmt.Sprintf("node %d (%s)", node.ID, node.Name)
+			}
+		}
+	}
+
+	for _, node := range candidates {
+		names := interfaceNames(node)
+		for _, name := range names {
+			if err := validateInterfaceName(s.config, name); err != nil {
+				return fmt.Errorf("node %s: %w", node.Name, err)
+			}
+			if owner, ok := taken[name]; ok {
+				return fmt.Errorf("node %s: interface name %s conflicts with %s", node.Name, name, owner)
+			}
+		}
+		if s.config.Network.InterfaceNaming != InterfaceNamingID {
+			for _, name := range names {
+				taken[name] = fmt.Sprintf("node %s", node.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// errNameConflict 新节点名与租户内其他节点或接口名冲突
+var errNameConflict = errors.New("name conflict")
+
+// checkNodeRename 检查节点能否改名为 name：新名称不能与租户内其他节点重复，生成的接口名不能与其他节点或附加路径的接口名冲突。
+// 冲突时返回的错误包装 errNameConflict
+func (s *NodeService) checkNodeRename(ctx context.Context, node *types.NodeConfig, name string) error {
+	nodes, err := s.ListTenantNodes(ctx, node.TenantID)
+	if err != nil {
+		return err
+	}
+	for _, other := range nodes {
+		if other.ID != node.ID && other.Name == name {
+			return fmt.Errorf("%w: node %d is already named %s", errNameConflict, other.ID, name)
+		}
+	}
+	renamed := *node
+	renamed.Name = name
+	if err := s.checkNodeInterfaces(ctx, node.TenantID, &renamed); err != nil {
+		return fmt.Errorf("%w: %v", errNameConflict, err)
+	}
+	return nil
+}
+
+// HandleRenameNode 重命名节点
+//
+// 接口名由节点名生成时（name、hash），其他节点上指向它的接口随之改名：对端的 agent 先停用旧接口再以相同端口启用新接口，
+// 期间该链路短暂中断。
+func (s *NodeService) HandleRenameNode(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required,name"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Name == types.ClientInterfaceName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("节点名称 %s 为保留名称", req.Name)})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	node, err := s.GetTenantNode(c.Request.Context(), tenantID, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	if node.Name == req.Name {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if err := s.checkNodeRename(c.Request.Context(), node, req.Name); err != nil {
+		if errors.Is(err, errNameConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.store.UpdateNodeName(nodeID, req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.notifyMeshChange()
+	if s.config.Network.InterfaceNaming != InterfaceNamingID {
+		if err := s.enqueueMeshUpdate(tenantID); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+		}
+	} else {
+		s.enqueueNodeUpdate(nodeID)
+	}
+
+	s.logger.Info().
+		Int("node_id", nodeID).
+		Str("old_name", node.Name).
+		Str("name", req.Name).
+		Msg("Renamed node")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/rs/zerolog"
+)
+
+// Janitor 按保留策略定期清理过期的任务和节点状态，以及已删除节点遗留的数据
+type Janitor struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+	clock  clock.Clock
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewJanitor 创建清理服务实例
+func NewJanitor(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store) *Janitor {
+	return &Janitor{
+		config: cfg,
+		logger: logger.With().Str("service", "janitor").Logger(),
+		store:  store,
+		clock:  clock.Real(),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// SetClock 替换时间源，需在服务启动前调用
+func (j *Janitor) SetClock(c clock.Clock) {
+	j.clock = c
+}
+
+// Start 启动清理协程，启动时立即执行一次
+func (j *Janitor) Start() {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := j.clock.NewTicker(j.config.Retention.Interval)
+		defer ticker.Stop()
+
+		j.Run()
+		for {
+			select {
+			case <-j.stopCh:
+				return
+			case <-ticker.C():
+				j.Run()
+			}
+		}
+	}()
+}
+
+// Stop 停止清理协程
+func (j *Janitor) Stop() {
+	close(j.stopCh)
+	j.wg.Wait()
+}
+
+// Run 执行一次清理
+func (j *Janitor) Run() {
+	retention := j.config.Retention
+	now := j.clock.Now()
+
+	tasks := []struct {
+		status    types.TaskStatus
+		retention time.Duration
+	}{
+		{types.TaskStatusSuccess, retention.TaskSuccess},
+		{types.TaskStatusCanceled, retention.TaskCanceled},
+		{types.TaskStatusFailed, retention.TaskFailed},
+		{types.TaskStatusDeadLetter, retention.TaskDeadLetter},
+	}
+	for _, t := range tasks {
+		if t.retention <= 0 {
+			continue
+		}
+		deleted, err := j.store.CleanupTasks(t.status, now.Add(-t.retention))
+		if err != nil {
+			j.logger.Error().Err(err).Str("status", string(t.status)).Msg("Failed to clean up tasks")
+			continue
+		}
+		if deleted > 0 {
+			j.logger.Info().
+				Str("status", string(t.status)).
+				Int64("deleted", deleted).
+				Msg("Cleaned up expired tasks")
+		}
+	}
+
+	if retention.NodeStatus > 0 {
+		deleted, err := j.store.CleanupNodeStatuses(now.Add(-retention.NodeStatus))
+		if err != nil {
+			j.logger.Error().Err(err).Msg("Failed to clean up node statuses")
+		} else if deleted > 0 {
+			j.logger.Info().Int64("deleted", deleted).Msg("Cleaned up stale node statuses")
+		}
+	}
+
+	if retention.TrafficUsage > 0 {
+		before := now.Add(-retention.TrafficUsage).UTC().Format(types.UsageDateLayout)
+		deleted, err := j.store.CleanupTrafficUsage(before)
+		if err != nil {
+			j.logger.Error().Err(err).Msg("Failed to clean up traffic usage")
+		} else if deleted > 0 {
+			j.logger.Info().Int64("deleted", deleted).Msg("Cleaned up old traffic usage")
+		}
+	}
+
+	j.purgeOrphans()
+}
+
+// purgeOrphans 清除已删除节点遗留的数据，如删除节点时清除失败或升级前删除的节点
+func (j *Janitor) purgeOrphans() {
+	nodes, err := j.store.ListNodes()
+	if err != nil {
+		j.logger.Error().Err(err).Msg("Failed to list nodes for orphan cleanup")
+		return
+	}
+	statuses, err := j.store.ListNodeStatus()
+	if err != nil {
+		j.logger.Error().Err(err).Msg("Failed to list node statuses for orphan cleanup")
+		return
+	}
+	tasks, err := j.store.ListTasks(store.TaskFilter{})
+	if err != nil {
+		j.logger.Error().Err(err).Msg("Failed to list tasks for orphan cleanup")
+		return
+	}
+
+	exists := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		exists[node.ID] = true
+	}
+	orphans := make(map[int]bool)
+	for _, status := range statuses {
+		if !exists[status.NodeID] {
+			orphans[status.NodeID] = true
+		}
+	}
+	for _, task := range tasks {
+		if !exists[task.NodeID] {
+			orphans[task.NodeID] = true
+		}
+	}
+
+	for nodeID := range orphans {
+		deleted, err := j.store.PurgeNodeData(nodeID)
+		if err != nil {
+			j.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to purge orphaned node data")
+			continue
+		}
+		if deleted > 0 {
+			j.logger.Info().Int("node_id", nodeID).Int64("deleted", deleted).Msg("Purged data of deleted node")
+		}
+	}
+}
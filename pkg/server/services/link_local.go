@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/types"
+)
+
+// deriveLinkLocal 按模板生成节点 nodeID 在与 peerID 的隧道上使用的链路本地地址
+//
+// 模板中的 {node}、{peer} 替换为节点 ID 的十六进制形式（Go 模板中为 {{ printf "%x" .Node }}），每个占位符占一个 16 位分组，
+// 因此节点 ID 不能超过 0xffff。同一节点对的两端交换 node 和 peer，地址互不相同。
+func deriveLinkLocal(template string, nodeID, peerID int) (string, error) {
+	if nodeID <= 0 || nodeID > 0xffff || peerID <= 0 || peerID > 0xffff {
+		return "", fmt.Errorf("node pair %d-%d out of link-local range", nodeID, peerID)
+	}
+	addr, err := config.ExpandAddressHex(template, config.AddressVars{Node: nodeID, Peer: peerID})
+	if err != nil {
+		return "", err
+	}
+
+	ip, _, err := net.ParseCIDR(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid link-local address %q: %w", addr, err)
+	}
+	if !ip.IsLinkLocalUnicast() || ip.To4() != nil {
+		return "", fmt.Errorf("%s is not an IPv6 link-local address", addr)
+	}
+	return addr, nil
+}
+
+// assignLinkLocal 为尚未分配链路本地地址的连接生成并保存两端地址
+//
+// 地址保存后不随模板变化，修改 network.link_local_template 只影响新建的连接。
+func (s *NodeService) assignLinkLocal(conns map[int]*types.WireguardConnection) error {
+	for _, conn := range conns {
+		if conn.NodeLinkLocal != "" && conn.PeerLinkLocal != "" {
+			continue
+		}
+		nodeAddr, err := deriveLinkLocal(s.config.Network.LinkLocalTemplate, conn.NodeID, conn.PeerID)
+		if err != nil {
+			return err
+		}
+		peerAddr, err := deriveLinkLocal(s.config.Network.LinkLocalTemplate, conn.PeerID, conn.NodeID)
+		if err != nil {
+			return err
+		}
+		if err := s.store.UpdateConnectionLinkLocal(conn.ID, nodeAddr, peerAddr); err != nil {
+			return err
+		}
+		conn.NodeLinkLocal, conn.PeerLinkLocal = nodeAddr, peerAddr
+	}
+	return nil
+}
+
+// stripPrefixLen 去掉地址中的前缀长度
+func stripPrefixLen(addr string) string {
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		return addr[:i]
+	}
+	return addr
+}
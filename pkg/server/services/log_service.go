@@ -0,0 +1,179 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "mesh-backend/api/proto/logs"
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LogService 接收 agent 上传的日志，在内存中为每个节点保留最近的日志
+type LogService struct {
+	pb.UnimplementedLogServiceServer
+
+	config   *config.ServerConfig
+	logger   zerolog.Logger
+	store    store.Store
+	nodeAuth *middleware.NodeAuthenticator
+
+	mu      sync.RWMutex
+	buffers map[int]*logRing
+}
+
+// nodeLogEntry 节点日志
+type nodeLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Source    string    `json:"source"`
+	Message   string    `json:"message"`
+	Fields    string    `json:"fields,omitempty"`
+}
+
+// logRing 固定容量的日志环形缓冲
+type logRing struct {
+	entries []nodeLogEntry
+	next    int
+	full    bool
+}
+
+func (r *logRing) add(entry nodeLogEntry) {
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list 按时间顺序返回缓冲中的日志
+func (r *logRing) list() []nodeLogEntry {
+	if !r.full {
+		return append([]nodeLogEntry(nil), r.entries[:r.next]...)
+	}
+	return append(append([]nodeLogEntry(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// NewLogService 创建日志服务实例
+func NewLogService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeAuth *middleware.NodeAuthenticator) *LogService {
+	return &LogService{
+		config:   cfg,
+		logger:   logger.With().Str("service", "logs").Logger(),
+		store:    store,
+		nodeAuth: nodeAuth,
+		buffers:  make(map[int]*logRing),
+	}
+}
+
+// RegisterGRPC 注册gRPC服务
+func (s *LogService) RegisterGRPC(server *grpc.Server) {
+	pb.RegisterLogServiceServer(server, s)
+}
+
+// RegisterRoutes 注册路由
+func (s *LogService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.GET("/nodes/:id/logs", s.HandleGetNodeLogs)
+}
+
+// ShipLogs 接收 agent 持续上传的日志
+func (s *LogService) ShipLogs(stream pb.LogService_ShipLogsServer) error {
+	var (
+		nodeID   int32
+		received int64
+	)
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.ShipLogsResponse{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+
+		// 首批日志验证身份，之后的批次必须来自同一节点
+		if nodeID == 0 {
+			if !s.nodeAuth.ValidateCredentials(stream.Context(), int(batch.NodeId), batch.Token) {
+				return status.Error(codes.Unauthenticated, "invalid credentials")
+			}
+			nodeID = batch.NodeId
+		} else if batch.NodeId != nodeID {
+			return status.Error(codes.PermissionDenied, "node id changed within stream")
+		}
+
+		s.append(int(nodeID), batch.Entries)
+		received += int64(len(batch.Entries))
+	}
+}
+
+// append 将日志加入节点的缓冲
+func (s *LogService) append(nodeID int, entries []*pb.LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ring, ok := s.buffers[nodeID]
+	if !ok {
+		ring = &logRing{entries: make([]nodeLogEntry, s.config.NodeLogs.BufferSize)}
+		s.buffers[nodeID] = ring
+	}
+	for _, entry := range entries {
+		ring.add(nodeLogEntry{
+			Timestamp: time.Unix(0, entry.Timestamp),
+			Level:     entry.Level,
+			Source:    entry.Source,
+			Message:   entry.Message,
+			Fields:    entry.Fields,
+		})
+	}
+}
+
+// Forget 丢弃已删除节点的日志缓冲
+func (s *LogService) Forget(nodeID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buffers, nodeID)
+}
+
+// HandleGetNodeLogs 返回节点最近上传的日志，可按 source、level 过滤，limit 限制返回最新的条数
+func (s *LogService) HandleGetNodeLogs(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+	node, err := s.store.GetNode(nodeID)
+	if err != nil || node.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	source := c.Query("source")
+	level := c.Query("level")
+
+	s.mu.RLock()
+	var entries []nodeLogEntry
+	if ring, ok := s.buffers[nodeID]; ok {
+		entries = ring.list()
+	}
+	s.mu.RUnlock()
+
+	result := make([]nodeLogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if (source == "" || entry.Source == source) && (level == "" || entry.Level == level) {
+			result = append(result, entry)
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenancePolicy 返回租户的维护窗口，租户未设置时返回全局设置，custom 为 false
+func (s *TaskService) maintenancePolicy(tenantID int) (policy *types.MaintenancePolicy, custom bool, err error) {
+	tenant, err := s.store.GetTenant(tenantID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, false, err
+	}
+	if tenant == nil || tenant.MaintenancePolicy == nil {
+		return &s.config.Rollout.Maintenance, false, nil
+	}
+	return tenant.MaintenancePolicy, true, nil
+}
+
+// nextMaintenanceWindow 返回节点最早可以下发配置的时间，now 在维护窗口内时返回 now
+//
+// 读取节点或租户失败时不推迟，避免存储故障阻塞下发。
+func (s *TaskService) nextMaintenanceWindow(nodeID int, now time.Time) time.Time {
+	node, err := s.store.GetNode(nodeID)
+	if err != nil {
+		return now
+	}
+	policy, _, err := s.maintenancePolicy(node.TenantID)
+	if err != nil {
+		s.logger.Warn().Err(err).Int("node_id", nodeID).Msg("Failed to load maintenance policy")
+		return now
+	}
+	return policy.NextOpen(now)
+}
+
+// rearmDeferred 维护窗口变化后按新的窗口重新安排推迟的配置更新
+func (s *TaskService) rearmDeferred() {
+	s.pendingMu.Lock()
+	nodeIDs := make([]int, 0, len(s.pendingUpdates))
+	for nodeID := range s.pendingUpdates {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	s.pendingMu.Unlock()
+
+	now := s.clock.Now()
+	for _, nodeID := range nodeIDs {
+		nodeID := nodeID
+		s.clock.AfterFunc(s.nextMaintenanceWindow(nodeID, now).Sub(now), func() {
+			s.flushPendingUpdate(nodeID)
+		})
+	}
+}
+
+// HandleGetMaintenancePolicy 返回租户的维护窗口和下一次可以下发的时间，default 表示租户未设置、使用全局设置
+func (s *TaskService) HandleGetMaintenancePolicy(c *gin.Context) {
+	policy, custom, err := s.maintenancePolicy(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	windows := policy.Windows
+	if windows == nil {
+		windows = []types.MaintenanceWindow{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"timezone":  policy.Timezone,
+		"windows":   windows,
+		"default":   !custom,
+		"next_open": policy.NextOpen(s.clock.Now()),
+	})
+}
+
+// HandleUpdateMaintenancePolicy 替换租户的维护窗口
+func (s *TaskService) HandleUpdateMaintenancePolicy(c *gin.Context) {
+	var req types.MaintenancePolicy
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Windows == nil {
+		req.Windows = []types.MaintenanceWindow{}
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.saveMaintenancePolicy(c, &req)
+}
+
+// HandleResetMaintenancePolicy 删除租户的维护窗口，恢复全局设置
+func (s *TaskService) HandleResetMaintenancePolicy(c *gin.Context) {
+	s.saveMaintenancePolicy(c, nil)
+}
+
+func (s *TaskService) saveMaintenancePolicy(c *gin.Context, policy *types.MaintenancePolicy) {
+	tenantID := middleware.TenantID(c)
+	if err := s.store.UpdateTenantMaintenancePolicy(tenantID, policy); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.rearmDeferred()
+	s.logger.Info().Int("tenant_id", tenantID).Bool("default", policy == nil).Msg("Updated maintenance policy")
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleCreateConnectionPath 在节点对之间添加附加路径
+//
+// 附加路径与主链路使用不同的端口和端点，各自有独立的 babeld 接口参数（如 rxcost），
+// babeld 优先选择开销低的路径，路径中断时切换到其他路径。
+func (s *TopologyService) HandleCreateConnectionPath(c *gin.Context) {
+	var req struct {
+		NodeID       int                         `json:"node_id" binding:"required"`
+		PeerID       int                         `json:"peer_id" binding:"required"`
+		Port         int                         `json:"port"`                              // 为 0 时自动分配
+		PeerPort     int                         `json:"peer_port"`                         // PeerID 一端的监听端口，为 0 时与 port 相同
+		Endpoints    map[int]string              `json:"endpoints" binding:"dive,endpoint"` // 两端使用的端点，键为节点 ID
+		BabelOptions types.BabelInterfaceOptions `json:"babel_options"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.NodeID == req.PeerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "node_id and peer_id must differ"})
+		return
+	}
+	if err := req.BabelOptions.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	nodes := make(map[int]*types.NodeConfig, 2)
+	for _, id := range []int{req.NodeID, req.PeerID} {
+		node, err := s.nodeService.GetTenantNode(c.Request.Context(), tenantID, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if node == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Node %d not found", id)})
+			return
+		}
+		nodes[id] = node
+	}
+	for id, host := range req.Endpoints {
+		node, ok := nodes[id]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("endpoint for node %d, which is not part of the link", id)})
+			return
+		}
+		hosts, _ := endpointHosts(node)
+		if !slices.Contains(hosts, host) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("endpoint %s does not belong to node %d", host, id)})
+			return
+		}
+	}
+
+	// 附加路径与主链路一起下发，先确保主链路存在
+	if _, err := s.nodeService.GenerateWireguardConnections(req.NodeID, []int{req.PeerID}, s.config.Network.BasePort); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	paths, err := s.nodeService.connectionPaths(req.NodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	conn := &types.WireguardConnection{
+		NodeID:        req.NodeID,
+		PeerID:        req.PeerID,
+		Path:          1,
+		PathEndpoints: req.Endpoints,
+		BabelOptions:  req.BabelOptions,
+	}
+	if existing := paths[req.PeerID]; len(existing) > 0 {
+		conn.Path = existing[len(existing)-1].Path + 1
+	}
+	if err := s.nodeService.checkInterfaceName(c.Request.Context(), tenantID, conn.InterfaceName(peerInterface(s.config, nodes[req.PeerID])), conn.InterfaceName(peerInterface(s.config, nodes[req.NodeID]))); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Port == 0 {
+		conn.Port, err = s.nodeService.pathPort(conn)
+	} else {
+		if req.PeerPort == 0 {
+			req.PeerPort = req.Port
+		}
+		err = s.nodeService.checkConnectionPort(conn, req.Port, req.PeerPort)
+		conn.Port, conn.PeerPort = req.Port, req.PeerPort
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.store.CreateWireguardConnections([]*types.WireguardConnection{conn}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 并发创建了相同编号的路径
+	if conn.ID == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("path %d of link %d-%d already exists", conn.Path, conn.NodeID, conn.PeerID)})
+		return
+	}
+	if err := s.nodeService.assignLinkLocal(map[int]*types.WireguardConnection{conn.ID: conn}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	s.nodeService.enqueueNodeUpdate(conn.NodeID, conn.PeerID)
+
+	s.logger.Info().
+		Int("connection_id", conn.ID).
+		Int("node_id", conn.NodeID).
+		Int("peer_id", conn.PeerID).
+		Int("path", conn.Path).
+		Int("port", conn.Port).
+		Int("peer_port", conn.ListenPort(conn.PeerID)).
+		Msg("Created wireguard connection path")
+	c.JSON(http.StatusOK, conn)
+}
+
+// checkInterfaceName 检查附加路径的接口名是否合法，且不与租户内节点的主链路接口名冲突
+func (s *NodeService) checkInterfaceName(ctx context.Context, tenantID int, names ...string) error {
+	for _, name := range names {
+		if err := validateInterfaceName(s.config, name); err != nil {
+			return err
+		}
+	}
+	nodes, err := s.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if name := peerInterface(s.config, node); slices.Contains(names, name) {
+			return fmt.Errorf("interface name %s conflicts with node %d", name, node.ID)
+		}
+	}
+	return nil
+}
+
+// connectionPaths 返回节点参与的附加路径，按对端节点 ID 分组，组内按路径编号排序
+func (s *NodeService) connectionPaths(nodeID int) (map[int][]*types.WireguardConnection, error) {
+	conns, err := s.store.ListWireguardConnections(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[int][]*types.WireguardConnection)
+	for _, conn := range conns {
+		if conn.Path == 0 {
+			continue
+		}
+		peerID := conn.PeerID
+		if peerID == nodeID {
+			peerID = conn.NodeID
+		}
+		paths[peerID] = append(paths[peerID], conn)
+	}
+	for _, list := range paths {
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	}
+	return paths, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// effectiveNetworkSettings 返回租户网络生效的默认参数，租户未设置的字段使用服务端配置，返回值的 Keepalive 不为空
+func effectiveNetworkSettings(cfg *config.ServerConfig, tenant *types.Tenant) types.NetworkSettings {
+	var settings types.NetworkSettings
+	if tenant.Settings != nil {
+		settings = *tenant.Settings
+	}
+	if settings.MTU == 0 {
+		settings.MTU = cfg.Network.MTU
+	}
+	if settings.Keepalive == nil {
+		keepalive := cfg.Network.Keepalive
+		settings.Keepalive = &keepalive
+	}
+	return settings
+}
+
+// networkTenantID 返回路径中的网络 ID，每个租户只有一个网络，ID 与租户 ID 相同；不是当前租户的网络时返回 false
+func networkTenantID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Network not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleGetNetworkSettings 返回租户网络的默认参数，settings 为租户的设置，effective 为合并服务端配置后生效的值
+func (s *ConfigService) HandleGetNetworkSettings(c *gin.Context) {
+	tenantID, ok := networkTenantID(c)
+	if !ok {
+		return
+	}
+	tenant, err := s.nodeService.tenantSettings(tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	settings := tenant.Settings
+	if settings == nil {
+		settings = &types.NetworkSettings{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"settings":  settings,
+		"effective": effectiveNetworkSettings(s.config, tenant),
+		"default":   tenant.Settings == nil,
+	})
+}
+
+// HandleUpdateNetworkSettings 替换租户网络的默认参数，省略的字段使用服务端配置，租户内所有节点的配置都会更新
+//
+// MTU 只作用于未单独设置 MTU 的节点，babeld 参数被节点和链路上的设置覆盖。
+func (s *ConfigService) HandleUpdateNetworkSettings(c *gin.Context) {
+	tenantID, ok := networkTenantID(c)
+	if !ok {
+		return
+	}
+	var req types.NetworkSettings
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var settings *types.NetworkSettings
+	if req != (types.NetworkSettings{}) {
+		settings = &req
+	}
+	if err := s.nodeService.store.UpdateTenantNetworkSettings(tenantID, settings); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Network not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	s.logger.Info().
+		Int("tenant_id", tenantID).
+		Bool("default", settings == nil).
+		Msg("Updated network settings")
+	c.Status(http.StatusNoContent)
+}
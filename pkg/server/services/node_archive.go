@@ -0,0 +1,81 @@
+package services
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+)
+
+// nodeArchive 删除节点前导出的历史数据
+type nodeArchive struct {
+	ArchivedAt     time.Time              `json:"archived_at"`
+	Node           *types.NodeConfig      `json:"node"`   // 不含令牌和私钥
+	Status         *types.NodeStatus      `json:"status"` // 最近一次上报的状态，从未上报时为空
+	Tasks          []*types.Task          `json:"tasks"`
+	TrafficUsage   []*types.TrafficUsage  `json:"traffic_usage"`
+	BandwidthTests []*types.BandwidthTest `json:"bandwidth_tests"`
+}
+
+// archiveNode 将节点的历史数据写入 retention.node_archive_dir，返回归档文件路径
+func (s *NodeService) archiveNode(node *types.NodeConfig) (string, error) {
+	dir := s.config.Retention.NodeArchiveDir
+	now := time.Now().UTC()
+
+	info := *node
+	info.Token = ""
+	info.PrivateKey = ""
+	archive := nodeArchive{ArchivedAt: now, Node: &info}
+
+	// 没有状态记录时 GetNodeStatus 返回错误
+	archive.Status, _ = s.store.GetNodeStatus(node.ID)
+
+	var err error
+	if archive.Tasks, err = s.store.ListTasks(store.TaskFilter{NodeID: &node.ID}); err != nil {
+		return "", fmt.Errorf("listing tasks: %w", err)
+	}
+	if archive.TrafficUsage, err = s.store.ListTrafficUsage(store.UsageFilter{TenantID: node.TenantID, NodeID: node.ID}); err != nil {
+		return "", fmt.Errorf("listing traffic usage: %w", err)
+	}
+	tests, err := s.store.ListBandwidthTests(node.TenantID)
+	if err != nil {
+		return "", fmt.Errorf("listing bandwidth tests: %w", err)
+	}
+	for _, test := range tests {
+		if test.NodeID == node.ID || test.PeerID == node.ID {
+			archive.BandwidthTests = append(archive.BandwidthTests, test)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("creating archive directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("node-%d-%s.json.gz", node.ID, now.Format("20060102T150405Z")))
+	tmp, err := os.CreateTemp(dir, ".node-archive-*")
+	if err != nil {
+		return "", fmt.Errorf("creating archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(archive); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("writing archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("saving archive: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inventoryCSVHeader 导出 CSV 的表头，与 NodeInventory 的 JSON 字段一致
+var inventoryCSVHeader = []string{
+	"id", "name", "ipv4", "ipv6", "endpoints", "public_key", "status", "version", "last_seen", "uptime",
+	"os", "kernel", "wireguard_tools", "wireguard_module", "babeld",
+}
+
+// minVersionPattern 筛选条件中的点分版本号，如 5.15、1.0.20210914
+var minVersionPattern = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
+// inventoryVersionFilters 可按最低版本筛选的组件，键为查询参数
+var inventoryVersionFilters = map[string]func(*types.SoftwareVersions) string{
+	"min_kernel":          func(v *types.SoftwareVersions) string { return v.Kernel },
+	"min_wireguard_tools": func(v *types.SoftwareVersions) string { return v.WireGuardTools },
+	"min_babeld":          func(v *types.SoftwareVersions) string { return v.Babeld },
+}
+
+// HandleExportNodes 导出租户节点清单，format=json（默认）或 csv。
+// min_kernel、min_wireguard_tools、min_babeld 只导出该组件低于指定版本或版本未知的节点，供升级时选出待升级的节点
+func (s *NodeService) HandleExportNodes(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected csv or json"})
+		return
+	}
+	minVersions := make(map[string]string)
+	for param := range inventoryVersionFilters {
+		if v := c.Query(param); v != "" {
+			if !minVersionPattern.MatchString(v) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			minVersions[param] = v
+		}
+	}
+
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	inventory := make([]*types.NodeInventory, 0, len(nodes))
+	for _, node := range nodes {
+		item := s.nodeInventory(node)
+		if len(minVersions) > 0 && !outdated(&item.SoftwareVersions, minVersions) {
+			continue
+		}
+		inventory = append(inventory, item)
+	}
+
+	filename := "nodes-" + time.Now().UTC().Format("20060102") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		c.JSON(http.StatusOK, inventory)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	w.Write(inventoryCSVHeader)
+	for _, item := range inventory {
+		lastSeen := ""
+		if item.LastSeen != nil {
+			lastSeen = item.LastSeen.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			strconv.Itoa(item.ID),
+			item.Name,
+			item.IPv4,
+			item.IPv6,
+			strings.Join(item.Endpoints, " "),
+			item.PublicKey,
+			item.Status,
+			item.Version,
+			lastSeen,
+			strconv.FormatInt(item.Uptime, 10),
+			item.OS,
+			item.Kernel,
+			item.WireGuardTools,
+			item.WireGuardModule,
+			item.Babeld,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to write node export")
+	}
+}
+
+// nodeInventory 生成节点的清单条目，节点从未上报时状态相关字段为空
+func (s *NodeService) nodeInventory(node *types.NodeConfig) *types.NodeInventory {
+	item := &types.NodeInventory{
+		ID:        node.ID,
+		Name:      node.Name,
+		IPv4:      node.IPv4,
+		IPv6:      node.IPv6,
+		Endpoints: []string{},
+		PublicKey: node.PublicKey,
+	}
+	if node.Endpoints != "" {
+		if err := json.Unmarshal([]byte(node.Endpoints), &item.Endpoints); err != nil {
+			s.logger.Warn().Err(err).Int("node_id", node.ID).Msg("Failed to unmarshal endpoints")
+		}
+	}
+	if !node.Status.Timestamp.IsZero() {
+		lastSeen := node.Status.Timestamp
+		item.Status = node.Status.Status
+		item.Version = node.Status.Version
+		item.LastSeen = &lastSeen
+		item.Uptime = node.Status.Metrics.Uptime
+		item.SoftwareVersions = node.Status.Software
+	}
+	return item
+}
+
+// outdated 节点是否有组件低于 minVersions 中的最低版本，版本未知的组件视为需要升级
+func outdated(versions *types.SoftwareVersions, minVersions map[string]string) bool {
+	for param, minVersion := range minVersions {
+		current := inventoryVersionFilters[param](versions)
+		if current == "" || types.CompareVersions(current, minVersion) < 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// overviewRecentTasks 节点详情中返回的最近任务数
+const overviewRecentTasks = 10
+
+// HandleGetNodeOverview 返回节点详情页所需的节点信息、最近状态、连接及其健康状况和最近的任务
+func (s *TopologyService) HandleGetNodeOverview(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tenantID := middleware.TenantID(c)
+	node, err := s.nodeService.GetTenantNode(ctx, tenantID, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	st := s.store.WithContext(ctx)
+	nodes, err := s.nodeService.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	statuses, err := st.ListNodeStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	conns, err := st.ListWireguardConnections(nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	infos, err := s.ListConnections(ctx, tenantID, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tasks, err := st.ListTasks(store.TaskFilter{NodeID: &nodeID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	byNode := make(map[int]*types.NodeStatus, len(statuses))
+	for _, status := range statuses {
+		byNode[status.NodeID] = status
+	}
+	health := ComputeMeshHealth(nodes, byNode, conns, s.clock.Now(), s.config.Status.OfflineAfter, s.config.Status.HandshakeTimeout)
+
+	// 不返回令牌和私钥
+	info := *node
+	info.Token = ""
+	info.PrivateKey = ""
+
+	overview := &types.NodeOverview{
+		Node:        &info,
+		Status:      byNode[nodeID],
+		Connections: make([]types.NodeLink, 0, len(infos)),
+		RecentTasks: tasks,
+	}
+	for _, h := range health.Nodes {
+		if h.NodeID == nodeID {
+			overview.Health = h
+			break
+		}
+	}
+
+	linkHealth := make(map[[2]int]types.LinkHealthState, len(health.Links))
+	for _, link := range health.Links {
+		linkHealth[pairKey(link.NodeID, link.PeerID)] = link.Health
+	}
+	for _, conn := range infos {
+		link := types.NodeLink{ConnectionInfo: *conn}
+		if conn.Path == 0 && conn.Enabled {
+			link.Health = linkHealth[pairKey(conn.NodeID, conn.PeerID)]
+		}
+		overview.Connections = append(overview.Connections, link)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.After(tasks[j].CreatedAt) })
+	if len(tasks) > overviewRecentTasks {
+		overview.RecentTasks = tasks[:overviewRecentTasks]
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nodePatchRequest PATCH /nodes/:id 的请求体，省略的字段保持不变
+type nodePatchRequest struct {
+	Name      *string   `json:"name" binding:"omitempty,name"`
+	Endpoints *[]string `json:"endpoints" binding:"omitempty,min=1,dive,endpoint"`
+	Tags      *[]string `json:"tags"`
+	MTU       *int      `json:"mtu" binding:"omitempty,min=1280,max=9000"` // 为 0 时恢复 agent 的默认值
+}
+
+// HandlePatchNode 部分更新节点的名称、端点、标签和 MTU，只修改请求中出现的字段，不会覆盖密钥等其他配置。
+// 各字段的检查与单独修改该字段的接口相同，任一字段不合法时不做任何修改
+func (s *NodeService) HandlePatchNode(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req nodePatchRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Name != nil && *req.Name == types.ClientInterfaceName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": gin.H{"name": fmt.Sprintf("%s is reserved", *req.Name)}})
+		return
+	}
+	if req.Tags != nil {
+		if err := types.ValidateTags(*req.Tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": gin.H{"tags": err.Error()}})
+			return
+		}
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	// 只保留与当前值不同的字段
+	var (
+		patch   store.NodePatch
+		changed []string
+	)
+	renamed := req.Name != nil && *req.Name != node.Name
+	if renamed {
+		if err := s.checkNodeRename(c.Request.Context(), node, *req.Name); err != nil {
+			if errors.Is(err, errNameConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		patch.Name = req.Name
+		changed = append(changed, "name")
+	}
+	if req.Endpoints != nil {
+		var current []string
+		_ = json.Unmarshal([]byte(node.Endpoints), &current)
+		if !slices.Equal(current, *req.Endpoints) {
+			// 与创建节点相同，检查端点能否解析，节点地址取首个端点的地址
+			var ipv4, ipv6 string
+			for i, endpoint := range *req.Endpoints {
+				v4, v6, err := resolveEndpoint(c.Request.Context(), endpoint)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": gin.H{fmt.Sprintf("endpoints[%d]", i): err.Error()}})
+					return
+				}
+				if i == 0 {
+					ipv4, ipv6 = v4, v6
+				}
+			}
+			endpoints, _ := json.Marshal(*req.Endpoints)
+			encoded := string(endpoints)
+			patch.Endpoints, patch.IPv4, patch.IPv6 = &encoded, &ipv4, &ipv6
+			changed = append(changed, "endpoints")
+		}
+	}
+	if req.Tags != nil && !slices.Equal(node.Tags, *req.Tags) {
+		patch.Tags = req.Tags
+		changed = append(changed, "tags")
+	}
+	if req.MTU != nil && *req.MTU != node.MTU {
+		patch.MTU = req.MTU
+		changed = append(changed, "mtu")
+	}
+	if len(changed) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if err := s.store.PatchNode(nodeID, patch); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 端点和标签影响对端的配置和防火墙规则，改名时对端的接口名随之变化；只改 MTU 时只需更新本节点
+	s.notifyMeshChange()
+	if patch.Endpoints != nil || patch.Tags != nil || (renamed && s.config.Network.InterfaceNaming != InterfaceNamingID) {
+		if err := s.enqueueMeshUpdate(node.TenantID); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+		}
+	} else {
+		s.enqueueNodeUpdate(nodeID)
+	}
+
+	s.logger.Info().
+		Int("node_id", nodeID).
+		Strs("fields", changed).
+		Msg("Patched node")
+	c.Status(http.StatusNoContent)
+}
@@ -1,17 +1,20 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
 	"mesh-backend/pkg/store"
 	"mesh-backend/pkg/types"
 	"net/http"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,6 +22,12 @@ import (
 	"golang.org/x/crypto/curve25519"
 )
 
+// 临时日志级别的默认和最长生效时长
+const (
+	defaultLogLevelDuration = 15 * time.Minute
+	maxLogLevelDuration     = 24 * time.Hour
+)
+
 type NodeService struct {
 	config *config.ServerConfig
 	logger zerolog.Logger
@@ -29,6 +38,25 @@ type NodeService struct {
 
 	// 服务依赖
 	taskService *TaskService
+
+	// 配置下发
+	dispatcher *ConfigDispatcher
+	drift      *DriftTracker
+
+	// 节点变更监听
+	changeListeners []func()
+	deleteListeners []func(nodeID int)
+
+	// 下发前的配置检查，由配置服务设置；未通过检查的节点保留最近一次检查结果
+	configCheck func(ctx context.Context, nodeID int) (*ConfigCheckReport, error)
+	rejectMu    sync.Mutex
+	rejected    map[int]*ConfigCheckReport
+
+	// 变更审批，由变更集服务设置；返回 true 时节点更新等待审批，不进入下发队列
+	changeHold func(nodeIDs []int) bool
+
+	// 生命周期事件通知，未设置时不发送
+	webhooks *WebhookNotifier
 }
 
 // NewNodeService 创建节点服务实例
@@ -39,20 +67,58 @@ func NewNodeService(cfg *config.ServerConfig, logger zerolog.Logger, store store
 		store:       store,
 		nodes:       make(map[int]*types.NodeConfig),
 		taskService: taskService,
+		drift:       NewDriftTracker(),
+		rejected:    make(map[int]*ConfigCheckReport),
 	}
+	srv.dispatcher = NewConfigDispatcher(srv.logger, cfg.Rollout.Workers, cfg.Rollout.QueueSize, srv.TriggerConfigUpdate)
+	taskService.OnTaskDone(types.TaskTypeUpdate, srv.drift.handleUpdateDone)
+	taskService.OnStreamConnected(srv.bootstrapNode)
 
 	return srv
 }
 
-func (s *NodeService) RegisterRoutes(r *gin.RouterGroup) {
+// Start 启动节点服务后台任务
+func (s *NodeService) Start() {
+	s.dispatcher.Start()
+}
+
+// Stop 停止节点服务后台任务
+func (s *NodeService) Stop() {
+	s.dispatcher.Stop()
+}
+
+// RegisterRoutes 注册路由
+func (s *NodeService) RegisterRoutes(g *RouteGroups) {
+	r := g.Dashboard
 	r.GET("/nodes", s.HandleListNodes)
+	r.GET("/nodes/summary", s.HandleListNodeSummaries)
+	r.GET("/nodes/export", s.HandleExportNodes)
 	r.POST("/nodes", s.HandleCreateNode)
+	r.POST("/nodes/import", s.HandleImportWireGuard)
 	r.GET("/nodes/:id", s.HandleGetNode)
+	r.PATCH("/nodes/:id", s.HandlePatchNode)
+	r.DELETE("/nodes/:id", s.HandleDeleteNode)
+	r.PUT("/nodes/:id/metadata", s.HandleUpdateNodeMetadata)
+	r.PUT("/nodes/:id/allowed-ports", s.HandleUpdateAllowedPorts)
+	r.PUT("/nodes/:id/babel-options", s.HandleUpdateBabelOptions)
+	r.PUT("/nodes/:id/traffic-quota", s.HandleUpdateTrafficQuota)
+	r.PUT("/nodes/:id/tags", s.HandleUpdateNodeTags)
+	r.PUT("/nodes/:id/name", s.HandleRenameNode)
+	r.GET("/nodes/:id/capabilities", s.HandleGetNodeCapabilities)
+	r.GET("/nodes/:id/prefix", s.HandleGetDelegatedPrefix)
+	r.GET("/prefixes", s.HandleListDelegatedPrefixes)
+	r.GET("/addressing", s.HandleGetAddressingPlan)
+	r.PUT("/addressing", s.HandleUpdateAddressingPlan)
 	r.POST("/nodes/config/:id", s.HandleTriggerConfigUpdate)
+	r.PUT("/nodes/:id/log-level", s.HandleSetLogLevel)
+	r.POST("/nodes/:id/gc", s.HandleGarbageCollect)
+	r.GET("/rollout", s.HandleGetRolloutProgress)
+	r.GET("/rollout/drift", s.HandleGetConfigDrift)
+	r.GET("/rollout/rejected", s.HandleListRejectedConfigs)
 }
 
 func (s *NodeService) HandleListNodes(c *gin.Context) {
-	nodes, err := s.ListNodes()
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -60,21 +126,52 @@ func (s *NodeService) HandleListNodes(c *gin.Context) {
 	c.JSON(http.StatusOK, nodes)
 }
 
+// HandleListNodeSummaries 列出当前租户的节点摘要
+func (s *NodeService) HandleListNodeSummaries(c *gin.Context) {
+	summaries, err := s.store.WithContext(c.Request.Context()).ListNodeSummaries(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
 func (s *NodeService) HandleCreateNode(c *gin.Context) {
 	var req struct {
 		ID       int    `json:"id"`
-		Name     string `json:"name" binding:"required"`
-		Endpoint string `json:"endpoint" binding:"required"`
+		Name     string `json:"name" binding:"required,name"`
+		Endpoint string `json:"endpoint" binding:"required,endpoint"`
+		MTU      int    `json:"mtu" binding:"omitempty,min=1280,max=9000"` // 为 0 时使用 agent 的默认值
+		types.NodeMetadata
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.NodeMetadata.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 节点名称用作 WireGuard 接口名，不能与网关节点的客户端接口冲突
+	if req.Name == types.ClientInterfaceName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("节点名称 %s 为保留名称", req.Name)})
+		return
+	}
+	if err := s.checkNodeInterfaces(c.Request.Context(), middleware.TenantID(c), &types.NodeConfig{ID: req.ID, Name: req.Name}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 端点可以是域名，创建时检查能否解析
+	ipv4, ipv6, err := resolveEndpoint(c.Request.Context(), req.Endpoint)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// 如果用户指定了ID，检查该ID是否已存在
 	if req.ID > 0 {
-		existingNode, err := s.GetNode(req.ID)
+		existingNode, err := s.GetNode(c.Request.Context(), req.ID)
 		if err == nil && existingNode != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("节点ID %d 已存在", req.ID)})
 			return
@@ -92,23 +189,21 @@ func (s *NodeService) HandleCreateNode(c *gin.Context) {
 
 	peersBytes, _ := json.Marshal([]string{})
 	endpointBytes, _ := json.Marshal([]string{req.Endpoint})
-	var ipv4, ipv6 string
-	if strings.Contains(req.Endpoint, ".") {
-		ipv4 = req.Endpoint
-	} else {
-		ipv6 = req.Endpoint
-	}
 	config := &types.NodeConfig{
 		// 基本信息
 		ID:        req.ID, // 使用用户指定的ID，如果为0则自增
+		TenantID:  middleware.TenantID(c),
 		Name:      req.Name,
 		Token:     token,
 		Peers:     string(peersBytes), // To-Do 添加预设节点
 		Endpoints: string(endpointBytes),
 		IPv4:      ipv4,
 		IPv6:      ipv6,
+		MTU:       req.MTU,
 		CreatedAt: now,
 		UpdatedAt: now,
+
+		NodeMetadata: req.NodeMetadata,
 	}
 
 	// 生成 WireGuard 密钥对
@@ -123,35 +218,18 @@ func (s *NodeService) HandleCreateNode(c *gin.Context) {
 
 	// 创建节点
 	if err := s.store.CreateNode(config); err != nil {
-		// http.Error(w, err.Error(), http.StatusInternalServerError)
+		// 其他服务端实例可能同时使用了该 ID
+		if errors.Is(err, store.ErrNodeIDTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 异步触发所有现有节点的配置更新任务（不包括新创建的节点）
-	go func() {
-		// 获取所有节点
-		nodes, err := s.ListNodes()
-		if err != nil {
-			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
-			return
-		}
-
-		// 为每个现有节点触发配置更新任务，但不包括新创建的节点
-		for _, node := range nodes {
-			// 跳过新创建的节点，因为它还没有连接，更新必然失败
-			if node.ID == config.ID {
-				continue
-			}
-
-			// 触发节点配置更新任务
-			if err := s.TriggerConfigUpdate(node.ID); err != nil {
-				s.logger.Warn().Err(err).Int("node_id", node.ID).Msg("Failed to trigger config update for node")
-				// 继续处理其他节点，不中断流程
-			}
-			time.Sleep(10 * time.Second)
-		}
-	}()
+	// 新节点和对端的配置在 agent 首次连接时下发，见 bootstrapNode
+	s.notifyMeshChange()
+	s.webhooks.Emit(types.EventNodeCreated, config.TenantID, gin.H{"id": config.ID, "name": config.Name, "public_key": config.PublicKey})
 
 	c.JSON(http.StatusOK, gin.H{
 		"id":         config.ID,
@@ -168,7 +246,7 @@ func (s *NodeService) HandleGetNode(c *gin.Context) {
 		return
 	}
 
-	node, err := s.GetNode(nodeID)
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -182,6 +260,267 @@ func (s *NodeService) HandleGetNode(c *gin.Context) {
 	c.JSON(http.StatusOK, node)
 }
 
+// HandleDeleteNode 删除节点并更新其余节点的配置
+//
+// 删除会使原本互通的节点断开时返回 409 和连通性分析，确认后使用 ?force=true 重新提交。
+func (s *NodeService) HandleDeleteNode(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	node, err := s.GetTenantNode(c.Request.Context(), tenantID, nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	before, err := s.loadMeshGraph(c.Request.Context(), tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := s.checkPartition(before, before.withoutNode(nodeID), c.Query("force") == "true")
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reachability": report})
+		return
+	}
+
+	if err := s.DeleteNode(nodeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	s.webhooks.Emit(types.EventNodeDeleted, tenantID, gin.H{"id": nodeID, "name": node.Name})
+	s.logger.Info().Int("node_id", nodeID).Str("name", node.Name).Msg("Deleted node")
+	c.JSON(http.StatusOK, gin.H{"reachability": report})
+}
+
+// HandleUpdateNodeMetadata 更新节点备注信息
+func (s *NodeService) HandleUpdateNodeMetadata(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var metadata types.NodeMetadata
+	if !bindJSON(c, &metadata) {
+		return
+	}
+	if err := metadata.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if err := s.store.UpdateNodeMetadata(nodeID, &metadata); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+// HandleUpdateBabelOptions 设置节点所有 babeld 接口的默认参数
+func (s *NodeService) HandleUpdateBabelOptions(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req types.BabelInterfaceOptions
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if err := s.store.UpdateNodeBabelOptions(nodeID, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 只影响该节点自身的 babeld 配置
+	s.notifyMeshChange()
+	s.enqueueNodeUpdate(nodeID)
+	c.Status(http.StatusNoContent)
+}
+
+// HandleUpdateTrafficQuota 更新节点的月流量配额，下次统计时按新配额检查
+//
+// 取消配额或关闭 deprioritize 时立即恢复节点的 rxcost。
+func (s *NodeService) HandleUpdateTrafficQuota(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req types.TrafficQuota
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if err := s.store.UpdateNodeTrafficQuota(nodeID, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if node.QuotaStatus.Deprioritized && (req.MonthlyBytes == 0 || !req.Deprioritize) {
+		status := node.QuotaStatus
+		status.Deprioritized = false
+		if err := s.store.UpdateNodeQuotaStatus(nodeID, status); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		s.notifyMeshChange()
+		s.enqueueNodeUpdate(nodeID)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandleUpdateNodeTags 更新节点的访问控制标签，租户内所有节点重新编译防火墙规则
+func (s *NodeService) HandleUpdateNodeTags(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := types.ValidateTags(req.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if err := s.store.UpdateNodeTags(nodeID, req.Tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.notifyMeshChange()
+	if err := s.enqueueMeshUpdate(node.TenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HandleUpdateAllowedPorts 更新节点的 UDP 端口白名单，并为端口不在白名单内的链路重新分配端口
+func (s *NodeService) HandleUpdateAllowedPorts(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req struct {
+		AllowedPorts string `json:"allowed_ports"` // 如 51820-51830,443，为空时不限制
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if _, err := types.ParsePortRanges(req.AllowedPorts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if err := s.store.UpdateNodeAllowedPorts(nodeID, req.AllowedPorts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 白名单已保存，无法满足时返回错误，由运维调整白名单或为链路指定端口
+	reassigned, err := s.ReassignDisallowedPorts(nodeID)
+	if reassigned > 0 {
+		s.notifyMeshChange()
+		if err := s.enqueueMeshUpdate(node.TenantID); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reassigned": reassigned})
+		return
+	}
+
+	s.logger.Info().
+		Int("node_id", nodeID).
+		Str("allowed_ports", req.AllowedPorts).
+		Int("reassigned", reassigned).
+		Msg("Updated node allowed ports")
+	c.JSON(http.StatusOK, gin.H{"allowed_ports": req.AllowedPorts, "reassigned": reassigned})
+}
+
 func (s *NodeService) HandleTriggerConfigUpdate(c *gin.Context) {
 	nodeID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -189,7 +528,26 @@ func (s *NodeService) HandleTriggerConfigUpdate(c *gin.Context) {
 		return
 	}
 
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	if s.holdChange([]int{nodeID}) {
+		c.JSON(http.StatusAccepted, gin.H{"status": types.ChangesetPending})
+		return
+	}
+
 	if err := s.TriggerConfigUpdate(nodeID); err != nil {
+		if errors.Is(err, ErrConfigRejected) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "report": s.rejectedReport(nodeID)})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -197,34 +555,225 @@ func (s *NodeService) HandleTriggerConfigUpdate(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// HandleSetLogLevel 临时调整节点 agent 的日志级别，到期后 agent 自动恢复配置文件中的级别
+func (s *NodeService) HandleSetLogLevel(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req types.LogLevelParams
+	if !bindJSON(c, &req) {
+		return
+	}
+	if _, err := zerolog.ParseLevel(req.Level); err != nil || req.Level == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid log level %q", req.Level)})
+		return
+	}
+	if req.Duration <= 0 {
+		req.Duration = int(defaultLogLevelDuration / time.Second)
+	}
+	if req.Duration > int(maxLogLevelDuration/time.Second) {
+		req.Duration = int(maxLogLevelDuration / time.Second)
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	task, err := s.taskService.CreateTaskWithParams(types.TaskTypeLogLevel, nodeID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.taskService.PushTask(task); err != nil {
+		s.taskService.CancelTask(task, "node not connected")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("node %d is not connected", nodeID)})
+		return
+	}
+
+	s.logger.Info().
+		Str("task_id", task.ID).
+		Int("node_id", nodeID).
+		Str("level", req.Level).
+		Int("duration", req.Duration).
+		Msg("Log level change requested")
+	c.JSON(http.StatusAccepted, task)
+}
+
+// HandleGarbageCollect 让节点 agent 清理配置中已不存在的 WireGuard 接口，结果在任务详情中查看
+func (s *NodeService) HandleGarbageCollect(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		return
+	}
+
+	var req types.GCParams
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &req) {
+			return
+		}
+	}
+
+	node, err := s.GetTenantNode(c.Request.Context(), middleware.TenantID(c), nodeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	task, err := s.taskService.CreateTaskWithParams(types.TaskTypeGC, nodeID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.taskService.PushTask(task); err != nil {
+		s.taskService.CancelTask(task, "node not connected")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("node %d is not connected", nodeID)})
+		return
+	}
+
+	s.logger.Info().
+		Str("task_id", task.ID).
+		Int("node_id", nodeID).
+		Bool("dry_run", req.DryRun).
+		Bool("force", req.Force).
+		Msg("Interface garbage collection requested")
+	c.JSON(http.StatusAccepted, task)
+}
+
+// OnMeshChange 注册节点变更监听函数
+func (s *NodeService) OnMeshChange(fn func()) {
+	s.changeListeners = append(s.changeListeners, fn)
+}
+
+// OnNodeDeleted 注册节点删除监听函数，用于清理其他服务中与节点相关的记录
+func (s *NodeService) OnNodeDeleted(fn func(nodeID int)) {
+	s.deleteListeners = append(s.deleteListeners, fn)
+}
+
+// notifyMeshChange 通知节点已变更
+func (s *NodeService) notifyMeshChange() {
+	for _, fn := range s.changeListeners {
+		fn()
+	}
+}
+
+// HandleGetRolloutProgress 获取租户内节点的配置下发进度
+func (s *NodeService) HandleGetRolloutProgress(c *gin.Context) {
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	include := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		include[node.ID] = true
+	}
+	c.JSON(http.StatusOK, s.dispatcher.Progress(include))
+}
+
+// HandleGetConfigDrift 获取租户内配置落后的节点和最近的下发耗时
+func (s *NodeService) HandleGetConfigDrift(c *gin.Context) {
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	include := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		include[node.ID] = true
+	}
+	c.JSON(http.StatusOK, s.drift.Report(include))
+}
+
 // GetNode 获取节点配置
-func (s *NodeService) GetNode(nodeID int) (*types.NodeConfig, error) {
-	return s.store.GetNode(nodeID)
+func (s *NodeService) GetNode(ctx context.Context, nodeID int) (*types.NodeConfig, error) {
+	return s.store.WithContext(ctx).GetNode(nodeID)
+}
+
+// GetTenantNode 获取租户下的节点，节点不存在或属于其他租户时返回 nil，查询失败或请求已取消时返回错误
+func (s *NodeService) GetTenantNode(ctx context.Context, tenantID, nodeID int) (*types.NodeConfig, error) {
+	node, err := s.store.WithContext(ctx).GetNode(nodeID)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if node.TenantID != tenantID {
+		return nil, nil
+	}
+	return node, nil
+}
+
+// BabelPolicy 返回租户的 babeld 过滤策略，租户未配置时返回默认策略，custom 为 false
+func (s *NodeService) BabelPolicy(tenantID int) (policy *types.BabelPolicy, custom bool, err error) {
+	tenant, err := s.store.GetTenant(tenantID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, false, fmt.Errorf("getting tenant: %w", err)
+	}
+	if tenant == nil || tenant.BabelPolicy == nil {
+		return types.DefaultBabelPolicy(), false, nil
+	}
+	return tenant.BabelPolicy, true, nil
 }
 
 // ListNodes 列出所有节点
-func (s *NodeService) ListNodes() ([]*types.NodeConfig, error) {
-	nodes, err := s.store.ListNodes()
+func (s *NodeService) ListNodes(ctx context.Context) ([]*types.NodeConfig, error) {
+	nodes, err := s.store.WithContext(ctx).ListNodes()
 	if err != nil {
 		return nil, fmt.Errorf("querying nodes: %w", err)
 	}
 
+	roundNodeMetrics(nodes)
+	return nodes, nil
+}
+
+// ListTenantNodes 列出租户下的所有节点
+func (s *NodeService) ListTenantNodes(ctx context.Context, tenantID int) ([]*types.NodeConfig, error) {
+	nodes, err := s.store.WithContext(ctx).ListNodesByTenant(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("querying nodes: %w", err)
+	}
+
+	roundNodeMetrics(nodes)
+	return nodes, nil
+}
+
+// roundNodeMetrics 将节点资源使用率保留两位小数
+func roundNodeMetrics(nodes []*types.NodeConfig) {
 	for _, node := range nodes {
 		node.Status.Metrics.CPUUsage = math.Round(node.Status.Metrics.CPUUsage*100) / 100
 		node.Status.Metrics.DiskUsage = math.Round(node.Status.Metrics.DiskUsage*100) / 100
 	}
-
-	return nodes, nil
 }
 
 // UpdateNode 更新节点配置
 func (s *NodeService) UpdateNode(nodeID int, config *types.NodeConfig) error {
 	// 获取原有节点配置
-	_, err := s.store.GetNode(nodeID)
+	oldNode, err := s.store.GetNode(nodeID)
 	if err != nil {
 		return fmt.Errorf("get old node: %w", err)
 	}
 
+	// 节点不允许跨租户迁移
+	config.TenantID = oldNode.TenantID
+
 	// 保留原有 token
 	// config.Token = oldNode.Token
 
@@ -236,32 +785,131 @@ func (s *NodeService) UpdateNode(nodeID int, config *types.NodeConfig) error {
 	// 确保 token 在 nodeAuth 中注册
 	// s.nodeAuth.RegisterNode(nodeID, config.Token)
 
-	// 异步触发所有节点的配置更新任务
-	go func() {
-		// 获取所有节点
-		nodes, err := s.ListNodes()
-		if err != nil {
-			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
-			return
-		}
+	s.notifyMeshChange()
+
+	// 异步触发同租户所有节点的配置更新任务
+	if err := s.enqueueMeshUpdate(oldNode.TenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	return nil
+}
+
+// enqueueMeshUpdate 将租户下所有节点（排除指定节点）加入配置下发队列
+//
+// 变更已经写入，下发不随触发变更的请求取消。
+func (s *NodeService) enqueueMeshUpdate(tenantID int, excludeIDs ...int) error {
+	nodes, err := s.ListTenantNodes(context.Background(), tenantID)
+	if err != nil {
+		return err
+	}
+
+	excluded := make(map[int]bool, len(excludeIDs))
+	for _, id := range excludeIDs {
+		excluded[id] = true
+	}
 
-		// 为每个节点触发配置更新任务
-		for _, node := range nodes {
-			// 触发节点配置更新任务
-			if err := s.TriggerConfigUpdate(node.ID); err != nil {
-				s.logger.Warn().Err(err).Int("node_id", node.ID).Msg("Failed to trigger config update for node")
-				// 继续处理其他节点，不中断流程
-			}
-			time.Sleep(10 * time.Second)
+	nodeIDs := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		if excluded[node.ID] {
+			continue
 		}
-	}()
+		nodeIDs = append(nodeIDs, node.ID)
+	}
+	s.enqueueNodeUpdate(nodeIDs...)
 
 	return nil
 }
 
-// DeleteNode 删除节点
+// enqueueNodeUpdate 将指定节点加入配置下发队列，开启变更审批时记录到待审批的变更集
+func (s *NodeService) enqueueNodeUpdate(nodeIDs ...int) {
+	if len(nodeIDs) == 0 || s.holdChange(nodeIDs) {
+		return
+	}
+	s.dispatchNodeUpdate(nodeIDs...)
+}
+
+// dispatchNodeUpdate 将指定节点加入配置下发队列，不经过变更审批
+func (s *NodeService) dispatchNodeUpdate(nodeIDs ...int) {
+	s.drift.MarkChanged(nodeIDs...)
+	s.dispatcher.Enqueue(nodeIDs...)
+}
+
+// SetWebhooks 设置生命周期事件的 webhook 通知
+func (s *NodeService) SetWebhooks(webhooks *WebhookNotifier) {
+	s.webhooks = webhooks
+}
+
+// SetChangeHold 设置变更审批，hold 返回 true 表示节点更新已记录到待审批的变更集
+func (s *NodeService) SetChangeHold(hold func(nodeIDs []int) bool) {
+	s.changeHold = hold
+}
+
+func (s *NodeService) holdChange(nodeIDs []int) bool {
+	return s.changeHold != nil && s.changeHold(nodeIDs)
+}
+
+// bootstrapNode 节点首次订阅任务时下发初始配置，并更新租户内所有对端
+//
+// 创建节点时 agent 尚未部署，提前向对端下发只会产生连不通的链路，因此推迟到 agent 首次连接。
+// 标记写入存储，多副本或重连时只触发一次；升级前创建的节点在升级后首次连接时也会触发一次。
+func (s *NodeService) bootstrapNode(nodeID int) {
+	first, err := s.store.MarkNodeBootstrapped(nodeID, time.Now())
+	if err != nil {
+		s.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to mark node bootstrapped")
+		return
+	}
+	if !first {
+		return
+	}
+
+	node, err := s.store.GetNode(nodeID)
+	if err != nil {
+		s.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to get node for bootstrap")
+		return
+	}
+	if err := s.enqueueMeshUpdate(node.TenantID); err != nil {
+		s.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to list nodes for config update")
+		return
+	}
+	s.logger.Info().Int("node_id", nodeID).Msg("Node connected for the first time, pushing initial config")
+}
+
+// DeleteNode 删除节点，并清除其任务、状态、流量统计和测速记录
+//
+// 配置了 retention.node_archive_dir 时先导出这些数据，导出失败则不删除节点。
 func (s *NodeService) DeleteNode(nodeID int) error {
-	return s.store.DeleteNode(nodeID)
+	if s.config.Retention.NodeArchiveDir != "" {
+		node, err := s.store.GetNode(nodeID)
+		if err != nil {
+			return err
+		}
+		path, err := s.archiveNode(node)
+		if err != nil {
+			return fmt.Errorf("archiving node %d: %w", nodeID, err)
+		}
+		s.logger.Info().Int("node_id", nodeID).Str("path", path).Msg("Archived node data")
+	}
+
+	if err := s.store.DeleteNode(nodeID); err != nil {
+		return err
+	}
+	// 节点已删除，清除失败时由 janitor 稍后清理
+	if purged, err := s.store.PurgeNodeData(nodeID); err != nil {
+		s.logger.Error().Err(err).Int("node_id", nodeID).Msg("Failed to purge node data")
+	} else if purged > 0 {
+		s.logger.Info().Int("node_id", nodeID).Int64("records", purged).Msg("Purged node data")
+	}
+
+	s.drift.Forget(nodeID)
+	s.rejectMu.Lock()
+	delete(s.rejected, nodeID)
+	s.rejectMu.Unlock()
+	for _, fn := range s.deleteListeners {
+		fn(nodeID)
+	}
+	s.notifyMeshChange()
+	return nil
 }
 
 // TriggerConfigUpdate 触发节点配置更新任务
@@ -275,14 +923,14 @@ func (s *NodeService) TriggerConfigUpdate(nodeID int) error {
 	// 	NodeID:    nodeID,
 	// }
 
-	// 保存任务
-	task, err := s.taskService.CreateTask(types.TaskTypeUpdate, nodeID)
-	if err != nil {
-		return fmt.Errorf("creating update task: %w", err)
+	if err := s.checkConfig(nodeID); err != nil {
+		return err
 	}
 
-	if err := s.taskService.PushTask(task); err != nil {
-		return fmt.Errorf("saving task: %w", err)
+	// 创建任务，合并窗口内的重复请求会被合并
+	task, err := s.taskService.ScheduleConfigUpdate(nodeID)
+	if err != nil {
+		return fmt.Errorf("scheduling update task: %w", err)
 	}
 
 	s.logger.Info().
@@ -293,6 +941,63 @@ func (s *NodeService) TriggerConfigUpdate(nodeID int) error {
 	return nil
 }
 
+// SetConfigCheck 设置下发前的配置检查，未通过检查的节点不创建更新任务
+func (s *NodeService) SetConfigCheck(check func(ctx context.Context, nodeID int) (*ConfigCheckReport, error)) {
+	s.configCheck = check
+}
+
+// checkConfig 检查节点即将下发的配置，未通过时记录检查结果并返回 ErrConfigRejected
+func (s *NodeService) checkConfig(nodeID int) error {
+	if s.configCheck == nil {
+		return nil
+	}
+	report, err := s.configCheck(context.Background(), nodeID)
+	if err != nil {
+		return fmt.Errorf("checking config: %w", err)
+	}
+
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+	if report.OK() {
+		delete(s.rejected, nodeID)
+		return nil
+	}
+	s.rejected[nodeID] = report
+
+	event := s.logger.Warn().Int("node_id", nodeID).Int("issues", len(report.Issues))
+	if len(report.Issues) > 0 {
+		event = event.Str("first_issue", report.Issues[0].Message)
+	}
+	event.Msg("Config failed sanity checks, rollout rejected")
+	return fmt.Errorf("%w: %d issue(s)", ErrConfigRejected, len(report.Issues))
+}
+
+// rejectedReport 返回节点最近一次未通过的检查结果
+func (s *NodeService) rejectedReport(nodeID int) *ConfigCheckReport {
+	s.rejectMu.Lock()
+	defer s.rejectMu.Unlock()
+	return s.rejected[nodeID]
+}
+
+// HandleListRejectedConfigs 列出租户内最近一次配置检查未通过、尚未成功下发的节点及检查结果
+func (s *NodeService) HandleListRejectedConfigs(c *gin.Context) {
+	nodes, err := s.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reports := make([]*ConfigCheckReport, 0)
+	s.rejectMu.Lock()
+	for _, node := range nodes {
+		if report, ok := s.rejected[node.ID]; ok {
+			reports = append(reports, report)
+		}
+	}
+	s.rejectMu.Unlock()
+	c.JSON(http.StatusOK, reports)
+}
+
 // generateWireGuardKeyPair 生成WireGuard密钥对
 func generateWireGuardKeyPair() (privateKey, publicKey string, err error) {
 	var private, public [32]byte
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mesh-backend/pkg/types"
+)
+
+// 端口分配模式
+const (
+	PortModeSequential = "sequential" // 按创建顺序递增分配，端口保存在存储中
+	PortModePair       = "pair"       // 由节点对计算得出，重建服务端后端口不变
+)
+
+// pairPort 计算节点对的确定性端口
+//
+// 节点对 (a, b)（a < b）按 b 分组依次编号：(1,2)=0, (1,3)=1, (2,3)=2, (1,4)=3 ...，
+// 编号即端口相对 basePort 的偏移，不同节点对的端口互不相同。
+func pairPort(basePort, rangeSize, nodeID, peerID int) (int, error) {
+	a, b := nodeID, peerID
+	if a > b {
+		a, b = b, a
+	}
+	if a < 1 || a == b {
+		return 0, fmt.Errorf("invalid node pair %d-%d", nodeID, peerID)
+	}
+	offset := (b-1)*(b-2)/2 + (a - 1)
+	if offset >= rangeSize {
+		return 0, fmt.Errorf("node pair %d-%d needs port offset %d, beyond network.port_range_size %d", a, b, offset, rangeSize)
+	}
+	return basePort + offset, nil
+}
+
+// generatePairConnections 按节点对计算端口创建缺失的连接，已有连接保留原端口
+//
+// 新端口与两端节点上已有连接（手动指定或按顺序分配的端口）冲突时返回错误。
+func (s *NodeService) generatePairConnections(nodeID int, peerIDs []int) (map[int]*types.WireguardConnection, error) {
+	existing, err := s.store.ListWireguardConnections(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	conns := connectionsByPeer(nodeID, existing)
+
+	var missing []*types.WireguardConnection
+	for _, peerID := range peerIDs {
+		if _, ok := conns[peerID]; ok || peerID == nodeID {
+			continue
+		}
+		port, err := pairPort(s.config.Network.BasePort, s.config.Network.PortRangeSize, nodeID, peerID)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, &types.WireguardConnection{
+			NodeID: nodeID,
+			PeerID: peerID,
+			Port:   port,
+		})
+	}
+	if len(missing) == 0 {
+		return conns, nil
+	}
+
+	all, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return nil, err
+	}
+	used := newPortUsage(all)
+	for _, conn := range missing {
+		if other := used.conflict(conn.NodeID, conn.PeerID, conn.Path, conn.Port, conn.Port); other != nil {
+			return nil, fmt.Errorf("port %d for link %d-%d collides with link %d-%d",
+				conn.Port, conn.NodeID, conn.PeerID, other.NodeID, other.PeerID)
+		}
+	}
+
+	if err := s.store.CreateWireguardConnections(missing); err != nil {
+		return nil, err
+	}
+
+	// 并发创建时以存储中的记录为准
+	existing, err = s.store.ListWireguardConnections(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	return connectionsByPeer(nodeID, existing), nil
+}
+
+// portConstraints 返回节点所在租户中设置了端口白名单的节点
+func (s *NodeService) portConstraints(nodeID int) (map[int]types.PortRanges, error) {
+	node, err := s.store.GetNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := s.store.ListNodesByTenant(node.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	constraints := make(map[int]types.PortRanges)
+	for _, n := range nodes {
+		ranges, err := n.AllowedPortRanges()
+		if err != nil {
+			return nil, err
+		}
+		if len(ranges) > 0 {
+			constraints[n.ID] = ranges
+		}
+	}
+	return constraints, nil
+}
+
+// portUsage 各节点上已被连接占用的端口，键为节点 ID 和该节点一端的监听端口
+type portUsage map[[2]int]*types.WireguardConnection
+
+func newPortUsage(conns []*types.WireguardConnection) portUsage {
+	used := make(portUsage, len(conns)*2)
+	for _, conn := range conns {
+		used.add(conn)
+	}
+	return used
+}
+
+func (u portUsage) add(conn *types.WireguardConnection) {
+	u[[2]int{conn.NodeID, conn.ListenPort(conn.NodeID)}] = conn
+	u[[2]int{conn.PeerID, conn.ListenPort(conn.PeerID)}] = conn
+}
+
+// conflict 返回两端节点上占用各自监听端口的其他连接，同一节点对的不同路径也不能共用端口
+func (u portUsage) conflict(nodeID, peerID, path, nodePort, peerPort int) *types.WireguardConnection {
+	for _, side := range [][2]int{{nodeID, nodePort}, {peerID, peerPort}} {
+		if other, ok := u[side]; ok && (pairKey(other.NodeID, other.PeerID) != pairKey(nodeID, peerID) || other.Path != path) {
+			return other
+		}
+	}
+	return nil
+}
+
+// constrainedPort 为有端口白名单的链路选择端口
+//
+// pair 模式下优先使用计算出的端口，否则在两端白名单交集中选择两端都未占用的最小端口。
+func (s *NodeService) constrainedPort(nodeID, peerID, path int, constraints map[int]types.PortRanges, used portUsage) (int, error) {
+	nodeRanges, peerRanges := constraints[nodeID], constraints[peerID]
+
+	if s.config.Network.PortMode == PortModePair && path == 0 {
+		port, err := pairPort(s.config.Network.BasePort, s.config.Network.PortRangeSize, nodeID, peerID)
+		if err == nil && nodeRanges.Allows(port) && peerRanges.Allows(port) && used.conflict(nodeID, peerID, path, port, port) == nil {
+			return port, nil
+		}
+	}
+
+	candidates := nodeRanges
+	if len(candidates) == 0 {
+		candidates = peerRanges
+	}
+	for _, pr := range candidates {
+		for port := pr.Start; port <= pr.End; port++ {
+			if nodeRanges.Allows(port) && peerRanges.Allows(port) && used.conflict(nodeID, peerID, path, port, port) == nil {
+				return port, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no free port for link %d-%d: node %d allows %s, node %d allows %s",
+		nodeID, peerID, nodeID, formatPortRanges(nodeRanges), peerID, formatPortRanges(peerRanges))
+}
+
+// generateConstrainedConnections 为有端口白名单的链路创建缺失的连接
+func (s *NodeService) generateConstrainedConnections(nodeID int, peerIDs []int, constraints map[int]types.PortRanges) error {
+	existing, err := s.store.ListWireguardConnections(nodeID)
+	if err != nil {
+		return err
+	}
+	conns := connectionsByPeer(nodeID, existing)
+
+	var missing []int
+	for _, peerID := range peerIDs {
+		if _, ok := conns[peerID]; !ok && peerID != nodeID {
+			missing = append(missing, peerID)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	all, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return err
+	}
+	used := newPortUsage(all)
+
+	created := make([]*types.WireguardConnection, 0, len(missing))
+	for _, peerID := range missing {
+		port, err := s.constrainedPort(nodeID, peerID, 0, constraints, used)
+		if err != nil {
+			return err
+		}
+		conn := &types.WireguardConnection{NodeID: nodeID, PeerID: peerID, Port: port, PeerPort: port}
+		used.add(conn)
+		created = append(created, conn)
+	}
+	return s.store.CreateWireguardConnections(created)
+}
+
+// checkPortConstraints 检查连接两端的监听端口是否在各自节点的白名单内
+func checkPortConstraints(conn *types.WireguardConnection, constraints map[int]types.PortRanges) error {
+	for _, id := range []int{conn.NodeID, conn.PeerID} {
+		if port := conn.ListenPort(id); !constraints[id].Allows(port) {
+			return fmt.Errorf("link %d-%d uses port %d on node %d, which it does not allow (allowed: %s)",
+				conn.NodeID, conn.PeerID, port, id, formatPortRanges(constraints[id]))
+		}
+	}
+	return nil
+}
+
+// ReassignDisallowedPorts 为端口不在白名单内的连接重新分配端口，返回调整的连接数
+func (s *NodeService) ReassignDisallowedPorts(nodeID int) (int, error) {
+	constraints, err := s.portConstraints(nodeID)
+	if err != nil {
+		return 0, err
+	}
+	all, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return 0, err
+	}
+	used := newPortUsage(all)
+
+	changed := 0
+	for _, conn := range all {
+		if conn.NodeID != nodeID && conn.PeerID != nodeID {
+			continue
+		}
+		if checkPortConstraints(conn, constraints) == nil {
+			continue
+		}
+		port, err := s.constrainedPort(conn.NodeID, conn.PeerID, conn.Path, constraints, used)
+		if err != nil {
+			return changed, err
+		}
+		conn.Port, conn.PeerPort = port, port
+		if err := s.store.UpdateWireguardConnection(conn); err != nil {
+			return changed, err
+		}
+		used.add(conn)
+		changed++
+	}
+	return changed, nil
+}
+
+// PinConnectionPort 为链路两端指定固定的监听端口，peerPort 为 0 时两端使用同一端口；
+// 端口需在各自节点的白名单内且未被该节点的其他连接占用
+func (s *NodeService) PinConnectionPort(conn *types.WireguardConnection, port, peerPort int) error {
+	if peerPort == 0 {
+		peerPort = port
+	}
+	if err := s.checkConnectionPort(conn, port, peerPort); err != nil {
+		return err
+	}
+	conn.Port, conn.PeerPort = port, peerPort
+	return s.store.UpdateWireguardConnection(conn)
+}
+
+// checkConnectionPort 检查两端的监听端口是否可供连接使用，port 为 NodeID 一端，peerPort 为 PeerID 一端
+func (s *NodeService) checkConnectionPort(conn *types.WireguardConnection, port, peerPort int) error {
+	for _, p := range []int{port, peerPort} {
+		if p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port: %d", p)
+		}
+	}
+	constraints, err := s.portConstraints(conn.NodeID)
+	if err != nil {
+		return err
+	}
+	all, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return err
+	}
+	if other := newPortUsage(all).conflict(conn.NodeID, conn.PeerID, conn.Path, port, peerPort); other != nil {
+		return fmt.Errorf("port %d/%d is already used by link %d-%d", port, peerPort, other.NodeID, other.PeerID)
+	}
+
+	pinned := *conn
+	pinned.Port, pinned.PeerPort = port, peerPort
+	return checkPortConstraints(&pinned, constraints)
+}
+
+// pathPort 为附加路径分配端口
+//
+// 任一端设置了端口白名单时在白名单交集中选择，否则使用所有连接中最大端口的下一个端口；
+// pair 模式下不使用 basePort 起的 port_range_size 个端口，它们保留给各节点对的主链路。
+func (s *NodeService) pathPort(conn *types.WireguardConnection) (int, error) {
+	constraints, err := s.portConstraints(conn.NodeID)
+	if err != nil {
+		return 0, err
+	}
+	all, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return 0, err
+	}
+	used := newPortUsage(all)
+	if len(constraints[conn.NodeID]) > 0 || len(constraints[conn.PeerID]) > 0 {
+		return s.constrainedPort(conn.NodeID, conn.PeerID, conn.Path, constraints, used)
+	}
+
+	port := s.config.Network.BasePort
+	if s.config.Network.PortMode == PortModePair {
+		port += s.config.Network.PortRangeSize
+	}
+	for _, other := range all {
+		if p := max(other.Port, other.PeerPort); p >= port {
+			port = p + 1
+		}
+	}
+	if port > 65535 {
+		return 0, fmt.Errorf("no free port for path %d of link %d-%d", conn.Path, conn.NodeID, conn.PeerID)
+	}
+	return port, nil
+}
+
+// formatPortRanges 格式化端口白名单用于错误信息
+func formatPortRanges(ranges types.PortRanges) string {
+	if len(ranges) == 0 {
+		return "any port"
+	}
+	parts := make([]string, 0, len(ranges))
+	for _, pr := range ranges {
+		if pr.Start == pr.End {
+			parts = append(parts, strconv.Itoa(pr.Start))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pr.Start, pr.End))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// connectionsByPeer 将节点参与的主链路按对端节点ID建立索引，忽略附加路径
+func connectionsByPeer(nodeID int, conns []*types.WireguardConnection) map[int]*types.WireguardConnection {
+	byPeer := make(map[int]*types.WireguardConnection, len(conns))
+	for _, conn := range conns {
+		if conn.Path != 0 {
+			continue
+		}
+		peerID := conn.PeerID
+		if peerID == nodeID {
+			peerID = conn.NodeID
+		}
+		byPeer[peerID] = conn
+	}
+	return byPeer
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mesh-backend/pkg/types"
+)
+
+// PartitionError 拓扑变更会使网格分区，需要强制执行
+type PartitionError struct {
+	Report *types.ReachabilityReport
+}
+
+func (e *PartitionError) Error() string {
+	ids := make([]string, len(e.Report.Isolated))
+	for i, id := range e.Report.Isolated {
+		ids[i] = fmt.Sprint(id)
+	}
+	return fmt.Sprintf("change would partition the mesh, isolating nodes %s", strings.Join(ids, ", "))
+}
+
+// meshGraph 租户内节点之间的链路图
+//
+// 配置生成时为每对节点创建连接且默认启用，因此除停用的连接外，任意两个节点之间都有链路。
+type meshGraph struct {
+	nodes    []int
+	disabled map[[2]int]bool
+}
+
+// loadMeshGraph 读取租户当前的链路图
+func (s *NodeService) loadMeshGraph(ctx context.Context, tenantID int) (*meshGraph, error) {
+	nodes, err := s.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	conns, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+
+	g := &meshGraph{disabled: make(map[[2]int]bool)}
+	for _, node := range nodes {
+		g.nodes = append(g.nodes, node.ID)
+	}
+	for _, conn := range conns {
+		if conn.Disabled && conn.Path == 0 {
+			g.disabled[pairKey(conn.NodeID, conn.PeerID)] = true
+		}
+	}
+	return g, nil
+}
+
+// withoutNode 返回删除节点后的链路图
+func (g *meshGraph) withoutNode(nodeID int) *meshGraph {
+	after := &meshGraph{disabled: g.disabled}
+	for _, id := range g.nodes {
+		if id != nodeID {
+			after.nodes = append(after.nodes, id)
+		}
+	}
+	return after
+}
+
+// withLinks 返回只启用 links 中链路的链路图
+func (g *meshGraph) withLinks(links map[[2]int]bool) *meshGraph {
+	after := &meshGraph{nodes: g.nodes, disabled: make(map[[2]int]bool)}
+	for i, a := range g.nodes {
+		for _, b := range g.nodes[i+1:] {
+			if key := pairKey(a, b); !links[key] {
+				after.disabled[key] = true
+			}
+		}
+	}
+	return after
+}
+
+// components 计算连通分量，键为节点 ID，值为所在分量的编号
+func (g *meshGraph) components() map[int]int {
+	comp := make(map[int]int, len(g.nodes))
+	next := 0
+	for _, start := range g.nodes {
+		if _, ok := comp[start]; ok {
+			continue
+		}
+		comp[start] = next
+		queue := []int{start}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, id := range g.nodes {
+				if _, ok := comp[id]; ok || g.disabled[pairKey(cur, id)] {
+					continue
+				}
+				comp[id] = next
+				queue = append(queue, id)
+			}
+		}
+		next++
+	}
+	return comp
+}
+
+// analyzeReachability 比较变更前后的链路图，找出变更前互通、变更后断开的节点
+//
+// 变更前已经断开的节点不算作分区；被拆开的分量中节点数最多的部分视为主体，其余部分的节点记为隔离。
+func analyzeReachability(before, after *meshGraph) *types.ReachabilityReport {
+	beforeComp, afterComp := before.components(), after.components()
+
+	groups := make(map[int][]int)
+	for _, id := range after.nodes {
+		groups[afterComp[id]] = append(groups[afterComp[id]], id)
+	}
+	report := &types.ReachabilityReport{Components: make([][]int, 0, len(groups)), Isolated: []int{}}
+	for _, ids := range groups {
+		sort.Ints(ids)
+		report.Components = append(report.Components, ids)
+	}
+	sort.Slice(report.Components, func(i, j int) bool {
+		a, b := report.Components[i], report.Components[j]
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a[0] < b[0]
+	})
+
+	// 变更前的每个分量在变更后拆成的部分
+	pieces := make(map[int]map[int]int)
+	for _, id := range after.nodes {
+		bc, ok := beforeComp[id]
+		if !ok {
+			continue
+		}
+		if pieces[bc] == nil {
+			pieces[bc] = make(map[int]int)
+		}
+		pieces[bc][afterComp[id]]++
+	}
+	for bc, parts := range pieces {
+		if len(parts) < 2 {
+			continue
+		}
+		report.Partitioned = true
+		main, size := -1, 0
+		for _, comp := range report.Components {
+			if n := parts[afterComp[comp[0]]]; n > size {
+				main, size = afterComp[comp[0]], n
+			}
+		}
+		for _, id := range after.nodes {
+			if beforeComp[id] == bc && afterComp[id] != main {
+				report.Isolated = append(report.Isolated, id)
+			}
+		}
+	}
+	sort.Ints(report.Isolated)
+	return report
+}
+
+// checkPartition 分析变更后的链路图，force 为 false 且会产生分区时返回 PartitionError
+func (s *NodeService) checkPartition(before, after *meshGraph, force bool) (*types.ReachabilityReport, error) {
+	report := analyzeReachability(before, after)
+	if !report.Partitioned {
+		return report, nil
+	}
+	if !force {
+		return report, &PartitionError{Report: report}
+	}
+	s.logger.Warn().
+		Ints("isolated", report.Isolated).
+		Int("components", len(report.Components)).
+		Msg("Forcing topology change that partitions the mesh")
+	return report, nil
+}
@@ -0,0 +1,16 @@
+package services
+
+import "github.com/gin-gonic/gin"
+
+// RouteGroups HTTP 路由分组，各分组已挂载对应的认证中间件
+type RouteGroups struct {
+	Version   string           // API 版本，服务可据此为旧版本注册兼容实现
+	Auth      *gin.RouterGroup // 登录注册等无需认证的路由
+	Dashboard *gin.RouterGroup // 需要 JWT 认证的管理路由
+	Agent     *gin.RouterGroup // 需要节点令牌认证的 agent 路由
+}
+
+// RouteRegistrar 注册 HTTP 路由的服务
+type RouteRegistrar interface {
+	RegisterRoutes(g *RouteGroups)
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// birdOSPFDefaultCost 链路未设置 rxcost 时使用的 OSPF 开销
+const birdOSPFDefaultCost = 10
+
+// HandleGetRoutingDaemon 返回租户使用的路由守护进程
+func (s *ConfigService) HandleGetRoutingDaemon(c *gin.Context) {
+	tenant, err := s.nodeService.tenantSettings(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"routing_daemon": tenantRoutingDaemon(tenant)})
+}
+
+// HandleUpdateRoutingDaemon 切换租户使用的路由守护进程，租户内所有节点的配置都会更新
+//
+// agent 应用新配置时停用原来的守护进程；切换期间节点间的路由会短暂中断。
+func (s *ConfigService) HandleUpdateRoutingDaemon(c *gin.Context) {
+	var req struct {
+		RoutingDaemon string `json:"routing_daemon" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !slices.Contains(types.RoutingDaemons, req.RoutingDaemon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("routing_daemon must be one of %s", strings.Join(types.RoutingDaemons, ", "))})
+		return
+	}
+
+	tenantID := middleware.TenantID(c)
+	if err := s.nodeService.store.UpdateTenantRoutingDaemon(tenantID, req.RoutingDaemon); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.nodeService.notifyMeshChange()
+	if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+	}
+
+	s.logger.Info().
+		Int("tenant_id", tenantID).
+		Str("routing_daemon", req.RoutingDaemon).
+		Msg("Updated routing daemon")
+	c.Status(http.StatusNoContent)
+}
+
+// tenantRoutingDaemon 返回租户使用的路由守护进程，未设置时为 babeld
+func tenantRoutingDaemon(tenant *types.Tenant) string {
+	if tenant.RoutingDaemon == "" {
+		return types.RoutingDaemonBabeld
+	}
+	return tenant.RoutingDaemon
+}
+
+// linkInterface 节点上的一个隧道接口及其路由参数
+type linkInterface struct {
+	Name          string // 不含前缀的接口名
+	LinkLocal     string // 本端的链路本地地址，含前缀长度
+	PeerLinkLocal string // 对端的链路本地地址，含前缀长度
+	Options       types.BabelInterfaceOptions
+}
+
+// linkInterfaces 返回节点上各条路径的隧道接口，参数依次合并了租户网络的默认值、节点和链路的设置
+func (s *ConfigService) linkInterfaces(node *types.NodeConfig, peers []*types.NodeConfig, conns map[int]*types.WireguardConnection, paths map[int][]*types.WireguardConnection, defaults types.BabelInterfaceOptions) []linkInterface {
+	var links []linkInterface
+	for _, peer := range peers {
+		if peer.ID == node.ID {
+			continue
+		}
+		linkConns := paths[peer.ID]
+		if conn, ok := conns[peer.ID]; ok {
+			linkConns = append([]*types.WireguardConnection{conn}, linkConns...)
+		} else {
+			linkConns = append([]*types.WireguardConnection{{}}, linkConns...)
+		}
+		for _, conn := range linkConns {
+			opts := defaults.Merge(node.BabelOptions).Merge(conn.BabelOptions)
+			// 超出流量配额的节点提高接收开销，其他节点优先选择绕开它的路径
+			if node.QuotaStatus.Deprioritized && opts.RxCost < s.config.Quota.PenaltyRxCost {
+				opts.RxCost = s.config.Quota.PenaltyRxCost
+			}
+			local, remote := conn.LinkLocal(node.ID)
+			links = append(links, linkInterface{
+				Name:          conn.InterfaceName(peerInterface(s.config, peer)),
+				LinkLocal:     local,
+				PeerLinkLocal: remote,
+				Options:       opts,
+			})
+		}
+	}
+	return links
+}
+
+// generateBirdConfig 生成 BIRD 2 的路由配置片段，daemon 为 bird-babel 或 bird-ospf
+//
+// 片段只通告本节点的网段、委派前缀和经本节点接入的客户端地址，只接受 mesh 网段内的路由；
+// router id 等全局设置由节点上的主配置提供。租户的 babeld 过滤策略不适用于 BIRD。
+func (s *ConfigService) generateBirdConfig(daemon string, node *types.NodeConfig, links []linkInterface, clients []*types.ClientPeer) string {
+	var v4, v6 []string
+	for _, p := range s.nodePrefixes(node.AddressNumber()) {
+		if strings.Contains(p, ":") {
+			v6 = append(v6, p)
+		} else {
+			v4 = append(v4, p)
+		}
+	}
+	for _, client := range clients {
+		v4 = append(v4, client.IPv4+"/32")
+		v6 = append(v6, client.IPv6+"/128")
+	}
+	prefixSet := func(prefixes []string) string {
+		if len(prefixes) == 0 {
+			return "false"
+		}
+		return fmt.Sprintf("net ~ [ %s+ ]", strings.Join(prefixes, "+, "))
+	}
+	protocols := map[string]string{"ipv4": "igp_babel", "ipv6": "igp_babel"}
+	if daemon == types.RoutingDaemonBirdOSPF {
+		protocols = map[string]string{"ipv4": "igp_ospf4", "ipv6": "igp_ospf6"}
+	}
+	table := ""
+	if s.config.Network.Routing.Table != 0 {
+		table = fmt.Sprintf("\tkernel table %d;\n", s.config.Network.Routing.Table)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by mesh-backend, do not edit\n")
+	b.WriteString("\nprotocol device igp_device {\n}\n")
+	b.WriteString("\nprotocol direct igp_direct {\n\tipv4;\n\tipv6;\n}\n")
+	for _, family := range []string{"ipv4", "ipv6"} {
+		suffix := strings.TrimPrefix(family, "ipv")
+		// 客户端地址只存在于 WireGuard 的 allowed-ips 中，以静态路由导入
+		fmt.Fprintf(&b, "\nprotocol static igp_clients%s {\n\t%s;\n", suffix, family)
+		for _, client := range clients {
+			addr := client.IPv4 + "/32"
+			if family == "ipv6" {
+				addr = client.IPv6 + "/128"
+			}
+			fmt.Fprintf(&b, "\troute %s via \"{WGPrefix}%s\";\n", addr, types.ClientInterfaceName)
+		}
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "\nprotocol kernel igp_kernel%s {\n\t%s {\n\t\timport none;\n\t\texport where proto = \"%s\";\n\t};\n%s}\n",
+			suffix, family, protocols[family], table)
+	}
+
+	imports := map[string]string{
+		"ipv4": fmt.Sprintf("net ~ [ %s+ ]", s.config.Network.IPv4Range),
+		"ipv6": fmt.Sprintf("net ~ [ %s+ ]", s.config.Network.IPv6Range),
+	}
+	exports := map[string]string{"ipv4": prefixSet(v4), "ipv6": prefixSet(v6)}
+	channel := func(family string) string {
+		return fmt.Sprintf("\t%s {\n\t\timport where %s;\n\t\texport where %s;\n\t};\n", family, imports[family], exports[family])
+	}
+
+	switch daemon {
+	case types.RoutingDaemonBirdBabel:
+		b.WriteString("\nprotocol babel igp_babel {\n")
+		b.WriteString(channel("ipv4"))
+		b.WriteString(channel("ipv6"))
+		for _, link := range links {
+			// BIRD 只支持 wired 和 wireless 两种接口类型
+			linkType := "wired"
+			if link.Options.Type == "wireless" {
+				linkType = "wireless"
+			}
+			fmt.Fprintf(&b, "\tinterface \"{WGPrefix}%s\" {\n\t\ttype %s;\n\t\tport %d;\n", link.Name, linkType, s.config.Network.BabelPort)
+			if link.Options.RxCost > 0 {
+				fmt.Fprintf(&b, "\t\trxcost %d;\n", link.Options.RxCost)
+			}
+			if link.Options.HelloInterval > 0 {
+				fmt.Fprintf(&b, "\t\thello interval %d ms;\n", int(link.Options.HelloInterval*1000))
+			}
+			if link.Options.UpdateInterval > 0 {
+				fmt.Fprintf(&b, "\t\tupdate interval %d ms;\n", int(link.Options.UpdateInterval*1000))
+			}
+			b.WriteString("\t};\n")
+		}
+		b.WriteString("}\n")
+	case types.RoutingDaemonBirdOSPF:
+		for _, family := range []struct{ version, name string }{{"v2", "ipv4"}, {"v3", "ipv6"}} {
+			fmt.Fprintf(&b, "\nprotocol ospf %s %s {\n", family.version, protocols[family.name])
+			b.WriteString(channel(family.name))
+			b.WriteString("\tarea 0 {\n")
+			for _, link := range links {
+				cost := birdOSPFDefaultCost
+				if link.Options.RxCost > 0 {
+					cost = link.Options.RxCost
+				}
+				fmt.Fprintf(&b, "\t\tinterface \"{WGPrefix}%s\" {\n\t\t\ttype ptp;\n\t\t\tcost %d;\n", link.Name, cost)
+				if link.Options.HelloInterval >= 1 {
+					fmt.Fprintf(&b, "\t\t\thello %d;\n", int(link.Options.HelloInterval))
+				}
+				b.WriteString("\t\t};\n")
+			}
+			b.WriteString("\t};\n}\n")
+		}
+	}
+	return b.String()
+}
+
+// generateStaticRoutes 为全互联拓扑生成静态路由：对等节点的网段经直连链路转发，
+// 客户端地址经其首个与本节点直连的网关转发
+//
+// 只使用主链路，附加路径和链路故障都不会触发切换；没有直连链路的节点不可达。
+func (s *ConfigService) generateStaticRoutes(node *types.NodeConfig, peers []*types.NodeConfig, conns map[int]*types.WireguardConnection, clients []*types.ClientPeer) []types.StaticRoute {
+	routes := []types.StaticRoute{}
+	ifaces := make(map[int]string, len(peers))
+	for _, peer := range peers {
+		conn, ok := conns[peer.ID]
+		if !ok || peer.ID == node.ID {
+			continue
+		}
+		ifaces[peer.ID] = conn.InterfaceName(peerInterface(s.config, peer))
+		for _, prefix := range s.nodePrefixes(peer.AddressNumber()) {
+			routes = append(routes, types.StaticRoute{Prefix: prefix, Interface: ifaces[peer.ID]})
+		}
+	}
+	for _, client := range clients {
+		if client.HasGateway(node.ID) {
+			continue
+		}
+		for _, gatewayID := range client.GatewayIDs {
+			if iface, ok := ifaces[gatewayID]; ok {
+				for _, prefix := range clientPrefixes(client) {
+					routes = append(routes, types.StaticRoute{Prefix: prefix, Interface: iface})
+				}
+				break
+			}
+		}
+	}
+	return routes
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+
+	"github.com/rs/zerolog"
+)
+
+// SecretRefresher 定期重新读取配置中引用的外部 secret
+//
+// JWT 签名密钥可以在运行时轮换，轮换前签发的 token 在过期前仍然有效；
+// 数据库、Redis 等连接参数在建立连接时使用，变化后需要重启服务端才能生效。
+type SecretRefresher struct {
+	config  *config.ServerConfig
+	logger  zerolog.Logger
+	jwtAuth *middleware.JWTAuthenticator
+
+	// 当前生效的值，配置本身不会更新
+	current map[string]string
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSecretRefresher 创建外部 secret 刷新服务
+func NewSecretRefresher(cfg *config.ServerConfig, logger zerolog.Logger, jwtAuth *middleware.JWTAuthenticator) *SecretRefresher {
+	return &SecretRefresher{
+		config:  cfg,
+		logger:  logger.With().Str("service", "secrets").Logger(),
+		jwtAuth: jwtAuth,
+		current: cfg.ResolvedSecrets(),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start 启动刷新协程，未配置刷新间隔或没有外部引用时不启动
+func (r *SecretRefresher) Start() {
+	if r.config.Secrets.RefreshInterval <= 0 || !r.config.HasSecretRefs() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer cancel()
+
+		ticker := time.NewTicker(r.config.Secrets.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				r.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+// Stop 停止刷新协程
+func (r *SecretRefresher) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
+
+// Refresh 重新读取一次外部 secret 并应用变化
+func (r *SecretRefresher) Refresh(ctx context.Context) {
+	values, err := r.config.FetchSecrets(ctx)
+	if err != nil {
+		// 读取失败时继续使用当前的值
+		r.logger.Error().Err(err).Msg("Failed to refresh secrets")
+		return
+	}
+	for name, value := range values {
+		if r.current[name] == value {
+			continue
+		}
+		r.current[name] = value
+		switch name {
+		case config.SecretJWT:
+			r.jwtAuth.SetSecret([]byte(value))
+			r.logger.Info().Str("secret", name).Msg("Rotated secret")
+		default:
+			r.logger.Warn().Str("secret", name).Msg("Secret changed, restart the server to apply it")
+		}
+	}
+}
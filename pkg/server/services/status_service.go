@@ -3,18 +3,26 @@ package services
 import (
 	"context"
 	"sync"
-	"time"
 
 	pb "mesh-backend/api/proto/status"
 	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/metrics"
+	"mesh-backend/pkg/server/ephemeral"
 	"mesh-backend/pkg/server/middleware"
 	"mesh-backend/pkg/store"
 	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
 
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	statusUpdatesDropped  = metrics.NewCounter("mesh_status_updates_dropped_total", "Status updates dropped because a subscriber queue was full")
+	statusSubscriberGauge = metrics.NewGauge("mesh_status_subscribers", "Number of connected status subscribers on this replica")
 )
 
 // StatusService 实现状态管理服务
@@ -25,26 +33,150 @@ type StatusService struct {
 	logger   zerolog.Logger
 	store    store.Store
 	nodeAuth *middleware.NodeAuthenticator
+	jwtAuth  *middleware.JWTAuthenticator
 
-	// 节点状态管理
-	nodeStatuses      map[int32]*pb.NodeStatus
-	nodeStatusesMu    sync.RWMutex
-	statusSubscribers map[string][]pb.StatusService_SubscribeStatusServer
+	// 节点最新状态保存在临时状态中，本副本只管理自己的订阅者
+	state             ephemeral.State
+	statusSubscribers map[string][]*statusSubscriber
 	subscribersMu     sync.RWMutex
+
+	// 状态写入缓冲
+	pendingStatuses map[int]*types.NodeStatus
+	lastStates      map[int]string
+	pendingMu       sync.Mutex
+	flushCh         chan struct{}
+	stopCh          chan struct{}
+	wg              sync.WaitGroup
+
+	// 流量统计，为空时不统计
+	usage *UsageService
+
+	// 时间源，测试中可替换
+	clock clock.Clock
 }
 
 // NewStatusService 创建状态服务实例
-func NewStatusService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeAuth *middleware.NodeAuthenticator) *StatusService {
+func NewStatusService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeAuth *middleware.NodeAuthenticator, jwtAuth *middleware.JWTAuthenticator, state ephemeral.State) *StatusService {
 	return &StatusService{
 		config:            cfg,
 		logger:            logger.With().Str("service", "status").Logger(),
 		store:             store,
 		nodeAuth:          nodeAuth,
-		nodeStatuses:      make(map[int32]*pb.NodeStatus),
-		statusSubscribers: make(map[string][]pb.StatusService_SubscribeStatusServer),
+		jwtAuth:           jwtAuth,
+		state:             state,
+		statusSubscribers: make(map[string][]*statusSubscriber),
+		pendingStatuses:   make(map[int]*types.NodeStatus),
+		lastStates:        make(map[int]string),
+		flushCh:           make(chan struct{}, 1),
+		stopCh:            make(chan struct{}),
+		clock:             clock.Real(),
 	}
 }
 
+// SetClock 替换时间源，需在服务启动前调用
+func (s *StatusService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetUsage 设置流量统计服务，需在服务启动前调用
+func (s *StatusService) SetUsage(usage *UsageService) {
+	s.usage = usage
+}
+
+// Start 启动状态批量写入协程并订阅其他副本的状态更新
+func (s *StatusService) Start() {
+	s.state.Subscribe(ephemeral.ChannelStatus, s.handleStatusEvent)
+
+	s.wg.Add(1)
+	go s.flushLoop()
+}
+
+// Stop 停止状态批量写入协程并写入剩余状态
+func (s *StatusService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// flushLoop 按间隔或缓冲大小批量写入状态
+func (s *StatusService) flushLoop() {
+	defer s.wg.Done()
+
+	ticker := s.clock.NewTicker(s.config.Status.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			s.flushStatuses()
+			return
+		case <-ticker.C():
+			s.flushStatuses()
+		case <-s.flushCh:
+			s.flushStatuses()
+		}
+	}
+}
+
+// flushStatuses 将缓冲中的状态批量写入存储
+func (s *StatusService) flushStatuses() {
+	s.pendingMu.Lock()
+	if len(s.pendingStatuses) == 0 {
+		s.pendingMu.Unlock()
+		return
+	}
+	batch := make([]*types.NodeStatus, 0, len(s.pendingStatuses))
+	for _, status := range s.pendingStatuses {
+		batch = append(batch, status)
+	}
+	s.pendingStatuses = make(map[int]*types.NodeStatus)
+	s.pendingMu.Unlock()
+
+	if err := s.store.UpdateNodeStatuses(batch); err != nil {
+		s.logger.Error().
+			Err(err).
+			Int("count", len(batch)).
+			Msg("Failed to flush node statuses")
+		s.restoreStatuses(batch)
+	}
+}
+
+// restoreStatuses 将写入失败的状态放回缓冲，节点在此期间有新的上报时保留新状态
+func (s *StatusService) restoreStatuses(batch []*types.NodeStatus) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	for _, status := range batch {
+		if pending, ok := s.pendingStatuses[status.NodeID]; ok && pending.Timestamp.After(status.Timestamp) {
+			continue
+		}
+		s.pendingStatuses[status.NodeID] = status
+	}
+}
+
+// saveStatus 缓冲节点状态，状态发生转换时立即写入
+func (s *StatusService) saveStatus(status *types.NodeStatus) error {
+	s.pendingMu.Lock()
+	lastState, seen := s.lastStates[status.NodeID]
+	s.lastStates[status.NodeID] = status.Status
+	if !seen || lastState != status.Status {
+		// 状态转换直接写入，保证在线状态及时可见
+		delete(s.pendingStatuses, status.NodeID)
+		s.pendingMu.Unlock()
+		return s.store.UpdateNodeStatus(status.NodeID, status)
+	}
+
+	s.pendingStatuses[status.NodeID] = status
+	full := len(s.pendingStatuses) >= s.config.Status.BatchSize
+	s.pendingMu.Unlock()
+
+	if full {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
 // RegisterGRPC 注册gRPC服务
 func (s *StatusService) RegisterGRPC(server *grpc.Server) {
 	pb.RegisterStatusServiceServer(server, s)
@@ -53,53 +185,62 @@ func (s *StatusService) RegisterGRPC(server *grpc.Server) {
 // ReportStatus 实现状态上报
 func (s *StatusService) ReportStatus(ctx context.Context, req *pb.StatusReport) (*pb.StatusResponse, error) {
 	// 验证节点身份
-	if !s.nodeAuth.ValidateToken(int(req.NodeId), req.Token) {
+	if !s.nodeAuth.ValidateCredentials(ctx, int(req.NodeId), req.Token) {
 		return &pb.StatusResponse{
 			Success: false,
 			Message: "Invalid credentials",
 		}, status.Error(codes.Unauthenticated, "invalid credentials")
 	}
+	if req.Status == nil {
+		return &pb.StatusResponse{
+			Success: false,
+			Message: "Missing status",
+		}, status.Error(codes.InvalidArgument, "missing status")
+	}
+	// 状态中的节点 ID 以认证结果为准，节点不能上报其他节点的状态
+	req.Status.NodeId = req.NodeId
+
+	// 上一次上报保存在副本共享的状态中，流量统计据此计算差值
+	var prev *types.NodeStatus
+	if last, err := s.state.Status(req.NodeId); err != nil {
+		s.logger.Error().
+			Err(err).
+			Int32("node_id", req.NodeId).
+			Msg("Failed to load previous node status")
+	} else if last != nil {
+		prev = types.NodeStatusFromProto(last)
+	}
 
 	// 更新节点状态
-	s.nodeStatusesMu.Lock()
-	s.nodeStatuses[req.NodeId] = req.Status
-	s.nodeStatusesMu.Unlock()
+	if err := s.state.SetStatus(req.Status); err != nil {
+		s.logger.Error().
+			Err(err).
+			Int32("node_id", req.NodeId).
+			Msg("Failed to update node status")
+		// 共享状态仍是上一次上报，这段流量留到下次上报再计入，避免重复统计
+		prev = nil
+	}
 
-	// 广播状态更新给订阅者
-	s.subscribersMu.RLock()
-	for _, subscribers := range s.statusSubscribers {
-		for _, subscriber := range subscribers {
-			if err := subscriber.Send(req.Status); err != nil {
-				s.logger.Error().
-					Err(err).
-					Int32("node_id", req.NodeId).
-					Msg("Failed to send status update to subscriber")
-			}
+	// 通知所有副本（包括本副本）将状态更新广播给各自的订阅者
+	if data, err := proto.Marshal(req.Status); err == nil {
+		if err := s.state.Publish(ephemeral.ChannelStatus, data); err != nil {
+			s.logger.Error().
+				Err(err).
+				Int32("node_id", req.NodeId).
+				Msg("Failed to publish status update")
 		}
 	}
-	s.subscribersMu.RUnlock()
-
-	// 保存状态到存储
-	if err := s.store.UpdateNodeStatus(int(req.Status.NodeId), &types.NodeStatus{
-		NodeID:    int(req.Status.NodeId),
-		Hostname:  req.Status.Hostname,
-		IPAddress: req.Status.IpAddress,
-		Metrics: types.SystemMetrics{
-			CPUUsage:    req.Status.Metrics.CpuUsage,
-			MemoryUsage: req.Status.Metrics.MemoryUsage,
-			DiskUsage:   req.Status.Metrics.DiskUsage,
-			Uptime:      req.Status.Metrics.Uptime,
-		},
-		RunningTasks: req.Status.RunningTasks,
-		Status:       req.Status.Status,
-		Version:      req.Status.Version,
-		Timestamp:    time.Unix(0, req.Status.Timestamp),
-	}); err != nil {
+
+	// 保存状态到存储，时间以本副本收到上报的时间为准，存储据此丢弃晚到的旧状态
+	nodeStatus := types.NodeStatusFromProto(req.Status)
+	nodeStatus.Timestamp = s.clock.Now()
+	if err := s.saveStatus(nodeStatus); err != nil {
 		s.logger.Error().
 			Err(err).
 			Int32("node_id", req.NodeId).
 			Msg("Failed to save node status")
 	}
+	s.usage.Record(prev, nodeStatus)
 
 	return &pb.StatusResponse{
 		Success: true,
@@ -107,70 +248,133 @@ func (s *StatusService) ReportStatus(ctx context.Context, req *pb.StatusReport)
 	}, nil
 }
 
+// handleStatusEvent 将副本间的状态更新广播给本副本的订阅者
+func (s *StatusService) handleStatusEvent(payload []byte) {
+	nodeStatus := &pb.NodeStatus{}
+	if err := proto.Unmarshal(payload, nodeStatus); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to decode status update")
+		return
+	}
+
+	s.subscribersMu.RLock()
+	defer s.subscribersMu.RUnlock()
+	for _, subscribers := range s.statusSubscribers {
+		for _, subscriber := range subscribers {
+			if subscriber.wantsNode(nodeStatus.NodeId) {
+				subscriber.enqueue(nodeStatus)
+			}
+		}
+	}
+}
+
 // SubscribeStatus 实现状态订阅
+//
+// token 为用户登录获得的 JWT，只推送 token 所属租户的节点，请求中的 tenant_ids 被忽略。
 func (s *StatusService) SubscribeStatus(req *pb.StatusSubscribeRequest, stream pb.StatusService_SubscribeStatusServer) error {
 	// 验证订阅者身份
-	if !s.validateSubscriber(req.Token) {
+	claims, ok := s.validateSubscriber(req.Token)
+	if !ok {
 		return status.Error(codes.Unauthenticated, "invalid subscriber token")
 	}
+	return s.subscribe(req, claims.TenantID, stream)
+}
 
-	// 注册订阅者
+// subscribe 注册租户 tenantID 的订阅者并推送状态，直到连接断开
+func (s *StatusService) subscribe(req *pb.StatusSubscribeRequest, tenantID int, stream pb.StatusService_SubscribeStatusServer) error {
+	// 注册订阅者，发送初始状态期间的更新在队列中等待
+	subscriber := s.newStatusSubscriber(req, tenantID, stream)
 	s.subscribersMu.Lock()
-	s.statusSubscribers[req.Token] = append(s.statusSubscribers[req.Token], stream)
+	s.statusSubscribers[req.Token] = append(s.statusSubscribers[req.Token], subscriber)
 	s.subscribersMu.Unlock()
+	statusSubscriberGauge.Add(1)
 
 	// 发送当前所有节点状态
-	s.nodeStatusesMu.RLock()
-	for _, nodeStatus := range s.nodeStatuses {
-		if err := stream.Send(nodeStatus); err != nil {
+	statuses, err := s.state.Statuses()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load node statuses")
+	}
+	for _, nodeStatus := range statuses {
+		update := subscriber.update(nodeStatus)
+		if update == nil {
+			continue
+		}
+		if err := stream.Send(update); err != nil {
 			s.logger.Error().
 				Err(err).
 				Msg("Failed to send initial status to subscriber")
 		}
 	}
-	s.nodeStatusesMu.RUnlock()
 
-	// 等待连接断开
-	<-stream.Context().Done()
+	// 发送状态更新直到连接断开
+	for done := false; !done; {
+		select {
+		case <-stream.Context().Done():
+			done = true
+		case nodeStatus := <-subscriber.queue:
+			update := subscriber.update(nodeStatus)
+			if update == nil {
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				s.logger.Error().
+					Err(err).
+					Int32("node_id", nodeStatus.NodeId).
+					Msg("Failed to send status update to subscriber")
+			}
+		}
+	}
 
 	// 移除订阅者
 	s.subscribersMu.Lock()
 	subscribers := s.statusSubscribers[req.Token]
 	for i, sub := range subscribers {
-		if sub == stream {
+		if sub == subscriber {
 			s.statusSubscribers[req.Token] = append(subscribers[:i], subscribers[i+1:]...)
 			break
 		}
 	}
+	if len(s.statusSubscribers[req.Token]) == 0 {
+		delete(s.statusSubscribers, req.Token)
+	}
 	s.subscribersMu.Unlock()
+	statusSubscriberGauge.Add(-1)
 
 	return nil
 }
 
-// validateSubscriber 验证订阅者身份
-func (s *StatusService) validateSubscriber(token string) bool {
-	// TODO: 实现订阅者身份验证逻辑
-	// 这里可以根据实际需求实现不同的验证方式
-	return token != ""
+// validateSubscriber 验证订阅者的 JWT，返回其中的用户信息
+func (s *StatusService) validateSubscriber(token string) (*middleware.Claims, bool) {
+	if token == "" {
+		return nil, false
+	}
+	claims, err := s.jwtAuth.ParseToken(token)
+	if err != nil {
+		s.logger.Debug().Err(err).Msg("Rejected status subscriber token")
+		return nil, false
+	}
+	// 需修改密码的用户只能修改密码
+	if claims.MustChangePassword {
+		return nil, false
+	}
+	return claims, true
 }
 
 // GetNodeStatus 获取指定节点的状态
 func (s *StatusService) GetNodeStatus(nodeID int32) (*pb.NodeStatus, bool) {
-	s.nodeStatusesMu.RLock()
-	defer s.nodeStatusesMu.RUnlock()
-
-	status, exists := s.nodeStatuses[nodeID]
-	return status, exists
+	status, err := s.state.Status(nodeID)
+	if err != nil {
+		s.logger.Error().Err(err).Int32("node_id", nodeID).Msg("Failed to load node status")
+		return nil, false
+	}
+	return status, status != nil
 }
 
 // GetAllNodeStatuses 获取所有节点的状态
 func (s *StatusService) GetAllNodeStatuses() map[int32]*pb.NodeStatus {
-	s.nodeStatusesMu.RLock()
-	defer s.nodeStatusesMu.RUnlock()
-
-	statuses := make(map[int32]*pb.NodeStatus, len(s.nodeStatuses))
-	for nodeID, status := range s.nodeStatuses {
-		statuses[nodeID] = status
+	statuses, err := s.state.Statuses()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load node statuses")
+		return map[int32]*pb.NodeStatus{}
 	}
 	return statuses
 }
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "mesh-backend/api/proto/status"
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ephemeral"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/rs/zerolog"
+)
+
+// TestReportStatusAcrossReplicas 节点在副本间切换上报时流量只计入一次，状态中的节点 ID 以认证结果为准
+func TestReportStatusAcrossReplicas(t *testing.T) {
+	cfg := config.DefaultServerConfig()
+	logger := zerolog.Nop()
+	st := store.NewMemoryStore()
+	state := ephemeral.NewMemory()
+	createTestNodes(t, st, 2)
+
+	nodeAuth := middleware.NewNodeAuthenticator(logger, st)
+	jwtAuth := middleware.NewJWTAuthenticator(logger, st, []byte("test"))
+	var replicas []*StatusService
+	var usages []*UsageService
+	for i := 0; i < 2; i++ {
+		s := NewStatusService(cfg, logger, st, nodeAuth, jwtAuth, state)
+		usage := NewUsageService(cfg, logger, st, nil)
+		s.SetUsage(usage)
+		replicas = append(replicas, s)
+		usages = append(usages, usage)
+	}
+
+	// 节点 1 冒充节点 2 上报，累计计数依次发往两个副本
+	for i, rx := range []int64{100, 250, 400, 700} {
+		_, err := replicas[i%2].ReportStatus(context.Background(), &pb.StatusReport{
+			NodeId: 1,
+			Token:  "token-1",
+			Status: &pb.NodeStatus{
+				NodeId: 2,
+				Wireguard: &pb.WireGuardStatus{Peers: []*pb.WireGuardPeer{
+					{PublicKey: "pub-2", RxBytes: rx, TxBytes: rx / 2},
+				}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("ReportStatus: %v", err)
+		}
+	}
+
+	if spoofed, _ := state.Status(2); spoofed != nil {
+		t.Error("status reported by node 1 was stored for node 2")
+	}
+	if reported, _ := state.Status(1); reported == nil {
+		t.Error("status of node 1 not stored")
+	}
+
+	for _, usage := range usages {
+		usage.flush()
+	}
+	node, err := st.GetNode(1)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	rows, err := st.ListTrafficUsage(store.UsageFilter{TenantID: node.TenantID, NodeID: 1})
+	if err != nil {
+		t.Fatalf("ListTrafficUsage: %v", err)
+	}
+	var rx, tx int64
+	for _, row := range rows {
+		rx += row.RxBytes
+		tx += row.TxBytes
+	}
+	if rx != 600 || tx != 300 {
+		t.Errorf("usage rx=%d tx=%d, want rx=600 tx=300", rx, tx)
+	}
+}
+
+// TestFlushStatusesKeepsNewerStatus 延迟写入的批次不覆盖已保存的新状态
+func TestFlushStatusesKeepsNewerStatus(t *testing.T) {
+	cfg := config.DefaultServerConfig()
+	logger := zerolog.Nop()
+	st := store.NewMemoryStore()
+	s := NewStatusService(cfg, logger, st, nil, nil, ephemeral.NewMemory())
+
+	reported := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := st.UpdateNodeStatus(1, &types.NodeStatus{Status: "offline", Timestamp: reported.Add(time.Minute)}); err != nil {
+		t.Fatalf("UpdateNodeStatus: %v", err)
+	}
+	s.pendingStatuses[1] = &types.NodeStatus{NodeID: 1, Status: "online", Timestamp: reported}
+	s.flushStatuses()
+
+	stored, err := st.GetNodeStatus(1)
+	if err != nil {
+		t.Fatalf("GetNodeStatus: %v", err)
+	}
+	if stored.Status != "offline" {
+		t.Errorf("stored status = %s, want the newer offline status", stored.Status)
+	}
+}
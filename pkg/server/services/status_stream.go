@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "mesh-backend/api/proto/status"
+	"mesh-backend/pkg/server/middleware"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// sseKeepAliveInterval SSE 心跳间隔，避免代理因空闲断开连接
+const sseKeepAliveInterval = 15 * time.Second
+
+// statusJSON 状态事件的 JSON 编码，字段名与 proto 定义一致
+var statusJSON = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// RegisterRoutes 注册路由
+func (s *StatusService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.GET("/status/stream", s.HandleStatusStream)
+}
+
+// HandleStatusStream 以 Server-Sent Events 推送节点状态更新，供浏览器通过 EventSource 订阅
+//
+// 复用 gRPC SubscribeStatus 的订阅逻辑：先推送当前所有节点状态，之后推送每次上报，只包含当前租户的节点。
+// 查询参数 node_id 可重复，只订阅指定节点；delta=true 时启用增量推送，keepalive 为心跳间隔（秒）。
+func (s *StatusService) HandleStatusStream(c *gin.Context) {
+	req := &pb.StatusSubscribeRequest{
+		Token: fmt.Sprintf("dashboard:%d", c.GetInt("user_id")),
+		Delta: c.Query("delta") == "true",
+	}
+	for _, value := range c.QueryArray("node_id") {
+		nodeID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+			return
+		}
+		req.NodeIds = append(req.NodeIds, int32(nodeID))
+	}
+	if value := c.Query("keepalive"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid keepalive"})
+			return
+		}
+		req.KeepaliveSeconds = int32(seconds)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	stream := &sseStatusStream{
+		ctx:    c.Request.Context(),
+		w:      c.Writer,
+		status: s,
+	}
+
+	go stream.keepAlive()
+	defer stream.close()
+
+	if err := s.subscribe(req, middleware.TenantID(c), stream); err != nil {
+		s.logger.Error().Err(err).Msg("Status stream subscription failed")
+	}
+}
+
+// sseStatusStream 将 gRPC 状态订阅流适配为 SSE 响应
+type sseStatusStream struct {
+	grpc.ServerStream
+
+	ctx    context.Context
+	status *StatusService
+
+	mu     sync.Mutex
+	w      gin.ResponseWriter
+	closed bool // 请求处理结束后不能再写入响应
+}
+
+// Context 返回 HTTP 请求的上下文，客户端断开时取消订阅
+func (s *sseStatusStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send 以 status 事件推送节点状态，订阅已限定为当前租户的节点
+func (s *sseStatusStream) Send(status *pb.NodeStatus) error {
+	data, err := statusJSON.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return s.write(fmt.Sprintf("event: status\ndata: %s\n\n", data))
+}
+
+// write 写入并立即刷新一段事件
+func (s *sseStatusStream) write(event string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return context.Canceled
+	}
+	if _, err := fmt.Fprint(s.w, event); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// close 标记流已结束
+func (s *sseStatusStream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// keepAlive 定期发送 SSE 注释行作为心跳
+func (s *sseStatusStream) keepAlive() {
+	ticker := s.status.clock.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := s.write(": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"slices"
+	"time"
+
+	pb "mesh-backend/api/proto/status"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultStatusKeepalive 增量订阅未指定心跳间隔时使用的默认值
+const defaultStatusKeepalive = 30 * time.Second
+
+// statusSubscriber 状态订阅者，更新经有界队列由订阅者自己的协程发送，慢订阅者不阻塞状态上报
+type statusSubscriber struct {
+	service *StatusService
+	stream  pb.StatusService_SubscribeStatusServer
+	queue   chan *pb.NodeStatus
+
+	// 订阅者所属租户，只推送该租户的节点
+	tenantID int
+
+	// 订阅过滤，为空表示不过滤
+	nodes map[int32]bool
+
+	// 增量推送
+	delta     bool
+	keepalive time.Duration
+
+	// 以下字段只由发送协程访问
+	nodeTenants map[int32]int            // 节点所属租户缓存
+	last        map[int32]*pb.NodeStatus // 每个节点最近推送的完整状态
+	lastSent    map[int32]time.Time      // 每个节点最近一次推送的时间
+}
+
+// newStatusSubscriber 按订阅请求创建订阅者
+func (s *StatusService) newStatusSubscriber(req *pb.StatusSubscribeRequest, tenantID int, stream pb.StatusService_SubscribeStatusServer) *statusSubscriber {
+	sub := &statusSubscriber{
+		service:     s,
+		stream:      stream,
+		tenantID:    tenantID,
+		queue:       make(chan *pb.NodeStatus, s.config.Status.SubscriberBuffer),
+		delta:       req.Delta,
+		keepalive:   defaultStatusKeepalive,
+		nodeTenants: make(map[int32]int),
+		last:        make(map[int32]*pb.NodeStatus),
+		lastSent:    make(map[int32]time.Time),
+	}
+	if len(req.NodeIds) > 0 {
+		sub.nodes = make(map[int32]bool, len(req.NodeIds))
+		for _, id := range req.NodeIds {
+			sub.nodes[id] = true
+		}
+	}
+	if req.KeepaliveSeconds > 0 {
+		sub.keepalive = time.Duration(req.KeepaliveSeconds) * time.Second
+	}
+	return sub
+}
+
+// wantsNode 节点是否在订阅的节点列表中，在广播时调用，不查询存储
+func (sub *statusSubscriber) wantsNode(nodeID int32) bool {
+	return sub.nodes == nil || sub.nodes[nodeID]
+}
+
+// enqueue 将状态更新加入队列，队列已满时丢弃最旧的更新
+func (sub *statusSubscriber) enqueue(nodeStatus *pb.NodeStatus) {
+	for {
+		select {
+		case sub.queue <- nodeStatus:
+			return
+		default:
+		}
+		select {
+		case <-sub.queue:
+			statusUpdatesDropped.Inc()
+		default:
+		}
+	}
+}
+
+// update 返回需要推送给订阅者的消息，不需要推送时返回 nil
+//
+// 增量订阅时每个节点首次推送完整状态，之后只推送变化的字段；状态未变化时按心跳间隔推送心跳。
+func (sub *statusSubscriber) update(nodeStatus *pb.NodeStatus) *pb.NodeStatus {
+	if !sub.wantsNode(nodeStatus.NodeId) || !sub.wantsTenant(nodeStatus.NodeId) {
+		return nil
+	}
+	if !sub.delta {
+		return nodeStatus
+	}
+
+	now := sub.service.clock.Now()
+	prev, ok := sub.last[nodeStatus.NodeId]
+	sub.last[nodeStatus.NodeId] = nodeStatus
+	if !ok {
+		sub.lastSent[nodeStatus.NodeId] = now
+		return nodeStatus
+	}
+
+	update := statusDelta(prev, nodeStatus)
+	if len(update.ChangedFields) == 0 && now.Sub(sub.lastSent[nodeStatus.NodeId]) < sub.keepalive {
+		return nil
+	}
+	sub.lastSent[nodeStatus.NodeId] = now
+	return update
+}
+
+// wantsTenant 节点是否属于订阅者的租户
+func (sub *statusSubscriber) wantsTenant(nodeID int32) bool {
+	tenantID, ok := sub.nodeTenants[nodeID]
+	if !ok {
+		node, err := sub.service.store.GetNode(int(nodeID))
+		if err != nil {
+			return false
+		}
+		tenantID = node.TenantID
+		sub.nodeTenants[nodeID] = tenantID
+	}
+	return tenantID == sub.tenantID
+}
+
+// statusDelta 生成 next 相对 prev 的增量消息，timestamp 每次上报都会变化，不计入变化字段
+func statusDelta(prev, next *pb.NodeStatus) *pb.NodeStatus {
+	d := &pb.NodeStatus{NodeId: next.NodeId, Timestamp: next.Timestamp, Delta: true}
+	if prev.Hostname != next.Hostname {
+		d.Hostname = next.Hostname
+		d.ChangedFields = append(d.ChangedFields, "hostname")
+	}
+	if prev.IpAddress != next.IpAddress {
+		d.IpAddress = next.IpAddress
+		d.ChangedFields = append(d.ChangedFields, "ip_address")
+	}
+	if !proto.Equal(prev.Metrics, next.Metrics) {
+		d.Metrics = next.Metrics
+		d.ChangedFields = append(d.ChangedFields, "metrics")
+	}
+	if !slices.Equal(prev.RunningTasks, next.RunningTasks) {
+		d.RunningTasks = next.RunningTasks
+		d.ChangedFields = append(d.ChangedFields, "running_tasks")
+	}
+	if prev.Status != next.Status {
+		d.Status = next.Status
+		d.ChangedFields = append(d.ChangedFields, "status")
+	}
+	if prev.Version != next.Version {
+		d.Version = next.Version
+		d.ChangedFields = append(d.ChangedFields, "version")
+	}
+	if !proto.Equal(prev.Wireguard, next.Wireguard) {
+		d.Wireguard = next.Wireguard
+		d.ChangedFields = append(d.ChangedFields, "wireguard")
+	}
+	if !proto.Equal(prev.Babel, next.Babel) {
+		d.Babel = next.Babel
+		d.ChangedFields = append(d.ChangedFields, "babel")
+	}
+	if !proto.Equal(prev.Software, next.Software) {
+		d.Software = next.Software
+		d.ChangedFields = append(d.ChangedFields, "software")
+	}
+	return d
+}
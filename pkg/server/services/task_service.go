@@ -2,16 +2,26 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	pb "mesh-backend/api/proto/task"
 	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ephemeral"
 	"mesh-backend/pkg/server/middleware"
 	"mesh-backend/pkg/store"
 	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+	"mesh-backend/pkg/utils/idgen"
 
+	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -31,10 +41,27 @@ type TaskService struct {
 	nodeMu   sync.RWMutex
 	nodeAuth *middleware.NodeAuthenticator
 
-	// 任务管理
-	tasks    map[string]*types.Task
-	tasksMu  sync.RWMutex
-	taskChan chan *types.Task
+	// 副本间共享的订阅流归属和待投递任务
+	state ephemeral.State
+
+	// 配置更新合并
+	pendingUpdates map[int]*pendingUpdate
+	pendingMu      sync.Mutex
+
+	// 任务结束时的回调，按任务类型注册
+	doneHooks    map[types.TaskType][]func(task *types.Task)
+	connectHooks []func(nodeID int)
+	hooksMu      sync.RWMutex
+
+	// 时间源和任务ID生成器，测试中可替换
+	clock clock.Clock
+	ids   idgen.Generator
+}
+
+// pendingUpdate 合并窗口内尚未推送的配置更新任务
+type pendingUpdate struct {
+	task   *types.Task
+	merged int
 }
 
 // nodeState 记录节点状态
@@ -46,16 +73,157 @@ type nodeState struct {
 }
 
 // NewTaskService 创建任务服务实例
-func NewTaskService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeAuth *middleware.NodeAuthenticator) *TaskService {
+func NewTaskService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeAuth *middleware.NodeAuthenticator, state ephemeral.State) *TaskService {
+	c := clock.Real()
 	return &TaskService{
 		config:   cfg,
 		logger:   logger.With().Str("service", "task").Logger(),
 		store:    store,
 		nodes:    make(map[int32]*nodeState),
-		tasks:    make(map[string]*types.Task),
-		taskChan: make(chan *types.Task, 100),
 		nodeAuth: nodeAuth,
+		state:    state,
+
+		pendingUpdates: make(map[int]*pendingUpdate),
+		doneHooks:      make(map[types.TaskType][]func(task *types.Task)),
+
+		clock: c,
+		ids:   idgen.NewTimeGenerator(c),
+	}
+}
+
+// SetClock 替换时间源，需在服务启动前调用
+//
+// 任务ID生成器随之换为基于 c 的时间戳生成器；需要其他生成器时在之后调用 SetIDGenerator。
+func (s *TaskService) SetClock(c clock.Clock) {
+	s.clock = c
+	s.ids = idgen.NewTimeGenerator(c)
+}
+
+// SetIDGenerator 替换任务ID生成器，需在服务启动前调用
+func (s *TaskService) SetIDGenerator(g idgen.Generator) {
+	s.ids = g
+}
+
+// OnTaskDone 注册任务结束（成功、失败或进入死信队列）时的回调，taskType 为空时对所有类型生效
+//
+// 回调在收到 agent 状态回报的副本上执行，各副本需注册相同的回调。
+func (s *TaskService) OnTaskDone(taskType types.TaskType, hook func(task *types.Task)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.doneHooks[taskType] = append(s.doneHooks[taskType], hook)
+}
+
+// OnStreamConnected 注册节点建立任务订阅流时的回调
+//
+// 回调在持有订阅流的副本上执行，此时下发的任务可以立即投递。
+func (s *TaskService) OnStreamConnected(hook func(nodeID int)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.connectHooks = append(s.connectHooks, hook)
+}
+
+// Start 订阅其他副本转发的待投递任务通知
+//
+// 任务以存储为准，服务端重启前未投递的任务仍为 pending 状态，在节点重新订阅时投递。
+func (s *TaskService) Start() {
+	s.state.Subscribe(ephemeral.ChannelTasks, s.handleTaskEvent)
+
+	pending := types.TaskStatusPending
+	tasks, err := s.store.ListTasks(store.TaskFilter{Status: &pending})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load pending tasks")
+		return
+	}
+	if len(tasks) > 0 {
+		s.logger.Info().
+			Int("count", len(tasks)).
+			Msg("Loaded pending tasks, delivering when nodes reconnect")
+	}
+}
+
+// RegisterRoutes 注册路由
+func (s *TaskService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.GET("/tasks/dead-letter", s.HandleListDeadLetterTasks)
+	g.Dashboard.POST("/tasks/:id/requeue", s.HandleRequeueTask)
+	g.Dashboard.GET("/maintenance-policy", s.HandleGetMaintenancePolicy)
+	g.Dashboard.PUT("/maintenance-policy", s.HandleUpdateMaintenancePolicy)
+	g.Dashboard.DELETE("/maintenance-policy", s.HandleResetMaintenancePolicy)
+}
+
+// deadLetterTask 死信任务
+type deadLetterTask struct {
+	ID          string         `json:"id"`
+	NodeID      int            `json:"node_id"`
+	NodeName    string         `json:"node_name"`
+	Type        types.TaskType `json:"type"`
+	Error       string         `json:"error"`
+	Attempts    int            `json:"attempts"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at"`
+}
+
+// HandleListDeadLetterTasks 列出当前租户重试耗尽的任务
+func (s *TaskService) HandleListDeadLetterTasks(c *gin.Context) {
+	nodes, err := s.store.ListNodesByTenant(middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	names := make(map[int]string, len(nodes))
+	for _, node := range nodes {
+		names[node.ID] = node.Name
+	}
+
+	deadLetter := types.TaskStatusDeadLetter
+	tasks, err := s.store.ListTasks(store.TaskFilter{Status: &deadLetter})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]deadLetterTask, 0, len(tasks))
+	for _, task := range tasks {
+		name, ok := names[task.NodeID]
+		if !ok {
+			continue
+		}
+		result = append(result, deadLetterTask{
+			ID:          task.ID,
+			NodeID:      task.NodeID,
+			NodeName:    name,
+			Type:        task.Type,
+			Error:       task.Message,
+			Attempts:    task.Attempts,
+			CreatedAt:   task.CreatedAt,
+			CompletedAt: task.CompletedAt,
+		})
 	}
+	c.JSON(http.StatusOK, result)
+}
+
+// HandleRequeueTask 手动重新投递死信任务
+func (s *TaskService) HandleRequeueTask(c *gin.Context) {
+	task, err := s.store.GetTask(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	node, err := s.store.GetNode(task.NodeID)
+	if err != nil || node.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+
+	if task.Status != types.TaskStatusDeadLetter {
+		c.JSON(http.StatusConflict, gin.H{"error": "Task is not in the dead-letter queue"})
+		return
+	}
+	if err := s.RequeueTask(task); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": task.ID, "status": task.Status})
 }
 
 // RegisterGRPC 注册gRPC服务
@@ -66,31 +234,53 @@ func (s *TaskService) RegisterGRPC(server *grpc.Server) {
 // Register 实现节点注册
 func (s *TaskService) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
 	// 验证节点身份
-	if !s.nodeAuth.ValidateToken(int(req.NodeId), req.Token) {
+	if !s.nodeAuth.ValidateCredentials(ctx, int(req.NodeId), req.Token) {
 		return &pb.RegisterResponse{
 			Success: false,
 			Message: "Invalid credentials",
 		}, status.Error(codes.Unauthenticated, "invalid credentials")
 	}
 
+	// 检查本地工具是否满足节点配置的要求，检查失败不影响注册
+	warnings, err := s.checkRegistration(ctx, int(req.NodeId), req.Capabilities)
+	if err != nil {
+		s.logger.Error().Err(err).Int32("node_id", req.NodeId).Msg("Failed to check node capabilities")
+	}
+	if len(warnings) > 0 {
+		s.logger.Warn().
+			Int32("node_id", req.NodeId).
+			Strs("problems", warnings).
+			Bool("enforce", s.config.Capabilities.Enforce).
+			Msg("Node is missing required capabilities")
+		if s.config.Capabilities.Enforce {
+			message := "Missing required capabilities: " + strings.Join(warnings, "; ")
+			return &pb.RegisterResponse{
+				Success:  false,
+				Message:  message,
+				Warnings: warnings,
+			}, status.Error(codes.FailedPrecondition, message)
+		}
+	}
+
 	// 更新节点状态
 	s.nodeMu.Lock()
 	s.nodes[req.NodeId] = &nodeState{
 		token:    req.Token,
-		lastSeen: time.Now(),
+		lastSeen: s.clock.Now(),
 	}
 	s.nodeMu.Unlock()
 
 	return &pb.RegisterResponse{
-		Success: true,
-		Message: "Registration successful",
+		Success:  true,
+		Message:  "Registration successful",
+		Warnings: warnings,
 	}, nil
 }
 
 // SubscribeTasks 实现任务订阅
 func (s *TaskService) SubscribeTasks(req *pb.SubscribeRequest, stream pb.TaskService_SubscribeTasksServer) error {
 	// 验证节点身份
-	if !s.nodeAuth.ValidateToken(int(req.NodeId), req.Token) {
+	if !s.nodeAuth.ValidateCredentials(stream.Context(), int(req.NodeId), req.Token) {
 		return status.Error(codes.Unauthenticated, "invalid credentials")
 	}
 
@@ -105,82 +295,347 @@ func (s *TaskService) SubscribeTasks(req *pb.SubscribeRequest, stream pb.TaskSer
 	// 更新流和最后活动时间
 	node.streamLock.Lock()
 	node.stream = stream
-	node.lastSeen = time.Now()
+	node.lastSeen = s.clock.Now()
 	node.streamLock.Unlock()
 	s.nodeMu.Unlock()
 
-	// 保持连接直到客户端断开或上下文取消
-	<-stream.Context().Done()
+	// 声明本副本持有订阅流，并投递节点离线或连接其他副本期间排队的任务
+	ttl := s.config.Ephemeral.StreamTTL
+	if err := s.state.ClaimStream(req.NodeId, ttl); err != nil {
+		s.logger.Error().Err(err).Int32("node_id", req.NodeId).Msg("Failed to claim task stream")
+	}
+	s.deliverQueued(req.NodeId)
+	s.deliverPending(req.NodeId)
+
+	s.hooksMu.RLock()
+	hooks := s.connectHooks
+	s.hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(int(req.NodeId))
+	}
+
+	// 保持连接直到客户端断开或上下文取消，期间定期续期声明
+	ticker := s.clock.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C():
+			if err := s.state.ClaimStream(req.NodeId, ttl); err != nil {
+				s.logger.Error().Err(err).Int32("node_id", req.NodeId).Msg("Failed to renew task stream claim")
+			}
+		case <-stream.Context().Done():
+			done = true
+		}
+	}
 
 	// 清理节点状态
 	s.nodeMu.Lock()
 	if node, exists := s.nodes[req.NodeId]; exists {
 		node.streamLock.Lock()
-		node.stream = nil
+		if node.stream == stream {
+			node.stream = nil
+		}
 		node.streamLock.Unlock()
 	}
 	s.nodeMu.Unlock()
 
+	if err := s.state.ReleaseStream(req.NodeId); err != nil {
+		s.logger.Error().Err(err).Int32("node_id", req.NodeId).Msg("Failed to release task stream")
+	}
+
 	return nil
 }
 
 // UpdateTaskStatus 实现任务状态更新
 func (s *TaskService) UpdateTaskStatus(ctx context.Context, req *pb.UpdateTaskStatusRequest) (*pb.UpdateTaskStatusResponse, error) {
-	s.tasksMu.Lock()
-	defer s.tasksMu.Unlock()
+	// 验证节点身份
+	if !s.nodeAuth.ValidateCredentials(ctx, int(req.NodeId), req.Token) {
+		return &pb.UpdateTaskStatusResponse{
+			Success: false,
+			Message: "Invalid credentials",
+		}, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
 
-	task, exists := s.tasks[req.TaskId]
-	if !exists {
+	st := s.store.WithContext(ctx)
+	task, err := st.GetTask(req.TaskId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+	// 节点只能更新分配给自己的任务，不暴露其他节点的任务是否存在
+	if task.NodeID != int(req.NodeId) {
 		return nil, status.Error(codes.NotFound, "task not found")
 	}
 
 	// 更新任务状态
 	task.Status = types.TaskStatus(req.Status)
+	task.Result = req.Details
 	if req.Error != "" {
 		task.Message = req.Error
 		task.Status = types.TaskStatusFailed
 	}
-	now := time.Now()
+	now := s.clock.Now()
 	task.CompletedAt = &now
 
-	err := s.store.UpdateTask(task)
-	if err != nil {
+	// 失败的任务按配置重试，重试耗尽后进入死信队列等待人工处理
+	retry := false
+	if task.Status == types.TaskStatusFailed && task.Type.Retriable() {
+		task.Attempts++
+		if task.Attempts <= s.config.Tasks.MaxRetries {
+			task.Status = types.TaskStatusPending
+			task.StartedAt = nil
+			task.CompletedAt = nil
+			retry = true
+		} else {
+			task.Status = types.TaskStatusDeadLetter
+			s.logger.Error().
+				Str("task_id", task.ID).
+				Int("node_id", task.NodeID).
+				Int("attempts", task.Attempts).
+				Str("error", task.Message).
+				Msg("Task moved to dead-letter queue")
+		}
+	}
+
+	if err := st.UpdateTask(task); err != nil {
 		return &pb.UpdateTaskStatusResponse{
 			Success: false,
 			Message: fmt.Sprintf("Failed to update task: %s", err),
 		}, status.Error(codes.Internal, "failed to update task")
 	}
 
+	if retry {
+		s.scheduleRetry(task)
+	} else if task.Status != types.TaskStatusPending && task.Status != types.TaskStatusRunning {
+		s.hooksMu.RLock()
+		hooks := append(slices.Clone(s.doneHooks[task.Type]), s.doneHooks[""]...)
+		s.hooksMu.RUnlock()
+		for _, hook := range hooks {
+			hook(task)
+		}
+	}
+
 	return &pb.UpdateTaskStatusResponse{
 		Success: true,
 		Message: "Task status updated",
 	}, nil
 }
 
+// scheduleRetry 按已失败次数线性退避后重新推送任务
+func (s *TaskService) scheduleRetry(task *types.Task) {
+	delay := s.config.Tasks.RetryBackoff * time.Duration(task.Attempts)
+	s.logger.Warn().
+		Str("task_id", task.ID).
+		Int("node_id", task.NodeID).
+		Int("attempt", task.Attempts).
+		Dur("delay", delay).
+		Str("error", task.Message).
+		Msg("Task failed, scheduling retry")
+
+	s.clock.AfterFunc(delay, func() {
+		// 等待期间任务可能已在节点重连时投递或被取消
+		current, err := s.store.GetTask(task.ID)
+		if err != nil || current.Status != types.TaskStatusPending {
+			return
+		}
+		if err := s.PushTask(current); err != nil {
+			s.logger.Warn().
+				Err(err).
+				Str("task_id", task.ID).
+				Int("node_id", task.NodeID).
+				Msg("Failed to push task retry, will deliver on reconnect")
+		}
+	})
+}
+
+// RequeueTask 将死信任务重置为待执行并重新推送，节点不在线时在重连后投递
+func (s *TaskService) RequeueTask(task *types.Task) error {
+	if task.Status != types.TaskStatusDeadLetter {
+		return fmt.Errorf("task %s is not in the dead-letter queue", task.ID)
+	}
+
+	task.Status = types.TaskStatusPending
+	task.Attempts = 0
+	task.Message = ""
+	task.StartedAt = nil
+	task.CompletedAt = nil
+	if err := s.store.UpdateTask(task); err != nil {
+		return fmt.Errorf("updating task: %w", err)
+	}
+
+	if err := s.PushTask(task); err != nil {
+		s.logger.Info().
+			Err(err).
+			Str("task_id", task.ID).
+			Int("node_id", task.NodeID).
+			Msg("Requeued task will be delivered when node reconnects")
+	}
+	return nil
+}
+
 // CreateTask 创建新任务
 func (s *TaskService) CreateTask(taskType types.TaskType, nodeID int) (*types.Task, error) {
 	task := &types.Task{
-		ID:     generateTaskID(taskType),
-		Type:   taskType,
-		NodeID: nodeID,
-		Status: types.TaskStatusPending,
+		ID:        s.ids.NewID(string(taskType)),
+		Type:      taskType,
+		NodeID:    nodeID,
+		Status:    types.TaskStatusPending,
+		CreatedAt: s.clock.Now(),
+	}
+
+	// 保存任务到存储
+	if err := s.store.CreateTask(task); err != nil {
+		return nil, fmt.Errorf("saving task: %w", err)
 	}
 
-	s.tasksMu.Lock()
-	s.tasks[task.ID] = task
-	s.tasksMu.Unlock()
+	return task, nil
+}
 
-	// 发送任务到通道
-	s.taskChan <- task
+// CreateTaskWithParams 创建带参数的任务，参数序列化为 JSON 随任务下发
+func (s *TaskService) CreateTaskWithParams(taskType types.TaskType, nodeID int, params interface{}) (*types.Task, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encoding task params: %w", err)
+	}
 
-	// 保存任务到存储
+	task := &types.Task{
+		ID:        s.ids.NewID(string(taskType)),
+		Type:      taskType,
+		NodeID:    nodeID,
+		Status:    types.TaskStatusPending,
+		Params:    string(data),
+		CreatedAt: s.clock.Now(),
+	}
 	if err := s.store.CreateTask(task); err != nil {
 		return nil, fmt.Errorf("saving task: %w", err)
 	}
+	return task, nil
+}
+
+// CancelTask 将尚未结束的任务标记为已取消
+func (s *TaskService) CancelTask(task *types.Task, reason string) {
+	now := s.clock.Now()
+	task.Status = types.TaskStatusCanceled
+	task.Message = reason
+	task.CompletedAt = &now
+	if err := s.store.UpdateTask(task); err != nil {
+		s.logger.Error().Err(err).Str("task_id", task.ID).Msg("Failed to cancel task")
+	}
+}
+
+// ScheduleConfigUpdate 调度节点配置更新任务
+// 合并窗口内对同一节点的多次请求会合并为一个任务，窗口结束时统一推送；
+// 不在维护窗口内时任务推迟到下一个维护窗口开始时推送，期间的请求同样合并
+func (s *TaskService) ScheduleConfigUpdate(nodeID int) (*types.Task, error) {
+	window := s.config.Rollout.CoalesceWindow
+	now := s.clock.Now()
+	openAt := s.nextMaintenanceWindow(nodeID, now)
+	if wait := openAt.Sub(now); wait > window {
+		window = wait
+	}
+	if window <= 0 {
+		task, err := s.CreateTask(types.TaskTypeUpdate, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		return task, s.PushTask(task)
+	}
+
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if pending, exists := s.pendingUpdates[nodeID]; exists {
+		pending.merged++
+		s.logger.Debug().
+			Int("node_id", nodeID).
+			Str("task_id", pending.task.ID).
+			Int("merged", pending.merged).
+			Msg("Coalesced config update request")
+		return pending.task, nil
+	}
+
+	task, err := s.CreateTask(types.TaskTypeUpdate, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if openAt.After(now) {
+		s.markDeferred(task, openAt)
+	}
+	s.pendingUpdates[nodeID] = &pendingUpdate{task: task}
+
+	s.clock.AfterFunc(window, func() {
+		s.flushPendingUpdate(nodeID)
+	})
 
 	return task, nil
 }
 
+// flushPendingUpdate 合并窗口结束，推送节点的配置更新任务；维护窗口未开始时重新等待
+func (s *TaskService) flushPendingUpdate(nodeID int) {
+	s.pendingMu.Lock()
+	pending, exists := s.pendingUpdates[nodeID]
+	if exists {
+		now := s.clock.Now()
+		if openAt := s.nextMaintenanceWindow(nodeID, now); openAt.After(now) {
+			s.clock.AfterFunc(openAt.Sub(now), func() {
+				s.flushPendingUpdate(nodeID)
+			})
+			s.pendingMu.Unlock()
+			return
+		}
+	}
+	delete(s.pendingUpdates, nodeID)
+	s.pendingMu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	if err := s.PushTask(pending.task); err != nil {
+		s.logger.Warn().
+			Err(err).
+			Int("node_id", nodeID).
+			Str("task_id", pending.task.ID).
+			Msg("Failed to push coalesced config update")
+		return
+	}
+
+	if pending.merged > 0 {
+		s.logger.Info().
+			Int("node_id", nodeID).
+			Str("task_id", pending.task.ID).
+			Int("merged", pending.merged).
+			Msg("Pushed coalesced config update")
+	}
+}
+
+// holdUpdate 积压的配置更新任务推迟到维护窗口开始时推送
+func (s *TaskService) holdUpdate(task *types.Task, openAt time.Time) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if _, exists := s.pendingUpdates[task.NodeID]; exists {
+		return
+	}
+	s.markDeferred(task, openAt)
+	s.pendingUpdates[task.NodeID] = &pendingUpdate{task: task}
+	s.clock.AfterFunc(openAt.Sub(s.clock.Now()), func() {
+		s.flushPendingUpdate(task.NodeID)
+	})
+}
+
+// markDeferred 在任务消息中记录推迟到的时间
+func (s *TaskService) markDeferred(task *types.Task, openAt time.Time) {
+	task.Message = "deferred until maintenance window at " + openAt.Format(time.RFC3339)
+	if err := s.store.UpdateTask(task); err != nil {
+		s.logger.Error().Err(err).Str("task_id", task.ID).Msg("Failed to update deferred task")
+	}
+	s.logger.Info().
+		Int("node_id", task.NodeID).
+		Str("task_id", task.ID).
+		Time("open_at", openAt).
+		Msg("Config update deferred until maintenance window")
+}
+
 // BroadcastTask 广播任务到所有节点
 func (s *TaskService) BroadcastTask(task *types.Task) error {
 	s.nodeMu.RLock()
@@ -188,8 +643,9 @@ func (s *TaskService) BroadcastTask(task *types.Task) error {
 
 	// 创建gRPC任务消息
 	pbTask := &pb.Task{
-		Id:   task.ID,
-		Type: string(task.Type),
+		Id:     task.ID,
+		Type:   string(task.Type),
+		Params: task.Params,
 	}
 
 	// 广播到所有节点
@@ -210,50 +666,200 @@ func (s *TaskService) BroadcastTask(task *types.Task) error {
 	return nil
 }
 
-// generateTaskID 生成任务ID
-func generateTaskID(taskType types.TaskType) string {
-	return fmt.Sprintf("%s_%d", string(taskType), time.Now().UnixNano())
-}
-
 // PushTask 推送任务
+//
+// 节点的订阅流在本副本时直接发送；在其他副本时加入共享队列并通知持有订阅流的副本投递。
+// 推送失败的任务保持 pending 状态，节点重新订阅时再投递。
 func (s *TaskService) PushTask(task *types.Task) error {
-	now := time.Now()
+	// 先标记为执行中再发送，避免覆盖 agent 很快回报的结果
+	now := s.clock.Now()
 	task.StartedAt = &now
+	task.Status = types.TaskStatusRunning
 	s.store.UpdateTask(task)
 
-	// 查找节点状态
+	if err := s.pushTask(task); err != nil {
+		task.StartedAt = nil
+		task.Status = types.TaskStatusPending
+		s.store.UpdateTask(task)
+		return err
+	}
+	return nil
+}
+
+// pushTask 将任务发送到本副本的订阅流或转发给持有订阅流的副本
+func (s *TaskService) pushTask(task *types.Task) error {
+	nodeID := int32(task.NodeID)
+
+	// 转换为 protobuf 任务
+	pbTask := &pb.Task{
+		Id:     task.ID,
+		Type:   string(task.Type),
+		Params: task.Params,
+	}
+
+	sent, err := s.sendLocal(nodeID, pbTask)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		elsewhere, err := s.state.StreamElsewhere(nodeID)
+		if err != nil {
+			return fmt.Errorf("looking up stream owner: %w", err)
+		}
+		if !elsewhere {
+			return fmt.Errorf("node %d stream not available", nodeID)
+		}
+		if err := s.state.EnqueueTask(nodeID, pbTask); err != nil {
+			return fmt.Errorf("queueing task: %w", err)
+		}
+		if err := s.state.Publish(ephemeral.ChannelTasks, []byte(strconv.Itoa(int(nodeID)))); err != nil {
+			return fmt.Errorf("notifying stream owner: %w", err)
+		}
+	}
+
+	s.logger.Info().
+		Str("task_id", task.ID).
+		Str("type", string(task.Type)).
+		Int32("node_id", nodeID).
+		Bool("forwarded", !sent).
+		Msg("Task pushed to node")
+
+	return nil
+}
+
+// sendLocal 通过本副本持有的订阅流发送任务，节点未连接到本副本时返回 false
+func (s *TaskService) sendLocal(nodeID int32, task *pb.Task) (bool, error) {
 	s.nodeMu.RLock()
-	node, exists := s.nodes[int32(task.NodeID)]
+	node, exists := s.nodes[nodeID]
 	s.nodeMu.RUnlock()
 
 	if !exists {
-		return fmt.Errorf("node %d not found", int32(task.NodeID))
+		return false, nil
 	}
 
-	// 推送任务到节点
 	node.streamLock.Lock()
 	defer node.streamLock.Unlock()
 
 	if node.stream == nil {
-		return fmt.Errorf("node %d stream not available", int32(task.NodeID))
+		return false, nil
 	}
 
-	// 转换为 protobuf 任务
-	pbTask := &pb.Task{
-		Id:   task.ID,
-		Type: string(task.Type),
+	if err := node.stream.Send(task); err != nil {
+		return false, fmt.Errorf("sending task: %w", err)
 	}
+	return true, nil
+}
 
-	// 发送任务
-	if err := node.stream.Send(pbTask); err != nil {
-		return fmt.Errorf("sending task: %w", err)
+// handleTaskEvent 其他副本为节点排队了任务，节点连接在本副本时投递
+func (s *TaskService) handleTaskEvent(payload []byte) {
+	nodeID, err := strconv.Atoi(string(payload))
+	if err != nil {
+		return
 	}
 
-	s.logger.Info().
-		Str("task_id", task.ID).
-		Str("type", string(task.Type)).
-		Int32("node_id", int32(task.NodeID)).
-		Msg("Task pushed to node")
+	s.nodeMu.RLock()
+	node, exists := s.nodes[int32(nodeID)]
+	s.nodeMu.RUnlock()
+	if !exists {
+		return
+	}
 
-	return nil
+	node.streamLock.Lock()
+	connected := node.stream != nil
+	node.streamLock.Unlock()
+	if connected {
+		s.deliverQueued(int32(nodeID))
+	}
+}
+
+// deliverPending 投递存储中节点积压的 pending 任务
+//
+// 配置更新任务只需投递最新的一个，较早的标记为已取消；仍在合并窗口内的任务由窗口结束时推送，
+// 不在维护窗口内时推迟到维护窗口开始时推送。
+func (s *TaskService) deliverPending(nodeID int32) {
+	id := int(nodeID)
+	pending := types.TaskStatusPending
+	tasks, err := s.store.ListTasks(store.TaskFilter{NodeID: &id, Status: &pending})
+	if err != nil {
+		s.logger.Error().Err(err).Int32("node_id", nodeID).Msg("Failed to load pending tasks")
+		return
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+
+	s.pendingMu.Lock()
+	held := s.pendingUpdates[id]
+	s.pendingMu.Unlock()
+
+	var latestUpdate *types.Task
+	for _, task := range tasks {
+		if held != nil && held.task.ID == task.ID {
+			continue
+		}
+		if task.Type != types.TaskTypeUpdate {
+			s.pushPending(task)
+			continue
+		}
+		if latestUpdate != nil {
+			s.supersede(latestUpdate)
+		}
+		latestUpdate = task
+	}
+	if latestUpdate != nil {
+		now := s.clock.Now()
+		if openAt := s.nextMaintenanceWindow(id, now); openAt.After(now) {
+			s.holdUpdate(latestUpdate, openAt)
+		} else {
+			s.pushPending(latestUpdate)
+		}
+	}
+}
+
+// pushPending 推送积压任务，失败时任务保持 pending 状态
+func (s *TaskService) pushPending(task *types.Task) {
+	if err := s.PushTask(task); err != nil {
+		s.logger.Warn().
+			Err(err).
+			Int("node_id", task.NodeID).
+			Str("task_id", task.ID).
+			Msg("Failed to deliver pending task")
+	}
+}
+
+// supersede 将被更新的配置更新任务标记为已取消
+func (s *TaskService) supersede(task *types.Task) {
+	s.CancelTask(task, "superseded by a newer config update")
+}
+
+// deliverQueued 投递节点共享队列中的任务，发送失败的任务放回队列等待节点重连
+func (s *TaskService) deliverQueued(nodeID int32) {
+	tasks, err := s.state.DrainTasks(nodeID)
+	if err != nil {
+		s.logger.Error().Err(err).Int32("node_id", nodeID).Msg("Failed to load queued tasks")
+		return
+	}
+
+	for i, task := range tasks {
+		sent, err := s.sendLocal(nodeID, task)
+		if err == nil && sent {
+			continue
+		}
+
+		for _, remaining := range tasks[i:] {
+			if err := s.state.EnqueueTask(nodeID, remaining); err != nil {
+				s.logger.Error().
+					Err(err).
+					Int32("node_id", nodeID).
+					Str("task_id", remaining.Id).
+					Msg("Failed to requeue task")
+			}
+		}
+		return
+	}
+
+	if len(tasks) > 0 {
+		s.logger.Info().
+			Int32("node_id", nodeID).
+			Int("count", len(tasks)).
+			Msg("Delivered queued tasks")
+	}
 }
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "mesh-backend/api/proto/task"
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/ephemeral"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestTaskService(t *testing.T, window time.Duration) (*TaskService, *store.MemoryStore, *clock.Fake) {
+	t.Helper()
+	cfg := config.DefaultServerConfig()
+	cfg.Rollout.CoalesceWindow = window
+
+	st := store.NewMemoryStore()
+	s := NewTaskService(cfg, zerolog.Nop(), st, middleware.NewNodeAuthenticator(zerolog.Nop(), st), ephemeral.NewMemory())
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.SetClock(fake)
+	return s, st, fake
+}
+
+func TestScheduleConfigUpdateCoalesces(t *testing.T) {
+	s, st, fake := newTestTaskService(t, 2*time.Second)
+	start := fake.Now()
+
+	first, err := s.ScheduleConfigUpdate(1)
+	if err != nil {
+		t.Fatalf("ScheduleConfigUpdate: %v", err)
+	}
+	// 任务ID来自替换后的时间源
+	if want := fmt.Sprintf("%s_%d", types.TaskTypeUpdate, start.UnixNano()); first.ID != want {
+		t.Errorf("task ID = %s, want %s", first.ID, want)
+	}
+
+	fake.Advance(time.Second)
+	for i := 0; i < 3; i++ {
+		task, err := s.ScheduleConfigUpdate(1)
+		if err != nil {
+			t.Fatalf("ScheduleConfigUpdate: %v", err)
+		}
+		if task.ID != first.ID {
+			t.Fatalf("request within window created task %s, want coalesced into %s", task.ID, first.ID)
+		}
+	}
+	if got := s.pendingUpdates[1].merged; got != 3 {
+		t.Errorf("merged = %d, want 3", got)
+	}
+
+	// 其他节点的请求不合并
+	other, err := s.ScheduleConfigUpdate(2)
+	if err != nil {
+		t.Fatalf("ScheduleConfigUpdate: %v", err)
+	}
+	if other.ID == first.ID {
+		t.Errorf("node 2 reused task %s of node 1", other.ID)
+	}
+
+	// 窗口结束前不推送
+	fake.Advance(999 * time.Millisecond)
+	if _, ok := s.pendingUpdates[1]; !ok {
+		t.Fatal("update flushed before the coalesce window ended")
+	}
+
+	// 窗口结束时推送；节点未连接，推送失败后任务仍为待执行
+	fake.Advance(time.Millisecond)
+	if _, ok := s.pendingUpdates[1]; ok {
+		t.Fatal("update not flushed when the coalesce window ended")
+	}
+	task, err := st.GetTask(first.ID)
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if task.Status != types.TaskStatusPending || task.StartedAt != nil {
+		t.Errorf("task status = %s, started_at = %v, want pending and not started", task.Status, task.StartedAt)
+	}
+
+	// 新窗口中的请求生成新任务
+	fake.Advance(time.Second)
+	next, err := s.ScheduleConfigUpdate(1)
+	if err != nil {
+		t.Fatalf("ScheduleConfigUpdate: %v", err)
+	}
+	if next.ID == first.ID {
+		t.Errorf("request after the window reused task %s", next.ID)
+	}
+}
+
+func TestScheduleConfigUpdateWithoutWindow(t *testing.T) {
+	s, _, fake := newTestTaskService(t, 0)
+
+	first, err := s.ScheduleConfigUpdate(1)
+	if err == nil {
+		t.Fatal("push to a disconnected node succeeded")
+	}
+	second, _ := s.ScheduleConfigUpdate(1)
+	if first == nil || second == nil || first.ID == second.ID {
+		t.Fatalf("requests without a coalesce window must create separate tasks")
+	}
+	if len(s.pendingUpdates) != 0 || fake.Waiters() != 0 {
+		t.Errorf("update was deferred although coalescing is disabled")
+	}
+}
+
+// TestUpdateTaskStatusRequiresOwningNode 任务状态只能由持有凭据、且任务分配给它的节点更新
+func TestUpdateTaskStatusRequiresOwningNode(t *testing.T) {
+	s, st, _ := newTestTaskService(t, 0)
+	createTestNodes(t, st, 2)
+
+	// 节点未连接时推送失败，任务仍保存在存储中
+	task, _ := s.ScheduleConfigUpdate(1)
+	if task == nil {
+		t.Fatal("ScheduleConfigUpdate returned no task")
+	}
+
+	update := func(nodeID int32, token string) error {
+		_, err := s.UpdateTaskStatus(context.Background(), &pb.UpdateTaskStatusRequest{
+			TaskId: task.ID,
+			Status: string(types.TaskStatusSuccess),
+			NodeId: nodeID,
+			Token:  token,
+		})
+		return err
+	}
+
+	if err := update(1, "token-2"); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong token: got %v, want Unauthenticated", err)
+	}
+	if err := update(2, "token-2"); status.Code(err) != codes.NotFound {
+		t.Errorf("other node: got %v, want NotFound", err)
+	}
+	stored, err := st.GetTask(task.ID)
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if stored.Status == types.TaskStatusSuccess {
+		t.Fatal("task updated by a node it is not assigned to")
+	}
+
+	if err := update(1, "token-1"); err != nil {
+		t.Fatalf("owning node: %v", err)
+	}
+	if stored, _ := st.GetTask(task.ID); stored.Status != types.TaskStatusSuccess {
+		t.Errorf("task status = %s, want %s", stored.Status, types.TaskStatusSuccess)
+	}
+}
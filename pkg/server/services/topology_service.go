@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultNearestNeighbours 默认为每个节点连接的最近邻数量
+	defaultNearestNeighbours = 3
+	// backboneRole 元数据中标记骨干节点的角色值
+	backboneRole = "backbone"
+	// earthRadiusKm 地球平均半径
+	earthRadiusKm = 6371.0
+)
+
+// TopologyService 拓扑规划服务
+type TopologyService struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+
+	// 服务依赖
+	nodeService *NodeService
+
+	// 时间源，测试中可替换
+	clock clock.Clock
+}
+
+// NewTopologyService 创建拓扑规划服务
+func NewTopologyService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeService *NodeService) *TopologyService {
+	return &TopologyService{
+		config:      cfg,
+		logger:      logger.With().Str("service", "topology").Logger(),
+		store:       store,
+		nodeService: nodeService,
+		clock:       clock.Real(),
+	}
+}
+
+// SetClock 替换时间源
+func (s *TopologyService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// RegisterRoutes 注册路由
+func (s *TopologyService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.POST("/topology/suggest", s.HandleSuggestTopology)
+	g.Dashboard.POST("/topology/apply", s.HandleApplyTopology)
+	g.Dashboard.GET("/topology/health", s.HandleTopologyHealth)
+	g.Dashboard.GET("/summary", s.HandleGetSummary)
+	g.Dashboard.GET("/nodes/:id/overview", s.HandleGetNodeOverview)
+	g.Dashboard.GET("/connections", s.HandleListConnections)
+	g.Dashboard.POST("/connections", s.HandleCreateConnectionPath)
+	g.Dashboard.PUT("/connections/:id/port", s.HandlePinConnectionPort)
+	g.Dashboard.PUT("/connections/:id/babel-options", s.HandleUpdateConnectionBabelOptions)
+	g.Dashboard.PUT("/connections/:id/endpoint-ports", s.HandleUpdateConnectionEndpointPorts)
+	g.Dashboard.DELETE("/connections/:id", s.HandleDeleteConnection)
+	g.Agent.POST("/links/:peer_id/endpoint", s.HandleReportActiveEndpoint)
+}
+
+// HandleTopologyHealth 返回租户内节点和链路的健康状况
+func (s *TopologyService) HandleTopologyHealth(c *gin.Context) {
+	health, err := s.MeshHealth(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, health)
+}
+
+// MeshHealth 计算租户内节点和链路的健康状况
+func (s *TopologyService) MeshHealth(ctx context.Context, tenantID int) (*types.MeshHealth, error) {
+	nodes, err := s.nodeService.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("listing nodes: %w", err)
+	}
+	statuses, err := s.store.ListNodeStatus()
+	if err != nil {
+		return nil, fmt.Errorf("listing node statuses: %w", err)
+	}
+	conns, err := s.store.ListWireguardConnections(0)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+
+	byNode := make(map[int]*types.NodeStatus, len(statuses))
+	for _, status := range statuses {
+		byNode[status.NodeID] = status
+	}
+	return ComputeMeshHealth(nodes, byNode, conns, s.clock.Now(), s.config.Status.OfflineAfter, s.config.Status.HandshakeTimeout), nil
+}
+
+// HandleSuggestTopology 根据节点地理位置生成拓扑建议
+func (s *TopologyService) HandleSuggestTopology(c *gin.Context) {
+	var req struct {
+		K        int   `json:"k"`        // 每个节点连接的最近邻数量
+		Backbone []int `json:"backbone"` // 骨干节点，未指定时使用元数据 role=backbone 的节点
+	}
+	// 请求体可选
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.K <= 0 {
+		req.K = defaultNearestNeighbours
+	}
+
+	nodes, err := s.nodeService.ListTenantNodes(c.Request.Context(), middleware.TenantID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan := SuggestTopology(nodes, req.K, req.Backbone)
+	c.JSON(http.StatusOK, plan)
+}
+
+// HandleApplyTopology 应用拓扑规划：启用规划内的链路，停用其余链路
+//
+// 规划会使原本互通的节点断开时返回 409 和连通性分析，确认后使用 ?force=true 重新提交。
+func (s *TopologyService) HandleApplyTopology(c *gin.Context) {
+	var plan types.TopologyPlan
+	if !bindJSON(c, &plan) {
+		return
+	}
+	force := c.Query("force") == "true"
+
+	changed, report, err := s.ApplyTopology(c.Request.Context(), middleware.TenantID(c), &plan, force)
+	if err != nil {
+		var partition *PartitionError
+		if errors.As(err, &partition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "reachability": partition.Report})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"links":        len(plan.Links),
+		"changed":      changed,
+		"reachability": report,
+	})
+}
+
+// ApplyTopology 在租户范围内应用拓扑规划，返回状态发生变化的链路数量和变更后的连通性分析
+//
+// 规划会使原本互通的节点断开且 force 为 false 时不做任何修改，返回 PartitionError。
+func (s *TopologyService) ApplyTopology(ctx context.Context, tenantID int, plan *types.TopologyPlan, force bool) (int, *types.ReachabilityReport, error) {
+	nodes, err := s.nodeService.ListTenantNodes(ctx, tenantID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("listing nodes: %w", err)
+	}
+
+	exists := make(map[int]bool, len(nodes))
+	for _, node := range nodes {
+		exists[node.ID] = true
+	}
+
+	wanted := make(map[[2]int]bool, len(plan.Links))
+	for _, link := range plan.Links {
+		if !exists[link.NodeID] || !exists[link.PeerID] {
+			return 0, nil, fmt.Errorf("link %d-%d references unknown node", link.NodeID, link.PeerID)
+		}
+		if link.NodeID == link.PeerID {
+			return 0, nil, fmt.Errorf("link %d-%d connects node to itself", link.NodeID, link.PeerID)
+		}
+		wanted[pairKey(link.NodeID, link.PeerID)] = true
+	}
+
+	before, err := s.nodeService.loadMeshGraph(ctx, tenantID)
+	if err != nil {
+		return 0, nil, err
+	}
+	report, err := s.nodeService.checkPartition(before, before.withLinks(wanted), force)
+	if err != nil {
+		return 0, report, err
+	}
+
+	changed := 0
+	for _, node := range nodes {
+		var peerIDs []int
+		for _, peer := range nodes {
+			if peer.ID > node.ID {
+				peerIDs = append(peerIDs, peer.ID)
+			}
+		}
+		if len(peerIDs) == 0 {
+			continue
+		}
+
+		conns, err := s.nodeService.GenerateWireguardConnections(node.ID, peerIDs, s.config.Network.BasePort)
+		if err != nil {
+			return changed, nil, err
+		}
+		for _, peerID := range peerIDs {
+			conn := conns[peerID]
+			disabled := !wanted[pairKey(node.ID, peerID)]
+			if conn.Disabled == disabled {
+				continue
+			}
+			conn.Disabled = disabled
+			if err := s.store.UpdateWireguardConnection(conn); err != nil {
+				return changed, nil, fmt.Errorf("updating connection %d-%d: %w", node.ID, peerID, err)
+			}
+			changed++
+		}
+	}
+
+	if changed > 0 {
+		s.nodeService.notifyMeshChange()
+		if err := s.nodeService.enqueueMeshUpdate(tenantID); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to list nodes for config update")
+		}
+	}
+
+	s.logger.Info().
+		Int("links", len(plan.Links)).
+		Int("changed", changed).
+		Msg("Applied topology plan")
+
+	return changed, report, nil
+}
+
+// SuggestTopology 生成拓扑建议：每个节点连接 k 个地理上最近的节点，并连接所有骨干节点
+func SuggestTopology(nodes []*types.NodeConfig, k int, backbone []int) *types.TopologyPlan {
+	byID := make(map[int]*types.NodeConfig, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	// 确定骨干节点
+	isBackbone := make(map[int]bool)
+	if len(backbone) > 0 {
+		for _, id := range backbone {
+			if _, ok := byID[id]; ok {
+				isBackbone[id] = true
+			}
+		}
+	} else {
+		for _, node := range nodes {
+			if node.Metadata["role"] == backboneRole {
+				isBackbone[node.ID] = true
+			}
+		}
+	}
+
+	links := make(map[[2]int]types.TopologyLink)
+	addLink := func(a, b *types.NodeConfig, reason string) {
+		key := pairKey(a.ID, b.ID)
+		if _, ok := links[key]; ok {
+			return
+		}
+		link := types.TopologyLink{NodeID: key[0], PeerID: key[1], Reason: reason}
+		if a.HasLocation() && b.HasLocation() {
+			d := haversineKm(a, b)
+			link.DistanceKm = &d
+		}
+		links[key] = link
+	}
+
+	// 最近邻
+	var located []*types.NodeConfig
+	for _, node := range nodes {
+		if node.HasLocation() {
+			located = append(located, node)
+		}
+	}
+	for _, node := range located {
+		candidates := make([]*types.NodeConfig, 0, len(located))
+		for _, other := range located {
+			if other.ID != node.ID {
+				candidates = append(candidates, other)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return haversineKm(node, candidates[i]) < haversineKm(node, candidates[j])
+		})
+		for i := 0; i < k && i < len(candidates); i++ {
+			addLink(node, candidates[i], "nearest")
+		}
+	}
+
+	// 骨干节点
+	for _, node := range nodes {
+		for id := range isBackbone {
+			if id != node.ID {
+				addLink(node, byID[id], "backbone")
+			}
+		}
+	}
+
+	plan := &types.TopologyPlan{Links: make([]types.TopologyLink, 0, len(links))}
+	linked := make(map[int]bool)
+	for _, link := range links {
+		plan.Links = append(plan.Links, link)
+		linked[link.NodeID] = true
+		linked[link.PeerID] = true
+	}
+	sort.Slice(plan.Links, func(i, j int) bool {
+		if plan.Links[i].NodeID != plan.Links[j].NodeID {
+			return plan.Links[i].NodeID < plan.Links[j].NodeID
+		}
+		return plan.Links[i].PeerID < plan.Links[j].PeerID
+	})
+
+	for _, node := range nodes {
+		if !linked[node.ID] && len(nodes) > 1 {
+			plan.Unplaced = append(plan.Unplaced, node.ID)
+		}
+	}
+	sort.Ints(plan.Unplaced)
+
+	return plan
+}
+
+// pairKey 生成无序节点对的键
+func pairKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// haversineKm 计算两个节点之间的大圆距离
+func haversineKm(a, b *types.NodeConfig) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	lat1, lat2 := toRad(*a.Latitude), toRad(*b.Latitude)
+	dLat := lat2 - lat1
+	dLon := toRad(*b.Longitude - *a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/password"
+	"mesh-backend/pkg/utils/totp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// totpIssuer 验证器应用中显示的签发方名称
+	totpIssuer = "Mesh"
+	// recoveryCodeCount 每次启用两步验证时生成的恢复码数量
+	recoveryCodeCount = 10
+)
+
+// currentUser 获取当前登录用户，失败时已写入响应
+func (s *UserService) currentUser(c *gin.Context) (*types.User, bool) {
+	user, err := s.store.GetUser(c.GetInt("user_id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		s.logger.Error().Err(err).Msg("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	return user, true
+}
+
+// HandleEnrollTOTP 生成两步验证密钥，需调用 activate 确认后才生效
+func (s *UserService) HandleEnrollTOTP(c *gin.Context) {
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate totp secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPLastCounter = 0
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to save totp secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_url": totp.URL(totpIssuer, user.Username, secret),
+	})
+}
+
+// HandleActivateTOTP 校验验证码后启用两步验证，并返回恢复码
+func (s *UserService) HandleActivateTOTP(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment not started"})
+		return
+	}
+
+	counter, valid := totp.Validate(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastCounter)
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate recovery codes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, totp.HashRecoveryCode(code))
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	user.RecoveryCodes = hashes
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to enable totp")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.logger.Info().Int("user_id", user.ID).Msg("Two-factor authentication enabled")
+
+	// 恢复码仅在此处返回一次明文
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// HandleDisableTOTP 关闭两步验证，需要提供密码和验证码（或恢复码）
+func (s *UserService) HandleDisableTOTP(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication not enabled"})
+		return
+	}
+
+	valid, err := password.VerifyPassword(req.Password, user.Password)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to verify password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	valid, err = s.verifySecondFactor(user, req.Code)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to verify two-factor code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	user.RecoveryCodes = nil
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to disable totp")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.logger.Info().Int("user_id", user.ID).Msg("Two-factor authentication disabled")
+
+	c.Status(http.StatusOK)
+}
+
+// verifySecondFactor 校验验证码或恢复码，恢复码使用后即作废
+func (s *UserService) verifySecondFactor(user *types.User, code string) (bool, error) {
+	if counter, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastCounter); ok {
+		user.TOTPLastCounter = counter
+		return true, s.store.UpdateUser(user)
+	}
+
+	hash := totp.HashRecoveryCode(code)
+	for i, stored := range user.RecoveryCodes {
+		if stored != hash {
+			continue
+		}
+		user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+		if err := s.store.UpdateUser(user); err != nil {
+			return false, err
+		}
+		s.logger.Warn().
+			Int("user_id", user.ID).
+			Int("remaining", len(user.RecoveryCodes)).
+			Msg("Recovery code used for login")
+		return true, nil
+	}
+
+	return false, nil
+}
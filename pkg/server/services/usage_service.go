@@ -0,0 +1,411 @@
+package services
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// defaultUsageDays 查询未指定起始日期时返回的天数
+const defaultUsageDays = 30
+
+// UsageService 按天统计节点和链路的流量
+//
+// agent 上报的是 WireGuard 对等节点的累计收发字节数，服务端按相邻两次上报的差值累加到当天（UTC）的统计中。
+// 上一次上报取自副本共享的节点状态，节点切换到其他副本时差值仍然连续，每段流量只计入一次。
+// 计数变小说明接口重建，差值按新计数计算；共享状态中没有上一次上报时只作为基准，不计入统计。
+// 每次写入后按节点的月流量配额检查当月用量，见 checkQuotas。
+type UsageService struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+
+	// 服务依赖
+	nodeService *NodeService
+
+	mu      sync.Mutex
+	pending map[pendingUsageKey]*peerCounter
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	// 时间源，测试中可替换
+	clock clock.Clock
+}
+
+// peerCounter 收发字节数
+type peerCounter struct {
+	rx, tx int64
+}
+
+// pendingUsageKey 等待写入的流量增量，对端以公钥标识，写入时解析为节点ID
+type pendingUsageKey struct {
+	nodeID    int
+	publicKey string
+	date      string
+}
+
+// NewUsageService 创建流量统计服务
+func NewUsageService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, nodeService *NodeService) *UsageService {
+	return &UsageService{
+		config:      cfg,
+		logger:      logger.With().Str("service", "usage").Logger(),
+		store:       store,
+		nodeService: nodeService,
+		pending:     make(map[pendingUsageKey]*peerCounter),
+		stopCh:      make(chan struct{}),
+		clock:       clock.Real(),
+	}
+}
+
+// SetClock 替换时间源，需在服务启动前调用
+func (s *UsageService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// RegisterRoutes 注册路由
+func (s *UsageService) RegisterRoutes(g *RouteGroups) {
+	g.Dashboard.GET("/usage", s.HandleGetUsage)
+}
+
+// Start 启动定期写入和配额检查协程
+func (s *UsageService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := s.clock.NewTicker(s.config.Status.UsageFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopCh:
+				s.flush()
+				return
+			case <-ticker.C():
+				s.flush()
+				s.checkQuotas()
+			}
+		}
+	}()
+}
+
+// Stop 停止写入协程并写入剩余的统计
+func (s *UsageService) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// Record 按节点本次与上一次上报的累计计数之差累加流量，prev 为 nil 时本次上报只作为基准，可在 nil 上调用
+func (s *UsageService) Record(prev, status *types.NodeStatus) {
+	if s == nil || prev == nil {
+		return
+	}
+	date := s.clock.Now().UTC().Format(types.UsageDateLayout)
+
+	last := make(map[string]peerCounter, len(prev.WireGuard.Peers))
+	for _, peer := range prev.WireGuard.Peers {
+		last[peer.PublicKey] = peerCounter{rx: peer.RxBytes, tx: peer.TxBytes}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, peer := range status.WireGuard.Peers {
+		if peer.PublicKey == "" {
+			continue
+		}
+		prev, ok := last[peer.PublicKey]
+		if !ok {
+			continue
+		}
+		delta := peerCounter{rx: counterDelta(prev.rx, peer.RxBytes), tx: counterDelta(prev.tx, peer.TxBytes)}
+		if delta.rx == 0 && delta.tx == 0 {
+			continue
+		}
+		key := pendingUsageKey{nodeID: status.NodeID, publicKey: peer.PublicKey, date: date}
+		if p, ok := s.pending[key]; ok {
+			p.rx += delta.rx
+			p.tx += delta.tx
+		} else {
+			s.pending[key] = &delta
+		}
+	}
+}
+
+// counterDelta 计算累计计数的增量，计数变小时视为接口重建后重新计数
+func counterDelta(prev, current int64) int64 {
+	if current < prev {
+		return current
+	}
+	return current - prev
+}
+
+// flush 将累计的增量写入存储，写入失败时保留到下次
+func (s *UsageService) flush() {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	batch := s.pending
+	s.pending = make(map[pendingUsageKey]*peerCounter)
+	s.mu.Unlock()
+
+	nodes, err := s.store.ListNodes()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes")
+		s.restore(batch)
+		return
+	}
+	byID := make(map[int]*types.NodeConfig, len(nodes))
+	byKey := make(map[string]*types.NodeConfig, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+		byKey[node.PublicKey] = node
+	}
+
+	// 按节点、对端和日期合并，同一批次中每条记录只出现一次
+	now := s.clock.Now()
+	merged := make(map[usageRowKey]*types.TrafficUsage)
+	for key, delta := range batch {
+		node, peer := byID[key.nodeID], byKey[key.publicKey]
+		if node == nil || peer == nil {
+			// 节点已删除或对端不是网格节点
+			continue
+		}
+		rowKey := usageRowKey{nodeID: node.ID, peerID: peer.ID, date: key.date}
+		row, ok := merged[rowKey]
+		if !ok {
+			row = &types.TrafficUsage{TenantID: node.TenantID, NodeID: node.ID, PeerID: peer.ID, Date: key.date, UpdatedAt: now}
+			merged[rowKey] = row
+		}
+		row.RxBytes += delta.rx
+		row.TxBytes += delta.tx
+	}
+
+	rows := make([]*types.TrafficUsage, 0, len(merged))
+	for _, row := range merged {
+		rows = append(rows, row)
+	}
+	if err := s.store.AddTrafficUsage(rows); err != nil {
+		s.logger.Error().Err(err).Int("count", len(rows)).Msg("Failed to save traffic usage")
+		s.restore(batch)
+	}
+}
+
+// usageRowKey 流量统计记录的唯一键
+type usageRowKey struct {
+	nodeID, peerID int
+	date           string
+}
+
+// restore 将未写入的增量放回缓冲
+func (s *UsageService) restore(batch map[pendingUsageKey]*peerCounter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, delta := range batch {
+		if p, ok := s.pending[key]; ok {
+			p.rx += delta.rx
+			p.tx += delta.tx
+		} else {
+			s.pending[key] = delta
+		}
+	}
+}
+
+// HandleGetUsage 查询租户的流量统计
+//
+// 参数 from、to 为 YYYY-MM-DD（UTC），默认最近 30 天；node_id 只查询指定节点；
+// group=node（默认）按节点汇总每天的流量，group=link 返回每条链路每天的流量。
+func (s *UsageService) HandleGetUsage(c *gin.Context) {
+	tenantID := middleware.TenantID(c)
+	today := s.clock.Now().UTC()
+	filter := store.UsageFilter{
+		TenantID: tenantID,
+		From:     today.AddDate(0, 0, 1-defaultUsageDays).Format(types.UsageDateLayout),
+		To:       today.Format(types.UsageDateLayout),
+	}
+
+	for param, dst := range map[string]*string{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(types.UsageDateLayout, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " date, expected YYYY-MM-DD"})
+			return
+		}
+		*dst = value
+	}
+	if filter.From > filter.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+
+	group := c.DefaultQuery("group", "node")
+	if group != "node" && group != "link" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group, expected node or link"})
+		return
+	}
+
+	if value := c.Query("node_id"); value != "" {
+		nodeID, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+			return
+		}
+		filter.NodeID = nodeID
+	}
+
+	usage, err := s.store.ListTrafficUsage(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if group == "node" {
+		usage = sumUsageByNode(usage)
+	}
+	if usage == nil {
+		usage = []*types.TrafficUsage{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  filter.From,
+		"to":    filter.To,
+		"group": group,
+		"usage": usage,
+	})
+}
+
+// sumUsageByNode 将链路流量按节点和日期汇总，输入需按日期和节点排序
+func sumUsageByNode(usage []*types.TrafficUsage) []*types.TrafficUsage {
+	var summed []*types.TrafficUsage
+	for _, u := range usage {
+		if n := len(summed); n > 0 && summed[n-1].NodeID == u.NodeID && summed[n-1].Date == u.Date {
+			last := summed[n-1]
+			last.RxBytes += u.RxBytes
+			last.TxBytes += u.TxBytes
+			if u.UpdatedAt.After(last.UpdatedAt) {
+				last.UpdatedAt = u.UpdatedAt
+			}
+			continue
+		}
+		row := *u
+		row.PeerID = 0
+		summed = append(summed, &row)
+	}
+	return summed
+}
+
+// checkQuotas 检查设置了配额的节点当月的用量
+//
+// 用量首次达到某个告警阈值时发送 quota.threshold 事件；开启 deprioritize 的节点超出配额后
+// 提高其 babeld 接口的 rxcost 并下发配置。进入新的月份时告警状态重置，rxcost 随之恢复。
+func (s *UsageService) checkQuotas() {
+	nodes, err := s.store.ListNodes()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list nodes")
+		return
+	}
+
+	now := s.clock.Now().UTC()
+	period := now.Format(types.QuotaPeriodLayout)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format(types.UsageDateLayout)
+
+	// 按租户查询当月用量，只查询有节点设置了配额的租户
+	used := make(map[int]map[int]int64)
+	monthlyUsage := func(tenantID int) (map[int]int64, error) {
+		if byNode, ok := used[tenantID]; ok {
+			return byNode, nil
+		}
+		usage, err := s.store.ListTrafficUsage(store.UsageFilter{TenantID: tenantID, From: monthStart})
+		if err != nil {
+			return nil, err
+		}
+		byNode := make(map[int]int64)
+		for _, u := range usage {
+			byNode[u.NodeID] += u.RxBytes + u.TxBytes
+		}
+		used[tenantID] = byNode
+		return byNode, nil
+	}
+
+	for _, node := range nodes {
+		quota := node.TrafficQuota.MonthlyBytes
+		if quota == 0 && !node.QuotaStatus.Deprioritized {
+			continue
+		}
+
+		status := node.QuotaStatus
+		if status.Period != period {
+			status = types.QuotaStatus{Period: period}
+		}
+		if quota > 0 {
+			byNode, err := monthlyUsage(node.TenantID)
+			if err != nil {
+				s.logger.Error().Err(err).Int("tenant_id", node.TenantID).Msg("Failed to query traffic usage")
+				continue
+			}
+			bytes := byNode[node.ID]
+			percent := float64(bytes) * 100 / float64(quota)
+			if threshold := crossedThreshold(s.config.Quota.Thresholds, percent); threshold > status.Threshold {
+				status.Threshold = threshold
+				s.logger.Warn().
+					Int("node_id", node.ID).
+					Int64("used_bytes", bytes).
+					Int64("quota_bytes", quota).
+					Int("threshold", threshold).
+					Msg("Traffic quota threshold reached")
+				s.nodeService.webhooks.Emit(types.EventQuotaThreshold, node.TenantID, map[string]any{
+					"node_id":     node.ID,
+					"name":        node.Name,
+					"period":      period,
+					"used_bytes":  bytes,
+					"quota_bytes": quota,
+					"threshold":   threshold,
+				})
+			}
+			status.Deprioritized = node.TrafficQuota.Deprioritize && bytes >= quota
+		} else {
+			status.Deprioritized = false
+		}
+
+		if status == node.QuotaStatus {
+			continue
+		}
+		if err := s.store.UpdateNodeQuotaStatus(node.ID, status); err != nil {
+			s.logger.Error().Err(err).Int("node_id", node.ID).Msg("Failed to update quota status")
+			continue
+		}
+		if status.Deprioritized != node.QuotaStatus.Deprioritized {
+			s.logger.Info().
+				Int("node_id", node.ID).
+				Bool("deprioritized", status.Deprioritized).
+				Msg("Updating node routing cost for traffic quota")
+			s.nodeService.notifyMeshChange()
+			s.nodeService.enqueueNodeUpdate(node.ID)
+		}
+	}
+}
+
+// crossedThreshold 返回已达到的最高告警阈值，未达到任何阈值时返回 0
+func crossedThreshold(thresholds []int, percent float64) int {
+	crossed := 0
+	for _, threshold := range thresholds {
+		if percent >= float64(threshold) && threshold > crossed {
+			crossed = threshold
+		}
+	}
+	return crossed
+}
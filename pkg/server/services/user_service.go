@@ -1,11 +1,17 @@
 package services
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"mesh-backend/pkg/config"
 	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/server/oidc"
 	"mesh-backend/pkg/store"
 	"mesh-backend/pkg/types"
 	"mesh-backend/pkg/utils/password"
@@ -19,23 +25,49 @@ type UserService struct {
 	config  *config.ServerConfig
 	logger  zerolog.Logger
 	store   store.Store
-	jwtAuth middleware.JWTAuthenticator
+	jwtAuth *middleware.JWTAuthenticator
+
+	// OIDC 登录，未启用时为 nil
+	oidc *oidc.Provider
+
+	// 密码策略
+	policy *password.Policy
 }
 
+// oidcStateCookie 保存 OIDC 登录 state 和 nonce 的 cookie
+const oidcStateCookie = "mesh_oidc_state"
+
 // NewUserService 创建用户服务实例
-func NewUserService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, jwtAuth middleware.JWTAuthenticator) *UserService {
+func NewUserService(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store, jwtAuth *middleware.JWTAuthenticator, oidcProvider *oidc.Provider, policy *password.Policy) *UserService {
 	return &UserService{
 		config:  cfg,
 		logger:  logger.With().Str("service", "user").Logger(),
 		store:   store,
 		jwtAuth: jwtAuth,
+		oidc:    oidcProvider,
+		policy:  policy,
 	}
 }
 
 // RegisterRoutes 注册路由
-func (s *UserService) RegisterRoutes(r *gin.RouterGroup) {
-	r.POST("/register", s.HandleRegister)
-	r.POST("/login", s.HandleLogin)
+func (s *UserService) RegisterRoutes(g *RouteGroups) {
+	auth := g.Auth
+	auth.POST("/register", s.HandleRegister)
+	auth.POST("/login", s.HandleLogin)
+	auth.POST("/change-password", s.jwtAuth.PasswordChangeAuth(), s.HandleChangePassword)
+	if s.oidc != nil {
+		auth.GET("/oidc/login", s.HandleOIDCLogin)
+		auth.GET("/oidc/callback", s.HandleOIDCCallback)
+	}
+
+	dashboard := g.Dashboard
+	dashboard.GET("/tenant", s.HandleGetTenant)
+	dashboard.POST("/tenant/users", s.HandleCreateTenantUser)
+	dashboard.POST("/2fa/enroll", s.HandleEnrollTOTP)
+	dashboard.POST("/2fa/activate", s.HandleActivateTOTP)
+	dashboard.POST("/2fa/disable", s.HandleDisableTOTP)
+	dashboard.POST("/users/:id/reset-password", s.HandleResetPassword)
+	dashboard.PUT("/users/:id/role", s.HandleUpdateUserRole)
 }
 
 // HandleRegister 处理用户注册
@@ -43,13 +75,31 @@ func (s *UserService) HandleRegister(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		Tenant   string `json:"tenant"` // 新建租户名称，为空时归属默认租户
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := s.policy.Check(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	tenantID := types.DefaultTenantID
+	if req.Tenant != "" {
+		// 已存在的租户只能由其成员添加用户，不允许自行加入
+		if _, err := s.store.GetTenantByName(req.Tenant); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Tenant already exists"})
+			return
+		} else if !errors.Is(err, store.ErrNotFound) {
+			s.logger.Error().Err(err).Msg("Failed to get tenant")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+
 	// 检查用户名是否已存在
 	exists, err := s.store.CheckUserExists(req.Username)
 	if err != nil {
@@ -71,13 +121,34 @@ func (s *UserService) HandleRegister(c *gin.Context) {
 		return
 	}
 
+	// 新建租户的创建者是该租户的管理员；自行注册加入默认租户的用户只有普通权限，
+	// 默认租户的第一个用户除外，否则默认租户没有管理员
+	role := types.RoleUser
+	if req.Tenant != "" {
+		tenant := &types.Tenant{Name: req.Tenant}
+		if err := s.store.CreateTenant(tenant); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to create tenant")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		tenantID = tenant.ID
+		role = types.RoleAdmin
+	}
+
 	// 创建用户
 	user := &types.User{
 		Username: req.Username,
 		Password: hashedPassword,
+		TenantID: tenantID,
+		Role:     role,
 	}
 
-	if err := s.store.CreateUser(user); err != nil {
+	if req.Tenant == "" {
+		err = s.store.CreateUserWithFirstRole(user, types.RoleAdmin)
+	} else {
+		err = s.store.CreateUser(user)
+	}
+	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to create user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
@@ -86,21 +157,106 @@ func (s *UserService) HandleRegister(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User registered successfully",
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
+			"id":        user.ID,
+			"username":  user.Username,
+			"tenant_id": user.TenantID,
+			"role":      user.Role,
 		},
 	})
 }
 
+// HandleGetTenant 获取当前用户所属租户
+func (s *UserService) HandleGetTenant(c *gin.Context) {
+	tenantID := middleware.TenantID(c)
+	if tenantID == types.DefaultTenantID {
+		c.JSON(http.StatusOK, &types.Tenant{ID: types.DefaultTenantID, Name: "default"})
+		return
+	}
+
+	tenant, err := s.store.GetTenant(tenantID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to get tenant")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// HandleCreateTenantUser 管理员在当前租户下创建用户
+func (s *UserService) HandleCreateTenantUser(c *gin.Context) {
+	if c.GetString("role") != types.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+		return
+	}
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := s.policy.Check(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exists, err := s.store.CheckUserExists(req.Username)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to check user existence")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	hashedPassword, err := password.HashPassword(req.Password)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	user := &types.User{
+		Username: req.Username,
+		Password: hashedPassword,
+		TenantID: middleware.TenantID(c),
+		Role:     types.RoleUser,
+	}
+
+	if err := s.store.CreateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to create user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":        user.ID,
+		"username":  user.Username,
+		"tenant_id": user.TenantID,
+		"role":      user.Role,
+	})
+}
+
 // HandleLogin 处理用户登录
 func (s *UserService) HandleLogin(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		OTP      string `json:"otp"` // 启用两步验证时必填，可以是验证码或恢复码
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -108,6 +264,7 @@ func (s *UserService) HandleLogin(c *gin.Context) {
 	user, err := s.store.GetUserByUsername(req.Username)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
+			s.auditLogin(c, req.Username, "unknown user")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 			return
 		}
@@ -116,6 +273,13 @@ func (s *UserService) HandleLogin(c *gin.Context) {
 		return
 	}
 
+	// OIDC 用户只能通过单点登录
+	if user.Provider != "" {
+		s.auditLogin(c, req.Username, "password login for sso user")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
 	// 验证密码
 	valid, err := password.VerifyPassword(req.Password, user.Password)
 	if err != nil {
@@ -125,23 +289,417 @@ func (s *UserService) HandleLogin(c *gin.Context) {
 	}
 
 	if !valid {
+		s.auditLogin(c, req.Username, "invalid password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
 
-	// 生成 JWT token
-	token, err := s.jwtAuth.GenerateToken(user.ID, user.Username)
+	// 两步验证通过后才签发 token
+	if user.TOTPEnabled {
+		if req.OTP == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "two_factor_required": true})
+			return
+		}
+		ok, err := s.verifySecondFactor(user, req.OTP)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to verify two-factor code")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if !ok {
+			s.auditLogin(c, req.Username, "invalid two-factor code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "two_factor_required": true})
+			return
+		}
+	}
+
+	s.upgradeOnLogin(user, req.Password)
+	s.respondWithToken(c, user)
+}
+
+// auditLogin 记录失败的登录尝试，client_ip 按 server.trusted_proxies 解析转发头
+func (s *UserService) auditLogin(c *gin.Context, username, reason string) {
+	s.logger.Warn().
+		Str("username", username).
+		Str("client_ip", c.ClientIP()).
+		Str("reason", reason).
+		Msg("Login failed")
+}
+
+// respondWithToken 为用户签发 JWT token 并返回登录结果
+func (s *UserService) respondWithToken(c *gin.Context, user *types.User) {
+	token, err := s.jwtAuth.GenerateToken(user)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to generate token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
+	s.logger.Info().
+		Int("user_id", user.ID).
+		Str("username", user.Username).
+		Str("client_ip", c.ClientIP()).
+		Msg("User logged in")
+
 	c.JSON(http.StatusOK, gin.H{
 		"token": token,
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
+			"id":        user.ID,
+			"username":  user.Username,
+			"tenant_id": user.TenantID,
+			"role":      user.Role,
 		},
+		"must_change_password": user.MustChangePassword,
 	})
 }
+
+// upgradeOnLogin 登录成功后升级旧的密码哈希参数，并为早期创建的本地用户补全角色
+func (s *UserService) upgradeOnLogin(user *types.User, plain string) {
+	changed := false
+
+	if password.NeedsRehash(user.Password) {
+		hashedPassword, err := password.HashPassword(plain)
+		if err != nil {
+			s.logger.Warn().Err(err).Int("user_id", user.ID).Msg("Failed to rehash password")
+		} else {
+			user.Password = hashedPassword
+			changed = true
+		}
+	}
+
+	// 引入角色前创建的用户均拥有完整权限
+	if user.Role == "" {
+		user.Role = types.RoleAdmin
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Warn().Err(err).Int("user_id", user.ID).Msg("Failed to upgrade user on login")
+	}
+}
+
+// HandleChangePassword 修改当前用户密码
+func (s *UserService) HandleChangePassword(c *gin.Context) {
+	var req struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, ok := s.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.Provider != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the identity provider"})
+		return
+	}
+
+	valid, err := password.VerifyPassword(req.OldPassword, user.Password)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to verify password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if req.NewPassword == req.OldPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the old password"})
+		return
+	}
+	if err := s.policy.Check(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := password.HashPassword(req.NewPassword)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// 修改密码后之前签发的 token 全部失效，返回新的 token 供当前会话继续使用
+	user.Password = hashedPassword
+	user.MustChangePassword = false
+	user.TokenVersion++
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to update password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.respondWithToken(c, user)
+}
+
+// HandleResetPassword 管理员重置同租户用户的密码，用户下次登录时需修改密码
+func (s *UserService) HandleResetPassword(c *gin.Context) {
+	if c.GetString("role") != types.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"` // 为空时生成临时密码
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := s.store.GetUser(userID)
+	if err != nil || user.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.Provider != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the identity provider"})
+		return
+	}
+
+	generated := req.Password == ""
+	if generated {
+		if req.Password, err = randomString(); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to generate temporary password")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	} else if err := s.policy.Check(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := password.HashPassword(req.Password)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	user.Password = hashedPassword
+	user.MustChangePassword = true
+	user.TokenVersion++
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to reset password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.logger.Info().
+		Int("user_id", user.ID).
+		Int("admin_id", c.GetInt("user_id")).
+		Msg("Password reset by admin")
+
+	if generated {
+		c.JSON(http.StatusOK, gin.H{"temporary_password": req.Password})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// HandleUpdateUserRole 管理员修改同租户用户的角色，用于指定变更集的审批人
+//
+// 用户之前签发的 token 随即失效，新角色在重新登录后生效。管理员不能修改自己的角色，租户中始终至少保留一名管理员。
+func (s *UserService) HandleUpdateUserRole(c *gin.Context) {
+	if c.GetString("role") != types.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if userID == c.GetInt("user_id") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Admins cannot change their own role"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required,oneof=admin user"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := s.store.GetUser(userID)
+	if err != nil || user.TenantID != middleware.TenantID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.Role = req.Role
+	user.TokenVersion++
+	if err := s.store.UpdateUser(user); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to update user role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.logger.Info().
+		Int("user_id", user.ID).
+		Int("admin_id", c.GetInt("user_id")).
+		Str("role", user.Role).
+		Msg("User role changed by admin")
+	c.JSON(http.StatusOK, user)
+}
+
+// HandleOIDCLogin 跳转到 OIDC 提供方进行授权
+func (s *UserService) HandleOIDCLogin(c *gin.Context) {
+	state, err := randomString()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate oidc state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to generate oidc nonce")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	secure := strings.HasPrefix(s.config.Server.OIDC.RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state+"."+nonce, 600, "/", "", secure, true)
+	c.Redirect(http.StatusFound, s.oidc.AuthCodeURL(state, nonce))
+}
+
+// HandleOIDCCallback 处理 OIDC 授权回调，首次登录的用户会被自动创建
+func (s *UserService) HandleOIDCCallback(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC login failed: " + errParam})
+		return
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing OIDC state"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/", "", false, true)
+
+	state, nonce, ok := strings.Cut(cookie, ".")
+	if !ok || state != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OIDC state"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing authorization code"})
+		return
+	}
+
+	rawIDToken, err := s.oidc.Exchange(c.Request.Context(), code)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to exchange oidc code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC login failed"})
+		return
+	}
+
+	claims, err := s.oidc.Verify(c.Request.Context(), rawIDToken, nonce)
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to verify oidc id token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC login failed"})
+		return
+	}
+
+	oidcCfg := s.config.Server.OIDC
+	username := oidc.StringClaim(claims, oidcCfg.UsernameClaim)
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC token does not contain username claim " + oidcCfg.UsernameClaim})
+		return
+	}
+	role := oidc.MapRole(claims, oidcCfg.RoleClaim, oidcCfg.RoleMapping, oidcCfg.DefaultRole)
+
+	user, err := s.provisionOIDCUser(username, role)
+	if err != nil {
+		if errors.Is(err, errUserConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Username already used by a local account"})
+			return
+		}
+		s.logger.Error().Err(err).Msg("Failed to provision oidc user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	s.respondWithToken(c, user)
+}
+
+// errUserConflict 用户名已被本地账户占用
+var errUserConflict = errors.New("username already used by a local account")
+
+// provisionOIDCUser 获取或创建 OIDC 用户，并同步其角色
+func (s *UserService) provisionOIDCUser(username, role string) (*types.User, error) {
+	user, err := s.store.GetUserByUsername(username)
+	if err == nil {
+		if user.Provider != types.AuthProviderOIDC {
+			return nil, errUserConflict
+		}
+		if user.Role != role {
+			user.Role = role
+			user.TokenVersion++
+			if err := s.store.UpdateUser(user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	// OIDC 用户不使用本地密码，写入随机密码的哈希以满足非空约束
+	secret, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := password.HashPassword(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &types.User{
+		Username: username,
+		Password: hashedPassword,
+		TenantID: types.DefaultTenantID,
+		Role:     role,
+		Provider: types.AuthProviderOIDC,
+	}
+	if err := s.store.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("username", username).
+		Str("role", role).
+		Msg("Provisioned oidc user")
+
+	return user, nil
+}
+
+// randomString 生成随机字符串
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
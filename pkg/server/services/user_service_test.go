@@ -0,0 +1,120 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/password"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// TestResetPasswordRevokesTokens 管理员重置密码后用户之前的 token 失效，新 token 在修改密码前只能用于修改密码，
+// 修改密码后之前的 token 同样失效
+func TestResetPasswordRevokesTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.DefaultServerConfig()
+	logger := zerolog.Nop()
+	st := store.NewMemoryStore()
+	jwtAuth := middleware.NewJWTAuthenticator(logger, st, []byte("test"))
+	policy, err := password.NewPolicy(8, "")
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	users := NewUserService(cfg, logger, st, jwtAuth, nil, policy)
+
+	router := gin.New()
+	users.RegisterRoutes(&RouteGroups{
+		Auth:      router.Group("/auth"),
+		Dashboard: router.Group("/dashboard", jwtAuth.JWTAuth()),
+	})
+
+	tenant := &types.Tenant{Name: "acme"}
+	if err := st.CreateTenant(tenant); err != nil {
+		t.Fatalf("CreateTenant: %v", err)
+	}
+	hashed, err := password.HashPassword("original-password")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	admin := &types.User{Username: "owner", Password: hashed, TenantID: tenant.ID, Role: types.RoleAdmin}
+	member := &types.User{Username: "member", Password: hashed, TenantID: tenant.ID, Role: types.RoleUser}
+	for _, user := range []*types.User{admin, member} {
+		if err := st.CreateUser(user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	token := func(user *types.User) string {
+		stored, err := st.GetUser(user.ID)
+		if err != nil {
+			t.Fatalf("GetUser: %v", err)
+		}
+		token, err := jwtAuth.GenerateToken(stored)
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		return token
+	}
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	staleToken := token(member)
+	if w := do(http.MethodGet, "/dashboard/tenant", staleToken, ""); w.Code != http.StatusOK {
+		t.Fatalf("member before reset: status %d, body %s", w.Code, w.Body)
+	}
+
+	w := do(http.MethodPost, fmt.Sprintf("/dashboard/users/%d/reset-password", member.ID), token(admin), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("resetting password: status %d, body %s", w.Code, w.Body)
+	}
+	var reset struct {
+		TemporaryPassword string `json:"temporary_password"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &reset); err != nil {
+		t.Fatalf("decoding reset response: %v", err)
+	}
+
+	if w := do(http.MethodGet, "/dashboard/tenant", staleToken, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("token issued before reset: status %d", w.Code)
+	}
+
+	// 重置后登录得到的 token 只能用于修改密码
+	resetToken := token(member)
+	if w := do(http.MethodGet, "/dashboard/tenant", resetToken, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("token requiring password change: status %d", w.Code)
+	}
+	body := fmt.Sprintf(`{"old_password":%q,"new_password":"changed-password"}`, reset.TemporaryPassword)
+	w = do(http.MethodPost, "/auth/change-password", resetToken, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("changing password: status %d, body %s", w.Code, w.Body)
+	}
+	var changed struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &changed); err != nil {
+		t.Fatalf("decoding change response: %v", err)
+	}
+
+	if w := do(http.MethodPost, "/auth/change-password", resetToken, body); w.Code != http.StatusUnauthorized {
+		t.Fatalf("token issued before password change: status %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/dashboard/tenant", changed.Token, ""); w.Code != http.StatusOK {
+		t.Fatalf("token issued by password change: status %d, body %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// 节点和客户端名称：字母或数字开头，只含字母、数字、_、.、-
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+// hostnamePattern 端点中的域名
+var hostnamePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// validationMessages 各校验规则的错误说明
+var validationMessages = map[string]string{
+	"required": "is required",
+	"name":     "must start with a letter or digit and contain only letters, digits, '_', '.' and '-' (at most 63 characters)",
+	"endpoint": "must be an IP address or hostname, optionally followed by :port",
+	"cidr":     "must be a CIDR prefix such as 10.0.0.0/24",
+	"min":      "is too small",
+	"max":      "is too large",
+}
+
+var registerValidatorsOnce sync.Once
+
+// RegisterValidators 向 gin 的校验器注册自定义规则，并在错误中使用 JSON 字段名
+func RegisterValidators() {
+	registerValidatorsOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		v.RegisterValidation("name", func(fl validator.FieldLevel) bool {
+			return namePattern.MatchString(fl.Field().String())
+		})
+		v.RegisterValidation("endpoint", func(fl validator.FieldLevel) bool {
+			return validEndpoint(fl.Field().String())
+		})
+	})
+}
+
+// validEndpoint 检查端点是否为 IP、[IPv6]:port、host 或 host:port
+func validEndpoint(endpoint string) bool {
+	if net.ParseIP(endpoint) != nil {
+		return true
+	}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		// 不带端口
+		host = endpoint
+	} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	return len(host) <= 253 && hostnamePattern.MatchString(host)
+}
+
+// bindJSON 解析并校验请求体，失败时返回 400，校验错误按字段列出原因
+func bindJSON(c *gin.Context, req any) bool {
+	err := c.ShouldBindJSON(req)
+	if err == nil {
+		return true
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return false
+	}
+	fields := make(map[string]string, len(verrs))
+	for _, fe := range verrs {
+		fields[fieldPath(fe)] = validationMessage(fe)
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": fields})
+	return false
+}
+
+// fieldPath 返回出错字段的路径，去掉顶层结构体名，如 endpoints[2]
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return ns
+}
+
+func validationMessage(fe validator.FieldError) string {
+	msg, ok := validationMessages[fe.Tag()]
+	if !ok {
+		return fmt.Sprintf("failed %s validation", fe.Tag())
+	}
+	if fe.Param() != "" && (fe.Tag() == "min" || fe.Tag() == "max") {
+		return fmt.Sprintf("%s (%s %s)", msg, fe.Tag(), fe.Param())
+	}
+	return msg
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"mesh-backend/pkg/config"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+	"mesh-backend/pkg/utils/clock"
+	"mesh-backend/pkg/utils/idgen"
+
+	"github.com/rs/zerolog"
+)
+
+// webhookSignatureHeader 请求体签名的请求头
+const webhookSignatureHeader = "X-Mesh-Signature"
+
+// WebhookNotifier 将生命周期事件异步发送到配置的 webhook 地址
+//
+// 事件在内存队列中等待发送，失败时按 webhooks.retry_backoff 倍增间隔重试，服务重启时未发送的事件丢失。
+// 方法可在 nil 上调用，未配置 webhook 时不发送。
+type WebhookNotifier struct {
+	config *config.ServerConfig
+	logger zerolog.Logger
+	store  store.Store
+	client *http.Client
+
+	queues []chan *webhookDelivery // 每个地址一个队列，一个地址重试时不阻塞其他地址
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	// 时间源和事件ID生成器，测试中可替换
+	clock clock.Clock
+	ids   idgen.Generator
+}
+
+// webhookDelivery 一个事件到一个地址的投递
+type webhookDelivery struct {
+	endpoint config.WebhookEndpoint
+	event    string
+	id       string
+	body     []byte
+}
+
+// NewWebhookNotifier 创建 webhook 通知器
+func NewWebhookNotifier(cfg *config.ServerConfig, logger zerolog.Logger, store store.Store) *WebhookNotifier {
+	c := clock.Real()
+	n := &WebhookNotifier{
+		config: cfg,
+		logger: logger.With().Str("component", "webhook").Logger(),
+		store:  store,
+		client: &http.Client{Timeout: cfg.Webhooks.Timeout},
+		stopCh: make(chan struct{}),
+		clock:  c,
+		ids:    idgen.NewTimeGenerator(c),
+	}
+	for range cfg.Webhooks.Endpoints {
+		n.queues = append(n.queues, make(chan *webhookDelivery, cfg.Webhooks.QueueSize))
+	}
+	return n
+}
+
+// Start 为每个地址启动发送协程
+func (n *WebhookNotifier) Start() {
+	for _, queue := range n.queues {
+		n.wg.Add(1)
+		go n.run(queue)
+	}
+}
+
+// Stop 停止发送，等待正在进行的请求结束
+func (n *WebhookNotifier) Stop() {
+	close(n.stopCh)
+	n.wg.Wait()
+}
+
+// Emit 向订阅了该事件的地址发送通知，不阻塞调用方；队列已满时丢弃
+func (n *WebhookNotifier) Emit(event string, tenantID int, data any) {
+	if n == nil || len(n.config.Webhooks.Endpoints) == 0 {
+		return
+	}
+
+	payload := &types.WebhookEvent{
+		ID:        n.ids.NewID("evt"),
+		Event:     event,
+		TenantID:  tenantID,
+		Timestamp: n.clock.Now(),
+		Data:      data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		n.logger.Error().Err(err).Str("event", event).Msg("Failed to encode webhook event")
+		return
+	}
+
+	for i, endpoint := range n.config.Webhooks.Endpoints {
+		if len(endpoint.Events) > 0 && !slices.Contains(endpoint.Events, event) {
+			continue
+		}
+		select {
+		case n.queues[i] <- &webhookDelivery{endpoint: endpoint, event: event, id: payload.ID, body: body}:
+		default:
+			n.logger.Warn().Str("event", event).Str("url", endpoint.URL).Msg("Webhook queue full, dropping event")
+		}
+	}
+}
+
+// HandleTaskDone 任务结束时发送 config.pushed 或 task.failed，注册为所有任务类型的结束回调
+func (n *WebhookNotifier) HandleTaskDone(task *types.Task) {
+	var event string
+	switch {
+	case task.Type == types.TaskTypeUpdate && task.Status == types.TaskStatusSuccess:
+		event = types.EventConfigPushed
+	case task.Status == types.TaskStatusFailed || task.Status == types.TaskStatusDeadLetter:
+		event = types.EventTaskFailed
+	default:
+		return
+	}
+
+	tenantID := types.DefaultTenantID
+	if node, err := n.store.GetNode(task.NodeID); err == nil {
+		tenantID = node.TenantID
+	}
+	n.Emit(event, tenantID, map[string]any{
+		"task_id":  task.ID,
+		"node_id":  task.NodeID,
+		"type":     task.Type,
+		"status":   task.Status,
+		"message":  task.Message,
+		"attempts": task.Attempts,
+	})
+}
+
+// run 依次发送一个地址队列中的事件，保持事件顺序
+func (n *WebhookNotifier) run(queue chan *webhookDelivery) {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case delivery := <-queue:
+			n.deliver(delivery)
+		}
+	}
+}
+
+// deliver 发送事件，失败时重试，重试耗尽或服务停止时放弃
+func (n *WebhookNotifier) deliver(d *webhookDelivery) {
+	backoff := n.config.Webhooks.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := n.post(d)
+		if err == nil {
+			return
+		}
+		if attempt >= n.config.Webhooks.MaxRetries {
+			n.logger.Error().
+				Err(err).
+				Str("event", d.event).
+				Str("event_id", d.id).
+				Str("url", d.endpoint.URL).
+				Int("attempts", attempt+1).
+				Msg("Giving up webhook delivery")
+			return
+		}
+		n.logger.Warn().
+			Err(err).
+			Str("event", d.event).
+			Str("url", d.endpoint.URL).
+			Dur("retry_in", backoff).
+			Msg("Webhook delivery failed, retrying")
+
+		select {
+		case <-n.stopCh:
+			return
+		case <-n.clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post 发送一次请求，返回非 2xx 时视为失败
+func (n *WebhookNotifier) post(d *webhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.config.Webhooks.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Mesh-Event", d.event)
+	req.Header.Set("X-Mesh-Delivery", d.id)
+	req.Header.Set(webhookSignatureHeader, signWebhook(d.endpoint.Secret, d.body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhook 计算请求体的签名，格式为 sha256=<HMAC-SHA256 十六进制>
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mesh-backend/pkg/server/middleware"
+	"mesh-backend/pkg/store"
+	"mesh-backend/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/curve25519"
+)
+
+// wgConf 解析后的 wg-quick 配置或 wg showconf 输出
+type wgConf struct {
+	PrivateKey string
+	ListenPort int
+	Addresses  []string
+	Peers      []wgConfPeer
+}
+
+// wgConfPeer wg 配置中的一个 [Peer] 段
+type wgConfPeer struct {
+	PublicKey string
+	Endpoint  string // host:port，可能为空
+}
+
+// importNode 导入请求中的一个节点
+type importNode struct {
+	ID       int    `json:"id"`                                    // 为 0 时自动分配
+	Name     string `json:"name" binding:"required,name"`          // 节点名，也是其他节点上指向它的接口名
+	Endpoint string `json:"endpoint" binding:"omitempty,endpoint"` // 为空时从其他节点配置中指向它的 Endpoint 推断
+	// 节点上现有的 WireGuard 配置，键为接口名，值为配置文件内容或 wg showconf 的输出；
+	// 所有配置须使用同一私钥
+	Configs map[string]string `json:"configs"`
+
+	ipv4, ipv6 string // 端点解析出的地址
+
+	conf       []*wgConf
+	privateKey string
+	publicKey  string
+}
+
+// importLink 导入时发现的一条链路
+type importLink struct {
+	NodeName string `json:"node_name"`
+	PeerName string `json:"peer_name"`
+	Port     int    `json:"port"`      // 沿用的 NodeName 一端监听端口，0 表示由服务端重新分配
+	PeerPort int    `json:"peer_port"` // 沿用的 PeerName 一端监听端口
+	Created  bool   `json:"created"`   // 已存在的链路不会重复创建
+
+	node, peer           *importNode
+	nodeAddrs, peerAddrs []string
+	nodePort, peerPort   int
+}
+
+// HandleImportWireGuard 从现有的 WireGuard 配置导入节点和链路，沿用原有密钥
+//
+// 节点之间以公钥匹配，两端的监听端口都未被占用时沿用（两端可以不同），否则由服务端重新分配；
+// 接口地址中的链路本地地址会保留。?dry_run=true 时只返回解析结果，不写入。
+// 导入的节点在 agent 首次连接时下发配置，此前原有的 WireGuard 配置保持不变。
+func (s *NodeService) HandleImportWireGuard(c *gin.Context) {
+	var req struct {
+		Nodes []*importNode `json:"nodes" binding:"required,dive"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	tenantID := middleware.TenantID(c)
+
+	existing, err := s.ListTenantNodes(c.Request.Context(), tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	links, warnings, err := planWireGuardImport(req.Nodes, existing)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requestedIDs := make(map[int]bool, len(req.Nodes))
+	for _, n := range req.Nodes {
+		if n.ID > 0 {
+			if requestedIDs[n.ID] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("节点ID %d 重复", n.ID)})
+				return
+			}
+			requestedIDs[n.ID] = true
+			if node, err := s.GetNode(c.Request.Context(), n.ID); err == nil && node != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("节点ID %d 已存在", n.ID)})
+				return
+			}
+		}
+	}
+	for _, n := range req.Nodes {
+		if n.Endpoint == "" {
+			continue
+		}
+		if n.ipv4, n.ipv6, err = resolveEndpoint(c.Request.Context(), n.Endpoint); err != nil {
+			warnings = append(warnings, fmt.Sprintf("node %s: %v", n.Name, err))
+		}
+	}
+	candidates := make([]*types.NodeConfig, 0, len(req.Nodes))
+	for _, n := range req.Nodes {
+		candidates = append(candidates, &types.NodeConfig{ID: n.ID, Name: n.Name})
+	}
+	if err := s.checkNodeInterfaces(c.Request.Context(), tenantID, candidates...); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		nodes := make([]gin.H, 0, len(req.Nodes))
+		for _, n := range req.Nodes {
+			nodes = append(nodes, gin.H{"name": n.Name, "endpoint": n.Endpoint, "public_key": n.publicKey})
+		}
+		for _, link := range links {
+			if link.node != nil && link.peer != nil && link.nodePort != 0 && link.peerPort != 0 {
+				link.Port, link.PeerPort = link.nodePort, link.peerPort
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"nodes": nodes, "links": links, "warnings": warnings})
+		return
+	}
+
+	// 先创建节点，端口检查需要两端节点存在
+	created := make([]gin.H, 0, len(req.Nodes))
+	ids := make(map[*importNode]int, len(req.Nodes))
+	for _, n := range req.Nodes {
+		node, err := s.createImportedNode(tenantID, n)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrNodeIDTaken) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error(), "nodes": created})
+			return
+		}
+		ids[n] = node.ID
+		created = append(created, gin.H{"id": node.ID, "name": node.Name, "token": node.Token, "public_key": node.PublicKey})
+		s.webhooks.Emit(types.EventNodeCreated, tenantID, gin.H{"id": node.ID, "name": node.Name, "public_key": node.PublicKey})
+	}
+	for _, link := range links {
+		conn, warning, err := s.createImportedLink(link, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "nodes": created})
+			return
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		if conn != nil {
+			link.Created = true
+			link.Port, link.PeerPort = conn.Port, conn.PeerPort
+		}
+	}
+
+	s.notifyMeshChange()
+	s.logger.Info().
+		Int("tenant_id", tenantID).
+		Int("nodes", len(created)).
+		Int("links", len(links)).
+		Msg("Imported existing WireGuard setup")
+	c.JSON(http.StatusOK, gin.H{"nodes": created, "links": links, "warnings": warnings})
+}
+
+// planWireGuardImport 解析各节点的配置并按公钥匹配出链路，existing 为租户内已有的节点
+func planWireGuardImport(nodes []*importNode, existing []*types.NodeConfig) ([]*importLink, []string, error) {
+	if len(nodes) == 0 {
+		return nil, nil, fmt.Errorf("no nodes to import")
+	}
+	names := make(map[string]bool, len(existing)+len(nodes))
+	byKey := make(map[string]*importNode, len(existing)+len(nodes))
+	existingByKey := make(map[string]*types.NodeConfig, len(existing))
+	for _, node := range existing {
+		names[node.Name] = true
+		existingByKey[node.PublicKey] = node
+	}
+
+	for _, n := range nodes {
+		if n.Name == "" || n.Name == types.ClientInterfaceName {
+			return nil, nil, fmt.Errorf("invalid node name %q", n.Name)
+		}
+		if names[n.Name] {
+			return nil, nil, fmt.Errorf("node %s already exists", n.Name)
+		}
+		names[n.Name] = true
+		if len(n.Configs) == 0 {
+			return nil, nil, fmt.Errorf("node %s: no wireguard configs", n.Name)
+		}
+
+		ifaces := make([]string, 0, len(n.Configs))
+		for iface := range n.Configs {
+			ifaces = append(ifaces, iface)
+		}
+		sort.Strings(ifaces)
+		for _, iface := range ifaces {
+			conf, err := parseWireGuardConf(n.Configs[iface])
+			if err != nil {
+				return nil, nil, fmt.Errorf("node %s, %s: %w", n.Name, iface, err)
+			}
+			if n.privateKey == "" {
+				n.privateKey = conf.PrivateKey
+			} else if conf.PrivateKey != n.privateKey {
+				// 服务端为每个节点保存一对密钥，各接口使用不同密钥的节点只能重新生成密钥
+				return nil, nil, fmt.Errorf("node %s: %s uses a different private key than the other interfaces", n.Name, iface)
+			}
+			n.conf = append(n.conf, conf)
+		}
+		publicKey, err := wireGuardPublicKey(n.privateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("node %s: %w", n.Name, err)
+		}
+		n.publicKey = publicKey
+		if byKey[publicKey] != nil || existingByKey[publicKey] != nil {
+			return nil, nil, fmt.Errorf("node %s: public key %s is already used by another node", n.Name, publicKey)
+		}
+		byKey[publicKey] = n
+	}
+
+	var warnings []string
+	links := make(map[[2]string]*importLink)
+	for _, n := range nodes {
+		for _, conf := range n.conf {
+			for _, p := range conf.Peers {
+				peer := byKey[p.PublicKey]
+				if peer == nil {
+					if node := existingByKey[p.PublicKey]; node != nil {
+						warnings = append(warnings, fmt.Sprintf("node %s: peer %s is already managed, link will be allocated by the server", n.Name, node.Name))
+					} else {
+						warnings = append(warnings, fmt.Sprintf("node %s: peer %s is not part of the import, skipped", n.Name, p.PublicKey))
+					}
+					continue
+				}
+				// 本节点配置中的 Endpoint 即对端的地址
+				if host, _, err := net.SplitHostPort(p.Endpoint); err == nil && peer.Endpoint == "" {
+					peer.Endpoint = host
+				}
+
+				key := [2]string{n.Name, peer.Name}
+				if n.Name > peer.Name {
+					key = [2]string{peer.Name, n.Name}
+				}
+				link := links[key]
+				if link == nil {
+					link = &importLink{NodeName: key[0], PeerName: key[1]}
+					links[key] = link
+				}
+				if n.Name == link.NodeName {
+					link.node, link.nodePort, link.nodeAddrs = n, conf.ListenPort, conf.Addresses
+				} else {
+					link.peer, link.peerPort, link.peerAddrs = n, conf.ListenPort, conf.Addresses
+				}
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		if n.Endpoint == "" {
+			return nil, nil, fmt.Errorf("node %s: endpoint is required, no peer config points to it", n.Name)
+		}
+	}
+
+	result := make([]*importLink, 0, len(links))
+	for _, link := range links {
+		if link.node == nil || link.peer == nil {
+			warnings = append(warnings, fmt.Sprintf("link %s-%s is only configured on one side, a new port will be allocated", link.NodeName, link.PeerName))
+		}
+		result = append(result, link)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].NodeName != result[j].NodeName {
+			return result[i].NodeName < result[j].NodeName
+		}
+		return result[i].PeerName < result[j].PeerName
+	})
+	return result, warnings, nil
+}
+
+// createImportedNode 以导入的密钥创建节点
+func (s *NodeService) createImportedNode(tenantID int, n *importNode) (*types.NodeConfig, error) {
+	token, err := s.GenerateNodeToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	peersBytes, _ := json.Marshal([]string{})
+	endpointBytes, _ := json.Marshal([]string{n.Endpoint})
+	node := &types.NodeConfig{
+		ID:         n.ID,
+		TenantID:   tenantID,
+		Name:       n.Name,
+		Token:      token,
+		Peers:      string(peersBytes),
+		Endpoints:  string(endpointBytes),
+		PrivateKey: n.privateKey,
+		PublicKey:  n.publicKey,
+		IPv4:       n.ipv4,
+		IPv6:       n.ipv6,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.store.CreateNode(node); err != nil {
+		return nil, fmt.Errorf("creating node %s: %w", n.Name, err)
+	}
+	return node, nil
+}
+
+// createImportedLink 创建导入的链路，两端的监听端口可用时沿用；
+// 否则不创建，由配置生成时按全互联拓扑分配端口
+func (s *NodeService) createImportedLink(link *importLink, ids map[*importNode]int) (*types.WireguardConnection, string, error) {
+	if link.node == nil || link.peer == nil {
+		return nil, "", nil
+	}
+	conn := &types.WireguardConnection{
+		NodeID:        ids[link.node],
+		PeerID:        ids[link.peer],
+		NodeLinkLocal: linkLocalAddress(link.nodeAddrs),
+		PeerLinkLocal: linkLocalAddress(link.peerAddrs),
+	}
+
+	var warning string
+	switch {
+	case link.nodePort == 0 || link.peerPort == 0:
+		warning = fmt.Sprintf("link %s-%s: no ListenPort set, a new port will be allocated", link.NodeName, link.PeerName)
+	default:
+		if err := s.checkConnectionPort(conn, link.nodePort, link.peerPort); err != nil {
+			warning = fmt.Sprintf("link %s-%s: %v, a new port will be allocated", link.NodeName, link.PeerName, err)
+		} else {
+			conn.Port, conn.PeerPort = link.nodePort, link.peerPort
+		}
+	}
+	if conn.Port == 0 {
+		return nil, warning, nil
+	}
+
+	if err := s.store.CreateWireguardConnections([]*types.WireguardConnection{conn}); err != nil {
+		return nil, "", fmt.Errorf("creating link %s-%s: %w", link.NodeName, link.PeerName, err)
+	}
+	if conn.ID == 0 {
+		return nil, fmt.Sprintf("link %s-%s already exists", link.NodeName, link.PeerName), nil
+	}
+	// 未保留链路本地地址的一端按模板生成
+	if err := s.assignLinkLocal(map[int]*types.WireguardConnection{conn.ID: conn}); err != nil {
+		return nil, "", err
+	}
+	return conn, warning, nil
+}
+
+// linkLocalAddress 返回接口地址中的 IPv6 链路本地地址（含前缀长度），没有时返回空字符串
+func linkLocalAddress(addrs []string) string {
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr)
+		if err != nil {
+			ip = net.ParseIP(addr)
+			addr += "/64"
+		}
+		if ip != nil && ip.To4() == nil && ip.IsLinkLocalUnicast() {
+			return addr
+		}
+	}
+	return ""
+}
+
+// parseWireGuardConf 解析 wg-quick 配置或 wg showconf 输出，忽略 wg-quick 专用的其他字段
+func parseWireGuardConf(content string) (*wgConf, error) {
+	conf := &wgConf{}
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			if section == "peer" {
+				conf.Peers = append(conf.Peers, wgConfPeer{})
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch section {
+		case "interface":
+			switch key {
+			case "privatekey":
+				conf.PrivateKey = value
+			case "listenport":
+				port, err := strconv.Atoi(value)
+				if err != nil || port < 1 || port > 65535 {
+					return nil, fmt.Errorf("line %d: invalid ListenPort %s", n, value)
+				}
+				conf.ListenPort = port
+			case "address":
+				for _, addr := range strings.Split(value, ",") {
+					conf.Addresses = append(conf.Addresses, strings.TrimSpace(addr))
+				}
+			}
+		case "peer":
+			peer := &conf.Peers[len(conf.Peers)-1]
+			switch key {
+			case "publickey":
+				peer.PublicKey = value
+			case "endpoint":
+				peer.Endpoint = value
+			}
+		default:
+			return nil, fmt.Errorf("line %d: key outside of a section", n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if conf.PrivateKey == "" {
+		return nil, fmt.Errorf("missing PrivateKey")
+	}
+	for i, peer := range conf.Peers {
+		if peer.PublicKey == "" {
+			return nil, fmt.Errorf("peer %d: missing PublicKey", i+1)
+		}
+	}
+	return conf, nil
+}
+
+// wireGuardPublicKey 由 base64 编码的私钥计算公钥
+func wireGuardPublicKey(privateKey string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("invalid private key")
+	}
+	var private, public [32]byte
+	copy(private[:], raw)
+	curve25519.ScalarBaseMult(&public, &private)
+	return base64.StdEncoding.EncodeToString(public[:]), nil
+}
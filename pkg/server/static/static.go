@@ -2,6 +2,7 @@ package static
 
 import (
 	"embed"
+	"errors"
 	"io/fs"
 	"net/http"
 	"os"
@@ -11,19 +12,52 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-//go:embed dist/*
+// content 前端构建产物，由 make frontend 复制到 dist 目录；未构建时只包含占位文件
+//
+//go:embed all:dist
 var content embed.FS
 
-func Register(r *gin.Engine) {
-	r.Use(Serve("/", EmbedFolder(content, "dist")))
+// ErrNotBuilt 二进制中未包含前端构建产物
+var ErrNotBuilt = errors.New("web UI is not built into this binary, run make frontend before building")
+
+// Register 在 basePath 下提供内嵌的前端文件
+//
+// 存在的文件直接返回；其余不带扩展名的 GET 请求返回 index.html，由前端路由处理（SPA 回退）。
+// API、指标和缺失的静态资源返回 404，避免把 index.html 当作资源或接口响应返回。
+func Register(r *gin.Engine, basePath string) error {
+	index, err := content.ReadFile("dist/" + INDEX)
+	if err != nil {
+		return ErrNotBuilt
+	}
+
+	r.Use(Serve(basePath+"/", EmbedFolder(content, "dist")))
 	r.NoRoute(func(c *gin.Context) {
-		data, err := content.ReadFile("dist/index.html")
-		if err != nil {
-			c.AbortWithError(http.StatusInternalServerError, err)
+		if !spaRoute(c.Request, basePath) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
 			return
 		}
-		c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
 	})
+	return nil
+}
+
+// spaRoute 判断未匹配的请求是否应由前端路由处理
+func spaRoute(r *http.Request, basePath string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	p := r.URL.Path
+	if basePath != "" {
+		if p != basePath && !strings.HasPrefix(p, basePath+"/") {
+			return false
+		}
+		p = strings.TrimPrefix(p, basePath)
+	}
+	if p == "/api" || strings.HasPrefix(p, "/api/") || p == "/metrics" {
+		return false
+	}
+	return !strings.Contains(path.Base(p), ".")
 }
 
 const INDEX = "index.html"
@@ -91,7 +125,11 @@ type embedFileSystem struct {
 }
 
 func (e embedFileSystem) Exists(prefix string, path string) bool {
-	_, err := e.Open(path)
+	p := strings.TrimPrefix(path, prefix)
+	if len(p) == len(path) {
+		return false
+	}
+	_, err := e.Open("/" + p)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+
+	"mesh-backend/pkg/server/ca"
+)
+
+// muxTLSCreds 向 gRPC 暴露由监听器终止的 TLS 连接
+//
+// TLS 由监听器终止，单端口模式下在 cmux 之前完成握手，gRPC 服务端不再握手，只从底层连接读取 TLS 状态，
+// 使处理函数可以通过 peer 信息取得客户端证书。
+type muxTLSCreds struct{}
+
+func (muxTLSCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	// 分离端口模式下 gRPC 直接使用 TLS 监听器，握手在首次读写时才进行
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return nil, nil, err
+		}
+	}
+	state := ca.ConnState(conn)
+	if state == nil {
+		return conn, nil, nil
+	}
+	return conn, credentials.TLSInfo{
+		State:          *state,
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func (muxTLSCreds) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("muxTLSCreds: client handshake not supported")
+}
+
+func (muxTLSCreds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2"}
+}
+
+func (c muxTLSCreds) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (muxTLSCreds) OverrideServerName(string) error {
+	return nil
+}
@@ -1,18 +1,40 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"mesh-backend/pkg/types"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
+// nodeIDSequence 节点 ID 序列的名称
+const nodeIDSequence = "node"
+
+// userRegistrationLock 创建租户首个用户时锁定的序列行，使检查与创建在多个实例间串行进行
+const userRegistrationLock = "user_registration"
+
+// idSequence 集中分配的 ID 序列，多个服务端实例共用同一数据库时通过行锁保证分配不重复。
+// 与数据库自增列不同，删除记录后不会重新分配其 ID，运维指定的 ID 也会推进序列
+type idSequence struct {
+	Name  string `gorm:"primaryKey;size:32"`
+	Value int    `gorm:"not null"` // 最近分配的 ID
+}
+
 // GormStore 通用GORM存储实现
 type GormStore struct {
 	db *gorm.DB
+
+	// 写入控制
+	writeMu     *sync.Mutex // 非空时串行化所有写操作（SQLite 单写者）
+	busyRetries int         // 数据库繁忙时的最大重试次数
 }
 
 // NewGormStore 创建GORM存储实例
@@ -34,12 +56,99 @@ func NewGormStore(dialector gorm.Dialector) (*GormStore, error) {
 	return store, nil
 }
 
+// WithContext 返回绑定到 ctx 的存储，与原存储共享连接池和写锁
+func (s *GormStore) WithContext(ctx context.Context) Store {
+	bound := *s
+	bound.db = s.db.WithContext(ctx)
+	return &bound
+}
+
+// retryOnBusy 执行操作，数据库繁忙时按指数退避重试，请求取消后不再重试
+func (s *GormStore) retryOnBusy(fn func() error) error {
+	ctx := s.db.Statement.Context
+	backoff := 20 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusyError(err) || attempt >= s.busyRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff < time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// write 执行写操作，按需串行化并在数据库繁忙时重试
+func (s *GormStore) write(fn func(db *gorm.DB) *gorm.DB) *gorm.DB {
+	if s.writeMu != nil {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+	}
+
+	var result *gorm.DB
+	s.retryOnBusy(func() error {
+		result = fn(s.db)
+		return result.Error
+	})
+	return result
+}
+
+// writeTx 在事务中执行写操作，按需串行化并在数据库繁忙时重试
+func (s *GormStore) writeTx(fn func(tx *gorm.DB) error) error {
+	if s.writeMu != nil {
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+	}
+
+	return s.retryOnBusy(func() error {
+		return s.db.Transaction(fn)
+	})
+}
+
+// isBusyError 判断是否为数据库繁忙/锁定错误
+func isBusyError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "SQLITE_BUSY") ||
+		strings.Contains(msg, "database table is locked")
+}
+
+// isDuplicateKeyError 判断是否为主键或唯一约束冲突
+func (s *GormStore) isDuplicateKeyError(err error) bool {
+	translator, ok := s.db.Dialector.(gorm.ErrorTranslator)
+	return ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+}
+
 // initialize 初始化数据库
 func (s *GormStore) initialize() error {
-	err := s.db.AutoMigrate(&types.NodeConfig{}, &types.NodeStatus{}, &types.Task{}, &types.WireguardConnection{}, &types.User{})
+	err := s.db.AutoMigrate(&types.NodeConfig{}, &types.NodeStatus{}, &types.Task{}, &types.WireguardConnection{}, &types.User{}, &types.Tenant{}, &types.BandwidthTest{}, &types.Changeset{}, &types.TrafficUsage{}, &types.ClientPeer{}, &idSequence{})
 	if err != nil {
 		return fmt.Errorf("auto migrating tables: %w", err)
 	}
+	// 引入地址规划之前的节点按节点 ID 编址
+	if err := s.db.Model(&types.NodeConfig{}).Where("address_index = 0").Update("address_index", gorm.Expr("id")).Error; err != nil {
+		return fmt.Errorf("migrating node address indexes: %w", err)
+	}
+	// 序列从已有节点的最大 ID 开始，多个实例同时启动时只有一个写入
+	var maxNodeID int
+	if err := s.db.Model(&types.NodeConfig{}).Select("COALESCE(MAX(id), 0)").Scan(&maxNodeID).Error; err != nil {
+		return fmt.Errorf("querying max node id: %w", err)
+	}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&idSequence{Name: nodeIDSequence, Value: maxNodeID}).Error; err != nil {
+		return fmt.Errorf("initializing node id sequence: %w", err)
+	}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&idSequence{Name: userRegistrationLock}).Error; err != nil {
+		return fmt.Errorf("initializing user registration lock: %w", err)
+	}
+	// 两端分别记录监听端口之前的连接两端使用同一端口
+	if err := s.db.Model(&types.WireguardConnection{}).Where("peer_port = 0").Update("peer_port", gorm.Expr("port")).Error; err != nil {
+		return fmt.Errorf("migrating connection peer ports: %w", err)
+	}
 	return nil
 }
 
@@ -47,7 +156,7 @@ func (s *GormStore) initialize() error {
 func (s *GormStore) CreateUser(user *types.User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
-	result := s.db.Create(user)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Create(user) })
 	if result.Error != nil {
 		return fmt.Errorf("creating user: %w", result.Error)
 	}
@@ -90,10 +199,37 @@ func (s *GormStore) CheckUserExists(username string) (bool, error) {
 	return count > 0, nil
 }
 
+// CreateUserWithFirstRole 创建用户，租户还没有用户时以 firstRole 作为其角色。
+// 事务先推进 userRegistrationLock 行，行锁使并发注册依次检查租户的用户数
+func (s *GormStore) CreateUserWithFirstRole(user *types.User, firstRole string) error {
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	role := user.Role
+	err := s.writeTx(func(tx *gorm.DB) error {
+		if _, err := nextID(tx, userRegistrationLock); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&types.User{}).Where("tenant_id = ?", user.TenantID).Count(&count).Error; err != nil {
+			return fmt.Errorf("counting tenant users: %w", err)
+		}
+		// 事务重试时按最初请求的角色重新判断
+		user.Role = role
+		if count == 0 {
+			user.Role = firstRole
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return fmt.Errorf("creating user: %w", err)
+	}
+	return nil
+}
+
 // UpdateUser 更新用户
 func (s *GormStore) UpdateUser(user *types.User) error {
 	user.UpdatedAt = time.Now()
-	result := s.db.Save(user)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Save(user) })
 	if result.Error != nil {
 		return fmt.Errorf("updating user: %w", result.Error)
 	}
@@ -102,18 +238,151 @@ func (s *GormStore) UpdateUser(user *types.User) error {
 
 // DeleteUser 删除用户
 func (s *GormStore) DeleteUser(id int) error {
-	result := s.db.Delete(&types.User{}, id)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Delete(&types.User{}, id) })
 	if result.Error != nil {
 		return fmt.Errorf("deleting user: %w", result.Error)
 	}
 	return nil
 }
 
+// CreateTenant 创建租户
+func (s *GormStore) CreateTenant(tenant *types.Tenant) error {
+	tenant.CreatedAt = time.Now()
+	tenant.UpdatedAt = time.Now()
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Create(tenant) })
+	if result.Error != nil {
+		return fmt.Errorf("creating tenant: %w", result.Error)
+	}
+	return nil
+}
+
+// GetTenant 获取租户
+func (s *GormStore) GetTenant(id int) (*types.Tenant, error) {
+	var tenant types.Tenant
+	result := s.db.First(&tenant, id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("getting tenant: %w", result.Error)
+	}
+	return &tenant, nil
+}
+
+// GetTenantByName 通过名称获取租户
+func (s *GormStore) GetTenantByName(name string) (*types.Tenant, error) {
+	var tenant types.Tenant
+	result := s.db.Where("name = ?", name).First(&tenant)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("getting tenant by name: %w", result.Error)
+	}
+	return &tenant, nil
+}
+
+// UpdateTenantBabelPolicy 更新租户的 babeld 过滤策略，policy 为 nil 时恢复默认策略
+func (s *GormStore) UpdateTenantBabelPolicy(tenantID int, policy *types.BabelPolicy) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.Tenant{ID: tenantID}).
+			Select("babel_policy", "updated_at").
+			Updates(&types.Tenant{BabelPolicy: policy, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating tenant babel policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateTenantACLPolicy 更新租户的访问控制策略，policy 为 nil 时不限制
+func (s *GormStore) UpdateTenantACLPolicy(tenantID int, policy *types.ACLPolicy) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.Tenant{ID: tenantID}).
+			Select("acl_policy", "updated_at").
+			Updates(&types.Tenant{ACLPolicy: policy, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating tenant acl policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateTenantBGPConfig 更新租户的 BGP 对接设置，bgp 为 nil 时不对接
+func (s *GormStore) UpdateTenantBGPConfig(tenantID int, bgp *types.BGPConfig) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.Tenant{ID: tenantID}).
+			Select("bgp", "updated_at").
+			Updates(&types.Tenant{BGP: bgp, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating tenant bgp config: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateTenantRoutingDaemon 更新租户使用的路由守护进程，为空时使用 babeld
+func (s *GormStore) UpdateTenantRoutingDaemon(tenantID int, daemon string) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.Tenant{ID: tenantID}).
+			Select("routing_daemon", "updated_at").
+			Updates(&types.Tenant{RoutingDaemon: daemon, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating tenant routing daemon: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateTenantMaintenancePolicy 更新租户的维护窗口，policy 为 nil 时使用全局设置
+func (s *GormStore) UpdateTenantMaintenancePolicy(tenantID int, policy *types.MaintenancePolicy) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.Tenant{ID: tenantID}).
+			Select("maintenance_policy", "updated_at").
+			Updates(&types.Tenant{MaintenancePolicy: policy, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating tenant maintenance policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateTenantNetworkSettings 更新租户网络的默认参数，settings 为 nil 时使用服务端配置
+func (s *GormStore) UpdateTenantNetworkSettings(tenantID int, settings *types.NetworkSettings) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.Tenant{ID: tenantID}).
+			Select("settings", "updated_at").
+			Updates(&types.Tenant{Settings: settings, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating tenant network settings: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // CreateTask 保存任务
 func (s *GormStore) CreateTask(task *types.Task) error {
 	task.CreatedAt = time.Now()
 	task.UpdatedAt = time.Now()
-	result := s.db.Create(&task)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Create(&task) })
 	if result.Error != nil {
 		return fmt.Errorf("inserting task: %w", result.Error)
 	}
@@ -124,7 +393,7 @@ func (s *GormStore) CreateTask(task *types.Task) error {
 func (s *GormStore) UpdateTask(task *types.Task) error {
 	task.UpdatedAt = time.Now()
 
-	result := s.db.Save(task)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Save(task) })
 	if result.Error != nil {
 		return fmt.Errorf("updating task: %w", result.Error)
 	}
@@ -145,13 +414,27 @@ func (s *GormStore) GetTask(id string) (*types.Task, error) {
 
 // ListTasks 列出任务
 func (s *GormStore) ListTasks(filter TaskFilter) ([]*types.Task, error) {
-	// Unimplemented
-	return nil, nil
+	query := s.db.Model(&types.Task{})
+	if filter.NodeID != nil {
+		query = query.Where("node_id = ?", *filter.NodeID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.Type != nil {
+		query = query.Where("type = ?", *filter.Type)
+	}
+
+	var tasks []*types.Task
+	if err := query.Order("created_at").Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("querying tasks: %w", err)
+	}
+	return tasks, nil
 }
 
 // DeleteTask 删除任务
 func (s *GormStore) DeleteTask(id string) error {
-	result := s.db.Delete(&types.Task{}, "id = ?", id)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Delete(&types.Task{}, "id = ?", id) })
 	if result.Error != nil {
 		return fmt.Errorf("deleting task: %w", result.Error)
 	}
@@ -159,15 +442,26 @@ func (s *GormStore) DeleteTask(id string) error {
 	return nil
 }
 
-// CleanupTasks 清理过期任务
-func (s *GormStore) CleanupTasks() error {
-	// cutoff := time.Now().Add(-24 * time.Hour)
-	// _, err := s.db.Exec("DELETE FROM tasks WHERE completed_at < ?", cutoff)
-	result := s.db.Delete(&types.Task{}, "completed_at < ?", time.Now().Add(-24*time.Hour))
+// CleanupTasks 删除指定状态下完成时间早于 before 的任务
+func (s *GormStore) CleanupTasks(status types.TaskStatus, before time.Time) (int64, error) {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Delete(&types.Task{}, "status = ? AND completed_at < ?", status, before)
+	})
 	if result.Error != nil {
-		return fmt.Errorf("deleting tasks: %w", result.Error)
+		return 0, fmt.Errorf("deleting tasks: %w", result.Error)
 	}
-	return nil
+	return result.RowsAffected, nil
+}
+
+// CleanupNodeStatuses 删除最后上报时间早于 before 的节点状态
+func (s *GormStore) CleanupNodeStatuses(before time.Time) (int64, error) {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Delete(&types.NodeStatus{}, "timestamp < ?", before)
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("deleting node statuses: %w", result.Error)
+	}
+	return result.RowsAffected, nil
 }
 
 // Close 关闭数据库连接
@@ -178,20 +472,92 @@ func (s *GormStore) Close() error {
 
 // CreateNode 创建节点
 func (s *GormStore) CreateNode(node *types.NodeConfig) error {
-	result := s.db.Create(node)
-	if result.Error != nil {
-		return fmt.Errorf("creating node: %w", result.Error)
+	requested, requestedIndex := node.ID, node.AddressIndex
+	err := s.writeTx(func(tx *gorm.DB) error {
+		// 数据库繁忙重试时恢复请求的 ID，回滚的事务中分配的 ID 无效
+		node.ID, node.AddressIndex = requested, requestedIndex
+		if requested == 0 {
+			id, err := nextID(tx, nodeIDSequence)
+			if err != nil {
+				return err
+			}
+			node.ID = id
+		} else {
+			var count int64
+			if err := tx.Model(&types.NodeConfig{}).Where("id = ?", node.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: %d", ErrNodeIDTaken, node.ID)
+			}
+			// 指定的 ID 超过序列时推进序列，之后自动分配的 ID 不会与之冲突
+			if err := tx.Model(&idSequence{}).
+				Where("name = ? AND value < ?", nodeIDSequence, node.ID).
+				Update("value", node.ID).Error; err != nil {
+				return err
+			}
+		}
+		if node.AddressIndex == 0 {
+			index, err := freeAddressIndex(tx, node.ID)
+			if err != nil {
+				return err
+			}
+			node.AddressIndex = index
+		}
+		if err := tx.Create(node).Error; err != nil {
+			// 并发创建同一指定 ID 时检查都会通过，后插入的事务违反主键约束
+			if requested != 0 && s.isDuplicateKeyError(err) {
+				return fmt.Errorf("%w: %d", ErrNodeIDTaken, node.ID)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("creating node: %w", err)
 	}
 	return nil
 }
 
+// freeAddressIndex 返回新节点的地址编号：优先与节点 ID 相同，已被重新编址的节点占用时取当前最大编号加一
+func freeAddressIndex(tx *gorm.DB, nodeID int) (int, error) {
+	var count int64
+	if err := tx.Model(&types.NodeConfig{}).Where("address_index = ?", nodeID).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("checking address index: %w", err)
+	}
+	if count == 0 {
+		return nodeID, nil
+	}
+	var maxIndex int
+	if err := tx.Model(&types.NodeConfig{}).Select("COALESCE(MAX(address_index), 0)").Scan(&maxIndex).Error; err != nil {
+		return 0, fmt.Errorf("querying max address index: %w", err)
+	}
+	return maxIndex + 1, nil
+}
+
+// nextID 在事务中推进序列并返回新的值，UPDATE 持有的行锁使并发的分配依次进行
+func nextID(tx *gorm.DB, name string) (int, error) {
+	result := tx.Model(&idSequence{}).Where("name = ?", name).UpdateColumn("value", gorm.Expr("value + 1"))
+	if result.Error != nil {
+		return 0, fmt.Errorf("advancing %s id sequence: %w", name, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return 0, fmt.Errorf("%s id sequence not initialized", name)
+	}
+	var seq idSequence
+	if err := tx.Where("name = ?", name).First(&seq).Error; err != nil {
+		return 0, fmt.Errorf("reading %s id sequence: %w", name, err)
+	}
+	return seq.Value, nil
+}
+
 // GetNode 获取节点
 func (s *GormStore) GetNode(nodeID int) (*types.NodeConfig, error) {
 	var node types.NodeConfig
 	result := s.db.Preload("Status").First(&node, nodeID)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("node %d not found", nodeID)
+			return nil, fmt.Errorf("node %d %w", nodeID, ErrNotFound)
 		}
 		return nil, fmt.Errorf("querying node: %w", result.Error)
 	}
@@ -200,7 +566,9 @@ func (s *GormStore) GetNode(nodeID int) (*types.NodeConfig, error) {
 
 // UpdateNode 更新节点
 func (s *GormStore) UpdateNode(nodeID int, node *types.NodeConfig) error {
-	result := s.db.Model(&types.NodeConfig{}).Where("id = ?", nodeID).Updates(node)
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{}).Where("id = ?", nodeID).Updates(node)
+	})
 	if result.Error != nil {
 		return fmt.Errorf("updating node: %w", result.Error)
 	}
@@ -210,9 +578,235 @@ func (s *GormStore) UpdateNode(nodeID int, node *types.NodeConfig) error {
 	return nil
 }
 
+// UpdateNodeMetadata 更新节点备注信息，允许清空字段
+func (s *GormStore) UpdateNodeMetadata(nodeID int, metadata *types.NodeMetadata) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{}).
+			Where("id = ?", nodeID).
+			Select("description", "contact", "latitude", "longitude", "metadata").
+			Updates(&types.NodeConfig{NodeMetadata: *metadata})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node metadata: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeCertificate 记录节点当前有效的客户端证书，serial 为空时吊销
+func (s *GormStore) UpdateNodeCertificate(nodeID int, serial string, expiresAt *time.Time) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{}).
+			Where("id = ?", nodeID).
+			Updates(map[string]interface{}{
+				"cert_serial":     serial,
+				"cert_expires_at": expiresAt,
+			})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node certificate: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// MarkNodeBootstrapped 标记节点已下发初始配置，只有首次标记成功时返回 true
+func (s *GormStore) MarkNodeBootstrapped(nodeID int, at time.Time) (bool, error) {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{}).
+			Where("id = ? AND bootstrapped_at IS NULL", nodeID).
+			Update("bootstrapped_at", at)
+	})
+	if result.Error != nil {
+		return false, fmt.Errorf("marking node bootstrapped: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateNodeBabelOptions 更新节点的 babeld 接口默认参数
+func (s *GormStore) UpdateNodeBabelOptions(nodeID int, opts types.BabelInterfaceOptions) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select("babel_options").
+			Updates(&types.NodeConfig{BabelOptions: opts})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node babel options: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeTags 更新节点的标签
+func (s *GormStore) UpdateNodeTags(nodeID int, tags []string) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select("tags").
+			Updates(&types.NodeConfig{Tags: tags})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node tags: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeName 更新节点名称
+func (s *GormStore) UpdateNodeName(nodeID int, name string) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select("name", "updated_at").
+			Updates(&types.NodeConfig{Name: name, UpdatedAt: time.Now()})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node name: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// PatchNode 在一次更新中写入 patch 中非空的字段
+func (s *GormStore) PatchNode(nodeID int, patch NodePatch) error {
+	update := types.NodeConfig{UpdatedAt: time.Now()}
+	columns := []any{"updated_at"}
+	if patch.Name != nil {
+		update.Name = *patch.Name
+		columns = append(columns, "name")
+	}
+	if patch.Endpoints != nil {
+		update.Endpoints = *patch.Endpoints
+		columns = append(columns, "endpoints")
+	}
+	if patch.IPv4 != nil {
+		update.IPv4 = *patch.IPv4
+		columns = append(columns, "ipv4")
+	}
+	if patch.IPv6 != nil {
+		update.IPv6 = *patch.IPv6
+		columns = append(columns, "ipv6")
+	}
+	if patch.Tags != nil {
+		update.Tags = *patch.Tags
+		columns = append(columns, "tags")
+	}
+	if patch.MTU != nil {
+		update.MTU = *patch.MTU
+		columns = append(columns, "mtu")
+	}
+
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select(columns[0], columns[1:]...).
+			Updates(&update)
+	})
+	if result.Error != nil {
+		return fmt.Errorf("patching node: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeAddressIndexes 在一个事务中更新多个节点的地址编号，键为节点 ID
+func (s *GormStore) UpdateNodeAddressIndexes(indexes map[int]int) error {
+	err := s.writeTx(func(tx *gorm.DB) error {
+		for nodeID, index := range indexes {
+			result := tx.Model(&types.NodeConfig{ID: nodeID}).
+				Select("address_index", "updated_at").
+				Updates(&types.NodeConfig{AddressIndex: index, UpdatedAt: time.Now()})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("node %d not found", nodeID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating node address indexes: %w", err)
+	}
+	return nil
+}
+
+// UpdateNodeCapabilities 更新 agent 上报的本地工具探测结果
+func (s *GormStore) UpdateNodeCapabilities(nodeID int, caps []types.Capability) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select("capabilities").
+			Updates(&types.NodeConfig{Capabilities: caps})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node capabilities: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeTrafficQuota 更新节点的月流量配额
+func (s *GormStore) UpdateNodeTrafficQuota(nodeID int, quota types.TrafficQuota) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select("traffic_quota").
+			Updates(&types.NodeConfig{TrafficQuota: quota})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node traffic quota: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeQuotaStatus 更新节点的配额告警状态
+func (s *GormStore) UpdateNodeQuotaStatus(nodeID int, status types.QuotaStatus) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{ID: nodeID}).
+			Select("quota_status").
+			Updates(&types.NodeConfig{QuotaStatus: status})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node quota status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
+// UpdateNodeAllowedPorts 更新节点的端口白名单，允许清空
+func (s *GormStore) UpdateNodeAllowedPorts(nodeID int, allowedPorts string) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.NodeConfig{}).
+			Where("id = ?", nodeID).
+			Update("allowed_ports", allowedPorts)
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating node allowed ports: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+	return nil
+}
+
 // DeleteNode 删除节点
 func (s *GormStore) DeleteNode(nodeID int) error {
-	result := s.db.Delete(&types.NodeConfig{}, nodeID)
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Delete(&types.NodeConfig{}, nodeID) })
 	if result.Error != nil {
 		return fmt.Errorf("deleting node: %w", result.Error)
 	}
@@ -222,6 +816,35 @@ func (s *GormStore) DeleteNode(nodeID int) error {
 	return nil
 }
 
+// PurgeNodeData 删除节点的任务、状态、流量统计和测速记录，返回删除的记录数；
+// 流量统计和测速记录中节点作为对端的记录也一并删除
+func (s *GormStore) PurgeNodeData(nodeID int) (int64, error) {
+	var deleted int64
+	err := s.writeTx(func(tx *gorm.DB) error {
+		for _, q := range []struct {
+			model any
+			where string
+			args  []any
+		}{
+			{&types.Task{}, "node_id = ?", []any{nodeID}},
+			{&types.NodeStatus{}, "node_id = ?", []any{nodeID}},
+			{&types.TrafficUsage{}, "node_id = ? OR peer_id = ?", []any{nodeID, nodeID}},
+			{&types.BandwidthTest{}, "node_id = ? OR peer_id = ?", []any{nodeID, nodeID}},
+		} {
+			result := tx.Where(q.where, q.args...).Delete(q.model)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("purging node data: %w", err)
+	}
+	return deleted, nil
+}
+
 // ListNodes 列出所有节点
 func (s *GormStore) ListNodes() ([]*types.NodeConfig, error) {
 	var nodes []*types.NodeConfig
@@ -232,16 +855,81 @@ func (s *GormStore) ListNodes() ([]*types.NodeConfig, error) {
 	return nodes, nil
 }
 
-// UpdateNodeStatus 更新节点状态
+// ListNodesByTenant 列出租户下的所有节点
+func (s *GormStore) ListNodesByTenant(tenantID int) ([]*types.NodeConfig, error) {
+	var nodes []*types.NodeConfig
+	result := s.db.Preload("Status").Where("tenant_id = ?", tenantID).Find(&nodes)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying nodes: %w", result.Error)
+	}
+	return nodes, nil
+}
+
+// ListNodeSummaries 列出租户下的节点摘要，只查询轻量字段并一次性关联节点状态
+func (s *GormStore) ListNodeSummaries(tenantID int) ([]*types.NodeSummary, error) {
+	var summaries []*types.NodeSummary
+	result := s.db.Model(&types.NodeConfig{}).
+		Select("node_configs.id, node_configs.tenant_id, node_configs.name, "+
+			"COALESCE(node_statuses.status, '') AS status, "+
+			"node_statuses.timestamp AS last_seen, "+
+			"COALESCE(node_statuses.version, '') AS version").
+		Joins("LEFT JOIN node_statuses ON node_statuses.node_id = node_configs.id").
+		Where("node_configs.tenant_id = ?", tenantID).
+		Order("node_configs.id").
+		Scan(&summaries)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying node summaries: %w", result.Error)
+	}
+	return summaries, nil
+}
+
+// UpdateNodeStatus 更新节点状态，已保存的状态更新时不覆盖
 func (s *GormStore) UpdateNodeStatus(nodeID int, status *types.NodeStatus) error {
 	status.NodeID = nodeID
-	result := s.db.Save(status)
+	return s.UpdateNodeStatuses([]*types.NodeStatus{status})
+}
+
+// UpdateNodeStatuses 批量更新节点状态，只覆盖时间不晚于新状态的记录，
+// 延迟写入的旧状态（如写入失败后重试的批次）不会覆盖已保存的新状态
+func (s *GormStore) UpdateNodeStatuses(statuses []*types.NodeStatus) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+	columns, err := s.nodeStatusColumns()
+	if err != nil {
+		return err
+	}
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "node_id"}},
+			DoUpdates: clause.AssignmentColumns(columns),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "node_statuses.timestamp <= excluded.timestamp"},
+			}},
+		}).Create(&statuses)
+	})
 	if result.Error != nil {
-		return fmt.Errorf("upserting node status: %w", result.Error)
+		return fmt.Errorf("upserting node statuses: %w", result.Error)
 	}
 	return nil
 }
 
+// nodeStatusColumns 返回节点状态除主键外的列，冲突时以新状态的值更新。
+// 不使用 UpdateAll，它会把 autoUpdateTime 的 timestamp 替换为写入时间，无法比较先后
+func (s *GormStore) nodeStatusColumns() ([]string, error) {
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(&types.NodeStatus{}); err != nil {
+		return nil, fmt.Errorf("parsing node status schema: %w", err)
+	}
+	columns := make([]string, 0, len(stmt.Schema.DBNames))
+	for _, name := range stmt.Schema.DBNames {
+		if name != "node_id" {
+			columns = append(columns, name)
+		}
+	}
+	return columns, nil
+}
+
 // GetNodeStatus 获取节点状态
 func (s *GormStore) GetNodeStatus(nodeID int) (*types.NodeStatus, error) {
 	var status types.NodeStatus
@@ -284,10 +972,10 @@ func (s *GormStore) GetOrCreateWireguardConnection(connection *types.WireguardCo
 		return nil, fmt.Errorf("wireguard connection not found with port %d", connection.Port)
 	}
 
-	// 情况2：如果提供了NodeID和PeerID，则根据它们查询连接
+	// 情况2：如果提供了NodeID和PeerID，则根据它们查询主链路
 	if connection.NodeID != 0 && connection.PeerID != 0 {
 		result := s.db.Where(
-			"(node_id = ? AND peer_id = ?) OR (node_id = ? AND peer_id = ?)",
+			"path = 0 AND ((node_id = ? AND peer_id = ?) OR (node_id = ? AND peer_id = ?))",
 			connection.NodeID, connection.PeerID,
 			connection.PeerID, connection.NodeID,
 		).First(&conn)
@@ -300,7 +988,7 @@ func (s *GormStore) GetOrCreateWireguardConnection(connection *types.WireguardCo
 
 		// 未找到连接，需要创建新的连接
 		var maxPort int
-		result = s.db.Model(&types.WireguardConnection{}).Select("COALESCE(MAX(port), 0)").Scan(&maxPort)
+		result = s.db.Model(&types.WireguardConnection{}).Select(maxPortColumn).Scan(&maxPort)
 		if result.Error != nil {
 			return nil, fmt.Errorf("getting max port: %w", result.Error)
 		}
@@ -313,11 +1001,12 @@ func (s *GormStore) GetOrCreateWireguardConnection(connection *types.WireguardCo
 
 		// 创建新的连接记录
 		conn = types.WireguardConnection{
-			NodeID: connection.NodeID,
-			PeerID: connection.PeerID,
-			Port:   newPort,
+			NodeID:   connection.NodeID,
+			PeerID:   connection.PeerID,
+			Port:     newPort,
+			PeerPort: newPort,
 		}
-		result = s.db.Create(&conn)
+		result = s.write(func(db *gorm.DB) *gorm.DB { return db.Create(&conn) })
 		if result.Error != nil {
 			return nil, fmt.Errorf("creating wireguard connection: %w", result.Error)
 		}
@@ -327,3 +1016,404 @@ func (s *GormStore) GetOrCreateWireguardConnection(connection *types.WireguardCo
 
 	return nil, fmt.Errorf("invalid connection parameters; must provide either port, or node_id and peer_id")
 }
+
+// maxPortColumn 查询两端监听端口中的最大值
+const maxPortColumn = "COALESCE(MAX(CASE WHEN peer_port > port THEN peer_port ELSE port END), 0)"
+
+// GetOrCreateWireguardConnections 批量获取或创建节点与多个对等节点之间的主链路，返回以对等节点ID为键的映射
+func (s *GormStore) GetOrCreateWireguardConnections(nodeID int, peerIDs []int, basePort int) (map[int]*types.WireguardConnection, error) {
+	conns := make(map[int]*types.WireguardConnection, len(peerIDs))
+
+	err := s.writeTx(func(tx *gorm.DB) error {
+		// 一次查询节点参与的所有主链路
+		var existing []*types.WireguardConnection
+		if err := tx.Where("path = 0 AND (node_id = ? OR peer_id = ?)", nodeID, nodeID).Find(&existing).Error; err != nil {
+			return fmt.Errorf("querying wireguard connections: %w", err)
+		}
+		for _, conn := range existing {
+			peerID := conn.PeerID
+			if peerID == nodeID {
+				peerID = conn.NodeID
+			}
+			conns[peerID] = conn
+		}
+
+		var missing []int
+		for _, peerID := range peerIDs {
+			if _, ok := conns[peerID]; !ok && peerID != nodeID {
+				missing = append(missing, peerID)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		var maxPort int
+		if err := tx.Model(&types.WireguardConnection{}).Select(maxPortColumn).Scan(&maxPort).Error; err != nil {
+			return fmt.Errorf("getting max port: %w", err)
+		}
+		nextPort := basePort
+		if maxPort >= basePort {
+			nextPort = maxPort + 1
+		}
+
+		created := make([]*types.WireguardConnection, 0, len(missing))
+		for _, peerID := range missing {
+			created = append(created, &types.WireguardConnection{
+				NodeID:   nodeID,
+				PeerID:   peerID,
+				Port:     nextPort,
+				PeerPort: nextPort,
+			})
+			nextPort++
+		}
+		if err := tx.Create(&created).Error; err != nil {
+			return fmt.Errorf("creating wireguard connections: %w", err)
+		}
+		for _, conn := range created {
+			conns[conn.PeerID] = conn
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conns, nil
+}
+
+// CreateWireguardConnections 使用调用方分配的端口创建连接，节点对上已存在相同路径的连接会被跳过，其 ID 保持为 0
+func (s *GormStore) CreateWireguardConnections(conns []*types.WireguardConnection) error {
+	return s.writeTx(func(tx *gorm.DB) error {
+		for _, conn := range conns {
+			var count int64
+			if err := tx.Model(&types.WireguardConnection{}).Where(
+				"path = ? AND ((node_id = ? AND peer_id = ?) OR (node_id = ? AND peer_id = ?))",
+				conn.Path,
+				conn.NodeID, conn.PeerID,
+				conn.PeerID, conn.NodeID,
+			).Count(&count).Error; err != nil {
+				return fmt.Errorf("querying wireguard connection: %w", err)
+			}
+			if count > 0 {
+				continue
+			}
+			if conn.PeerPort == 0 {
+				conn.PeerPort = conn.Port
+			}
+			if err := tx.Create(conn).Error; err != nil {
+				return fmt.Errorf("creating wireguard connection: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListWireguardConnections 列出Wireguard连接，nodeID 为 0 时列出全部
+func (s *GormStore) ListWireguardConnections(nodeID int) ([]*types.WireguardConnection, error) {
+	var conns []*types.WireguardConnection
+	query := s.db.Order("id")
+	if nodeID != 0 {
+		query = query.Where("node_id = ? OR peer_id = ?", nodeID, nodeID)
+	}
+	if err := query.Find(&conns).Error; err != nil {
+		return nil, fmt.Errorf("querying wireguard connections: %w", err)
+	}
+	return conns, nil
+}
+
+// GetWireguardConnection 获取Wireguard连接
+func (s *GormStore) GetWireguardConnection(id int) (*types.WireguardConnection, error) {
+	var conn types.WireguardConnection
+	if err := s.db.First(&conn, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("querying wireguard connection: %w", err)
+	}
+	return &conn, nil
+}
+
+// DeleteWireguardConnection 删除Wireguard连接，释放其端口
+func (s *GormStore) DeleteWireguardConnection(id int) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Delete(&types.WireguardConnection{}, id) })
+	if result.Error != nil {
+		return fmt.Errorf("deleting wireguard connection: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("wireguard connection %d not found", id)
+	}
+	return nil
+}
+
+// UpdateWireguardConnection 更新Wireguard连接
+func (s *GormStore) UpdateWireguardConnection(connection *types.WireguardConnection) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.WireguardConnection{}).
+			Where("id = ?", connection.ID).
+			Select("port", "peer_port", "disabled", "babel_options", "path_endpoints", "endpoint_ports").
+			Updates(connection)
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating wireguard connection: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("wireguard connection %d not found", connection.ID)
+	}
+	return nil
+}
+
+// UpdateConnectionLinkLocal 保存连接两端的链路本地地址
+func (s *GormStore) UpdateConnectionLinkLocal(id int, nodeAddr, peerAddr string) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Model(&types.WireguardConnection{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{"node_link_local": nodeAddr, "peer_link_local": peerAddr})
+	})
+	if result.Error != nil {
+		return fmt.Errorf("updating link-local addresses: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("wireguard connection %d not found", id)
+	}
+	return nil
+}
+
+// UpdateConnectionActiveEndpoint 记录节点在连接上当前使用的对端端点，endpoint 为空时清除记录
+func (s *GormStore) UpdateConnectionActiveEndpoint(id, nodeID int, endpoint string) error {
+	return s.writeTx(func(tx *gorm.DB) error {
+		var conn types.WireguardConnection
+		if err := tx.First(&conn, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrNotFound
+			}
+			return fmt.Errorf("querying wireguard connection: %w", err)
+		}
+		if conn.ActiveEndpoints == nil {
+			conn.ActiveEndpoints = make(map[int]string)
+		}
+		if endpoint == "" {
+			delete(conn.ActiveEndpoints, nodeID)
+		} else {
+			conn.ActiveEndpoints[nodeID] = endpoint
+		}
+		if err := tx.Model(&conn).Select("active_endpoints").Updates(&conn).Error; err != nil {
+			return fmt.Errorf("updating active endpoint: %w", err)
+		}
+		return nil
+	})
+}
+
+// CreateBandwidthTest 创建吞吐量测试记录
+func (s *GormStore) CreateBandwidthTest(test *types.BandwidthTest) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Create(test) })
+	if result.Error != nil {
+		return fmt.Errorf("inserting bandwidth test: %w", result.Error)
+	}
+	return nil
+}
+
+// UpdateBandwidthTest 更新吞吐量测试记录
+func (s *GormStore) UpdateBandwidthTest(test *types.BandwidthTest) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Save(test) })
+	if result.Error != nil {
+		return fmt.Errorf("updating bandwidth test: %w", result.Error)
+	}
+	return nil
+}
+
+// GetBandwidthTest 获取吞吐量测试记录
+func (s *GormStore) GetBandwidthTest(id int) (*types.BandwidthTest, error) {
+	var test types.BandwidthTest
+	result := s.db.First(&test, id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("querying bandwidth test: %w", result.Error)
+	}
+	return &test, nil
+}
+
+// ListBandwidthTests 列出租户的吞吐量测试记录，按创建时间倒序
+func (s *GormStore) ListBandwidthTests(tenantID int) ([]*types.BandwidthTest, error) {
+	var tests []*types.BandwidthTest
+	result := s.db.Where("tenant_id = ?", tenantID).Order("created_at DESC").Find(&tests)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying bandwidth tests: %w", result.Error)
+	}
+	return tests, nil
+}
+
+// CreateChangeset 创建变更集
+func (s *GormStore) CreateChangeset(changeset *types.Changeset) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Create(changeset) })
+	if result.Error != nil {
+		return fmt.Errorf("inserting changeset: %w", result.Error)
+	}
+	return nil
+}
+
+// UpdateChangeset 更新变更集
+func (s *GormStore) UpdateChangeset(changeset *types.Changeset) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Save(changeset) })
+	if result.Error != nil {
+		return fmt.Errorf("updating changeset: %w", result.Error)
+	}
+	return nil
+}
+
+// GetChangeset 获取变更集
+func (s *GormStore) GetChangeset(id int) (*types.Changeset, error) {
+	var changeset types.Changeset
+	result := s.db.First(&changeset, id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("querying changeset: %w", result.Error)
+	}
+	return &changeset, nil
+}
+
+// GetPendingChangeset 获取租户待审批的变更集，没有时返回 ErrNotFound
+func (s *GormStore) GetPendingChangeset(tenantID int) (*types.Changeset, error) {
+	var changeset types.Changeset
+	result := s.db.Where("tenant_id = ? AND status = ?", tenantID, types.ChangesetPending).Order("id").First(&changeset)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("querying pending changeset: %w", result.Error)
+	}
+	return &changeset, nil
+}
+
+// ListChangesets 列出租户的变更集，status 为空时列出全部，按创建时间倒序
+func (s *GormStore) ListChangesets(tenantID int, status string) ([]*types.Changeset, error) {
+	var changesets []*types.Changeset
+	query := s.db.Where("tenant_id = ?", tenantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	result := query.Order("created_at DESC").Find(&changesets)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying changesets: %w", result.Error)
+	}
+	return changesets, nil
+}
+
+// CreateClientPeer 创建客户端对等节点
+func (s *GormStore) CreateClientPeer(peer *types.ClientPeer) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Create(peer) })
+	if result.Error != nil {
+		return fmt.Errorf("inserting client peer: %w", result.Error)
+	}
+	return nil
+}
+
+// UpdateClientPeer 更新客户端对等节点
+func (s *GormStore) UpdateClientPeer(peer *types.ClientPeer) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Save(peer) })
+	if result.Error != nil {
+		return fmt.Errorf("updating client peer: %w", result.Error)
+	}
+	return nil
+}
+
+// GetClientPeer 获取客户端对等节点
+func (s *GormStore) GetClientPeer(id int) (*types.ClientPeer, error) {
+	var peer types.ClientPeer
+	result := s.db.First(&peer, id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("querying client peer: %w", result.Error)
+	}
+	return &peer, nil
+}
+
+// ListClientPeers 列出租户的客户端对等节点，按 ID 排序
+func (s *GormStore) ListClientPeers(tenantID int) ([]*types.ClientPeer, error) {
+	var peers []*types.ClientPeer
+	result := s.db.Where("tenant_id = ?", tenantID).Order("id").Find(&peers)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying client peers: %w", result.Error)
+	}
+	return peers, nil
+}
+
+// ListExpiredClientPeers 列出所有租户中已过期的客户端对等节点
+func (s *GormStore) ListExpiredClientPeers(now time.Time) ([]*types.ClientPeer, error) {
+	var peers []*types.ClientPeer
+	result := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Order("id").Find(&peers)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying expired client peers: %w", result.Error)
+	}
+	return peers, nil
+}
+
+// DeleteClientPeer 删除客户端对等节点
+func (s *GormStore) DeleteClientPeer(id int) error {
+	result := s.write(func(db *gorm.DB) *gorm.DB { return db.Delete(&types.ClientPeer{}, id) })
+	if result.Error != nil {
+		return fmt.Errorf("deleting client peer: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddTrafficUsage 累加流量统计，同一节点、对端和日期的记录合并
+func (s *GormStore) AddTrafficUsage(usage []*types.TrafficUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "node_id"}, {Name: "peer_id"}, {Name: "date"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"rx_bytes":   gorm.Expr("traffic_usages.rx_bytes + excluded.rx_bytes"),
+				"tx_bytes":   gorm.Expr("traffic_usages.tx_bytes + excluded.tx_bytes"),
+				"updated_at": gorm.Expr("excluded.updated_at"),
+			}),
+		}).Create(&usage)
+	})
+	if result.Error != nil {
+		return fmt.Errorf("adding traffic usage: %w", result.Error)
+	}
+	return nil
+}
+
+// ListTrafficUsage 查询流量统计，按日期、节点和对端排序
+func (s *GormStore) ListTrafficUsage(filter UsageFilter) ([]*types.TrafficUsage, error) {
+	var usage []*types.TrafficUsage
+	query := s.db.Where("tenant_id = ?", filter.TenantID)
+	if filter.NodeID != 0 {
+		query = query.Where("node_id = ?", filter.NodeID)
+	}
+	if filter.From != "" {
+		query = query.Where("date >= ?", filter.From)
+	}
+	if filter.To != "" {
+		query = query.Where("date <= ?", filter.To)
+	}
+	result := query.Order("date, node_id, peer_id").Find(&usage)
+	if result.Error != nil {
+		return nil, fmt.Errorf("querying traffic usage: %w", result.Error)
+	}
+	return usage, nil
+}
+
+// CleanupTrafficUsage 删除指定日期之前的流量统计
+func (s *GormStore) CleanupTrafficUsage(before string) (int64, error) {
+	result := s.write(func(db *gorm.DB) *gorm.DB {
+		return db.Where("date < ?", before).Delete(&types.TrafficUsage{})
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("cleaning up traffic usage: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,667 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"mesh-backend/pkg/metrics"
+	"mesh-backend/pkg/types"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	storeOps = metrics.NewCounterVec("mesh_store_operations_total",
+		"Store operations by operation and result", "op", "result")
+	storeLatency = metrics.NewHistogramVec("mesh_store_operation_duration_seconds",
+		"Store operation latency", metrics.DefaultBuckets, "op")
+	storeSlowOps = metrics.NewCounterVec("mesh_store_slow_operations_total",
+		"Store operations slower than the configured threshold", "op")
+)
+
+// InstrumentedStore 为存储操作记录指标并输出慢查询日志
+//
+// 不嵌入底层存储，Store 新增方法时编译器要求在这里同时添加包装，避免新方法绕过指标。
+type InstrumentedStore struct {
+	next Store
+
+	logger        zerolog.Logger
+	slowThreshold time.Duration
+}
+
+// NewInstrumentedStore 包装存储实例，slowThreshold 为 0 时不记录慢查询
+func NewInstrumentedStore(store Store, logger zerolog.Logger, slowThreshold time.Duration) *InstrumentedStore {
+	return &InstrumentedStore{
+		next:          store,
+		logger:        logger.With().Str("component", "store").Logger(),
+		slowThreshold: slowThreshold,
+	}
+}
+
+// WithContext 返回绑定到 ctx 的存储，保留指标记录
+func (s *InstrumentedStore) WithContext(ctx context.Context) Store {
+	return &InstrumentedStore{
+		next:          s.next.WithContext(ctx),
+		logger:        s.logger,
+		slowThreshold: s.slowThreshold,
+	}
+}
+
+// observe 记录一次存储操作
+func (s *InstrumentedStore) observe(op string, start time.Time, err error) {
+	elapsed := time.Since(start)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	storeOps.WithLabelValues(op, result).Inc()
+	storeLatency.WithLabelValues(op).Observe(elapsed.Seconds())
+
+	if s.slowThreshold > 0 && elapsed >= s.slowThreshold {
+		storeSlowOps.WithLabelValues(op).Inc()
+		s.logger.Warn().
+			Str("op", op).
+			Dur("elapsed", elapsed).
+			Dur("threshold", s.slowThreshold).
+			Err(err).
+			Msg("Slow store operation")
+	}
+}
+
+// CreateNode 包装 Store.CreateNode
+func (s *InstrumentedStore) CreateNode(node *types.NodeConfig) error {
+	start := time.Now()
+	err := s.next.CreateNode(node)
+	s.observe("create_node", start, err)
+	return err
+}
+
+// GetNode 包装 Store.GetNode
+func (s *InstrumentedStore) GetNode(nodeID int) (*types.NodeConfig, error) {
+	start := time.Now()
+	result, err := s.next.GetNode(nodeID)
+	s.observe("get_node", start, err)
+	return result, err
+}
+
+// UpdateNode 包装 Store.UpdateNode
+func (s *InstrumentedStore) UpdateNode(nodeID int, node *types.NodeConfig) error {
+	start := time.Now()
+	err := s.next.UpdateNode(nodeID, node)
+	s.observe("update_node", start, err)
+	return err
+}
+
+// UpdateNodeMetadata 包装 Store.UpdateNodeMetadata
+func (s *InstrumentedStore) UpdateNodeMetadata(nodeID int, metadata *types.NodeMetadata) error {
+	start := time.Now()
+	err := s.next.UpdateNodeMetadata(nodeID, metadata)
+	s.observe("update_node_metadata", start, err)
+	return err
+}
+
+// UpdateNodeAllowedPorts 包装 Store.UpdateNodeAllowedPorts
+func (s *InstrumentedStore) UpdateNodeAllowedPorts(nodeID int, allowedPorts string) error {
+	start := time.Now()
+	err := s.next.UpdateNodeAllowedPorts(nodeID, allowedPorts)
+	s.observe("update_node_allowed_ports", start, err)
+	return err
+}
+
+// UpdateNodeBabelOptions 包装 Store.UpdateNodeBabelOptions
+func (s *InstrumentedStore) UpdateNodeBabelOptions(nodeID int, opts types.BabelInterfaceOptions) error {
+	start := time.Now()
+	err := s.next.UpdateNodeBabelOptions(nodeID, opts)
+	s.observe("update_node_babel_options", start, err)
+	return err
+}
+
+// UpdateNodeTrafficQuota 包装 Store.UpdateNodeTrafficQuota
+func (s *InstrumentedStore) UpdateNodeTrafficQuota(nodeID int, quota types.TrafficQuota) error {
+	start := time.Now()
+	err := s.next.UpdateNodeTrafficQuota(nodeID, quota)
+	s.observe("update_node_traffic_quota", start, err)
+	return err
+}
+
+// UpdateNodeQuotaStatus 包装 Store.UpdateNodeQuotaStatus
+func (s *InstrumentedStore) UpdateNodeQuotaStatus(nodeID int, status types.QuotaStatus) error {
+	start := time.Now()
+	err := s.next.UpdateNodeQuotaStatus(nodeID, status)
+	s.observe("update_node_quota_status", start, err)
+	return err
+}
+
+// UpdateNodeTags 包装 Store.UpdateNodeTags
+func (s *InstrumentedStore) UpdateNodeTags(nodeID int, tags []string) error {
+	start := time.Now()
+	err := s.next.UpdateNodeTags(nodeID, tags)
+	s.observe("update_node_tags", start, err)
+	return err
+}
+
+// UpdateNodeName 包装 Store.UpdateNodeName
+func (s *InstrumentedStore) UpdateNodeName(nodeID int, name string) error {
+	start := time.Now()
+	err := s.next.UpdateNodeName(nodeID, name)
+	s.observe("update_node_name", start, err)
+	return err
+}
+
+// PatchNode 包装 Store.PatchNode
+func (s *InstrumentedStore) PatchNode(nodeID int, patch NodePatch) error {
+	start := time.Now()
+	err := s.next.PatchNode(nodeID, patch)
+	s.observe("patch_node", start, err)
+	return err
+}
+
+// UpdateNodeAddressIndexes 包装 Store.UpdateNodeAddressIndexes
+func (s *InstrumentedStore) UpdateNodeAddressIndexes(indexes map[int]int) error {
+	start := time.Now()
+	err := s.next.UpdateNodeAddressIndexes(indexes)
+	s.observe("update_node_address_indexes", start, err)
+	return err
+}
+
+// UpdateNodeCapabilities 包装 Store.UpdateNodeCapabilities
+func (s *InstrumentedStore) UpdateNodeCapabilities(nodeID int, caps []types.Capability) error {
+	start := time.Now()
+	err := s.next.UpdateNodeCapabilities(nodeID, caps)
+	s.observe("update_node_capabilities", start, err)
+	return err
+}
+
+// UpdateNodeCertificate 包装 Store.UpdateNodeCertificate
+func (s *InstrumentedStore) UpdateNodeCertificate(nodeID int, serial string, expiresAt *time.Time) error {
+	start := time.Now()
+	err := s.next.UpdateNodeCertificate(nodeID, serial, expiresAt)
+	s.observe("update_node_certificate", start, err)
+	return err
+}
+
+// MarkNodeBootstrapped 包装 Store.MarkNodeBootstrapped
+func (s *InstrumentedStore) MarkNodeBootstrapped(nodeID int, at time.Time) (bool, error) {
+	start := time.Now()
+	result, err := s.next.MarkNodeBootstrapped(nodeID, at)
+	s.observe("mark_node_bootstrapped", start, err)
+	return result, err
+}
+
+// DeleteNode 包装 Store.DeleteNode
+func (s *InstrumentedStore) DeleteNode(nodeID int) error {
+	start := time.Now()
+	err := s.next.DeleteNode(nodeID)
+	s.observe("delete_node", start, err)
+	return err
+}
+
+// PurgeNodeData 包装 Store.PurgeNodeData
+func (s *InstrumentedStore) PurgeNodeData(nodeID int) (int64, error) {
+	start := time.Now()
+	deleted, err := s.next.PurgeNodeData(nodeID)
+	s.observe("purge_node_data", start, err)
+	return deleted, err
+}
+
+// ListNodes 包装 Store.ListNodes
+func (s *InstrumentedStore) ListNodes() ([]*types.NodeConfig, error) {
+	start := time.Now()
+	result, err := s.next.ListNodes()
+	s.observe("list_nodes", start, err)
+	return result, err
+}
+
+// ListNodesByTenant 包装 Store.ListNodesByTenant
+func (s *InstrumentedStore) ListNodesByTenant(tenantID int) ([]*types.NodeConfig, error) {
+	start := time.Now()
+	result, err := s.next.ListNodesByTenant(tenantID)
+	s.observe("list_nodes_by_tenant", start, err)
+	return result, err
+}
+
+// ListNodeSummaries 包装 Store.ListNodeSummaries
+func (s *InstrumentedStore) ListNodeSummaries(tenantID int) ([]*types.NodeSummary, error) {
+	start := time.Now()
+	result, err := s.next.ListNodeSummaries(tenantID)
+	s.observe("list_node_summaries", start, err)
+	return result, err
+}
+
+// GetOrCreateWireguardConnection 包装 Store.GetOrCreateWireguardConnection
+func (s *InstrumentedStore) GetOrCreateWireguardConnection(connection *types.WireguardConnection, basePort int) (*types.WireguardConnection, error) {
+	start := time.Now()
+	result, err := s.next.GetOrCreateWireguardConnection(connection, basePort)
+	s.observe("get_or_create_wireguard_connection", start, err)
+	return result, err
+}
+
+// GetOrCreateWireguardConnections 包装 Store.GetOrCreateWireguardConnections
+func (s *InstrumentedStore) GetOrCreateWireguardConnections(nodeID int, peerIDs []int, basePort int) (map[int]*types.WireguardConnection, error) {
+	start := time.Now()
+	result, err := s.next.GetOrCreateWireguardConnections(nodeID, peerIDs, basePort)
+	s.observe("get_or_create_wireguard_connections", start, err)
+	return result, err
+}
+
+// CreateWireguardConnections 包装 Store.CreateWireguardConnections
+func (s *InstrumentedStore) CreateWireguardConnections(conns []*types.WireguardConnection) error {
+	start := time.Now()
+	err := s.next.CreateWireguardConnections(conns)
+	s.observe("create_wireguard_connections", start, err)
+	return err
+}
+
+// ListWireguardConnections 包装 Store.ListWireguardConnections
+func (s *InstrumentedStore) ListWireguardConnections(nodeID int) ([]*types.WireguardConnection, error) {
+	start := time.Now()
+	result, err := s.next.ListWireguardConnections(nodeID)
+	s.observe("list_wireguard_connections", start, err)
+	return result, err
+}
+
+// GetWireguardConnection 包装 Store.GetWireguardConnection
+func (s *InstrumentedStore) GetWireguardConnection(id int) (*types.WireguardConnection, error) {
+	start := time.Now()
+	result, err := s.next.GetWireguardConnection(id)
+	s.observe("get_wireguard_connection", start, err)
+	return result, err
+}
+
+// UpdateWireguardConnection 包装 Store.UpdateWireguardConnection
+func (s *InstrumentedStore) UpdateWireguardConnection(connection *types.WireguardConnection) error {
+	start := time.Now()
+	err := s.next.UpdateWireguardConnection(connection)
+	s.observe("update_wireguard_connection", start, err)
+	return err
+}
+
+// UpdateConnectionActiveEndpoint 包装 Store.UpdateConnectionActiveEndpoint
+func (s *InstrumentedStore) UpdateConnectionActiveEndpoint(id, nodeID int, endpoint string) error {
+	start := time.Now()
+	err := s.next.UpdateConnectionActiveEndpoint(id, nodeID, endpoint)
+	s.observe("update_connection_active_endpoint", start, err)
+	return err
+}
+
+// UpdateConnectionLinkLocal 包装 Store.UpdateConnectionLinkLocal
+func (s *InstrumentedStore) UpdateConnectionLinkLocal(id int, nodeAddr, peerAddr string) error {
+	start := time.Now()
+	err := s.next.UpdateConnectionLinkLocal(id, nodeAddr, peerAddr)
+	s.observe("update_connection_link_local", start, err)
+	return err
+}
+
+// DeleteWireguardConnection 包装 Store.DeleteWireguardConnection
+func (s *InstrumentedStore) DeleteWireguardConnection(id int) error {
+	start := time.Now()
+	err := s.next.DeleteWireguardConnection(id)
+	s.observe("delete_wireguard_connection", start, err)
+	return err
+}
+
+// UpdateNodeStatus 包装 Store.UpdateNodeStatus
+func (s *InstrumentedStore) UpdateNodeStatus(nodeID int, status *types.NodeStatus) error {
+	start := time.Now()
+	err := s.next.UpdateNodeStatus(nodeID, status)
+	s.observe("update_node_status", start, err)
+	return err
+}
+
+// UpdateNodeStatuses 包装 Store.UpdateNodeStatuses
+func (s *InstrumentedStore) UpdateNodeStatuses(statuses []*types.NodeStatus) error {
+	start := time.Now()
+	err := s.next.UpdateNodeStatuses(statuses)
+	s.observe("update_node_statuses", start, err)
+	return err
+}
+
+// GetNodeStatus 包装 Store.GetNodeStatus
+func (s *InstrumentedStore) GetNodeStatus(nodeID int) (*types.NodeStatus, error) {
+	start := time.Now()
+	result, err := s.next.GetNodeStatus(nodeID)
+	s.observe("get_node_status", start, err)
+	return result, err
+}
+
+// ListNodeStatus 包装 Store.ListNodeStatus
+func (s *InstrumentedStore) ListNodeStatus() ([]*types.NodeStatus, error) {
+	start := time.Now()
+	result, err := s.next.ListNodeStatus()
+	s.observe("list_node_status", start, err)
+	return result, err
+}
+
+// CleanupNodeStatuses 包装 Store.CleanupNodeStatuses
+func (s *InstrumentedStore) CleanupNodeStatuses(before time.Time) (int64, error) {
+	start := time.Now()
+	deleted, err := s.next.CleanupNodeStatuses(before)
+	s.observe("cleanup_node_statuses", start, err)
+	return deleted, err
+}
+
+// CreateTask 包装 Store.CreateTask
+func (s *InstrumentedStore) CreateTask(task *types.Task) error {
+	start := time.Now()
+	err := s.next.CreateTask(task)
+	s.observe("create_task", start, err)
+	return err
+}
+
+// UpdateTask 包装 Store.UpdateTask
+func (s *InstrumentedStore) UpdateTask(task *types.Task) error {
+	start := time.Now()
+	err := s.next.UpdateTask(task)
+	s.observe("update_task", start, err)
+	return err
+}
+
+// GetTask 包装 Store.GetTask
+func (s *InstrumentedStore) GetTask(id string) (*types.Task, error) {
+	start := time.Now()
+	result, err := s.next.GetTask(id)
+	s.observe("get_task", start, err)
+	return result, err
+}
+
+// ListTasks 包装 Store.ListTasks
+func (s *InstrumentedStore) ListTasks(filter TaskFilter) ([]*types.Task, error) {
+	start := time.Now()
+	result, err := s.next.ListTasks(filter)
+	s.observe("list_tasks", start, err)
+	return result, err
+}
+
+// DeleteTask 包装 Store.DeleteTask
+func (s *InstrumentedStore) DeleteTask(id string) error {
+	start := time.Now()
+	err := s.next.DeleteTask(id)
+	s.observe("delete_task", start, err)
+	return err
+}
+
+// CleanupTasks 包装 Store.CleanupTasks
+func (s *InstrumentedStore) CleanupTasks(status types.TaskStatus, before time.Time) (int64, error) {
+	start := time.Now()
+	deleted, err := s.next.CleanupTasks(status, before)
+	s.observe("cleanup_tasks", start, err)
+	return deleted, err
+}
+
+// CreateUser 包装 Store.CreateUser
+func (s *InstrumentedStore) CreateUser(user *types.User) error {
+	start := time.Now()
+	err := s.next.CreateUser(user)
+	s.observe("create_user", start, err)
+	return err
+}
+
+// GetUser 包装 Store.GetUser
+func (s *InstrumentedStore) GetUser(id int) (*types.User, error) {
+	start := time.Now()
+	result, err := s.next.GetUser(id)
+	s.observe("get_user", start, err)
+	return result, err
+}
+
+// GetUserByUsername 包装 Store.GetUserByUsername
+func (s *InstrumentedStore) GetUserByUsername(username string) (*types.User, error) {
+	start := time.Now()
+	result, err := s.next.GetUserByUsername(username)
+	s.observe("get_user_by_username", start, err)
+	return result, err
+}
+
+// CheckUserExists 包装 Store.CheckUserExists
+func (s *InstrumentedStore) CheckUserExists(username string) (bool, error) {
+	start := time.Now()
+	result, err := s.next.CheckUserExists(username)
+	s.observe("check_user_exists", start, err)
+	return result, err
+}
+
+// CreateUserWithFirstRole 包装 Store.CreateUserWithFirstRole
+func (s *InstrumentedStore) CreateUserWithFirstRole(user *types.User, firstRole string) error {
+	start := time.Now()
+	err := s.next.CreateUserWithFirstRole(user, firstRole)
+	s.observe("create_user_with_first_role", start, err)
+	return err
+}
+
+// UpdateUser 包装 Store.UpdateUser
+func (s *InstrumentedStore) UpdateUser(user *types.User) error {
+	start := time.Now()
+	err := s.next.UpdateUser(user)
+	s.observe("update_user", start, err)
+	return err
+}
+
+// DeleteUser 包装 Store.DeleteUser
+func (s *InstrumentedStore) DeleteUser(id int) error {
+	start := time.Now()
+	err := s.next.DeleteUser(id)
+	s.observe("delete_user", start, err)
+	return err
+}
+
+// CreateTenant 包装 Store.CreateTenant
+func (s *InstrumentedStore) CreateTenant(tenant *types.Tenant) error {
+	start := time.Now()
+	err := s.next.CreateTenant(tenant)
+	s.observe("create_tenant", start, err)
+	return err
+}
+
+// GetTenant 包装 Store.GetTenant
+func (s *InstrumentedStore) GetTenant(id int) (*types.Tenant, error) {
+	start := time.Now()
+	result, err := s.next.GetTenant(id)
+	s.observe("get_tenant", start, err)
+	return result, err
+}
+
+// GetTenantByName 包装 Store.GetTenantByName
+func (s *InstrumentedStore) GetTenantByName(name string) (*types.Tenant, error) {
+	start := time.Now()
+	result, err := s.next.GetTenantByName(name)
+	s.observe("get_tenant_by_name", start, err)
+	return result, err
+}
+
+// UpdateTenantBabelPolicy 包装 Store.UpdateTenantBabelPolicy
+func (s *InstrumentedStore) UpdateTenantBabelPolicy(tenantID int, policy *types.BabelPolicy) error {
+	start := time.Now()
+	err := s.next.UpdateTenantBabelPolicy(tenantID, policy)
+	s.observe("update_tenant_babel_policy", start, err)
+	return err
+}
+
+// UpdateTenantMaintenancePolicy 包装 Store.UpdateTenantMaintenancePolicy
+func (s *InstrumentedStore) UpdateTenantMaintenancePolicy(tenantID int, policy *types.MaintenancePolicy) error {
+	start := time.Now()
+	err := s.next.UpdateTenantMaintenancePolicy(tenantID, policy)
+	s.observe("update_tenant_maintenance_policy", start, err)
+	return err
+}
+
+// UpdateTenantACLPolicy 包装 Store.UpdateTenantACLPolicy
+func (s *InstrumentedStore) UpdateTenantACLPolicy(tenantID int, policy *types.ACLPolicy) error {
+	start := time.Now()
+	err := s.next.UpdateTenantACLPolicy(tenantID, policy)
+	s.observe("update_tenant_acl_policy", start, err)
+	return err
+}
+
+// UpdateTenantBGPConfig 包装 Store.UpdateTenantBGPConfig
+func (s *InstrumentedStore) UpdateTenantBGPConfig(tenantID int, bgp *types.BGPConfig) error {
+	start := time.Now()
+	err := s.next.UpdateTenantBGPConfig(tenantID, bgp)
+	s.observe("update_tenant_bgp_config", start, err)
+	return err
+}
+
+// UpdateTenantRoutingDaemon 包装 Store.UpdateTenantRoutingDaemon
+func (s *InstrumentedStore) UpdateTenantRoutingDaemon(tenantID int, daemon string) error {
+	start := time.Now()
+	err := s.next.UpdateTenantRoutingDaemon(tenantID, daemon)
+	s.observe("update_tenant_routing_daemon", start, err)
+	return err
+}
+
+// UpdateTenantNetworkSettings 包装 Store.UpdateTenantNetworkSettings
+func (s *InstrumentedStore) UpdateTenantNetworkSettings(tenantID int, settings *types.NetworkSettings) error {
+	start := time.Now()
+	err := s.next.UpdateTenantNetworkSettings(tenantID, settings)
+	s.observe("update_tenant_network_settings", start, err)
+	return err
+}
+
+// CreateBandwidthTest 包装 Store.CreateBandwidthTest
+func (s *InstrumentedStore) CreateBandwidthTest(test *types.BandwidthTest) error {
+	start := time.Now()
+	err := s.next.CreateBandwidthTest(test)
+	s.observe("create_bandwidth_test", start, err)
+	return err
+}
+
+// UpdateBandwidthTest 包装 Store.UpdateBandwidthTest
+func (s *InstrumentedStore) UpdateBandwidthTest(test *types.BandwidthTest) error {
+	start := time.Now()
+	err := s.next.UpdateBandwidthTest(test)
+	s.observe("update_bandwidth_test", start, err)
+	return err
+}
+
+// GetBandwidthTest 包装 Store.GetBandwidthTest
+func (s *InstrumentedStore) GetBandwidthTest(id int) (*types.BandwidthTest, error) {
+	start := time.Now()
+	result, err := s.next.GetBandwidthTest(id)
+	s.observe("get_bandwidth_test", start, err)
+	return result, err
+}
+
+// ListBandwidthTests 包装 Store.ListBandwidthTests
+func (s *InstrumentedStore) ListBandwidthTests(tenantID int) ([]*types.BandwidthTest, error) {
+	start := time.Now()
+	result, err := s.next.ListBandwidthTests(tenantID)
+	s.observe("list_bandwidth_tests", start, err)
+	return result, err
+}
+
+// CreateChangeset 包装 Store.CreateChangeset
+func (s *InstrumentedStore) CreateChangeset(changeset *types.Changeset) error {
+	start := time.Now()
+	err := s.next.CreateChangeset(changeset)
+	s.observe("create_changeset", start, err)
+	return err
+}
+
+// UpdateChangeset 包装 Store.UpdateChangeset
+func (s *InstrumentedStore) UpdateChangeset(changeset *types.Changeset) error {
+	start := time.Now()
+	err := s.next.UpdateChangeset(changeset)
+	s.observe("update_changeset", start, err)
+	return err
+}
+
+// GetChangeset 包装 Store.GetChangeset
+func (s *InstrumentedStore) GetChangeset(id int) (*types.Changeset, error) {
+	start := time.Now()
+	result, err := s.next.GetChangeset(id)
+	s.observe("get_changeset", start, err)
+	return result, err
+}
+
+// GetPendingChangeset 包装 Store.GetPendingChangeset
+func (s *InstrumentedStore) GetPendingChangeset(tenantID int) (*types.Changeset, error) {
+	start := time.Now()
+	result, err := s.next.GetPendingChangeset(tenantID)
+	s.observe("get_pending_changeset", start, err)
+	return result, err
+}
+
+// ListChangesets 包装 Store.ListChangesets
+func (s *InstrumentedStore) ListChangesets(tenantID int, status string) ([]*types.Changeset, error) {
+	start := time.Now()
+	result, err := s.next.ListChangesets(tenantID, status)
+	s.observe("list_changesets", start, err)
+	return result, err
+}
+
+// CreateClientPeer 包装 Store.CreateClientPeer
+func (s *InstrumentedStore) CreateClientPeer(peer *types.ClientPeer) error {
+	start := time.Now()
+	err := s.next.CreateClientPeer(peer)
+	s.observe("create_client_peer", start, err)
+	return err
+}
+
+// UpdateClientPeer 包装 Store.UpdateClientPeer
+func (s *InstrumentedStore) UpdateClientPeer(peer *types.ClientPeer) error {
+	start := time.Now()
+	err := s.next.UpdateClientPeer(peer)
+	s.observe("update_client_peer", start, err)
+	return err
+}
+
+// GetClientPeer 包装 Store.GetClientPeer
+func (s *InstrumentedStore) GetClientPeer(id int) (*types.ClientPeer, error) {
+	start := time.Now()
+	result, err := s.next.GetClientPeer(id)
+	s.observe("get_client_peer", start, err)
+	return result, err
+}
+
+// ListClientPeers 包装 Store.ListClientPeers
+func (s *InstrumentedStore) ListClientPeers(tenantID int) ([]*types.ClientPeer, error) {
+	start := time.Now()
+	result, err := s.next.ListClientPeers(tenantID)
+	s.observe("list_client_peers", start, err)
+	return result, err
+}
+
+// ListExpiredClientPeers 包装 Store.ListExpiredClientPeers
+func (s *InstrumentedStore) ListExpiredClientPeers(now time.Time) ([]*types.ClientPeer, error) {
+	start := time.Now()
+	result, err := s.next.ListExpiredClientPeers(now)
+	s.observe("list_expired_client_peers", start, err)
+	return result, err
+}
+
+// DeleteClientPeer 包装 Store.DeleteClientPeer
+func (s *InstrumentedStore) DeleteClientPeer(id int) error {
+	start := time.Now()
+	err := s.next.DeleteClientPeer(id)
+	s.observe("delete_client_peer", start, err)
+	return err
+}
+
+// AddTrafficUsage 包装 Store.AddTrafficUsage
+func (s *InstrumentedStore) AddTrafficUsage(usage []*types.TrafficUsage) error {
+	start := time.Now()
+	err := s.next.AddTrafficUsage(usage)
+	s.observe("add_traffic_usage", start, err)
+	return err
+}
+
+// ListTrafficUsage 包装 Store.ListTrafficUsage
+func (s *InstrumentedStore) ListTrafficUsage(filter UsageFilter) ([]*types.TrafficUsage, error) {
+	start := time.Now()
+	result, err := s.next.ListTrafficUsage(filter)
+	s.observe("list_traffic_usage", start, err)
+	return result, err
+}
+
+// CleanupTrafficUsage 包装 Store.CleanupTrafficUsage
+func (s *InstrumentedStore) CleanupTrafficUsage(before string) (int64, error) {
+	start := time.Now()
+	result, err := s.next.CleanupTrafficUsage(before)
+	s.observe("cleanup_traffic_usage", start, err)
+	return result, err
+}
+
+// Close 关闭底层存储
+func (s *InstrumentedStore) Close() error {
+	return s.next.Close()
+}
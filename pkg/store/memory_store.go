@@ -1,7 +1,9 @@
 package store
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,7 +20,21 @@ type MemoryStore struct {
 	users       map[int]*types.User // 用户ID到用户的映射
 	usernames   map[string]int      // 用户名到用户ID的映射
 	lastUserID  int                 // 最后分配的用户ID
-	maxNodeID   int                 // 最大节点ID
+	maxNodeID   int                 // 最近分配或指定的最大节点ID
+	tenants     map[int]*types.Tenant
+
+	bandwidthTests  map[int]*types.BandwidthTest
+	lastBandwidthID int
+
+	changesets      map[int]*types.Changeset
+	lastChangesetID int
+
+	usage map[usageKey]*types.TrafficUsage
+
+	clientPeers  map[int]*types.ClientPeer
+	lastClientID int
+
+	lastConnectionID int // 最后分配的连接ID
 }
 
 // NewMemoryStore 创建内存存储实例
@@ -31,30 +47,60 @@ func NewMemoryStore() *MemoryStore {
 		users:       make(map[int]*types.User),
 		usernames:   make(map[string]int),
 		lastUserID:  0,
+		tenants:     make(map[int]*types.Tenant),
+
+		bandwidthTests: make(map[int]*types.BandwidthTest),
+		changesets:     make(map[int]*types.Changeset),
+		usage:          make(map[usageKey]*types.TrafficUsage),
+		clientPeers:    make(map[int]*types.ClientPeer),
 	}
 }
 
+// usageKey 流量统计记录的唯一键
+type usageKey struct {
+	nodeID int
+	peerID int
+	date   string
+}
+
 // CreateNode 创建节点
 func (s *MemoryStore) CreateNode(node *types.NodeConfig) error {
 	s.Lock()
 	defer s.Unlock()
 
-	// 如果 NodeID 未定义
+	// 未指定 ID 时分配，与 GormStore 的序列一致，已删除节点的 ID 不会再自动分配
 	if node.ID == 0 {
 		s.maxNodeID++
 		node.ID = s.maxNodeID
-	} else if node.ID > s.maxNodeID {
-		s.maxNodeID = node.ID
 	}
-
 	if _, exists := s.nodes[node.ID]; exists {
-		return fmt.Errorf("node %d already exists", node.ID)
+		return fmt.Errorf("%w: %d", ErrNodeIDTaken, node.ID)
+	}
+	if node.ID > s.maxNodeID {
+		s.maxNodeID = node.ID
+	}
+	if node.AddressIndex == 0 {
+		node.AddressIndex = s.freeAddressIndex(node.ID)
 	}
 
 	s.nodes[node.ID] = node
 	return nil
 }
 
+// freeAddressIndex 返回新节点的地址编号，与 GormStore 相同，调用方需持有锁
+func (s *MemoryStore) freeAddressIndex(nodeID int) int {
+	maxIndex, taken := 0, false
+	for _, node := range s.nodes {
+		index := node.AddressNumber()
+		taken = taken || index == nodeID
+		maxIndex = max(maxIndex, index)
+	}
+	if !taken {
+		return nodeID
+	}
+	return maxIndex + 1
+}
+
 // GetNode 获取节点
 func (s *MemoryStore) GetNode(nodeID int) (*types.NodeConfig, error) {
 	s.RLock()
@@ -62,7 +108,7 @@ func (s *MemoryStore) GetNode(nodeID int) (*types.NodeConfig, error) {
 
 	node, exists := s.nodes[nodeID]
 	if !exists {
-		return nil, fmt.Errorf("node %d not found", nodeID)
+		return nil, fmt.Errorf("node %d %w", nodeID, ErrNotFound)
 	}
 
 	return node, nil
@@ -81,6 +127,197 @@ func (s *MemoryStore) UpdateNode(nodeID int, node *types.NodeConfig) error {
 	return nil
 }
 
+// UpdateNodeMetadata 更新节点备注信息
+func (s *MemoryStore) UpdateNodeMetadata(nodeID int, metadata *types.NodeMetadata) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.NodeMetadata = *metadata
+	return nil
+}
+
+// UpdateNodeAllowedPorts 更新节点的端口白名单，允许清空
+func (s *MemoryStore) UpdateNodeAllowedPorts(nodeID int, allowedPorts string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.AllowedPorts = allowedPorts
+	return nil
+}
+
+// UpdateNodeCertificate 记录节点当前有效的客户端证书，serial 为空时吊销
+func (s *MemoryStore) UpdateNodeCertificate(nodeID int, serial string, expiresAt *time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.CertSerial = serial
+	node.CertExpiresAt = expiresAt
+	return nil
+}
+
+// MarkNodeBootstrapped 标记节点已下发初始配置，只有首次标记成功时返回 true
+func (s *MemoryStore) MarkNodeBootstrapped(nodeID int, at time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists || node.BootstrappedAt != nil {
+		return false, nil
+	}
+	node.BootstrappedAt = &at
+	return true, nil
+}
+
+// UpdateNodeBabelOptions 更新节点的 babeld 接口默认参数
+func (s *MemoryStore) UpdateNodeBabelOptions(nodeID int, opts types.BabelInterfaceOptions) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.BabelOptions = opts
+	return nil
+}
+
+// UpdateNodeTags 更新节点的标签
+func (s *MemoryStore) UpdateNodeTags(nodeID int, tags []string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.Tags = tags
+	return nil
+}
+
+// UpdateNodeTrafficQuota 更新节点的月流量配额
+func (s *MemoryStore) UpdateNodeTrafficQuota(nodeID int, quota types.TrafficQuota) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.TrafficQuota = quota
+	return nil
+}
+
+// UpdateNodeQuotaStatus 更新节点的配额告警状态
+func (s *MemoryStore) UpdateNodeQuotaStatus(nodeID int, status types.QuotaStatus) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.QuotaStatus = status
+	return nil
+}
+
+// UpdateNodeName 更新节点名称
+func (s *MemoryStore) UpdateNodeName(nodeID int, name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.Name = name
+	node.UpdatedAt = time.Now()
+	return nil
+}
+
+// PatchNode 更新 patch 中非空的字段
+func (s *MemoryStore) PatchNode(nodeID int, patch NodePatch) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	if patch.Name != nil {
+		node.Name = *patch.Name
+	}
+	if patch.Endpoints != nil {
+		node.Endpoints = *patch.Endpoints
+	}
+	if patch.IPv4 != nil {
+		node.IPv4 = *patch.IPv4
+	}
+	if patch.IPv6 != nil {
+		node.IPv6 = *patch.IPv6
+	}
+	if patch.Tags != nil {
+		node.Tags = *patch.Tags
+	}
+	if patch.MTU != nil {
+		node.MTU = *patch.MTU
+	}
+	node.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateNodeAddressIndexes 更新多个节点的地址编号，任一节点不存在时不做修改
+func (s *MemoryStore) UpdateNodeAddressIndexes(indexes map[int]int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for nodeID := range indexes {
+		if _, exists := s.nodes[nodeID]; !exists {
+			return fmt.Errorf("node %d not found", nodeID)
+		}
+	}
+	now := time.Now()
+	for nodeID, index := range indexes {
+		s.nodes[nodeID].AddressIndex = index
+		s.nodes[nodeID].UpdatedAt = now
+	}
+	return nil
+}
+
+// UpdateNodeCapabilities 更新 agent 上报的本地工具探测结果
+func (s *MemoryStore) UpdateNodeCapabilities(nodeID int, caps []types.Capability) error {
+	s.Lock()
+	defer s.Unlock()
+
+	node, exists := s.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %d not found", nodeID)
+	}
+
+	node.Capabilities = caps
+	return nil
+}
+
 // DeleteNode 删除节点
 func (s *MemoryStore) DeleteNode(nodeID int) error {
 	s.Lock()
@@ -94,6 +331,38 @@ func (s *MemoryStore) DeleteNode(nodeID int) error {
 	return nil
 }
 
+// PurgeNodeData 删除节点的任务、状态、流量统计和测速记录，返回删除的记录数；
+// 流量统计和测速记录中节点作为对端的记录也一并删除
+func (s *MemoryStore) PurgeNodeData(nodeID int) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var deleted int64
+	for id, task := range s.tasks {
+		if task.NodeID == nodeID {
+			delete(s.tasks, id)
+			deleted++
+		}
+	}
+	if _, ok := s.status[nodeID]; ok {
+		delete(s.status, nodeID)
+		deleted++
+	}
+	for key := range s.usage {
+		if key.nodeID == nodeID || key.peerID == nodeID {
+			delete(s.usage, key)
+			deleted++
+		}
+	}
+	for id, test := range s.bandwidthTests {
+		if test.NodeID == nodeID || test.PeerID == nodeID {
+			delete(s.bandwidthTests, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 // ListNodes 列出所有节点
 func (s *MemoryStore) ListNodes() ([]*types.NodeConfig, error) {
 	s.RLock()
@@ -107,6 +376,49 @@ func (s *MemoryStore) ListNodes() ([]*types.NodeConfig, error) {
 	return nodes, nil
 }
 
+// ListNodesByTenant 列出租户下的所有节点
+func (s *MemoryStore) ListNodesByTenant(tenantID int) ([]*types.NodeConfig, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var nodes []*types.NodeConfig
+	for _, node := range s.nodes {
+		if node.TenantID == tenantID {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// ListNodeSummaries 列出租户下的节点摘要
+func (s *MemoryStore) ListNodeSummaries(tenantID int) ([]*types.NodeSummary, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	summaries := make([]*types.NodeSummary, 0)
+	for _, node := range s.nodes {
+		if node.TenantID != tenantID {
+			continue
+		}
+		summary := &types.NodeSummary{
+			ID:       node.ID,
+			TenantID: node.TenantID,
+			Name:     node.Name,
+		}
+		if status, ok := s.status[node.ID]; ok {
+			lastSeen := status.Timestamp
+			summary.Status = status.Status
+			summary.LastSeen = &lastSeen
+			summary.Version = status.Version
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+
+	return summaries, nil
+}
+
 // GetOrCreateWireguardConnection 获取或创建Wireguard连接
 func (s *MemoryStore) GetOrCreateWireguardConnection(connection *types.WireguardConnection, basePort int) (*types.WireguardConnection, error) {
 	if connection == nil {
@@ -137,7 +449,7 @@ func (s *MemoryStore) GetOrCreateWireguardConnection(connection *types.Wireguard
 		}
 
 		for _, c := range s.connections {
-			if c.NodeID == nodeID && c.PeerID == peerID {
+			if c.NodeID == nodeID && c.PeerID == peerID && c.Path == 0 {
 				conn = *c
 				break
 			}
@@ -153,9 +465,7 @@ func (s *MemoryStore) GetOrCreateWireguardConnection(connection *types.Wireguard
 		maxPort := basePort
 		s.RLock()
 		for _, c := range s.connections {
-			if c.Port > maxPort {
-				maxPort = c.Port
-			}
+			maxPort = max(maxPort, c.Port, c.PeerPort)
 		}
 		s.RUnlock()
 
@@ -165,13 +475,16 @@ func (s *MemoryStore) GetOrCreateWireguardConnection(connection *types.Wireguard
 		}
 
 		conn = types.WireguardConnection{
-			NodeID: connection.NodeID,
-			PeerID: connection.PeerID,
-			Port:   newPort,
+			NodeID:   connection.NodeID,
+			PeerID:   connection.PeerID,
+			Port:     newPort,
+			PeerPort: newPort,
 		}
 
 		s.Lock()
-		s.connections[len(s.connections)] = &conn
+		s.lastConnectionID++
+		conn.ID = s.lastConnectionID
+		s.connections[conn.ID] = &conn
 		s.Unlock()
 
 		return &conn, nil
@@ -181,15 +494,201 @@ func (s *MemoryStore) GetOrCreateWireguardConnection(connection *types.Wireguard
 	return nil, fmt.Errorf("invalid connection parameters; must provide either port, or node_id and peer_id")
 }
 
-// UpdateNodeStatus 更新节点状态
+// GetOrCreateWireguardConnections 批量获取或创建节点与多个对等节点之间的主链路，返回以对等节点ID为键的映射
+func (s *MemoryStore) GetOrCreateWireguardConnections(nodeID int, peerIDs []int, basePort int) (map[int]*types.WireguardConnection, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	conns := make(map[int]*types.WireguardConnection, len(peerIDs))
+	maxPort := 0
+	for _, c := range s.connections {
+		maxPort = max(maxPort, c.Port, c.PeerPort)
+		if c.Path != 0 {
+			continue
+		}
+		switch nodeID {
+		case c.NodeID:
+			conns[c.PeerID] = c
+		case c.PeerID:
+			conns[c.NodeID] = c
+		}
+	}
+
+	nextPort := basePort
+	if maxPort >= basePort {
+		nextPort = maxPort + 1
+	}
+
+	for _, peerID := range peerIDs {
+		if _, ok := conns[peerID]; ok || peerID == nodeID {
+			continue
+		}
+		conn := &types.WireguardConnection{
+			NodeID:   nodeID,
+			PeerID:   peerID,
+			Port:     nextPort,
+			PeerPort: nextPort,
+		}
+		nextPort++
+		s.lastConnectionID++
+		conn.ID = s.lastConnectionID
+		s.connections[conn.ID] = conn
+		conns[peerID] = conn
+	}
+
+	return conns, nil
+}
+
+// CreateWireguardConnections 使用调用方分配的端口创建连接，节点对上已存在相同路径的连接会被跳过，其 ID 保持为 0
+func (s *MemoryStore) CreateWireguardConnections(conns []*types.WireguardConnection) error {
+	s.Lock()
+	defer s.Unlock()
+
+	exists := make(map[[3]int]bool, len(s.connections))
+	for _, c := range s.connections {
+		exists[[3]int{c.NodeID, c.PeerID, c.Path}] = true
+		exists[[3]int{c.PeerID, c.NodeID, c.Path}] = true
+	}
+	for _, conn := range conns {
+		if exists[[3]int{conn.NodeID, conn.PeerID, conn.Path}] {
+			continue
+		}
+		if conn.PeerPort == 0 {
+			conn.PeerPort = conn.Port
+		}
+		s.lastConnectionID++
+		conn.ID = s.lastConnectionID
+		s.connections[conn.ID] = conn
+		exists[[3]int{conn.NodeID, conn.PeerID, conn.Path}] = true
+		exists[[3]int{conn.PeerID, conn.NodeID, conn.Path}] = true
+	}
+	return nil
+}
+
+// ListWireguardConnections 列出Wireguard连接，nodeID 为 0 时列出全部
+func (s *MemoryStore) ListWireguardConnections(nodeID int) ([]*types.WireguardConnection, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	conns := make([]*types.WireguardConnection, 0, len(s.connections))
+	for _, c := range s.connections {
+		if nodeID == 0 || c.NodeID == nodeID || c.PeerID == nodeID {
+			conns = append(conns, c)
+		}
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	return conns, nil
+}
+
+// GetWireguardConnection 获取Wireguard连接
+func (s *MemoryStore) GetWireguardConnection(id int) (*types.WireguardConnection, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	conn, ok := s.connections[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return conn, nil
+}
+
+// DeleteWireguardConnection 删除Wireguard连接，释放其端口
+func (s *MemoryStore) DeleteWireguardConnection(id int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.connections[id]; !ok {
+		return fmt.Errorf("wireguard connection %d not found", id)
+	}
+	delete(s.connections, id)
+	return nil
+}
+
+// UpdateWireguardConnection 更新Wireguard连接
+func (s *MemoryStore) UpdateWireguardConnection(connection *types.WireguardConnection) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, c := range s.connections {
+		if c.ID == connection.ID {
+			c.Port = connection.Port
+			c.PeerPort = connection.PeerPort
+			c.Disabled = connection.Disabled
+			c.BabelOptions = connection.BabelOptions
+			c.PathEndpoints = connection.PathEndpoints
+			c.EndpointPorts = connection.EndpointPorts
+			return nil
+		}
+	}
+	return fmt.Errorf("wireguard connection %d not found", connection.ID)
+}
+
+// UpdateConnectionLinkLocal 保存连接两端的链路本地地址
+func (s *MemoryStore) UpdateConnectionLinkLocal(id int, nodeAddr, peerAddr string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	conn, ok := s.connections[id]
+	if !ok {
+		return fmt.Errorf("wireguard connection %d not found", id)
+	}
+	conn.NodeLinkLocal = nodeAddr
+	conn.PeerLinkLocal = peerAddr
+	return nil
+}
+
+// UpdateConnectionActiveEndpoint 记录节点在连接上当前使用的对端端点，endpoint 为空时清除记录
+func (s *MemoryStore) UpdateConnectionActiveEndpoint(id, nodeID int, endpoint string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	conn, ok := s.connections[id]
+	if !ok {
+		return ErrNotFound
+	}
+	// 复制后替换，避免与读取方共享的 map 被并发修改
+	endpoints := make(map[int]string, len(conn.ActiveEndpoints)+1)
+	for k, v := range conn.ActiveEndpoints {
+		endpoints[k] = v
+	}
+	if endpoint == "" {
+		delete(endpoints, nodeID)
+	} else {
+		endpoints[nodeID] = endpoint
+	}
+	conn.ActiveEndpoints = endpoints
+	return nil
+}
+
+// UpdateNodeStatus 更新节点状态，已保存的状态更新时不覆盖
 func (s *MemoryStore) UpdateNodeStatus(nodeID int, status *types.NodeStatus) error {
 	s.Lock()
 	defer s.Unlock()
 
-	s.status[nodeID] = status
+	status.NodeID = nodeID
+	s.updateNodeStatusLocked(status)
 	return nil
 }
 
+// UpdateNodeStatuses 批量更新节点状态，只覆盖时间不晚于新状态的记录
+func (s *MemoryStore) UpdateNodeStatuses(statuses []*types.NodeStatus) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, status := range statuses {
+		s.updateNodeStatusLocked(status)
+	}
+	return nil
+}
+
+// updateNodeStatusLocked 保存不早于已有记录的状态，调用方需持有写锁
+func (s *MemoryStore) updateNodeStatusLocked(status *types.NodeStatus) {
+	if existing, ok := s.status[status.NodeID]; ok && existing.Timestamp.After(status.Timestamp) {
+		return
+	}
+	s.status[status.NodeID] = status
+}
+
 // GetNodeStatus 获取节点状态
 func (s *MemoryStore) GetNodeStatus(nodeID int) (*types.NodeStatus, error) {
 	s.RLock()
@@ -277,18 +776,39 @@ func (s *MemoryStore) DeleteTask(id string) error {
 	return nil
 }
 
-// CleanupTasks 清理过期任务
-func (s *MemoryStore) CleanupTasks() error {
+// CleanupTasks 删除指定状态下完成时间早于 before 的任务
+func (s *MemoryStore) CleanupTasks(status types.TaskStatus, before time.Time) (int64, error) {
 	s.Lock()
 	defer s.Unlock()
 
-	cutoff := time.Now().Add(-24 * time.Hour)
+	var deleted int64
 	for id, task := range s.tasks {
-		if task.CompletedAt != nil && task.CompletedAt.Before(cutoff) {
+		if task.Status == status && task.CompletedAt != nil && task.CompletedAt.Before(before) {
 			delete(s.tasks, id)
+			deleted++
 		}
 	}
-	return nil
+	return deleted, nil
+}
+
+// CleanupNodeStatuses 删除最后上报时间早于 before 的节点状态
+func (s *MemoryStore) CleanupNodeStatuses(before time.Time) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var deleted int64
+	for nodeID, status := range s.status {
+		if status.Timestamp.Before(before) {
+			delete(s.status, nodeID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// WithContext 内存存储的操作不会阻塞，直接返回自身
+func (s *MemoryStore) WithContext(ctx context.Context) Store {
+	return s
 }
 
 // Close 关闭存储
@@ -327,6 +847,29 @@ func (s *MemoryStore) CreateUser(user *types.User) error {
 	s.Lock()
 	defer s.Unlock()
 
+	return s.createUserLocked(user)
+}
+
+// CreateUserWithFirstRole 创建用户，租户还没有用户时以 firstRole 作为其角色
+func (s *MemoryStore) CreateUserWithFirstRole(user *types.User, firstRole string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	first := true
+	for _, existing := range s.users {
+		if existing.TenantID == user.TenantID {
+			first = false
+			break
+		}
+	}
+	if first {
+		user.Role = firstRole
+	}
+	return s.createUserLocked(user)
+}
+
+// createUserLocked 创建用户，调用方需持有写锁
+func (s *MemoryStore) createUserLocked(user *types.User) error {
 	// 检查用户名是否已存在
 	if _, exists := s.usernames[user.Username]; exists {
 		return fmt.Errorf("username already exists: %s", user.Username)
@@ -420,3 +963,387 @@ func (s *MemoryStore) DeleteUser(id int) error {
 
 	return nil
 }
+
+// CreateTenant 创建租户
+func (s *MemoryStore) CreateTenant(tenant *types.Tenant) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, t := range s.tenants {
+		if t.Name == tenant.Name {
+			return fmt.Errorf("tenant already exists: %s", tenant.Name)
+		}
+	}
+
+	tenant.ID = len(s.tenants) + 1
+	tenant.CreatedAt = time.Now()
+	tenant.UpdatedAt = time.Now()
+	s.tenants[tenant.ID] = tenant
+	return nil
+}
+
+// GetTenant 获取租户
+func (s *MemoryStore) GetTenant(id int) (*types.Tenant, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	tenant, exists := s.tenants[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return tenant, nil
+}
+
+// GetTenantByName 通过名称获取租户
+func (s *MemoryStore) GetTenantByName(name string) (*types.Tenant, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.Name == name {
+			return tenant, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// UpdateTenantBabelPolicy 更新租户的 babeld 过滤策略，policy 为 nil 时恢复默认策略
+func (s *MemoryStore) UpdateTenantBabelPolicy(tenantID int, policy *types.BabelPolicy) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return ErrNotFound
+	}
+	tenant.BabelPolicy = policy
+	tenant.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateTenantACLPolicy 更新租户的访问控制策略，policy 为 nil 时不限制
+func (s *MemoryStore) UpdateTenantACLPolicy(tenantID int, policy *types.ACLPolicy) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return ErrNotFound
+	}
+	tenant.ACLPolicy = policy
+	tenant.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateTenantBGPConfig 更新租户的 BGP 对接设置，bgp 为 nil 时不对接
+func (s *MemoryStore) UpdateTenantBGPConfig(tenantID int, bgp *types.BGPConfig) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return ErrNotFound
+	}
+	tenant.BGP = bgp
+	tenant.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateTenantRoutingDaemon 更新租户使用的路由守护进程，为空时使用 babeld
+func (s *MemoryStore) UpdateTenantRoutingDaemon(tenantID int, daemon string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return ErrNotFound
+	}
+	tenant.RoutingDaemon = daemon
+	tenant.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateTenantMaintenancePolicy 更新租户的维护窗口，policy 为 nil 时使用全局设置
+func (s *MemoryStore) UpdateTenantMaintenancePolicy(tenantID int, policy *types.MaintenancePolicy) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return ErrNotFound
+	}
+	tenant.MaintenancePolicy = policy
+	tenant.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpdateTenantNetworkSettings 更新租户网络的默认参数，settings 为 nil 时使用服务端配置
+func (s *MemoryStore) UpdateTenantNetworkSettings(tenantID int, settings *types.NetworkSettings) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tenant, exists := s.tenants[tenantID]
+	if !exists {
+		return ErrNotFound
+	}
+	tenant.Settings = settings
+	tenant.UpdatedAt = time.Now()
+	return nil
+}
+
+// CreateBandwidthTest 创建吞吐量测试记录
+func (s *MemoryStore) CreateBandwidthTest(test *types.BandwidthTest) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastBandwidthID++
+	test.ID = s.lastBandwidthID
+	s.bandwidthTests[test.ID] = test
+	return nil
+}
+
+// UpdateBandwidthTest 更新吞吐量测试记录
+func (s *MemoryStore) UpdateBandwidthTest(test *types.BandwidthTest) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.bandwidthTests[test.ID]; !ok {
+		return ErrNotFound
+	}
+	s.bandwidthTests[test.ID] = test
+	return nil
+}
+
+// GetBandwidthTest 获取吞吐量测试记录
+func (s *MemoryStore) GetBandwidthTest(id int) (*types.BandwidthTest, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	test, ok := s.bandwidthTests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return test, nil
+}
+
+// ListBandwidthTests 列出租户的吞吐量测试记录，按创建时间倒序
+func (s *MemoryStore) ListBandwidthTests(tenantID int) ([]*types.BandwidthTest, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var tests []*types.BandwidthTest
+	for _, test := range s.bandwidthTests {
+		if test.TenantID == tenantID {
+			tests = append(tests, test)
+		}
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].CreatedAt.After(tests[j].CreatedAt) })
+	return tests, nil
+}
+
+// CreateChangeset 创建变更集
+func (s *MemoryStore) CreateChangeset(changeset *types.Changeset) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastChangesetID++
+	changeset.ID = s.lastChangesetID
+	s.changesets[changeset.ID] = changeset
+	return nil
+}
+
+// UpdateChangeset 更新变更集
+func (s *MemoryStore) UpdateChangeset(changeset *types.Changeset) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.changesets[changeset.ID]; !ok {
+		return ErrNotFound
+	}
+	s.changesets[changeset.ID] = changeset
+	return nil
+}
+
+// GetChangeset 获取变更集
+func (s *MemoryStore) GetChangeset(id int) (*types.Changeset, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	changeset, ok := s.changesets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return changeset, nil
+}
+
+// GetPendingChangeset 获取租户待审批的变更集，没有时返回 ErrNotFound
+func (s *MemoryStore) GetPendingChangeset(tenantID int) (*types.Changeset, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var pending *types.Changeset
+	for _, changeset := range s.changesets {
+		if changeset.TenantID == tenantID && changeset.Status == types.ChangesetPending && (pending == nil || changeset.ID < pending.ID) {
+			pending = changeset
+		}
+	}
+	if pending == nil {
+		return nil, ErrNotFound
+	}
+	return pending, nil
+}
+
+// ListChangesets 列出租户的变更集，status 为空时列出全部，按创建时间倒序
+func (s *MemoryStore) ListChangesets(tenantID int, status string) ([]*types.Changeset, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var changesets []*types.Changeset
+	for _, changeset := range s.changesets {
+		if changeset.TenantID == tenantID && (status == "" || changeset.Status == status) {
+			changesets = append(changesets, changeset)
+		}
+	}
+	sort.Slice(changesets, func(i, j int) bool { return changesets[i].CreatedAt.After(changesets[j].CreatedAt) })
+	return changesets, nil
+}
+
+// CreateClientPeer 创建客户端对等节点
+func (s *MemoryStore) CreateClientPeer(peer *types.ClientPeer) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastClientID++
+	peer.ID = s.lastClientID
+	s.clientPeers[peer.ID] = peer
+	return nil
+}
+
+// UpdateClientPeer 更新客户端对等节点
+func (s *MemoryStore) UpdateClientPeer(peer *types.ClientPeer) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.clientPeers[peer.ID]; !ok {
+		return ErrNotFound
+	}
+	s.clientPeers[peer.ID] = peer
+	return nil
+}
+
+// GetClientPeer 获取客户端对等节点
+func (s *MemoryStore) GetClientPeer(id int) (*types.ClientPeer, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	peer, ok := s.clientPeers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return peer, nil
+}
+
+// ListClientPeers 列出租户的客户端对等节点，按 ID 排序
+func (s *MemoryStore) ListClientPeers(tenantID int) ([]*types.ClientPeer, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var peers []*types.ClientPeer
+	for _, peer := range s.clientPeers {
+		if peer.TenantID == tenantID {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers, nil
+}
+
+// ListExpiredClientPeers 列出所有租户中已过期的客户端对等节点
+func (s *MemoryStore) ListExpiredClientPeers(now time.Time) ([]*types.ClientPeer, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var peers []*types.ClientPeer
+	for _, peer := range s.clientPeers {
+		if peer.Expired(now) {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers, nil
+}
+
+// DeleteClientPeer 删除客户端对等节点
+func (s *MemoryStore) DeleteClientPeer(id int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.clientPeers[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.clientPeers, id)
+	return nil
+}
+
+// AddTrafficUsage 累加流量统计，同一节点、对端和日期的记录合并
+func (s *MemoryStore) AddTrafficUsage(usage []*types.TrafficUsage) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, u := range usage {
+		key := usageKey{nodeID: u.NodeID, peerID: u.PeerID, date: u.Date}
+		if existing, ok := s.usage[key]; ok {
+			existing.RxBytes += u.RxBytes
+			existing.TxBytes += u.TxBytes
+			existing.UpdatedAt = u.UpdatedAt
+			continue
+		}
+		copied := *u
+		s.usage[key] = &copied
+	}
+	return nil
+}
+
+// ListTrafficUsage 查询流量统计，按日期、节点和对端排序
+func (s *MemoryStore) ListTrafficUsage(filter UsageFilter) ([]*types.TrafficUsage, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var usage []*types.TrafficUsage
+	for _, u := range s.usage {
+		if u.TenantID != filter.TenantID ||
+			(filter.NodeID != 0 && u.NodeID != filter.NodeID) ||
+			(filter.From != "" && u.Date < filter.From) ||
+			(filter.To != "" && u.Date > filter.To) {
+			continue
+		}
+		copied := *u
+		usage = append(usage, &copied)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		a, b := usage[i], usage[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.NodeID != b.NodeID {
+			return a.NodeID < b.NodeID
+		}
+		return a.PeerID < b.PeerID
+	})
+	return usage, nil
+}
+
+// CleanupTrafficUsage 删除指定日期之前的流量统计
+func (s *MemoryStore) CleanupTrafficUsage(before string) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var deleted int64
+	for key := range s.usage {
+		if key.date < before {
+			delete(s.usage, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Constructor 根据配置创建存储实例，返回值同时实现 Store 时直接使用，否则按 StoreV1 适配
+type Constructor func(cfg *Config) (StoreV1, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Constructor)
+)
+
+func init() {
+	RegisterBackend("memory", func(cfg *Config) (StoreV1, error) {
+		return NewMemoryStore(), nil
+	})
+	RegisterBackend("sqlite", func(cfg *Config) (StoreV1, error) {
+		return NewSQLiteStore(cfg.SQLite)
+	})
+	RegisterBackend("postgres", func(cfg *Config) (StoreV1, error) {
+		return NewPostgreStore(cfg.Postgres)
+	})
+}
+
+// RegisterBackend 注册存储后端，配置中 storage.type 为 name 时使用 constructor 创建存储
+//
+// 下游部署可以借此接入 etcd、MySQL 或自研存储：在自己的包中实现 StoreV1 接口，
+// 于 init 中调用 RegisterBackend，并在服务端入口匿名导入该包即可，无需修改本包。
+// StoreV1 是稳定的扩展接口，之后的版本只增加新接口，已有后端无需修改即可随新版本使用。
+// 后端专有参数通过 Config.Options 传入。名称重复或 constructor 为空时 panic。
+func RegisterBackend(name string, constructor Constructor) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if constructor == nil {
+		panic("store: RegisterBackend constructor is nil")
+	}
+	if _, exists := backends[name]; exists {
+		panic("store: RegisterBackend called twice for backend " + name)
+	}
+	backends[name] = constructor
+}
+
+// Backends 返回已注册的存储后端名称
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupBackend 查找存储后端
+func lookupBackend(name string) (Constructor, error) {
+	backendsMu.RLock()
+	constructor, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported store type: %s (registered: %v)", name, Backends())
+	}
+	return constructor, nil
+}
+
+// adaptBackend 将后端适配为 Store，只实现 StoreV1 的后端由 v1Backend 补全
+func adaptBackend(backend StoreV1) Store {
+	if s, ok := backend.(Store); ok {
+		return s
+	}
+	return &v1Backend{StoreV1: backend}
+}
+
+// v1Backend 只实现 StoreV1 的第三方后端，StoreV1 之后增加的方法在此提供默认实现
+type v1Backend struct {
+	StoreV1
+}
+
+// WithContext 返回自身，后端不支持按 ctx 中止查询
+func (b *v1Backend) WithContext(ctx context.Context) Store {
+	return b
+}
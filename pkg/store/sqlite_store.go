@@ -1,6 +1,10 @@
 package store
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/glebarez/sqlite"
 )
 
@@ -9,12 +13,59 @@ type SQLiteStore struct {
 	*GormStore
 }
 
+var (
+	sqliteJournalModes = map[string]bool{"DELETE": true, "TRUNCATE": true, "PERSIST": true, "MEMORY": true, "WAL": true, "OFF": true}
+	sqliteSyncModes    = map[string]bool{"OFF": true, "NORMAL": true, "FULL": true, "EXTRA": true}
+)
+
 // NewSQLiteStore 创建SQLite存储实例
-func NewSQLiteStore(path string) (*SQLiteStore, error) {
-	store, err := NewGormStore(sqlite.Open(path))
+func NewSQLiteStore(config SQLiteConfig) (*SQLiteStore, error) {
+	dsn, err := sqliteDSN(config)
 	if err != nil {
 		return nil, err
 	}
 
+	store, err := NewGormStore(sqlite.Open(dsn))
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite 同一时间只允许一个写者，串行化写入并在繁忙时重试
+	store.writeMu = &sync.Mutex{}
+	store.busyRetries = config.BusyRetries
+
 	return &SQLiteStore{GormStore: store}, nil
 }
+
+// sqliteDSN 根据配置生成带 pragma 参数的连接串
+func sqliteDSN(config SQLiteConfig) (string, error) {
+	var pragmas []string
+
+	if config.BusyTimeout > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("_pragma=busy_timeout(%d)", config.BusyTimeout.Milliseconds()))
+	}
+	if config.JournalMode != "" {
+		mode := strings.ToUpper(config.JournalMode)
+		if !sqliteJournalModes[mode] {
+			return "", fmt.Errorf("invalid sqlite journal_mode: %s", config.JournalMode)
+		}
+		pragmas = append(pragmas, fmt.Sprintf("_pragma=journal_mode(%s)", mode))
+	}
+	if config.Synchronous != "" {
+		mode := strings.ToUpper(config.Synchronous)
+		if !sqliteSyncModes[mode] {
+			return "", fmt.Errorf("invalid sqlite synchronous: %s", config.Synchronous)
+		}
+		pragmas = append(pragmas, fmt.Sprintf("_pragma=synchronous(%s)", mode))
+	}
+
+	if len(pragmas) == 0 {
+		return config.Path, nil
+	}
+
+	sep := "?"
+	if strings.Contains(config.Path, "?") {
+		sep = "&"
+	}
+	return config.Path + sep + strings.Join(pragmas, "&"), nil
+}
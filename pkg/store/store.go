@@ -1,30 +1,70 @@
 package store
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"time"
 
 	"mesh-backend/pkg/types"
 )
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound    = errors.New("not found")
+	ErrNodeIDTaken = errors.New("node id already in use")
 )
 
-// Store 定义存储接口
+// Store 定义存储接口，内置后端实现全部方法
 type Store interface {
+	StoreV1
+
+	// WithContext 返回绑定到 ctx 的存储，ctx 取消或超时后未完成的查询随之中止
+	WithContext(ctx context.Context) Store
+}
+
+// StoreV1 第一版存储后端接口，第三方后端实现它即可通过 RegisterBackend 接入
+//
+// 该接口发布后不再修改。新增的存储方法放入嵌入 StoreV1 的 StoreV2，由 Store 嵌入，
+// 并在 registry.go 的 v1Backend 中为只实现 StoreV1 的后端提供默认实现。
+type StoreV1 interface {
 	// 节点相关
+	// CreateNode 创建节点，node.ID 为 0 时从节点 ID 序列分配，分配过的 ID 不会再自动分配；
+	// 指定的 ID 已被占用时返回 ErrNodeIDTaken
 	CreateNode(node *types.NodeConfig) error
 	GetNode(nodeID int) (*types.NodeConfig, error)
 	UpdateNode(nodeID int, node *types.NodeConfig) error
+	UpdateNodeMetadata(nodeID int, metadata *types.NodeMetadata) error
+	UpdateNodeAllowedPorts(nodeID int, allowedPorts string) error
+	UpdateNodeBabelOptions(nodeID int, opts types.BabelInterfaceOptions) error
+	UpdateNodeTrafficQuota(nodeID int, quota types.TrafficQuota) error
+	UpdateNodeQuotaStatus(nodeID int, status types.QuotaStatus) error
+	UpdateNodeTags(nodeID int, tags []string) error
+	UpdateNodeName(nodeID int, name string) error
+	PatchNode(nodeID int, patch NodePatch) error
+	UpdateNodeAddressIndexes(indexes map[int]int) error
+	UpdateNodeCapabilities(nodeID int, caps []types.Capability) error
+	UpdateNodeCertificate(nodeID int, serial string, expiresAt *time.Time) error
+	MarkNodeBootstrapped(nodeID int, at time.Time) (bool, error)
 	DeleteNode(nodeID int) error
+	PurgeNodeData(nodeID int) (int64, error)
 	ListNodes() ([]*types.NodeConfig, error)
+	ListNodesByTenant(tenantID int) ([]*types.NodeConfig, error)
+	ListNodeSummaries(tenantID int) ([]*types.NodeSummary, error)
 	GetOrCreateWireguardConnection(connection *types.WireguardConnection, basePort int) (*types.WireguardConnection, error)
+	GetOrCreateWireguardConnections(nodeID int, peerIDs []int, basePort int) (map[int]*types.WireguardConnection, error)
+	CreateWireguardConnections(conns []*types.WireguardConnection) error
+	ListWireguardConnections(nodeID int) ([]*types.WireguardConnection, error)
+	GetWireguardConnection(id int) (*types.WireguardConnection, error)
+	UpdateWireguardConnection(connection *types.WireguardConnection) error
+	UpdateConnectionActiveEndpoint(id, nodeID int, endpoint string) error
+	UpdateConnectionLinkLocal(id int, nodeAddr, peerAddr string) error
+	DeleteWireguardConnection(id int) error
 
-	// 节点状态相关
+	// 节点状态相关，状态按 Timestamp 判断先后，不覆盖已保存的更新状态
 	UpdateNodeStatus(nodeID int, status *types.NodeStatus) error
+	UpdateNodeStatuses(statuses []*types.NodeStatus) error
 	GetNodeStatus(nodeID int) (*types.NodeStatus, error)
 	ListNodeStatus() ([]*types.NodeStatus, error)
+	CleanupNodeStatuses(before time.Time) (int64, error)
 
 	// 任务相关
 	CreateTask(task *types.Task) error
@@ -32,30 +72,95 @@ type Store interface {
 	GetTask(id string) (*types.Task, error)
 	ListTasks(filter TaskFilter) ([]*types.Task, error)
 	DeleteTask(id string) error
-	CleanupTasks() error
+	CleanupTasks(status types.TaskStatus, before time.Time) (int64, error)
 
 	// 用户相关
 	CreateUser(user *types.User) error
 	GetUser(id int) (*types.User, error)
 	GetUserByUsername(username string) (*types.User, error)
 	CheckUserExists(username string) (bool, error)
+	// CreateUserWithFirstRole 创建用户，租户还没有用户时以 firstRole 作为其角色，
+	// 检查与创建原子进行，并发注册时只有一个用户获得 firstRole
+	CreateUserWithFirstRole(user *types.User, firstRole string) error
 	UpdateUser(user *types.User) error
 	DeleteUser(id int) error
 
+	// 租户相关
+	CreateTenant(tenant *types.Tenant) error
+	GetTenant(id int) (*types.Tenant, error)
+	GetTenantByName(name string) (*types.Tenant, error)
+	UpdateTenantBabelPolicy(tenantID int, policy *types.BabelPolicy) error
+	UpdateTenantMaintenancePolicy(tenantID int, policy *types.MaintenancePolicy) error
+	UpdateTenantACLPolicy(tenantID int, policy *types.ACLPolicy) error
+	UpdateTenantBGPConfig(tenantID int, bgp *types.BGPConfig) error
+	UpdateTenantRoutingDaemon(tenantID int, daemon string) error
+	UpdateTenantNetworkSettings(tenantID int, settings *types.NetworkSettings) error
+
+	// 诊断相关
+	CreateBandwidthTest(test *types.BandwidthTest) error
+	UpdateBandwidthTest(test *types.BandwidthTest) error
+	GetBandwidthTest(id int) (*types.BandwidthTest, error)
+	ListBandwidthTests(tenantID int) ([]*types.BandwidthTest, error)
+
+	// 变更审批相关
+	CreateChangeset(changeset *types.Changeset) error
+	UpdateChangeset(changeset *types.Changeset) error
+	GetChangeset(id int) (*types.Changeset, error)
+	GetPendingChangeset(tenantID int) (*types.Changeset, error)
+	ListChangesets(tenantID int, status string) ([]*types.Changeset, error)
+
+	// 客户端对等节点相关
+	CreateClientPeer(peer *types.ClientPeer) error
+	UpdateClientPeer(peer *types.ClientPeer) error
+	GetClientPeer(id int) (*types.ClientPeer, error)
+	ListClientPeers(tenantID int) ([]*types.ClientPeer, error)
+	ListExpiredClientPeers(now time.Time) ([]*types.ClientPeer, error)
+	DeleteClientPeer(id int) error
+
+	// 流量统计相关
+	AddTrafficUsage(usage []*types.TrafficUsage) error
+	ListTrafficUsage(filter UsageFilter) ([]*types.TrafficUsage, error)
+	CleanupTrafficUsage(before string) (int64, error)
+
 	// 关闭存储
 	Close() error
 }
 
+// NodePatch 节点的部分更新，只更新非空字段
+type NodePatch struct {
+	Name      *string
+	Endpoints *string // JSON 数组
+	IPv4      *string
+	IPv6      *string
+	Tags      *[]string
+	MTU       *int
+}
+
+// UsageFilter 流量统计过滤器，日期为 YYYY-MM-DD，范围包含两端
+type UsageFilter struct {
+	TenantID int
+	NodeID   int    // 为 0 表示全部节点
+	From     string // 为空表示不限
+	To       string // 为空表示不限
+}
+
 // Config 存储配置
 type Config struct {
 	Type     string         `yaml:"type"`     // 存储类型
 	SQLite   SQLiteConfig   `yaml:"sqlite"`   // SQLite配置
 	Postgres PostgresConfig `yaml:"postgres"` // Postgre配置
+
+	// Options 通过 RegisterBackend 注册的第三方后端的专有参数
+	Options map[string]string `yaml:"options"`
 }
 
 // SQLiteConfig SQLite配置
 type SQLiteConfig struct {
-	Path string `yaml:"path"` // 数据库文件路径
+	Path        string        `yaml:"path"`         // 数据库文件路径
+	JournalMode string        `yaml:"journal_mode"` // 日志模式 (WAL, DELETE, ...)
+	Synchronous string        `yaml:"synchronous"`  // 同步模式 (OFF, NORMAL, FULL, EXTRA)
+	BusyTimeout time.Duration `yaml:"busy_timeout"` // 数据库锁定时的等待时间
+	BusyRetries int           `yaml:"busy_retries"` // 数据库繁忙时的最大重试次数
 }
 
 // PostgresConfig Postgre配置
@@ -68,16 +173,15 @@ type PostgresConfig struct {
 	SSLMode  string `yaml:"sslmode"`
 }
 
-// NewStore 创建存储实例
+// NewStore 根据 cfg.Type 使用已注册的后端创建存储实例
 func NewStore(cfg *Config) (Store, error) {
-	switch cfg.Type {
-	case "memory":
-		return NewMemoryStore(), nil
-	case "sqlite":
-		return NewSQLiteStore(cfg.SQLite.Path)
-	case "postgres":
-		return NewPostgreStore(cfg.Postgres)
-	default:
-		return nil, fmt.Errorf("unsupported store type: %s", cfg.Type)
+	constructor, err := lookupBackend(cfg.Type)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := constructor(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return adaptBackend(backend), nil
 }
@@ -0,0 +1,152 @@
+package types
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ACL 动作
+const (
+	ACLAllow = "allow"
+	ACLDeny  = "deny"
+)
+
+// ACLAnyTag 匹配所有成员的标签
+const ACLAnyTag = "*"
+
+// FirewallTable agent 安装的 nftables 表名，整表由 agent 管理
+const FirewallTable = "mesh_acl"
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// ValidateTags 校验节点或客户端的标签，标签为小写字母、数字和 _.-
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// ACLPolicy 租户网络内的访问控制策略，按成员（节点和客户端）的标签控制互访
+//
+// 策略编译为各节点上的 nftables 规则，在目的节点（客户端则在其网关节点）丢弃不允许的源地址；
+// 中转节点不做过滤。不使用 AllowedIPs 限制，因为 babeld 选路时任意链路都可能承载中转流量。
+type ACLPolicy struct {
+	Default string    `json:"default"` // 没有规则匹配时的动作：allow 或 deny
+	Rules   []ACLRule `json:"rules"`   // 按顺序匹配，使用第一条匹配的规则
+}
+
+// ACLRule 一条访问规则，源成员带有 Src 标签且目的成员带有 Dst 标签时匹配
+type ACLRule struct {
+	Src    string `json:"src"`    // 源标签，* 匹配所有成员
+	Dst    string `json:"dst"`    // 目的标签，* 匹配所有成员
+	Action string `json:"action"` // allow 或 deny
+}
+
+// Validate 校验访问控制策略
+func (p *ACLPolicy) Validate() error {
+	if p.Default != ACLAllow && p.Default != ACLDeny {
+		return fmt.Errorf("invalid default action: %q", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Action != ACLAllow && rule.Action != ACLDeny {
+			return fmt.Errorf("rule %d: invalid action %q", i+1, rule.Action)
+		}
+		for _, tag := range []string{rule.Src, rule.Dst} {
+			if tag != ACLAnyTag && !tagPattern.MatchString(tag) {
+				return fmt.Errorf("rule %d: invalid tag %q", i+1, tag)
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed 返回带有 srcTags 的成员是否可以访问带有 dstTags 的成员
+func (p *ACLPolicy) Allowed(srcTags, dstTags []string) bool {
+	for _, rule := range p.Rules {
+		if aclMatch(rule.Src, srcTags) && aclMatch(rule.Dst, dstTags) {
+			return rule.Action == ACLAllow
+		}
+	}
+	return p.Default == ACLAllow
+}
+
+func aclMatch(tag string, tags []string) bool {
+	return tag == ACLAnyTag || slices.Contains(tags, tag)
+}
+
+// FirewallPolicy 由访问控制策略编译出的节点防火墙规则，随节点配置下发，由 agent 安装到 nftables
+type FirewallPolicy struct {
+	Rules []FirewallRule `json:"rules"`
+}
+
+// FirewallRule 丢弃来自 Saddr 的报文；Daddr 为空时作用于发往本节点的报文（input），否则作用于转发到 Daddr 的报文（forward）
+type FirewallRule struct {
+	Daddr []string `json:"daddr,omitempty"`
+	Saddr []string `json:"saddr"`
+}
+
+// NFTables 渲染为 nft -f 使用的脚本，先删除旧表再整体创建，重复执行结果相同
+func (p *FirewallPolicy) NFTables() (string, error) {
+	var input, forward []string
+	for i, rule := range p.Rules {
+		for _, ipv6 := range []bool{false, true} {
+			saddr, err := familyPrefixes(rule.Saddr, ipv6)
+			if err != nil {
+				return "", fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			daddr, err := familyPrefixes(rule.Daddr, ipv6)
+			if err != nil {
+				return "", fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			if len(saddr) == 0 || len(rule.Daddr) > 0 && len(daddr) == 0 {
+				continue
+			}
+			family := "ip"
+			if ipv6 {
+				family = "ip6"
+			}
+			match := fmt.Sprintf("%s saddr { %s } drop", family, strings.Join(saddr, ", "))
+			if len(rule.Daddr) == 0 {
+				input = append(input, match)
+			} else {
+				forward = append(forward, fmt.Sprintf("%s daddr { %s } %s", family, strings.Join(daddr, ", "), match))
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\ntable inet %s {\n", FirewallTable, FirewallTable, FirewallTable)
+	for _, chain := range []struct {
+		name  string
+		rules []string
+	}{{"input", input}, {"forward", forward}} {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %s priority filter; policy accept;\n", chain.name, chain.name)
+		for _, rule := range chain.rules {
+			fmt.Fprintf(&b, "\t\t%s\n", rule)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// familyPrefixes 返回指定地址族的前缀
+func familyPrefixes(prefixes []string, ipv6 bool) ([]string, error) {
+	var result []string
+	for _, raw := range prefixes {
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q", raw)
+		}
+		if prefix.Addr().Is6() == ipv6 {
+			result = append(result, prefix.Masked().String())
+		}
+	}
+	return result, nil
+}
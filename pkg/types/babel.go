@@ -0,0 +1,199 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// BabelInterfaceOptions babeld 接口参数，零值表示继承上一级设置
+//
+// 优先级从高到低：链路、节点。隧道链路和局域网链路通常需要不同的 hello/update 间隔。
+type BabelInterfaceOptions struct {
+	Type           string  `json:"type,omitempty"`            // 接口类型：wired、wireless 或 tunnel
+	HelloInterval  float64 `json:"hello_interval,omitempty"`  // hello 间隔（秒）
+	UpdateInterval float64 `json:"update_interval,omitempty"` // 路由更新间隔（秒）
+	RxCost         int     `json:"rxcost,omitempty"`          // 链路接收开销
+}
+
+// defaultBabelInterfaceType 未设置接口类型时使用的默认值，与默认模板中的 default type tunnel 一致
+const defaultBabelInterfaceType = "tunnel"
+
+// Validate 校验接口参数
+func (o *BabelInterfaceOptions) Validate() error {
+	switch o.Type {
+	case "", "wired", "wireless", "tunnel":
+	default:
+		return fmt.Errorf("invalid babel interface type: %s", o.Type)
+	}
+	if o.HelloInterval < 0 || o.HelloInterval > 655 {
+		return fmt.Errorf("hello_interval out of range: %g", o.HelloInterval)
+	}
+	if o.UpdateInterval < 0 || o.UpdateInterval > 655 {
+		return fmt.Errorf("update_interval out of range: %g", o.UpdateInterval)
+	}
+	if o.RxCost < 0 || o.RxCost > 65535 {
+		return fmt.Errorf("rxcost out of range: %d", o.RxCost)
+	}
+	return nil
+}
+
+// Merge 用 override 中已设置的字段覆盖当前参数
+func (o BabelInterfaceOptions) Merge(override BabelInterfaceOptions) BabelInterfaceOptions {
+	if override.Type != "" {
+		o.Type = override.Type
+	}
+	if override.HelloInterval > 0 {
+		o.HelloInterval = override.HelloInterval
+	}
+	if override.UpdateInterval > 0 {
+		o.UpdateInterval = override.UpdateInterval
+	}
+	if override.RxCost > 0 {
+		o.RxCost = override.RxCost
+	}
+	return o
+}
+
+// String 渲染为 babeld interface 语句的参数，如 type tunnel hello-interval 4
+func (o BabelInterfaceOptions) String() string {
+	typ := o.Type
+	if typ == "" {
+		typ = defaultBabelInterfaceType
+	}
+	parts := []string{"type", typ}
+	if o.HelloInterval > 0 {
+		parts = append(parts, "hello-interval", strconv.FormatFloat(o.HelloInterval, 'f', -1, 64))
+	}
+	if o.UpdateInterval > 0 {
+		parts = append(parts, "update-interval", strconv.FormatFloat(o.UpdateInterval, 'f', -1, 64))
+	}
+	if o.RxCost > 0 {
+		parts = append(parts, "rxcost", strconv.Itoa(o.RxCost))
+	}
+	return strings.Join(parts, " ")
+}
+
+// BabelPolicy 租户网络的 babeld 路由过滤策略，渲染到租户内每个节点的 babeld 配置中
+type BabelPolicy struct {
+	Rules []BabelFilterRule `json:"rules"` // 按顺序渲染，babeld 使用第一条匹配的规则
+}
+
+// BabelFilterRule babeld 的一条 in/out/redistribute 过滤规则
+//
+// Prefix 中可以使用 {node_ipv4}、{node_ipv6} 占位符，渲染时替换为当前节点的网段地址。
+type BabelFilterRule struct {
+	Type   string `json:"type"`             // in、out 或 redistribute
+	Local  bool   `json:"local,omitempty"`  // 只匹配本地路由，仅用于 redistribute
+	Prefix string `json:"prefix,omitempty"` // 匹配的前缀，为空时匹配所有路由
+	Eq     int    `json:"eq,omitempty"`     // 前缀长度等于该值
+	Le     int    `json:"le,omitempty"`     // 前缀长度不大于该值
+	Ge     int    `json:"ge,omitempty"`     // 前缀长度不小于该值
+	Action string `json:"action"`           // allow、deny 或 metric
+	Metric int    `json:"metric,omitempty"` // action 为 metric 时附加的开销
+}
+
+// 过滤规则前缀中的占位符
+const (
+	BabelPlaceholderIPv4 = "{node_ipv4}"
+	BabelPlaceholderIPv6 = "{node_ipv6}"
+)
+
+// DefaultBabelPolicy 未配置策略时使用的默认规则：只接收和通告 mesh 网段内的节点路由，不通告其他本地路由
+func DefaultBabelPolicy() *BabelPolicy {
+	v4, v6 := BabelPlaceholderIPv4, BabelPlaceholderIPv6
+	return &BabelPolicy{Rules: []BabelFilterRule{
+		{Type: "in", Prefix: v4 + "/16", Eq: 24, Action: "allow"},
+		{Type: "in", Prefix: v4 + "/24", Eq: 32, Action: "allow"},
+		{Type: "in", Prefix: v6 + "/48", Eq: 80, Action: "allow"},
+		{Type: "in", Prefix: v6 + "/80", Eq: 128, Action: "allow"},
+		{Type: "redistribute", Prefix: v4 + "/24", Eq: 32, Action: "allow"},
+		{Type: "redistribute", Prefix: v4 + "/16", Eq: 24, Action: "allow"},
+		{Type: "redistribute", Local: true, Prefix: v4 + "/24", Eq: 32, Action: "allow"},
+		{Type: "redistribute", Prefix: v6 + "/48", Eq: 80, Action: "allow"},
+		{Type: "redistribute", Prefix: v6 + "/80", Eq: 128, Action: "allow"},
+		{Type: "redistribute", Local: true, Action: "deny"},
+	}}
+}
+
+// Validate 校验策略中的所有规则
+func (p *BabelPolicy) Validate() error {
+	for i, rule := range p.Rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Validate 校验过滤规则
+func (r *BabelFilterRule) Validate() error {
+	switch r.Type {
+	case "in", "out", "redistribute":
+	default:
+		return fmt.Errorf("invalid filter type: %s", r.Type)
+	}
+	if r.Local && r.Type != "redistribute" {
+		return fmt.Errorf("local only applies to redistribute rules")
+	}
+	switch r.Action {
+	case "allow", "deny":
+	case "metric":
+		if r.Metric <= 0 || r.Metric > 65535 {
+			return fmt.Errorf("metric out of range: %d", r.Metric)
+		}
+	default:
+		return fmt.Errorf("invalid filter action: %s", r.Action)
+	}
+
+	maxLen := 128
+	if r.Prefix != "" {
+		// 占位符替换为任意同族地址后校验
+		prefix := strings.NewReplacer(BabelPlaceholderIPv4, "0.0.0.0", BabelPlaceholderIPv6, "::").Replace(r.Prefix)
+		ip, _, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid prefix: %s", r.Prefix)
+		}
+		if ip.To4() != nil {
+			maxLen = 32
+		}
+	}
+	if r.Eq != 0 && (r.Le != 0 || r.Ge != 0) {
+		return fmt.Errorf("eq cannot be combined with le or ge")
+	}
+	for _, n := range []int{r.Eq, r.Le, r.Ge} {
+		if n < 0 || n > maxLen {
+			return fmt.Errorf("prefix length out of range: %d", n)
+		}
+	}
+	if r.Le != 0 && r.Ge > r.Le {
+		return fmt.Errorf("ge %d is greater than le %d", r.Ge, r.Le)
+	}
+	return nil
+}
+
+// Render 渲染为 babeld 过滤语句，replacer 用于替换前缀中的占位符
+func (r *BabelFilterRule) Render(replacer *strings.Replacer) string {
+	parts := []string{r.Type}
+	if r.Local {
+		parts = append(parts, "local")
+	}
+	if r.Prefix != "" {
+		parts = append(parts, "ip", replacer.Replace(r.Prefix))
+	}
+	if r.Eq > 0 {
+		parts = append(parts, "eq", strconv.Itoa(r.Eq))
+	}
+	if r.Le > 0 {
+		parts = append(parts, "le", strconv.Itoa(r.Le))
+	}
+	if r.Ge > 0 {
+		parts = append(parts, "ge", strconv.Itoa(r.Ge))
+	}
+	parts = append(parts, r.Action)
+	if r.Action == "metric" {
+		parts = append(parts, strconv.Itoa(r.Metric))
+	}
+	return strings.Join(parts, " ")
+}
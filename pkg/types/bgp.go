@@ -0,0 +1,138 @@
+package types
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+var bgpNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// BGPConfig 租户网络与上游网络的 BGP 对接设置
+//
+// 设置了邻居的节点为边界节点，服务端为其生成 BIRD 2 配置片段，由 agent 写入并重新加载 BIRD；
+// 片段中只有静态路由和 BGP 会话，router id 等全局设置由节点上的主配置提供。
+type BGPConfig struct {
+	LocalASN  uint32        `json:"local_asn"`
+	Prefixes  []string      `json:"prefixes" binding:"dive,cidr"` // 向上游通告的前缀，为空时通告 network.ipv4_range 和 network.ipv6_range
+	Neighbors []BGPNeighbor `json:"neighbors"`
+}
+
+// BGPNeighbor 边界节点上的一个 BGP 邻居
+type BGPNeighbor struct {
+	Name     string `json:"name"`    // 会话名称，渲染为 BIRD 协议名 mesh_<name>
+	NodeID   int    `json:"node_id"` // 建立会话的边界节点
+	Address  string `json:"address"` // 邻居地址，决定通告 IPv4 还是 IPv6 前缀
+	ASN      uint32 `json:"asn"`
+	Password string `json:"password,omitempty"` // TCP MD5 口令
+	Multihop int    `json:"multihop,omitempty"` // 非直连邻居的跳数，0 表示直连
+}
+
+// Validate 校验 BGP 设置
+func (c *BGPConfig) Validate() error {
+	if c.LocalASN == 0 || c.LocalASN == 4294967295 {
+		return fmt.Errorf("invalid local_asn: %d", c.LocalASN)
+	}
+	for _, p := range c.Prefixes {
+		if prefix, err := netip.ParsePrefix(p); err != nil || prefix.Masked() != prefix {
+			return fmt.Errorf("invalid prefix: %s", p)
+		}
+	}
+	names := make(map[string]bool, len(c.Neighbors))
+	for i, n := range c.Neighbors {
+		if !bgpNamePattern.MatchString(n.Name) {
+			return fmt.Errorf("neighbor %d: invalid name %q", i+1, n.Name)
+		}
+		if names[n.Name] {
+			return fmt.Errorf("neighbor %d: duplicate name %s", i+1, n.Name)
+		}
+		names[n.Name] = true
+		if n.NodeID <= 0 {
+			return fmt.Errorf("neighbor %s: node_id is required", n.Name)
+		}
+		if _, err := netip.ParseAddr(n.Address); err != nil {
+			return fmt.Errorf("neighbor %s: invalid address %s", n.Name, n.Address)
+		}
+		if n.ASN == 0 || n.ASN == 4294967295 {
+			return fmt.Errorf("neighbor %s: invalid asn %d", n.Name, n.ASN)
+		}
+		if strings.ContainsAny(n.Password, "\"\\\n") {
+			return fmt.Errorf("neighbor %s: password must not contain quotes, backslashes or newlines", n.Name)
+		}
+		if n.Multihop < 0 || n.Multihop > 255 {
+			return fmt.Errorf("neighbor %s: invalid multihop %d", n.Name, n.Multihop)
+		}
+	}
+	return nil
+}
+
+// NodeIDs 返回设置了邻居的边界节点
+func (c *BGPConfig) NodeIDs() []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, n := range c.Neighbors {
+		if !seen[n.NodeID] {
+			seen[n.NodeID] = true
+			ids = append(ids, n.NodeID)
+		}
+	}
+	return ids
+}
+
+// BIRD 渲染节点 nodeID 的 BIRD 配置片段，节点没有邻居时返回空字符串
+//
+// 通告的前缀以 unreachable 静态路由的形式导入 BIRD，片段中没有 kernel 协议，不影响节点的路由表；
+// 发往 mesh 的流量由 babeld 安装的更具体路由转发。
+func (c *BGPConfig) BIRD(nodeID int, prefixes []string) string {
+	var neighbors []BGPNeighbor
+	for _, n := range c.Neighbors {
+		if n.NodeID == nodeID {
+			neighbors = append(neighbors, n)
+		}
+	}
+	if len(neighbors) == 0 {
+		return ""
+	}
+
+	var v4, v6 []string
+	for _, p := range prefixes {
+		if strings.Contains(p, ":") {
+			v6 = append(v6, p)
+		} else {
+			v4 = append(v4, p)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by mesh-backend, do not edit\n")
+	for _, family := range []struct {
+		name     string
+		prefixes []string
+	}{{"ipv4", v4}, {"ipv6", v6}} {
+		fmt.Fprintf(&b, "\nprotocol static mesh_%s {\n\t%s;\n", family.name, family.name)
+		for _, p := range family.prefixes {
+			fmt.Fprintf(&b, "\troute %s unreachable;\n", p)
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, n := range neighbors {
+		family := "ipv4"
+		if addr, _ := netip.ParseAddr(n.Address); addr.Is6() {
+			family = "ipv6"
+		}
+		fmt.Fprintf(&b, "\nprotocol bgp mesh_%s {\n", n.Name)
+		fmt.Fprintf(&b, "\tlocal as %d;\n", c.LocalASN)
+		fmt.Fprintf(&b, "\tneighbor %s as %d;\n", n.Address, n.ASN)
+		if n.Multihop > 0 {
+			fmt.Fprintf(&b, "\tmultihop %d;\n", n.Multihop)
+		}
+		if n.Password != "" {
+			fmt.Fprintf(&b, "\tpassword \"%s\";\n", n.Password)
+		}
+		fmt.Fprintf(&b, "\t%s {\n\t\timport none;\n\t\texport where proto = \"mesh_%s\";\n\t};\n", family, family)
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// agent 探测的工具
+const (
+	CapabilityBabeld    = "babeld"
+	CapabilityWireGuard = "wireguard-tools" // wg 命令
+	CapabilityBird      = "bird"
+)
+
+// 依赖特定版本的功能
+const (
+	minBabeldRTTVersion = "1.6" // babeld 自 1.6 起支持基于 RTT 的开销（enable-timestamps、max-rtt-penalty）
+	minBirdVersion      = "2.0" // 生成的 BIRD 配置使用 BIRD 2 的通道语法
+)
+
+// Capability agent 在注册时上报的一项本地工具探测结果
+type Capability struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Version   string `json:"version,omitempty"` // 从工具输出中解析的版本号，无法解析时为空
+}
+
+// CapabilityRequirements 节点配置依赖的功能
+type CapabilityRequirements struct {
+	RoutingDaemon string // 租户使用的路由守护进程
+	BabeldRTT     bool   // babeld 模板启用了基于 RTT 的开销
+}
+
+// CheckCapabilities 检查 agent 上报的工具是否满足节点配置的要求，返回不满足的项
+//
+// 旧版本 agent 不上报探测结果，caps 为空时不检查。
+func CheckCapabilities(caps []Capability, req CapabilityRequirements) []string {
+	if len(caps) == 0 {
+		return nil
+	}
+	byName := make(map[string]Capability, len(caps))
+	for _, c := range caps {
+		byName[c.Name] = c
+	}
+
+	var problems []string
+	require := func(name, minVersion, feature string) {
+		c, ok := byName[name]
+		if !ok || !c.Available {
+			problems = append(problems, fmt.Sprintf("%s is not installed (required for %s)", name, feature))
+			return
+		}
+		if minVersion != "" && c.Version != "" && CompareVersions(c.Version, minVersion) < 0 {
+			problems = append(problems, fmt.Sprintf("%s %s is older than %s (required for %s)", name, c.Version, minVersion, feature))
+		}
+	}
+
+	require(CapabilityWireGuard, "", "wireguard tunnels")
+	switch {
+	case IsBird(req.RoutingDaemon):
+		require(CapabilityBird, minBirdVersion, req.RoutingDaemon+" routing")
+	case req.RoutingDaemon == RoutingDaemonStatic:
+	case req.BabeldRTT:
+		require(CapabilityBabeld, minBabeldRTTVersion, "rtt-based metrics")
+	default:
+		require(CapabilityBabeld, "", "babeld routing")
+	}
+	return problems
+}
+
+// CompareVersions 按数字逐段比较点分版本号，非数字后缀被忽略
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = leadingInt(as[i])
+		}
+		if i < len(bs) {
+			y = leadingInt(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// leadingInt 解析字符串开头的数字，如 "13-rc1" 返回 13
+func leadingInt(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
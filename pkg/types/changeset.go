@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+// 变更集状态
+const (
+	ChangesetPending  = "pending"  // 等待审批，期间的修改合并到同一变更集
+	ChangesetApproved = "approved" // 已批准，相关节点已加入下发队列
+	ChangesetRejected = "rejected" // 已拒绝，相关节点不下发
+)
+
+// Changeset 等待审批的配置变更
+//
+// 开启 rollout.require_approval 后，修改只保存不下发，受影响的节点记录在租户唯一的待审批变更集中，
+// 由其他管理员批准后才生成配置更新任务。
+type Changeset struct {
+	ID         int           `gorm:"primarykey" json:"id"`
+	TenantID   int           `gorm:"index" json:"tenant_id"`
+	Status     string        `gorm:"size:20;index" json:"status"`
+	NodeIDs    []int         `gorm:"serializer:json;type:text" json:"node_ids"` // 需要重新下发配置的节点
+	Changes    []ChangeEntry `gorm:"serializer:json;type:text" json:"changes"`  // 变更集包含的修改请求
+	ReviewedBy int           `json:"reviewed_by,omitempty"`                     // 审批人用户ID
+	Comment    string        `gorm:"type:text" json:"comment,omitempty"`        // 审批意见
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	ReviewedAt *time.Time    `json:"reviewed_at,omitempty"`
+}
+
+// ChangeEntry 变更集中的一次修改请求
+type ChangeEntry struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	At       time.Time `json:"at"`
+}
+
+// AuthoredBy 用户是否提交过变更集中的修改
+func (c *Changeset) AuthoredBy(userID int) bool {
+	for _, change := range c.Changes {
+		if change.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
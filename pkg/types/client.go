@@ -0,0 +1,64 @@
+package types
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ClientInterfaceName 网关节点上客户端接口的名称（不含前缀），也是下发配置中 WireGuard 配置的键
+const ClientInterfaceName = "clients"
+
+// ClientPeer 客户端对等节点，手机、笔记本等不运行 agent 的设备，通过网关节点接入 mesh
+type ClientPeer struct {
+	ID         int       `gorm:"primarykey;autoIncrement" json:"id"` // 客户端ID，用于生成地址
+	CreatedAt  time.Time `json:"created_at"`                         // 创建时间
+	UpdatedAt  time.Time `json:"updated_at"`                         // 更新时间
+	TenantID   int       `gorm:"index" json:"tenant_id"`             // 所属租户
+	Name       string    `gorm:"size:255" json:"name"`               // 名称
+	PublicKey  string    `gorm:"size:255" json:"public_key"`         // WireGuard公钥
+	PrivateKey string    `gorm:"size:255" json:"-"`                  // 服务端生成的私钥，客户端自带公钥时为空
+	IPv4       string    `gorm:"size:45" json:"ipv4"`                // 客户端 IPv4 地址
+	IPv6       string    `gorm:"size:45" json:"ipv6"`                // 客户端 IPv6 地址
+	// 可接入的网关节点，客户端配置默认使用第一个；同一时间只应连接其中一个网关
+	GatewayIDs  []int    `gorm:"serializer:json;type:text" json:"gateway_ids"`
+	Description string   `gorm:"type:text" json:"description"`          // 描述
+	Tags        []string `gorm:"serializer:json;type:text" json:"tags"` // 访问控制策略使用的标签
+
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"` // 过期时间，到期后从网关节点移除并删除，为空表示长期有效
+}
+
+// Validate 校验客户端对等节点
+func (p *ClientPeer) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(p.GatewayIDs) == 0 {
+		return fmt.Errorf("at least one gateway is required")
+	}
+	seen := make(map[int]bool, len(p.GatewayIDs))
+	for _, id := range p.GatewayIDs {
+		if seen[id] {
+			return fmt.Errorf("duplicate gateway %d", id)
+		}
+		seen[id] = true
+	}
+	if err := ValidateTags(p.Tags); err != nil {
+		return err
+	}
+	if raw, err := base64.StdEncoding.DecodeString(p.PublicKey); err != nil || len(raw) != 32 {
+		return fmt.Errorf("invalid public key")
+	}
+	return nil
+}
+
+// Expired 是否已过期
+func (p *ClientPeer) Expired(now time.Time) bool {
+	return p.ExpiresAt != nil && !now.Before(*p.ExpiresAt)
+}
+
+// HasGateway 是否可通过指定节点接入
+func (p *ClientPeer) HasGateway(nodeID int) bool {
+	return slices.Contains(p.GatewayIDs, nodeID)
+}
@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // WireguardConnection 定义Wireguard连接
 type WireguardConnection struct {
@@ -9,8 +12,107 @@ type WireguardConnection struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	NodeID    int       `gorm:"index;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"node_id"` // 节点ID
 	PeerID    int       `gorm:"index;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"peer_id"` // 对等节点ID
-	Port      int       `json:"port"`                                                               // 端口
+	Port      int       `json:"port"`                                                               // NodeID 一端的监听端口
+	PeerPort  int       `gorm:"not null;default:0" json:"peer_port"`                                // PeerID 一端的监听端口，为 0 时与 Port 相同
+	Disabled  bool      `json:"disabled"`                                                           // 是否停用该链路
+
+	// 路径编号：0 为节点对的主链路，配置生成时自动创建；大于 0 为手动添加的附加路径，
+	// 与主链路并行建立独立的隧道（如分别经光纤和 LTE），由 babeld 按开销在路径间选择和切换
+	Path int `gorm:"not null;default:0" json:"path"`
+	// 附加路径两端使用的端点，键为节点 ID，值为该节点的端点地址，须在节点的端点列表中；
+	// 未指定的一端使用其首个端点
+	PathEndpoints map[int]string `gorm:"serializer:json;type:text" json:"path_endpoints,omitempty"`
+
+	// 两端对外的端点端口，键为节点 ID；端口转发或 NAT 映射使对端须连接的端口与监听端口不同时设置，
+	// 未设置的一端使用其监听端口
+	EndpointPorts map[int]int `gorm:"serializer:json;type:text" json:"endpoint_ports,omitempty"`
+
+	BabelOptions BabelInterfaceOptions `gorm:"serializer:json;type:text" json:"babel_options"` // 覆盖两端节点的 babeld 接口参数
+
+	// 两端隧道接口的链路本地地址（含前缀长度），由节点 ID 按 network.link_local_template 生成后保存
+	NodeLinkLocal string `gorm:"size:64" json:"node_link_local"` // NodeID 一端的地址
+	PeerLinkLocal string `gorm:"size:64" json:"peer_link_local"` // PeerID 一端的地址
+
+	// 两端当前使用的对端端点，键为发起连接的节点 ID，值为对端端点列表中的一项，由 agent 故障切换后上报
+	ActiveEndpoints map[int]string `gorm:"serializer:json;type:text" json:"active_endpoints,omitempty"`
 
 	Node NodeConfig `gorm:"foreignKey:NodeID" json:"node"` // 节点引用
 	Peer NodeConfig `gorm:"foreignKey:PeerID" json:"peer"` // 对等节点引用
 }
+
+// ConnectionInfo 控制台展示的连接信息
+type ConnectionInfo struct {
+	ID       int    `json:"id"`
+	NodeID   int    `json:"node_id"`
+	NodeName string `json:"node_name"`
+	PeerID   int    `json:"peer_id"`
+	PeerName string `json:"peer_name"`
+	Path     int    `json:"path"`      // 路径编号，0 为主链路
+	Port     int    `json:"port"`      // NodeID 一端的监听端口
+	PeerPort int    `json:"peer_port"` // PeerID 一端的监听端口
+	Enabled  bool   `json:"enabled"`   // 链路是否启用
+
+	NodeLinkLocal   string                `json:"node_link_local"`            // NodeID 一端的链路本地地址
+	PeerLinkLocal   string                `json:"peer_link_local"`            // PeerID 一端的链路本地地址
+	BabelOptions    BabelInterfaceOptions `json:"babel_options"`              // 链路的 babeld 接口参数覆盖
+	ActiveEndpoints map[int]string        `json:"active_endpoints,omitempty"` // 两端当前使用的对端端点，键为节点 ID
+	PathEndpoints   map[int]string        `json:"path_endpoints,omitempty"`   // 附加路径两端使用的端点，键为节点 ID
+	EndpointPorts   map[int]int           `json:"endpoint_ports,omitempty"`   // 两端对外的端点端口，键为节点 ID
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+}
+
+// LinkLocal 返回从节点 nodeID 一侧看到的本端和对端链路本地地址
+func (c *WireguardConnection) LinkLocal(nodeID int) (local, remote string) {
+	if nodeID == c.NodeID {
+		return c.NodeLinkLocal, c.PeerLinkLocal
+	}
+	return c.PeerLinkLocal, c.NodeLinkLocal
+}
+
+// Other 返回连接中节点 nodeID 的另一端节点 ID
+func (c *WireguardConnection) Other(nodeID int) int {
+	if nodeID == c.NodeID {
+		return c.PeerID
+	}
+	return c.NodeID
+}
+
+// ListenPort 返回节点 nodeID 在连接上的监听端口
+func (c *WireguardConnection) ListenPort(nodeID int) int {
+	if nodeID == c.PeerID && c.PeerPort != 0 {
+		return c.PeerPort
+	}
+	return c.Port
+}
+
+// RemotePort 返回节点 nodeID 连接对端时使用的端口：对端设置了端点端口时使用该端口，否则使用对端的监听端口
+func (c *WireguardConnection) RemotePort(nodeID int) int {
+	other := c.Other(nodeID)
+	if port := c.EndpointPorts[other]; port != 0 {
+		return port
+	}
+	return c.ListenPort(other)
+}
+
+// InterfaceName 返回连接在节点上的接口名（不含前缀）：主链路使用对端节点名，附加路径追加路径编号
+func (c *WireguardConnection) InterfaceName(peerName string) string {
+	if c.Path == 0 {
+		return peerName
+	}
+	return fmt.Sprintf("%s.%d", peerName, c.Path)
+}
+
+// ActiveEndpoint 返回节点 nodeID 当前使用的对端端点，未上报过时为空
+func (c *WireguardConnection) ActiveEndpoint(nodeID int) string {
+	return c.ActiveEndpoints[nodeID]
+}
+
+// LinkEndpoints 随节点配置下发的链路端点列表，agent 据此在握手超时后切换端点
+type LinkEndpoints struct {
+	PeerID    int      `json:"peer_id"`
+	Interface string   `json:"interface"`  // 不含前缀的接口名
+	PublicKey string   `json:"public_key"` // 对端公钥
+	Endpoints []string `json:"endpoints"`  // 对端的候选端点（host:port），按优先级排列
+	Active    string   `json:"active"`     // 当前配置中使用的端点
+}
@@ -0,0 +1,79 @@
+package types
+
+import "time"
+
+// 吞吐量测试中 agent 的角色
+const (
+	BandwidthRoleSender   = "sender"   // 连接接收端并持续发送数据
+	BandwidthRoleReceiver = "receiver" // 监听端口并统计收到的数据
+)
+
+// BandwidthTest 两个节点之间一次吞吐量测试，按链路保存
+type BandwidthTest struct {
+	ID             int        `gorm:"primarykey" json:"id"`
+	TenantID       int        `gorm:"index" json:"tenant_id"`
+	NodeID         int        `gorm:"index" json:"node_id"` // 发送端节点
+	PeerID         int        `gorm:"index" json:"peer_id"` // 接收端节点
+	Duration       int        `json:"duration"`             // 测试时长（秒）
+	Status         TaskStatus `gorm:"size:50" json:"status"`
+	SenderTaskID   string     `gorm:"size:36" json:"sender_task_id"`
+	ReceiverTaskID string     `gorm:"size:36" json:"receiver_task_id"`
+	SentBytes      int64      `json:"sent_bytes"`      // 发送端写出的字节数
+	ReceivedBytes  int64      `json:"received_bytes"`  // 接收端收到的字节数
+	BitsPerSecond  float64    `json:"bits_per_second"` // 按接收端统计的吞吐量
+	Error          string     `gorm:"type:text" json:"error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+}
+
+// BandwidthTestParams 吞吐量测试任务参数
+type BandwidthTestParams struct {
+	TestID   int    `json:"test_id"`
+	Role     string `json:"role"`     // sender / receiver
+	Address  string `json:"address"`  // 接收端地址，仅发送端使用
+	Port     int    `json:"port"`     // 接收端监听端口
+	Duration int    `json:"duration"` // 发送时长（秒）
+	Timeout  int    `json:"timeout"`  // 等待对端连接的超时（秒）
+}
+
+// BandwidthTestResult 吞吐量测试任务结果
+type BandwidthTestResult struct {
+	Bytes   int64   `json:"bytes"`   // 发送或接收的字节数
+	Seconds float64 `json:"seconds"` // 实际传输耗时
+}
+
+// TracerouteParams 路径探测任务参数
+type TracerouteParams struct {
+	Target  string `json:"target"`   // 目标节点的网格地址
+	MaxHops int    `json:"max_hops"` // 最大跳数
+}
+
+// TracerouteHop 路径上的一跳
+type TracerouteHop struct {
+	TTL      int       `json:"ttl"`
+	Address  string    `json:"address"`             // 回应的地址，全部探测超时时为空
+	RTTs     []float64 `json:"rtt_ms"`              // 各次探测的往返时延（毫秒），超时的探测不计入
+	Lost     int       `json:"lost"`                // 超时的探测次数
+	NodeID   int       `json:"node_id,omitempty"`   // 地址所属的网格节点，由服务端补全
+	NodeName string    `json:"node_name,omitempty"` // 节点名称，由服务端补全
+}
+
+// TracerouteResult 路径探测任务结果
+type TracerouteResult struct {
+	Target string          `json:"target"`
+	Hops   []TracerouteHop `json:"hops"`
+}
+
+// CaptureParams 抓包任务参数
+type CaptureParams struct {
+	Interface string `json:"interface"` // 网格接口名称
+	Filter    string `json:"filter"`    // BPF 过滤表达式，由服务端从白名单中选取
+	Duration  int    `json:"duration"`  // 抓包时长（秒）
+	MaxBytes  int64  `json:"max_bytes"` // 抓包文件大小上限
+}
+
+// CaptureResult 抓包任务结果
+type CaptureResult struct {
+	Bytes     int64 `json:"bytes"`     // 上传的抓包文件大小
+	Truncated bool  `json:"truncated"` // 是否因达到大小上限提前结束
+}
@@ -0,0 +1,109 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow 允许下发配置的时间窗口
+type MaintenanceWindow struct {
+	Start string   `json:"start" yaml:"start"`                   // 开始时间 HH:MM
+	End   string   `json:"end" yaml:"end"`                       // 结束时间 HH:MM，不晚于开始时间表示跨越午夜
+	Days  []string `json:"days,omitempty" yaml:"days,omitempty"` // 窗口开始所在的星期，如 mon、sat，为空表示每天
+}
+
+// MaintenancePolicy 配置下发的维护窗口，窗口外的配置更新推迟到下一个窗口开始时投递
+type MaintenancePolicy struct {
+	Timezone string              `json:"timezone" yaml:"timezone"` // IANA 时区，如 Asia/Shanghai，为空表示 UTC
+	Windows  []MaintenanceWindow `json:"windows" yaml:"windows"`   // 为空表示随时下发
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseClock 解析 HH:MM，返回当天零点起的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Validate 校验维护窗口策略
+func (p *MaintenancePolicy) Validate() error {
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", p.Timezone)
+	}
+	for i, w := range p.Windows {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("window %d: %w", i+1, err)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("window %d: %w", i+1, err)
+		}
+		for _, day := range w.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("window %d: invalid day %q", i+1, day)
+			}
+		}
+	}
+	return nil
+}
+
+// NextOpen 返回 now 之后最早可以下发的时间，now 在窗口内或没有窗口时返回 now
+//
+// 策略需先通过 Validate 校验。
+func (p *MaintenancePolicy) NextOpen(now time.Time) time.Time {
+	if p == nil || len(p.Windows) == 0 {
+		return now
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return now
+	}
+
+	local := now.In(loc)
+	var next time.Time
+	// 从前一天开始检查，覆盖跨越午夜、仍未结束的窗口
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		for _, w := range p.Windows {
+			if !w.onDay(day.Weekday()) {
+				continue
+			}
+			startMin, _ := parseClock(w.Start)
+			endMin, _ := parseClock(w.End)
+			start := time.Date(day.Year(), day.Month(), day.Day(), startMin/60, startMin%60, 0, 0, loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(), endMin/60, endMin%60, 0, 0, loc)
+			if !end.After(start) {
+				end = end.AddDate(0, 0, 1)
+			}
+			if !now.Before(start) && now.Before(end) {
+				return now
+			}
+			if start.After(now) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	if next.IsZero() {
+		return now
+	}
+	return next
+}
+
+func (w MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
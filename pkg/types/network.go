@@ -0,0 +1,24 @@
+package types
+
+import "fmt"
+
+// NetworkSettings 租户网络的默认参数，节点和链路上的设置优先，未设置的字段使用服务端配置
+type NetworkSettings struct {
+	MTU          int                   `json:"mtu,omitempty"`           // 未设置 MTU 的节点使用的隧道 MTU，0 表示使用 network.mtu
+	Keepalive    *int                  `json:"keepalive,omitempty"`     // 链路的 PersistentKeepalive（秒），0 表示不设置，为空时使用 network.keepalive
+	BabelOptions BabelInterfaceOptions `json:"babel_options,omitempty"` // 各链路 babeld 接口参数的默认值，节点和链路上的设置覆盖该值
+}
+
+// Validate 校验网络设置
+func (s *NetworkSettings) Validate() error {
+	if s.MTU != 0 && (s.MTU < 1280 || s.MTU > 9000) {
+		return fmt.Errorf("mtu out of range: %d", s.MTU)
+	}
+	if s.Keepalive != nil && (*s.Keepalive < 0 || *s.Keepalive > 65535) {
+		return fmt.Errorf("keepalive out of range: %d", *s.Keepalive)
+	}
+	if err := s.BabelOptions.Validate(); err != nil {
+		return fmt.Errorf("babel_options: %w", err)
+	}
+	return nil
+}
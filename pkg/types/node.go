@@ -1,20 +1,34 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // NodeConfig 节点配置
 type NodeConfig struct {
 	ID        int       `gorm:"primarykey;autoIncrement" json:"id"` // 节点ID
 	CreatedAt time.Time `json:"created_at"`                         // 创建时间
 	UpdatedAt time.Time `json:"updated_at"`                         // 更新时间
+	TenantID  int       `gorm:"index" json:"tenant_id"`             // 所属租户
 	Name      string    `gorm:"size:255" json:"name"`               // 节点名称
 	Token     string    `gorm:"size:255" json:"token"`              // 认证令牌
 
+	// 客户端证书，由内置 CA 签发，重新签发后旧证书失效
+	CertSerial    string     `gorm:"size:64" json:"cert_serial,omitempty"` // 当前有效证书的序列号
+	CertExpiresAt *time.Time `json:"cert_expires_at,omitempty"`            // 当前证书的过期时间
+
+	BootstrappedAt *time.Time `json:"bootstrapped_at,omitempty"` // 首次订阅任务、下发初始配置的时间，为空表示 agent 尚未连接过
+
+	// 地址规划：地址模板中的 {node}、{peer} 替换为节点的地址编号而不是节点 ID，修改编号即可为节点重新编址，
+	// 见 /addressing。创建节点时默认与节点 ID 相同，为 0 的旧记录按节点 ID 处理
+	AddressIndex int `gorm:"not null;default:0;index" json:"address_index"`
+
 	// 网络配置
 	IPv4       string `gorm:"size:45" json:"ipv4"`         // IPv4地址
 	IPv6       string `gorm:"size:45" json:"ipv6"`         // IPv6地址
 	Peers      string `gorm:"type:text" json:"peers"`      // 对等节点列表(JSON)
-	Endpoints  string `gorm:"type:text" json:"endpoints"`  // 可访问的端点(JSON)
+	Endpoints  string `gorm:"type:text" json:"endpoints"`  // 可访问的端点(JSON)，每项为 host 或 host:port，带端口时对端总是连接该端口
 	PublicKey  string `gorm:"size:255" json:"public_key"`  // WireGuard公钥
 	PrivateKey string `gorm:"size:255" json:"private_key"` // WireGuard私钥
 
@@ -28,20 +42,90 @@ type NodeConfig struct {
 	LinkLocalNet  string `gorm:"size:45" json:"link_local_net"` // 链路本地网络
 	BabelPort     int    `json:"babel_port"`                    // Babeld端口
 	BabelInterval int    `json:"babel_interval"`                // Babeld更新间隔
+	AllowedPorts  string `gorm:"size:255" json:"allowed_ports"` // 防火墙允许的 UDP 端口，如 51820-51830,443，为空时不限制
+
+	BabelOptions BabelInterfaceOptions `gorm:"serializer:json;type:text" json:"babel_options"` // 节点所有 babeld 接口的默认参数，可被链路覆盖
+
+	TrafficQuota TrafficQuota `gorm:"serializer:json;type:text" json:"traffic_quota"` // 月流量配额
+	QuotaStatus  QuotaStatus  `gorm:"serializer:json;type:text" json:"quota_status"`  // 当月配额告警状态，由服务端维护
+
+	Tags []string `gorm:"serializer:json;type:text" json:"tags"` // 访问控制策略使用的标签
+
+	Capabilities []Capability `gorm:"serializer:json;type:text" json:"capabilities"` // agent 注册时上报的本地工具探测结果
+
+	Firewall *FirewallPolicy `gorm:"-" json:"firewall,omitempty"` // 由租户访问控制策略编译的防火墙规则，只在下发的配置中生成
+
+	Routing *RoutingPolicy  `gorm:"-" json:"routing,omitempty"` // 策略路由设置，只在下发的配置中生成，不持久化
+	Links   []LinkEndpoints `gorm:"-" json:"links,omitempty"`   // 各链路对端的候选端点，只在下发的配置中生成
+
+	DelegatedPrefix string `gorm:"-" json:"delegated_prefix,omitempty"` // 委派给节点下游局域网的 IPv6 前缀，由节点 ID 计算，不持久化
+	BGP             string `gorm:"-" json:"bgp,omitempty"`              // 边界节点的 BIRD 配置片段，只在下发的配置中生成
+
+	// 路由守护进程及其配置，只在下发的配置中生成；守护进程为 babeld 时配置在 Babel 字段中
+	RoutingDaemon string        `gorm:"-" json:"routing_daemon,omitempty"`
+	Bird          string        `gorm:"-" json:"bird,omitempty"`          // BIRD 路由配置片段
+	StaticRoutes  []StaticRoute `gorm:"-" json:"static_routes,omitempty"` // 静态路由
+
+	// 备注信息
+	NodeMetadata `gorm:"embedded"`
 
 	Status NodeStatus `gorm:"foreignKey:NodeID;references:ID;onUpdate:CASCADE" json:"status"`
 }
 
-// NodeStatus 节点状态
+// AddressNumber 返回替换地址模板中 {node}、{peer} 的编号
+func (n *NodeConfig) AddressNumber() int {
+	if n.AddressIndex > 0 {
+		return n.AddressIndex
+	}
+	return n.ID
+}
+
+// NodeMetadata 节点备注信息
+type NodeMetadata struct {
+	Description string            `gorm:"type:text" json:"description"`              // 描述
+	Contact     string            `gorm:"size:255" json:"contact"`                   // 联系人
+	Latitude    *float64          `json:"latitude"`                                  // 纬度
+	Longitude   *float64          `json:"longitude"`                                 // 经度
+	Metadata    map[string]string `gorm:"serializer:json;type:text" json:"metadata"` // 自定义键值对
+}
+
+// Validate 校验备注信息
+func (m *NodeMetadata) Validate() error {
+	if (m.Latitude == nil) != (m.Longitude == nil) {
+		return fmt.Errorf("latitude and longitude must be set together")
+	}
+	if m.Latitude != nil && (*m.Latitude < -90 || *m.Latitude > 90) {
+		return fmt.Errorf("latitude out of range: %f", *m.Latitude)
+	}
+	if m.Longitude != nil && (*m.Longitude < -180 || *m.Longitude > 180) {
+		return fmt.Errorf("longitude out of range: %f", *m.Longitude)
+	}
+	for k := range m.Metadata {
+		if k == "" {
+			return fmt.Errorf("metadata key cannot be empty")
+		}
+	}
+	return nil
+}
+
+// HasLocation 是否设置了地理位置
+func (m *NodeMetadata) HasLocation() bool {
+	return m.Latitude != nil && m.Longitude != nil
+}
+
+// NodeStatus 节点状态，与 status.proto 中的 NodeStatus 一一对应，转换见 NodeStatusFromProto
 type NodeStatus struct {
-	NodeID       int           `gorm:"primarykey" json:"node_id"`
-	Hostname     string        `gorm:"type:varchar(255)" json:"hostname"`
-	IPAddress    string        `gorm:"type:varchar(255)" json:"ip_address"`
-	Metrics      SystemMetrics `gorm:"embedded" json:"metrics"`
-	RunningTasks []string      `gorm:"type:json" json:"running_tasks"`
-	Status       string        `gorm:"type:varchar(50)" json:"status"`
-	Version      string        `gorm:"type:varchar(50)" json:"version"`
-	Timestamp    time.Time     `gorm:"autoUpdateTime" json:"timestamp"`
+	NodeID       int              `gorm:"primarykey" json:"node_id"`
+	Hostname     string           `gorm:"type:varchar(255)" json:"hostname"`
+	IPAddress    string           `gorm:"type:varchar(255)" json:"ip_address"`
+	Metrics      SystemMetrics    `gorm:"embedded" json:"metrics"`
+	RunningTasks []string         `gorm:"type:text;serializer:json" json:"running_tasks"`
+	Status       string           `gorm:"type:varchar(50)" json:"status"`
+	Version      string           `gorm:"type:varchar(50)" json:"version"`
+	WireGuard    WireGuardStatus  `gorm:"type:text;serializer:json" json:"wireguard"`
+	Babel        BabelStatus      `gorm:"type:text;serializer:json" json:"babel"`
+	Software     SoftwareVersions `gorm:"type:text;serializer:json" json:"software"`
+	Timestamp    time.Time        `gorm:"autoUpdateTime" json:"timestamp"`
 }
 
 // SystemMetrics 系统指标
@@ -50,4 +134,87 @@ type SystemMetrics struct {
 	MemoryUsage float64 `gorm:"type:decimal(5,2)" json:"memory_usage"`
 	DiskUsage   float64 `gorm:"type:decimal(5,2)" json:"disk_usage"`
 	Uptime      int64   `gorm:"type:bigint" json:"uptime"`
+
+	// agent 运行在设有 CPU 或内存限额的 cgroup v2 中时，CPU 和内存使用率相对于限额统计
+	Cgroup       bool    `json:"cgroup"`
+	CPULimit     float64 `gorm:"type:decimal(8,2)" json:"cpu_limit"`     // CPU 限额（核数），0 表示不限
+	MemoryLimit  int64   `gorm:"type:bigint" json:"memory_limit"`        // 内存限额（字节），0 表示不限
+	CPUThrottled float64 `gorm:"type:decimal(5,2)" json:"cpu_throttled"` // 采样期间被限流的调度周期占比（%）
+}
+
+// SoftwareVersions 节点的系统和网络组件版本，无法获取的项为空
+type SoftwareVersions struct {
+	OS              string `json:"os"`               // 发行版及版本，如 debian 12.5
+	Kernel          string `json:"kernel"`           // 内核版本
+	WireGuardTools  string `json:"wireguard_tools"`  // wg 命令的版本
+	WireGuardModule string `json:"wireguard_module"` // WireGuard 内核模块的版本，内置于内核时为空
+	Babeld          string `json:"babeld"`
+}
+
+// WireGuardStatus WireGuard 状态
+type WireGuardStatus struct {
+	Peers []WireGuardPeerStatus `json:"peers"`
+}
+
+// WireGuardPeerStatus WireGuard 对等节点状态
+type WireGuardPeerStatus struct {
+	Interface       string     `json:"interface"`
+	PublicKey       string     `json:"public_key"`
+	Endpoint        string     `json:"endpoint"`
+	LatestHandshake *time.Time `json:"latest_handshake"` // 从未握手时为空
+	RxBytes         int64      `json:"rx_bytes"`
+	TxBytes         int64      `json:"tx_bytes"`
+}
+
+// BabelStatus Babel 状态
+type BabelStatus struct {
+	Running    bool             `json:"running"`
+	Neighbours []BabelNeighbour `json:"neighbours"`
+}
+
+// BabelNeighbour Babel 邻居
+type BabelNeighbour struct {
+	Address   string `json:"address"`
+	Interface string `json:"interface"`
+	PublicKey string `json:"public_key"` // 接口上 WireGuard 对等节点的公钥
+	Reach     int    `json:"reach"`
+	RxCost    int    `json:"rxcost"`
+	TxCost    int    `json:"txcost"`
+	Cost      int    `json:"cost"`
+}
+
+// NodeSummary 节点摘要，仅包含列表展示所需的轻量字段
+type NodeSummary struct {
+	ID       int        `json:"id"`        // 节点ID
+	TenantID int        `json:"tenant_id"` // 所属租户
+	Name     string     `json:"name"`      // 节点名称
+	Status   string     `json:"status"`    // 节点状态
+	LastSeen *time.Time `json:"last_seen"` // 最后上报时间
+	Version  string     `json:"version"`   // Agent版本
+}
+
+// AddressAssignment 地址规划中的一项：节点的地址编号及由此生成的节点地址
+type AddressAssignment struct {
+	NodeID          int    `json:"node_id"`
+	Name            string `json:"name"`
+	AddressIndex    int    `json:"address_index"`              // 替换地址模板中 {node}、{peer} 的编号
+	IPv4            string `json:"ipv4"`                       // 按 network.ipv4_node_template 生成的节点地址
+	IPv6            string `json:"ipv6"`                       // 按 network.ipv6_node_template 生成的节点地址
+	DelegatedPrefix string `json:"delegated_prefix,omitempty"` // 委派前缀，未启用前缀委派时为空
+}
+
+// NodeInventory 节点资产清单条目，用于合规审计和资产登记导出，不含令牌和私钥
+type NodeInventory struct {
+	ID        int        `json:"id"`         // 节点ID
+	Name      string     `json:"name"`       // 节点名称
+	IPv4      string     `json:"ipv4"`       // IPv4地址
+	IPv6      string     `json:"ipv6"`       // IPv6地址
+	Endpoints []string   `json:"endpoints"`  // 可访问的端点
+	PublicKey string     `json:"public_key"` // WireGuard公钥
+	Status    string     `json:"status"`     // 节点状态
+	Version   string     `json:"version"`    // Agent版本
+	LastSeen  *time.Time `json:"last_seen"`  // 最后上报时间，从未上报时为空
+	Uptime    int64      `json:"uptime"`     // 最后上报时的运行时长（秒）
+
+	SoftwareVersions // 最后上报的系统和组件版本
 }
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange 闭区间端口范围
+type PortRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// PortRanges 端口白名单，为空时不限制
+type PortRanges []PortRange
+
+// ParsePortRanges 解析逗号分隔的端口列表，如 "51820-51830,443"
+func ParsePortRanges(s string) (PortRanges, error) {
+	var ranges PortRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(endStr)); err != nil {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		ranges = append(ranges, PortRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// Allows 端口是否在白名单内，白名单为空时总是允许
+func (r PortRanges) Allows(port int) bool {
+	if len(r) == 0 {
+		return true
+	}
+	for _, pr := range r {
+		if port >= pr.Start && port <= pr.End {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedPortRanges 解析节点的端口白名单
+func (n *NodeConfig) AllowedPortRanges() (PortRanges, error) {
+	ranges, err := ParsePortRanges(n.AllowedPorts)
+	if err != nil {
+		return nil, fmt.Errorf("node %d allowed_ports: %w", n.ID, err)
+	}
+	return ranges, nil
+}
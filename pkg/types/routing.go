@@ -0,0 +1,130 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// RoutingPolicy 节点的策略路由设置，随节点配置下发，由 agent 安装 ip rule
+type RoutingPolicy struct {
+	Table  int      `json:"table"`            // mesh 路由所在的路由表，0 表示使用主路由表，不安装规则
+	FwMark string   `json:"fwmark,omitempty"` // WireGuard 为加密后的隧道报文设置的标记
+	Rules  []IPRule `json:"rules"`            // 需要安装的 ip rule
+}
+
+// IPRule 一条 ip rule
+type IPRule struct {
+	Priority             int    `json:"priority"`                        // 规则优先级，数值越小越先匹配
+	Not                  bool   `json:"not,omitempty"`                   // 反转选择器，如 not fwmark
+	From                 string `json:"from,omitempty"`                  // 源地址前缀
+	To                   string `json:"to,omitempty"`                    // 目的地址前缀
+	FwMark               string `json:"fwmark,omitempty"`                // 匹配的防火墙标记，如 0xca6c
+	IPv6                 bool   `json:"ipv6,omitempty"`                  // 没有地址前缀的规则所属的地址族
+	Table                int    `json:"table"`                           // 查询的路由表
+	SuppressPrefixLength *int   `json:"suppress_prefixlength,omitempty"` // 忽略前缀长度不大于该值的路由，0 表示忽略默认路由
+}
+
+// RouteTableMain 内核主路由表
+const RouteTableMain = 254
+
+// Family 返回规则的地址族参数（-4 或 -6），From 和 To 都为空时按 IPv6 字段决定
+func (r IPRule) Family() string {
+	for _, prefix := range []string{r.From, r.To} {
+		if prefix == "" {
+			continue
+		}
+		ip, _, err := net.ParseCIDR(prefix)
+		if err != nil {
+			ip = net.ParseIP(prefix)
+		}
+		if ip != nil && ip.To4() == nil {
+			return "-6"
+		}
+		return "-4"
+	}
+	if r.IPv6 {
+		return "-6"
+	}
+	return "-4"
+}
+
+// Args 返回 ip rule add/del 使用的选择器和动作参数
+func (r IPRule) Args() []string {
+	var args []string
+	if r.Not {
+		args = append(args, "not")
+	}
+	if r.Priority > 0 {
+		args = append(args, "priority", strconv.Itoa(r.Priority))
+	}
+	if r.From != "" {
+		args = append(args, "from", r.From)
+	}
+	if r.To != "" {
+		args = append(args, "to", r.To)
+	}
+	if r.FwMark != "" {
+		args = append(args, "fwmark", r.FwMark)
+	}
+	args = append(args, "lookup", strconv.Itoa(r.Table))
+	if r.SuppressPrefixLength != nil {
+		args = append(args, "suppress_prefixlength", strconv.Itoa(*r.SuppressPrefixLength))
+	}
+	return args
+}
+
+// String 返回规则的文本形式，与 ip rule 的参数一致
+func (r IPRule) String() string {
+	s := r.Family()
+	for _, arg := range r.Args() {
+		s += " " + arg
+	}
+	return s
+}
+
+// Validate 校验规则
+func (r IPRule) Validate() error {
+	if r.Table <= 0 {
+		return fmt.Errorf("invalid rule table: %d", r.Table)
+	}
+	for _, prefix := range []string{r.From, r.To} {
+		if prefix == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(prefix); err != nil && net.ParseIP(prefix) == nil {
+			return fmt.Errorf("invalid rule prefix: %s", prefix)
+		}
+	}
+	if r.FwMark != "" {
+		if _, err := strconv.ParseUint(r.FwMark, 0, 32); err != nil {
+			return fmt.Errorf("invalid rule fwmark: %s", r.FwMark)
+		}
+	}
+	if r.SuppressPrefixLength != nil && (*r.SuppressPrefixLength < 0 || *r.SuppressPrefixLength > 128) {
+		return fmt.Errorf("invalid rule suppress_prefixlength: %d", *r.SuppressPrefixLength)
+	}
+	return nil
+}
+
+// 路由守护进程，按租户选择
+const (
+	RoutingDaemonBabeld    = "babeld"     // babeld，默认
+	RoutingDaemonBirdBabel = "bird-babel" // BIRD 2 的 babel 协议
+	RoutingDaemonBirdOSPF  = "bird-ospf"  // BIRD 2 的 OSPFv2/OSPFv3
+	RoutingDaemonStatic    = "static"     // agent 为直连的对等节点安装静态路由，只适用于全互联拓扑
+)
+
+// RoutingDaemons 可选的路由守护进程
+var RoutingDaemons = []string{RoutingDaemonBabeld, RoutingDaemonBirdBabel, RoutingDaemonBirdOSPF, RoutingDaemonStatic}
+
+// IsBird 路由守护进程是否由 BIRD 实现
+func IsBird(daemon string) bool {
+	return daemon == RoutingDaemonBirdBabel || daemon == RoutingDaemonBirdOSPF
+}
+
+// StaticRoute 路由守护进程为 static 时 agent 安装的一条静态路由
+type StaticRoute struct {
+	Prefix    string `json:"prefix"`
+	Interface string `json:"interface"` // 不含前缀的 WireGuard 接口名
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 服务端在节点配置响应中附带的签名相关响应头
+const (
+	ConfigSignatureHeader = "X-Config-Signature" // 对 ConfigSignedMessage 的 Ed25519 签名（base64）
+	ConfigNodeHeader      = "X-Config-Node"      // 配置所属的节点 ID
+	ConfigIssuedAtHeader  = "X-Config-Issued-At" // 配置的签发时间（Unix 纳秒），agent 据此拒绝比已应用配置更旧的配置
+)
+
+// ConfigMeta 与配置响应体一起签名的元数据，使签名绑定到节点和签发时间，防止重放其他节点或更旧的配置
+type ConfigMeta struct {
+	NodeID   int
+	IssuedAt time.Time
+}
+
+// ConfigSignedMessage 返回签名覆盖的内容：元数据和完整的响应体
+func ConfigSignedMessage(meta ConfigMeta, body []byte) []byte {
+	msg := fmt.Appendf(nil, "mesh-config-v1\nnode=%d\nissued_at=%d\n", meta.NodeID, meta.IssuedAt.UnixNano())
+	return append(msg, body...)
+}
+
+// ParseConfigMeta 从响应头中读取签名的元数据
+func ParseConfigMeta(nodeID, issuedAt string) (ConfigMeta, error) {
+	id, err := strconv.Atoi(nodeID)
+	if err != nil {
+		return ConfigMeta{}, fmt.Errorf("invalid %s header %q", ConfigNodeHeader, nodeID)
+	}
+	nanos, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil {
+		return ConfigMeta{}, fmt.Errorf("invalid %s header %q", ConfigIssuedAtHeader, issuedAt)
+	}
+	return ConfigMeta{NodeID: id, IssuedAt: time.Unix(0, nanos)}, nil
+}
+
+// ParseConfigPublicKey 解析 base64 编码的 Ed25519 公钥
+func ParseConfigPublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyConfigSignature 校验配置响应的签名，签名需同时覆盖元数据和响应体
+func VerifyConfigSignature(key ed25519.PublicKey, meta ConfigMeta, body []byte, signature string) error {
+	if signature == "" {
+		return errors.New("config is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("decoding config signature: %w", err)
+	}
+	if !ed25519.Verify(key, ConfigSignedMessage(meta, body), sig) {
+		return errors.New("config signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package types
+
+import (
+	"time"
+
+	spb "mesh-backend/api/proto/status"
+)
+
+// NodeStatusFromProto 将上报的 proto 状态转换为存储模型
+func NodeStatusFromProto(status *spb.NodeStatus) *NodeStatus {
+	result := &NodeStatus{
+		NodeID:       int(status.NodeId),
+		Hostname:     status.Hostname,
+		IPAddress:    status.IpAddress,
+		RunningTasks: status.RunningTasks,
+		Status:       status.Status,
+		Version:      status.Version,
+		Timestamp:    time.Unix(0, status.Timestamp),
+	}
+
+	if m := status.Metrics; m != nil {
+		result.Metrics = SystemMetrics{
+			CPUUsage:    m.CpuUsage,
+			MemoryUsage: m.MemoryUsage,
+			DiskUsage:   m.DiskUsage,
+			Uptime:      m.Uptime,
+
+			Cgroup:       m.Cgroup,
+			CPULimit:     m.CpuLimit,
+			MemoryLimit:  m.MemoryLimit,
+			CPUThrottled: m.CpuThrottled,
+		}
+	}
+
+	if sw := status.Software; sw != nil {
+		result.Software = SoftwareVersions{
+			OS:              sw.Os,
+			Kernel:          sw.Kernel,
+			WireGuardTools:  sw.WireguardTools,
+			WireGuardModule: sw.WireguardModule,
+			Babeld:          sw.Babeld,
+		}
+	}
+
+	if wg := status.Wireguard; wg != nil {
+		for _, peer := range wg.Peers {
+			p := WireGuardPeerStatus{
+				Interface: peer.Interface,
+				PublicKey: peer.PublicKey,
+				Endpoint:  peer.Endpoint,
+				RxBytes:   peer.RxBytes,
+				TxBytes:   peer.TxBytes,
+			}
+			if peer.LatestHandshake > 0 {
+				handshake := time.Unix(peer.LatestHandshake, 0)
+				p.LatestHandshake = &handshake
+			}
+			result.WireGuard.Peers = append(result.WireGuard.Peers, p)
+		}
+	}
+
+	if babel := status.Babel; babel != nil {
+		result.Babel.Running = babel.Running
+		for _, n := range babel.Neighbours {
+			result.Babel.Neighbours = append(result.Babel.Neighbours, BabelNeighbour{
+				Address:   n.Address,
+				Interface: n.Interface,
+				PublicKey: n.PublicKey,
+				Reach:     int(n.Reach),
+				RxCost:    int(n.Rxcost),
+				TxCost:    int(n.Txcost),
+				Cost:      int(n.Cost),
+			})
+		}
+	}
+
+	return result
+}
+
+// Proto 将存储模型转换为 proto 状态
+func (s *NodeStatus) Proto() *spb.NodeStatus {
+	result := &spb.NodeStatus{
+		NodeId:       int32(s.NodeID),
+		Hostname:     s.Hostname,
+		IpAddress:    s.IPAddress,
+		RunningTasks: s.RunningTasks,
+		Status:       s.Status,
+		Version:      s.Version,
+		Timestamp:    s.Timestamp.UnixNano(),
+		Metrics: &spb.SystemMetrics{
+			CpuUsage:    s.Metrics.CPUUsage,
+			MemoryUsage: s.Metrics.MemoryUsage,
+			DiskUsage:   s.Metrics.DiskUsage,
+			Uptime:      s.Metrics.Uptime,
+
+			Cgroup:       s.Metrics.Cgroup,
+			CpuLimit:     s.Metrics.CPULimit,
+			MemoryLimit:  s.Metrics.MemoryLimit,
+			CpuThrottled: s.Metrics.CPUThrottled,
+		},
+		Software: &spb.SoftwareVersions{
+			Os:              s.Software.OS,
+			Kernel:          s.Software.Kernel,
+			WireguardTools:  s.Software.WireGuardTools,
+			WireguardModule: s.Software.WireGuardModule,
+			Babeld:          s.Software.Babeld,
+		},
+		Wireguard: &spb.WireGuardStatus{},
+		Babel:     &spb.BabelStatus{Running: s.Babel.Running},
+	}
+
+	for _, peer := range s.WireGuard.Peers {
+		p := &spb.WireGuardPeer{
+			Interface: peer.Interface,
+			PublicKey: peer.PublicKey,
+			Endpoint:  peer.Endpoint,
+			RxBytes:   peer.RxBytes,
+			TxBytes:   peer.TxBytes,
+		}
+		if peer.LatestHandshake != nil {
+			p.LatestHandshake = peer.LatestHandshake.Unix()
+		}
+		result.Wireguard.Peers = append(result.Wireguard.Peers, p)
+	}
+
+	for _, n := range s.Babel.Neighbours {
+		result.Babel.Neighbours = append(result.Babel.Neighbours, &spb.BabelNeighbour{
+			Address:   n.Address,
+			Interface: n.Interface,
+			PublicKey: n.PublicKey,
+			Reach:     int32(n.Reach),
+			Rxcost:    int32(n.RxCost),
+			Txcost:    int32(n.TxCost),
+			Cost:      int32(n.Cost),
+		})
+	}
+
+	return result
+}
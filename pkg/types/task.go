@@ -8,8 +8,42 @@ type TaskType string
 const (
 	TaskTypeUpdate TaskType = "update" // 更新配置
 	TaskTypeStatus TaskType = "status" // 状态报告
+
+	TaskTypeBandwidthTest TaskType = "bandwidth_test" // 节点间吞吐量测试
+	TaskTypeTraceroute    TaskType = "traceroute"     // 网格内路径探测
+	TaskTypeCapture       TaskType = "capture"        // 网格接口抓包
+	TaskTypeLogLevel      TaskType = "log_level"      // 临时调整 agent 日志级别
+	TaskTypeGC            TaskType = "gc"             // 清理配置中已不存在的 WireGuard 接口
 )
 
+// Retriable 失败后是否自动重试，诊断类任务的结果只在发起时有意义，失败后不重试
+func (t TaskType) Retriable() bool {
+	switch t {
+	case TaskTypeUpdate, TaskTypeStatus:
+		return true
+	default:
+		return false
+	}
+}
+
+// LogLevelParams 日志级别任务参数
+type LogLevelParams struct {
+	Level    string `json:"level"`    // zerolog 日志级别，如 debug
+	Duration int    `json:"duration"` // 生效时长（秒），到期后恢复 agent.yaml 中的级别
+}
+
+// GCParams 接口清理任务参数
+type GCParams struct {
+	DryRun bool `json:"dry_run"` // 只列出要清理的接口，不删除
+	Force  bool `json:"force"`   // 同时清理不在 agent 状态文件中的同前缀接口，默认保留
+}
+
+// GCResult 接口清理任务结果
+type GCResult struct {
+	Removed   []string `json:"removed"`             // 已删除（dry_run 时为将要删除）的接口
+	Unmanaged []string `json:"unmanaged,omitempty"` // 未设置 force 时保留的、不由 agent 管理的孤立接口
+}
+
 // TaskStatus 定义任务状态
 type TaskStatus string
 
@@ -19,6 +53,8 @@ const (
 	TaskStatusSuccess  TaskStatus = "success"  // 执行成功
 	TaskStatusFailed   TaskStatus = "failed"   // 执行失败
 	TaskStatusCanceled TaskStatus = "canceled" // 已取消
+
+	TaskStatusDeadLetter TaskStatus = "dead_letter" // 重试耗尽，等待人工处理
 )
 
 // Task 定义任务结构
@@ -28,6 +64,9 @@ type Task struct {
 	Type        TaskType   `gorm:"size:50" json:"type"`                         // 任务类型
 	Status      TaskStatus `gorm:"size:50" json:"status"`                       // 任务状态
 	Message     string     `gorm:"type:text" json:"message"`                    // 任务消息
+	Params      string     `gorm:"type:text" json:"params"`                     // 任务参数(JSON)
+	Result      string     `gorm:"type:text" json:"result"`                     // agent 回报的执行结果(JSON)
+	Attempts    int        `json:"attempts"`                                    // 已执行失败的次数
 	CreatedAt   time.Time  `json:"created_at"`                                  // 创建时间
 	UpdatedAt   time.Time  `json:"updated_at"`                                  // 更新时间
 	StartedAt   *time.Time `json:"started_at"`                                  // 开始时间
@@ -45,6 +84,27 @@ type TaskResult struct {
 	Timestamp time.Time  `json:"timestamp"`                // 时间戳
 }
 
+// 配置更新钩子的执行阶段
+const (
+	HookPreApply  = "pre_apply"  // 写入配置之前，失败时不更新配置
+	HookPostApply = "post_apply" // 写入配置之后，无论更新是否成功都会执行
+)
+
+// HookResult 一次钩子脚本的执行结果
+type HookResult struct {
+	Phase      string  `json:"phase"`
+	Path       string  `json:"path"`
+	ExitCode   int     `json:"exit_code"`       // 进程退出码，未能启动或超时时为 -1
+	Output     string  `json:"output"`          // 标准输出和标准错误，超长时只保留末尾
+	Error      string  `json:"error,omitempty"` // 启动失败、超时或退出码非零的原因
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// ConfigUpdateResult 配置更新任务结果
+type ConfigUpdateResult struct {
+	Hooks []HookResult `json:"hooks,omitempty"` // 按执行顺序排列的钩子结果
+}
+
 // TaskHandler 定义任务处理器接口
 type TaskHandler interface {
 	// Handle 处理任务
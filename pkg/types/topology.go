@@ -0,0 +1,121 @@
+package types
+
+import "time"
+
+// TopologyLink 拓扑规划中的一条链路
+type TopologyLink struct {
+	NodeID     int      `json:"node_id"`               // 节点ID（较小者）
+	PeerID     int      `json:"peer_id"`               // 对等节点ID（较大者）
+	DistanceKm *float64 `json:"distance_km,omitempty"` // 两节点间的地理距离
+	Reason     string   `json:"reason"`                // 建立链路的原因 (nearest, backbone)
+}
+
+// TopologyPlan 拓扑规划
+type TopologyPlan struct {
+	Links    []TopologyLink `json:"links"`    // 需要启用的链路
+	Unplaced []int          `json:"unplaced"` // 无法规划链路的节点
+}
+
+// NodeHealthState 节点健康状态
+type NodeHealthState string
+
+const (
+	NodeHealthOnline   NodeHealthState = "online"   // 按时上报且对端握手正常
+	NodeHealthDegraded NodeHealthState = "degraded" // 按时上报，但有在线对端报告与其握手过期
+	NodeHealthOffline  NodeHealthState = "offline"  // 未按时上报
+)
+
+// LinkHealthState 链路健康状态
+type LinkHealthState string
+
+const (
+	LinkHealthUp      LinkHealthState = "up"      // 两端握手均未过期
+	LinkHealthOneWay  LinkHealthState = "one_way" // 仅一端握手未过期，通常是单向连通
+	LinkHealthDown    LinkHealthState = "down"    // 两端握手均已过期
+	LinkHealthUnknown LinkHealthState = "unknown" // 至少一端离线，无法判断
+)
+
+// LinkView 链路一端上报的握手情况
+type LinkView struct {
+	Reported        bool       `json:"reported"`         // 该端是否上报了这条链路的对等节点
+	LatestHandshake *time.Time `json:"latest_handshake"` // 最近握手时间
+	Fresh           bool       `json:"fresh"`            // 握手是否未过期
+}
+
+// LinkHealth 链路健康状况，由两端的上报共同得出
+type LinkHealth struct {
+	NodeID   int             `json:"node_id"`   // 节点ID（较小者）
+	PeerID   int             `json:"peer_id"`   // 对等节点ID（较大者）
+	Health   LinkHealthState `json:"health"`    // 健康状态
+	NodeView LinkView        `json:"node_view"` // 节点一端的握手情况
+	PeerView LinkView        `json:"peer_view"` // 对等节点一端的握手情况
+}
+
+// NodeHealth 节点健康状况
+type NodeHealth struct {
+	NodeID     int             `json:"node_id"`
+	Name       string          `json:"name"`
+	Health     NodeHealthState `json:"health"`
+	LastSeen   *time.Time      `json:"last_seen"`             // 最近一次上报时间
+	StalePeers []int           `json:"stale_peers,omitempty"` // 报告与本节点握手过期的在线对端
+}
+
+// MeshHealth 网格健康状况
+type MeshHealth struct {
+	Nodes []NodeHealth `json:"nodes"`
+	Links []LinkHealth `json:"links"`
+}
+
+// MeshSummary 控制台概览页使用的网格汇总指标
+type MeshSummary struct {
+	Nodes struct {
+		Total    int `json:"total"`
+		Online   int `json:"online"`   // 包括 degraded
+		Degraded int `json:"degraded"` // 有在线对端报告与其握手过期
+		Offline  int `json:"offline"`
+	} `json:"nodes"`
+	Links struct {
+		Total     int `json:"total"`     // 启用的主链路
+		Unhealthy int `json:"unhealthy"` // 状态为 one_way 或 down 的链路
+	} `json:"links"`
+	Tasks struct {
+		Pending int `json:"pending"` // 最近 24 小时内创建、仍在等待执行的任务
+		Failed  int `json:"failed"`  // 最近 24 小时内创建、执行失败的任务
+	} `json:"tasks"`
+	AvgCPUUsage    float64 `json:"avg_cpu_usage"`    // 在线节点的平均 CPU 使用率
+	AvgMemoryUsage float64 `json:"avg_memory_usage"` // 在线节点的平均内存使用率
+	DriftedNodes   int     `json:"drifted_nodes"`    // 配置落后于最新变更的节点数
+}
+
+// NodeOverview 控制台节点详情页的汇总信息，节点配置中不含令牌和私钥
+type NodeOverview struct {
+	Node        *NodeConfig `json:"node"`
+	Status      *NodeStatus `json:"status"` // 最近一次上报的状态，从未上报时为空
+	Health      NodeHealth  `json:"health"`
+	Connections []NodeLink  `json:"connections"`
+	RecentTasks []*Task     `json:"recent_tasks"` // 最近的任务，按创建时间降序
+}
+
+// NodeLink 节点参与的一条连接及其健康状况
+type NodeLink struct {
+	ConnectionInfo
+	Health LinkHealthState `json:"health,omitempty"` // 只有启用的主链路有健康状况
+}
+
+// AdjacencyEvent Babel 邻接缺失事件：拓扑中启用的链路在节点上报的 babeld 邻居中缺失超过阈值
+type AdjacencyEvent struct {
+	TenantID     int        `json:"-"`
+	NodeID       int        `json:"node_id"`       // 缺少邻居的节点
+	PeerID       int        `json:"peer_id"`       // 期望的邻居节点
+	TunnelUp     bool       `json:"tunnel_up"`     // WireGuard 握手是否正常，为 true 时说明隧道已通但未参与路由
+	MissingSince time.Time  `json:"missing_since"` // 首次发现缺失的时间
+	RaisedAt     time.Time  `json:"raised_at"`     // 产生事件的时间
+	ResolvedAt   *time.Time `json:"resolved_at"`   // 邻居恢复的时间，未恢复时为空
+}
+
+// ReachabilityReport 拓扑变更前后的连通性分析
+type ReachabilityReport struct {
+	Partitioned bool    `json:"partitioned"` // 变更是否使原本互通的节点失去连通
+	Components  [][]int `json:"components"`  // 变更后的连通分量，按节点数降序
+	Isolated    []int   `json:"isolated"`    // 变更前互通、变更后与所在网络的最大部分断开的节点
+}
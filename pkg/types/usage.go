@@ -0,0 +1,45 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// UsageDateLayout 流量统计的日期格式，按 UTC 划分
+const UsageDateLayout = "2006-01-02"
+
+// QuotaPeriodLayout 流量配额的统计周期，按 UTC 自然月
+const QuotaPeriodLayout = "2006-01"
+
+// TrafficUsage 节点到对端链路某一天的流量，收发字节数以节点一侧为准
+type TrafficUsage struct {
+	ID        int       `gorm:"primarykey;autoIncrement" json:"-"`
+	TenantID  int       `gorm:"index" json:"tenant_id"`                             // 所属租户
+	NodeID    int       `gorm:"uniqueIndex:idx_usage_link_day" json:"node_id"`      // 节点ID
+	PeerID    int       `gorm:"uniqueIndex:idx_usage_link_day" json:"peer_id"`      // 对端节点ID，按节点汇总时为 0
+	Date      string    `gorm:"size:10;uniqueIndex:idx_usage_link_day" json:"date"` // 日期 YYYY-MM-DD
+	RxBytes   int64     `json:"rx_bytes"`                                           // 接收字节数
+	TxBytes   int64     `json:"tx_bytes"`                                           // 发送字节数
+	UpdatedAt time.Time `json:"updated_at"`                                         // 最后累加时间
+}
+
+// TrafficQuota 节点的月流量配额
+type TrafficQuota struct {
+	MonthlyBytes int64 `json:"monthly_bytes"` // 每月收发字节数之和的上限，0 表示不限
+	Deprioritize bool  `json:"deprioritize"`  // 超出配额后提高节点 babeld 接口的 rxcost，使其他节点的流量尽量绕开该节点
+}
+
+// Validate 校验流量配额
+func (q *TrafficQuota) Validate() error {
+	if q.MonthlyBytes < 0 {
+		return fmt.Errorf("monthly_bytes must not be negative")
+	}
+	return nil
+}
+
+// QuotaStatus 节点当月的配额告警状态，进入新的月份时重置
+type QuotaStatus struct {
+	Period        string `json:"period,omitempty"`        // 月份 YYYY-MM
+	Threshold     int    `json:"threshold,omitempty"`     // 本月已告警的最高阈值（配额的百分比）
+	Deprioritized bool   `json:"deprioritized,omitempty"` // 是否已提高 rxcost
+}
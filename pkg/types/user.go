@@ -4,9 +4,48 @@ import "time"
 
 // User 用户模型
 type User struct {
-	ID        int       `json:"id" gorm:"primaryKey"`
-	Username  string    `json:"username" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"` // 密码不会在JSON中返回
+	ID                 int       `json:"id" gorm:"primaryKey"`
+	Username           string    `json:"username" gorm:"unique;not null"`
+	Password           string    `json:"-" gorm:"not null"` // 密码不会在JSON中返回
+	TenantID           int       `json:"tenant_id" gorm:"index"`
+	Role               string    `json:"role"`
+	Provider           string    `json:"provider"`             // 认证来源，本地用户为空
+	MustChangePassword bool      `json:"must_change_password"` // 管理员重置密码后需在下次登录时修改
+	TokenVersion       int       `json:"-"`                    // 修改密码、重置密码或角色时递增，之前签发的 token 随之失效
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+
+	// 两步验证
+	TOTPSecret      string   `json:"-"`
+	TOTPEnabled     bool     `json:"totp_enabled"`
+	TOTPLastCounter int64    `json:"-"`                                  // 最近一次使用的时间步，防止验证码重放
+	RecoveryCodes   []string `json:"-" gorm:"serializer:json;type:text"` // 恢复码哈希
+}
+
+// 用户角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// AuthProviderOIDC 通过 OIDC 登录自动创建的用户
+const AuthProviderOIDC = "oidc"
+
+// DefaultTenantID 默认租户ID，未指定租户的用户和节点均属于默认租户
+const DefaultTenantID = 0
+
+// Tenant 租户，租户之间的用户、节点和网络相互隔离
+type Tenant struct {
+	ID   int    `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"unique;not null"`
+
+	BabelPolicy       *BabelPolicy       `json:"babel_policy,omitempty" gorm:"serializer:json;type:text"`       // 租户网络的 babeld 过滤策略，为空时使用默认策略
+	MaintenancePolicy *MaintenancePolicy `json:"maintenance_policy,omitempty" gorm:"serializer:json;type:text"` // 租户网络的配置下发维护窗口，为空时使用 rollout.maintenance
+	ACLPolicy         *ACLPolicy         `json:"acl_policy,omitempty" gorm:"serializer:json;type:text"`         // 租户网络的访问控制策略，为空时不限制
+	RoutingDaemon     string             `json:"routing_daemon,omitempty" gorm:"size:16"`                       // 租户网络使用的路由守护进程，为空时使用 babeld
+	BGP               *BGPConfig         `json:"bgp,omitempty" gorm:"column:bgp;serializer:json;type:text"`     // 租户网络与上游的 BGP 对接设置，为空时不对接
+	Settings          *NetworkSettings   `json:"settings,omitempty" gorm:"serializer:json;type:text"`           // 租户网络的 MTU、keepalive 和 babeld 默认参数，为空时使用服务端配置
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
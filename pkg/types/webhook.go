@@ -0,0 +1,26 @@
+package types
+
+import "time"
+
+// Webhook 事件
+const (
+	EventNodeCreated  = "node.created"  // 创建节点
+	EventNodeDeleted  = "node.deleted"  // 删除节点
+	EventConfigPushed = "config.pushed" // agent 回报配置更新成功
+	EventTaskFailed   = "task.failed"   // 任务最终失败（不再重试）
+
+	EventQuotaThreshold = "quota.threshold" // 节点当月流量达到配额告警阈值
+	EventClientExpired  = "client.expired"  // 客户端对等节点到期并已移除
+)
+
+// WebhookEvents 所有可订阅的事件
+var WebhookEvents = []string{EventNodeCreated, EventNodeDeleted, EventConfigPushed, EventTaskFailed, EventQuotaThreshold, EventClientExpired}
+
+// WebhookEvent webhook 请求体
+type WebhookEvent struct {
+	ID        string    `json:"id"` // 事件ID，重试时不变，接收方可据此去重
+	Event     string    `json:"event"`
+	TenantID  int       `json:"tenant_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
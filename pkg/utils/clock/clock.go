@@ -0,0 +1,199 @@
+// Package clock 提供可替换的时间源，便于在测试中控制时间流逝
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 时间源
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker 周期触发器
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer 延迟执行的定时器
+type Timer interface {
+	Stop() bool
+}
+
+// Real 返回使用系统时间的时间源
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// Fake 手动推进的时间源，只有调用 Advance 或 Set 时时间才会变化
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter 等待到达指定时间的定时器、触发器或 Sleep
+type waiter struct {
+	at     time.Time
+	period time.Duration // 大于 0 时为周期触发器
+	ch     chan time.Time
+	fn     func()
+}
+
+// NewFake 创建以 now 为初始时间的时间源
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now 返回当前时间
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since 返回自 t 以来经过的时间
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After 返回在 d 之后收到当前时间的通道
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	w := &waiter{ch: make(chan time.Time, 1)}
+	f.add(w, d)
+	return w.ch
+}
+
+// Sleep 阻塞直到时间被推进 d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTicker 创建周期为 d 的触发器
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	w := &waiter{ch: make(chan time.Time, 1), period: d}
+	f.add(w, d)
+	return &fakeTicker{f: f, w: w}
+}
+
+// AfterFunc 在 d 之后执行 fn，fn 在调用 Advance 的协程中同步执行
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &waiter{fn: fn}
+	f.add(w, d)
+	return &fakeTimer{f: f, w: w}
+}
+
+// Advance 将时间推进 d，并触发期间到期的所有定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set 将时间设置为 t，并触发期间到期的所有定时器；t 早于当前时间时不做任何事
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mu.Lock()
+		if t.Before(f.now) {
+			f.mu.Unlock()
+			return
+		}
+		sort.Slice(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+		if len(f.waiters) == 0 || f.waiters[0].at.After(t) {
+			f.now = t
+			f.mu.Unlock()
+			return
+		}
+
+		w := f.waiters[0]
+		f.now = w.at
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+		now := f.now
+		f.mu.Unlock()
+
+		if w.fn != nil {
+			w.fn()
+			continue
+		}
+		// 与 time.Ticker 一致，接收方未及时读取时丢弃本次触发
+		select {
+		case w.ch <- now:
+		default:
+		}
+	}
+}
+
+// Waiters 返回尚未到期的定时器数量，可用于等待被测代码进入等待状态
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// add 登记等待者
+func (f *Fake) add(w *waiter, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.at = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+}
+
+// remove 移除等待者，返回其是否仍在等待
+func (f *Fake) remove(w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, existing := range f.waiters {
+		if existing == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+func (t *fakeTicker) Stop()               { t.f.remove(t.w) }
+
+type fakeTimer struct {
+	f *Fake
+	w *waiter
+}
+
+func (t *fakeTimer) Stop() bool { return t.f.remove(t.w) }
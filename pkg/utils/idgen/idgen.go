@@ -0,0 +1,59 @@
+// Package idgen 提供可替换的ID生成器，便于在测试中得到确定的ID
+package idgen
+
+import (
+	"fmt"
+	"sync"
+
+	"mesh-backend/pkg/utils/clock"
+)
+
+// Generator ID生成器
+type Generator interface {
+	// NewID 生成带前缀的唯一ID
+	NewID(prefix string) string
+}
+
+// timeGenerator 以纳秒时间戳作为ID，同一纳秒内的多次调用依次递增以保证唯一
+type timeGenerator struct {
+	clock clock.Clock
+	mu    sync.Mutex
+	last  int64
+}
+
+// NewTimeGenerator 创建基于时间戳的ID生成器，生成形如 prefix_1700000000000000000 的ID
+func NewTimeGenerator(c clock.Clock) Generator {
+	return &timeGenerator{clock: c}
+}
+
+func (g *timeGenerator) NewID(prefix string) string {
+	g.mu.Lock()
+	n := g.clock.Now().UnixNano()
+	if n <= g.last {
+		n = g.last + 1
+	}
+	g.last = n
+	g.mu.Unlock()
+
+	return fmt.Sprintf("%s_%d", prefix, n)
+}
+
+// sequenceGenerator 按调用顺序递增的ID生成器
+type sequenceGenerator struct {
+	mu   sync.Mutex
+	next int64
+}
+
+// NewSequence 创建从 start 开始递增的ID生成器，生成形如 prefix_1 的ID
+func NewSequence(start int64) Generator {
+	return &sequenceGenerator{next: start}
+}
+
+func (g *sequenceGenerator) NewID(prefix string) string {
+	g.mu.Lock()
+	n := g.next
+	g.next++
+	g.mu.Unlock()
+
+	return fmt.Sprintf("%s_%d", prefix, n)
+}
@@ -84,3 +84,28 @@ func VerifyPassword(password, encodedHash string) (bool, error) {
 	// 使用恒定时间比较防止时序攻击
 	return subtle.ConstantTimeCompare(hash, newHash) == 1, nil
 }
+
+// NeedsRehash 判断哈希是否使用了旧的 Argon2 参数，需要在下次登录时重新哈希
+func NeedsRehash(encodedHash string) bool {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return true
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return true
+	}
+
+	var m, t, p int
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &m, &t, &p); err != nil {
+		return true
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return true
+	}
+
+	return m != memory || t != time || p != threads || len(hash) != keyLen
+}
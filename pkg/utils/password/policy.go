@@ -0,0 +1,97 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrTooShort 密码长度不足
+	ErrTooShort = errors.New("password is too short")
+	// ErrTooLong 密码过长
+	ErrTooLong = errors.New("password is too long")
+	// ErrBreached 密码出现在泄露密码列表中
+	ErrBreached = errors.New("password appears in a list of breached passwords")
+)
+
+// maxLength 密码最大长度，避免超长输入拖慢哈希计算
+const maxLength = 256
+
+// Policy 密码策略
+type Policy struct {
+	MinLength int
+	breached  map[string]struct{} // 泄露密码的 SHA-1 十六进制（大写）
+}
+
+// NewPolicy 创建密码策略，breachList 为空时不检查泄露列表
+//
+// 泄露列表每行一条，可以是明文密码，也可以是 HIBP 格式的 SHA-1 哈希（"HASH" 或 "HASH:count"）。
+func NewPolicy(minLength int, breachList string) (*Policy, error) {
+	p := &Policy{
+		MinLength: minLength,
+		breached:  make(map[string]struct{}),
+	}
+	if breachList == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(breachList)
+	if err != nil {
+		return nil, fmt.Errorf("opening breach list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading breach list: %w", err)
+	}
+
+	return p, nil
+}
+
+// Check 检查密码是否满足策略
+func (p *Policy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: minimum length is %d", ErrTooShort, p.MinLength)
+	}
+	if len(password) > maxLength {
+		return fmt.Errorf("%w: maximum length is %d bytes", ErrTooLong, maxLength)
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return ErrBreached
+	}
+	return nil
+}
+
+// sha1Hex 计算大写十六进制 SHA-1
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// isSHA1Hex 判断是否为 SHA-1 十六进制串
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
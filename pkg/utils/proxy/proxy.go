@@ -0,0 +1,280 @@
+// Package proxy 实现经出站代理建立 TCP 连接，支持 HTTP CONNECT 和 SOCKS5，供受限网络中的 agent 连接服务端
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DialFunc 建立到目标地址的连接
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewDialer 根据代理地址创建拨号函数，proxyURL 为空时直接连接
+//
+// 支持的格式：http://[user:pass@]host:port、https://...、socks5://[user:pass@]host:port、socks5h://...
+// socks5 在本地解析目标域名，socks5h 由代理解析。
+func NewDialer(proxyURL string, timeout time.Duration) (DialFunc, error) {
+	direct := &net.Dialer{Timeout: timeout}
+	if proxyURL == "" {
+		return direct.DialContext, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", proxyURL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialConnect(ctx, direct, u, addr)
+		}, nil
+	case "socks5", "socks5h":
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialSOCKS5(ctx, direct, u, addr)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
+	}
+}
+
+// proxyAddr 返回代理地址，未指定端口时使用协议默认端口
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "http":
+		return net.JoinHostPort(u.Hostname(), "80")
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	default:
+		return net.JoinHostPort(u.Hostname(), "1080")
+	}
+}
+
+// dialConnect 通过 HTTP CONNECT 建立隧道
+func dialConnect(ctx context.Context, d *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr(u))
+	if err != nil {
+		return nil, fmt.Errorf("dialing proxy: %w", err)
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy tls handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("writing connect request: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading connect response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused connect to %s: %s", addr, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn 保留读取 CONNECT 响应时多读的数据
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// SOCKS5 协议常量（RFC 1928 / RFC 1929）
+const (
+	socksVersion      = 0x05
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAuthNoAccept = 0xff
+	socksCmdConnect   = 0x01
+	socksAtypIPv4     = 0x01
+	socksAtypDomain   = 0x03
+	socksAtypIPv6     = 0x04
+)
+
+// dialSOCKS5 通过 SOCKS5 代理建立连接
+func dialSOCKS5(ctx context.Context, d *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port in %q", addr)
+	}
+
+	// socks5 在本地解析域名
+	if u.Scheme == "socks5" && net.ParseIP(host) == nil {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", host, err)
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("resolving %s: no addresses", host)
+		}
+		host = ips[0].IP.String()
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr(u))
+	if err != nil {
+		return nil, fmt.Errorf("dialing proxy: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	if err := socksHandshake(conn, u.User, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socksHandshake 完成认证协商和 CONNECT 请求
+func socksHandshake(conn net.Conn, user *url.Userinfo, host string, port int) error {
+	method := byte(socksAuthNone)
+	if user != nil {
+		method = socksAuthPassword
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return fmt.Errorf("socks5 greeting: %w", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5 greeting: %w", err)
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("socks5: unexpected version %d", reply[0])
+	}
+	switch reply[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		if user == nil {
+			return errors.New("socks5: proxy requires authentication")
+		}
+		password, _ := user.Password()
+		name := user.Username()
+		if len(name) > 255 || len(password) > 255 {
+			return errors.New("socks5: username or password too long")
+		}
+		msg := []byte{0x01, byte(len(name))}
+		msg = append(msg, name...)
+		msg = append(msg, byte(len(password)))
+		msg = append(msg, password...)
+		if _, err := conn.Write(msg); err != nil {
+			return fmt.Errorf("socks5 auth: %w", err)
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("socks5 auth: %w", err)
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: authentication failed")
+		}
+	case socksAuthNoAccept:
+		return errors.New("socks5: no acceptable authentication method")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d", reply[1])
+	}
+
+	req := []byte{socksVersion, socksCmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socksAtypIPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socksAtypIPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: host name too long: %s", host)
+		}
+		req = append(req, socksAtypDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+
+	// 跳过代理返回的绑定地址
+	var skip int
+	switch head[3] {
+	case socksAtypIPv4:
+		skip = net.IPv4len
+	case socksAtypIPv6:
+		skip = net.IPv6len
+	case socksAtypDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return fmt.Errorf("socks5 connect: %w", err)
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("socks5: unexpected address type %d", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+	return nil
+}